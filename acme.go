@@ -0,0 +1,597 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// acmeRenewBefore is how long before it expires a certificate is renewed.
+	acmeRenewBefore = 30 * 24 * time.Hour
+
+	// acmePropagationTimeout is how long to wait for a challenge TXT record
+	// to become visible before asking the CA to validate it anyway.
+	acmePropagationTimeout = 2 * time.Minute
+)
+
+// publicCerts provides certificates for --public-hostname, or is nil if no
+// public hostname is configured.
+var publicCerts *acmeManager
+
+// dnsProvider publishes the TXT records that prove control of a domain to
+// an ACME certificate authority in a DNS-01 challenge.
+type dnsProvider interface {
+	// present creates a TXT record named fqdn containing value.
+	present(ctx context.Context, fqdn, value string) error
+
+	// cleanUp removes the record created by present.
+	cleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// dnsProviders are the providers that --acme-dns-provider may name, each
+// constructed from --acme-dns-config.
+var dnsProviders = map[string]func(config string) (dnsProvider, error){
+	"cloudflare": newCloudflareDNS,
+	"exec":       newExecDNS,
+}
+
+// newDNSProvider returns the named DNS provider.
+func newDNSProvider(name, config string) (dnsProvider, error) {
+	newProvider, ok := dnsProviders[name]
+	if !ok {
+		names := make([]string, 0, len(dnsProviders))
+		for n := range dnsProviders {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown DNS provider %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return newProvider(config)
+}
+
+// execDNS is a DNS provider that runs a program as
+// "PROGRAM present|cleanup FQDN VALUE", for DNS hosts without a built-in provider.
+type execDNS struct {
+	program string
+}
+
+func newExecDNS(config string) (dnsProvider, error) {
+	if config == "" {
+		return nil, errors.New(`the "exec" DNS provider requires --acme-dns-config to name a program`)
+	}
+	return &execDNS{program: config}, nil
+}
+
+func (e *execDNS) present(ctx context.Context, fqdn, value string) error {
+	return e.run(ctx, "present", fqdn, value)
+}
+
+func (e *execDNS) cleanUp(ctx context.Context, fqdn, value string) error {
+	return e.run(ctx, "cleanup", fqdn, value)
+}
+
+func (e *execDNS) run(ctx context.Context, action, fqdn, value string) error {
+	out, err := exec.CommandContext(ctx, e.program, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %s", e.program, action, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// cloudflareDNS is a DNS provider for zones hosted by Cloudflare, using an
+// API token with the Zone:Read and DNS:Edit permissions.
+type cloudflareDNS struct {
+	token   string
+	baseURL string // overridden in tests
+}
+
+func newCloudflareDNS(config string) (dnsProvider, error) {
+	if config == "" {
+		return nil, errors.New(`the "cloudflare" DNS provider requires --acme-dns-config to name a file containing an API token`)
+	}
+	b, err := os.ReadFile(config)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return nil, fmt.Errorf("%s: empty API token", config)
+	}
+	return &cloudflareDNS{token: token, baseURL: "https://api.cloudflare.com/client/v4"}, nil
+}
+
+// call makes a Cloudflare API request, decoding the result into result if non-nil.
+func (c *cloudflareDNS) call(ctx context.Context, method, path string, body, result any) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := outboundClient(time.Minute).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success bool
+		Errors  []struct {
+			Code    int
+			Message string
+		}
+		Result json.RawMessage
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("cloudflare %s %s: %s", method, path, resp.Status)
+	}
+	if !envelope.Success {
+		var msgs []string
+		for _, e := range envelope.Errors {
+			msgs = append(msgs, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("cloudflare %s %s: %s", method, path, strings.Join(msgs, "; "))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+// zoneID returns the ID of the most specific zone containing fqdn.
+func (c *cloudflareDNS) zoneID(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := 0; i+2 <= len(labels); i++ {
+		var zones []struct{ ID string }
+		name := strings.Join(labels[i:], ".")
+		if err := c.call(ctx, "GET", "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no Cloudflare zone found for %s", fqdn)
+}
+
+func (c *cloudflareDNS) present(ctx context.Context, fqdn, value string) error {
+	zone, err := c.zoneID(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	record := map[string]any{
+		"type":    "TXT",
+		"name":    strings.TrimSuffix(fqdn, "."),
+		"content": value,
+		"ttl":     120,
+	}
+	return c.call(ctx, "POST", "/zones/"+zone+"/dns_records", record, nil)
+}
+
+func (c *cloudflareDNS) cleanUp(ctx context.Context, fqdn, value string) error {
+	zone, err := c.zoneID(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	q := url.Values{
+		"type":    {"TXT"},
+		"name":    {strings.TrimSuffix(fqdn, ".")},
+		"content": {value},
+	}
+	var records []struct{ ID string }
+	if err := c.call(ctx, "GET", "/zones/"+zone+"/dns_records?"+q.Encode(), nil, &records); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := c.call(ctx, "DELETE", "/zones/"+zone+"/dns_records/"+r.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acmeManager obtains and renews the certificate for a single hostname
+// using DNS-01 challenges, caching its ACME account key and the current
+// certificate in a directory so they survive restarts.
+type acmeManager struct {
+	client *acme.Client
+	host   string
+	email  string
+	dir    string
+	dns    dnsProvider
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+// newACMEManager returns a manager for host's certificate, loading any
+// previously issued certificate from dir.
+func newACMEManager(host, directoryURL, email, dir string, dns dnsProvider) (*acmeManager, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	key, err := loadAccountKey(filepath.Join(dir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+	m := &acmeManager{
+		client: &acme.Client{Key: key, DirectoryURL: directoryURL, UserAgent: "golink"},
+		host:   host,
+		email:  email,
+		dir:    dir,
+		dns:    dns,
+	}
+	cert, err := loadCertificate(m.certFile())
+	if err == nil {
+		m.cert = cert
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("acme: ignoring cached certificate: %v", err)
+	}
+	return m, nil
+}
+
+func (m *acmeManager) certFile() string {
+	return filepath.Join(m.dir, m.host+".pem")
+}
+
+// loadAccountKey reads the ACME account key from file, creating one if
+// it does not exist.
+func loadAccountKey(file string) (*ecdsa.PrivateKey, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		pemKey := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		return key, os.WriteFile(file, pemKey, 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM key", file)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// loadCertificate reads a certificate chain and its key from a single PEM file.
+func loadCertificate(file string) (*tls.Certificate, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := tls.X509KeyPair(b, b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &cert, nil
+}
+
+// getCertificate implements tls.Config.GetCertificate.
+func (m *acmeManager) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if !strings.EqualFold(hello.ServerName, m.host) {
+		return nil, fmt.Errorf("acme: no certificate for %q", hello.ServerName)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cert == nil {
+		return nil, fmt.Errorf("acme: certificate for %q has not been issued yet", m.host)
+	}
+	return m.cert, nil
+}
+
+// needsRenewal reports whether there is no certificate, or it expires
+// within acmeRenewBefore of now.
+func (m *acmeManager) needsRenewal(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cert == nil || m.cert.Leaf == nil || now.Add(acmeRenewBefore).After(m.cert.Leaf.NotAfter)
+}
+
+// renew obtains a new certificate if the current one is missing or due for
+// renewal, and is otherwise a no-op.
+func (m *acmeManager) renew(ctx context.Context) error {
+	if !m.needsRenewal(time.Now()) {
+		return nil
+	}
+	chain, key, err := m.obtain(ctx)
+	if err != nil {
+		return fmt.Errorf("obtaining certificate for %s: %w", m.host, err)
+	}
+
+	var buf bytes.Buffer
+	for _, der := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pem.Encode(&buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(buf.Bytes(), buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.certFile(), buf.Bytes(), 0o600); err != nil {
+		log.Printf("acme: caching certificate: %v", err)
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	log.Printf("acme: obtained certificate for %s, valid until %v", m.host, cert.Leaf.NotAfter)
+	return nil
+}
+
+// obtain runs an ACME order for m.host, returning the DER certificate chain
+// and its private key.
+func (m *acmeManager) obtain(ctx context.Context) ([][]byte, *ecdsa.PrivateKey, error) {
+	acct := &acme.Account{}
+	if m.email != "" {
+		acct.Contact = []string{"mailto:" + m.email}
+	}
+	if _, err := m.client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, nil, fmt.Errorf("registering ACME account: %w", err)
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.host))
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, u := range order.AuthzURLs {
+		if err := m.authorize(ctx, u); err != nil {
+			return nil, nil, err
+		}
+	}
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{m.host}}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chain, key, nil
+}
+
+// authorize completes the DNS-01 challenge of the authorization at url.
+func (m *acmeManager) authorize(ctx context.Context, url string) error {
+	authz, err := m.client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+	value, err := m.client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+
+	fqdn := "_acme-challenge." + authz.Identifier.Value + "."
+	if err := m.dns.present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("creating TXT record %s: %w", fqdn, err)
+	}
+	defer func() {
+		if err := m.dns.cleanUp(context.WithoutCancel(ctx), fqdn, value); err != nil {
+			log.Printf("acme: removing TXT record %s: %v", fqdn, err)
+		}
+	}()
+	waitForTXT(ctx, fqdn, value)
+
+	if _, err := m.client.Accept(ctx, chal); err != nil {
+		return err
+	}
+	_, err = m.client.WaitAuthorization(ctx, url)
+	return err
+}
+
+// waitForTXT waits up to acmePropagationTimeout for a TXT record of fqdn to
+// contain value, so that the CA is not asked to validate a record it cannot
+// see yet.
+func waitForTXT(ctx context.Context, fqdn, value string) {
+	ctx, cancel := context.WithTimeout(ctx, acmePropagationTimeout)
+	defer cancel()
+	for {
+		txts, _ := net.DefaultResolver.LookupTXT(ctx, fqdn)
+		if slices.Contains(txts, value) {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("acme: TXT record %s not visible after %v, continuing", fqdn, acmePropagationTimeout)
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// setupPublicCerts configures publicCerts from the --public-hostname and
+// --acme-* flags.
+func setupPublicCerts() error {
+	if *publicHostname == "" {
+		return nil
+	}
+	if *acmeDNS == "" {
+		return errors.New("--public-hostname requires --acme-dns-provider")
+	}
+	dns, err := newDNSProvider(*acmeDNS, *acmeDNSConfig)
+	if err != nil {
+		return fmt.Errorf("--acme-dns-provider: %w", err)
+	}
+	dir := *acmeCacheDir
+	if dir == "" {
+		confDir, err := os.UserConfigDir()
+		if err != nil {
+			return fmt.Errorf("--acme-cache-dir: %w", err)
+		}
+		dir = filepath.Join(confDir, "golink", "acme")
+	}
+	publicCerts, err = newACMEManager(*publicHostname, *acmeDirectory, *acmeEmail, dir, dns)
+	return err
+}
+
+// servePublicHost serves links tagged --public-tag on --public-listen over
+// TLS, with certificates from publicCerts.
+func servePublicHost() error {
+	ln, err := net.Listen("tcp", *publicListen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           HSTS(http.HandlerFunc(servePublic)),
+		TLSConfig:         &tls.Config{GetCertificate: publicCerts.getCertificate},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := publicCerts.renew(context.Background()); err != nil {
+			log.Printf("acme: %v", err)
+		}
+	}()
+	addProbeTarget("public", "https://"+*publicHostname, http.DefaultClient)
+	go func() {
+		log.Printf("Serving public links on https://%s/ ...", *publicHostname)
+		if err := srv.ServeTLS(ln, "", ""); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	return nil
+}
+
+// publicInterstitialData is the data used by publicInterstitialTmpl.
+type publicInterstitialData struct {
+	Hostname   string // --public-hostname
+	Short      string
+	Target     string // expanded destination of the link
+	Disclaimer string // --public-disclaimer
+}
+
+// servePublic resolves links tagged --public-tag for anonymous visitors to
+// --public-hostname. Every other request gets a 404, so that nothing else
+// golink serves is reachable from the internet.
+//
+// If --public-disclaimer is set, browsers are shown it on a page linking to
+// the destination rather than being redirected. Clicks are counted as
+// external either way.
+func servePublic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	short, remainder, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if short == "" || strings.HasPrefix(short, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	link, err := loadLink(short)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("serving public %q: %v", short, err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	// one-time links and links pending deletion stay private
+	if !link.HasTag(*publicTag) || link.MaxUses > 0 || linkExpired(link, time.Now()) {
+		http.NotFound(w, r)
+		return
+	}
+
+	env := expandEnv{Now: time.Now().UTC(), Path: remainder}
+	if r.URL.RawQuery != "" {
+		env.query = r.URL.Query()
+	}
+	target, err := expandLinkTarget(link, resolveTarget(link), env)
+	if err == nil {
+		err = appendParams(link, target, env)
+	}
+	if errors.Is(err, errNoUser) {
+		// anonymous visitors have no user to expand the link for
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("expanding public %q: %v", link.Short, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	countExternalClick(link.Short)
+	countClickSource(link.Short, remainder, r.Referer())
+	setLinkHeaders(w, link)
+	if *publicDisclaimer != "" && acceptHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		publicInterstitialTmpl.Execute(w, publicInterstitialData{
+			Hostname:   *publicHostname,
+			Short:      link.Short,
+			Target:     target.String(),
+			Disclaimer: *publicDisclaimer,
+		})
+		return
+	}
+	w.Header().Set("Location", target.String())
+	redirectsServed.Add(1)
+	w.WriteHeader(http.StatusFound)
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCloudflareDNS(t *testing.T) {
+	var mu sync.Mutex
+	records := map[string]string{} // id -> "name content"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			fmt.Fprint(w, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		var result any = []any{}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/zones":
+			if r.URL.Query().Get("name") == "example.com" {
+				result = []map[string]string{{"id": "zone1"}}
+			}
+		case r.Method == "POST" && r.URL.Path == "/zones/zone1/dns_records":
+			var rec struct{ Type, Name, Content string }
+			json.NewDecoder(r.Body).Decode(&rec)
+			if rec.Type != "TXT" {
+				t.Errorf("created record type %q; want TXT", rec.Type)
+			}
+			records[fmt.Sprint(len(records)+1)] = rec.Name + " " + rec.Content
+		case r.Method == "GET" && r.URL.Path == "/zones/zone1/dns_records":
+			var ids []map[string]string
+			want := r.URL.Query().Get("name") + " " + r.URL.Query().Get("content")
+			for id, rec := range records {
+				if rec == want {
+					ids = append(ids, map[string]string{"id": id})
+				}
+			}
+			result = ids
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/zones/zone1/dns_records/"):
+			delete(records, strings.TrimPrefix(r.URL.Path, "/zones/zone1/dns_records/"))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	fqdn := "_acme-challenge.links.example.com."
+	dns := &cloudflareDNS{token: "secret", baseURL: srv.URL}
+	if err := dns.present(ctx, fqdn, "value1"); err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	if got, want := records["1"], "_acme-challenge.links.example.com value1"; got != want {
+		t.Errorf("record = %q; want %q", got, want)
+	}
+	if err := dns.cleanUp(ctx, fqdn, "value1"); err != nil {
+		t.Fatalf("cleanUp: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("records left after cleanUp: %v", records)
+	}
+
+	if err := dns.present(ctx, "_acme-challenge.example.org.", "value"); err == nil {
+		t.Error("present succeeded for a domain without a zone")
+	}
+	dns.token = "wrong"
+	if err := dns.present(ctx, fqdn, "value"); err == nil || !strings.Contains(err.Error(), "Authentication error") {
+		t.Errorf("present with a bad token = %v; want authentication error", err)
+	}
+}
+
+func TestExecDNS(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "dns.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	dns, err := newDNSProvider("exec", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := dns.present(ctx, "_acme-challenge.example.com.", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dns.cleanUp(ctx, "_acme-challenge.example.com.", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "present _acme-challenge.example.com. abc\ncleanup _acme-challenge.example.com. abc\n"
+	if string(b) != want {
+		t.Errorf("script calls = %q; want %q", b, want)
+	}
+
+	if _, err := newDNSProvider("route53", ""); err == nil {
+		t.Error("newDNSProvider succeeded for an unknown provider")
+	}
+	if _, err := newDNSProvider("exec", ""); err == nil {
+		t.Error("newDNSProvider succeeded for exec without a program")
+	}
+}
+
+func TestServePublic(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "launch", Long: "https://example.com/launch", Tags: []string{"public"}})
+	db.Save(&Link{Short: "internal", Long: "https://wiki.example.com/"})
+
+	oldHostname, oldDisclaimer := *publicHostname, *publicDisclaimer
+	t.Cleanup(func() { *publicHostname, *publicDisclaimer = oldHostname, oldDisclaimer })
+	*publicHostname = "links.example.com"
+	stats.mu.Lock()
+	stats.clicks, stats.dirty, stats.external = nil, nil, nil
+	stats.mu.Unlock()
+
+	get := func(path string, html bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		if html {
+			r.Header.Set("Accept", "text/html")
+		}
+		w := httptest.NewRecorder()
+		servePublic(w, r)
+		return w
+	}
+
+	if w := get("/internal", true); w.Code != http.StatusNotFound {
+		t.Errorf("GET /internal = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	w := get("/launch", true)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "https://example.com/launch" {
+		t.Errorf("GET /launch = %d to %q; want redirect", w.Code, w.Header().Get("Location"))
+	}
+
+	*publicDisclaimer = "You are leaving Example Corp."
+	w = get("/launch", true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /launch with disclaimer = %d; want %d", w.Code, http.StatusOK)
+	}
+	for _, want := range []string{"You are leaving Example Corp.", `href="https://example.com/launch"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("interstitial does not contain %q:\n%s", want, w.Body.String())
+		}
+	}
+	if w := get("/launch", false); w.Code != http.StatusFound {
+		t.Errorf("GET /launch without HTML = %d; want %d", w.Code, http.StatusFound)
+	}
+
+	countClick("launch")
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if got := stats.dirty["launch"]; got != 4 {
+		t.Errorf("launch clicks = %d; want 4", got)
+	}
+	if got := stats.external["launch"]; got != 3 {
+		t.Errorf("launch external clicks = %d; want 3", got)
+	}
+}
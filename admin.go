@@ -0,0 +1,243 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+// adminShortName is used as the short name for generating XSRF tokens for
+// the admin console.
+const adminShortName = ".admin"
+
+// adminData is the data used by adminTmpl.
+type adminData struct {
+	// Admins are the logins granted admin access by --admins. Admins may
+	// also be granted by the identity provider, who are not listed.
+	Admins []string
+
+	Links  int // number of links
+	Clicks int // total clicks of all links, as of the last stats flush
+
+	Jobs     []jobStatus
+	JobsXSRF string
+
+	// Webhooks is whether --webhooks is set, with the number of pending
+	// deliveries and recent deliveries that failed.
+	Webhooks        bool
+	WebhooksPending int
+	WebhooksFailed  int
+
+	// Ready is whether /readyz succeeds.
+	Ready bool
+
+	ReadOnly bool
+	XSRF     string
+
+	// Message reports the result of reassigning links.
+	Message string
+}
+
+// serveAdmin serves the admin console, which summarizes golink's state and
+// links to admin-only pages. A POST request reassigns every link owned by
+// the "from" owner to the "to" owner, such as when someone leaves. Only
+// admins may use the console.
+func serveAdmin(w http.ResponseWriter, r *http.Request) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "admin console")
+		http.Error(w, "only admins can use the admin console", http.StatusForbidden)
+		return
+	}
+
+	data := adminData{
+		ReadOnly: *readonly,
+		XSRF:     xsrftoken.Generate(xsrfKey, cu.login, adminShortName),
+		JobsXSRF: xsrftoken.Generate(xsrfKey, cu.login, jobsShortName),
+		Ready:    resolveSLO.ready(),
+	}
+	if r.Method == "POST" {
+		if *readonly {
+			http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+			return
+		}
+		if !isRequestAuthorized(r, cu, adminShortName) {
+			http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+			return
+		}
+		from, to := strings.TrimSpace(r.FormValue("from")), strings.TrimSpace(r.FormValue("to"))
+		if from == "" || to == "" {
+			http.Error(w, "from and to owners required", http.StatusBadRequest)
+			return
+		}
+		exists, err := userExists(r.Context(), to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "new owner not a valid user: "+to, http.StatusBadRequest)
+			return
+		}
+		links, err := reassignLinks(r, cu, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Message = fmt.Sprintf("Reassigned %d links from %s to %s.", len(links), from, to)
+	}
+
+	for login := range adminLogins {
+		data.Admins = append(data.Admins, login)
+	}
+	slices.Sort(data.Admins)
+
+	if err := flushStats(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	links, err := db.LoadAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Links = len(links)
+	for _, link := range links {
+		data.Clicks += link.TotalClicks
+	}
+
+	jobsMu.Lock()
+	all := slices.Clone(jobs)
+	jobsMu.Unlock()
+	for _, j := range all {
+		data.Jobs = append(data.Jobs, j.status())
+	}
+
+	if webhooks != nil {
+		l := webhooks.deliveries()
+		data.Webhooks = true
+		data.WebhooksPending = len(l.Pending)
+		for _, d := range l.Recent {
+			if d.Status == "failed" {
+				data.WebhooksFailed++
+			}
+		}
+	}
+
+	adminTmpl.Execute(w, data)
+}
+
+// ownerTransferRequest is the body of a request to
+// /.api/v1/owners/{owner}/transfer.
+type ownerTransferRequest struct {
+	To string // the new owner
+}
+
+// ownerTransferResponse is the response to an owner transfer.
+type ownerTransferResponse struct {
+	From  string
+	To    string
+	Links []string // short names of the transferred and co-owned links, sorted
+}
+
+// serveOwnerTransfer handles POST /.api/v1/owners/{owner}/transfer, which
+// reassigns every link owned or co-owned by owner to the owner in the
+// request body in a single transaction, such as when someone leaves. Only
+// admins may transfer links.
+func serveOwnerTransfer(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	from, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/.api/v1/owners/"), "/transfer")
+	if !ok || from == "" || strings.Contains(from, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ownerTransferRequest
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	to := strings.TrimSpace(req.To)
+	if to == "" {
+		http.Error(w, "To required", http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "owner transfer")
+		http.Error(w, "only admins can transfer links", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, adminShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	exists, err := userExists(r.Context(), to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "new owner not a valid user: "+to, http.StatusBadRequest)
+		return
+	}
+
+	links, err := reassignLinks(r, cu, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := ownerTransferResponse{From: from, To: to, Links: make([]string, len(links))}
+	for i, link := range links {
+		resp.Links[i] = link.Short
+	}
+	slices.Sort(resp.Links)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// reassignLinks transfers every link owned or co-owned by the owner from to
+// the owner to, on behalf of the admin cu, all at once. It returns the links
+// changed.
+func reassignLinks(r *http.Request, cu user, from, to string) ([]*Link, error) {
+	owner, err := recordOwner(to)
+	if err != nil {
+		return nil, err
+	}
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		return nil, err
+	}
+	old, links, err := db.TransferOwner(storedOwner(from), owner, editor)
+	if err != nil {
+		return nil, err
+	}
+	for i, link := range links {
+		linkChanges.Add("edit", 1)
+		linkTemplates.invalidate(link.Short)
+		notifyLinkChange(cu.login, old[i], link)
+	}
+	audit(r, cu, "owner.transfer", "", fmt.Sprintf("from=%s to=%s links=%d", from, to, len(links)))
+	return links, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+func TestServeAdmin(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "a", Long: "/a", Owner: "departed@example.com"})
+	db.Save(&Link{Short: "b", Long: "/b", Owner: "departed@example.com"})
+	db.Save(&Link{Short: "c", Long: "/c", Owner: "foo@example.com"})
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	w := httptest.NewRecorder()
+	serveAdmin(w, httptest.NewRequest("GET", "/.admin", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin GET /.admin = %d; want %d", w.Code, http.StatusForbidden)
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com", isAdmin: true}, nil }
+	w = httptest.NewRecorder()
+	serveAdmin(w, httptest.NewRequest("GET", "/.admin", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin GET /.admin = %d; want %d", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), "3 links") {
+		t.Errorf("admin console does not count 3 links:\n%s", w.Body.String())
+	}
+
+	reassign := func(xsrf string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/.admin", strings.NewReader(url.Values{
+			"from": {"departed@example.com"},
+			"to":   {"bar@example.com"},
+			"xsrf": {xsrf},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		serveAdmin(w, r)
+		return w
+	}
+	if w := reassign("invalid"); w.Code != http.StatusBadRequest {
+		t.Errorf("reassign with invalid xsrf = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	w = reassign(xsrftoken.Generate(xsrfKey, "foo@example.com", adminShortName))
+	if w.Code != http.StatusOK {
+		t.Fatalf("reassign = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "Reassigned 2 links") {
+		t.Errorf("reassign response does not report 2 links:\n%s", w.Body.String())
+	}
+	for short, want := range map[string]string{"a": "bar@example.com", "b": "bar@example.com", "c": "foo@example.com"} {
+		link, err := db.Load(short)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Owner != want {
+			t.Errorf("%s owner = %q; want %q", short, link.Owner, want)
+		}
+	}
+}
+
+func TestServeOwnerTransfer(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "a", Long: "/a", Owner: "departed@example.com"})
+	db.Save(&Link{Short: "b", Long: "/b", Owner: "departed@example.com"})
+	db.Save(&Link{Short: "c", Long: "/c", Owner: "foo@example.com"})
+	db.Save(&Link{Short: "d", Long: "/d", Owner: "foo@example.com", CoOwners: []string{"departed@example.com"}})
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	transfer := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		serveOwnerTransfer(w, r)
+		return w
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	if w := transfer("/.api/v1/owners/departed@example.com/transfer", `{"To": "bar@example.com"}`); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin transfer = %d; want %d", w.Code, http.StatusForbidden)
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com", isAdmin: true}, nil }
+	if w := transfer("/.api/v1/owners/departed@example.com", `{"To": "bar@example.com"}`); w.Code != http.StatusNotFound {
+		t.Errorf("transfer without /transfer = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	if w := transfer("/.api/v1/owners/departed@example.com/transfer", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("transfer without To = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	w := transfer("/.api/v1/owners/departed@example.com/transfer", `{"To": "bar@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("transfer = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp ownerTransferResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "d"}; !slices.Equal(resp.Links, want) {
+		t.Errorf("transferred links = %q; want %q", resp.Links, want)
+	}
+	for short, want := range map[string]string{"a": "bar@example.com", "b": "bar@example.com", "c": "foo@example.com", "d": "foo@example.com"} {
+		link, err := db.Load(short)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Owner != want {
+			t.Errorf("%s owner = %q; want %q", short, link.Owner, want)
+		}
+	}
+	d, err := db.Load("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"bar@example.com"}; !slices.Equal(d.CoOwners, want) {
+		t.Errorf("d co-owners = %q; want %q", d.CoOwners, want)
+	}
+	revs, err := db.LoadHistory("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := revs[len(revs)-1]; last.Editor != "foo@example.com" {
+		t.Errorf("d's last revision was made by %q; want the transfer by foo@example.com", last.Editor)
+	}
+}
@@ -0,0 +1,678 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The links API at /.api/v1/links is a JSON interface to the same
+// operations as the web UI:
+//
+//	GET    /.api/v1/links                 list links, optionally filtered by a query
+//	POST   /.api/v1/links                 create a link, failing if it exists
+//	GET    /.api/v1/links/{short}         get a link
+//	PUT    /.api/v1/links/{short}         create or update a link
+//	PATCH  /.api/v1/links/{short}         update some fields of a link
+//	DELETE /.api/v1/links/{short}         delete a link
+//	GET    /.api/v1/links/{short}/clicks  break down a link's clicks by path or referrer
+//
+// Links are returned as JSON Link objects, and errors as an apiError.
+// Creates and updates may be safely retried with an Idempotency-Key header.
+// PATCH takes an RFC 6902 JSON Patch or an RFC 7386 JSON Merge Patch of
+// the link's linkPatchDocument.
+
+// apiError is the JSON body of an API error response.
+type apiError struct {
+	Error string
+}
+
+// apiLinkRequest is the JSON body of a request to create or update a link.
+// Fields that are omitted are left unchanged when updating a link.
+type apiLinkRequest struct {
+	Short             string // only used when creating with POST
+	Long              string
+	Owner             string
+	Tags              *[]string
+	CoOwners          *[]string
+	Fallbacks         *[]string
+	MaintenanceTarget *string
+	Successor         *string
+	Headers           *map[string]string
+	Params            *string
+	MaxUses           *int
+	HealthCheck       *string
+	Expires           *string // as accepted by parseExpires, or "" to never expire
+	Version           int     // if set, the update fails unless the link is at this version
+}
+
+// form returns the form values that serveSave expects for req.
+func (req *apiLinkRequest) form(short string) url.Values {
+	form := url.Values{
+		"short": {short},
+		"long":  {req.Long},
+	}
+	if req.Owner != "" {
+		form.Set("owner", req.Owner)
+	}
+	if req.Tags != nil {
+		form.Set("tags", strings.Join(*req.Tags, " "))
+	}
+	if req.CoOwners != nil {
+		form.Set("co_owners", strings.Join(*req.CoOwners, " "))
+	}
+	if req.Fallbacks != nil {
+		form.Set("fallbacks", strings.Join(*req.Fallbacks, "\n"))
+	}
+	if req.MaintenanceTarget != nil {
+		form.Set("maintenance_target", *req.MaintenanceTarget)
+	}
+	if req.Successor != nil {
+		form.Set("successor", *req.Successor)
+	}
+	if req.Headers != nil {
+		form.Set("headers", formatLinkHeaders(*req.Headers))
+	}
+	if req.Params != nil {
+		form.Set("params", *req.Params)
+	}
+	if req.HealthCheck != nil {
+		form.Set("health_check", *req.HealthCheck)
+	}
+	if req.MaxUses != nil {
+		form.Set("max_uses", strconv.Itoa(*req.MaxUses))
+	}
+	if req.Expires != nil {
+		form.Set("expires", *req.Expires)
+	}
+	if req.Version != 0 {
+		form.Set("version", strconv.Itoa(req.Version))
+	}
+	return form
+}
+
+// apiWriter is an http.ResponseWriter that rewrites plain text error
+// responses, as written by http.Error, as JSON apiErrors. Error responses
+// that are already JSON, such as save conflicts, are left unchanged.
+type apiWriter struct {
+	http.ResponseWriter
+	okStatus    int // status to send instead of 200 OK, if set
+	wroteHeader bool
+	errStatus   int // status of an error response, if any
+	errBody     strings.Builder
+}
+
+func (w *apiWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		w.errStatus = code
+		return
+	}
+	if code == http.StatusOK && w.okStatus != 0 {
+		code = w.okStatus
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *apiWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.errStatus != 0 {
+		return w.errBody.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, so that
+// http.ResponseController can flush streamed responses.
+func (w *apiWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the buffered error response, if any.
+func (w *apiWriter) finish() {
+	if w.errStatus == 0 {
+		return
+	}
+	h := w.Header()
+	h.Del("X-Content-Type-Options")
+	h.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.errStatus)
+	json.NewEncoder(w.ResponseWriter).Encode(apiError{Error: strings.TrimSpace(w.errBody.String())})
+}
+
+// serveAPI calls h with errors written as JSON, sending okStatus rather
+// than 200 OK for successful responses if it is non-zero.
+func serveAPI(w http.ResponseWriter, r *http.Request, okStatus int, h http.HandlerFunc) {
+	aw := &apiWriter{ResponseWriter: w, okStatus: okStatus}
+	h(aw, r)
+	aw.finish()
+}
+
+// maxAPIPageSize is the largest number of links returned in one page.
+const maxAPIPageSize = 1000
+
+// serveAPILinks lists links or creates a new one.
+//
+// Links are listed sorted by ID, their normalized short name. The "q"
+// parameter filters them by a query expression, whose free text terms also
+// match their synonyms, and "health=broken" limits them to those whose
+// destination the dead link checker found broken. If "limit" is set, at most
+// that many links after the short name in "after" are returned, and a Link
+// header with rel="next" gives the URL of the next page. TotalClicks
+// include clicks up to the last time stats were saved.
+//
+// With "sort=score", links are instead ranked best first by their search
+// score for the current user, and "limit" returns only the best links.
+func serveAPILinks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		serveAPI(w, r, 0, serveListLinks)
+	case "POST":
+		serveAPI(w, r, http.StatusCreated, idempotent(serveCreateLink))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		serveAPI(w, r, 0, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		})
+	}
+}
+
+func serveListLinks(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if s := r.FormValue("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAPIPageSize {
+			http.Error(w, fmt.Sprintf("limit must be a number from 1 to %d", maxAPIPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	after := r.FormValue("after")
+	sortBy := r.FormValue("sort")
+	switch sortBy {
+	case "", "short":
+	case "score":
+		if after != "" {
+			http.Error(w, "after cannot be used with sort=score", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, fmt.Sprintf("unknown sort %q: use short or score", sortBy), http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseLinkQuery(r.FormValue("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch health := r.FormValue("health"); health {
+	case "":
+	case "broken":
+		q.terms = append(q.terms, queryTerm{field: "is", op: ":", value: "broken"})
+	default:
+		http.Error(w, fmt.Sprintf("unknown health %q: use broken", health), http.StatusBadRequest)
+		return
+	}
+	q.withSynonyms(synonymsOf)
+	cond, args, err := q.sql()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// as in the web UI, one-time links are only listed for their editors
+	hidden := func(l *Link) bool {
+		return l.MaxUses > 0 && !authz.canEdit(r.Context(), cu, l)
+	}
+	if sortBy == "score" {
+		links, err := db.LoadWhere(cond, args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		links = slices.DeleteFunc(links, hidden)
+		newLinkScorer(searchWeights, q, cu, links, time.Now()).sortByScore(links)
+		if limit > 0 && len(links) > limit {
+			links = links[:limit]
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(links)
+		return
+	}
+
+	// hidden links are dropped from pages after loading them, so pages
+	// are topped up until they are full or there are no more links
+	var links []*Link
+	for cursor := after; ; {
+		n := 0
+		if limit > 0 {
+			n = limit - len(links)
+		}
+		page, err := db.LoadPage(cond, cursor, n, args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		links = append(links, slices.DeleteFunc(slices.Clone(page), hidden)...)
+		if n == 0 || len(page) < n || len(links) == limit {
+			break
+		}
+		cursor = page[len(page)-1].Short
+	}
+	if limit > 0 && len(links) == limit {
+		next := url.Values{"limit": {strconv.Itoa(limit)}, "after": {links[limit-1].Short}}
+		if q := r.FormValue("q"); q != "" {
+			next.Set("q", q)
+		}
+		if health := r.FormValue("health"); health != "" {
+			next.Set("health", health)
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// serveCreateLink creates the link in the JSON request body, failing with
+// 409 Conflict if a link with the same short name exists.
+func serveCreateLink(w http.ResponseWriter, r *http.Request) {
+	var req apiLinkRequest
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	if req.Short == "" {
+		http.Error(w, "Short required", http.StatusBadRequest)
+		return
+	}
+	_, err := db.Load(req.Short)
+	if err == nil {
+		http.Error(w, req.Short+" already exists", http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	saveAPILink(w, r, req.Short, &req)
+}
+
+// serveAPILink gets, updates, or deletes the link named by the request path.
+func serveAPILink(w http.ResponseWriter, r *http.Request) {
+	short := strings.TrimPrefix(r.URL.Path, "/.api/v1/links/")
+	serveAPI(w, r, 0, func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := strings.CutSuffix(short, "/clicks"); ok && s != "" && !strings.Contains(s, "/") {
+			serveLinkClicks(w, r, s)
+			return
+		}
+		if short == "" || strings.Contains(short, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET", "HEAD":
+			serveGetLink(w, r, short)
+		case "PUT":
+			idempotent(func(w http.ResponseWriter, r *http.Request) {
+				var req apiLinkRequest
+				if decodeAPIRequest(w, r, &req) {
+					saveAPILink(w, r, short, &req)
+				}
+			})(w, r)
+		case "PATCH":
+			idempotent(func(w http.ResponseWriter, r *http.Request) {
+				servePatchLink(w, r, short)
+			})(w, r)
+		case "DELETE":
+			serveDeleteLink(w, r, short)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, PATCH, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func serveGetLink(w http.ResponseWriter, r *http.Request, short string) {
+	link, ok := loadVisibleLink(w, r, short)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// loadVisibleLink loads the link short for the API, responding with an
+// error and returning false if it doesn't exist or can't be shown to the
+// current user.
+func loadVisibleLink(w http.ResponseWriter, r *http.Request, short string) (*Link, bool) {
+	link, err := db.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if link.MaxUses > 0 {
+		// as on the detail page, one-time links are only shown to editors
+		cu, err := currentUser(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+		if !authz.canEdit(r.Context(), cu, link) {
+			http.NotFound(w, r)
+			return nil, false
+		}
+	}
+	return link, true
+}
+
+// clickBreakdownLimit is the most paths or referrers returned by
+// /.api/v1/links/{short}/clicks.
+const clickBreakdownLimit = 100
+
+// serveLinkClicks handles GET /.api/v1/links/{short}/clicks, which breaks
+// down the clicks of a link over the last days days (30 by default) by the
+// path requested under it, by referring host, or by day, as chosen by by
+// ("path", "referrer", or "day"). The most clicked paths and referrers are
+// listed first, and days in order. Days begin at midnight in the time zone
+// tz, which defaults to --stats-timezone, so that they can match a team's
+// working days.
+func serveLinkClicks(w http.ResponseWriter, r *http.Request, short string) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	by := cmp.Or(r.FormValue("by"), "path")
+	if by != "path" && by != "referrer" && by != "day" {
+		http.Error(w, `by must be "path", "referrer", or "day"`, http.StatusBadRequest)
+		return
+	}
+	loc := statsLocation
+	if v := r.FormValue("tz"); v != "" {
+		var err error
+		if loc, err = parseStatsTimezone(v); err != nil {
+			http.Error(w, "invalid tz: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	days := 30
+	if v := r.FormValue("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "days must be a positive number", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	link, ok := loadVisibleLink(w, r, short)
+	if !ok {
+		return
+	}
+	if err := flushStats(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	since := time.Now().AddDate(0, 0, -days)
+	var counts []ClickCount
+	var err error
+	if by == "day" {
+		// whole days, the last of which is today
+		since = startOfDay(time.Now(), loc).AddDate(0, 0, 1-days)
+		counts, err = db.LoadDailyClicks(link.Short, since, loc)
+	} else {
+		counts, err = db.LoadClickBreakdown(link.Short, by, since, clickBreakdownLimit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Short  string
+		By     string
+		Since  time.Time
+		Clicks []ClickCount
+	}{link.Short, by, since.In(loc).Truncate(time.Second), counts})
+}
+
+// saveAPILink saves the link in req with the given short name, using the
+// same validation and authorization as the edit form.
+func saveAPILink(w http.ResponseWriter, r *http.Request, short string, req *apiLinkRequest) {
+	form := req.form(short)
+	if link, err := db.Load(short); err == nil {
+		// unlike the edit form, an update need not repeat the destination,
+		// and leaves the owner unchanged unless one is given
+		if req.Long == "" {
+			form.Set("long", cmp.Or(link.RawLong, link.Long))
+		}
+		if req.Owner == "" {
+			form.Set("owner", link.Owner)
+		}
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.Header.Del("Accept")
+	r2.Form = form
+	r2.PostForm = r2.Form
+	serveSave(w, r2)
+}
+
+// servePatchLink applies the JSON Patch or JSON Merge Patch in the request
+// body to the link short, saving only the fields it changes. The save fails
+// with 409 Conflict if the link is changed concurrently, or if a JSON Patch
+// "test" operation fails.
+func servePatchLink(w http.ResponseWriter, r *http.Request, short string) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonPatchType && mediaType != mergePatchType {
+		w.Header().Set("Accept-Patch", jsonPatchType+", "+mergePatchType)
+		http.Error(w, "Content-Type must be "+jsonPatchType+" or "+mergePatchType, http.StatusUnsupportedMediaType)
+		return
+	}
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	if err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	link, ok := loadVisibleLink(w, r, short)
+	if !ok {
+		return
+	}
+	req, err := newLinkPatchDocument(link).patch(mediaType, patch)
+	if errors.Is(err, errPatchTest) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	saveAPILink(w, r, link.Short, req)
+}
+
+func serveDeleteLink(w http.ResponseWriter, r *http.Request, short string) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	link, err := db.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canDelete(r.Context(), cu, link) {
+		audit(r, cu, "access.denied", link.Short, "delete")
+		http.Error(w, fmt.Sprintf("cannot delete link owned by %q", link.Owner), http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, link.Short) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.Delete(link.Short, editor); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deleteLinkStats(link)
+	linkChanges.Add("delete", 1)
+	linkTemplates.invalidate(link.Short)
+	audit(r, cu, "link.delete", link.Short, "long="+link.Long)
+	notifyLinkChange(cu.login, link, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maxAPIRequestSize limits the size of API request bodies.
+const maxAPIRequestSize = 1 << 20
+
+// apiResolveResponse is the response to /.api/v1/resolve.
+type apiResolveResponse struct {
+	URL string `json:"url"`
+}
+
+// maxSuccessorHops is the most deprecated links that /.api/v1/resolve
+// follows to their successors, in case successors form a cycle.
+const maxSuccessorHops = 10
+
+// serveResolve handles GET /.api/v1/resolve?short=foo&path=bar/baz, which
+// expands a link's destination as it would be when visiting go/foo/bar/baz,
+// and returns it as JSON instead of redirecting to it, so that tools can
+// preview where links go. The "query" parameter holds the query string of
+// the visit, if any.
+//
+// Resolving a link doesn't count as a click, and doesn't use up one-time
+// links, which are only resolved for the users who can edit them.
+func serveResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	short := strings.TrimSpace(r.FormValue("short"))
+	if short == "" {
+		http.Error(w, "short required", http.StatusBadRequest)
+		return
+	}
+	env := expandEnv{Now: time.Now().UTC(), Path: strings.TrimPrefix(r.FormValue("path"), "/")}
+	if q := r.FormValue("query"); q != "" {
+		query, err := url.ParseQuery(strings.TrimPrefix(q, "?"))
+		if err != nil {
+			http.Error(w, "invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		env.query = query
+	}
+
+	link, err := loadLink(short)
+	// follow links whose deprecation period has passed, as visitors are
+	// redirected to their successors
+	for hops := 0; err == nil && link.Successor != "" && !time.Now().Before(link.Deprecated.Add(*deprecationPeriod)); hops++ {
+		if hops == maxSuccessorHops {
+			http.Error(w, "too many successors", http.StatusLoopDetected)
+			return
+		}
+		link, err = loadLink(link.Successor)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if linkExpired(link, time.Now()) {
+		http.Error(w, "link expired", http.StatusNotFound)
+		return
+	}
+	if link.MaxUses > 0 {
+		// resolving doesn't use up a one-time link, so as on the detail
+		// page, its destination is only shown to editors
+		cu, err := currentUser(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !authz.canEdit(r.Context(), cu, link) {
+			http.Error(w, "link not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	long := resolveTarget(link)
+	if usesUser(long) || paramsUseUser(link) {
+		cu, _ := currentUser(r)
+		env.user = cu.login
+	}
+	target, err := expandLinkTarget(link, long, env)
+	if err == nil {
+		err = appendParams(link, target, env)
+	}
+	if errors.Is(err, errNoUser) {
+		http.Error(w, "link requires a valid user", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(apiResolveResponse{URL: target.String()})
+}
+
+// decodeAPIRequest decodes the JSON body of r into v, writing an error
+// response and returning false if it is invalid.
+func decodeAPIRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
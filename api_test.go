@@ -0,0 +1,271 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAPILinkRequestForm(t *testing.T) {
+	tags := []string{"oncall", "sre"}
+	params := ""
+	maxUses := 1
+	expires := "2w"
+	tests := []struct {
+		name string
+		req  apiLinkRequest
+		want url.Values
+	}{
+		{
+			name: "minimal",
+			req:  apiLinkRequest{Long: "https://example.com/"},
+			want: url.Values{"short": {"foo"}, "long": {"https://example.com/"}},
+		},
+		{
+			name: "optional fields",
+			req: apiLinkRequest{
+				Long:    "https://example.com/",
+				Owner:   "bar@example.com",
+				Tags:    &tags,
+				Headers: &map[string]string{"Cache-Control": "no-store"},
+				Params:  &params,
+				MaxUses: &maxUses,
+				Expires: &expires,
+			},
+			want: url.Values{
+				"short":    {"foo"},
+				"long":     {"https://example.com/"},
+				"owner":    {"bar@example.com"},
+				"tags":     {"oncall sre"},
+				"headers":  {"Cache-Control: no-store"},
+				"params":   {""},
+				"max_uses": {"1"},
+				"expires":  {"2w"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, tt.req.form("foo")); diff != "" {
+				t.Errorf("form() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServeAPIErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		okStatus   int
+		h          http.HandlerFunc
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "error",
+			h:          func(w http.ResponseWriter, r *http.Request) { http.Error(w, "short required", http.StatusBadRequest) },
+			wantStatus: http.StatusBadRequest,
+			wantError:  "short required",
+		},
+		{
+			name:       "not found",
+			h:          http.NotFound,
+			wantStatus: http.StatusNotFound,
+			wantError:  "404 page not found",
+		},
+		{
+			name: "json error",
+			h: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"Error":"link was deleted by someone else"}`))
+			},
+			wantStatus: http.StatusConflict,
+			wantError:  "link was deleted by someone else",
+		},
+		{
+			name:       "created",
+			okStatus:   http.StatusCreated,
+			h:          func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("{}")) },
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "no content",
+			okStatus:   http.StatusCreated,
+			h:          func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) },
+			wantStatus: http.StatusNoContent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serveAPI(w, httptest.NewRequest("GET", "/.api/v1/links", nil), tt.okStatus, tt.h)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q; want application/json", ct)
+			}
+			var got apiError
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Error != tt.wantError {
+				t.Errorf("Error = %q; want %q", got.Error, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestServeListLinksOneTime(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "who", Long: "http://who/", Owner: "bar@example.com"})
+	db.Save(&Link{Short: "secret", Long: "http://secret/", Owner: "foo@example.com", MaxUses: 1})
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	tests := []struct {
+		login string
+		query string
+		want  []string
+	}{
+		{"foo@example.com", "", []string{"secret", "who"}},
+		{"bar@example.com", "", []string{"who"}},
+		{"bar@example.com", "sort=score", []string{"who"}},
+	}
+	for _, tt := range tests {
+		currentUser = func(*http.Request) (user, error) { return user{login: tt.login}, nil }
+		w := httptest.NewRecorder()
+		serveListLinks(w, httptest.NewRequest("GET", "/.api/v1/links?"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list as %s = %d; want %d", tt.login, w.Code, http.StatusOK)
+		}
+		var links []*Link
+		if err := json.NewDecoder(w.Body).Decode(&links); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, link := range links {
+			got = append(got, link.Short)
+		}
+		if !cmp.Equal(got, tt.want) {
+			t.Errorf("list %q as %s = %v; want %v", tt.query, tt.login, got, tt.want)
+		}
+	}
+}
+
+func TestServeListLinksPages(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "a", Long: "http://a/"})
+	db.Save(&Link{Short: "b", Long: "http://b/", Owner: "foo@example.com", MaxUses: 1})
+	db.Save(&Link{Short: "C", Long: "http://c/"})
+	db.Save(&Link{Short: "d", Long: "http://d/"})
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+	currentUser = func(*http.Request) (user, error) { return user{login: "bar@example.com"}, nil }
+
+	// the hidden one-time link b doesn't shorten the first page
+	tests := []struct {
+		query    string
+		want     []string
+		wantNext string
+	}{
+		{"limit=2", []string{"a", "C"}, `</.api/v1/links?after=C&limit=2>; rel="next"`},
+		{"limit=2&after=C", []string{"d"}, ""},
+		{"limit=2&after=c", []string{"d"}, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		serveListLinks(w, httptest.NewRequest("GET", "/.api/v1/links?"+tt.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %q = %d; want %d", tt.query, w.Code, http.StatusOK)
+		}
+		var links []*Link
+		if err := json.NewDecoder(w.Body).Decode(&links); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, link := range links {
+			got = append(got, link.Short)
+		}
+		if !cmp.Equal(got, tt.want) {
+			t.Errorf("list %q = %v; want %v", tt.query, got, tt.want)
+		}
+		if next := w.Header().Get("Link"); next != tt.wantNext {
+			t.Errorf("list %q Link = %q; want %q", tt.query, next, tt.wantNext)
+		}
+	}
+}
+
+func TestServeResolve(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "who", Long: "http://who/"})
+	db.Save(&Link{Short: "people", Long: "http://people/", Successor: "who", Deprecated: time.Now().AddDate(-1, 0, 0)})
+	db.Save(&Link{Short: "secret", Long: "http://secret/", Owner: "foo@example.com", MaxUses: 1})
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantURL    string
+	}{
+		{"short=who", http.StatusOK, "http://who/"},
+		{"short=who&path=alice", http.StatusOK, "http://who/alice"},
+		{"short=who&path=alice&query=" + url.QueryEscape("q=1"), http.StatusOK, "http://who/alice?q=1"},
+		{"short=people&path=bob", http.StatusOK, "http://who/bob"},
+		{"short=secret", http.StatusOK, "http://secret/"},
+		{"short=missing", http.StatusNotFound, ""},
+		{"", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		serveResolve(w, httptest.NewRequest("GET", "/.api/v1/resolve?"+tt.query, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("resolve %q = %d; want %d", tt.query, w.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+		var got apiResolveResponse
+		if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != tt.wantURL {
+			t.Errorf("resolve %q = %q; want %q", tt.query, got.URL, tt.wantURL)
+		}
+	}
+
+	// one-time links are only resolved for their editors
+	currentUser = func(*http.Request) (user, error) { return user{login: "bar@example.com"}, nil }
+	w := httptest.NewRecorder()
+	serveResolve(w, httptest.NewRequest("GET", "/.api/v1/resolve?short=secret", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("resolve secret as non-editor = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	// previews don't use up one-time links
+	link, err := db.Load("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Uses != 0 {
+		t.Errorf("secret uses = %d after resolving; want 0", link.Uses)
+	}
+}
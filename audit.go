@@ -0,0 +1,235 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEvent records a change to links or an access decision, for export to
+// a SIEM with --audit-export.
+type AuditEvent struct {
+	Time       time.Time
+	Action     string // such as "link.save" or "access.denied"
+	User       string // login of the user making the request
+	Short      string `json:",omitempty"` // link acted on, if any
+	Detail     string `json:",omitempty"`
+	RemoteAddr string `json:",omitempty"`
+}
+
+// auditSeverity returns the CEF severity (0-10) of an audit action.
+func auditSeverity(action string) int {
+	switch action {
+	case "access.denied", "owner.lookup":
+		return 7
+	case "link.delete", "link.merge":
+		return 5
+	}
+	return 3
+}
+
+// cefEscaper and cefExtEscaper escape CEF header and extension values.
+var (
+	cefEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// formatCEF formats e in ArcSight Common Event Format.
+func formatCEF(e AuditEvent) string {
+	var ext []string
+	add := func(k, v string) {
+		if v != "" {
+			ext = append(ext, k+"="+cefExtEscaper.Replace(v))
+		}
+	}
+	add("rt", strconv.FormatInt(e.Time.UnixMilli(), 10))
+	add("suser", e.User)
+	if host, _, err := net.SplitHostPort(e.RemoteAddr); err == nil {
+		add("src", host)
+	}
+	if e.Short != "" {
+		add("cs1Label", "short")
+		add("cs1", e.Short)
+	}
+	add("msg", e.Detail)
+	return fmt.Sprintf("CEF:0|Tailscale|golink|1.0|%s|%s|%d|%s",
+		cefEscaper.Replace(e.Action), cefEscaper.Replace(e.Action), auditSeverity(e.Action), strings.Join(ext, " "))
+}
+
+// formatAuditEvent formats e as a single line in format, "json" or "cef".
+func formatAuditEvent(format string, e AuditEvent) (string, error) {
+	switch format {
+	case "cef":
+		return formatCEF(e), nil
+	case "json":
+		b, err := json.Marshal(e)
+		return string(b), err
+	}
+	return "", fmt.Errorf("unknown audit format %q", format)
+}
+
+// auditExporter batches audit events and sends them to a SIEM, retrying
+// failed batches.
+type auditExporter struct {
+	format    string
+	send      func(lines []string) error // deliver one batch
+	batchSize int
+	retries   int
+	backoff   time.Duration // initial delay between retries, doubled each time
+
+	mu      sync.Mutex
+	pending []string
+}
+
+// maxPendingAuditEvents limits the events held while the SIEM is unreachable.
+const maxPendingAuditEvents = 10000
+
+// auditLog is the exporter used by audit, or nil if --audit-export is not set.
+var auditLog *auditExporter
+
+// audit records an audit event for the request r made by u.
+func audit(r *http.Request, u user, action, short, detail string) {
+	if auditLog == nil {
+		return
+	}
+	auditLog.add(AuditEvent{
+		Time:       time.Now().UTC(),
+		Action:     action,
+		User:       u.login,
+		Short:      short,
+		Detail:     detail,
+		RemoteAddr: r.RemoteAddr,
+	})
+}
+
+// add queues e to be sent with the next batch.
+func (a *auditExporter) add(e AuditEvent) {
+	line, err := formatAuditEvent(a.format, e)
+	if err != nil {
+		log.Printf("formatting audit event: %v", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.pending) >= maxPendingAuditEvents {
+		log.Printf("audit queue full; dropping %s event for %q", e.Action, e.Short)
+		return
+	}
+	a.pending = append(a.pending, line)
+}
+
+// flush sends all queued events in batches. Batches that fail after all
+// retries are kept to be sent by the next flush.
+func (a *auditExporter) flush() error {
+	a.mu.Lock()
+	lines := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	for len(lines) > 0 {
+		n := min(len(lines), a.batchSize)
+		var err error
+		delay := a.backoff
+		for attempt := 0; attempt <= a.retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(delay)
+				delay *= 2
+			}
+			if err = a.send(lines[:n]); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			a.mu.Lock()
+			a.pending = append(lines, a.pending...)
+			a.mu.Unlock()
+			return err
+		}
+		lines = lines[n:]
+	}
+	return nil
+}
+
+// newAuditExporter returns an exporter for the --audit-export destination,
+// which is an https:// URL that batches are POSTed to as newline separated
+// events, or a syslog+tcp:// or syslog+udp:// address.
+func newAuditExporter(dest, format string) (*auditExporter, error) {
+	if _, err := formatAuditEvent(format, AuditEvent{}); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+	a := &auditExporter{
+		format:    format,
+		batchSize: 100,
+		retries:   3,
+		backoff:   time.Second,
+	}
+	switch u.Scheme {
+	case "https", "http":
+		client := outboundClient(30 * time.Second)
+		a.send = func(lines []string) error {
+			body := strings.Join(lines, "\n") + "\n"
+			resp, err := client.Post(dest, "application/x-ndjson", strings.NewReader(body))
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				return fmt.Errorf("audit export to %s: %s", u.Host, resp.Status)
+			}
+			return nil
+		}
+	case "syslog+tcp", "syslog+udp":
+		network := strings.TrimPrefix(u.Scheme, "syslog+")
+		hostname, _ := os.Hostname()
+		a.send = func(lines []string) error {
+			conn, err := net.DialTimeout(network, u.Host, 10*time.Second)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(30 * time.Second))
+			for _, line := range lines {
+				if _, err := conn.Write(syslogMessage(network, hostname, time.Now(), line)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported audit destination %q: use https://, syslog+tcp://, or syslog+udp://", dest)
+	}
+	return a, nil
+}
+
+// syslogMessage formats msg as an RFC 5424 syslog message with facility
+// authpriv and severity notice. Messages sent over TCP are octet-counted as
+// described in RFC 6587.
+func syslogMessage(network, hostname string, t time.Time, msg string) []byte {
+	const pri = 10*8 + 5 // authpriv.notice
+	if hostname == "" {
+		hostname = "-"
+	}
+	line := fmt.Sprintf("<%d>1 %s %s golink - - - %s", pri, t.UTC().Format(time.RFC3339), hostname, msg)
+	var b bytes.Buffer
+	if network == "tcp" {
+		fmt.Fprintf(&b, "%d ", len(line))
+	}
+	b.WriteString(line)
+	return b.Bytes()
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatAuditEvent(t *testing.T) {
+	e := AuditEvent{
+		Time:       time.UnixMilli(1672531200000).UTC(),
+		Action:     "link.save",
+		User:       "alice@example.com",
+		Short:      "wiki",
+		Detail:     `long=https://example.com/?a=b|c\d`,
+		RemoteAddr: "100.64.0.1:1234",
+	}
+	got, err := formatAuditEvent("cef", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `CEF:0|Tailscale|golink|1.0|link.save|link.save|3|rt=1672531200000 suser=alice@example.com src=100.64.0.1 cs1Label=short cs1=wiki msg=long\=https://example.com/?a\=b|c\\d`
+	if got != want {
+		t.Errorf("formatCEF =\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = formatAuditEvent("json", e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"Time":"2023-01-01T00:00:00Z","Action":"link.save","User":"alice@example.com","Short":"wiki","Detail":"long=https://example.com/?a=b|c\\d","RemoteAddr":"100.64.0.1:1234"}`
+	if got != want {
+		t.Errorf("json =\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := formatAuditEvent("xml", e); err == nil {
+		t.Error("formatAuditEvent(xml) succeeded; want error")
+	}
+}
+
+func TestAuditExporterFlush(t *testing.T) {
+	var batches [][]string
+	failures := 0
+	a := &auditExporter{
+		format:    "json",
+		batchSize: 2,
+		retries:   1,
+		send: func(lines []string) error {
+			if failures > 0 {
+				failures--
+				return errors.New("unavailable")
+			}
+			batches = append(batches, lines)
+			return nil
+		},
+	}
+	for _, short := range []string{"a", "b", "c"} {
+		a.add(AuditEvent{Action: "link.save", Short: short})
+	}
+
+	// first batch fails once and is retried
+	failures = 1
+	if err := a.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := []int{len(batches[0]), len(batches[1])}; !cmp.Equal(got, []int{2, 1}) {
+		t.Errorf("batch sizes = %v; want [2 1]", got)
+	}
+
+	// batches that exhaust their retries are kept for the next flush
+	a.add(AuditEvent{Action: "link.delete", Short: "d"})
+	failures = 2
+	if err := a.flush(); err == nil {
+		t.Fatal("flush succeeded; want error")
+	}
+	if len(a.pending) != 1 {
+		t.Fatalf("pending = %d events; want 1", len(a.pending))
+	}
+	if err := a.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.pending) != 0 || len(batches) != 3 {
+		t.Errorf("after retry: pending = %d, batches = %d; want 0, 3", len(a.pending), len(batches))
+	}
+}
+
+func TestSyslogMessage(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got, want := string(syslogMessage("udp", "go", ts, "hi")), "<85>1 2023-01-01T00:00:00Z go golink - - - hi"; got != want {
+		t.Errorf("udp message = %q; want %q", got, want)
+	}
+	if got, want := string(syslogMessage("tcp", "", ts, "hi")), "44 <85>1 2023-01-01T00:00:00Z - golink - - - hi"; got != want {
+		t.Errorf("tcp message = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Backups written by /.export are JSON lines with a Checksum field added to
+// the end of each link, the CRC-32C of the line without it, and a trailer
+// line counting the links and holding the SHA-256 of all lines before it.
+// Restores and imports ignore both, so that older backups still load, and
+// `golink backup verify` checks them.
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// backupTrailer is the last line of a backup.
+type backupTrailer struct {
+	Records int    // number of links in the backup
+	SHA256  string // hex SHA-256 of all lines before the trailer
+}
+
+// reBackupChecksum matches the checksum field at the end of a backup line.
+var reBackupChecksum = regexp.MustCompile(`,"Checksum":"crc32c:([0-9a-f]{8})"}$`)
+
+// backupWriter writes links to a backup.
+type backupWriter struct {
+	w       io.Writer
+	sum     hash.Hash // of lines written so far
+	records int
+}
+
+func newBackupWriter(w io.Writer) *backupWriter {
+	return &backupWriter{w: w, sum: sha256.New()}
+}
+
+// Write writes link as one line of the backup, with its checksum.
+func (bw *backupWriter) Write(link *Link) error {
+	b, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+	line := fmt.Appendf(b[:len(b)-1:len(b)-1], `,"Checksum":"crc32c:%08x"}`+"\n", crc32.Checksum(b, castagnoli))
+	bw.sum.Write(line)
+	bw.records++
+	_, err = bw.w.Write(line)
+	return err
+}
+
+// Close writes the backup trailer. It does not close the underlying writer.
+func (bw *backupWriter) Close() error {
+	return json.NewEncoder(bw.w).Encode(backupTrailer{
+		Records: bw.records,
+		SHA256:  hex.EncodeToString(bw.sum.Sum(nil)),
+	})
+}
+
+// isBackupTrailer reports whether line is the trailer of a backup.
+func isBackupTrailer(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(`{"Records":`))
+}
+
+// verifyBackup checks the checksums of the backup read from r, which may be
+// compressed. It returns the number of links in the backup and a
+// description of each problem found, such as a corrupted line or a missing
+// trailer in a truncated backup. The error is set only if r can't be read.
+func verifyBackup(r io.Reader) (records int, problems []string, err error) {
+	dr, err := decompressReader(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer dr.Close()
+	s := bufio.NewScanner(dr)
+	s.Buffer(nil, maxImportLine)
+	sum := sha256.New()
+	var trailer *backupTrailer
+	for n := 1; s.Scan(); n++ {
+		line := s.Bytes()
+		if trailer != nil {
+			problems = append(problems, fmt.Sprintf("line %d: data after trailer", n))
+			break
+		}
+		if isBackupTrailer(line) {
+			trailer = new(backupTrailer)
+			if err := json.Unmarshal(line, trailer); err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: invalid trailer: %v", n, err))
+			}
+			continue
+		}
+		sum.Write(line)
+		sum.Write([]byte("\n"))
+		records++
+		m := reBackupChecksum.FindSubmatchIndex(line)
+		if m == nil {
+			problems = append(problems, fmt.Sprintf("line %d: no checksum", n))
+			continue
+		}
+		want, _ := strconv.ParseUint(string(line[m[2]:m[3]]), 16, 32)
+		record := append(line[:m[0]:m[0]], '}')
+		if crc32.Checksum(record, castagnoli) != uint32(want) {
+			problems = append(problems, fmt.Sprintf("line %d: checksum mismatch", n))
+		}
+	}
+	if err := s.Err(); err != nil {
+		// a corrupted compressed stream fails here, rather than on open
+		problems = append(problems, fmt.Sprintf("reading backup: %v", err))
+		return records, problems, nil
+	}
+	switch {
+	case trailer == nil:
+		problems = append(problems, "no trailer: the backup is truncated or was exported without checksums")
+	case trailer.Records != records:
+		problems = append(problems, fmt.Sprintf("trailer counts %d links, found %d", trailer.Records, records))
+	case trailer.SHA256 != hex.EncodeToString(sum.Sum(nil)):
+		problems = append(problems, "file checksum mismatch")
+	}
+	return records, problems, nil
+}
+
+// runBackupCommand runs the "golink backup" subcommand with args.
+func runBackupCommand(args []string, w io.Writer) error {
+	if len(args) != 2 || args[0] != "verify" {
+		return errors.New("usage: golink backup verify FILE")
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	records, problems, err := verifyBackup(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[1], err)
+	}
+	for _, p := range problems {
+		fmt.Fprintf(w, "FAIL  %s\n", p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s has %d problems", args[1], len(problems))
+	}
+	fmt.Fprintf(w, "%s is valid: %d links\n", args[1], records)
+	return nil
+}
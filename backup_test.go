@@ -0,0 +1,120 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func writeTestBackup(t *testing.T, links ...*Link) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	bw := newBackupWriter(&buf)
+	for _, link := range links {
+		if err := bw.Write(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyBackup(t *testing.T) {
+	created := time.Date(2022, 6, 17, 18, 5, 43, 0, time.UTC)
+	backup := writeTestBackup(t,
+		&Link{Short: "go", Long: "http://go", Created: created, LastEdit: created, Owner: "amelie@example.com"},
+		&Link{Short: "slack", Long: "https://company.slack.com/{{.Path}}", Created: created, LastEdit: created, Owner: "amelie@example.com", Tags: []string{"chat"}},
+	)
+	lines := strings.SplitAfter(string(backup), "\n")
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(backup)
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		backup   string
+		records  int
+		problems []string
+	}{
+		{
+			name:    "valid",
+			backup:  string(backup),
+			records: 2,
+		},
+		{
+			name:    "gzip",
+			backup:  gz.String(),
+			records: 2,
+		},
+		{
+			name:     "corrupted record",
+			backup:   strings.Replace(string(backup), "http://go", "http://gp", 1),
+			records:  2,
+			problems: []string{"line 1: checksum mismatch", "file checksum mismatch"},
+		},
+		{
+			name:     "truncated",
+			backup:   lines[0],
+			records:  1,
+			problems: []string{"no trailer: the backup is truncated or was exported without checksums"},
+		},
+		{
+			name:     "missing record",
+			backup:   lines[0] + lines[2],
+			records:  1,
+			problems: []string{"trailer counts 2 links, found 1"},
+		},
+		{
+			name:     "no checksums",
+			backup:   `{"Short":"go","Long":"http://go"}` + "\n",
+			records:  1,
+			problems: []string{"line 1: no checksum", "no trailer: the backup is truncated or was exported without checksums"},
+		},
+		{
+			name:     "data after trailer",
+			backup:   string(backup) + lines[0],
+			records:  2,
+			problems: []string{"line 4: data after trailer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, problems, err := verifyBackup(strings.NewReader(tt.backup))
+			if err != nil {
+				t.Fatalf("verifyBackup: %v", err)
+			}
+			if records != tt.records {
+				t.Errorf("verifyBackup records = %d; want %d", records, tt.records)
+			}
+			if diff := cmp.Diff(tt.problems, problems); diff != "" {
+				t.Errorf("verifyBackup problems mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestImportBackup(t *testing.T) {
+	backup := writeTestBackup(t, &Link{Short: "go", Long: "http://go", Tags: []string{"a"}})
+	rows, err := parseImportJSONLines(bytes.NewReader(backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].err != nil {
+		t.Fatalf("parseImportJSONLines = %+v; want one link", rows)
+	}
+	want := &Link{Short: "go", Long: "http://go", Tags: []string{"a"}}
+	if diff := cmp.Diff(want, rows[0].link); diff != "" {
+		t.Errorf("parseImportJSONLines mismatch (-want +got):\n%s", diff)
+	}
+}
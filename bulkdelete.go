@@ -0,0 +1,157 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+// bulkDeleteTimeout is how long a bulk delete confirmation token is valid.
+const bulkDeleteTimeout = 15 * time.Minute
+
+// bulkDeleteRequest is the JSON body of a request to /.api/v1/bulk-delete.
+type bulkDeleteRequest struct {
+	Query   string // link query expression selecting the links to delete
+	Confirm string // token from the preview response; empty to preview
+}
+
+// bulkDeleteResponse is the response to /.api/v1/bulk-delete. A preview
+// lists the matching links and a Confirm token to delete them with, and a
+// confirmed request lists the links that were deleted.
+type bulkDeleteResponse struct {
+	Query   string
+	Links   []string // short names, sorted
+	Confirm string   `json:",omitempty"` // in previews only
+	Deleted bool     `json:",omitempty"`
+}
+
+// bulkDeleteAction returns the XSRF action ID that a bulk delete
+// confirmation token is bound to. It covers the query and the exact set of
+// links matched, so a token can't delete links that were not previewed.
+func bulkDeleteAction(query string, shorts []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", query)
+	for _, short := range shorts {
+		fmt.Fprintf(h, "%s\n", linkID(short))
+	}
+	return "bulk-delete:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// serveBulkDelete deletes every link matching a query, such as
+// "owner:alice created<2023-01-01 clicks=0", in two steps: a request
+// without a Confirm token previews the matching links, and repeating it
+// with the token from the preview deletes them. The token expires after
+// bulkDeleteTimeout, and is rejected if the matching links have changed.
+// Only admins may delete links in bulk.
+func serveBulkDelete(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	var req bulkDeleteRequest
+	if !decodeAPIRequest(w, r, &req) {
+		return
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	q, err := parseLinkQuery(req.Query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(q.terms) == 0 {
+		http.Error(w, "Query required: bulk delete won't match every link", http.StatusBadRequest)
+		return
+	}
+	cond, args, err := q.sql()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "bulk-delete")
+		http.Error(w, "only admins can delete links in bulk", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, ".bulk-delete") {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	// flush stats so that clicks terms match current counts
+	if err := flushStats(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	links, err := db.LoadWhere(cond, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Short < links[j].Short
+	})
+	resp := bulkDeleteResponse{Query: req.Query, Links: make([]string, len(links))}
+	for i, link := range links {
+		resp.Links[i] = link.Short
+	}
+	action := bulkDeleteAction(req.Query, resp.Links)
+
+	if req.Confirm == "" {
+		resp.Confirm = xsrftoken.Generate(xsrfKey, cu.login, action)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+	if !xsrftoken.ValidFor(req.Confirm, xsrfKey, cu.login, action, bulkDeleteTimeout) {
+		http.Error(w, "Confirm token is expired, or the matching links have changed; preview the delete again", http.StatusConflict)
+		return
+	}
+
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = db.DeleteLinks(resp.Links, editor)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "matching links have changed; preview the delete again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, link := range links {
+		deleteLinkStats(link)
+		linkTemplates.invalidate(link.Short)
+		audit(r, cu, "link.delete", link.Short, "long="+link.Long+" bulk=true")
+		notifyLinkChange(cu.login, link, nil)
+	}
+	linkChanges.Add("delete", int64(len(links)))
+	audit(r, cu, "link.bulk-delete", "", fmt.Sprintf("q=%q deleted=%d", req.Query, len(links)))
+	resp.Deleted = true
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
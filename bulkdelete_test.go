@@ -0,0 +1,39 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+func TestBulkDeleteConfirm(t *testing.T) {
+	const key, login, query = "key", "amelie@example.com", "owner:amelie clicks=0"
+	token := xsrftoken.Generate(key, login, bulkDeleteAction(query, []string{"a", "b"}))
+
+	tests := []struct {
+		name   string
+		login  string
+		query  string
+		shorts []string
+		want   bool
+	}{
+		{"same", login, query, []string{"a", "b"}, true},
+		{"same ids", login, query, []string{"A", "b"}, true},
+		{"other user", "bob@example.com", query, []string{"a", "b"}, false},
+		{"other query", login, "owner:amelie", []string{"a", "b"}, false},
+		{"link added", login, query, []string{"a", "b", "c"}, false},
+		{"link removed", login, query, []string{"a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := xsrftoken.ValidFor(token, key, tt.login, bulkDeleteAction(tt.query, tt.shorts), time.Minute)
+			if got != tt.want {
+				t.Errorf("token valid = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
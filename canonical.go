@@ -0,0 +1,79 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"log"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// canonicalTarget returns the canonical form of the link target long, used
+// to serve the link and to find links with the same destination. Scheme and
+// host are lowercased, default ports are removed, and repeated slashes and
+// dot segments in the path are resolved. An http URL is upgraded to https if
+// supportsHTTPS reports that its https form works.
+//
+// Templates and targets that are not absolute http or https URLs are
+// returned unchanged.
+func canonicalTarget(long string, supportsHTTPS func(target string) bool) string {
+	if strings.Contains(long, "{{") {
+		return long
+	}
+	u, err := url.Parse(long)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Opaque != "" {
+		return long
+	}
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if unescaped, err := url.PathUnescape(cleaned); err == nil {
+		u.Path, u.RawPath = unescaped, cleaned
+	}
+
+	if u.Scheme == "http" && u.Port() == "" && supportsHTTPS != nil {
+		secure := *u
+		secure.Scheme = "https"
+		if supportsHTTPS(secure.String()) {
+			u = &secure
+		}
+	}
+	return u.String()
+}
+
+// targetSupportsHTTPS reports whether the dead-link checker has found
+// target, an https URL, to be healthy.
+func targetSupportsHTTPS(target string) bool {
+	health, err := db.LoadTargetHealth([]string{target})
+	if err != nil {
+		log.Printf("loading target health for %q: %v", target, err)
+		return false
+	}
+	h, ok := health[target]
+	return ok && h.Healthy
+}
+
+// sameTargets returns the canonical forms of target that links with the
+// same destination may have stored, with either http or https.
+func sameTargets(target string) []string {
+	c := canonicalTarget(target, nil)
+	if other, ok := strings.CutPrefix(c, "http://"); ok {
+		return []string{c, "https://" + other}
+	}
+	if other, ok := strings.CutPrefix(c, "https://"); ok {
+		return []string{c, "http://" + other}
+	}
+	return []string{c}
+}
@@ -0,0 +1,34 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import "testing"
+
+func TestCanonicalTarget(t *testing.T) {
+	supportsHTTPS := func(target string) bool {
+		return target == "https://secure.example.com/docs"
+	}
+	tests := []struct {
+		long string
+		want string
+	}{
+		{"https://example.com/a", "https://example.com/a"},
+		{"HTTPS://Example.COM:443/a", "https://example.com/a"},
+		{"http://example.com:80", "http://example.com/"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com//a///b/", "https://example.com/a/b/"},
+		{"https://example.com/a/../b/./c?q=1#top", "https://example.com/b/c?q=1#top"},
+		{"https://example.com/a%2Fb//c", "https://example.com/a%2Fb/c"},
+		{"http://secure.example.com/docs", "https://secure.example.com/docs"},
+		{"http://secure.example.com:8080/docs", "http://secure.example.com:8080/docs"},
+		{"https://example.com/{{.Path}}", "https://example.com/{{.Path}}"},
+		{"mailto:team@example.com", "mailto:team@example.com"},
+		{"/relative//path", "/relative//path"},
+	}
+	for _, tt := range tests {
+		if got := canonicalTarget(tt.long, supportsHTTPS); got != tt.want {
+			t.Errorf("canonicalTarget(%q) = %q; want %q", tt.long, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package client is a Go client for the golink JSON API at /.api/v1.
+//
+// It has no dependencies beyond the standard library, so that services and
+// scripts can manage links without importing the golink server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client makes requests to a golink server.
+type Client struct {
+	// BaseURL is the URL of the golink server, such as "http://go".
+	BaseURL string
+
+	// Token is an API token, created at /.tokens, sent as a bearer token.
+	// If empty, requests are authenticated as the tailnet node making them.
+	Token string
+
+	// HTTPClient makes requests; http.DefaultClient is used if nil.
+	HTTPClient *http.Client
+}
+
+// Link is a link as returned by the API.
+type Link struct {
+	Short             string
+	Long              string
+	RawLong           string `json:",omitempty"`
+	Created           time.Time
+	LastEdit          time.Time
+	Owner             string
+	Tags              []string          `json:",omitempty"`
+	AutoCreated       bool              `json:",omitempty"`
+	CoOwners          []string          `json:",omitempty"`
+	Successor         string            `json:",omitempty"`
+	Deprecated        time.Time         `json:",omitzero"`
+	Expires           time.Time         `json:",omitzero"`
+	Fallbacks         []string          `json:",omitempty"`
+	MaintenanceTarget string            `json:",omitempty"`
+	Headers           map[string]string `json:",omitempty"`
+	Params            string            `json:",omitempty"`
+	MaxUses           int               `json:",omitempty"`
+	Uses              int               `json:",omitempty"`
+	HealthCheck       string            `json:",omitempty"`
+	Version           int               `json:",omitempty"`
+	TotalClicks       int               `json:",omitempty"`
+	ExternalClicks    int               `json:",omitempty"`
+}
+
+// LinkRequest creates or updates a link. Fields that are nil or empty are
+// left unchanged when updating a link.
+type LinkRequest struct {
+	Long              string             `json:",omitempty"`
+	Owner             string             `json:",omitempty"`
+	Tags              *[]string          `json:",omitempty"`
+	CoOwners          *[]string          `json:",omitempty"`
+	Fallbacks         *[]string          `json:",omitempty"`
+	MaintenanceTarget *string            `json:",omitempty"`
+	Successor         *string            `json:",omitempty"`
+	Headers           *map[string]string `json:",omitempty"`
+	Params            *string            `json:",omitempty"`
+	MaxUses           *int               `json:",omitempty"`
+	HealthCheck       *string            `json:",omitempty"` // "off", or "status=NNN" and "auth=NAME"
+	Expires           *string            `json:",omitempty"` // such as "30d" or an RFC 3339 time, or "" to never expire
+	Version           int                `json:",omitempty"` // if set, the update fails unless the link is at this version
+}
+
+// ListOptions filter and page the links returned by List.
+type ListOptions struct {
+	Query  string // a search query, as in the golink UI
+	Health string // "broken" to list only broken links
+	Sort   string // "short" (the default) or "score"
+	Limit  int    // the most links to return, or 0 for all of them
+	After  string // list links after this short name
+}
+
+// ClickCount is the number of clicks on a link with one path, referrer, or
+// day.
+type ClickCount struct {
+	Value  string
+	Clicks int
+}
+
+// Clicks is a breakdown of a link's recent clicks.
+type Clicks struct {
+	Short  string
+	By     string
+	Since  time.Time
+	Clicks []ClickCount
+}
+
+// Error is an error response from the API.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("golink: %s (%d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound reports whether err is a 404 Not Found response from the API.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+// Get returns the link short.
+func (c *Client) Get(ctx context.Context, short string) (*Link, error) {
+	var link Link
+	if err := c.do(ctx, "GET", linkPath(short), nil, nil, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// Put creates or updates the link short, returning it as saved.
+func (c *Client) Put(ctx context.Context, short string, req *LinkRequest) (*Link, error) {
+	var link Link
+	if err := c.do(ctx, "PUT", linkPath(short), nil, req, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// Delete deletes the link short.
+func (c *Client) Delete(ctx context.Context, short string) error {
+	return c.do(ctx, "DELETE", linkPath(short), nil, nil, nil)
+}
+
+// List returns the links matching opts, sorted by short name unless
+// opts.Sort is "score".
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]*Link, error) {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("q", opts.Query)
+	set("health", opts.Health)
+	set("sort", opts.Sort)
+	set("after", opts.After)
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var links []*Link
+	if err := c.do(ctx, "GET", "/.api/v1/links", q, nil, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// Clicks breaks down the clicks on the link short over the last days days
+// (30 if 0) by "path", "referrer", or "day".
+func (c *Client) Clicks(ctx context.Context, short, by string, days int) (*Clicks, error) {
+	q := url.Values{}
+	if by != "" {
+		q.Set("by", by)
+	}
+	if days > 0 {
+		q.Set("days", strconv.Itoa(days))
+	}
+	var clicks Clicks
+	if err := c.do(ctx, "GET", linkPath(short)+"/clicks", q, nil, &clicks); err != nil {
+		return nil, err
+	}
+	return &clicks, nil
+}
+
+// Resolve returns the URL that visiting short/path redirects to, without
+// counting a click.
+func (c *Client) Resolve(ctx context.Context, short, path string) (string, error) {
+	q := url.Values{"short": {short}}
+	if path != "" {
+		q.Set("path", path)
+	}
+	var resp struct {
+		URL string `json:"url"`
+	}
+	if err := c.do(ctx, "GET", "/.api/v1/resolve", q, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.URL, nil
+}
+
+func linkPath(short string) string {
+	return "/.api/v1/links/" + url.PathEscape(short)
+}
+
+// do makes an API request, encoding body as JSON if it is not nil and
+// decoding the response into out if it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	u := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return responseError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// responseError returns the error in an API error response, which is
+// usually JSON but may be plain text from outside the API handlers.
+func responseError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	e := &Error{StatusCode: resp.StatusCode}
+	var body struct{ Error string }
+	if json.Unmarshal(b, &body) == nil && body.Error != "" {
+		e.Message = body.Error
+	} else {
+		e.Message = strings.TrimSpace(string(b))
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
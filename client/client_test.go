@@ -0,0 +1,100 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /.api/v1/links/foo":
+			json.NewEncoder(w).Encode(Link{Short: "foo", Long: "http://foo", Owner: "a@example.com"})
+		case "PUT /.api/v1/links/foo":
+			var req LinkRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(Link{Short: "foo", Long: req.Long, Tags: *req.Tags})
+		case "DELETE /.api/v1/links/foo":
+			w.WriteHeader(http.StatusNoContent)
+		case "GET /.api/v1/links":
+			if r.FormValue("q") != "owner:me" || r.FormValue("limit") != "2" {
+				t.Errorf("list query = %q", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode([]*Link{{Short: "a"}, {Short: "b"}})
+		case "GET /.api/v1/links/foo/clicks":
+			json.NewEncoder(w).Encode(Clicks{Short: "foo", By: r.FormValue("by"), Clicks: []ClickCount{{"/x", 3}}})
+		case "GET /.api/v1/resolve":
+			json.NewEncoder(w).Encode(map[string]string{"url": "http://foo/" + r.FormValue("path")})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"Error": "404 page not found"})
+		}
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+	c := &Client{BaseURL: ts.URL + "/", Token: "golink-secret"}
+
+	link, err := c.Get(ctx, "foo")
+	if err != nil || link.Long != "http://foo" {
+		t.Errorf("Get = %+v, %v", link, err)
+	}
+	if gotAuth != "Bearer golink-secret" {
+		t.Errorf("Authorization = %q; want bearer token", gotAuth)
+	}
+	tags := []string{"docs"}
+	link, err = c.Put(ctx, "foo", &LinkRequest{Long: "http://bar", Tags: &tags})
+	if err != nil || link.Long != "http://bar" || len(link.Tags) != 1 {
+		t.Errorf("Put = %+v, %v", link, err)
+	}
+	if err := c.Delete(ctx, "foo"); err != nil {
+		t.Errorf("Delete = %v", err)
+	}
+	links, err := c.List(ctx, ListOptions{Query: "owner:me", Limit: 2})
+	if err != nil || len(links) != 2 {
+		t.Errorf("List = %v, %v", links, err)
+	}
+	clicks, err := c.Clicks(ctx, "foo", "referrer", 0)
+	if err != nil || clicks.By != "referrer" || len(clicks.Clicks) != 1 || clicks.Clicks[0].Clicks != 3 {
+		t.Errorf("Clicks = %+v, %v", clicks, err)
+	}
+	u, err := c.Resolve(ctx, "foo", "a/b")
+	if err != nil || u != "http://foo/a/b" {
+		t.Errorf("Resolve = %q, %v", u, err)
+	}
+
+	_, err = c.Get(ctx, "missing")
+	if !IsNotFound(err) {
+		t.Errorf("Get(missing) = %v; want not found", err)
+	}
+	if got, want := err.Error(), "golink: 404 page not found (404)"; got != want {
+		t.Errorf("error = %q; want %q", got, want)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{`{"Error":"cannot delete link owned by \"x\""}`, `cannot delete link owned by "x"`},
+		{"invalid XSRF token\n", "invalid XSRF token"},
+		{"", "Forbidden"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		rec.WriteHeader(http.StatusForbidden)
+		rec.WriteString(tt.body)
+		err := responseError(rec.Result())
+		if e, ok := err.(*Error); !ok || e.Message != tt.want || e.StatusCode != http.StatusForbidden {
+			t.Errorf("responseError(%q) = %#v; want %q", tt.body, err, tt.want)
+		}
+	}
+}
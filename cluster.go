@@ -0,0 +1,118 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"time"
+)
+
+// Several golink replicas can share one database behind a load balancer.
+// Background jobs that work on the database as a whole run on only one
+// replica at a time, holding an advisory lock, and are skipped by the other
+// replicas if one of them has run the job since they last tried. Writes are
+// announced on PostgreSQL notification channels, so that each replica drops
+// the links and settings it has cached. Click stats are counted by each
+// replica and added to the database in batches that are never saved twice.
+
+// replicaName identifies this replica in JobRuns.
+var replicaName = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", cmp.Or(host, "golink"), os.Getpid())
+}()
+
+// minOpenConns is the smallest --db-max-open-conns limit, besides no limit.
+// Each replica holds a connection to listen for changes, and one for each
+// of the two jobs that can run at once, which also need connections for
+// their work.
+const minOpenConns = 5
+
+// errJobSkipped is returned by RunJob when the job is left to another
+// replica.
+var errJobSkipped = errors.New("job skipped")
+
+// jobLockID returns the PostgreSQL advisory lock held while running the
+// job name.
+func jobLockID(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("golink job " + name))
+	return int64(h.Sum64())
+}
+
+// RunJob calls run as the background job name, unless another replica is
+// running the job or has started it after since, in which case it returns
+// an error wrapping errJobSkipped. If since is zero, runs by other replicas
+// are ignored, but a run in progress still skips this one.
+func (s *PostgresDB) RunJob(ctx context.Context, name string, since time.Time, run func() error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	id := jobLockID(name)
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", id).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("%w: running on another replica", errJobSkipped)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", id); err != nil {
+			// don't return the connection to the pool still holding the lock
+			log.Printf("unlocking job %s: %v", name, err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	now := s.Now()
+	cutoff := since
+	if cutoff.IsZero() {
+		cutoff = now
+	}
+	res, err := conn.ExecContext(ctx, `
+INSERT INTO JobRuns (Name, LastStart, Replica) VALUES ($1, $2, $3)
+ON CONFLICT (Name) DO UPDATE SET LastStart = EXCLUDED.LastStart, Replica = EXCLUDED.Replica
+WHERE JobRuns.LastStart <= $4`, name, now.Unix(), replicaName, cutoff.Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("%w: already run by another replica", errJobSkipped)
+	}
+	return run()
+}
+
+// cacheChannel is the PostgreSQL notification channel on which changes to
+// settings cached by every replica announce the name of their cache in
+// sharedCaches.
+const cacheChannel = "golink_cache_changes"
+
+// sharedCaches are the caches of settings stored in the database, by name.
+// They are otherwise only reloaded every 30 seconds.
+var sharedCaches = map[string]func(){
+	"reserved":      invalidateReservedNames,
+	"synonyms":      invalidateSynonyms,
+	"maintenance":   invalidateMaintenanceWindows,
+	"home-sections": invalidateHomeSections,
+}
+
+// invalidateShared invalidates the shared cache name on every replica,
+// after its settings are saved.
+func invalidateShared(name string) {
+	sharedCaches[name]()
+	if db != nil {
+		db.notify(cacheChannel, name)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The golinkctl command manages links on a golink server from the command
+// line, using the JSON API.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tailscale/golink/client"
+)
+
+const usage = `usage: golinkctl [flags] <command> [args]
+
+Commands:
+  get SHORT          show a link
+  put SHORT LONG     create or update a link
+  rm SHORT           delete a link
+  ls [QUERY]         list links, optionally matching a search query
+  stats SHORT        break down a link's recent clicks
+  open SHORT [PATH]  open a link in the browser
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// errUsage is returned for invalid arguments, after printing usage.
+var errUsage = errors.New("invalid arguments")
+
+// openBrowser opens a URL in the user's browser, and is replaced in tests.
+var openBrowser = func(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Run()
+}
+
+func run(ctx context.Context, args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("golinkctl", flag.ContinueOnError)
+	fs.SetOutput(w)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	server := fs.String("server", cmp.Or(os.Getenv("GOLINK_SERVER"), "http://go"), "URL of the golink server, or $GOLINK_SERVER")
+	token := fs.String("token", os.Getenv("GOLINK_TOKEN"), "API token, or $GOLINK_TOKEN; if empty, requests are authenticated as this tailnet node")
+	asJSON := fs.Bool("json", false, "print links and stats as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	c := &client.Client{BaseURL: *server, Token: *token}
+	cmd, args := fs.Arg(0), fs.Args()[1:]
+	out := func(v any, text func()) error {
+		if *asJSON {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(v)
+		}
+		text()
+		return nil
+	}
+
+	switch cmd {
+	case "get":
+		if len(args) != 1 {
+			return errors.New("usage: golinkctl get SHORT")
+		}
+		link, err := c.Get(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return out(link, func() { printLink(w, link) })
+
+	case "put":
+		pfs := flag.NewFlagSet("put", flag.ContinueOnError)
+		pfs.SetOutput(w)
+		owner := pfs.String("owner", "", "owner of the link, such as user@example.com or team:infra; defaults to you for new links")
+		tags := pfs.String("tags", "", "comma-separated tags, replacing the link's tags if set")
+		expires := pfs.String("expires", "", `when the link expires, such as "30d" or an RFC 3339 time`)
+		if err := pfs.Parse(args); err != nil {
+			return err
+		}
+		if pfs.NArg() != 2 {
+			return errors.New("usage: golinkctl put [-owner OWNER] [-tags TAGS] [-expires WHEN] SHORT LONG")
+		}
+		req := &client.LinkRequest{Long: pfs.Arg(1), Owner: *owner}
+		if *tags != "" {
+			t := strings.Split(*tags, ",")
+			req.Tags = &t
+		}
+		if *expires != "" {
+			req.Expires = expires
+		}
+		link, err := c.Put(ctx, pfs.Arg(0), req)
+		if err != nil {
+			return err
+		}
+		return out(link, func() { printLink(w, link) })
+
+	case "rm":
+		if len(args) != 1 {
+			return errors.New("usage: golinkctl rm SHORT")
+		}
+		return c.Delete(ctx, args[0])
+
+	case "ls":
+		lfs := flag.NewFlagSet("ls", flag.ContinueOnError)
+		lfs.SetOutput(w)
+		broken := lfs.Bool("broken", false, "only list broken links")
+		limit := lfs.Int("limit", 0, "the most links to list, or 0 for all")
+		byScore := lfs.Bool("score", false, "sort by search score rather than short name")
+		if err := lfs.Parse(args); err != nil {
+			return err
+		}
+		opts := client.ListOptions{Query: strings.Join(lfs.Args(), " "), Limit: *limit}
+		if *broken {
+			opts.Health = "broken"
+		}
+		if *byScore {
+			opts.Sort = "score"
+		}
+		links, err := c.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return out(links, func() {
+			tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			for _, link := range links {
+				fmt.Fprintf(tw, "%s\t%s\t%s\n", link.Short, link.Long, link.Owner)
+			}
+			tw.Flush()
+		})
+
+	case "stats":
+		sfs := flag.NewFlagSet("stats", flag.ContinueOnError)
+		sfs.SetOutput(w)
+		by := sfs.String("by", "path", `break clicks down by "path", "referrer", or "day"`)
+		days := sfs.Int("days", 30, "number of days of clicks")
+		if err := sfs.Parse(args); err != nil {
+			return err
+		}
+		if sfs.NArg() != 1 {
+			return errors.New("usage: golinkctl stats [-by path|referrer|day] [-days N] SHORT")
+		}
+		clicks, err := c.Clicks(ctx, sfs.Arg(0), *by, *days)
+		if err != nil {
+			return err
+		}
+		return out(clicks, func() {
+			for _, cc := range clicks.Clicks {
+				fmt.Fprintf(w, "%7d  %s\n", cc.Clicks, cmp.Or(cc.Value, "(none)"))
+			}
+		})
+
+	case "open":
+		if len(args) != 1 && len(args) != 2 {
+			return errors.New("usage: golinkctl open SHORT [PATH]")
+		}
+		// visit the link rather than resolving it, so that the visit
+		// counts as a click and the browser's identity is used
+		u := strings.TrimSuffix(*server, "/") + "/" + url.PathEscape(args[0])
+		if len(args) == 2 {
+			u += "/" + strings.TrimPrefix(args[1], "/")
+		}
+		return openBrowser(u)
+	}
+	fs.Usage()
+	return errUsage
+}
+
+// printLink prints the fields of link that are set, one per line.
+func printLink(w io.Writer, link *client.Link) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", name, value)
+		}
+	}
+	field("Short", link.Short)
+	field("Long", link.Long)
+	field("Owner", link.Owner)
+	field("Co-owners", strings.Join(link.CoOwners, ", "))
+	field("Tags", strings.Join(link.Tags, ", "))
+	field("Successor", link.Successor)
+	if !link.Expires.IsZero() {
+		field("Expires", link.Expires.Format("2006-01-02 15:04 MST"))
+	}
+	field("Clicks", fmt.Sprint(link.TotalClicks))
+	tw.Flush()
+}
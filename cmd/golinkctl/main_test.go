@@ -0,0 +1,80 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tailscale/golink/client"
+)
+
+func TestRun(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /.api/v1/links":
+			json.NewEncoder(w).Encode([]*client.Link{{Short: "docs", Long: "http://docs", Owner: "a@example.com"}})
+		case "PUT /.api/v1/links/docs":
+			var req client.LinkRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(client.Link{Short: "docs", Long: req.Long, Tags: *req.Tags})
+		case "GET /.api/v1/links/docs/clicks":
+			json.NewEncoder(w).Encode(client.Clicks{Clicks: []client.ClickCount{{Value: "/api", Clicks: 12}, {Value: "", Clicks: 3}}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"Error": "404 page not found"})
+		}
+	}))
+	defer ts.Close()
+
+	var opened string
+	oldOpen := openBrowser
+	t.Cleanup(func() { openBrowser = oldOpen })
+	openBrowser = func(u string) error {
+		opened = u
+		return nil
+	}
+
+	tests := []struct {
+		args    []string
+		want    []string // substrings of the output
+		wantErr string
+	}{
+		{[]string{"ls"}, []string{"docs  http://docs  a@example.com"}, ""},
+		{[]string{"put", "-tags", "a,b", "docs", "http://new"}, []string{"Long:", "http://new", "a, b"}, ""},
+		{[]string{"stats", "docs"}, []string{"12  /api", " 3  (none)"}, ""},
+		{[]string{"-json", "ls"}, []string{`"Short": "docs"`}, ""},
+		{[]string{"get", "missing"}, nil, "404 page not found"},
+		{[]string{"get"}, nil, "usage: golinkctl get SHORT"},
+		{[]string{"frob"}, []string{"Commands:"}, errUsage.Error()},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		err := run(context.Background(), append([]string{"-server", ts.URL}, tt.args...), &out)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("run(%q) = %v; want %q", tt.args, err, tt.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("run(%q) = %v", tt.args, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("run(%q) printed %q; want %q in it", tt.args, out.String(), want)
+			}
+		}
+	}
+
+	if err := run(context.Background(), []string{"-server", "http://go/", "open", "docs", "/a/b"}, new(strings.Builder)); err != nil {
+		t.Fatal(err)
+	}
+	if want := "http://go/docs/a/b"; opened != want {
+		t.Errorf("opened %q; want %q", opened, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// exportEncodings are the content codings that exports can be compressed
+// with, in order of preference.
+var exportEncodings = []string{"zstd", "gzip"}
+
+// negotiateEncoding returns the preferred content coding in exportEncodings
+// accepted by an Accept-Encoding header value, or "" to send the response
+// uncompressed. Codings with a q-value of 0 are not accepted, and ties go to
+// the earlier coding in exportEncodings.
+func negotiateEncoding(acceptEncoding string) string {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		qs[coding] = q
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range exportEncodings {
+		q, ok := qs[enc]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressWriter returns a writer that compresses to w with the content
+// coding enc, which is one of exportEncodings or "" for no compression.
+// The writer must be closed to flush the compressed stream.
+func compressWriter(w io.Writer, enc string) (io.WriteCloser, error) {
+	switch enc {
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	}
+	return nopWriteCloser{w}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressResponse returns a writer for the body of the response w to r,
+// compressed with the best encoding accepted by r, and sets the response
+// headers to match. The writer must be closed once the body is written.
+func compressResponse(w http.ResponseWriter, r *http.Request) (io.WriteCloser, error) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if enc != "" {
+		w.Header().Set("Content-Encoding", enc)
+	}
+	return compressWriter(w, enc)
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressReader returns a reader of the decompressed contents of r,
+// which may be gzip or zstd compressed, or uncompressed. The compression is
+// detected from the first bytes of r. The returned reader must be closed.
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	}
+	return io.NopCloser(br), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"zstd;q=0.5, gzip", "gzip"},
+		{"zstd;q=0, *", "gzip"},
+		{"*;q=0", ""},
+		{"GZIP;q=0.8", "gzip"},
+		{"gzip;q=bogus", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.in); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	const export = `{"Short":"a","Long":"https://a.example.com/"}` + "\n" + `{"Short":"b","Long":"https://b.example.com/"}` + "\n"
+	for _, enc := range append([]string{""}, exportEncodings...) {
+		var buf bytes.Buffer
+		w, err := compressWriter(&buf, enc)
+		if err != nil {
+			t.Fatalf("compressWriter(%q): %v", enc, err)
+		}
+		io.WriteString(w, strings.Repeat(export, 100))
+		if err := w.Close(); err != nil {
+			t.Fatalf("closing %q writer: %v", enc, err)
+		}
+
+		r, err := decompressReader(&buf)
+		if err != nil {
+			t.Fatalf("decompressReader(%q): %v", enc, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("reading %q: %v", enc, err)
+		}
+		if string(got) != strings.Repeat(export, 100) {
+			t.Errorf("%q round trip = %q; want original", enc, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Errors wrapped by ConfigError.
+var (
+	errConfigSyntax     = errors.New(`want "name = value"`)
+	errUnknownSetting   = errors.New("unknown setting")
+	errDuplicateSetting = errors.New("duplicate setting")
+)
+
+// ConfigError describes a problem with a line of a config file.
+type ConfigError struct {
+	File string
+	Line int
+	Name string // setting name, if known
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %s: %v", e.File, e.Line, e.Name, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// configSetting is a setting read from a config file.
+type configSetting struct {
+	line        int
+	name, value string
+}
+
+// parseConfig parses a config file, which sets flags with one
+// "name = value" line each. Names are flag names, optionally prefixed with
+// "--". Values may be double quoted Go strings. Blank lines and lines
+// starting with "#" are ignored.
+func parseConfig(r io.Reader, file string) ([]configSetting, []error) {
+	var settings []configSetting
+	var errs []error
+	seen := make(map[string]bool)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			errs = append(errs, &ConfigError{File: file, Line: n, Err: errConfigSyntax})
+			continue
+		}
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, `"`) {
+			v, err := strconv.Unquote(value)
+			if err != nil {
+				errs = append(errs, &ConfigError{File: file, Line: n, Name: name, Err: err})
+				continue
+			}
+			value = v
+		}
+		if seen[name] {
+			errs = append(errs, &ConfigError{File: file, Line: n, Name: name, Err: errDuplicateSetting})
+			continue
+		}
+		seen[name] = true
+		settings = append(settings, configSetting{line: n, name: name, value: value})
+	}
+	if err := s.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return settings, errs
+}
+
+// loadConfig sets the flags in fs from the config file at path. Flags
+// already set on the command line take precedence and are left unchanged.
+// It returns all problems found in the file.
+func loadConfig(path string, fs *flag.FlagSet) []error {
+	f, err := os.Open(path)
+	if err != nil {
+		return []error{err}
+	}
+	defer f.Close()
+	settings, errs := parseConfig(f, path)
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, s := range settings {
+		fl := fs.Lookup(s.name)
+		if fl == nil || s.name == "config" {
+			errs = append(errs, &ConfigError{File: path, Line: s.line, Name: s.name, Err: errUnknownSetting})
+			continue
+		}
+		if set[s.name] {
+			continue
+		}
+		if err := fl.Value.Set(s.value); err != nil {
+			errs = append(errs, &ConfigError{File: path, Line: s.line, Name: s.name, Err: err})
+		}
+	}
+	return errs
+}
+
+// secretDefaults are flags whose defaults come from the environment and may
+// hold credentials, so they are not written to example configs.
+var secretDefaults = map[string]bool{"pgdsn": true}
+
+// writeExampleConfig writes a config file to w documenting every flag in fs,
+// with each setting commented out at its default value.
+func writeExampleConfig(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "# golink config file, loaded with --config.")
+	fmt.Fprintln(w, "# Each line sets a flag by name; flags on the command line take precedence.")
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		fmt.Fprintln(w)
+		for _, line := range strings.Split(f.Usage, "\n") {
+			fmt.Fprintf(w, "# %s\n", line)
+		}
+		def := f.DefValue
+		if secretDefaults[f.Name] {
+			def = ""
+		}
+		fmt.Fprintf(w, "# %s = %s\n", f.Name, strconv.Quote(def))
+	})
+}
+
+// runConfigCommand runs "golink config validate FILE" or
+// "golink config example".
+func runConfigCommand(args []string, w io.Writer) error {
+	switch {
+	case len(args) == 1 && args[0] == "example":
+		writeExampleConfig(w, flag.CommandLine)
+		return nil
+	case len(args) == 2 && args[0] == "validate":
+		errs := loadConfig(args[1], flag.CommandLine)
+		for _, err := range errs {
+			fmt.Fprintf(w, "FAIL  %v\n", err)
+		}
+		// check the combination of settings, as on startup
+		d := &doctor{w: w, problems: len(errs)}
+		d.checkConfig()
+		d.checkFiles()
+		if d.problems > 0 {
+			return fmt.Errorf("%s has %d problems", args[1], d.problems)
+		}
+		fmt.Fprintf(w, "%s is valid\n", args[1])
+		return nil
+	}
+	return errors.New("usage: golink config validate FILE | golink config example")
+}
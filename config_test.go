@@ -0,0 +1,109 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFlagSet() (*flag.FlagSet, *string, *int, *time.Duration) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	hostname := fs.String("hostname", "go", "service name")
+	limit := fs.Int("max-links-per-user", 0, "maximum number of links\nper user")
+	grace := fs.Duration("gc-grace", time.Hour, "grace period")
+	return fs, hostname, limit, grace
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "golink.conf")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	fs, hostname, limit, grace := testFlagSet()
+	if err := fs.Parse([]string{"--hostname=links"}); err != nil {
+		t.Fatal(err)
+	}
+	path := writeConfig(t, `
+# comment
+hostname = ignored
+--max-links-per-user = 50
+gc-grace = "2h"
+`)
+	if errs := loadConfig(path, fs); len(errs) > 0 {
+		t.Fatalf("loadConfig returned errors: %v", errs)
+	}
+	if *hostname != "links" {
+		t.Errorf("hostname = %q; want command line value links", *hostname)
+	}
+	if *limit != 50 || *grace != 2*time.Hour {
+		t.Errorf("max-links-per-user = %d, gc-grace = %v; want 50, 2h", *limit, *grace)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	fs, _, _, _ := testFlagSet()
+	path := writeConfig(t, `hostname
+max-links-per-user = lots
+colour = blue
+gc-grace = 1h
+gc-grace = 2h
+hostname = "unterminated
+`)
+	errs := loadConfig(path, fs)
+	want := []struct {
+		line int
+		err  error
+	}{
+		{1, errConfigSyntax},
+		{5, errDuplicateSetting},
+		{6, nil},
+		{2, nil},
+		{3, errUnknownSetting},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("loadConfig returned %d errors; want %d: %v", len(errs), len(want), errs)
+	}
+	for i, w := range want {
+		var ce *ConfigError
+		if !errors.As(errs[i], &ce) || ce.Line != w.line {
+			t.Errorf("error %d = %v; want ConfigError on line %d", i, errs[i], w.line)
+			continue
+		}
+		if w.err != nil && !errors.Is(ce, w.err) {
+			t.Errorf("error %d = %v; want %v", i, ce, w.err)
+		}
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	fs, _, _, _ := testFlagSet()
+	var b strings.Builder
+	writeExampleConfig(&b, fs)
+	example := b.String()
+	if !strings.Contains(example, "# maximum number of links\n# per user\n# max-links-per-user = \"0\"\n") {
+		t.Errorf("example is missing commented max-links-per-user:\n%s", example)
+	}
+
+	// uncommented, the example sets every flag to its default
+	var settings []string
+	for _, line := range strings.Split(example, "\n") {
+		if s, ok := strings.CutPrefix(line, "# "); ok && strings.Contains(s, " = ") {
+			settings = append(settings, s)
+		}
+	}
+	fs, _, _, _ = testFlagSet()
+	if errs := loadConfig(writeConfig(t, strings.Join(settings, "\n")), fs); len(errs) > 0 {
+		t.Errorf("uncommented example has errors: %v", errs)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+// parseVersion parses the version form value of a link, which is empty when
+// saving without checking for concurrent edits.
+func parseVersion(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid version %q", s)
+	}
+	return n, nil
+}
+
+// conflictError returns the *ConflictError for a link that was created by
+// someone else while short was being created.
+func conflictError(short string) error {
+	current, err := db.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		// short is an alias, or the link was deleted again
+		return fmt.Errorf("%s already exists", short)
+	}
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Current: current}
+}
+
+// saveConflictResponse is the JSON response to a save that conflicted with
+// someone else's changes.
+type saveConflictResponse struct {
+	Error   string
+	Current *Link // nil if the link was deleted
+}
+
+// serveSaveConflict responds to a save of link that was rejected because
+// someone else changed or deleted it. Browsers are shown the edit page with
+// the rejected changes and the current link, so that the user can merge them
+// and confirm by saving again.
+func serveSaveConflict(w http.ResponseWriter, r *http.Request, cu user, link *Link, conflict *ConflictError) {
+	if !acceptHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(saveConflictResponse{Error: conflict.Error(), Current: conflict.Current})
+		return
+	}
+
+	// saving the form again overwrites the current version, or recreates
+	// the link if it was deleted
+	link.Version = 0
+	tokenShortName := newShortName
+	if conflict.Current != nil {
+		link.Version = conflict.Current.Version
+		tokenShortName = link.Short
+	}
+	w.WriteHeader(http.StatusConflict)
+	detailTmpl.Execute(w, detailData{
+		Link:     link,
+		Editable: true,
+		XSRF:     xsrftoken.Generate(xsrfKey, cu.login, tokenShortName),
+		Conflict: conflict,
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "0"},
+		{in: " 7 ", want: 7},
+		{in: "-1", wantErr: true},
+		{in: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseVersion(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseVersion(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseVersion(%q) = %d; want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	tests := []struct {
+		err  *ConflictError
+		want string
+	}{
+		{&ConflictError{}, "link was deleted by someone else"},
+		{&ConflictError{Current: &Link{Short: "who", Version: 3}}, "link was changed by someone else (version 3)"},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("saving: %w", tt.err)
+		var conflict *ConflictError
+		if !errors.As(err, &conflict) {
+			t.Errorf("errors.As(%v) = false; want true", err)
+			continue
+		}
+		if got := conflict.Error(); got != tt.want {
+			t.Errorf("Error() = %q; want %q", got, tt.want)
+		}
+	}
+}
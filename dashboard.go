@@ -0,0 +1,279 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"tailscale.com/metrics"
+)
+
+// dashboardWindow is the period that the dashboard's request rate, error
+// rate, and top links are measured over.
+const dashboardWindow = 5 * time.Minute
+
+// dashboardInterval is how often the dashboard stream sends a snapshot.
+const dashboardInterval = 2 * time.Second
+
+// Limits on the lists in a dashboard snapshot.
+const (
+	dashboardTopLinks    = 10
+	dashboardRecentEdits = 20
+)
+
+// activityBucket counts the clicks of each link in a minute.
+type activityBucket struct {
+	minute int64 // Unix time in minutes
+	clicks ClickStats
+}
+
+// activityTracker records recent link clicks, in per-minute buckets covering
+// dashboardWindow, and recent link changes, for the admin dashboard.
+type activityTracker struct {
+	mu      sync.Mutex
+	buckets []activityBucket // ring indexed by minute
+	edits   []dashboardEdit  // oldest first, at most dashboardRecentEdits
+}
+
+// activity tracks recent clicks and changes for the admin dashboard.
+var activity = &activityTracker{buckets: make([]activityBucket, dashboardWindow/time.Minute)}
+
+// click records a click of short.
+func (t *activityTracker) click(now time.Time, short string) {
+	minute := now.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute || b.clicks == nil {
+		*b = activityBucket{minute: minute, clicks: make(ClickStats)}
+	}
+	b.clicks[short]++
+}
+
+// topLinks returns the n links clicked most within dashboardWindow of now,
+// most clicked first.
+func (t *activityTracker) topLinks(now time.Time, n int) []linkActivity {
+	minute := now.Unix() / 60
+	oldest := minute - int64(len(t.buckets))
+	clicks := make(ClickStats)
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.minute <= oldest || b.minute > minute {
+			continue
+		}
+		for short, c := range b.clicks {
+			clicks[short] += c
+		}
+	}
+	t.mu.Unlock()
+
+	links := make([]linkActivity, 0, len(clicks))
+	for short, c := range clicks {
+		links = append(links, linkActivity{Short: short, Clicks: c})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Clicks != links[j].Clicks {
+			return links[i].Clicks > links[j].Clicks
+		}
+		return links[i].Short < links[j].Short
+	})
+	return links[:min(n, len(links))]
+}
+
+// edit records a change to a link.
+func (t *activityTracker) edit(e dashboardEdit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.edits = append(t.edits, e)
+	if len(t.edits) > dashboardRecentEdits {
+		t.edits = slices.Delete(t.edits, 0, len(t.edits)-dashboardRecentEdits)
+	}
+}
+
+// recentEdits returns the recorded link changes, newest first.
+func (t *activityTracker) recentEdits() []dashboardEdit {
+	t.mu.Lock()
+	edits := slices.Clone(t.edits)
+	t.mu.Unlock()
+	slices.Reverse(edits)
+	return edits
+}
+
+// linkActivity is the number of recent clicks of a link.
+type linkActivity struct {
+	Short  string
+	Clicks int
+}
+
+// dashboardEdit is a recent change to a link.
+type dashboardEdit struct {
+	Time   time.Time
+	Action string // create, update, or delete
+	Short  string
+	User   string `json:",omitempty"` // empty for changes golink makes itself
+}
+
+// cacheStats describes one of golink's in-memory caches.
+type cacheStats struct {
+	Name    string
+	Entries int
+	Hits    int64     `json:",omitempty"`
+	Misses  int64     `json:",omitempty"`
+	Loaded  time.Time `json:",omitzero"` // when the cache was last loaded from db, for caches reloaded periodically
+}
+
+// dashboardSnapshot is the state shown by the admin dashboard.
+type dashboardSnapshot struct {
+	Time time.Time
+
+	// RequestRate is the link resolves per second, and ErrorRate the
+	// fraction of them that failed with a server error, over
+	// dashboardWindow. P99Latency is the upper bound in seconds of the
+	// latency bucket containing the 99th percentile resolve.
+	RequestRate float64
+	ErrorRate   float64
+	P99Latency  float64
+
+	TopLinks    []linkActivity
+	RecentEdits []dashboardEdit
+	Caches      []cacheStats
+
+	// StatsQueued is the number of links with clicks not yet saved to db.
+	StatsQueued int
+}
+
+// takeDashboardSnapshot returns the current dashboard state.
+func takeDashboardSnapshot(now time.Time) dashboardSnapshot {
+	s := dashboardSnapshot{
+		Time:        now.UTC(),
+		TopLinks:    activity.topLinks(now, dashboardTopLinks),
+		RecentEdits: activity.recentEdits(),
+	}
+	w := resolveSLO.window(now, dashboardWindow)
+	s.RequestRate = float64(w.total) / dashboardWindow.Seconds()
+	if w.total > 0 {
+		s.ErrorRate = float64(w.errors) / float64(w.total)
+	}
+	s.P99Latency = w.quantile(0.99)
+
+	s.Caches = append(s.Caches, cacheStats{
+		Name:    "templates",
+		Entries: linkTemplates.len(),
+		Hits:    labelCount(templateCacheLookups, "hit"),
+		Misses:  labelCount(templateCacheLookups, "miss"),
+	})
+	suggestionCache.mu.Lock()
+	s.Caches = append(s.Caches, cacheStats{Name: "suggestions", Entries: len(suggestionCache.links), Loaded: suggestionCache.loaded})
+	suggestionCache.mu.Unlock()
+	synonymCache.mu.Lock()
+	s.Caches = append(s.Caches, cacheStats{Name: "synonyms", Entries: len(synonymCache.index), Loaded: synonymCache.loaded})
+	synonymCache.mu.Unlock()
+	reservedCache.mu.Lock()
+	s.Caches = append(s.Caches, cacheStats{Name: "reserved-names", Entries: len(reservedCache.names), Loaded: reservedCache.loaded})
+	reservedCache.mu.Unlock()
+
+	stats.mu.Lock()
+	s.StatsQueued = len(stats.dirty)
+	stats.mu.Unlock()
+	return s
+}
+
+// labelCount returns the count of label in m, or 0 if it has none.
+func labelCount(m *metrics.LabelMap, label string) int64 {
+	if v, ok := m.Map.Get(label).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+// dashboardData is the data used by dashboardTmpl.
+type dashboardData struct {
+	Snapshot dashboardSnapshot
+}
+
+// canViewDashboard reports whether the current user may view the dashboard,
+// responding with an error if not.
+func canViewDashboard(w http.ResponseWriter, r *http.Request) bool {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "dashboard")
+		http.Error(w, "only admins can view the dashboard", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// serveDashboard serves the admin activity dashboard, which shows the
+// request rate, top links, recent edits, error rate, and cache stats and
+// keeps them current using /.api/v1/dashboard/stream. Only admins may view
+// it.
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if !canViewDashboard(w, r) {
+		return
+	}
+	dashboardTmpl.Execute(w, dashboardData{Snapshot: takeDashboardSnapshot(time.Now())})
+}
+
+// serveDashboardAPI handles GET /.api/v1/dashboard, which returns the
+// current dashboard state as JSON. Only admins may use it.
+func serveDashboardAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	if !canViewDashboard(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(takeDashboardSnapshot(time.Now()))
+}
+
+// serveDashboardStream handles GET /.api/v1/dashboard/stream, a server-sent
+// event stream that sends the dashboard state as a JSON "snapshot" event
+// every dashboardInterval until the client disconnects. Only admins may use
+// it.
+func serveDashboardStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	if !canViewDashboard(w, r) {
+		return
+	}
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{}) // the stream outlives any server write timeout
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+	for {
+		b, err := json.Marshal(takeDashboardSnapshot(time.Now()))
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", b); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
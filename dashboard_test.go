@@ -0,0 +1,76 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestActivityTracker(t *testing.T) {
+	tr := &activityTracker{buckets: make([]activityBucket, 5)}
+	now := time.Unix(1700000000, 0)
+	tr.click(now.Add(-10*time.Minute), "old")
+	tr.click(now.Add(-2*time.Minute), "wiki")
+	tr.click(now.Add(-time.Minute), "oncall")
+	tr.click(now, "oncall")
+	tr.click(now, "docs")
+
+	want := []linkActivity{{"oncall", 2}, {"docs", 1}}
+	if diff := cmp.Diff(want, tr.topLinks(now, 2)); diff != "" {
+		t.Errorf("topLinks mismatch (-want +got):\n%s", diff)
+	}
+
+	for i := range dashboardRecentEdits + 1 {
+		tr.edit(dashboardEdit{Time: now.Add(time.Duration(i) * time.Second), Action: "create", Short: "link"})
+	}
+	edits := tr.recentEdits()
+	if len(edits) != dashboardRecentEdits {
+		t.Fatalf("recentEdits returned %d edits; want %d", len(edits), dashboardRecentEdits)
+	}
+	if got, want := edits[0].Time, now.Add(dashboardRecentEdits*time.Second); !got.Equal(want) {
+		t.Errorf("newest edit at %v; want %v", got, want)
+	}
+}
+
+func TestServeDashboardStream(t *testing.T) {
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	w := httptest.NewRecorder()
+	serveAPI(w, httptest.NewRequest("GET", "/.api/v1/dashboard/stream", nil), 0, serveDashboardStream)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("non-admin stream = %d; want %d", w.Code, http.StatusForbidden)
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com", isAdmin: true}, nil }
+	notifyLinkChange("foo@example.com", nil, &Link{Short: "dashboard-test"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // send a single snapshot
+	w = httptest.NewRecorder()
+	serveAPI(w, httptest.NewRequest("GET", "/.api/v1/dashboard/stream", nil).WithContext(ctx), 0, serveDashboardStream)
+	if got := w.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q; want text/event-stream", got)
+	}
+	sc := bufio.NewScanner(w.Body)
+	if !sc.Scan() || sc.Text() != "event: snapshot" || !sc.Scan() {
+		t.Fatalf("stream = %q; want a snapshot event", w.Body.String())
+	}
+	var s dashboardSnapshot
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(sc.Text(), "data: ")), &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.RecentEdits) == 0 || s.RecentEdits[0].Short != "dashboard-test" || s.RecentEdits[0].Action != "create" {
+		t.Errorf("RecentEdits = %+v; want dashboard-test created first", s.RecentEdits)
+	}
+}
@@ -4,20 +4,23 @@
 package golink
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
-	_ "embed"
 	"errors"
 	"fmt"
 	"io/fs"
+	"iter"
 	"log"
-	"net/url"
+	"maps"
+	"regexp"
+	"slices"
 	"strings"
-	"sync"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib" // Import for pgx driver
 	"tailscale.com/tstime"
+	"tailscale.com/util/singleflight"
 )
 
 // Link is the structure stored for each go short link.
@@ -27,32 +30,246 @@ type Link struct {
 	Created  time.Time
 	LastEdit time.Time // when the link was last edited
 	Owner    string    // user@domain
+
+	// RawLong is the target as it was entered, if it differs from its
+	// canonical form stored in Long.
+	RawLong string `json:",omitempty"`
+
+	Tags        []string `json:",omitempty"` // sorted, lowercase labels
+	AutoCreated bool     `json:",omitempty"` // created by an importer or bot rather than a person
+
+	// CoOwners are the stored owner values of other users and teams, such
+	// as "team:infra", who may edit the link as if they owned it. Sorted.
+	CoOwners []string `json:",omitempty"`
+
+	// Successor is the short name that replaces a deprecated link,
+	// and Deprecated is when the link was deprecated.
+	Successor  string    `json:",omitempty"`
+	Deprecated time.Time `json:",omitzero"`
+
+	// Expires is when the link stops resolving, or the zero time if it
+	// never expires. Expired links are kept so that they can be renewed.
+	Expires time.Time `json:",omitzero"`
+
+	// Fallbacks are targets to use, in order, when Long is marked unhealthy.
+	Fallbacks []string `json:",omitempty"`
+
+	// MaintenanceTarget is used instead of Long during maintenance windows
+	// that apply to the link.
+	MaintenanceTarget string `json:",omitempty"`
+
+	// Headers are extra response headers set when redirecting to the link's
+	// target, keyed by canonical header name.
+	Headers map[string]string `json:",omitempty"`
+
+	// Params is a template of query parameters, such as
+	// "utm_source=golink&utm_content={{.Path}}", appended to the target when
+	// they are not already present.
+	Params string `json:",omitempty"`
+
+	// MaxUses is the number of times a one-time link can be resolved before
+	// it is deleted, or 0 if it is not limited. Uses is the number of times it
+	// has been resolved so far; it is maintained by UseLink and is not
+	// written by Save.
+	MaxUses int `json:",omitempty"`
+	Uses    int `json:",omitempty"`
+
+	// HealthCheck overrides how the dead link checker checks Long, such as
+	// "off" or "status=302 auth=okta"; see parseHealthCheck. Empty uses the
+	// default check.
+	HealthCheck string `json:",omitempty"`
+
+	// Version is incremented each time the link is saved. It is used to
+	// detect concurrent edits with Update.
+	Version int `json:",omitempty"`
+
+	// TotalClicks is the number of times the link has been visited, as of the
+	// last time stats were saved. It is maintained by SaveStats and is not
+	// written by Save.
+	TotalClicks int `json:",omitempty"`
+
+	// ExternalClicks is the number of TotalClicks from visitors to
+	// --public-hostname rather than tailnet users. It is maintained by
+	// SaveExternalClicks and is not written by Save.
+	ExternalClicks int `json:",omitempty"`
+
+	// Editor is the stored owner value of the user saving the link, which
+	// Save records in the link's history. It is not stored with the link.
+	Editor string `json:"-"`
+}
+
+// clone returns a deep copy of l.
+func (l *Link) clone() *Link {
+	c := *l
+	c.Tags = slices.Clone(l.Tags)
+	c.CoOwners = slices.Clone(l.CoOwners)
+	c.Fallbacks = slices.Clone(l.Fallbacks)
+	c.Headers = maps.Clone(l.Headers)
+	return &c
+}
+
+// HasTag reports whether the link is labeled with tag.
+func (l *Link) HasTag(tag string) bool {
+	tag = strings.ToLower(tag)
+	for _, t := range l.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Team is a named group of users that can own links.
+type Team struct {
+	Name      string
+	Namespace string   // default namespace for the team's links, if any
+	Members   []string // sorted user@domain logins
+	Created   time.Time
+}
+
+// Collection is a curated, ordered set of links, such as a starter pack of
+// links for new engineers.
+type Collection struct {
+	Name        string // identifier, such as "engineer"
+	Title       string // display name, such as "Engineering starter pack"
+	Description string
+	Position    int // display order among collections, ascending
+	Links       []CollectionLink
+}
+
+// CollectionLink is a link in a Collection, in display order.
+type CollectionLink struct {
+	Short       string
+	Description string
+}
+
+// TargetHealth is the most recent health check result for a link target.
+type TargetHealth struct {
+	Target  string
+	Healthy bool
+	Checked time.Time
+	Detail  string // reason the target was marked unhealthy
+}
+
+// MaintenanceWindow is a period during which links are redirected to their
+// maintenance target. A window applies either to a single link or to all
+// links with a tag.
+type MaintenanceWindow struct {
+	ID        int64
+	Short     string `json:",omitempty"` // link the window applies to
+	Tag       string `json:",omitempty"` // tag of the links the window applies to
+	Start     time.Time
+	End       time.Time
+	Target    string `json:",omitempty"` // overrides the link's MaintenanceTarget if set
+	Reason    string `json:",omitempty"`
+	CreatedBy string
+}
+
+// SmartList is a named link query saved by a user, such as
+// "stale oncall links" for "tag:oncall edited<180d".
+type SmartList struct {
+	Owner   string // user@domain
+	Name    string
+	Query   string // link query expression
+	Created time.Time
+}
+
+// APIToken is a long-lived token that automation uses to call the API as
+// Login, limited to its Scopes. The token itself is only shown when it is
+// created; only its hash is stored.
+type APIToken struct {
+	ID        string
+	Name      string
+	Login     string   // user@domain
+	Scopes    []string // such as "links:read"
+	Created   time.Time
+	CreatedBy string
+	Revoked   time.Time `json:",omitzero"`
+}
+
+// ReservedName is a short name that links may not be created with, such as
+// one needed for routing.
+type ReservedName struct {
+	Name      string
+	Reason    string    `json:",omitempty"`
+	Created   time.Time `json:",omitzero"`
+	CreatedBy string    `json:",omitempty"` // empty if reserved by --reserved-names
+}
+
+// HomeSection is a section of the home page, listing links of one Kind:
+// "pinned" links chosen by admins, "popular" links with the most clicks,
+// "trending" links with the most clicks this week, "yours", the links the
+// visitor owns, "new" links created this week, or links with a "tag".
+type HomeSection struct {
+	Kind   string
+	Title  string   `json:",omitempty"` // heading, or "" for the default of Kind
+	Tag    string   `json:",omitempty"` // for Kind "tag"
+	Links  []string `json:",omitempty"` // short names, in order, for Kind "pinned"
+	Limit  int      `json:",omitempty"` // most links shown, or 0 for defaultHomeSectionLimit
+	Hidden bool     `json:",omitempty"` // configured but not shown
+}
+
+// LinkRevision is a version of a link recorded in its history.
+type LinkRevision struct {
+	Revision int // 1 for the first revision of a link
+	Short    string
+	Long     string
+	Owner    string
+	Tags     []string `json:",omitempty"`
+	Edited   time.Time
+	Editor   string `json:",omitempty"` // who made the change, if known
+	Deleted  bool   `json:",omitempty"` // the link was deleted at Edited
+}
+
+// Active reports whether the window is in effect at t.
+func (m *MaintenanceWindow) Active(t time.Time) bool {
+	return !t.Before(m.Start) && t.Before(m.End)
 }
 
 // ClickStats is the number of clicks a set of links have received in a given
 // time period. It is keyed by link short name, with values of total clicks.
 type ClickStats map[string]int
 
-// linkID returns the normalized ID for a link short name.
-func linkID(short string) string {
-	id := url.PathEscape(strings.ToLower(short))
-	id = strings.ReplaceAll(id, "-", "")
-	return id
+// ClickSource identifies where clicks of a link came from.
+type ClickSource struct {
+	Path     string // the path requested under the link, such as "design" for go/docs/design
+	Referrer string // the host of the page that linked to it
+}
+
+// ClickSources breaks down the clicks in a ClickStats by where they came
+// from. It is keyed by link short name. Clicks with no known path or
+// referrer are not included.
+type ClickSources map[string]map[ClickSource]int
+
+// ClickCount is the number of clicks of a link with one path, referrer, or
+// day, as returned by LoadClickBreakdown and LoadDailyClicks.
+type ClickCount struct {
+	Value  string
+	Clicks int
 }
 
 // PostgresDB stores Links in a PostgreSQL database.
 type PostgresDB struct {
 	db *sql.DB
-	mu sync.RWMutex
+
+	// loads coalesces concurrent Loads of the same link, keyed by link ID.
+	// Writes to a link forget its key once committed, so that later Loads
+	// query the database again rather than share a query made before it.
+	loads singleflight.Group[string, *Link]
+
+	// cache holds recently loaded links if enabled by EnableCache, or is nil.
+	cache *linkCache
+
+	// shared holds loaded links for every replica if enabled by
+	// EnableRedis, or is nil.
+	shared *RedisDB
 
 	clock tstime.Clock // allow overriding time for tests
 }
 
-//go:embed schema.sql
-var sqlSchema string
-
 // NewPostgresDB returns a new PostgresDB that stores links in a PostgreSQL database.
 // dsn is the Data Source Name (connection string) for PostgreSQL.
+// Pending schema migrations are applied before it returns.
 func NewPostgresDB(dsn string) (*PostgresDB, error) {
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
@@ -62,189 +279,2398 @@ func NewPostgresDB(dsn string) (*PostgresDB, error) {
 		return nil, err
 	}
 
-	if _, err = db.Exec(sqlSchema); err != nil {
-		// It's possible the schema already exists, which might not be an error.
-		// Depending on the desired behavior, this error handling might need adjustment.
-		// For now, we'll return it.
-		return nil, fmt.Errorf("error executing schema: %w", err)
+	ms, err := loadMigrations(migrationFS)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrate(context.Background(), db, ms); err != nil {
+		return nil, fmt.Errorf("migrating schema: %w", err)
 	}
 
 	return &PostgresDB{db: db}, nil
 }
 
+// SetPoolSize limits the number of open connections to the database to
+// maxOpen, or no limit if maxOpen is zero, and keeps up to maxIdle idle
+// connections open for reuse.
+func (s *PostgresDB) SetPoolSize(maxOpen, maxIdle int) {
+	s.db.SetMaxOpenConns(maxOpen)
+	s.db.SetMaxIdleConns(maxIdle)
+}
+
 // Now returns the current time.
 func (s *PostgresDB) Now() time.Time {
 	return tstime.DefaultClock{Clock: s.clock}.Now()
 }
 
+// linkColumns are the Links table columns read by scanLink, in order.
+const linkColumns = "Short, Long, RawLong, Created, LastEdit, Owner, AutoCreated, Successor, Deprecated, Expires, Fallbacks, MaintenanceTarget, Headers, Params, MaxUses, Uses, Version, TotalClicks, ExternalClicks, HealthCheck"
+
+// scanLink scans a row of linkColumns into a new Link.
+// Tags are stored separately and are not populated.
+func scanLink(row interface{ Scan(...any) error }) (*Link, error) {
+	link := new(Link)
+	var created, lastEdit, deprecated, expires int64
+	var fallbacks, headers string
+	if err := row.Scan(&link.Short, &link.Long, &link.RawLong, &created, &lastEdit, &link.Owner, &link.AutoCreated, &link.Successor, &deprecated, &expires, &fallbacks, &link.MaintenanceTarget, &headers, &link.Params, &link.MaxUses, &link.Uses, &link.Version, &link.TotalClicks, &link.ExternalClicks, &link.HealthCheck); err != nil {
+		return nil, err
+	}
+	if fallbacks != "" {
+		link.Fallbacks = strings.Split(fallbacks, "\n")
+	}
+	h, err := parseLinkHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	link.Headers = h
+	link.Created = time.Unix(created, 0).UTC()
+	link.LastEdit = time.Unix(lastEdit, 0).UTC()
+	link.Deprecated = optionalTime(deprecated)
+	link.Expires = optionalTime(expires)
+	return link, nil
+}
+
+// optionalTime returns the UTC time for unix seconds, or the zero time if
+// sec is zero. It is the inverse of optionalUnix.
+func optionalTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0).UTC()
+}
+
+// optionalUnix returns t as unix seconds, or zero if t is the zero time.
+func optionalUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
 // LoadAll returns all stored Links.
 //
 // The caller owns the returned values.
 func (s *PostgresDB) LoadAll() ([]*Link, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	return s.LoadWhere("TRUE")
+}
+
+// LoadByTag returns the stored Links labeled with tag.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadByTag(tag string) ([]*Link, error) {
+	return s.LoadWhere("ID IN (SELECT ID FROM LinkTags WHERE Tag = $1)", strings.ToLower(tag))
+}
 
+// LoadWhere returns the stored Links matching the SQL condition cond, which
+// may refer to the columns of the Links table and to args as $1, $2, etc.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadWhere(cond string, args ...any) ([]*Link, error) {
+	defer dbQuerySeconds.observe("LoadWhere", time.Now())
 	var links []*Link
-	rows, err := s.db.Query("SELECT Short, Long, Created, LastEdit, Owner FROM Links")
+	rows, err := s.db.Query("SELECT "+linkColumns+" FROM Links WHERE "+cond, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close() // Ensure rows are closed
 	for rows.Next() {
-		link := new(Link)
-		var created, lastEdit int64
-		err := rows.Scan(&link.Short, &link.Long, &created, &lastEdit, &link.Owner)
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tags, err := s.loadAllTags()
+	if err != nil {
+		return nil, err
+	}
+	coOwners, err := s.loadAllCoOwners()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		link.Tags = tags[linkID(link.Short)]
+		link.CoOwners = coOwners[linkID(link.Short)]
+	}
+	return links, nil
+}
+
+// LoadPage returns up to limit stored Links matching the SQL condition
+// cond, as for LoadWhere, ordered by ID and starting after the ID of the
+// short name after, if it is not empty. A limit of 0 returns every matching
+// link.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadPage(cond, after string, limit int, args ...any) ([]*Link, error) {
+	defer dbQuerySeconds.observe("LoadPage", time.Now())
+	args = slices.Clip(args)
+	query := "SELECT " + linkColumns + " FROM Links WHERE (" + cond + ")"
+	if after != "" {
+		args = append(args, linkID(after))
+		query += fmt.Sprintf(" AND ID > $%d", len(args))
+	}
+	query += " ORDER BY ID"
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []*Link
+	byID := make(map[string]*Link)
+	for rows.Next() {
+		link, err := scanLink(rows)
 		if err != nil {
 			return nil, err
 		}
-		link.Created = time.Unix(created, 0).UTC()
-		link.LastEdit = time.Unix(lastEdit, 0).UTC()
 		links = append(links, link)
+		byID[linkID(link.Short)] = link
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	// only the tags and co-owners of this page
+	ids := slices.Collect(maps.Keys(byID))
+	for _, q := range []struct {
+		query  string
+		values func(*Link) *[]string
+	}{
+		{"SELECT ID, Tag FROM LinkTags WHERE ID = ANY($1) ORDER BY ID, Tag", func(l *Link) *[]string { return &l.Tags }},
+		{"SELECT ID, Owner FROM LinkOwners WHERE ID = ANY($1) ORDER BY ID, Owner", func(l *Link) *[]string { return &l.CoOwners }},
+	} {
+		rows, err := s.db.Query(q.query, ids)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id, v string
+			if err := rows.Scan(&id, &v); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if link := byID[id]; link != nil {
+				vs := q.values(link)
+				*vs = append(*vs, v)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// AllLinks returns an iterator over all stored Links, ordered by short
+// name, that reads them from the database as they are consumed rather than
+// loading them all into memory. Iteration stops after the first error.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) AllLinks(ctx context.Context) iter.Seq2[*Link, error] {
+	return func(yield func(*Link, error) bool) {
+		tags, err := s.loadAllTags()
+		var coOwners map[string][]string
+		if err == nil {
+			coOwners, err = s.loadAllCoOwners()
+		}
+		var rows *sql.Rows
+		if err == nil {
+			rows, err = s.db.QueryContext(ctx, "SELECT "+linkColumns+` FROM Links ORDER BY Short COLLATE "C"`)
+		}
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			link, err := scanLink(rows)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			link.Tags = tags[linkID(link.Short)]
+			link.CoOwners = coOwners[linkID(link.Short)]
+			if !yield(link, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(nil, err)
+		}
 	}
-	return links, rows.Err()
 }
 
 // Load returns a Link by its short name.
 //
+// Concurrent loads of the same link share a single database query, so that
+// a popular link doesn't cause a query per visitor. A load that starts after
+// a write to the link has returned never shares the result of a query made
+// before it. If the cache is enabled, cached links are returned without a
+// query.
+//
 // It returns fs.ErrNotExist if the link does not exist.
 //
 // The caller owns the returned value.
 func (s *PostgresDB) Load(short string) (*Link, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	id := linkID(short)
+	var gen uint64
+	if s.cache != nil {
+		var link *Link
+		if link, gen = s.cache.get(id, s.Now()); link != nil {
+			return link, nil
+		}
+	}
+	link, err, shared := s.loads.Do(id, func() (*Link, error) {
+		return s.loadShared(id)
+	})
+	if s.cache != nil && err == nil {
+		s.cache.put(id, link, gen, s.Now())
+	}
+	if shared && link != nil {
+		// each caller owns its value
+		link = link.clone()
+	}
+	return link, err
+}
 
-	link := new(Link)
-	var created, lastEdit int64
+// loadShared returns the Link with the specified ID from the Redis server
+// shared by the replicas, if enabled, or else from the database, putting it
+// on the Redis server for the next replica to load it.
+func (s *PostgresDB) loadShared(id string) (*Link, error) {
+	if s.shared == nil {
+		return s.load(id)
+	}
+	if link, err := s.shared.loadID(id); err == nil {
+		return link, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("redis: loading link: %v", err)
+	}
+	// read first, so that the link isn't put if it is written meanwhile
+	gen, genErr := s.shared.generation(id)
+	link, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if genErr != nil {
+		log.Printf("redis: loading link generation: %v", genErr)
+	} else if err := s.shared.put(link, gen); err != nil {
+		log.Printf("redis: saving link: %v", err)
+	}
+	return link, nil
+}
+
+// load returns the Link with the specified ID.
+func (s *PostgresDB) load(id string) (*Link, error) {
+	defer dbQuerySeconds.observe("Load", time.Now())
 	// Use $1 for placeholder in PostgreSQL
-	row := s.db.QueryRow("SELECT Short, Long, Created, LastEdit, Owner FROM Links WHERE ID = $1 LIMIT 1", linkID(short))
-	err := row.Scan(&link.Short, &link.Long, &created, &lastEdit, &link.Owner)
+	row := s.db.QueryRow("SELECT "+linkColumns+" FROM Links WHERE ID = $1 LIMIT 1", id)
+	link, err := scanLink(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = fs.ErrNotExist
 		}
 		return nil, err
 	}
-	link.Created = time.Unix(created, 0).UTC()
-	link.LastEdit = time.Unix(lastEdit, 0).UTC()
+	if link.Tags, err = s.loadTags(id); err != nil {
+		return nil, err
+	}
+	if link.CoOwners, err = s.loadCoOwners(s.db, id); err != nil {
+		return nil, err
+	}
 	return link, nil
 }
 
-// Save saves a Link.
-func (s *PostgresDB) Save(link *Link) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	// PostgreSQL equivalent of INSERT OR REPLACE
-	query := `
-INSERT INTO Links (ID, Short, Long, Created, LastEdit, Owner)
-VALUES ($1, $2, $3, $4, $5, $6)
-ON CONFLICT (ID) DO UPDATE SET
-	Short = EXCLUDED.Short,
-	Long = EXCLUDED.Long,
-	Created = EXCLUDED.Created,
-	LastEdit = EXCLUDED.LastEdit,
-	Owner = EXCLUDED.Owner`
-	result, err := s.db.Exec(query, linkID(link.Short), link.Short, link.Long, link.Created.Unix(), link.LastEdit.Unix(), link.Owner)
+// loadTags returns the sorted tags for the link with the specified ID.
+func (s *PostgresDB) loadTags(id string) ([]string, error) {
+	rows, err := s.db.Query("SELECT Tag FROM LinkTags WHERE ID = $1 ORDER BY Tag", id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	rows, err := result.RowsAffected()
+	defer rows.Close()
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// loadAllTags returns the sorted tags of every link, keyed by link ID.
+func (s *PostgresDB) loadAllTags() (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT ID, Tag FROM LinkTags ORDER BY ID, Tag")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if rows != 1 {
-		// In PostgreSQL, ON CONFLICT DO UPDATE for an existing row might report 0 rows affected by some drivers/versions
-		// if no actual change was made to the row's data, or it might report 1.
-		// It's safer not to strictly check for 1 row affected here if the operation is an upsert.
-		// However, if an INSERT occurs, it should be 1. If an UPDATE occurs, it can be 0 or 1.
-		// For simplicity, we'll keep the check for now but this might need refinement.
-		// return fmt.Errorf("expected to affect 1 row, affected %d", rows)
+	defer rows.Close()
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], tag)
 	}
-	return nil
+	return tags, rows.Err()
 }
 
-// Delete removes a Link using its short name.
-func (s *PostgresDB) Delete(short string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
 
-	// Use $1 for placeholder in PostgreSQL
-	result, err := s.db.Exec("DELETE FROM Links WHERE ID = $1", linkID(short))
+// loadCoOwners returns the sorted co-owners of the link with the specified
+// ID, as seen by q.
+func (s *PostgresDB) loadCoOwners(q queryer, id string) ([]string, error) {
+	rows, err := q.Query("SELECT Owner FROM LinkOwners WHERE ID = $1 ORDER BY Owner", id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	rows, err := result.RowsAffected()
+	defer rows.Close()
+	var owners []string
+	for rows.Next() {
+		var owner string
+		if err := rows.Scan(&owner); err != nil {
+			return nil, err
+		}
+		owners = append(owners, owner)
+	}
+	return owners, rows.Err()
+}
+
+// loadAllCoOwners returns the sorted co-owners of every link, keyed by link
+// ID.
+func (s *PostgresDB) loadAllCoOwners() (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT ID, Owner FROM LinkOwners ORDER BY ID, Owner")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if rows != 1 {
-		return fmt.Errorf("expected to affect 1 row, affected %d", rows)
+	defer rows.Close()
+	owners := make(map[string][]string)
+	for rows.Next() {
+		var id, owner string
+		if err := rows.Scan(&id, &owner); err != nil {
+			return nil, err
+		}
+		owners[id] = append(owners[id], owner)
 	}
-	return nil
+	return owners, rows.Err()
 }
 
-// LoadStats returns click stats for links.
-func (s *PostgresDB) LoadStats() (ClickStats, error) {
-	log.Println("DEBUG: PostgresDB.LoadStats() called")
-	rows, err := s.db.Query("SELECT ID, SUM(Clicks) FROM Stats GROUP BY ID")
+// ConflictError is returned by Update when a link was changed after it was
+// loaded.
+type ConflictError struct {
+	Current *Link // the link as now stored, or nil if it was deleted
+}
+
+func (e *ConflictError) Error() string {
+	if e.Current == nil {
+		return "link was deleted by someone else"
+	}
+	return fmt.Sprintf("link was changed by someone else (version %d)", e.Current.Version)
+}
+
+// saveMode controls how save treats an existing link.
+type saveMode int
+
+const (
+	saveAlways saveMode = iota // replace any existing link
+	saveCreate                 // fail with fs.ErrExist if the link exists
+	saveUpdate                 // fail with *ConflictError if the link changed
+)
+
+// Save saves a Link, replacing any existing link with the same ID.
+// link.Version is set to the new version.
+func (s *PostgresDB) Save(link *Link) error {
+	return s.save(link, saveAlways, false)
+}
+
+// Create saves a new Link. It returns fs.ErrExist if a link or alias with
+// the same ID already exists, rather than replacing it.
+func (s *PostgresDB) Create(link *Link) error {
+	return s.save(link, saveCreate, false)
+}
+
+// NextInSequence allocates the next number of the family of links named
+// prefix followed by a number, such as 43 for release- after release-42.
+// Numbers are never allocated twice, even to concurrent callers, and follow
+// the highest numbered link or alias of the family, so that links created
+// by hand are skipped.
+func (s *PostgresDB) NextInSequence(prefix string) (int64, error) {
+	defer dbQuerySeconds.observe("NextInSequence", time.Now())
+	id := linkID(prefix)
+	rows, err := s.db.Query(`
+SELECT ID FROM Links WHERE left(ID, length($1)) = $1
+UNION ALL
+SELECT ID FROM Aliases WHERE left(ID, length($1)) = $1`, id)
 	if err != nil {
-		log.Printf("DEBUG: PostgresDB.LoadStats() db.Query error: %v", err)
-		return nil, fmt.Errorf("querying stats: %w", err)
+		return 0, err
 	}
 	defer rows.Close()
-
-	stats := make(ClickStats)
-	log.Println("DEBUG: PostgresDB.LoadStats() entering row scan loop")
+	var highest int64
 	for rows.Next() {
-		var id string
-		var clicks int
-		if err := rows.Scan(&id, &clicks); err != nil {
-			log.Printf("DEBUG: PostgresDB.LoadStats() rows.Scan error: %v", err)
-			return nil, fmt.Errorf("scanning stat row: %w", err)
+		var other string
+		if err := rows.Scan(&other); err != nil {
+			return 0, err
+		}
+		if n, ok := sequenceNumber(id, other); ok {
+			highest = max(highest, n)
 		}
-		stats[id] = clicks
 	}
-	log.Println("DEBUG: PostgresDB.LoadStats() exited row scan loop")
 	if err := rows.Err(); err != nil {
-		log.Printf("DEBUG: PostgresDB.LoadStats() rows.Err error: %v", err)
-		return nil, fmt.Errorf("stat rows.Err: %w", err)
+		return 0, err
 	}
-	log.Println("DEBUG: PostgresDB.LoadStats() successful")
-	return stats, nil
+
+	var n int64
+	err = s.db.QueryRow(`
+INSERT INTO LinkSequences (Prefix, Last) VALUES ($1, $2 + 1)
+ON CONFLICT (Prefix) DO UPDATE SET Last = GREATEST(LinkSequences.Last, $2) + 1
+RETURNING Last`, id, highest).Scan(&n)
+	return n, err
 }
 
-// SaveStats records click stats for links. The provided map includes
-// incremental clicks that have occurred since the last time SaveStats
-// was called.
-func (s *PostgresDB) SaveStats(stats ClickStats) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Update saves a Link only if the stored link is still at link.Version, so
+// that concurrent edits don't silently overwrite each other. It returns a
+// *ConflictError if the link was changed or deleted since that version.
+// link.Version is set to the new version.
+func (s *PostgresDB) Update(link *Link) error {
+	return s.save(link, saveUpdate, false)
+}
 
+// save saves link as Save, Create, or Update do for mode. If quotas is set,
+// it fails with an error wrapping errQuotaExceeded if that would exceed a
+// quota, as checkQuotas reports for link.Owner and the creator link.Editor.
+// Quotas are counted in the transaction saving the link, under advisory
+// locks on the owner, namespace, and creator, so that concurrent saves
+// can't each find room for one more link and together exceed a quota.
+func (s *PostgresDB) save(link *Link, mode saveMode, quotas bool) error {
+	defer dbQuerySeconds.observe("Save", time.Now())
 	tx, err := s.db.BeginTx(context.TODO(), nil)
 	if err != nil {
 		return err
 	}
-	now := s.Now().Unix()
-	for short, clicks := range stats {
-		// Use $1, $2, $3 for placeholders in PostgreSQL
-		_, err := tx.Exec("INSERT INTO Stats (ID, Created, Clicks) VALUES ($1, $2, $3)", linkID(short), now, clicks)
+	defer tx.Rollback()
+
+	id := linkID(link.Short)
+	if quotas {
+		for _, key := range quotaLockKeys(link.Short, link.Owner, link.Editor) {
+			if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", key); err != nil {
+				return err
+			}
+		}
+	}
+	var existing *Link
+	conflict := linkUpsert
+	switch mode {
+	case saveUpdate:
+		current, err := scanLink(tx.QueryRow("SELECT "+linkColumns+" FROM Links WHERE ID = $1 FOR UPDATE", id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return &ConflictError{}
+		}
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
+		if current.Version != link.Version {
+			if current.Tags, err = s.loadTags(id); err != nil {
+				return err
+			}
+			if current.CoOwners, err = s.loadCoOwners(s.db, id); err != nil {
+				return err
+			}
+			return &ConflictError{Current: current}
+		}
+		existing = current
+	case saveCreate:
+		var aliased bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM Aliases WHERE ID = $1)", id).Scan(&aliased); err != nil {
+			return err
+		}
+		if aliased {
+			return fs.ErrExist
+		}
+		conflict = "DO NOTHING"
+	}
+	if quotas {
+		if mode != saveUpdate {
+			existing, err = scanLink(tx.QueryRow("SELECT "+linkColumns+" FROM Links WHERE ID = $1 FOR UPDATE", id))
+			if errors.Is(err, sql.ErrNoRows) {
+				existing = nil
+			} else if err != nil {
+				return err
+			}
+		}
+		if mode == saveCreate && existing != nil {
+			return fs.ErrExist
+		}
+		if err := checkQuotas(linkCounter{tx}, existing, link.Short, link.Owner, link.Editor, s.Now()); err != nil {
+			return err
+		}
+	}
+	query := `
+INSERT INTO Links (ID, Short, Long, RawLong, Created, LastEdit, Owner, AutoCreated, Successor, Deprecated, Expires, Fallbacks, MaintenanceTarget, Headers, Params, MaxUses, Version, IDVersion, HealthCheck, Creator, Inserted)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, 1, $17, $18, $19, $20)
+ON CONFLICT (ID) ` + conflict + `
+RETURNING Version`
+	var version int
+	err = tx.QueryRow(query, id, link.Short, link.Long, link.RawLong, link.Created.Unix(), link.LastEdit.Unix(), link.Owner, link.AutoCreated, link.Successor, optionalUnix(link.Deprecated), optionalUnix(link.Expires), strings.Join(link.Fallbacks, "\n"), link.MaintenanceTarget, formatLinkHeaders(link.Headers), link.Params, link.MaxUses, currentIDStrategy.version, link.HealthCheck, link.Editor, s.Now().Unix()).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		// only possible when creating
+		return fs.ErrExist
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM LinkTags WHERE ID = $1", id); err != nil {
+		return err
+	}
+	for _, tag := range link.Tags {
+		if _, err := tx.Exec("INSERT INTO LinkTags (ID, Tag) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, tag); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM LinkOwners WHERE ID = $1", id); err != nil {
+		return err
+	}
+	for _, owner := range link.CoOwners {
+		if _, err := tx.Exec("INSERT INTO LinkOwners (ID, Owner) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, owner); err != nil {
+			return err
+		}
+	}
+	if err := addRevision(tx, id, link, link.Editor, link.LastEdit, false); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.forget(id)
+	link.Version = version
+	return nil
+}
+
+// linkUpsert is the conflict action used by Save to replace existing links.
+// It is the PostgreSQL equivalent of INSERT OR REPLACE, except that the
+// Creator and Inserted of the link are kept.
+const linkUpsert = `DO UPDATE SET
+	Short = EXCLUDED.Short,
+	Long = EXCLUDED.Long,
+	RawLong = EXCLUDED.RawLong,
+	Created = EXCLUDED.Created,
+	LastEdit = EXCLUDED.LastEdit,
+	Owner = EXCLUDED.Owner,
+	AutoCreated = EXCLUDED.AutoCreated,
+	Successor = EXCLUDED.Successor,
+	Deprecated = EXCLUDED.Deprecated,
+	Expires = EXCLUDED.Expires,
+	Fallbacks = EXCLUDED.Fallbacks,
+	MaintenanceTarget = EXCLUDED.MaintenanceTarget,
+	Headers = EXCLUDED.Headers,
+	Params = EXCLUDED.Params,
+	MaxUses = EXCLUDED.MaxUses,
+	IDVersion = EXCLUDED.IDVersion,
+	HealthCheck = EXCLUDED.HealthCheck,
+	Version = Links.Version + 1`
+
+// addRevision records link as the next revision in the history of id, made
+// by editor.
+func addRevision(tx *sql.Tx, id string, link *Link, editor string, edited time.Time, deleted bool) error {
+	query := `
+INSERT INTO LinkHistory (ID, Revision, Short, Long, Owner, Tags, Edited, Editor, Deleted)
+SELECT $1, COALESCE(MAX(Revision), 0) + 1, $2, $3, $4, $5, $6, $7, $8
+FROM LinkHistory WHERE ID = $1`
+	_, err := tx.Exec(query, id, link.Short, link.Long, link.Owner, strings.Join(link.Tags, "\n"), edited.Unix(), editor, deleted)
+	return err
+}
+
+// Delete removes a Link using its short name, recording its deletion by
+// editor, a stored owner value, in the link's history.
+//
+// It returns fs.ErrNotExist if the link does not exist.
+func (s *PostgresDB) Delete(short, editor string) error {
+	defer dbQuerySeconds.observe("Delete", time.Now())
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id := linkID(short)
+	if err := s.deleteTx(tx, id, editor); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.forget(id)
+	return nil
+}
+
+// DeleteLinks removes the links with the given short names in a single
+// transaction, recording each deletion by editor in the link's history.
+// Either all of the links are deleted or, on error, none are.
+//
+// It returns fs.ErrNotExist if any of the links does not exist.
+func (s *PostgresDB) DeleteLinks(shorts []string, editor string) error {
+	defer dbQuerySeconds.observe("DeleteLinks", time.Now())
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, short := range shorts {
+		if err := s.deleteTx(tx, linkID(short), editor); err != nil {
+			return fmt.Errorf("%s: %w", short, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, short := range shorts {
+		s.forget(linkID(short))
+	}
+	return nil
+}
+
+// TransferOwner reassigns every link owned by from to the owner to with a
+// single UPDATE, and gives to the links that from co-owns, recording the
+// change by editor in each link's history. Owners are stored owner values.
+// It returns the changed links as they were before and after the transfer,
+// in the same order.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) TransferOwner(from, to, editor string) (before, after []*Link, err error) {
+	defer dbQuerySeconds.observe("TransferOwner", time.Now())
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	scanLinks := func(rows *sql.Rows, err error) ([]*Link, error) {
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var links []*Link
+		for rows.Next() {
+			link, err := scanLink(rows)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, link)
+		}
+		return links, rows.Err()
+	}
+
+	now := s.Now().UTC()
+	after, err = scanLinks(tx.Query("UPDATE Links SET Owner = $2, LastEdit = $3, Version = Version + 1 WHERE Owner = $1 RETURNING "+linkColumns, from, to, now.Unix()))
+	if err != nil {
+		return nil, nil, err
+	}
+	owned := make(map[string]bool)
+	for _, link := range after {
+		owned[linkID(link.Short)] = true
+	}
+
+	// to replaces from as a co-owner, unless it already was one
+	rows, err := tx.Query("DELETE FROM LinkOwners WHERE Owner = $1 RETURNING ID", from)
+	if err != nil {
+		return nil, nil, err
+	}
+	var coOwned []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		coOwned = append(coOwned, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	replaced := make(map[string]bool) // co-owned links to was added to
+	var coOnly []string               // co-owned links not also owned by from
+	for _, id := range coOwned {
+		result, err := tx.Exec("INSERT INTO LinkOwners (ID, Owner) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, to)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, nil, err
+		} else if n == 1 {
+			replaced[id] = true
+		}
+		if !owned[id] {
+			coOnly = append(coOnly, id)
+		}
+	}
+	coLinks, err := scanLinks(tx.Query("UPDATE Links SET LastEdit = $2, Version = Version + 1 WHERE ID = ANY($1) RETURNING "+linkColumns, coOnly, now.Unix()))
+	if err != nil {
+		return nil, nil, err
+	}
+	after = append(after, coLinks...)
+
+	coOwnedBy := make(map[string]bool)
+	for _, id := range coOwned {
+		coOwnedBy[id] = true
+	}
+	for _, link := range after {
+		id := linkID(link.Short)
+		if link.Tags, err = s.loadTags(id); err != nil {
+			return nil, nil, err
+		}
+		if link.CoOwners, err = s.loadCoOwners(tx, id); err != nil {
+			return nil, nil, err
+		}
+		link.Editor = editor
+		if err := addRevision(tx, id, link, editor, now, false); err != nil {
+			return nil, nil, err
+		}
+
+		old := link.clone()
+		if owned[id] {
+			old.Owner = from
+		}
+		if coOwnedBy[id] {
+			if replaced[id] {
+				old.CoOwners = slices.DeleteFunc(old.CoOwners, func(o string) bool { return o == to })
+			}
+			old.CoOwners = append(old.CoOwners, from)
+			slices.Sort(old.CoOwners)
+		}
+		before = append(before, old)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	for _, link := range after {
+		s.forget(linkID(link.Short))
+	}
+	return before, after, nil
+}
+
+// deleteTx removes the link with the specified ID in tx, recording its
+// deletion by editor in the link's history.
+func (s *PostgresDB) deleteTx(tx *sql.Tx, id, editor string) error {
+	// lock the row, so that a concurrent delete waits for this one and then
+	// finds no link
+	link, err := scanLink(tx.QueryRow("SELECT "+linkColumns+" FROM Links WHERE ID = $1 FOR UPDATE", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fs.ErrNotExist
+		}
+		return err
 	}
-	return tx.Commit()
-}
-
-// DeleteStats deletes click stats for a link.
-func (s *PostgresDB) DeleteStats(short string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
 
 	// Use $1 for placeholder in PostgreSQL
-	_, err := s.db.Exec("DELETE FROM Stats WHERE ID = $1", linkID(short))
+	result, err := tx.Exec("DELETE FROM Links WHERE ID = $1", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return fmt.Errorf("expected to affect 1 row, affected %d", rows)
+	}
+	if _, err := tx.Exec("DELETE FROM LinkTags WHERE ID = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM LinkOwners WHERE ID = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM Aliases WHERE Target = $1", id); err != nil {
+		return err
+	}
+	return addRevision(tx, id, link, editor, s.Now(), true)
+}
+
+// errLinkUsedUp is returned by UseLink when a link has no uses left.
+var errLinkUsedUp = errors.New("link has no uses left")
+
+// UseLink counts a resolution of a link limited to MaxUses resolutions, and
+// returns the number of uses left. The link is deleted when its last use is
+// taken. Uses are counted atomically, so concurrent visitors can never
+// resolve a link more than MaxUses times.
+//
+// It returns errLinkUsedUp if the link has no uses left, including when it
+// no longer exists because another visitor took its last use.
+func (s *PostgresDB) UseLink(short string) (int, error) {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id := linkID(short)
+	var uses, maxUses int
+	err = tx.QueryRow("UPDATE Links SET Uses = Uses + 1 WHERE ID = $1 AND MaxUses > 0 AND Uses < MaxUses RETURNING Uses, MaxUses", id).Scan(&uses, &maxUses)
+	if errors.Is(err, sql.ErrNoRows) {
+		var limited bool
+		err := tx.QueryRow("SELECT MaxUses > 0 FROM Links WHERE ID = $1", id).Scan(&limited)
+		switch {
+		case errors.Is(err, sql.ErrNoRows), err == nil && limited:
+			// the link may have been deleted by a concurrent last use
+			return 0, errLinkUsedUp
+		case err != nil:
+			return 0, err
+		}
+		return 0, fmt.Errorf("link %q does not have limited uses", short)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if uses >= maxUses {
+		// used up by a visitor rather than deleted by an editor
+		if err := s.deleteTx(tx, id, ""); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.forget(id)
+	return maxUses - uses, nil
+}
+
+// LoadHistory returns the recorded revisions of a link, oldest first.
+// History is kept for deleted links, ending with a revision marked Deleted.
+//
+// It returns fs.ErrNotExist if no history exists for short.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadHistory(short string) ([]*LinkRevision, error) {
+	rows, err := s.db.Query("SELECT Revision, Short, Long, Owner, Tags, Edited, Editor, Deleted FROM LinkHistory WHERE ID = $1 ORDER BY Revision", linkID(short))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revs []*LinkRevision
+	for rows.Next() {
+		r := new(LinkRevision)
+		var tags string
+		var edited int64
+		if err := rows.Scan(&r.Revision, &r.Short, &r.Long, &r.Owner, &tags, &edited, &r.Editor, &r.Deleted); err != nil {
+			return nil, err
+		}
+		if tags != "" {
+			r.Tags = strings.Split(tags, "\n")
+		}
+		r.Edited = time.Unix(edited, 0).UTC()
+		revs = append(revs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		return nil, fs.ErrNotExist
+	}
+	return revs, nil
+}
+
+// LoadDeletion returns the revision recording the deletion of short, if
+// short's latest revision deleted it.
+//
+// It returns fs.ErrNotExist if short has no history, or exists.
+func (s *PostgresDB) LoadDeletion(short string) (*LinkRevision, error) {
+	r := new(LinkRevision)
+	var tags string
+	var edited int64
+	err := s.db.QueryRow("SELECT Revision, Short, Long, Owner, Tags, Edited, Editor, Deleted FROM LinkHistory WHERE ID = $1 ORDER BY Revision DESC LIMIT 1", linkID(short)).
+		Scan(&r.Revision, &r.Short, &r.Long, &r.Owner, &tags, &edited, &r.Editor, &r.Deleted)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !r.Deleted) {
+		return nil, fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tags != "" {
+		r.Tags = strings.Split(tags, "\n")
+	}
+	r.Edited = time.Unix(edited, 0).UTC()
+	return r, nil
+}
+
+// LoadAlias returns the normalized ID of the link that short was merged into.
+//
+// It returns fs.ErrNotExist if short is not an alias.
+func (s *PostgresDB) LoadAlias(short string) (string, error) {
+	var target string
+	err := s.db.QueryRow("SELECT Target FROM Aliases WHERE ID = $1", linkID(short)).Scan(&target)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fs.ErrNotExist
+	}
+	return target, err
+}
+
+// Merge merges the link from into the link into. The click stats, tags, and
+// history of from are moved to into, the earliest creation time of the two
+// is kept, and from is deleted and recorded as an alias of into. Existing
+// aliases of from are repointed to into. The revisions of from are
+// renumbered to come before those of into, whose latest revision remains
+// its current one.
+func (s *PostgresDB) Merge(from, into string) error {
+	fromID, intoID := linkID(from), linkID(into)
+	if fromID == intoID {
+		return errors.New("cannot merge a link into itself")
+	}
+
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fromShort string
+	var fromCreated, fromClicks, fromExternal int64
+	err = tx.QueryRow("DELETE FROM Links WHERE ID = $1 RETURNING Short, Created, TotalClicks, ExternalClicks", fromID).Scan(&fromShort, &fromCreated, &fromClicks, &fromExternal)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fs.ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec("UPDATE Links SET Created = LEAST(Created, $2), TotalClicks = TotalClicks + $3, ExternalClicks = ExternalClicks + $4, Version = Version + 1 WHERE ID = $1", intoID, fromCreated, fromClicks, fromExternal)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows != 1 {
+		return fs.ErrNotExist
+	}
+
+	stmts := []struct {
+		query string
+		args  []any
+	}{
+		{"UPDATE Stats SET ID = $2 WHERE ID = $1", []any{fromID, intoID}},
+		{"INSERT INTO LinkTags (ID, Tag) SELECT $2, Tag FROM LinkTags WHERE ID = $1 ON CONFLICT DO NOTHING", []any{fromID, intoID}},
+		{"DELETE FROM LinkTags WHERE ID = $1", []any{fromID}},
+		{"DELETE FROM LinkOwners WHERE ID = $1", []any{fromID}},
+		{"DELETE FROM GCNotices WHERE ID = $1", []any{fromID}},
+		{"UPDATE Aliases SET Target = $2 WHERE Target = $1", []any{fromID, intoID}},
+		{"INSERT INTO Aliases (ID, Short, Target) VALUES ($1, $2, $3) ON CONFLICT (ID) DO UPDATE SET Short = EXCLUDED.Short, Target = EXCLUDED.Target", []any{fromID, fromShort, intoID}},
+	}
+	for _, st := range stmts {
+		if _, err := tx.Exec(st.query, st.args...); err != nil {
+			return err
+		}
+	}
+
+	// Revisions are numbered from 1 for each ID, so into's are moved out of
+	// the way, negated, while from's are re-keyed, then renumbered to follow
+	// them.
+	if _, err := tx.Exec("UPDATE LinkHistory SET Revision = -Revision WHERE ID = $1", intoID); err != nil {
+		return err
+	}
+	result, err = tx.Exec("UPDATE LinkHistory SET ID = $2 WHERE ID = $1", fromID, intoID)
+	if err != nil {
+		return err
+	}
+	moved, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if _, err := tx.Exec("UPDATE LinkHistory SET Revision = $2 - Revision WHERE ID = $1 AND Revision < 0", intoID, moved); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.forget(fromID, intoID)
 	return nil
 }
+
+// LoadStats returns click stats for links.
+func (s *PostgresDB) LoadStats() (ClickStats, error) {
+	log.Println("DEBUG: PostgresDB.LoadStats() called")
+	rows, err := s.db.Query("SELECT ID, SUM(Clicks) FROM Stats GROUP BY ID")
+	if err != nil {
+		log.Printf("DEBUG: PostgresDB.LoadStats() db.Query error: %v", err)
+		return nil, fmt.Errorf("querying stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(ClickStats)
+	log.Println("DEBUG: PostgresDB.LoadStats() entering row scan loop")
+	for rows.Next() {
+		var id string
+		var clicks int
+		if err := rows.Scan(&id, &clicks); err != nil {
+			log.Printf("DEBUG: PostgresDB.LoadStats() rows.Scan error: %v", err)
+			return nil, fmt.Errorf("scanning stat row: %w", err)
+		}
+		stats[id] = clicks
+	}
+	log.Println("DEBUG: PostgresDB.LoadStats() exited row scan loop")
+	if err := rows.Err(); err != nil {
+		log.Printf("DEBUG: PostgresDB.LoadStats() rows.Err error: %v", err)
+		return nil, fmt.Errorf("stat rows.Err: %w", err)
+	}
+	log.Println("DEBUG: PostgresDB.LoadStats() successful")
+	return stats, nil
+}
+
+// LoadStatsFor returns click stats for the links with the specified short
+// names, keyed by link ID. Unlike LoadStats, only the Stats rows for those
+// links are read.
+func (s *PostgresDB) LoadStatsFor(shorts []string) (ClickStats, error) {
+	ids := make([]string, len(shorts))
+	for i, short := range shorts {
+		ids[i] = linkID(short)
+	}
+	rows, err := s.db.Query("SELECT ID, SUM(Clicks) FROM Stats WHERE ID = ANY($1) GROUP BY ID", ids)
+	if err != nil {
+		return nil, fmt.Errorf("querying stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(ClickStats)
+	for rows.Next() {
+		var id string
+		var clicks int
+		if err := rows.Scan(&id, &clicks); err != nil {
+			return nil, fmt.Errorf("scanning stat row: %w", err)
+		}
+		stats[id] = clicks
+	}
+	return stats, rows.Err()
+}
+
+// SaveStats records click stats for links. The provided map includes
+// incremental clicks that have occurred since the last time SaveStats
+// was called.
+func (s *PostgresDB) SaveStats(stats ClickStats) error {
+	return s.SaveClickSources(stats, nil)
+}
+
+// SaveClickSources records click stats for links like SaveStats, breaking
+// down each link's clicks by the sources in sources. Clicks in stats beyond
+// those in sources are recorded with no path or referrer, so that the total
+// clicks of each link are those in stats.
+func (s *PostgresDB) SaveClickSources(stats ClickStats, sources ClickSources) error {
+	defer dbQuerySeconds.observe("SaveStats", time.Now())
+	return s.saveClickSources(s.db, stats, sources)
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (s *PostgresDB) saveClickSources(ex execer, stats ClickStats, sources ClickSources) error {
+	if len(stats) == 0 {
+		return nil
+	}
+
+	// short names that differ only in case or dashes are the same link
+	byID := make(map[string]map[ClickSource]int, len(stats))
+	for short, clicks := range stats {
+		id := linkID(short)
+		if byID[id] == nil {
+			byID[id] = make(map[ClickSource]int)
+		}
+		byID[id][ClickSource{}] += clicks
+	}
+	for short, srcs := range sources {
+		counts := byID[linkID(short)]
+		for src, n := range srcs {
+			// never record more clicks from sources than in total
+			if counts == nil || src == (ClickSource{}) || counts[ClickSource{}] < n {
+				continue
+			}
+			counts[ClickSource{}] -= n
+			counts[src] += n
+		}
+	}
+	var (
+		ids, paths, referrers []string
+		clicks                []int
+	)
+	for _, id := range slices.Sorted(maps.Keys(byID)) {
+		counts := byID[id]
+		for _, src := range slices.SortedFunc(maps.Keys(counts), compareClickSources) {
+			if n := counts[src]; n > 0 {
+				ids = append(ids, id)
+				paths = append(paths, src.Path)
+				referrers = append(referrers, src.Referrer)
+				clicks = append(clicks, n)
+			}
+		}
+	}
+
+	// Record the stats and update link totals in a single statement, passing
+	// arrays rather than parameters for each link so that a flush of any
+	// size is one round trip.
+	query := `
+WITH saved AS (
+	INSERT INTO Stats (ID, Created, Clicks, Path, Referrer)
+	SELECT ID, $1, Clicks, Path, Referrer FROM unnest($2::text[], $3::integer[], $4::text[], $5::text[]) AS t(ID, Clicks, Path, Referrer)
+	RETURNING ID, Clicks
+), totals AS (
+	SELECT ID, SUM(Clicks) AS Clicks FROM saved GROUP BY ID
+)
+UPDATE Links SET TotalClicks = TotalClicks + totals.Clicks
+FROM totals WHERE Links.ID = totals.ID`
+	_, err := ex.Exec(query, s.Now().Unix(), ids, clicks, paths, referrers)
+	return err
+}
+
+// clickBatchRetention is how long the keys of saved click batches are kept
+// for ClickBatchSaved.
+const clickBatchRetention = 7 * 24 * time.Hour
+
+// SaveClickBatch saves a flush of click stats, as SaveClickSources and
+// SaveExternalClicks would, in one transaction recorded under key, so that
+// if the save fails ambiguously, such as by losing the connection while
+// committing, ClickBatchSaved reports whether it was saved. A batch whose
+// key was already saved is not saved again.
+func (s *PostgresDB) SaveClickBatch(key string, stats ClickStats, sources ClickSources, external ClickStats) error {
+	defer dbQuerySeconds.observe("SaveClickBatch", time.Now())
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := s.Now()
+	res, err := tx.Exec("INSERT INTO ClickBatches (ID, Created) VALUES ($1, $2) ON CONFLICT DO NOTHING", key, now.Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM ClickBatches WHERE Created < $1", now.Add(-clickBatchRetention).Unix()); err != nil {
+		return err
+	}
+	if err := s.saveClickSources(tx, stats, sources); err != nil {
+		return err
+	}
+	if err := saveExternalClicks(tx, external); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClickBatchSaved reports whether the batch of clicks with the given key
+// was saved by SaveClickBatch.
+func (s *PostgresDB) ClickBatchSaved(key string) (bool, error) {
+	var saved bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM ClickBatches WHERE ID = $1)", key).Scan(&saved)
+	return saved, err
+}
+
+// compareClickSources orders click sources by path, then referrer.
+func compareClickSources(a, b ClickSource) int {
+	return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Referrer, b.Referrer))
+}
+
+// LoadClickBreakdown returns the clicks of the link short since the given
+// time, grouped by by, which is "path" or "referrer", most clicked first.
+// Clicks with no path or referrer are grouped under "". At most limit
+// values are returned.
+func (s *PostgresDB) LoadClickBreakdown(short, by string, since time.Time, limit int) ([]ClickCount, error) {
+	var column string
+	switch by {
+	case "path":
+		column = "Path"
+	case "referrer":
+		column = "Referrer"
+	default:
+		return nil, fmt.Errorf("unknown click breakdown %q", by)
+	}
+	rows, err := s.db.Query(`SELECT `+column+`, SUM(Clicks) AS N FROM Stats
+WHERE ID = $1 AND Created >= $2 GROUP BY `+column+` ORDER BY N DESC, `+column+` LIMIT $3`,
+		linkID(short), since.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying click breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []ClickCount{}
+	for rows.Next() {
+		var c ClickCount
+		if err := rows.Scan(&c.Value, &c.Clicks); err != nil {
+			return nil, fmt.Errorf("scanning click breakdown: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// SaveExternalClicks adds external, the clicks of each link from visitors to
+// --public-hostname, to the links' ExternalClicks. The clicks must also have
+// been saved with SaveStats, which counts all clicks.
+func (s *PostgresDB) SaveExternalClicks(external ClickStats) error {
+	defer dbQuerySeconds.observe("SaveExternalClicks", time.Now())
+	return saveExternalClicks(s.db, external)
+}
+
+func saveExternalClicks(ex execer, external ClickStats) error {
+	if len(external) == 0 {
+		return nil
+	}
+	byID := make(map[string]int, len(external))
+	for short, clicks := range external {
+		byID[linkID(short)] += clicks
+	}
+	ids := slices.Sorted(maps.Keys(byID))
+	clicks := make([]int, len(ids))
+	for i, id := range ids {
+		clicks[i] = byID[id]
+	}
+	query := `
+UPDATE Links SET ExternalClicks = ExternalClicks + t.Clicks
+FROM unnest($1::text[], $2::integer[]) AS t(ID, Clicks) WHERE Links.ID = t.ID`
+	_, err := ex.Exec(query, ids, clicks)
+	return err
+}
+
+// CompactStats rolls up the click stats of each link from before olderThan
+// ago into one row per day, so that the Stats table grows with the number
+// of days rather than the number of flushes. Days begin at midnight in loc,
+// and only whole days are rolled up. Total clicks, and the clicks from each
+// path and referrer, are unchanged.
+//
+// It returns the number of rows removed.
+func (s *PostgresDB) CompactStats(olderThan time.Duration, loc *time.Location) (int, error) {
+	defer dbQuerySeconds.observe("CompactStats", time.Now())
+	cutoff := startOfDay(s.Now().Add(-olderThan), loc)
+
+	// rolled up rows are at midnight, and are left as they are
+	const day = `EXTRACT(EPOCH FROM date_trunc('day', to_timestamp(Created) AT TIME ZONE $2) AT TIME ZONE $2)::integer`
+	query := `
+WITH old AS (
+	DELETE FROM Stats WHERE Created < $1 AND Created <> ` + day + `
+	RETURNING ID, ` + day + ` AS Day, Clicks, Path, Referrer
+), daily AS (
+	INSERT INTO Stats (ID, Created, Clicks, Path, Referrer)
+	SELECT ID, Day, SUM(Clicks), Path, Referrer FROM old GROUP BY ID, Day, Path, Referrer
+	RETURNING 1
+)
+SELECT (SELECT COUNT(*) FROM old) - (SELECT COUNT(*) FROM daily)`
+	var removed int
+	err := s.db.QueryRow(query, cutoff.Unix(), loc.String()).Scan(&removed)
+	return removed, err
+}
+
+// startOfDay returns midnight in loc at the start of the day containing t.
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// LoadDailyClicks returns the clicks of the link short on each day since the
+// given time, oldest first, as ClickCounts whose values are dates such as
+// "2024-03-15". Days begin at midnight in loc, and days without clicks are
+// omitted. Stats rolled up by CompactStats are counted on the day they were
+// rolled up into.
+func (s *PostgresDB) LoadDailyClicks(short string, since time.Time, loc *time.Location) ([]ClickCount, error) {
+	rows, err := s.db.Query(`SELECT to_char(to_timestamp(Created) AT TIME ZONE $3, 'YYYY-MM-DD') AS Day, SUM(Clicks) FROM Stats
+WHERE ID = $1 AND Created >= $2 GROUP BY Day ORDER BY Day`,
+		linkID(short), since.Unix(), loc.String())
+	if err != nil {
+		return nil, fmt.Errorf("querying daily clicks: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []ClickCount{}
+	for rows.Next() {
+		var c ClickCount
+		if err := rows.Scan(&c.Value, &c.Clicks); err != nil {
+			return nil, fmt.Errorf("scanning daily clicks: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// CountOwnedLinks returns the number of links owned by owner.
+func (s *PostgresDB) CountOwnedLinks(owner string) (int, error) {
+	return linkCounter{s.db}.CountOwnedLinks(owner)
+}
+
+// CountNamespaceLinks returns the number of links in namespace ns.
+// The empty namespace counts links whose short name has no namespace prefix.
+func (s *PostgresDB) CountNamespaceLinks(ns string) (int, error) {
+	return linkCounter{s.db}.CountNamespaceLinks(ns)
+}
+
+// CountCreatedSince returns the number of links created by creator, a
+// stored owner value, that were added to the database at or after t,
+// whoever owns them now.
+func (s *PostgresDB) CountCreatedSince(creator string, t time.Time) (int, error) {
+	return linkCounter{s.db}.CountCreatedSince(creator, t)
+}
+
+// linkCounter implements quotaCounter for PostgresDB, counting links as
+// seen by q, such as in the transaction saving a link.
+type linkCounter struct {
+	q rowQueryer
+}
+
+// rowQueryer is implemented by *sql.DB and *sql.Tx.
+type rowQueryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (c linkCounter) CountOwnedLinks(owner string) (int, error) {
+	var n int
+	err := c.q.QueryRow("SELECT COUNT(*) FROM Links WHERE Owner = $1", owner).Scan(&n)
+	return n, err
+}
+
+func (c linkCounter) CountNamespaceLinks(ns string) (int, error) {
+	var n int
+	var err error
+	if ns == "" {
+		err = c.q.QueryRow("SELECT COUNT(*) FROM Links WHERE position('.' in ID) = 0").Scan(&n)
+	} else {
+		err = c.q.QueryRow("SELECT COUNT(*) FROM Links WHERE position('.' in ID) > 0 AND split_part(ID, '.', 1) = $1", linkID(ns)).Scan(&n)
+	}
+	return n, err
+}
+
+func (c linkCounter) CountCreatedSince(creator string, t time.Time) (int, error) {
+	var n int
+	err := c.q.QueryRow("SELECT COUNT(*) FROM Links WHERE Creator = $1 AND Inserted >= $2", creator, t.Unix()).Scan(&n)
+	return n, err
+}
+
+// DeleteStats deletes click stats for a link.
+func (s *PostgresDB) DeleteStats(short string) error {
+	// Use $1 for placeholder in PostgreSQL
+	_, err := s.db.Exec("DELETE FROM Stats WHERE ID = $1", linkID(short))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec("UPDATE Links SET TotalClicks = 0, ExternalClicks = 0 WHERE ID = $1", linkID(short))
+	if err != nil {
+		return err
+	}
+	s.forget(linkID(short))
+	return nil
+}
+
+var reStatsPartition = regexp.MustCompile(`^stats_(\d{6})$`)
+
+// statsPartition returns the name of the Stats partition for the UTC month
+// starting at month, and the range of Created values it holds.
+func statsPartition(month time.Time) (name string, from, to int64) {
+	return "stats_" + month.Format("200601"), month.Unix(), month.AddDate(0, 1, 0).Unix()
+}
+
+// statsPartitionMonth returns the month held by the Stats partition name,
+// or false if name is not a monthly partition.
+func statsPartitionMonth(name string) (time.Time, bool) {
+	m := reStatsPartition.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	month, err := time.Parse("200601", m[1])
+	return month, err == nil
+}
+
+// statsPartitions returns the names of the monthly partitions of Stats.
+func (s *PostgresDB) statsPartitions() ([]string, error) {
+	rows, err := s.db.Query("SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = 'stats'::regclass")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if _, ok := statsPartitionMonth(name); ok {
+			names = append(names, name)
+		}
+	}
+	return names, rows.Err()
+}
+
+// CreateStatsPartitions creates the monthly partitions of Stats from the
+// current month through months ahead that do not exist yet, moving any of
+// their rows out of the default partition. It returns the names of the
+// partitions created.
+func (s *PostgresDB) CreateStatsPartitions(months int) ([]string, error) {
+	defer dbQuerySeconds.observe("CreateStatsPartitions", time.Now())
+	existing, err := s.statsPartitions()
+	if err != nil {
+		return nil, err
+	}
+	now := s.Now().UTC()
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var created []string
+	for i := range months + 1 {
+		name, from, to := statsPartition(first.AddDate(0, i, 0))
+		if slices.Contains(existing, name) {
+			continue
+		}
+		if err := s.createStatsPartition(name, from, to); err != nil {
+			return created, fmt.Errorf("creating %s: %w", name, err)
+		}
+		created = append(created, name)
+	}
+	return created, nil
+}
+
+// createStatsPartition creates and attaches the Stats partition name for
+// Created values in [from, to).
+func (s *PostgresDB) createStatsPartition(name string, from, to int64) error {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("CREATE TABLE " + name + " (LIKE Stats INCLUDING DEFAULTS)"); err != nil {
+		return err
+	}
+	// attaching a partition fails while the default partition has rows in
+	// its range, so move them first
+	query := `
+WITH moved AS (
+	DELETE FROM Stats_default WHERE Created >= $1 AND Created < $2
+	RETURNING ID, Created, Clicks, Path, Referrer
+)
+INSERT INTO ` + name + ` (ID, Created, Clicks, Path, Referrer) SELECT ID, Created, Clicks, Path, Referrer FROM moved`
+	if _, err := tx.Exec(query, from, to); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE Stats ATTACH PARTITION %s FOR VALUES FROM (%d) TO (%d)", name, from, to)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DropStatsPartitions drops the monthly partitions of Stats that only hold
+// stats from more than olderThan ago, and deletes such stats from the
+// default partition, so that whole months are removed without scanning
+// them. Link TotalClicks, which count all clicks, are unchanged. It returns
+// the names of the partitions dropped.
+func (s *PostgresDB) DropStatsPartitions(olderThan time.Duration) ([]string, error) {
+	defer dbQuerySeconds.observe("DropStatsPartitions", time.Now())
+	cutoff := s.Now().Add(-olderThan).UTC()
+	names, err := s.statsPartitions()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+	var dropped []string
+	for _, name := range names {
+		month, _ := statsPartitionMonth(name)
+		if _, _, to := statsPartition(month); to > cutoff.Unix() {
+			continue
+		}
+		if _, err := s.db.Exec("DROP TABLE " + name); err != nil {
+			return dropped, fmt.Errorf("dropping %s: %w", name, err)
+		}
+		dropped = append(dropped, name)
+	}
+	_, err = s.db.Exec("DELETE FROM Stats_default WHERE Created < $1", cutoff.Unix())
+	return dropped, err
+}
+
+// LoadGCNotices returns the time each link was marked for garbage collection,
+// keyed by link ID.
+func (s *PostgresDB) LoadGCNotices() (map[string]time.Time, error) {
+	rows, err := s.db.Query("SELECT ID, Notified FROM GCNotices")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	notices := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var notified int64
+		if err := rows.Scan(&id, &notified); err != nil {
+			return nil, err
+		}
+		notices[id] = time.Unix(notified, 0).UTC()
+	}
+	return notices, rows.Err()
+}
+
+// SaveGCNotice records that the link with the specified short name was marked
+// for garbage collection at t.
+func (s *PostgresDB) SaveGCNotice(short string, t time.Time) error {
+	_, err := s.db.Exec("INSERT INTO GCNotices (ID, Notified) VALUES ($1, $2) ON CONFLICT (ID) DO UPDATE SET Notified = EXCLUDED.Notified", linkID(short), t.Unix())
+	return err
+}
+
+// DeleteGCNotice removes any garbage collection mark for a link.
+func (s *PostgresDB) DeleteGCNotice(short string) error {
+	_, err := s.db.Exec("DELETE FROM GCNotices WHERE ID = $1", linkID(short))
+	return err
+}
+
+// LoadTeams returns all teams, sorted by name.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadTeams() ([]*Team, error) {
+	rows, err := s.db.Query("SELECT ID, Name, Namespace, Created FROM Teams ORDER BY Name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var teams []*Team
+	byID := make(map[string]*Team)
+	for rows.Next() {
+		team := new(Team)
+		var id string
+		var created int64
+		if err := rows.Scan(&id, &team.Name, &team.Namespace, &created); err != nil {
+			return nil, err
+		}
+		team.Created = time.Unix(created, 0).UTC()
+		teams = append(teams, team)
+		byID[id] = team
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	members, err := s.db.Query("SELECT Team, Login FROM TeamMembers ORDER BY Team, Login")
+	if err != nil {
+		return nil, err
+	}
+	defer members.Close()
+	for members.Next() {
+		var id, login string
+		if err := members.Scan(&id, &login); err != nil {
+			return nil, err
+		}
+		if team, ok := byID[id]; ok {
+			team.Members = append(team.Members, login)
+		}
+	}
+	return teams, members.Err()
+}
+
+// LoadTeam returns a Team by name.
+//
+// It returns fs.ErrNotExist if the team does not exist.
+//
+// The caller owns the returned value.
+func (s *PostgresDB) LoadTeam(name string) (*Team, error) {
+	team := new(Team)
+	var created int64
+	id := linkID(name)
+	err := s.db.QueryRow("SELECT Name, Namespace, Created FROM Teams WHERE ID = $1", id).Scan(&team.Name, &team.Namespace, &created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fs.ErrNotExist
+		}
+		return nil, err
+	}
+	team.Created = time.Unix(created, 0).UTC()
+
+	rows, err := s.db.Query("SELECT Login FROM TeamMembers WHERE Team = $1 ORDER BY Login", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return nil, err
+		}
+		team.Members = append(team.Members, login)
+	}
+	return team, rows.Err()
+}
+
+// SaveTeam saves a Team, replacing its membership.
+func (s *PostgresDB) SaveTeam(team *Team) error {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id := linkID(team.Name)
+	query := `
+INSERT INTO Teams (ID, Name, Namespace, Created)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (ID) DO UPDATE SET
+	Name = EXCLUDED.Name,
+	Namespace = EXCLUDED.Namespace`
+	if _, err := tx.Exec(query, id, team.Name, team.Namespace, team.Created.Unix()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM TeamMembers WHERE Team = $1", id); err != nil {
+		return err
+	}
+	for _, login := range team.Members {
+		if _, err := tx.Exec("INSERT INTO TeamMembers (Team, Login) VALUES ($1, $2) ON CONFLICT DO NOTHING", id, login); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTeam removes a Team and its membership.
+func (s *PostgresDB) DeleteTeam(name string) error {
+	id := linkID(name)
+	result, err := s.db.Exec("DELETE FROM Teams WHERE ID = $1", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return fmt.Errorf("expected to affect 1 row, affected %d", rows)
+	}
+	_, err = s.db.Exec("DELETE FROM TeamMembers WHERE Team = $1", id)
+	return err
+}
+
+// LoadCollections returns all collections, in display order.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadCollections() ([]*Collection, error) {
+	rows, err := s.db.Query("SELECT ID, Name, Title, Description, Position FROM Collections ORDER BY Position, Name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var collections []*Collection
+	byID := make(map[string]*Collection)
+	for rows.Next() {
+		c := new(Collection)
+		var id string
+		if err := rows.Scan(&id, &c.Name, &c.Title, &c.Description, &c.Position); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+		byID[id] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	links, err := s.db.Query("SELECT Collection, Short, Description FROM CollectionLinks ORDER BY Collection, Position")
+	if err != nil {
+		return nil, err
+	}
+	defer links.Close()
+	for links.Next() {
+		var id string
+		var l CollectionLink
+		if err := links.Scan(&id, &l.Short, &l.Description); err != nil {
+			return nil, err
+		}
+		if c, ok := byID[id]; ok {
+			c.Links = append(c.Links, l)
+		}
+	}
+	return collections, links.Err()
+}
+
+// SaveCollection saves a Collection, replacing its links.
+func (s *PostgresDB) SaveCollection(c *Collection) error {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	id := linkID(c.Name)
+	query := `
+INSERT INTO Collections (ID, Name, Title, Description, Position)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (ID) DO UPDATE SET
+	Name = EXCLUDED.Name,
+	Title = EXCLUDED.Title,
+	Description = EXCLUDED.Description,
+	Position = EXCLUDED.Position`
+	if _, err := tx.Exec(query, id, c.Name, c.Title, c.Description, c.Position); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM CollectionLinks WHERE Collection = $1", id); err != nil {
+		return err
+	}
+	for i, l := range c.Links {
+		if _, err := tx.Exec("INSERT INTO CollectionLinks (Collection, Short, Description, Position) VALUES ($1, $2, $3, $4)", id, l.Short, l.Description, i); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteCollection removes a Collection and its links.
+func (s *PostgresDB) DeleteCollection(name string) error {
+	id := linkID(name)
+	result, err := s.db.Exec("DELETE FROM Collections WHERE ID = $1", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != 1 {
+		return fmt.Errorf("expected to affect 1 row, affected %d", rows)
+	}
+	_, err = s.db.Exec("DELETE FROM CollectionLinks WHERE Collection = $1", id)
+	return err
+}
+
+// LoadTargetHealth returns the recorded health of the specified targets,
+// keyed by target. Targets that have never been checked are omitted.
+func (s *PostgresDB) LoadTargetHealth(targets []string) (map[string]TargetHealth, error) {
+	health := make(map[string]TargetHealth)
+	for _, target := range targets {
+		h := TargetHealth{Target: target}
+		var checked int64
+		err := s.db.QueryRow("SELECT Healthy, Checked, Detail FROM TargetHealth WHERE Target = $1", target).Scan(&h.Healthy, &checked, &h.Detail)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		h.Checked = time.Unix(checked, 0).UTC()
+		health[target] = h
+	}
+	return health, nil
+}
+
+// LoadUnhealthyTargets returns the recorded health of the targets that are
+// marked unhealthy, keyed by target.
+func (s *PostgresDB) LoadUnhealthyTargets() (map[string]TargetHealth, error) {
+	rows, err := s.db.Query("SELECT Target, Checked, Detail FROM TargetHealth WHERE NOT Healthy")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	health := make(map[string]TargetHealth)
+	for rows.Next() {
+		var h TargetHealth
+		var checked int64
+		if err := rows.Scan(&h.Target, &checked, &h.Detail); err != nil {
+			return nil, err
+		}
+		h.Checked = time.Unix(checked, 0).UTC()
+		health[h.Target] = h
+	}
+	return health, rows.Err()
+}
+
+// SaveTargetHealth records the health of a link target.
+func (s *PostgresDB) SaveTargetHealth(h TargetHealth) error {
+	query := `
+INSERT INTO TargetHealth (Target, Healthy, Checked, Detail)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (Target) DO UPDATE SET
+	Healthy = EXCLUDED.Healthy,
+	Checked = EXCLUDED.Checked,
+	Detail = EXCLUDED.Detail`
+	_, err := s.db.Exec(query, h.Target, h.Healthy, h.Checked.Unix(), h.Detail)
+	return err
+}
+
+// RecordFallbackServe increments the number of times target was served as a
+// fallback for the link with the specified short name.
+func (s *PostgresDB) RecordFallbackServe(short, target string) error {
+	_, err := s.db.Exec("INSERT INTO FallbackServes (ID, Target, Clicks) VALUES ($1, $2, 1) ON CONFLICT (ID, Target) DO UPDATE SET Clicks = FallbackServes.Clicks + 1", linkID(short), target)
+	return err
+}
+
+// LoadFallbackServes returns the number of times each fallback target was
+// served for the link with the specified short name, keyed by target.
+func (s *PostgresDB) LoadFallbackServes(short string) (map[string]int, error) {
+	rows, err := s.db.Query("SELECT Target, Clicks FROM FallbackServes WHERE ID = $1", linkID(short))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	serves := make(map[string]int)
+	for rows.Next() {
+		var target string
+		var clicks int
+		if err := rows.Scan(&target, &clicks); err != nil {
+			return nil, err
+		}
+		serves[target] = clicks
+	}
+	return serves, rows.Err()
+}
+
+// LoadMaintenanceWindows returns maintenance windows that end after t,
+// ordered by start time.
+func (s *PostgresDB) LoadMaintenanceWindows(t time.Time) ([]*MaintenanceWindow, error) {
+	rows, err := s.db.Query(`SELECT ID, Short, Tag, Start, "End", Target, Reason, CreatedBy FROM MaintenanceWindows WHERE "End" > $1 ORDER BY Start, ID`, t.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var windows []*MaintenanceWindow
+	for rows.Next() {
+		m := new(MaintenanceWindow)
+		var start, end int64
+		if err := rows.Scan(&m.ID, &m.Short, &m.Tag, &start, &end, &m.Target, &m.Reason, &m.CreatedBy); err != nil {
+			return nil, err
+		}
+		m.Start = time.Unix(start, 0).UTC()
+		m.End = time.Unix(end, 0).UTC()
+		windows = append(windows, m)
+	}
+	return windows, rows.Err()
+}
+
+// SaveMaintenanceWindow stores a new maintenance window and sets its ID.
+func (s *PostgresDB) SaveMaintenanceWindow(m *MaintenanceWindow) error {
+	var id string
+	if m.Short != "" {
+		id = linkID(m.Short)
+	}
+	query := `
+INSERT INTO MaintenanceWindows (LinkID, Short, Tag, Start, "End", Target, Reason, CreatedBy)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING ID`
+	return s.db.QueryRow(query, id, m.Short, m.Tag, m.Start.Unix(), m.End.Unix(), m.Target, m.Reason, m.CreatedBy).Scan(&m.ID)
+}
+
+// DeleteMaintenanceWindow removes a maintenance window.
+//
+// It returns fs.ErrNotExist if the window does not exist.
+func (s *PostgresDB) DeleteMaintenanceWindow(id int64) error {
+	result, err := s.db.Exec("DELETE FROM MaintenanceWindows WHERE ID = $1", id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// LoadSmartLists returns the smart lists saved by owner, sorted by name.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadSmartLists(owner string) ([]*SmartList, error) {
+	rows, err := s.db.Query("SELECT Name, Query, Created FROM SmartLists WHERE Owner = $1 ORDER BY ID", owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var lists []*SmartList
+	for rows.Next() {
+		l := &SmartList{Owner: owner}
+		var created int64
+		if err := rows.Scan(&l.Name, &l.Query, &created); err != nil {
+			return nil, err
+		}
+		l.Created = time.Unix(created, 0).UTC()
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// LoadSmartList returns a smart list saved by owner.
+//
+// It returns fs.ErrNotExist if the list does not exist.
+//
+// The caller owns the returned value.
+func (s *PostgresDB) LoadSmartList(owner, name string) (*SmartList, error) {
+	l := &SmartList{Owner: owner}
+	var created int64
+	err := s.db.QueryRow("SELECT Name, Query, Created FROM SmartLists WHERE Owner = $1 AND ID = $2", owner, linkID(name)).Scan(&l.Name, &l.Query, &created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fs.ErrNotExist
+		}
+		return nil, err
+	}
+	l.Created = time.Unix(created, 0).UTC()
+	return l, nil
+}
+
+// SaveSmartList saves a smart list, replacing any list of the same name
+// saved by the same owner.
+func (s *PostgresDB) SaveSmartList(l *SmartList) error {
+	query := `
+INSERT INTO SmartLists (Owner, ID, Name, Query, Created)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (Owner, ID) DO UPDATE SET
+	Name = EXCLUDED.Name,
+	Query = EXCLUDED.Query`
+	_, err := s.db.Exec(query, l.Owner, linkID(l.Name), l.Name, l.Query, l.Created.Unix())
+	return err
+}
+
+// DeleteSmartList removes a smart list saved by owner.
+//
+// It returns fs.ErrNotExist if the list does not exist.
+func (s *PostgresDB) DeleteSmartList(owner, name string) error {
+	result, err := s.db.Exec("DELETE FROM SmartLists WHERE Owner = $1 AND ID = $2", owner, linkID(name))
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+const tokenColumns = "ID, Name, Login, Scopes, Created, CreatedBy, Revoked"
+
+// scanToken scans a row of tokenColumns into a new APIToken.
+func scanToken(row interface{ Scan(...any) error }) (*APIToken, error) {
+	t := new(APIToken)
+	var scopes string
+	var created, revoked int64
+	if err := row.Scan(&t.ID, &t.Name, &t.Login, &scopes, &created, &t.CreatedBy, &revoked); err != nil {
+		return nil, err
+	}
+	t.Scopes = strings.Fields(scopes)
+	t.Created = time.Unix(created, 0).UTC()
+	if revoked != 0 {
+		t.Revoked = time.Unix(revoked, 0).UTC()
+	}
+	return t, nil
+}
+
+// LoadTokens returns all API tokens, including revoked ones, oldest first.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadTokens() ([]*APIToken, error) {
+	rows, err := s.db.Query("SELECT " + tokenColumns + " FROM Tokens ORDER BY Created, ID")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tokens []*APIToken
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// LoadTokenByHash returns the API token with the given hash.
+//
+// It returns fs.ErrNotExist if no token has the hash.
+//
+// The caller owns the returned value.
+func (s *PostgresDB) LoadTokenByHash(hash string) (*APIToken, error) {
+	t, err := scanToken(s.db.QueryRow("SELECT "+tokenColumns+" FROM Tokens WHERE Hash = $1", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fs.ErrNotExist
+	}
+	return t, err
+}
+
+// CreateToken stores a new API token with the hash of its secret value.
+func (s *PostgresDB) CreateToken(t *APIToken, hash string) error {
+	_, err := s.db.Exec("INSERT INTO Tokens (ID, Hash, Name, Login, Scopes, Created, CreatedBy) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		t.ID, hash, t.Name, t.Login, strings.Join(t.Scopes, " "), t.Created.Unix(), t.CreatedBy)
+	return err
+}
+
+// RevokeToken marks an API token revoked at the given time, so that it can
+// no longer be used. Revoked tokens are kept for auditing.
+//
+// It returns fs.ErrNotExist if the token does not exist or is already revoked.
+func (s *PostgresDB) RevokeToken(id string, at time.Time) error {
+	result, err := s.db.Exec("UPDATE Tokens SET Revoked = $2 WHERE ID = $1 AND Revoked = 0", id, at.Unix())
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// SaveOwnerIdentity stores the encrypted identity behind a pseudonymized owner.
+func (s *PostgresDB) SaveOwnerIdentity(owner, sealed string) error {
+	_, err := s.db.Exec("INSERT INTO OwnerIdentities (Owner, Identity) VALUES ($1, $2) ON CONFLICT (Owner) DO UPDATE SET Identity = EXCLUDED.Identity", owner, sealed)
+	return err
+}
+
+// LoadOwnerIdentity returns the encrypted identity behind a pseudonymized owner.
+//
+// It returns fs.ErrNotExist if no identity is stored for owner.
+func (s *PostgresDB) LoadOwnerIdentity(owner string) (string, error) {
+	var sealed string
+	err := s.db.QueryRow("SELECT Identity FROM OwnerIdentities WHERE Owner = $1", owner).Scan(&sealed)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = fs.ErrNotExist
+	}
+	return sealed, err
+}
+
+// RenameOwner changes the Owner of all links owned by from to to, returning
+// the number of links changed. The Creator of links created by from is
+// changed too.
+func (s *PostgresDB) RenameOwner(from, to string) (int64, error) {
+	result, err := s.db.Exec("UPDATE Links SET Owner = $2, Version = Version + 1 WHERE Owner = $1", from, to)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.db.Exec("UPDATE Links SET Creator = $2 WHERE Creator = $1", from, to); err != nil {
+		return 0, err
+	}
+	s.forgetAll()
+	return result.RowsAffected()
+}
+
+// LoadSynonyms returns the synonyms of each term in the synonym dictionary,
+// sorted, keyed by term.
+func (s *PostgresDB) LoadSynonyms() (map[string][]string, error) {
+	rows, err := s.db.Query("SELECT Term, Synonym FROM Synonyms ORDER BY Term, Synonym")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	synonyms := make(map[string][]string)
+	for rows.Next() {
+		var term, synonym string
+		if err := rows.Scan(&term, &synonym); err != nil {
+			return nil, err
+		}
+		synonyms[term] = append(synonyms[term], synonym)
+	}
+	return synonyms, rows.Err()
+}
+
+// SaveSynonyms sets the synonyms of term, replacing any it had.
+func (s *PostgresDB) SaveSynonyms(term string, synonyms []string) error {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM Synonyms WHERE Term = $1", term); err != nil {
+		return err
+	}
+	for _, synonym := range synonyms {
+		if _, err := tx.Exec("INSERT INTO Synonyms (Term, Synonym) VALUES ($1, $2)", term, synonym); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteSynonyms removes term from the synonym dictionary.
+//
+// It returns fs.ErrNotExist if term has no synonyms.
+func (s *PostgresDB) DeleteSynonyms(term string) error {
+	result, err := s.db.Exec("DELETE FROM Synonyms WHERE Term = $1", term)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// LoadReservedNames returns all reserved short names, sorted by name.
+//
+// The caller owns the returned values.
+func (s *PostgresDB) LoadReservedNames() ([]*ReservedName, error) {
+	rows, err := s.db.Query("SELECT Name, Reason, Created, CreatedBy FROM ReservedNames ORDER BY ID")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []*ReservedName
+	for rows.Next() {
+		n := new(ReservedName)
+		var created int64
+		if err := rows.Scan(&n.Name, &n.Reason, &created, &n.CreatedBy); err != nil {
+			return nil, err
+		}
+		n.Created = time.Unix(created, 0).UTC()
+		names = append(names, n)
+	}
+	return names, rows.Err()
+}
+
+// SaveReservedName reserves a short name, replacing the reason for it if it
+// is already reserved.
+func (s *PostgresDB) SaveReservedName(n *ReservedName) error {
+	_, err := s.db.Exec(`INSERT INTO ReservedNames (ID, Name, Reason, Created, CreatedBy) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (ID) DO UPDATE SET Name = EXCLUDED.Name, Reason = EXCLUDED.Reason`,
+		linkID(n.Name), n.Name, n.Reason, n.Created.Unix(), n.CreatedBy)
+	return err
+}
+
+// DeleteReservedName releases a reserved short name.
+//
+// It returns fs.ErrNotExist if name is not reserved.
+func (s *PostgresDB) DeleteReservedName(name string) error {
+	result, err := s.db.Exec("DELETE FROM ReservedNames WHERE ID = $1", linkID(name))
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// LoadHomeSections returns the home page sections set with
+// SaveHomeSections, in order, or none if they have not been set.
+func (s *PostgresDB) LoadHomeSections() ([]HomeSection, error) {
+	rows, err := s.db.Query("SELECT Kind, Title, Tag, Links, MaxLinks, Hidden FROM HomeSections ORDER BY Position")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sections []HomeSection
+	for rows.Next() {
+		var hs HomeSection
+		var links string
+		if err := rows.Scan(&hs.Kind, &hs.Title, &hs.Tag, &links, &hs.Limit, &hs.Hidden); err != nil {
+			return nil, err
+		}
+		hs.Links = strings.Fields(links)
+		sections = append(sections, hs)
+	}
+	return sections, rows.Err()
+}
+
+// SaveHomeSections replaces the home page sections with sections, in order.
+// Saving no sections restores the sections set by --home-sections.
+func (s *PostgresDB) SaveHomeSections(sections []HomeSection) error {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM HomeSections"); err != nil {
+		return err
+	}
+	for i, hs := range sections {
+		if _, err := tx.Exec("INSERT INTO HomeSections (Position, Kind, Title, Tag, Links, MaxLinks, Hidden) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			i, hs.Kind, hs.Title, hs.Tag, strings.Join(hs.Links, " "), hs.Limit, hs.Hidden); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadTrending returns the links with the most clicks since the given time,
+// most clicked first, as ClickCounts whose values are short names. At most
+// limit links are returned.
+func (s *PostgresDB) LoadTrending(since time.Time, limit int) ([]ClickCount, error) {
+	defer dbQuerySeconds.observe("LoadTrending", time.Now())
+	rows, err := s.db.Query(`SELECT Links.Short, SUM(Stats.Clicks) AS N FROM Stats JOIN Links ON Links.ID = Stats.ID
+WHERE Stats.Created >= $1 GROUP BY Links.Short ORDER BY N DESC, Links.Short LIMIT $2`,
+		since.Unix(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying trending links: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []ClickCount{}
+	for rows.Next() {
+		var c ClickCount
+		if err := rows.Scan(&c.Value, &c.Clicks); err != nil {
+			return nil, fmt.Errorf("scanning trending links: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// CountStaleIDs returns the number of links whose IDs were normalized with
+// an ID strategy other than version.
+func (s *PostgresDB) CountStaleIDs(version int) (int, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Links WHERE IDVersion <> $1", version).Scan(&n)
+	return n, err
+}
+
+// idSource is a table whose IDs are normalized from a name, and the columns
+// that hold those IDs, including its own.
+type idSource struct {
+	table string
+	query string // selects the ID of each row and the name it is normalized from
+	refs  []string
+}
+
+// idSources are the tables renormalized by RenormalizeIDs.
+var idSources = []idSource{
+	{"Links", "SELECT ID, Short FROM Links", []string{
+		"Links.ID", "Stats.ID", "LinkTags.ID", "LinkOwners.ID", "GCNotices.ID",
+		"FallbackServes.ID", "LinkHistory.ID", "MaintenanceWindows.LinkID", "Aliases.Target",
+	}},
+	// the history of deleted links, named as in their last revision
+	{"LinkHistory", "SELECT DISTINCT ON (ID) ID, Short FROM LinkHistory WHERE ID NOT IN (SELECT ID FROM Links) ORDER BY ID, Revision DESC", []string{"LinkHistory.ID"}},
+	{"Aliases", "SELECT ID, Short FROM Aliases", []string{"Aliases.ID"}},
+	{"ReservedNames", "SELECT ID, Name FROM ReservedNames", []string{"ReservedNames.ID"}},
+	{"Teams", "SELECT ID, Name FROM Teams", []string{"Teams.ID", "TeamMembers.Team"}},
+	{"Collections", "SELECT ID, Name FROM Collections", []string{"Collections.ID", "CollectionLinks.Collection"}},
+	// smart lists of different owners may share an ID
+	{"SmartLists", "SELECT DISTINCT ON (ID) ID, Name FROM SmartLists ORDER BY ID, Name", []string{"SmartLists.ID"}},
+}
+
+// IDCollision is a group of rows in a table whose names would map to the
+// same ID.
+type IDCollision struct {
+	Table string
+	Collision
+}
+
+// IDRenormalization is the result of RenormalizeIDs.
+type IDRenormalization struct {
+	Changed    map[string]int // number of changed IDs, keyed by table
+	Collisions []IDCollision
+}
+
+// Total returns the number of changed IDs in all tables.
+func (r *IDRenormalization) Total() int {
+	var n int
+	for _, c := range r.Changed {
+		n += c
+	}
+	return n
+}
+
+// RenormalizeIDs recomputes every ID normalized from a link, alias, reserved
+// name, team, collection, or smart list name with linkID, updating the
+// columns that refer to them, and records version as the ID strategy of
+// every link. It is done in one transaction, and only if no two names in a
+// table would then have the same ID; otherwise the collisions are returned
+// and nothing is changed. If checkOnly is set, nothing is changed either.
+func (s *PostgresDB) RenormalizeIDs(version int, checkOnly bool) (*IDRenormalization, error) {
+	tx, err := s.db.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &IDRenormalization{Changed: make(map[string]int)}
+	renames := make([]map[string]string, len(idSources))
+	for i, src := range idSources {
+		rows, err := tx.Query(src.query)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", src.table, err)
+		}
+		renames[i] = make(map[string]string)
+		names := make(map[string][]string) // new ID -> names
+		for rows.Next() {
+			var id, name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("reading %s: %w", src.table, err)
+			}
+			newID := linkID(name)
+			names[newID] = append(names[newID], name)
+			if newID != id {
+				renames[i][id] = newID
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", src.table, err)
+		}
+		for _, id := range slices.Sorted(maps.Keys(names)) {
+			if len(names[id]) > 1 {
+				slices.Sort(names[id])
+				res.Collisions = append(res.Collisions, IDCollision{src.table, Collision{ID: id, Shorts: names[id]}})
+			}
+		}
+		if len(renames[i]) > 0 {
+			res.Changed[src.table] = len(renames[i])
+		}
+	}
+	if checkOnly || len(res.Collisions) > 0 {
+		return res, nil
+	}
+
+	// Renamed IDs are first given a leading space, which escaped IDs never
+	// contain, so that a new ID never conflicts with an old one that has
+	// yet to be renamed.
+	var refs []string
+	for i, src := range idSources {
+		if len(renames[i]) == 0 {
+			continue
+		}
+		olds := slices.Collect(maps.Keys(renames[i]))
+		news := make([]string, len(olds))
+		for j, old := range olds {
+			news[j] = renames[i][old]
+		}
+		for _, ref := range src.refs {
+			table, column, _ := strings.Cut(ref, ".")
+			query := fmt.Sprintf("UPDATE %s SET %s = ' ' || t.New FROM unnest($1::text[], $2::text[]) AS t(Old, New) WHERE %s = t.Old", table, column, ref)
+			if _, err := tx.Exec(query, olds, news); err != nil {
+				return nil, fmt.Errorf("renaming %s: %w", ref, err)
+			}
+			if !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	for _, ref := range refs {
+		table, column, _ := strings.Cut(ref, ".")
+		query := fmt.Sprintf("UPDATE %s SET %s = substr(%s, 2) WHERE %s LIKE ' %%'", table, column, column, ref)
+		if _, err := tx.Exec(query); err != nil {
+			return nil, fmt.Errorf("renaming %s: %w", ref, err)
+		}
+	}
+	if _, err := tx.Exec("UPDATE Links SET IDVersion = $1", version); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.forgetAll()
+	return res, nil
+}
@@ -4,22 +4,69 @@
 package golink
 
 import (
-	"path"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"tailscale.com/tstest"
 )
 
-// Test saving, loading, and deleting links for SQLiteDB.
-func Test_SQLiteDB_SaveLoadDeleteLinks(t *testing.T) {
-	db, err := NewSQLiteDB(path.Join(t.TempDir(), "links.db"))
+// newTestDB returns a PostgresDB on the database named by
+// GOLINK_TEST_PGDSN, emptied of all links, stats, and settings, or skips the
+// test if it is not set. Tests using it share the database, so they must
+// not run in parallel.
+//
+//	GOLINK_TEST_PGDSN=postgres://localhost/golink_test go test
+func newTestDB(t testing.TB) *PostgresDB {
+	t.Helper()
+	dsn := os.Getenv("GOLINK_TEST_PGDSN")
+	if dsn == "" {
+		t.Skip("GOLINK_TEST_PGDSN not set")
+	}
+	s, err := NewPostgresDB(dsn)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
+	t.Cleanup(func() { s.db.Close() })
+
+	rows, err := s.db.Query("SELECT quote_ident(tablename) FROM pg_tables WHERE schemaname = current_schema() AND tablename <> 'schema_version'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.db.Exec("TRUNCATE " + strings.Join(tables, ", ")); err != nil {
+		t.Fatal(err)
+	}
+	s.invalidateCaches()
+	return s
+}
+
+// Test saving, loading, and deleting links for PostgresDB.
+func Test_PostgresDB_SaveLoadDeleteLinks(t *testing.T) {
+	db := newTestDB(t)
 
 	links := []*Link{
-		{Short: "short", Long: "long"},
+		{Short: "short", Long: "long", Tags: []string{"oncall"}},
 		{Short: "Foo.Bar", Long: "long"},
 	}
 
@@ -49,8 +96,16 @@ func Test_SQLiteDB_SaveLoadDeleteLinks(t *testing.T) {
 		t.Errorf("db.LoadAll got %v, want %v", got, links)
 	}
 
+	got, err = db.LoadByTag("OnCall")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(got, links[:1]) {
+		t.Errorf("db.LoadByTag got %v, want %v", got, links[:1])
+	}
+
 	for _, link := range links {
-		if err := db.Delete(link.Short); err != nil {
+		if err := db.Delete(link.Short, ""); err != nil {
 			t.Error(err)
 		}
 	}
@@ -65,12 +120,9 @@ func Test_SQLiteDB_SaveLoadDeleteLinks(t *testing.T) {
 	}
 }
 
-// Test saving, loading, and deleting stats for SQLiteDB.
-func Test_SQLiteDB_SaveLoadDeleteStats(t *testing.T) {
-	db, err := NewSQLiteDB(path.Join(t.TempDir(), "links.db"))
-	if err != nil {
-		t.Error(err)
-	}
+// Test saving, loading, and deleting stats for PostgresDB.
+func Test_PostgresDB_SaveLoadDeleteStats(t *testing.T) {
+	db := newTestDB(t)
 
 	// preload some links
 	links := []*Link{
@@ -125,3 +177,320 @@ func Test_SQLiteDB_SaveLoadDeleteStats(t *testing.T) {
 		t.Errorf("db.LoadStats got %v, want %v", got, want)
 	}
 }
+
+func TestClickBreakdown(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Save(&Link{Short: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.SaveClickSources(ClickStats{"docs": 6}, ClickSources{"docs": {
+		{Path: "design"}: 3,
+		{Path: "design", Referrer: "wiki.example.com"}: 1,
+		{Path: "api"}:      1,
+		{Path: "too-many"}: 10, // more than the link's clicks
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.LoadStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ClickStats{"docs": 6}); !cmp.Equal(got, want) {
+		t.Errorf("db.LoadStats got %v, want %v", got, want)
+	}
+	paths, err := db.LoadClickBreakdown("docs", "path", time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ClickCount{{"design", 4}, {"", 1}, {"api", 1}}
+	if diff := cmp.Diff(want, paths); diff != "" {
+		t.Errorf("path breakdown mismatch (-want +got):\n%s", diff)
+	}
+	referrers, err := db.LoadClickBreakdown("docs", "referrer", time.Time{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []ClickCount{{"", 5}}; !cmp.Equal(referrers, want) {
+		t.Errorf("referrer breakdown = %v; want %v", referrers, want)
+	}
+}
+
+func TestMergeHistory(t *testing.T) {
+	db := newTestDB(t)
+	for _, link := range []*Link{
+		{Short: "old", Long: "https://example.com/1"},
+		{Short: "old", Long: "https://example.com/2"},
+		{Short: "new", Long: "https://example.com/3"},
+	} {
+		if err := db.Save(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Merge("old", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := db.LoadHistory("new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range revs {
+		got = append(got, fmt.Sprintf("%d %s %s", r.Revision, r.Short, r.Long))
+	}
+	want := []string{
+		"1 old https://example.com/1",
+		"2 old https://example.com/2",
+		"3 new https://example.com/3",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("history after merge mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := db.LoadHistory("old"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadHistory(old) error = %v; want fs.ErrNotExist", err)
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		t    time.Time
+		loc  *time.Location
+		want time.Time
+	}{
+		{time.Date(2024, 3, 15, 3, 0, 0, 0, time.UTC), time.UTC, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		// 3am UTC is still the previous evening in New York
+		{time.Date(2024, 3, 15, 3, 0, 0, 0, time.UTC), ny, time.Date(2024, 3, 14, 0, 0, 0, 0, ny)},
+		// the day daylight saving time starts is 23 hours long
+		{time.Date(2024, 3, 10, 23, 0, 0, 0, ny), ny, time.Date(2024, 3, 10, 5, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		if got := startOfDay(tt.t, tt.loc); !got.Equal(tt.want) {
+			t.Errorf("startOfDay(%v, %v) = %v; want %v", tt.t, tt.loc, got, tt.want)
+		}
+	}
+}
+
+func TestLinkClone(t *testing.T) {
+	link := &Link{
+		Short:     "a",
+		Tags:      []string{"docs"},
+		Fallbacks: []string{"https://mirror/"},
+		Headers:   map[string]string{"Cache-Control": "no-store"},
+	}
+	c := link.clone()
+	if diff := cmp.Diff(link, c); diff != "" {
+		t.Fatalf("clone mismatch (-want +got):\n%s", diff)
+	}
+	c.Tags[0] = "changed"
+	c.Fallbacks[0] = "changed"
+	c.Headers["Cache-Control"] = "changed"
+	if link.Tags[0] != "docs" || link.Fallbacks[0] != "https://mirror/" || link.Headers["Cache-Control"] != "no-store" {
+		t.Errorf("modifying clone changed original: %+v", link)
+	}
+}
+
+func TestStatsPartition(t *testing.T) {
+	month := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	name, from, to := statsPartition(month)
+	if name != "stats_202412" || from != month.Unix() || to != time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("statsPartition(%v) = %q, %d, %d", month, name, from, to)
+	}
+	if got, ok := statsPartitionMonth(name); !ok || !got.Equal(month) {
+		t.Errorf("statsPartitionMonth(%q) = %v, %v; want %v", name, got, ok, month)
+	}
+	for _, bad := range []string{"stats_default", "stats_2024", "stats_202413", "links_202412"} {
+		if _, ok := statsPartitionMonth(bad); ok {
+			t.Errorf("statsPartitionMonth(%q) succeeded; want not a monthly partition", bad)
+		}
+	}
+}
+
+// TestStatsPartitions creates and drops monthly Stats partitions. It needs
+// a PostgreSQL database named by GOLINK_TEST_PGDSN, whose stats it deletes.
+func TestStatsPartitions(t *testing.T) {
+	dsn := os.Getenv("GOLINK_TEST_PGDSN")
+	if dsn == "" {
+		t.Skip("GOLINK_TEST_PGDSN not set")
+	}
+	s, err := NewPostgresDB(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := tstest.NewClock(tstest.ClockOpts{Start: time.Date(2030, 1, 15, 0, 0, 0, 0, time.UTC)})
+	s.clock = clock
+
+	// stats in the default partition move into their month's partition
+	if _, err := s.db.Exec("INSERT INTO Stats (ID, Created, Clicks, Path, Referrer) VALUES ('partition-test', $1, 3, 'design', 'wiki.example.com')", clock.Now().Unix()); err != nil {
+		t.Fatal(err)
+	}
+	created, err := s.CreateStatsPartitions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(created, "stats_203001") || !slices.Contains(created, "stats_203002") {
+		t.Errorf("created partitions %v; want stats_203001 and stats_203002", created)
+	}
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM stats_203001").Scan(&n); err != nil || n != 1 {
+		t.Errorf("stats_203001 has %d rows (%v); want 1", n, err)
+	}
+	var path, referrer string
+	if err := s.db.QueryRow("SELECT Path, Referrer FROM stats_203001 WHERE ID = 'partition-test'").Scan(&path, &referrer); err != nil {
+		t.Error(err)
+	} else if path != "design" || referrer != "wiki.example.com" {
+		t.Errorf("moved stats have path %q and referrer %q; want %q and %q", path, referrer, "design", "wiki.example.com")
+	}
+
+	clock.Advance(90 * 24 * time.Hour)
+	dropped, err := s.DropStatsPartitions(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(dropped, "stats_203001") || slices.Contains(dropped, "stats_203003") {
+		t.Errorf("dropped partitions %v; want stats_203001 but not stats_203003", dropped)
+	}
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM Stats WHERE ID = 'partition-test'").Scan(&n); err != nil || n != 0 {
+		t.Errorf("%d stats left after dropping their partition (%v); want 0", n, err)
+	}
+}
+
+// BenchmarkPostgresDBParallel measures the throughput of a mix of link loads
+// and saves from many goroutines. The locked case wraps each call in a
+// sync.RWMutex, as PostgresDB once did, for comparison. It needs a
+// PostgreSQL database named by GOLINK_TEST_PGDSN, to which it saves links
+// named bench0 to bench99.
+//
+//	GOLINK_TEST_PGDSN=postgres://localhost/golink_test go test -run=^$ -bench=PostgresDBParallel
+func BenchmarkPostgresDBParallel(b *testing.B) {
+	dsn := os.Getenv("GOLINK_TEST_PGDSN")
+	if dsn == "" {
+		b.Skip("GOLINK_TEST_PGDSN not set")
+	}
+	s, err := NewPostgresDB(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	s.SetPoolSize(0, 64)
+
+	const numLinks = 100
+	for i := range numLinks {
+		if err := s.Save(&Link{Short: fmt.Sprintf("bench%d", i), Long: "http://example.com/"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, locked := range []bool{true, false} {
+		b.Run(fmt.Sprintf("locked=%v", locked), func(b *testing.B) {
+			var mu sync.RWMutex
+			var n atomic.Int64
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := n.Add(1)
+					short := fmt.Sprintf("bench%d", i%numLinks)
+					write := i%10 == 0 // one save for every nine loads
+					switch {
+					case locked && write:
+						mu.Lock()
+					case locked:
+						mu.RLock()
+					}
+					var err error
+					if write {
+						err = s.Save(&Link{Short: short, Long: fmt.Sprintf("http://example.com/%d", i)})
+					} else {
+						// bypass the coalescing in Load to measure the database
+						_, err = s.load(linkID(short))
+					}
+					switch {
+					case locked && write:
+						mu.Unlock()
+					case locked:
+						mu.RUnlock()
+					}
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
+
+// saveStatsLoop is the previous SaveStats, which saves the stats of each
+// link with its own statements, for comparison in BenchmarkSaveStats.
+func saveStatsLoop(s *PostgresDB, stats ClickStats) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := s.Now().Unix()
+	for short, clicks := range stats {
+		if _, err := tx.Exec("INSERT INTO Stats (ID, Created, Clicks) VALUES ($1, $2, $3)", linkID(short), now, clicks); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE Links SET TotalClicks = TotalClicks + $2 WHERE ID = $1", linkID(short), clicks); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// BenchmarkSaveStats compares saving the stats of many links in a single
+// statement with saving them one link at a time. Like
+// BenchmarkPostgresDBParallel, it needs a database named by
+// GOLINK_TEST_PGDSN, to which it saves links named bench0 to bench999.
+func BenchmarkSaveStats(b *testing.B) {
+	dsn := os.Getenv("GOLINK_TEST_PGDSN")
+	if dsn == "" {
+		b.Skip("GOLINK_TEST_PGDSN not set")
+	}
+	s, err := NewPostgresDB(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	stats := make(ClickStats)
+	for i := range 1000 {
+		short := fmt.Sprintf("bench%d", i)
+		if err := s.Save(&Link{Short: short, Long: "http://example.com/"}); err != nil {
+			b.Fatal(err)
+		}
+		stats[short] = i%7 + 1
+	}
+
+	saves := []struct {
+		name string
+		save func(ClickStats) error
+	}{
+		{"loop", func(stats ClickStats) error { return saveStatsLoop(s, stats) }},
+		{"batch", s.SaveStats},
+	}
+	for _, n := range []int{10, 100, 1000} {
+		batch := make(ClickStats, n)
+		for short, clicks := range stats {
+			if len(batch) == n {
+				break
+			}
+			batch[short] = clicks
+		}
+		for _, save := range saves {
+			b.Run(fmt.Sprintf("%s/links=%d", save.name, n), func(b *testing.B) {
+				for range b.N {
+					if err := save.save(batch); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doctor collects the results of `golink doctor` checks.
+type doctor struct {
+	w        io.Writer
+	problems int
+}
+
+func (d *doctor) ok(format string, args ...any) {
+	fmt.Fprintf(d.w, "ok    "+format+"\n", args...)
+}
+
+func (d *doctor) warn(format string, args ...any) {
+	fmt.Fprintf(d.w, "warn  "+format+"\n", args...)
+}
+
+// fail reports a problem, along with a hint on how to fix it.
+func (d *doctor) fail(hint, format string, args ...any) {
+	d.problems++
+	fmt.Fprintf(d.w, "FAIL  "+format+"\n", args...)
+	fmt.Fprintf(d.w, "      %s\n", hint)
+}
+
+// runDoctor checks golink's configuration and environment without changing
+// anything, printing a diagnostic for each check to w. It returns an error
+// if any check failed, so that it can gate rollouts in CI.
+func runDoctor(w io.Writer) error {
+	d := &doctor{w: w}
+	d.checkConfig()
+	d.checkFiles()
+	d.checkDatabase()
+	d.checkTailscale()
+	if d.problems > 0 {
+		return fmt.Errorf("doctor found %d problems", d.problems)
+	}
+	fmt.Fprintln(w, "no problems found")
+	return nil
+}
+
+// checkConfig validates flags that are otherwise only checked at startup.
+func (d *doctor) checkConfig() {
+	if _, err := parseNamespaceQuotas(*namespaceQuotas); err != nil {
+		d.fail(`use comma-separated namespace=limit pairs, such as "eng=500,sales=100"`, "--namespace-quotas: %v", err)
+	}
+	if _, err := parseLinkPatterns(*protectedLinksFlag); err != nil {
+		d.fail(`use comma-separated short names or prefixes ending in "*", such as "wiki,eng.*"`, "--protected-links: %v", err)
+	}
+	if oidc, err := oidcFlagConfig(); err != nil {
+		d.fail("check that the file exists and is readable", "--oidc-client-secret-file: %v", err)
+	} else if _, err := newIdentityProvider(*identityMode, *identityHeader, *trustedProxies, oidc); err != nil {
+		d.fail(`use --identity=tailscale, --identity=header with --trusted-proxies, or --identity=oidc with the --oidc-* flags`, "--identity: %v", err)
+	} else {
+		d.ok("identity provider configured")
+	}
+	if *auditExport != "" {
+		if _, err := newAuditExporter(*auditExport, *auditFormat); err != nil {
+			d.fail("use an https:// URL or syslog+tcp:// or syslog+udp:// address, and --audit-format=json or cef", "--audit-export: %v", err)
+		}
+	}
+	if *checkNormalization != "" {
+		if _, err := parseNormalizationRules(*checkNormalization); err != nil {
+			d.fail(`use rules from "underscore", "dot"`, "--check-normalization: %v", err)
+		}
+	}
+	if *resolveNormalization != "" {
+		if _, err := parseNormalizationRules(*resolveNormalization); err != nil {
+			d.fail(`use rules from "underscore", "dot"`, "--resolve-normalization: %v", err)
+		}
+	}
+	if _, err := parseHeaderAllowlist(*linkHeaders); err != nil {
+		d.fail(`use comma-separated header names, such as "Cache-Control,X-Robots-Tag"`, "--link-headers: %v", err)
+	}
+	if _, err := parseTagParams(*tagParamsConfig); err != nil {
+		d.fail(`use semicolon-separated tag=params rules, such as "marketing=utm_source=golink"`, "--tag-params: %v", err)
+	}
+	if _, err := parseTagTeams(*tagTeamsConfig); err != nil {
+		d.fail(`use comma-separated tag=team pairs, such as "tag:ci=sre"`, "--tag-teams: %v", err)
+	}
+	if _, err := parseScoreWeights(*searchWeightsConfig); err != nil {
+		d.fail(`use comma-separated name=weight pairs, such as "clicks=1,recency=1,prefix=2,owner=1"`, "--search-weights: %v", err)
+	}
+	if _, err := parseHomeSections(*homeSectionsConfig); err != nil {
+		d.fail(`use semicolon-separated sections, such as "pinned=docs,wiki;trending;popular;tag=onboarding"`, "--home-sections: %v", err)
+	}
+	if _, err := newRandomShorts(*autoShortAlphabet, *autoShortLength); err != nil {
+		d.fail("use distinct lowercase letters and digits, and a length of at least 1", "--auto-short-alphabet: %v", err)
+	}
+	if v := buildVersion(); *requireFIPS && !v.FIPS140 && !v.BoringCrypto {
+		d.fail("build with GOFIPS140=v1.0.0 or run with GODEBUG=fips140=on", "--require-fips is set but FIPS mode is not enabled")
+	}
+
+	switch {
+	case *templateCacheSize == 0:
+		d.warn("--template-cache-size=0 disables the link template cache; template links are parsed on every visit")
+	case *templateCacheSize < 0:
+		d.fail("set --template-cache-size to 0 or more", "--template-cache-size is negative")
+	}
+	if *linkCacheSize < 0 {
+		d.fail("set --link-cache-size to 0 or more", "--link-cache-size is negative")
+	}
+	if *linkCacheSize > 0 && *linkCacheTTL <= 0 {
+		d.fail("set --link-cache-ttl to a positive duration", "--link-cache-ttl=%v would never cache links", *linkCacheTTL)
+	}
+	if *dbMaxOpenConns > 0 && *dbMaxOpenConns < minOpenConns {
+		d.fail(fmt.Sprintf("set --db-max-open-conns to 0 or at least %d", minOpenConns), "--db-max-open-conns=%d leaves too few connections for listening for changes and running background jobs", *dbMaxOpenConns)
+	}
+	if *statsQueueSize < 0 {
+		d.fail("set --stats-queue-size to 0 or more", "--stats-queue-size is negative")
+	}
+	if *statsDropPolicy != "newest" && *statsDropPolicy != "oldest" {
+		d.fail(`use "newest" or "oldest"`, "--stats-drop-policy=%q is not a drop policy", *statsDropPolicy)
+	}
+	if err := setIDStrategy(*idNormalization); err != nil {
+		d.fail(`use "legacy", "strict", or "fold"`, "--id-normalization: %v", err)
+	}
+	if _, err := parseStatsTimezone(*statsTimezone); err != nil {
+		d.fail("use an IANA time zone name, such as America/New_York", "--stats-timezone: %v", err)
+	}
+	if *linkCheckWindow != "" {
+		if _, err := parseDailyWindow(*linkCheckWindow); err != nil {
+			d.fail("use a window such as 22:00-06:00", "--link-check-window: %v", err)
+		}
+	}
+	if _, err := parseOutboundConfig(*outboundProxy, *outboundCAFile, *outboundTimeout, *outboundAllow); err != nil {
+		d.fail("check the --outbound-* flags", "%v", err)
+	}
+	if *linkCheckAuthFile != "" {
+		f, err := os.Open(*linkCheckAuthFile)
+		if err == nil {
+			_, err = parseLinkCheckAuth(f)
+			f.Close()
+		}
+		if err != nil {
+			d.fail(`list one "name hosts Header: value" credential per line`, "--link-check-auth-file: %v", err)
+		}
+	}
+	if *syncFile != "" {
+		if _, err := readSyncFile(); err != nil {
+			d.fail("fix the manifest, or run \"golink sync check\" to see what it would change", "--sync-file: %v", err)
+		}
+	} else if *syncPrune {
+		d.warn("--sync-prune has no effect without --sync-file")
+	}
+	if *linkCheckPerHost < 1 {
+		d.warn("--link-check-per-host=%d is treated as 1", *linkCheckPerHost)
+	}
+	if *statsRetention > 0 && *compactAfter > 0 && *statsRetention <= *compactAfter {
+		d.warn("--stats-retention=%v drops click stats before --compact-stats-after=%v rolls them up; compaction has no effect", *statsRetention, *compactAfter)
+	}
+	if *gcAutoLinksAfter > 0 && *gcAutoLinksAfter < 24*time.Hour {
+		d.warn("--gc-auto-links-after=%v may delete auto-created links before anyone has a chance to use them", *gcAutoLinksAfter)
+	}
+}
+
+// checkFiles checks that configured files are readable and that secrets are
+// not readable by other users.
+func (d *doctor) checkFiles() {
+	secrets := []struct{ flag, path string }{
+		{"--owner-key-file", *ownerKeyFile},
+		{"--api-tokens-file", *apiTokensFile},
+	}
+	for _, f := range secrets {
+		if f.path == "" {
+			continue
+		}
+		fi, err := os.Stat(f.path)
+		if err != nil {
+			d.fail("check the path and that golink can read it", "%s: %v", f.flag, err)
+			continue
+		}
+		if fi.Mode().Perm()&0o077 != 0 {
+			d.fail(fmt.Sprintf("run: chmod 600 %s", f.path), "%s %s is accessible by other users (mode %v)", f.flag, f.path, fi.Mode().Perm())
+			continue
+		}
+		d.ok("%s is private", f.flag)
+	}
+	if *ownerKeyFile != "" {
+		if b, err := os.ReadFile(*ownerKeyFile); err == nil {
+			if _, err := parseOwnerKey(b); err != nil {
+				d.fail("generate a key with: head -c 32 /dev/urandom | base64", "--owner-key-file: %v", err)
+			}
+		}
+	}
+	if *apiTokensFile != "" {
+		if f, err := os.Open(*apiTokensFile); err == nil {
+			_, err := parseAPITokens(f)
+			f.Close()
+			if err != nil {
+				d.fail(`use one "token login" pair per line`, "--api-tokens-file: %v", err)
+			}
+		}
+	}
+	if *ownerMapFile != "" {
+		if f, err := os.Open(*ownerMapFile); err != nil {
+			d.fail("check the path and that golink can read it", "--owner-map: %v", err)
+		} else {
+			_, err := parseOwnerMap(f)
+			f.Close()
+			if err != nil {
+				d.fail(`use one "old new" owner pair per line`, "--owner-map: %v", err)
+			}
+		}
+	}
+	if *templateDir != "" {
+		if err := loadTemplateOverrides(os.DirFS(*templateDir)); err != nil {
+			d.fail("fix the template, or remove it to use the built-in page", "--template-dir: %v", err)
+		} else {
+			d.ok("template overrides in %s parse", *templateDir)
+		}
+	}
+}
+
+// checkDatabase checks that the database is reachable and that its schema
+// is current, without applying the schema.
+func (d *doctor) checkDatabase() {
+	if *pgDSN == "" {
+		d.fail("set --pgdsn or DATABASE_URL", "no database configured")
+		return
+	}
+	conn, err := sql.Open("pgx", *pgDSN)
+	if err != nil {
+		d.fail("check the --pgdsn connection string", "opening database: %v", err)
+		return
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := conn.PingContext(ctx); err != nil {
+		d.fail("check that PostgreSQL is running and reachable, and the credentials in --pgdsn", "connecting to database: %v", err)
+		return
+	}
+	d.ok("connected to database")
+
+	ms, err := loadMigrations(migrationFS)
+	if err != nil {
+		d.fail("rebuild golink", "loading schema migrations: %v", err)
+		return
+	}
+	pending, err := pendingMigrations(ctx, conn, ms)
+	if err != nil {
+		d.fail("check that the database user can read the schema_version table, and that golink is not older than the database", "checking schema: %v", err)
+		return
+	}
+	if len(pending) > 0 {
+		d.fail("run golink --migrate-only with a database user allowed to alter tables, or start this version of golink", "database schema is out of date: %d migrations pending, starting with %s", len(pending), pending[0].name)
+		return
+	}
+
+	var missing []string
+	for _, col := range strings.Split(linkColumns, ", ") {
+		var exists bool
+		err := conn.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND lower(table_name) = 'links' AND lower(column_name) = lower($1))", col).Scan(&exists)
+		if err != nil {
+			d.fail("check that the database user can read information_schema", "checking schema: %v", err)
+			return
+		}
+		if !exists {
+			missing = append(missing, "Links."+col)
+		}
+	}
+	if len(missing) > 0 {
+		d.fail("start this version of golink to migrate the schema, using a database user allowed to create tables", "database schema is out of date: missing %s", strings.Join(missing, ", "))
+		return
+	}
+	d.ok("database schema is current")
+
+	if *templateCacheSize > 0 {
+		var n int
+		if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM Links WHERE Long LIKE '%{{%'").Scan(&n); err == nil && n > *templateCacheSize {
+			d.warn("%d links use templates but --template-cache-size is %d; consider raising it", n, *templateCacheSize)
+		}
+	}
+}
+
+// checkTailscale checks the state needed to join the tailnet.
+func (d *doctor) checkTailscale() {
+	if devMode() {
+		d.ok("dev mode: not joining a tailnet")
+		return
+	}
+	dir := *configDir
+	if dir == "" {
+		confDir, err := os.UserConfigDir()
+		if err != nil {
+			d.fail("set --config-dir", "finding default tsnet config dir: %v", err)
+			return
+		}
+		dir = filepath.Join(confDir, "tsnet-golink")
+	}
+	// check that the directory, or the parent it will be created in, is writable
+	writable := dir
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		writable = filepath.Dir(dir)
+	}
+	f, err := os.CreateTemp(writable, ".golink-doctor-*")
+	if err != nil {
+		d.fail("set --config-dir to a directory writable by the golink user, such as a persistent volume", "tsnet config dir %s is not writable: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	if _, err := os.Stat(filepath.Join(dir, "tailscaled.state")); err == nil {
+		d.ok("tailscale state found in %s", dir)
+	} else if os.Getenv("TS_AUTHKEY") != "" {
+		d.ok("no tailscale state yet; will log in with TS_AUTHKEY")
+	} else {
+		d.warn("no tailscale state in %s and TS_AUTHKEY is not set; golink will print a login URL on first start", dir)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoctorCheckFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := filepath.Join(dir, "owner.key")
+	if err := os.WriteFile(key, []byte("0123456789abcdef0123456789abcdef"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	oldKeyFile := *ownerKeyFile
+	t.Cleanup(func() { *ownerKeyFile = oldKeyFile })
+	*ownerKeyFile = key
+
+	var out strings.Builder
+	d := &doctor{w: &out}
+	d.checkFiles()
+	if d.problems != 1 || !strings.Contains(out.String(), "chmod 600") {
+		t.Errorf("world-readable key: problems = %d, output:\n%s", d.problems, out.String())
+	}
+
+	if err := os.Chmod(key, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	d = &doctor{w: &out}
+	d.checkFiles()
+	if d.problems != 0 {
+		t.Errorf("private key: problems = %d, output:\n%s", d.problems, out.String())
+	}
+}
+
+func TestDoctorCheckConfig(t *testing.T) {
+	oldQuotas := *namespaceQuotas
+	t.Cleanup(func() { *namespaceQuotas = oldQuotas })
+	*namespaceQuotas = "eng=lots"
+
+	var out strings.Builder
+	d := &doctor{w: &out}
+	d.checkConfig()
+	if d.problems != 1 || !strings.Contains(out.String(), "FAIL  --namespace-quotas") {
+		t.Errorf("problems = %d, output:\n%s", d.problems, out.String())
+	}
+}
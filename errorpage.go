@@ -0,0 +1,155 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Kinds of error pages that can be customized with --template-dir.
+// A deployment overrides a page by providing "error-{kind}.html".
+const (
+	errorNotFound = "notfound"
+	errorExpired  = "expired"
+	errorBlocked  = "blocked"
+)
+
+var errorKinds = []string{errorNotFound, errorExpired, errorBlocked}
+
+// tmplOverrides holds templates from --template-dir, if set.
+var tmplOverrides fs.FS
+
+// customErrorTmpls holds the error page templates provided by --template-dir,
+// keyed by error kind.
+var customErrorTmpls map[string]*template.Template
+
+// overlayFS serves files under "tmpl/" from override if present there,
+// and otherwise from base.
+type overlayFS struct {
+	override fs.FS // rooted at the template directory
+	base     fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if rel, ok := strings.CutPrefix(name, "tmpl/"); ok {
+		f, err := o.override.Open(rel)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return o.base.Open(name)
+}
+
+// templateFS returns the file system that templates are parsed from.
+func templateFS() fs.FS {
+	if tmplOverrides == nil {
+		return embeddedFS
+	}
+	return overlayFS{override: tmplOverrides, base: embeddedFS}
+}
+
+// loadTemplateOverrides reparses all templates with overrides from fsys.
+func loadTemplateOverrides(fsys fs.FS) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	tmplOverrides = fsys
+	loadTemplates()
+	return nil
+}
+
+// loadCustomErrorTemplates returns the error page templates provided by
+// tmplOverrides, keyed by error kind.
+func loadCustomErrorTemplates() map[string]*template.Template {
+	tmpls := make(map[string]*template.Template)
+	if tmplOverrides == nil {
+		return tmpls
+	}
+	for _, kind := range errorKinds {
+		name := "error-" + kind + ".html"
+		if _, err := fs.Stat(tmplOverrides, name); err == nil {
+			tmpls[kind] = newTemplate("base.html", name)
+		}
+	}
+	return tmpls
+}
+
+// errorData is the data used by error page templates.
+type errorData struct {
+	Status  int
+	Kind    string // one of errorNotFound, errorExpired, or errorBlocked
+	Short   string // the requested short name
+	Message string
+
+	// Namespace is the namespace of Short, and NamespaceTeam is the team that
+	// uses it as their default namespace, if any. Pages can use these to
+	// suggest who to contact about the link.
+	Namespace     string
+	NamespaceTeam *Team
+
+	// Suggestions are existing links that may be what was meant by a
+	// missing Short, with similar names or found using the synonym
+	// dictionary.
+	Suggestions []*Link
+}
+
+// serveErrorPage writes an error page of the specified kind, using a custom
+// template from --template-dir if one was provided.
+// Requests that do not accept HTML receive msg as plain text.
+func serveErrorPage(w http.ResponseWriter, r *http.Request, status int, kind, short, msg string) {
+	if !acceptHTML(r) {
+		http.Error(w, msg, status)
+		return
+	}
+
+	data := errorData{
+		Status:    status,
+		Kind:      kind,
+		Short:     short,
+		Message:   msg,
+		Namespace: linkNamespace(short),
+	}
+	if data.Namespace != "" {
+		data.NamespaceTeam = namespaceTeam(data.Namespace)
+	}
+	if kind == errorNotFound {
+		data.Suggestions = suggestLinks(short)
+	}
+
+	t := customErrorTmpls[kind]
+	if t == nil {
+		t = errorTmpl
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := t.Execute(w, data); err != nil {
+		log.Printf("rendering %s error page: %v", kind, err)
+	}
+}
+
+// namespaceTeam returns the team whose default namespace is ns, or nil.
+func namespaceTeam(ns string) *Team {
+	teams, err := db.LoadTeams()
+	if err != nil {
+		log.Printf("loading teams: %v", err)
+		return nil
+	}
+	for _, t := range teams {
+		if t.Namespace != "" && linkID(t.Namespace) == linkID(ns) {
+			return t
+		}
+	}
+	return nil
+}
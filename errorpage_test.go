@@ -0,0 +1,63 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOverlayFS(t *testing.T) {
+	fsys := overlayFS{
+		override: fstest.MapFS{
+			"help.html": {Data: []byte("custom help")},
+		},
+		base: embeddedFS,
+	}
+
+	b, err := fs.ReadFile(fsys, "tmpl/help.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); got != "custom help" {
+		t.Errorf("tmpl/help.html = %q; want override", got)
+	}
+
+	b, err = fs.ReadFile(fsys, "tmpl/home.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `define "main"`) {
+		t.Errorf("tmpl/home.html did not fall back to embedded template")
+	}
+}
+
+func TestLoadTemplateOverrides(t *testing.T) {
+	t.Cleanup(func() {
+		tmplOverrides = nil
+		loadTemplates()
+	})
+
+	err := loadTemplateOverrides(fstest.MapFS{
+		"error-notfound.html": {Data: []byte(`{{ define "main" }}ask in #help{{ end }}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customErrorTmpls[errorNotFound] == nil {
+		t.Errorf("custom notfound template not loaded")
+	}
+	if customErrorTmpls[errorExpired] != nil {
+		t.Errorf("unexpected custom expired template")
+	}
+
+	err = loadTemplateOverrides(fstest.MapFS{
+		"home.html": {Data: []byte(`{{ define "main" }}{{ end`)},
+	})
+	if err == nil {
+		t.Errorf("loadTemplateOverrides with invalid template succeeded; want error")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiresLayout is the format of link expiration times in the edit form,
+// as used by HTML datetime-local inputs. Times are in UTC.
+const expiresLayout = "2006-01-02T15:04"
+
+// parseExpires parses the expires form value of a link, which is empty for
+// links that never expire. It may be a date (2006-01-02), a time in
+// expiresLayout or RFC 3339, or a lifetime from now in hours, days, or
+// weeks, such as "30d".
+func parseExpires(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if m := reQueryAge.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		now = now.UTC().Truncate(time.Second)
+		switch m[2] {
+		case "h":
+			return now.Add(time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, n), nil
+		case "w":
+			return now.AddDate(0, 0, 7*n), nil
+		}
+	}
+	for _, layout := range []string{time.DateOnly, expiresLayout, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expires %q: use YYYY-MM-DD, RFC 3339, or a lifetime like 30d", s)
+}
+
+// linkExpired reports whether link has expired at now.
+func linkExpired(link *Link, now time.Time) bool {
+	return !link.Expires.IsZero() && !now.Before(link.Expires)
+}
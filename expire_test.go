@@ -0,0 +1,55 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpires(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 30, 15, 500, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: ""},
+		{in: "2023-04-01", want: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "2023-04-01T09:30", want: time.Date(2023, 4, 1, 9, 30, 0, 0, time.UTC)},
+		{in: "2023-04-01T09:30:00-07:00", want: time.Date(2023, 4, 1, 16, 30, 0, 0, time.UTC)},
+		{in: "12h", want: time.Date(2023, 3, 2, 0, 30, 15, 0, time.UTC)},
+		{in: "30d", want: time.Date(2023, 3, 31, 12, 30, 15, 0, time.UTC)},
+		{in: "2w", want: time.Date(2023, 3, 15, 12, 30, 15, 0, time.UTC)},
+		{in: "next week", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseExpires(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseExpires(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseExpires(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLinkExpired(t *testing.T) {
+	now := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expires time.Time
+		want    bool
+	}{
+		{time.Time{}, false},
+		{now.Add(time.Second), false},
+		{now, true},
+		{now.Add(-time.Hour), true},
+	}
+	for _, tt := range tests {
+		if got := linkExpired(&Link{Expires: tt.expires}, now); got != tt.want {
+			t.Errorf("linkExpired with Expires %v = %v; want %v", tt.expires, got, tt.want)
+		}
+	}
+}
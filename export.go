@@ -0,0 +1,71 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// linkWriter writes links to an export, one at a time.
+type linkWriter interface {
+	Write(*Link) error
+	Close() error // finishes the export without closing the underlying writer
+}
+
+// exportFormats are the formats of /.export, by the name used in its
+// "format" parameter, and their content types.
+var exportFormats = map[string]struct {
+	contentType string
+	writer      func(io.Writer) linkWriter
+}{
+	"jsonl": {"text/plain; charset=utf-8", func(w io.Writer) linkWriter { return newBackupWriter(w) }},
+	"csv":   {"text/csv; charset=utf-8", func(w io.Writer) linkWriter { return newCSVWriter(w) }},
+}
+
+// csvColumns is the header row of CSV exports. The short, long, and owner
+// columns can be read back by /.api/v1/import.
+var csvColumns = []string{"Short", "Long", "Owner", "Created", "LastEdit", "Clicks"}
+
+// csvWriter writes links as CSV rows, flushing them as its buffer fills.
+type csvWriter struct {
+	w       *csv.Writer
+	started bool // header written
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) header() error {
+	if cw.started {
+		return nil
+	}
+	cw.started = true
+	return cw.w.Write(csvColumns)
+}
+
+func (cw *csvWriter) Write(link *Link) error {
+	if err := cw.header(); err != nil {
+		return err
+	}
+	return cw.w.Write([]string{
+		link.Short,
+		link.Long,
+		link.Owner,
+		link.Created.UTC().Format(time.RFC3339),
+		link.LastEdit.UTC().Format(time.RFC3339),
+		strconv.Itoa(link.TotalClicks),
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	if err := cw.header(); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
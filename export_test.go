@@ -0,0 +1,53 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCSVWriter(t *testing.T) {
+	created := time.Date(2022, 6, 17, 18, 5, 43, 0, time.UTC)
+	tests := []struct {
+		name  string
+		links []*Link
+		want  string
+	}{
+		{
+			name: "empty",
+			want: "Short,Long,Owner,Created,LastEdit,Clicks\n",
+		},
+		{
+			name: "links",
+			links: []*Link{
+				{Short: "go", Long: "http://go", Owner: "amelie@example.com", Created: created, LastEdit: created, TotalClicks: 1},
+				{Short: "q", Long: `https://search/?q={{QueryEscape .Path}},"x"`, Owner: "team:sre", Created: created, LastEdit: created.Add(time.Hour)},
+			},
+			want: "Short,Long,Owner,Created,LastEdit,Clicks\n" +
+				"go,http://go,amelie@example.com,2022-06-17T18:05:43Z,2022-06-17T18:05:43Z,1\n" +
+				`q,"https://search/?q={{QueryEscape .Path}},""x""",team:sre,2022-06-17T18:05:43Z,2022-06-17T19:05:43Z,0` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			cw := newCSVWriter(&b)
+			for _, link := range tt.links {
+				if err := cw.Write(link); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := cw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, b.String()); diff != "" {
+				t.Errorf("csvWriter mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// targetHealthShortName is used as the short name for authorizing changes to
+// target health.
+const targetHealthShortName = ".target-health"
+
+// chooseTarget returns the first target of link, starting with Long and
+// followed by its Fallbacks, that is not marked unhealthy in health.
+// Targets that have never been checked are assumed to be healthy.
+// If every target is unhealthy, Long is returned.
+func chooseTarget(link *Link, health map[string]TargetHealth) string {
+	if h, ok := health[link.Long]; !ok || h.Healthy {
+		return link.Long
+	}
+	for _, target := range link.Fallbacks {
+		if h, ok := health[target]; !ok || h.Healthy {
+			return target
+		}
+	}
+	return link.Long
+}
+
+// resolveTarget returns the target that should be served for link. Active
+// maintenance windows take precedence, followed by target health for links
+// with fallbacks. Serving a fallback is recorded in the database.
+func resolveTarget(link *Link) string {
+	now := time.Now().UTC()
+	if target := maintenanceTarget(link, maintenanceWindows(now), now); target != "" {
+		return target
+	}
+	if len(link.Fallbacks) == 0 {
+		return link.Long
+	}
+	health, err := db.LoadTargetHealth(append([]string{link.Long}, link.Fallbacks...))
+	if err != nil {
+		log.Printf("loading target health for %q: %v", link.Short, err)
+		return link.Long
+	}
+	target := chooseTarget(link, health)
+	if target != link.Long {
+		if err := db.RecordFallbackServe(link.Short, target); err != nil {
+			log.Printf("recording fallback for %q: %v", link.Short, err)
+		}
+	}
+	return target
+}
+
+// parseFallbacks parses newline-separated fallback targets, ignoring blank lines.
+func parseFallbacks(s string) []string {
+	var fallbacks []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fallbacks = append(fallbacks, line)
+		}
+	}
+	return fallbacks
+}
+
+// serveTargetHealth returns the recorded health of targets on GET requests,
+// and allows admins to mark a target healthy or unhealthy on POST requests.
+// The dead-link checker records its results in the same place.
+func serveTargetHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		health, err := db.LoadTargetHealth(r.URL.Query()["target"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(health)
+		return
+	}
+
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	target := r.FormValue("target")
+	healthy, err := strconv.ParseBool(r.FormValue("healthy"))
+	if target == "" || err != nil {
+		http.Error(w, "target and healthy (true or false) required", http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		http.Error(w, "only admins can mark target health", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, targetHealthShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	h := TargetHealth{
+		Target:  target,
+		Healthy: healthy,
+		Checked: time.Now().UTC(),
+		Detail:  r.FormValue("detail"),
+	}
+	if err := db.SaveTargetHealth(h); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h)
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestChooseTarget(t *testing.T) {
+	link := &Link{
+		Long:      "http://primary/",
+		Fallbacks: []string{"http://secondary/", "http://tertiary/"},
+	}
+	healthy := TargetHealth{Healthy: true}
+	unhealthy := TargetHealth{Healthy: false}
+
+	tests := []struct {
+		name   string
+		health map[string]TargetHealth
+		want   string
+	}{
+		{
+			name: "unchecked primary",
+			want: "http://primary/",
+		},
+		{
+			name:   "healthy primary",
+			health: map[string]TargetHealth{"http://primary/": healthy},
+			want:   "http://primary/",
+		},
+		{
+			name:   "unhealthy primary",
+			health: map[string]TargetHealth{"http://primary/": unhealthy},
+			want:   "http://secondary/",
+		},
+		{
+			name: "skip unhealthy fallback",
+			health: map[string]TargetHealth{
+				"http://primary/":   unhealthy,
+				"http://secondary/": unhealthy,
+				"http://tertiary/":  healthy,
+			},
+			want: "http://tertiary/",
+		},
+		{
+			name: "all unhealthy",
+			health: map[string]TargetHealth{
+				"http://primary/":   unhealthy,
+				"http://secondary/": unhealthy,
+				"http://tertiary/":  unhealthy,
+			},
+			want: "http://primary/",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chooseTarget(link, tt.health); got != tt.want {
+				t.Errorf("chooseTarget() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFallbacks(t *testing.T) {
+	got := parseFallbacks(" http://a/ \n\n\thttp://b/\r\n")
+	want := []string{"http://a/", "http://b/"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseFallbacks() = %q; want %q", got, want)
+	}
+	if got := parseFallbacks(""); got != nil {
+		t.Errorf("parseFallbacks(\"\") = %q; want nil", got)
+	}
+}
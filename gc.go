@@ -0,0 +1,118 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// notifyOwner delivers a message about link to its owner.
+// It may be overridden to deliver notifications by other means.
+var notifyOwner = func(link *Link, msg string) {
+	log.Printf("notify %s about %s: %s", link.Owner, link.Short, msg)
+}
+
+// createsAutoLinks reports whether the links u creates are auto-created,
+// and so garbage collected if never clicked: those created by tagged
+// devices, which are bots and importers rather than people. It is decided
+// here rather than by the request, so that people can't have their own
+// links deleted, or bots exempt theirs.
+func createsAutoLinks(u user) bool {
+	return len(u.tags) > 0
+}
+
+// gcEligible reports whether link is an auto-created link that has never been
+// clicked and is older than the configured --gc-auto-links-after age.
+func gcEligible(link *Link, clicks int, now time.Time) bool {
+	if !link.AutoCreated || clicks > 0 {
+		return false
+	}
+	if *gcExemptTag != "" && link.HasTag(*gcExemptTag) {
+		return false
+	}
+	return now.Sub(link.Created) >= *gcAutoLinksAfter
+}
+
+// collectGarbage removes auto-created links that have never been clicked.
+//
+// Eligible links are first marked and their owner notified. Links that are
+// still eligible once --gc-grace has passed since they were marked are deleted.
+// Marks are cleared from links that are clicked or exempted in the meantime.
+func collectGarbage(now time.Time) error {
+	if err := flushStats(); err != nil {
+		return err
+	}
+	links, err := db.LoadWhere("AutoCreated")
+	if err != nil {
+		return err
+	}
+	shorts := make([]string, len(links))
+	for i, link := range links {
+		shorts[i] = link.Short
+	}
+	clicks, err := db.LoadStatsFor(shorts)
+	if err != nil {
+		return err
+	}
+	notices, err := db.LoadGCNotices()
+	if err != nil {
+		return err
+	}
+
+	var marked, deleted int
+	for _, link := range links {
+		id := linkID(link.Short)
+		notified, ok := notices[id]
+		delete(notices, id)
+
+		if !gcEligible(link, clicks[id], now) {
+			if ok {
+				if err := db.DeleteGCNotice(link.Short); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !ok {
+			if err := db.SaveGCNotice(link.Short, now); err != nil {
+				return err
+			}
+			notifyOwner(link, fmt.Sprintf("%s/%s has never been clicked and will be deleted after %s unless it is used or tagged %q",
+				*hostname, link.Short, now.Add(*gcGrace).Format(time.DateOnly), *gcExemptTag))
+			marked++
+			continue
+		}
+		if now.Sub(notified) < *gcGrace {
+			continue
+		}
+
+		if err := db.Delete(link.Short, ""); err != nil {
+			return err
+		}
+		deleteLinkStats(link)
+		linkChanges.Add("delete", 1)
+		linkTemplates.invalidate(link.Short)
+		if err := db.DeleteGCNotice(link.Short); err != nil {
+			return err
+		}
+		notifyOwner(link, fmt.Sprintf("%s/%s was deleted because it was never clicked", *hostname, link.Short))
+		notifyLinkChange("", link, nil)
+		deleted++
+	}
+
+	// remove marks for links that no longer exist or are not auto-created
+	for id := range notices {
+		if err := db.DeleteGCNotice(id); err != nil {
+			return err
+		}
+	}
+
+	if (marked > 0 || deleted > 0) && *verbose {
+		log.Printf("garbage collection: marked %d links, deleted %d links", marked, deleted)
+	}
+	return nil
+}
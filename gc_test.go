@@ -0,0 +1,102 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCEligible(t *testing.T) {
+	oldAfter, oldTag := *gcAutoLinksAfter, *gcExemptTag
+	*gcAutoLinksAfter, *gcExemptTag = 30*24*time.Hour, "keep"
+	t.Cleanup(func() { *gcAutoLinksAfter, *gcExemptTag = oldAfter, oldTag })
+
+	now := time.Date(2022, 06, 02, 1, 2, 3, 4, time.UTC)
+	old := now.Add(-31 * 24 * time.Hour)
+	recent := now.Add(-24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		link   *Link
+		clicks int
+		want   bool
+	}{
+		{
+			name: "old unclicked auto link",
+			link: &Link{Short: "a", Created: old, AutoCreated: true},
+			want: true,
+		},
+		{
+			name: "manually created link",
+			link: &Link{Short: "a", Created: old},
+			want: false,
+		},
+		{
+			name:   "clicked auto link",
+			link:   &Link{Short: "a", Created: old, AutoCreated: true},
+			clicks: 1,
+			want:   false,
+		},
+		{
+			name: "recent auto link",
+			link: &Link{Short: "a", Created: recent, AutoCreated: true},
+			want: false,
+		},
+		{
+			name: "exempt auto link",
+			link: &Link{Short: "a", Created: old, AutoCreated: true, Tags: []string{"keep"}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gcEligible(tt.link, tt.clicks, now); got != tt.want {
+				t.Errorf("gcEligible = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeSaveAutoCreated(t *testing.T) {
+	db = newTestDB(t)
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	tests := []struct {
+		short string
+		user  user
+		want  bool
+	}{
+		// asking for it doesn't make a person's link garbage collected
+		{short: "person", user: user{login: "foo@example.com"}, want: false},
+		{short: "bot", user: user{login: "tagged-devices", tags: []string{"tag:ci"}}, want: true},
+	}
+	for _, tt := range tests {
+		currentUser = func(*http.Request) (user, error) { return tt.user, nil }
+		r := httptest.NewRequest("POST", "/", strings.NewReader(url.Values{
+			"short": {tt.short},
+			"long":  {"https://example.com/"},
+			"auto":  {"1"},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		serveSave(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("saving %s: %d %s", tt.short, w.Code, w.Body)
+		}
+		link, err := db.Load(tt.short)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.AutoCreated != tt.want {
+			t.Errorf("%s AutoCreated = %v; want %v", tt.short, link.AutoCreated, tt.want)
+		}
+	}
+}
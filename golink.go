@@ -7,6 +7,7 @@ package golink
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/rand"
 	"embed"
@@ -17,24 +18,31 @@ import (
 	"fmt"
 	"html/template"
 	"io/fs"
+	"iter"
 	"log"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	texttemplate "text/template"
 	"time"
+	"unicode"
 
+	"golang.org/x/crypto/acme"
 	"golang.org/x/net/xsrftoken"
 	"tailscale.com/client/tailscale"
 	"tailscale.com/hostinfo"
 	"tailscale.com/ipn"
 	"tailscale.com/tailcfg"
 	"tailscale.com/tsnet"
+	"tailscale.com/tsweb/varz"
 	"tailscale.com/util/dnsname"
 )
 
@@ -57,14 +65,104 @@ var (
 	verbose           = flag.Bool("verbose", false, "be verbose")
 	controlURL        = flag.String("control-url", ipn.DefaultControlURL, "the URL base of the control plane (i.e. coordination server)")
 	pgDSN             = flag.String("pgdsn", os.Getenv("DATABASE_URL"), "PostgreSQL Data Source Name (connection string). Can also be set via DATABASE_URL env var.")
+	dbMaxOpenConns    = flag.Int("db-max-open-conns", 0, "maximum number of open PostgreSQL connections (0 for no limit)")
+	dbMaxIdleConns    = flag.Int("db-max-idle-conns", 10, "maximum number of idle PostgreSQL connections kept open for reuse")
 	devListen         = flag.String("dev-listen", "", "if non-empty, listen on this address (e.g., localhost:8080 or :ENV to use 0.0.0.0:$PORT) and run in dev mode; auto-set pgdsn if empty and don't use tsnet")
 	useHTTPS          = flag.Bool("https", true, "serve golink over HTTPS if enabled on tailnet")
+	grpcListen        = flag.String("grpc-listen", "", `if non-empty, also serve the golink.v1 gRPC API on this address of the tailnet (e.g., ":9090"), or of the host with --dev-listen`)
 	snapshot          = flag.String("snapshot", "", "file path of snapshot file (NOTE: --resolve-from-backup feature is currently disabled for PostgreSQL)")
 	hostname          = flag.String("hostname", defaultHostname, "service name")
 	configDir         = flag.String("config-dir", "", `tsnet configuration directory ("" to use default)`)
 	resolveFromBackup = flag.String("resolve-from-backup", "", "resolve a link from snapshot file and exit (NOTE: This feature is currently disabled for PostgreSQL)")
 	allowUnknownUsers = flag.Bool("allow-unknown-users", false, "allow unknown users to save links")
 	readonly          = flag.Bool("readonly", false, "start golink server in read-only mode")
+	migrateOnly       = flag.Bool("migrate-only", false, "apply pending database schema migrations and exit")
+
+	maxLinksPerUser      = flag.Int("max-links-per-user", 0, "maximum number of links a single user may own (0 for no limit)")
+	maxLinksPerNamespace = flag.Int("max-links-per-namespace", 0, "maximum number of links in each namespace (0 for no limit)")
+	namespaceQuotas      = flag.String("namespace-quotas", "", `comma-separated per-namespace link limits overriding --max-links-per-namespace (e.g. "eng=500,sales=100"); 0 means no limit`)
+	maxCreationsPerDay   = flag.Int("max-creations-per-day", 0, "maximum number of links a single user may create in a 24 hour period (0 for no limit)")
+
+	compactAfter     = flag.Duration("compact-stats-after", 30*24*time.Hour, "roll up click stats older than this into daily totals, so that the Stats table stays small (0 to keep every flush)")
+	statsRetention   = flag.Duration("stats-retention", 0, "drop click stats older than this a month at a time, keeping link click totals (0 to keep stats forever)")
+	statsQueueSize   = flag.Int("stats-queue-size", 100000, "maximum number of links whose unsaved clicks are held in memory while the database is slow or down (0 for no limit)")
+	statsDropPolicy  = flag.String("stats-drop-policy", "newest", `unsaved clicks to drop when --stats-queue-size is reached: "newest" (clicks of links not yet queued) or "oldest" (clicks of the link queued longest)`)
+	gcAutoLinksAfter = flag.Duration("gc-auto-links-after", 0, "delete auto-created links that are never clicked within this long of creation (0 to disable)")
+	gcGrace          = flag.Duration("gc-grace", 7*24*time.Hour, "how long after notifying its owner an unclicked auto-created link is deleted")
+	gcExemptTag      = flag.String("gc-exempt-tag", "keep", "tag that exempts auto-created links from garbage collection")
+
+	publicHostname = flag.String("public-hostname", "", "if set, internet-facing domain on which links tagged --public-tag are served over HTTPS, with a certificate obtained from --acme-directory")
+	publicListen   = flag.String("public-listen", ":443", "address to serve --public-hostname on")
+	publicTag      = flag.String("public-tag", "public", "tag of the links served on --public-hostname")
+	acmeDirectory  = flag.String("acme-directory", acme.LetsEncryptURL, "directory URL of the ACME certificate authority used for --public-hostname")
+	acmeEmail      = flag.String("acme-email", "", "contact email registered with the ACME certificate authority")
+	acmeCacheDir   = flag.String("acme-cache-dir", "", `directory storing the ACME account key and certificate ("" for golink/acme in the user config directory)`)
+	acmeDNS        = flag.String("acme-dns-provider", "", `DNS provider that answers DNS-01 challenges for --public-hostname: "cloudflare" or "exec"`)
+	acmeDNSConfig  = flag.String("acme-dns-config", "", `DNS provider configuration: for "cloudflare", a file containing an API token; for "exec", a program run as "PROGRAM present|cleanup FQDN VALUE"`)
+
+	templateDir        = flag.String("template-dir", "", "directory of templates that override the built-in templates, including custom error pages")
+	deprecationPeriod  = flag.Duration("deprecation-period", 30*24*time.Hour, "how long a deprecated link shows a notice before permanently redirecting to its successor")
+	templateCacheSize  = flag.Int("template-cache-size", 1024, "maximum number of parsed link templates to cache (0 to disable)")
+	linkCacheSize      = flag.Int("link-cache-size", 0, "maximum number of loaded links to cache in memory, invalidated across replicas with LISTEN/NOTIFY (0 to disable)")
+	linkCacheTTL       = flag.Duration("link-cache-ttl", time.Minute, "how long a link stays in the --link-cache-size cache, bounding how stale its click counts get")
+	redisURL           = flag.String("redis-url", "", `if set, URL of a Redis server (e.g., "redis://:password@localhost:6379/0") on which replicas share the links they load from the database`)
+	storeBackend       = flag.String("store", "postgres", `where links are stored: "postgres" (--pgdsn), or "redis" (--redis-url), which only resolves links and serves the links API`)
+	redisTTL           = flag.Duration("redis-ttl", time.Minute, "how long a link stays on --redis-url, bounding how stale its click counts get (0 to keep links until they are written)")
+	warmFrom           = flag.String("warm-from", "", "if set, base URL of a running replica (e.g., http://10.0.0.5) to fetch links from at startup, before connecting to the database, to fill the --link-cache-size cache")
+	warmTokenFile      = flag.String("warm-from-token-file", "", "if set, file containing an API token with the links:read scope used to fetch links from --warm-from")
+	templatePinTag     = flag.String("template-pin-tag", "", "if set, links with this tag keep their parsed templates cached, not counting toward --template-cache-size")
+	ownerKeyFile       = flag.String("owner-key-file", "", "if set, file containing a secret key used to pseudonymize link owners so they are not stored in plaintext")
+	ownerMapFile       = flag.String("owner-map", "", "if set, file of owner mappings (old@legacy.example.com new@example.com, or @legacy.example.com @example.com for a whole domain) applied to links restored from --snapshot")
+	identityMode       = flag.String("identity", "", `how to identify users: "tailscale", "header" (trust --identity-header from --trusted-proxies), "oidc" (sign in with --oidc-issuer), or "dev" (default "dev" with --dev-listen, otherwise "tailscale")`)
+	identityHeader     = flag.String("identity-header", "X-Forwarded-Email", "request header containing the user's login, for --identity=header")
+	trustedProxies     = flag.String("trusted-proxies", "", "comma-separated IP addresses or prefixes of proxies allowed to set --identity-header")
+	oidcIssuer         = flag.String("oidc-issuer", "", "OpenID Connect issuer URL users sign in with, for --identity=oidc")
+	oidcClientID       = flag.String("oidc-client-id", "", "OAuth client ID registered with --oidc-issuer")
+	oidcSecretFile     = flag.String("oidc-client-secret-file", "", "file containing the OAuth client secret for --oidc-client-id")
+	oidcRedirectURL    = flag.String("oidc-redirect-url", "", "URL of this server's /.oidc/callback, as registered with --oidc-issuer")
+	oidcLoginClaim     = flag.String("oidc-login-claim", "email", "ID token claim used as the user's login, for --identity=oidc")
+	apiTokensFile      = flag.String("api-tokens-file", "", `if set, file of API tokens and the logins they authenticate as ("token login" per line), accepted as "Authorization: Bearer" headers`)
+	admins             = flag.String("admins", "", "comma-separated logins granted admin access, in addition to admins granted by the identity provider")
+	auditExport        = flag.String("audit-export", "", "if set, send audit events to this https:// URL, or syslog+tcp:// or syslog+udp:// address")
+	auditFormat        = flag.String("audit-format", "json", `format of exported audit events: "json" or "cef"`)
+	probeLink          = flag.String("probe-link", "", "if set, short name of a canary link that the probe job resolves through golink's own listeners every minute, to catch broken certificates or connectivity")
+	sloSpec            = flag.String("slo", "", `semicolon-separated link resolve SLO settings, such as "target=99.9;latency=250ms;window=1h;burn-rate=14.4;unready" (see README)`)
+	webhooksFile       = flag.String("webhooks-file", "", `if set, file of webhooks ("URL secret [events]" per line) that signed link change events are POSTed to`)
+	requireFIPS        = flag.Bool("require-fips", false, "refuse to start unless Go FIPS 140-3 mode or BoringCrypto is enabled")
+	jobsConfig         = flag.String("jobs", "", `semicolon-separated background job schedules overriding the defaults, such as "gc=@daily;stats-flush=@every 30s~5s" ("off" disables a job)`)
+	configFile         = flag.String("config", "", "if set, file of flag settings (\"name = value\" per line) used for flags not set on the command line; see \"golink config example\"")
+	updateURL          = flag.String("update-url", "", "URL of the signed release manifest used by \"golink update\" and /.api/v1/update")
+	updatePublicKey    = flag.String("update-public-key", "", "base64 ed25519 public key that release manifests must be signed with")
+	autoShortAlphabet  = flag.String("auto-short-alphabet", "abcdefghjkmnpqrstuvwxyz23456789", "lowercase letters and digits used in short names generated by /.api/v1/shorten")
+	autoShortLength    = flag.Int("auto-short-length", 6, "length of short names generated by /.api/v1/shorten")
+	linkHeaders        = flag.String("link-headers", "Cache-Control,X-Robots-Tag", "comma-separated response headers that links may set on their redirects")
+	tagParamsConfig    = flag.String("tag-params", "", `semicolon-separated query parameters appended to the targets of links with a tag, such as "marketing=utm_source=golink&utm_medium={{.Path}}"`)
+	protectedLinksFlag = flag.String("protected-links", "", `comma-separated links that only admins may create, edit, or delete, with a trailing "*" matching a prefix (e.g. "wiki,eng.*")`)
+	tagTeamsConfig     = flag.String("tag-teams", "", `comma-separated tag=team pairs; links created from nodes with the ACL tag are owned by the team and placed in its namespace (e.g. "tag:ci=sre")`)
+	idNormalization    = flag.String("id-normalization", "legacy", `how short names map to link IDs: "legacy" (ignore case and hyphens), "strict" (exact), or "fold" (also fold case variants such as final sigma, and ignore all dashes); run "golink migrate-ids" after changing it`)
+	checkNormalization = flag.String("check-normalization", "", `if set, comma-separated proposed link ID normalization rules ("underscore", "dot") to report short name collisions for at startup`)
+
+	resolveNormalization = flag.String("resolve-normalization", "", `if set, comma-separated link ID normalization rules ("underscore", "dot") used to find links for short names that don't match exactly; visitors choose when several links match`)
+	searchWeightsConfig  = flag.String("search-weights", "clicks=1,recency=1,prefix=2,owner=1", `comma-separated weights of the signals ranking search results with sort=score: "clicks", "recency", "prefix" (short name matches a search term), and "owner" (link owned by the searcher)`)
+	deleteCooldown       = flag.Duration("delete-cooldown", 7*24*time.Hour, "how long after a link is deleted only its previous owner, whoever deleted it, or an admin may create a link with the same short name (0 to disable)")
+	publicDisclaimer     = flag.String("public-disclaimer", "", "if set, text such as a legal disclaimer shown to visitors of --public-hostname on a page before they continue to a link's destination; override public-interstitial.html in --template-dir to brand the page")
+	reservedNames        = flag.String("reserved-names", "", "comma-separated short names, such as api or metrics, that links may never be created with, in addition to those reserved with /.api/v1/reserved-names")
+	allowedSchemes       = flag.String("allowed-schemes", "http,https", "comma-separated URL schemes that link destinations may use, such as http,https,slack")
+	linkCheckSMTP        = flag.String("link-check-smtp", "", "host:port of an SMTP relay used to email owners when the dead link checker finds their links broken; owners are not emailed if empty")
+	linkCheckFrom        = flag.String("link-check-from", "golink@localhost", "sender address of dead link emails, for --link-check-smtp")
+	statsTimezone        = flag.String("stats-timezone", "UTC", "IANA time zone, such as America/New_York, whose midnights divide click stats into days")
+	linkCheckUserAgent   = flag.String("link-check-user-agent", "golink-link-checker", "User-Agent sent by the dead link checker, also matched against robots.txt groups")
+	linkCheckPerHost     = flag.Int("link-check-per-host", 2, "maximum concurrent dead link checks against a single host")
+	linkCheckDelay       = flag.Duration("link-check-delay", time.Second, "minimum delay between dead link checks against a single host; a longer robots.txt Crawl-delay wins")
+	linkCheckAuthFile    = flag.String("link-check-auth-file", "", `if set, file of credentials ("name hosts Header: value" per line) that links' health checks can send to destinations behind authentication`)
+	outboundProxy        = flag.String("outbound-proxy", "", "URL of an HTTP proxy for outbound requests, such as link checks and webhooks, instead of $HTTPS_PROXY and $HTTP_PROXY; $NO_PROXY hosts still bypass it")
+	outboundCAFile       = flag.String("outbound-ca-file", "", "if set, PEM file of CA certificates trusted for outbound requests instead of the system roots")
+	outboundTimeout      = flag.Duration("outbound-timeout", 30*time.Second, "timeout for connecting and for getting response headers in outbound requests")
+	outboundAllow        = flag.String("outbound-allow", "", `if set, comma-separated hosts, or "*.example.com" for subdomains, that outbound requests may be made to; others are refused`)
+	linkCheckWindow      = flag.String("link-check-window", "", "HH:MM-HH:MM window, in --stats-timezone, outside which the dead link checker doesn't run; if set, the checker runs hourly within it")
+	syncFile             = flag.String("sync-file", "", `if set, JSON or YAML (".yaml" or ".yml") manifest of links that the link-sync job creates and updates every 5 minutes; see "golink sync"`)
+	syncPrune            = flag.Bool("sync-prune", false, "delete links with the --sync-file manifest's tag that it no longer lists")
+	homeSectionsConfig   = flag.String("home-sections", "popular", `semicolon-separated sections of links on the home page, in order: "pinned=SHORT,...", "popular", "trending", "yours", "new", and "tag=TAG"; admins can override them with /.api/v1/home-sections`)
 )
 
 var stats struct {
@@ -73,12 +171,57 @@ var stats struct {
 
 	// dirty identifies short link clicks that have not yet been stored.
 	dirty ClickStats
+
+	// external counts the clicks in dirty from visitors to --public-hostname,
+	// which are also stored as the links' ExternalClicks.
+	external ClickStats
+
+	// sources breaks down the clicks in dirty by the path and referrer they
+	// came from, for links where they are known.
+	sources ClickSources
+
+	// queued lists the links in dirty in the order they were added, so that
+	// the oldest can be dropped when the queue is full. It may include links
+	// since removed from dirty.
+	queued []string
+
+	// loading is set while warmStats loads the stored counts, during which
+	// clicks are counted in memory but not flushed.
+	loading bool
+}
+
+// statsLocation is the time zone of --stats-timezone, whose midnights
+// divide click stats into days.
+var statsLocation = time.UTC
+
+// parseStatsTimezone returns the time zone named name, which must be an IANA
+// time zone name such as "America/New_York" or "UTC". The database buckets
+// clicks by day using the name, so "Local" is not allowed.
+func parseStatsTimezone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%q is not an IANA time zone name", name)
+	}
+	return time.LoadLocation(name)
 }
 
+// statsFlushMu serializes flushing stats, which saves them without holding
+// stats.mu so that counting clicks never waits for the database.
+var statsFlushMu sync.Mutex
+
+// statsLoaded is closed once stats.clicks includes the counts stored in db.
+var (
+	statsLoaded     = make(chan struct{})
+	statsLoadedOnce sync.Once
+)
+
 // LastSnapshot is the data snapshot (as returned by the /.export handler)
 // that will be loaded on startup.
 var LastSnapshot []byte
 
+// importOwners rewrites the owners of links restored from LastSnapshot,
+// as configured by --owner-map.
+var importOwners *ownerMap
+
 //go:embed static tmpl/*.html tmpl/*.xml
 var embeddedFS embed.FS
 
@@ -98,6 +241,134 @@ func Run() error {
 
 	hostinfo.SetApp("golink")
 
+	if flag.Arg(0) == "config" {
+		return runConfigCommand(flag.Args()[1:], os.Stdout)
+	}
+	if *configFile != "" {
+		if err := errors.Join(loadConfig(*configFile, flag.CommandLine)...); err != nil {
+			return fmt.Errorf("--config: %w", err)
+		}
+	}
+
+	if flag.Arg(0) == "doctor" {
+		return runDoctor(os.Stdout)
+	}
+	if err := configureOutbound(); err != nil {
+		return err
+	}
+	updateClient = outboundClient(5 * time.Minute)
+	if flag.Arg(0) == "update" {
+		return runUpdate(flag.Args()[1:], os.Stdout)
+	}
+	if flag.Arg(0) == "backup" {
+		return runBackupCommand(flag.Args()[1:], os.Stdout)
+	}
+
+	if v := buildVersion(); *requireFIPS && !v.FIPS140 && !v.BoringCrypto {
+		return errors.New("--require-fips: build with GOFIPS140=v1.0.0 or run with GODEBUG=fips140=on")
+	}
+
+	if err := setIDStrategy(*idNormalization); err != nil {
+		return fmt.Errorf("--id-normalization: %w", err)
+	}
+
+	var err error
+	if namespaceLimits, err = parseNamespaceQuotas(*namespaceQuotas); err != nil {
+		return fmt.Errorf("--namespace-quotas: %w", err)
+	}
+	oidc, err := oidcFlagConfig()
+	if err != nil {
+		return fmt.Errorf("--oidc-client-secret-file: %w", err)
+	}
+	if identity, err = newIdentityProvider(*identityMode, *identityHeader, *trustedProxies, oidc); err != nil {
+		return fmt.Errorf("--identity: %w", err)
+	}
+	var fileTokens map[string]string
+	if *apiTokensFile != "" {
+		f, err := os.Open(*apiTokensFile)
+		if err != nil {
+			return fmt.Errorf("--api-tokens-file: %w", err)
+		}
+		fileTokens, err = parseAPITokens(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("--api-tokens-file: %w", err)
+		}
+	}
+	if *statsDropPolicy != "newest" && *statsDropPolicy != "oldest" {
+		return fmt.Errorf(`--stats-drop-policy: want "newest" or "oldest", got %q`, *statsDropPolicy)
+	}
+	slo, err := parseSLOConfig(*sloSpec)
+	if err != nil {
+		return fmt.Errorf("--slo: %w", err)
+	}
+	resolveSLO.configure(slo)
+	if *webhooksFile != "" {
+		f, err := os.Open(*webhooksFile)
+		if err != nil {
+			return fmt.Errorf("--webhooks-file: %w", err)
+		}
+		hooks, err := parseWebhooks(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("--webhooks-file: %w", err)
+		}
+		webhooks = newWebhookDispatcher(hooks)
+	}
+	// tokens created with /.api/v1/tokens are accepted with any provider
+	identity = tokenIdentity{tokens: fileTokens, next: identity}
+	adminLogins = parseAdminLogins(*admins)
+	if autoShorts, err = newRandomShorts(*autoShortAlphabet, *autoShortLength); err != nil {
+		return fmt.Errorf("--auto-short-alphabet: %w", err)
+	}
+	if allowedLinkHeaders, err = parseHeaderAllowlist(*linkHeaders); err != nil {
+		return fmt.Errorf("--link-headers: %w", err)
+	}
+	if tagParams, err = parseTagParams(*tagParamsConfig); err != nil {
+		return fmt.Errorf("--tag-params: %w", err)
+	}
+	if tagTeams, err = parseTagTeams(*tagTeamsConfig); err != nil {
+		return fmt.Errorf("--tag-teams: %w", err)
+	}
+	if protectedLinks, err = parseLinkPatterns(*protectedLinksFlag); err != nil {
+		return fmt.Errorf("--protected-links: %w", err)
+	}
+	if searchWeights, err = parseScoreWeights(*searchWeightsConfig); err != nil {
+		return fmt.Errorf("--search-weights: %w", err)
+	}
+	if flagHomeSections, err = parseHomeSections(*homeSectionsConfig); err != nil {
+		return fmt.Errorf("--home-sections: %w", err)
+	}
+	if statsLocation, err = parseStatsTimezone(*statsTimezone); err != nil {
+		return fmt.Errorf("--stats-timezone: %w", err)
+	}
+	if *linkCheckWindow != "" {
+		if linkCheckHours, err = parseDailyWindow(*linkCheckWindow); err != nil {
+			return fmt.Errorf("--link-check-window: %w", err)
+		}
+	}
+	if *linkCheckAuthFile != "" {
+		f, err := os.Open(*linkCheckAuthFile)
+		if err != nil {
+			return fmt.Errorf("--link-check-auth-file: %w", err)
+		}
+		linkCheckAuth, err = parseLinkCheckAuth(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("--link-check-auth-file: %w", err)
+		}
+	}
+	if *auditExport != "" {
+		if auditLog, err = newAuditExporter(*auditExport, *auditFormat); err != nil {
+			return fmt.Errorf("--audit-export: %w", err)
+		}
+	}
+	if *templateDir != "" {
+		if err := loadTemplateOverrides(os.DirFS(*templateDir)); err != nil {
+			return fmt.Errorf("--template-dir: %w", err)
+		}
+	}
+
 	log.Println("DEBUG: About to check snapshot flag")
 	if *snapshot != "" {
 		log.Printf("DEBUG: --snapshot flag is set to: %q", *snapshot)
@@ -114,8 +385,24 @@ func Run() error {
 		log.Println("DEBUG: --snapshot flag is empty, skipping snapshot read.")
 	}
 
-	if err := restoreLastSnapshot(); err != nil {
-		log.Printf("restoring snapshot: %v", err)
+	if *ownerMapFile != "" {
+		f, err := os.Open(*ownerMapFile)
+		if err != nil {
+			return fmt.Errorf("--owner-map: %w", err)
+		}
+		importOwners, err = parseOwnerMap(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("--owner-map: %w", err)
+		}
+	}
+
+	switch *storeBackend {
+	case "postgres":
+	case "redis":
+		return runLinkStore()
+	default:
+		return fmt.Errorf(`--store: want "postgres" or "redis", got %q`, *storeBackend)
 	}
 
 	if *pgDSN == "" {
@@ -128,7 +415,44 @@ func Run() error {
 		}
 	}
 
-	var err error
+	if *dbMaxOpenConns > 0 && *dbMaxOpenConns < minOpenConns {
+		return fmt.Errorf("--db-max-open-conns must be 0 or at least %d", minOpenConns)
+	}
+	// fetched before connecting, since the database may be slow to accept
+	// connections while replicas are starting
+	var warmLinks []*Link
+	if *warmFrom != "" {
+		if *linkCacheSize == 0 {
+			return errors.New("--warm-from requires --link-cache-size")
+		}
+		var token string
+		if *warmTokenFile != "" {
+			b, err := os.ReadFile(*warmTokenFile)
+			if err != nil {
+				return fmt.Errorf("--warm-from-token-file: %w", err)
+			}
+			token = strings.TrimSpace(string(b))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), warmTimeout)
+		warmLinks, err = fetchPeerLinks(ctx, outboundClient(0), *warmFrom, token, *linkCacheSize)
+		cancel()
+		if err != nil {
+			// start with the links fetched so far, if any
+			log.Printf("--warm-from: %v", err)
+		}
+		log.Printf("fetched %d links from %s", len(warmLinks), *warmFrom)
+	}
+	// serve the warmed links while connecting to the database, unless
+	// running a command rather than the server
+	var warming *warmHandler
+	serveErr := make(chan error, 1)
+	if len(warmLinks) > 0 && flag.NArg() == 0 && !*migrateOnly {
+		warming = newWarmHandler(warmLinks)
+		go func() {
+			serveErr <- serveListeners(func() http.Handler { return warming })
+		}()
+	}
+
 	log.Printf("DEBUG: About to call NewPostgresDB with DSN: %q", *pgDSN)
 	db, err = NewPostgresDB(*pgDSN)
 	if err != nil {
@@ -136,20 +460,85 @@ func Run() error {
 		return fmt.Errorf("NewPostgresDB(%q): %w", *pgDSN, err)
 	}
 	log.Println("DEBUG: NewPostgresDB call successful")
+	db.SetPoolSize(*dbMaxOpenConns, *dbMaxIdleConns)
+	if *linkCacheSize > 0 {
+		db.EnableCache(*linkCacheSize, *linkCacheTTL)
+		db.cache.warm(warmLinks, db.Now())
+	}
+	if *redisURL != "" {
+		r, err := NewRedisDB(*redisURL, "golink:", *redisTTL)
+		if err != nil {
+			return fmt.Errorf("--redis-url: %w", err)
+		}
+		db.EnableRedis(r)
+	}
+	if *migrateOnly {
+		return nil
+	}
+	go db.ListenForChanges(context.Background())
+	if flag.Arg(0) == "migrate-ids" {
+		return runMigrateIDsCommand(flag.Args()[1:], os.Stdout)
+	}
+	if err := checkIDVersions(); err != nil {
+		return err
+	}
 
-	log.Println("DEBUG: About to call initStats()")
-	if err := initStats(); err != nil {
-		log.Printf("ERROR: initStats failed: %v", err)
-		// Potentially return err here if initStats failure is critical before tsnet
-	} else {
-		log.Println("DEBUG: initStats() completed successfully")
+	// restored links are saved to the database, so it must be open
+	if err := restoreLastSnapshot(); err != nil {
+		log.Printf("restoring snapshot: %v", err)
+	}
+
+	if *ownerKeyFile != "" {
+		b, err := os.ReadFile(*ownerKeyFile)
+		if err != nil {
+			return fmt.Errorf("--owner-key-file: %w", err)
+		}
+		if ownerKey, err = parseOwnerKey(b); err != nil {
+			return fmt.Errorf("--owner-key-file: %w", err)
+		}
+		if !*readonly {
+			if err := pseudonymizeOwners(); err != nil {
+				return fmt.Errorf("pseudonymizing owners: %w", err)
+			}
+		}
+	}
+
+	if *checkNormalization != "" {
+		if err := logCollisions(*checkNormalization); err != nil {
+			return fmt.Errorf("--check-normalization: %w", err)
+		}
+	}
+	if *resolveNormalization != "" {
+		if err := setResolveNormalization(*resolveNormalization); err != nil {
+			return fmt.Errorf("--resolve-normalization: %w", err)
+		}
+	}
+
+	warmStats()
+
+	if flag.Arg(0) == "migrate-from" {
+		return runMigrateFromCommand(flag.Args()[1:], os.Stdout)
+	}
+	if flag.Arg(0) == "sync" {
+		return runSyncCommand(flag.Args()[1:], os.Stdout)
+	}
+	if flag.Arg(0) == "export-site" {
+		if flag.NArg() != 2 {
+			return errors.New("usage: golink export-site DIR")
+		}
+		n, err := exportSite(flag.Arg(1))
+		if err != nil {
+			return fmt.Errorf("export-site: %w", err)
+		}
+		log.Printf("exported %d links to %s", n, flag.Arg(1))
+		return nil
 	}
 
 	// if link specified on command line, resolve and exit
 	log.Printf("DEBUG: Checking flag.Args(), length: %d, Args: %v", len(flag.Args()), flag.Args())
 	if len(flag.Args()) > 0 {
 		log.Printf("DEBUG: flag.Args() is > 0, processing link: %s", flag.Arg(0))
-		link, err := db.Load(flag.Arg(0))
+		link, err := loadLink(flag.Arg(0))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -158,9 +547,33 @@ func Run() error {
 	}
 	log.Println("DEBUG: flag.Args() block passed or not entered")
 
-	// flush stats periodically
-	go flushStatsLoop()
+	if err := setupPublicCerts(); err != nil {
+		return err
+	}
+
+	registerJobs()
+	if err := configureJobs(*jobsConfig); err != nil {
+		return fmt.Errorf("--jobs: %w", err)
+	}
+	startJobs(context.Background())
+
+	if publicCerts != nil {
+		if err := servePublicHost(); err != nil {
+			return fmt.Errorf("--public-listen: %w", err)
+		}
+	}
+
+	if warming != nil {
+		warming.ready(serveHandler())
+		return <-serveErr
+	}
+	return serveListeners(serveHandler)
+}
 
+// serveListeners serves handlers made by newHandler on --dev-listen, or on
+// the tailnet as --hostname, and on --grpc-listen if it is set. It only
+// returns on error.
+func serveListeners(newHandler func() http.Handler) error {
 	if *devListen != "" {
 		actualListenAddr := *devListen
 		if *devListen == ":ENV" {
@@ -182,8 +595,22 @@ func Run() error {
 			}
 		}
 
+		probeAddr := actualListenAddr
+		if h, p, err := net.SplitHostPort(actualListenAddr); err == nil && (h == "" || h == "0.0.0.0") {
+			probeAddr = net.JoinHostPort("localhost", p)
+		}
+		addProbeTarget("dev", "http://"+probeAddr, http.DefaultClient)
+
+		if *grpcListen != "" {
+			ln, err := net.Listen("tcp", *grpcListen)
+			if err != nil {
+				return fmt.Errorf("--grpc-listen: %w", err)
+			}
+			go serveGRPC(ln, newHandler())
+		}
+
 		log.Printf("Running in dev mode on %s ...", actualListenAddr)
-		log.Fatal(http.ListenAndServe(actualListenAddr, serveHandler()))
+		log.Fatal(http.ListenAndServe(actualListenAddr, newHandler()))
 	}
 
 	if *hostname == "" {
@@ -210,6 +637,8 @@ func Run() error {
 	log.Println("DEBUG: tsnet.Server.Start() successful")
 
 	localClient, _ = srv.LocalClient()
+	// dial through the tailnet so that links to tailnet hosts can be checked
+	linkCheckClient = &http.Client{Transport: outbound.newTransport(srv.Dial)}
 out:
 	for {
 		upCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -229,7 +658,15 @@ out:
 	enableTLS := *useHTTPS && status.Self.HasCap(tailcfg.CapabilityHTTPS) && len(srv.CertDomains()) > 0
 	fqdn := strings.TrimSuffix(status.Self.DNSName, ".")
 
-	httpHandler := serveHandler()
+	httpHandler := newHandler()
+	if *grpcListen != "" {
+		// calls are encrypted by the tailnet, like those to the HTTP listener
+		ln, err := srv.Listen("tcp", *grpcListen)
+		if err != nil {
+			return fmt.Errorf("--grpc-listen: %w", err)
+		}
+		go serveGRPC(ln, httpHandler)
+	}
 	if enableTLS {
 		httpsHandler := HSTS(httpHandler)
 		httpHandler = redirectHandler(fqdn)
@@ -239,6 +676,7 @@ out:
 			return err
 		}
 		log.Println("Listening on :443")
+		addProbeTarget("https", "https://"+fqdn, srv.HTTPClient())
 		go func() {
 			log.Printf("Serving https://%s/ ...", fqdn)
 			if err := http.Serve(httpsListener, httpsHandler); err != nil {
@@ -252,6 +690,10 @@ out:
 	if err != nil {
 		return err
 	}
+	if !enableTLS {
+		// with TLS, the HTTP listener only redirects to HTTPS
+		addProbeTarget("http", "http://"+fqdn, srv.HTTPClient())
+	}
 	log.Printf("Serving http://%s/ ...", *hostname)
 	if err := http.Serve(httpListener, httpHandler); err != nil {
 		return err
@@ -282,6 +724,34 @@ var (
 
 	// opensearchTmpl is the template used by the http://go/.opensearch page
 	opensearchTmpl *template.Template
+
+	// deprecatedTmpl is the interstitial page shown when resolving a deprecated link.
+	deprecatedTmpl *template.Template
+
+	// teamsTmpl is the template used by the http://go/.teams page
+	teamsTmpl *template.Template
+
+	// teamTmpl is the template used by the http://go/.team/{name} page
+	teamTmpl *template.Template
+
+	// errorTmpl is the default template used for error pages.
+	errorTmpl *template.Template
+
+	// smartListTmpl is the template used by the http://go/.lists/{name} page
+	smartListTmpl *template.Template
+
+	// adminTmpl is the template used by the http://go/.admin page
+	adminTmpl *template.Template
+
+	// dashboardTmpl is the template used by the http://go/.dashboard page
+	dashboardTmpl *template.Template
+
+	// ambiguousTmpl is the page listing the links a short name may refer to.
+	ambiguousTmpl *template.Template
+
+	// publicInterstitialTmpl is the page shown to visitors of --public-hostname
+	// before they continue to a link, if --public-disclaimer is set.
+	publicInterstitialTmpl *template.Template
 )
 
 type visitData struct {
@@ -293,9 +763,39 @@ type visitData struct {
 type homeData struct {
 	Short    string
 	Long     string
-	Clicks   []visitData
 	XSRF     string
 	ReadOnly bool
+
+	// Suggestions are existing links that may be what was meant by a
+	// missing Short, with similar names or found using the synonym
+	// dictionary.
+	Suggestions []*Link
+
+	// Sections are the configured sections of links shown to the current
+	// user, in order.
+	Sections []homeSectionData
+
+	// StarterPacks are curated links presented to first-time visitors.
+	StarterPacks []*Collection
+
+	// SmartLists are the current user's saved link queries. ListsXSRF is
+	// only set for known users, who can save smart lists.
+	SmartLists []*SmartList
+	ListsXSRF  string
+
+	// Tag is set when browsing the links with a tag, which are listed in
+	// TagLinks a page at a time.
+	Tag      string
+	TagLinks []*Link
+	pagination
+}
+
+// deprecatedData is the data used by deprecatedTmpl.
+type deprecatedData struct {
+	Short     string
+	Successor string
+	Target    string    // expanded destination of the deprecated link
+	Until     time.Time // when the link starts redirecting to Successor
 }
 
 // deleteData is the data used by deleteTmpl.
@@ -308,6 +808,16 @@ type deleteData struct {
 var xsrfKey string
 
 func init() {
+	loadTemplates()
+
+	b := make([]byte, 24)
+	rand.Read(b)
+	xsrfKey = base64.StdEncoding.EncodeToString(b)
+}
+
+// loadTemplates parses all page templates, applying any overrides from
+// --template-dir. It panics if unable to parse a template.
+func loadTemplates() {
 	homeTmpl = newTemplate("base.html", "home.html")
 	detailTmpl = newTemplate("base.html", "detail.html")
 	successTmpl = newTemplate("base.html", "success.html")
@@ -315,22 +825,31 @@ func init() {
 	allTmpl = newTemplate("base.html", "all.html")
 	deleteTmpl = newTemplate("base.html", "delete.html")
 	opensearchTmpl = newTemplate("opensearch.xml")
-
-	b := make([]byte, 24)
-	rand.Read(b)
-	xsrfKey = base64.StdEncoding.EncodeToString(b)
+	deprecatedTmpl = newTemplate("base.html", "deprecated.html")
+	teamsTmpl = newTemplate("base.html", "teams.html")
+	teamTmpl = newTemplate("base.html", "team.html")
+	errorTmpl = newTemplate("base.html", "error.html")
+	smartListTmpl = newTemplate("base.html", "smartlist.html")
+	adminTmpl = newTemplate("base.html", "admin.html")
+	dashboardTmpl = newTemplate("base.html", "dashboard.html")
+	ambiguousTmpl = newTemplate("base.html", "ambiguous.html")
+	publicInterstitialTmpl = newTemplate("public-interstitial.html")
+	customErrorTmpls = loadCustomErrorTemplates()
 }
 
 var tmplFuncs = template.FuncMap{
 	// go is a template function that returns the hostname of the golink service.
 	// This is used throughout the UI to render links, but does not impact link resolution.
-	"go": func() string {
-		if devMode() {
-			// in dev mode, just use "go" instead of "localhost:8080"
-			return defaultHostname
-		}
-		return *hostname
-	},
+	"go": goHostname,
+}
+
+// goHostname returns the hostname that links are shown with, such as "go".
+func goHostname() string {
+	if devMode() {
+		// in dev mode, just use "go" instead of "localhost:8080"
+		return defaultHostname
+	}
+	return *hostname
 }
 
 // newTemplate creates a new template with the specified files in the tmpl directory.
@@ -346,70 +865,262 @@ func newTemplate(files ...string) *template.Template {
 		tf = append(tf, "tmpl/"+f)
 	}
 	t := template.New(files[0]).Funcs(tmplFuncs)
-	return template.Must(t.ParseFS(embeddedFS, tf...))
+	return template.Must(t.ParseFS(templateFS(), tf...))
 }
 
 // initStats initializes the in-memory stats counter with counts from db.
+// Clicks counted while warmStats is loading them, which have not been
+// flushed, are added to the stored counts; otherwise they are discarded.
 func initStats() error {
-	log.Println("DEBUG: initStats() called")
-	stats.mu.Lock()
-	defer stats.mu.Unlock()
-
 	clicks, err := db.LoadStats()
 	if err != nil {
 		log.Printf("ERROR: db.LoadStats() returned error: %v", err)
 		return err
 	}
 	if clicks == nil {
-		log.Println("DEBUG: db.LoadStats() returned nil clicks map, initializing to empty map")
 		clicks = make(ClickStats)
 	}
 
-	log.Println("DEBUG: initStats - BEFORE stats.clicks = clicks")
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.loading {
+		for short, n := range stats.dirty {
+			clicks[short] += n
+		}
+	}
+	if !stats.loading || stats.dirty == nil {
+		stats.dirty = make(ClickStats)
+		stats.external = nil
+		stats.sources = nil
+		stats.queued = nil
+	}
 	stats.clicks = clicks
-	log.Println("DEBUG: initStats - AFTER stats.clicks = clicks, BEFORE stats.dirty = make(ClickStats)")
-	stats.dirty = make(ClickStats)
-	log.Println("DEBUG: initStats - AFTER stats.dirty = make(ClickStats)")
-
+	stats.loading = false
+	statsLoadedOnce.Do(func() { close(statsLoaded) })
 	return nil
 }
 
+// warmStats loads the stored click counts in the background, so that golink
+// serves links and renders its home page while the Stats aggregate query
+// runs. Clicks are not flushed until it finishes, so that none are counted
+// twice. If the counts can't be loaded, only clicks since startup are shown.
+func warmStats() {
+	stats.mu.Lock()
+	stats.loading = true
+	stats.mu.Unlock()
+
+	go func() {
+		start := time.Now()
+		if err := initStats(); err != nil {
+			stats.mu.Lock()
+			stats.loading = false
+			stats.mu.Unlock()
+			statsLoadedOnce.Do(func() { close(statsLoaded) })
+			return
+		}
+		log.Printf("loaded click stats in %v", time.Since(start).Round(time.Millisecond))
+	}()
+}
+
+// clickBatch is a flush of click stats, saved with db.SaveClickBatch.
+type clickBatch struct {
+	key      string
+	clicks   ClickStats
+	external ClickStats
+	sources  ClickSources
+}
+
+// statsInDoubt is the last batch of clicks whose save failed, which may
+// have been saved anyway if the failure came while committing. The next
+// flush checks whether it was saved before requeueing its clicks, so that
+// they aren't counted twice. It is guarded by statsFlushMu.
+var statsInDoubt *clickBatch
+
+// forgetLink removes the clicks of the link short from b.
+func (b *clickBatch) forgetLink(short string) {
+	delete(b.clicks, short)
+	delete(b.external, short)
+	delete(b.sources, short)
+}
+
+// mergeLink moves the clicks of the link from in b to into, so that they
+// are requeued for into if b wasn't saved.
+func (b *clickBatch) mergeLink(from, into string) {
+	if n, ok := b.clicks[from]; ok {
+		b.clicks[into] += n
+	}
+	if n, ok := b.external[from]; ok {
+		b.external[into] += n
+	}
+	if sources, ok := b.sources[from]; ok {
+		if b.sources[into] == nil {
+			b.sources[into] = make(map[ClickSource]int)
+		}
+		for src, n := range sources {
+			b.sources[into][src] += n
+		}
+	}
+	b.forgetLink(from)
+}
+
 // flushStats writes any pending link stats to db.
 func flushStats() error {
-	stats.mu.Lock()
-	defer stats.mu.Unlock()
+	statsFlushMu.Lock()
+	defer statsFlushMu.Unlock()
+
+	if b := statsInDoubt; b != nil {
+		saved, err := db.ClickBatchSaved(b.key)
+		if err != nil {
+			return err
+		}
+		statsInDoubt = nil
+		if saved {
+			publishFlush(b.clicks)
+		} else {
+			requeueClicks(b.clicks, b.external, b.sources)
+		}
+	}
 
-	if len(stats.dirty) == 0 {
+	stats.mu.Lock()
+	if len(stats.dirty) == 0 && len(stats.external) == 0 || stats.loading {
+		stats.mu.Unlock()
 		return nil
 	}
+	dirty, external, sources := stats.dirty, stats.external, stats.sources
+	stats.dirty = make(ClickStats)
+	stats.external = nil
+	stats.sources = nil
+	stats.queued = nil
+	stats.mu.Unlock()
 
-	if err := db.SaveStats(stats.dirty); err != nil {
+	b := &clickBatch{key: rand.Text(), clicks: dirty, external: external, sources: sources}
+	if err := db.SaveClickBatch(b.key, dirty, sources, external); err != nil {
+		statsInDoubt = b
 		return err
 	}
-	stats.dirty = make(ClickStats)
+	publishFlush(dirty)
 	return nil
 }
 
-// flushStatsLoop will flush stats every minute.  This function never returns.
-func flushStatsLoop() {
-	for {
-		if err := flushStats(); err != nil {
-			log.Printf("flushing stats: %v", err)
+// requeueClicks returns clicks that failed to be saved to the queue, along
+// with those of them that were external and their sources, to be saved by
+// the next flush. Clicks of links that no longer fit in the queue are
+// dropped.
+func requeueClicks(failed, external ClickStats, sources ClickSources) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	for short, n := range external {
+		if stats.external == nil {
+			stats.external = make(ClickStats)
+		}
+		stats.external[short] += n
+	}
+	// the failed clicks are older than any queued since
+	queued := make([]string, 0, len(failed)+len(stats.queued))
+	for _, short := range slices.Sorted(maps.Keys(failed)) {
+		n := failed[short]
+		if _, ok := stats.dirty[short]; !ok {
+			if limit := *statsQueueSize; limit > 0 && len(stats.dirty) >= limit {
+				dropClicks(short, n)
+				continue
+			}
+			queued = append(queued, short)
 		}
-		time.Sleep(time.Minute)
+		stats.dirty[short] += n
+		addClickSources(short, sources[short])
+	}
+	stats.queued = append(queued, stats.queued...)
+}
+
+// dropOldestClicks discards the unsaved clicks of the link that has been
+// queued longest, to make room for another. stats.mu must be held.
+func dropOldestClicks() {
+	for len(stats.queued) > 0 {
+		short := stats.queued[0]
+		stats.queued = stats.queued[1:]
+		if n, ok := stats.dirty[short]; ok {
+			delete(stats.dirty, short)
+			dropClicks(short, n)
+			return
+		}
+	}
+}
+
+// dropClicks uncounts n unsaved clicks of short that will never be saved,
+// which are all of its unsaved clicks. stats.mu must be held.
+func dropClicks(short string, n int) {
+	if stats.clicks[short] -= n; stats.clicks[short] <= 0 {
+		delete(stats.clicks, short)
+	}
+	delete(stats.external, short)
+	delete(stats.sources, short)
+	statsDroppedClicks.Add(int64(n))
+}
+
+// addClickSources adds clicks from sources to the unsaved sources of short.
+// stats.mu must be held.
+func addClickSources(short string, sources map[ClickSource]int) {
+	if len(sources) == 0 {
+		return
+	}
+	if stats.sources == nil {
+		stats.sources = make(ClickSources)
+	}
+	if stats.sources[short] == nil {
+		stats.sources[short] = make(map[ClickSource]int)
+	}
+	for src, n := range sources {
+		stats.sources[short][src] += n
 	}
 }
 
 // deleteLinkStats removes the link stats from memory.
 func deleteLinkStats(link *Link) {
+	// wait for any flush, so that it can't requeue the link's clicks
+	statsFlushMu.Lock()
+	defer statsFlushMu.Unlock()
+
 	stats.mu.Lock()
 	delete(stats.clicks, link.Short)
 	delete(stats.dirty, link.Short)
+	delete(stats.external, link.Short)
+	delete(stats.sources, link.Short)
 	stats.mu.Unlock()
+	if statsInDoubt != nil {
+		statsInDoubt.forgetLink(link.Short)
+	}
 
 	db.DeleteStats(link.Short)
 }
 
+// mergeLinkStats moves the in-memory click stats of from to into.
+func mergeLinkStats(from, into *Link) {
+	statsFlushMu.Lock()
+	defer statsFlushMu.Unlock()
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	if n, ok := stats.clicks[from.Short]; ok {
+		stats.clicks[into.Short] += n
+		delete(stats.clicks, from.Short)
+	}
+	if n, ok := stats.dirty[from.Short]; ok {
+		stats.dirty[into.Short] += n
+		delete(stats.dirty, from.Short)
+	}
+	if n, ok := stats.external[from.Short]; ok {
+		stats.external[into.Short] += n
+		delete(stats.external, from.Short)
+	}
+	if sources, ok := stats.sources[from.Short]; ok {
+		delete(stats.sources, from.Short)
+		addClickSources(into.Short, sources)
+	}
+	if statsInDoubt != nil {
+		statsInDoubt.mergeLink(from.Short, into.Short)
+	}
+}
+
 // redirectHandler returns the http.Handler for serving all plaintext HTTP
 // requests. It redirects all requests to the HTTPs version of the same URL.
 func redirectHandler(hostname string) http.Handler {
@@ -453,24 +1164,114 @@ func serveHandler() http.Handler {
 	mux.HandleFunc("/.help", serveHelp)
 	mux.HandleFunc("/.opensearch", serveOpenSearch)
 	mux.HandleFunc("/.all", serveAll)
+	mux.HandleFunc("/.popular", servePopular)
 	mux.HandleFunc("/.delete/", serveDelete)
+	mux.HandleFunc("/.merge", serveMerge)
+	mux.HandleFunc("/.teams", serveTeams)
+	mux.HandleFunc("/.team/", serveTeam)
+	mux.HandleFunc("/.packs/", serveStarterPacks)
+	mux.HandleFunc("/.target-health", serveTargetHealth)
+	mux.HandleFunc("/.maintenance", serveMaintenance)
+	mux.HandleFunc("/.api/v1/links", serveAPILinks)
+	mux.HandleFunc("/.api/v1/links/", serveAPILink)
+	mux.HandleFunc("/.api/v1/resolve", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveResolve)
+	})
+	mux.HandleFunc("/.api/v1/version", serveVersion)
+	mux.HandleFunc("/.api/v1/jobs", serveJobs)
+	mux.HandleFunc("/.api/v1/webhooks", serveWebhooks)
+	mux.HandleFunc("/.api/v1/update", serveUpdateCheck)
+	mux.HandleFunc("/.api/v1/shorten", serveShorten)
+	mux.HandleFunc("/.api/v1/share", serveShare)
+	mux.HandleFunc("/.api/v1/import", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveImport)
+	})
+	mux.HandleFunc("/.api/v1/bulk-delete", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveBulkDelete)
+	})
+	mux.HandleFunc("/.api/v1/tokens", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveTokens)
+	})
+	mux.HandleFunc("/.api/v1/tokens/", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveToken)
+	})
+	mux.HandleFunc("/.api/v1/synonyms", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveSynonyms)
+	})
+	mux.HandleFunc("/.api/v1/synonyms/", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveSynonyms)
+	})
+	mux.HandleFunc("/.api/v1/reserved-names", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveReservedNames)
+	})
+	mux.HandleFunc("/.api/v1/reserved-names/", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveReservedNames)
+	})
+	mux.HandleFunc("/.api/v1/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveDashboardAPI)
+	})
+	mux.HandleFunc("/.api/v1/dashboard/stream", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveDashboardStream)
+	})
+	mux.HandleFunc("/.api/v1/stats/stream", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveStatsStream)
+	})
+	mux.HandleFunc("/.api/v1/teams/", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveTeamExport)
+	})
+	mux.HandleFunc("/.api/v1/owners/", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveOwnerTransfer)
+	})
+	mux.HandleFunc("/.api/v1/home", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveHomeAPI)
+	})
+	mux.HandleFunc("/.api/v1/home-sections", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveHomeSections)
+	})
+	mux.HandleFunc("/.api/v1/sync", func(w http.ResponseWriter, r *http.Request) {
+		serveAPI(w, r, 0, serveSync)
+	})
+	mux.HandleFunc("/.metrics", varz.Handler)
+	mux.HandleFunc("/.lists", serveSmartLists)
+	mux.HandleFunc("/.lists/", serveSmartList)
+	mux.HandleFunc("/.owners", serveOwnerLookup)
+	mux.HandleFunc("/.history/", serveHistory)
+	mux.HandleFunc("/.collisions", serveCollisions)
+	mux.HandleFunc("/.admin", serveAdmin)
+	mux.HandleFunc("/.dashboard", serveDashboard)
+	mux.HandleFunc("/.qr/", serveQR)
 	mux.Handle("/.static/", http.StripPrefix("/.", http.FileServer(http.FS(embeddedFS))))
 	mux.HandleFunc("/healthz", handleHealthCheck)
+	mux.HandleFunc("/readyz", handleReadyCheck)
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// all internal URLs begin with a leading "."; any other URL is treated as a go link.
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// all internal URLs begin with a leading ".", except for the health
+		// checks; any other URL is treated as a go link.
 		// Serve go links directly without passing through the ServeMux,
 		// which sometimes modifies the request URL path, which we don't want.
-		if !strings.HasPrefix(r.URL.Path, "/.") {
-			serveGo(w, r)
+		if !strings.HasPrefix(r.URL.Path, "/.") && r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+			if r.URL.Path == "/" {
+				serveGo(w, r)
+			} else {
+				trackResolve(w, r)
+			}
 			return
 		}
 		mux.ServeHTTP(w, r)
 	})
+	h = checkTokenScopes(h)
+	if o := oidcLogin(identity); o != nil {
+		h = o.requireLogin(h)
+	}
+	return h
 }
 
-func serveHome(w http.ResponseWriter, r *http.Request, short string) {
-	var clicks []visitData
+// maxPopularLinks is the number of links listed as popular.
+const maxPopularLinks = 200
+
+// popularLinks returns the most clicked links, most popular first.
+func popularLinks() []visitData {
+	clicks := []visitData{}
 
 	stats.mu.Lock()
 	for short, numClicks := range stats.clicks {
@@ -487,10 +1288,27 @@ func serveHome(w http.ResponseWriter, r *http.Request, short string) {
 		}
 		return clicks[i].Short < clicks[j].Short
 	})
-	if len(clicks) > 200 {
-		clicks = clicks[:200]
+	if len(clicks) > maxPopularLinks {
+		clicks = clicks[:maxPopularLinks]
+	}
+	return clicks
+}
+
+// servePopular serves the popular links on the home page as JSON. If the
+// stored click counts are still loading, it waits for them, so that the home
+// page can be rendered without them and fill them in when they arrive.
+func servePopular(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-statsLoaded:
+	case <-r.Context().Done():
+		http.Error(w, "click counts are still loading", http.StatusServiceUnavailable)
+		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(popularLinks())
+}
 
+func serveHome(w http.ResponseWriter, r *http.Request, short string) {
 	var long string
 	if short != "" && localClient != nil {
 		// if a peer exists with the short name, suggest it as the long URL
@@ -505,21 +1323,127 @@ func serveHome(w http.ResponseWriter, r *http.Request, short string) {
 		}
 	}
 
+	var suggestions []*Link
+	if short != "" {
+		suggestions = suggestLinks(short)
+	}
+
+	// list the links with a tag when browsing from one of them
+	var tag string
+	var tagLinks []*Link
+	var tagPages pagination
+	if short == "" {
+		tag = strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	}
+	if tag != "" {
+		links, err := db.LoadByTag(tag)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// one-time links are for sharing with specific people, not browsing
+		links = slices.DeleteFunc(links, func(l *Link) bool { return l.MaxUses > 0 })
+		sort.Slice(links, func(i, j int) bool {
+			return links[i].Short < links[j].Short
+		})
+		tagLinks, tagPages = paginate(r, links)
+	}
+
+	// present starter packs on the plain home page to first-time visitors,
+	// or to anyone who asks for them with ?welcome
+	var packs []*Collection
+	if short == "" && tag == "" {
+		if r.URL.Query().Has("welcome") {
+			var err error
+			if packs, err = db.LoadCollections(); err != nil {
+				log.Printf("loading starter packs: %v", err)
+			}
+		} else {
+			packs = firstVisitPacks(w, r)
+		}
+	}
+
 	cu, err := currentUser(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	var lists []*SmartList
+	var listsXSRF string
+	if cu.login != "" {
+		if lists, err = db.LoadSmartLists(cu.login); err != nil {
+			log.Printf("loading smart lists for %q: %v", cu.login, err)
+		}
+		listsXSRF = xsrftoken.Generate(xsrfKey, cu.login, smartListsShortName)
+	}
 	homeTmpl.Execute(w, homeData{
-		Short:    short,
-		Long:     long,
-		Clicks:   clicks,
-		XSRF:     xsrftoken.Generate(xsrfKey, cu.login, newShortName),
-		ReadOnly: *readonly,
+		Short:        short,
+		Long:         long,
+		Suggestions:  suggestions,
+		XSRF:         xsrftoken.Generate(xsrfKey, cu.login, newShortName),
+		ReadOnly:     *readonly,
+		Sections:     loadHomeSections(cu, time.Now()),
+		StarterPacks: packs,
+		SmartLists:   lists,
+		ListsXSRF:    listsXSRF,
+		Tag:          tag,
+		TagLinks:     tagLinks,
+		pagination:   tagPages,
 	})
 }
 
-func serveAll(w http.ResponseWriter, _ *http.Request) {
+// allPageSize is the number of links shown on each page of /.all, and of
+// other pages that list links.
+const allPageSize = 200
+
+// pagination describes the page shown of a list split into pages, which
+// are linked to each other so that they can be browsed without JavaScript.
+type pagination struct {
+	Total            int // number of items on all pages
+	Page             int // 1-based
+	Pages            int
+	PrevURL, NextURL string // adjacent pages, or "" if none
+}
+
+// paginate returns the page of items requested by the page parameter of r,
+// and its pagination. The links to adjacent pages keep the other query
+// parameters of r, such as the sort order.
+func paginate[T any](r *http.Request, items []T) ([]T, pagination) {
+	p := pagination{
+		Total: len(items),
+		Page:  1,
+		Pages: max(1, (len(items)+allPageSize-1)/allPageSize),
+	}
+	if n, err := strconv.Atoi(r.FormValue("page")); err == nil && n > 0 {
+		p.Page = min(n, p.Pages)
+	}
+	pageURL := func(n int) string {
+		q := r.URL.Query()
+		q.Set("page", strconv.Itoa(n))
+		return (&url.URL{Path: r.URL.Path, RawQuery: q.Encode()}).String()
+	}
+	if p.Page > 1 {
+		p.PrevURL = pageURL(p.Page - 1)
+	}
+	if p.Page < p.Pages {
+		p.NextURL = pageURL(p.Page + 1)
+	}
+	start := (p.Page - 1) * allPageSize
+	return items[start:min(start+allPageSize, len(items))], p
+}
+
+// allData is the data used by allTmpl.
+type allData struct {
+	Links []*Link
+	Sort  string // "clicks" to sort by popularity, otherwise by name
+	pagination
+
+	// Broken is the health of the destinations of Links that the dead
+	// link checker found broken, keyed by destination.
+	Broken map[string]*TargetHealth
+}
+
+func serveAll(w http.ResponseWriter, r *http.Request) {
 	if err := flushStats(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -530,11 +1454,19 @@ func serveAll(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// one-time links are for sharing with specific people, not browsing
+	links = slices.DeleteFunc(links, func(l *Link) bool { return l.MaxUses > 0 })
+	sortBy := r.FormValue("sort")
 	sort.Slice(links, func(i, j int) bool {
+		if sortBy == "clicks" && links[i].TotalClicks != links[j].TotalClicks {
+			return links[i].TotalClicks > links[j].TotalClicks
+		}
 		return links[i].Short < links[j].Short
 	})
 
-	allTmpl.Execute(w, links)
+	data := allData{Sort: sortBy, Broken: brokenTargets()}
+	data.Links, data.pagination = paginate(r, links)
+	allTmpl.Execute(w, data)
 }
 
 func serveHelp(w http.ResponseWriter, _ *http.Request) {
@@ -565,17 +1497,41 @@ func serveGo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	link, err := db.Load(short)
+	link, err := loadLink(short)
 	if errors.Is(err, fs.ErrNotExist) {
 		// Trim common punctuation from the end and try again.
 		// This catches auto-linking and copy/paste issues that include punctuation.
 		if s := strings.TrimRight(short, ".,()[]{}"); short != s {
 			short = s
-			link, err = db.Load(short)
+			link, err = loadLink(short)
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) && resolveNormalize != nil {
+		// look for links that differ only by the normalization rules, and
+		// let the visitor choose rather than guessing between several
+		var links []*Link
+		links, err = normalizedLinks(short)
+		switch {
+		case err != nil:
+		case len(links) == 1:
+			link = links[0]
+		case len(links) > 1:
+			serveAmbiguous(w, r, short, remainder, links)
+			return
+		default:
+			err = fs.ErrNotExist
 		}
 	}
 
 	if errors.Is(err, fs.ErrNotExist) {
+		if !acceptHTML(r) {
+			serveNotFoundJSON(w, r, short, remainder)
+			return
+		}
+		if customErrorTmpls[errorNotFound] != nil {
+			serveErrorPage(w, r, http.StatusNotFound, errorNotFound, short, "link not found")
+			return
+		}
 		w.WriteHeader(http.StatusNotFound)
 		serveHome(w, r, short)
 		return
@@ -585,23 +1541,46 @@ func serveGo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	stats.mu.Lock()
-	if stats.clicks == nil {
-		stats.clicks = make(ClickStats)
+	if linkExpired(link, time.Now()) {
+		serveErrorPage(w, r, http.StatusNotFound, errorExpired, link.Short, "link expired")
+		return
 	}
-	stats.clicks[link.Short]++
-	if stats.dirty == nil {
-		stats.dirty = make(ClickStats)
+	if !useLink(w, r, link) {
+		return
+	}
+
+	countClick(link.Short)
+	countClickSource(link.Short, remainder, r.Referer())
+
+	// deprecated links permanently redirect to their successor once the
+	// deprecation period has passed.
+	deprecatedUntil := link.Deprecated.Add(*deprecationPeriod)
+	if link.Successor != "" && !time.Now().Before(deprecatedUntil) {
+		u := &url.URL{Path: "/" + link.Successor, RawQuery: r.URL.RawQuery}
+		if remainder != "" {
+			u.Path += "/" + remainder
+		}
+		w.Header().Set("Location", u.String())
+		redirectsServed.Add(1)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return
 	}
-	stats.dirty[link.Short]++
-	stats.mu.Unlock()
 
-	cu, _ := currentUser(r)
-	env := expandEnv{Now: time.Now().UTC(), Path: remainder, user: cu.login, query: r.URL.Query()}
-	target, err := expandLink(link.Long, env)
+	long := resolveTarget(link)
+	env := expandEnv{Now: time.Now().UTC(), Path: remainder}
+	if r.URL.RawQuery != "" {
+		env.query = r.URL.Query()
+	}
+	if usesUser(long) || paramsUseUser(link) {
+		cu, _ := currentUser(r)
+		env.user = cu.login
+	}
+	target, err := expandLinkTarget(link, long, env)
+	if err == nil {
+		err = appendParams(link, target, env)
+	}
 	if err != nil {
-		log.Printf("expanding %q: %v", link.Long, err)
+		log.Printf("expanding %q: %v", long, err)
 		if errors.Is(err, errNoUser) {
 			http.Error(w, "link requires a valid user", http.StatusUnauthorized)
 			return
@@ -609,11 +1588,113 @@ func serveGo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// http.Redirect always cleans the redirect URL, which we don't always want.
-	// Instead, manually set status and Location header.
-	w.Header().Set("Location", target.String())
-	w.WriteHeader(http.StatusFound)
+
+	if link.Successor != "" {
+		w.Header().Set("Link", fmt.Sprintf(`</%s>; rel="successor-version"`, link.Successor))
+		if acceptHTML(r) {
+			deprecatedTmpl.Execute(w, deprecatedData{
+				Short:     link.Short,
+				Successor: link.Successor,
+				Target:    target.String(),
+				Until:     deprecatedUntil,
+			})
+			return
+		}
+	}
+
+	// http.Redirect always cleans the redirect URL, which we don't always want.
+	// Instead, manually set status and Location header.
+	setLinkHeaders(w, link)
+	w.Header().Set("Location", target.String())
+	redirectsServed.Add(1)
+	w.WriteHeader(http.StatusFound)
+}
+
+// countClick records a visit to the link short by a tailnet user in the
+// click stats.
+func countClick(short string) {
+	recordClick(short, false)
+}
+
+// countExternalClick records a visit to the link short by a visitor to
+// --public-hostname in the click stats.
+func countExternalClick(short string) {
+	recordClick(short, true)
+}
+
+// recordClick records a visit to the link short in the click stats, noting
+// whether it was external.
+func recordClick(short string, external bool) {
+	activity.click(time.Now(), short)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.clicks == nil {
+		stats.clicks = make(ClickStats)
+	}
+	if stats.dirty == nil {
+		stats.dirty = make(ClickStats)
+	}
+	if _, ok := stats.dirty[short]; !ok {
+		if limit := *statsQueueSize; limit > 0 && len(stats.dirty) >= limit {
+			if *statsDropPolicy != "oldest" {
+				statsDroppedClicks.Add(1)
+				return
+			}
+			dropOldestClicks()
+		}
+		stats.queued = append(stats.queued, short)
+	}
+	stats.clicks[short]++
+	stats.dirty[short]++
+	if external {
+		if stats.external == nil {
+			stats.external = make(ClickStats)
+		}
+		stats.external[short]++
+	}
+}
+
+// maxClickSources is the most distinct paths and referrers whose clicks are
+// kept for each link between flushes. Clicks from others are still counted,
+// but with no path or referrer.
+const maxClickSources = 100
+
+// maxClickPathLen is the longest path under a link that is recorded in the
+// click stats. Longer paths are truncated.
+const maxClickPathLen = 100
+
+// clickSource returns where a click came from: the path requested under
+// the link, truncated to maxClickPathLen bytes, and the host of the page
+// that referred it. Only the referrer's host is kept, so that the stats
+// never record the full URLs visitors came from.
+func clickSource(path, referer string) ClickSource {
+	if len(path) > maxClickPathLen {
+		path = strings.ToValidUTF8(path[:maxClickPathLen], "")
+	}
+	src := ClickSource{Path: path}
+	if u, err := url.Parse(referer); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		src.Referrer = strings.ToLower(u.Hostname())
+	}
+	return src
+}
+
+// countClickSource records where the click of short just counted by
+// countClick or countExternalClick came from, given the path requested
+// under the link and the request's Referer header.
+func countClickSource(short, path, referer string) {
+	src := clickSource(path, referer)
+	if src == (ClickSource{}) {
+		return
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if _, ok := stats.dirty[short]; !ok {
+		return // the click was dropped
+	}
+	if _, ok := stats.sources[short][src]; !ok && len(stats.sources[short]) >= maxClickSources {
+		return
+	}
+	addClickSources(short, map[ClickSource]int{src: 1})
 }
 
 // acceptHTML returns whether the request can accept a text/html response.
@@ -627,12 +1708,39 @@ type detailData struct {
 	Editable bool
 	Link     *Link
 	XSRF     string
+
+	// GCDeadline is when the link will be garbage collected if it remains
+	// unclicked, or the zero time if it is not scheduled for removal.
+	GCDeadline  time.Time
+	GCExemptTag string
+
+	// FallbackServes is the number of times each fallback target was served.
+	FallbackServes map[string]int
+
+	// Maintenance lists the upcoming and active maintenance windows for the link.
+	Maintenance []*MaintenanceWindow
+
+	// Expired is whether the link has expired.
+	Expired bool
+
+	// Broken is the health of the link's destination if the dead link
+	// checker found it broken.
+	Broken *TargetHealth
+
+	// Conflict is set when saving the link failed because someone else
+	// changed it, with Link holding the rejected changes.
+	Conflict *ConflictError
+
+	// History lists the link's revisions, newest first. RestoreXSRF is the
+	// token for reverting to one of them, set if the user can edit the link.
+	History     []historyEntry
+	RestoreXSRF string
 }
 
 func serveDetail(w http.ResponseWriter, r *http.Request) {
 	short := strings.TrimPrefix(r.URL.Path, "/.detail/")
 
-	link, err := db.Load(short)
+	link, err := loadLink(short)
 	if errors.Is(err, fs.ErrNotExist) {
 		http.NotFound(w, r)
 		return
@@ -647,6 +1755,14 @@ func serveDetail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if link.MaxUses > 0 {
+		// only editors may see the destination of a one-time link
+		cu, err := currentUser(r)
+		if err != nil || !authz.canEdit(r.Context(), cu, link) {
+			http.NotFound(w, r)
+			return
+		}
+	}
 
 	if !acceptHTML(r) {
 		w.Header().Set("Content-Type", "application/json")
@@ -661,8 +1777,8 @@ func serveDetail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	canEdit := canEditLink(r.Context(), link, cu)
-	ownerExists, err := userExists(r.Context(), link.Owner)
+	canEdit := authz.canEdit(r.Context(), cu, link)
+	ownerExists, err := linkOwnerExists(r.Context(), link.Owner)
 	if err != nil {
 		log.Printf("looking up tailnet user %q: %v", link.Owner, err)
 	}
@@ -671,10 +1787,46 @@ func serveDetail(w http.ResponseWriter, r *http.Request) {
 		Link:     link,
 		Editable: canEdit,
 		XSRF:     xsrftoken.Generate(xsrfKey, cu.login, link.Short),
+		Expired:  linkExpired(link, time.Now()),
 	}
-	if canEdit && !ownerExists {
+	if canEdit && (!ownerExists || link.Owner == storedOwner(cu.login)) {
 		data.Link.Owner = cu.login
 	}
+	for _, m := range maintenanceWindows(time.Now().UTC()) {
+		if windowApplies(m, link) {
+			data.Maintenance = append(data.Maintenance, m)
+		}
+	}
+	if revs, err := db.LoadHistory(link.Short); err == nil {
+		data.History = historyEntries(revs)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("loading history of %q: %v", link.Short, err)
+	}
+	if canEdit {
+		data.RestoreXSRF = xsrftoken.Generate(xsrfKey, cu.login, ".restore")
+	}
+	if linkHealthCheck(link).off {
+		// not checked, so not flagged even if another link's check failed
+	} else if health, err := db.LoadTargetHealth([]string{link.Long}); err != nil {
+		log.Printf("loading target health of %q: %v", link.Short, err)
+	} else if h, ok := health[link.Long]; ok && !h.Healthy {
+		data.Broken = &h
+	}
+	if len(link.Fallbacks) > 0 {
+		if data.FallbackServes, err = db.LoadFallbackServes(link.Short); err != nil {
+			log.Printf("loading fallback serves: %v", err)
+		}
+	}
+	if link.AutoCreated {
+		notices, err := db.LoadGCNotices()
+		if err != nil {
+			log.Printf("loading gc notices: %v", err)
+		}
+		if t, ok := notices[linkID(link.Short)]; ok {
+			data.GCDeadline = t.Add(*gcGrace)
+			data.GCExemptTag = *gcExemptTag
+		}
+	}
 
 	detailTmpl.Execute(w, data)
 }
@@ -725,15 +1877,30 @@ func regexMatch(pattern string, s string) bool {
 // If long does not include templates, the default behavior is to append
 // env.Path to long.
 func expandLink(long string, env expandEnv) (*url.URL, error) {
+	return expandLinkTarget(nil, long, env)
+}
+
+// expandLinkTarget is like expandLink, but caches the parsed template for
+// long, a target of link, if link is non-nil.
+func expandLinkTarget(link *Link, long string, env expandEnv) (*url.URL, error) {
 	if !strings.Contains(long, "{{") {
-		// default behavior is to append remaining path to long URL
-		if strings.HasSuffix(long, "/") {
-			long += "{{.Path}}"
-		} else {
-			long += "{{with .Path}}/{{.}}{{end}}"
+		// default behavior is to append remaining path to long URL,
+		// which does not require executing a template
+		if env.Path != "" {
+			if !strings.HasSuffix(long, "/") {
+				long += "/"
+			}
+			long += env.Path
 		}
+		return targetURL(long, env.query)
+	}
+	var tmpl *texttemplate.Template
+	var err error
+	if link != nil {
+		tmpl, err = linkTemplates.get(link, long)
+	} else {
+		tmpl, err = parseLinkTemplate(long)
 	}
-	tmpl, err := texttemplate.New("").Funcs(expandFuncMap).Parse(long)
 	if err != nil {
 		return nil, err
 	}
@@ -741,16 +1908,20 @@ func expandLink(long string, env expandEnv) (*url.URL, error) {
 	if err := tmpl.Execute(buf, env); err != nil {
 		return nil, err
 	}
+	return targetURL(buf.String(), env.query)
+}
 
-	u, err := url.Parse(buf.String())
+// targetURL parses target, adding query parameters from the original request.
+func targetURL(target string, reqQuery url.Values) (*url.URL, error) {
+	u, err := url.Parse(target)
 	if err != nil {
 		return nil, err
 	}
 
 	// add query parameters from original request
-	if len(env.query) > 0 {
+	if len(reqQuery) > 0 {
 		query := u.Query()
-		for key, values := range env.query {
+		for key, values := range reqQuery {
 			for _, v := range values {
 				query.Add(key, v)
 			}
@@ -761,29 +1932,44 @@ func expandLink(long string, env expandEnv) (*url.URL, error) {
 	return u, nil
 }
 
+// parseLinkTemplate parses the link template long.
+func parseLinkTemplate(long string) (*texttemplate.Template, error) {
+	return texttemplate.New("").Funcs(expandFuncMap).Parse(long)
+}
+
+// usesUser reports whether the link destination long refers to the current
+// user, which requires looking up the user making the request.
+func usesUser(long string) bool {
+	return strings.Contains(long, "{{") && strings.Contains(long, "User")
+}
+
 func devMode() bool { return *devListen != "" }
 
 const peerCapName = "tailscale.com/cap/golink"
 
 type capabilities struct {
-	Admin bool `json:"admin"`
+	Admin  bool     `json:"admin"`
+	Groups []string `json:"groups"` // tailnet groups the user is in, such as "group:sre"
+	Edit   []string `json:"edit"`   // link patterns the user may edit, such as "eng.*"
 }
 
 type user struct {
 	login   string
 	isAdmin bool
+	tags    []string // ACL tags of the requesting node, if it is tagged
+	scopes  []string // scopes of the stored API token used, if any; nil allows everything
+	groups  []string // tailnet groups the user is granted, such as "group:sre"
+	grants  []string // patterns of links the user is granted, such as "eng.*"
 }
 
-// currentUser returns the Tailscale user associated with the request.
-// In most cases, this will be the user that owns the device that made the request.
+// currentUser returns the user associated with the request, as determined
+// by the configured identity provider. With the default Tailscale provider,
+// this will in most cases be the user that owns the device that made the request.
 // For tagged devices, the value "tagged-devices" is returned.
 // If the user can't be determined (such as requests coming through a subnet router),
 // an error is returned unless the -allow-unknown-users flag is set.
 var currentUser = func(r *http.Request) (user, error) {
-	if devMode() {
-		return user{login: "foo@example.com"}, nil
-	}
-	whois, err := localClient.WhoIs(r.Context(), r.RemoteAddr)
+	u, err := identity.requestUser(r)
 	if err != nil {
 		if *allowUnknownUsers {
 			// Don't report the error if we are allowing unknown users.
@@ -791,41 +1977,24 @@ var currentUser = func(r *http.Request) (user, error) {
 		}
 		return user{}, err
 	}
-	login := whois.UserProfile.LoginName
-	caps, _ := tailcfg.UnmarshalCapJSON[capabilities](whois.CapMap, peerCapName)
-	for _, cap := range caps {
-		if cap.Admin {
-			return user{login: login, isAdmin: true}, nil
-		}
+	if adminLogins[strings.ToLower(u.login)] {
+		u.isAdmin = true
 	}
-	return user{login: login}, nil
+	return u, nil
 }
 
-// userExists returns whether a user exists with the specified login in the current tailnet.
+// userExists returns whether a user exists with the specified login, as
+// reported by the configured identity provider.
+// Logins of the form "team:{name}" exist if the named team exists.
 func userExists(ctx context.Context, login string) (bool, error) {
-	const userTaggedDevices = "tagged-devices" // owner of tagged devices
-
-	if login == userTaggedDevices {
-		return false, nil
-	}
-
-	if devMode() {
-		// in dev mode, just assume the user exists
-		return true, nil
-	}
-	st, err := localClient.Status(ctx)
-	if err != nil {
-		return false, err
-	}
-	for _, user := range st.User {
-		if user.LoginName == userTaggedDevices {
-			continue
-		}
-		if user.LoginName == login {
-			return true, nil
+	if name, ok := strings.CutPrefix(login, teamOwnerPrefix); ok {
+		_, err := db.LoadTeam(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
 		}
+		return err == nil, err
 	}
-	return false, nil
+	return identity.userExists(ctx, login)
 }
 
 var reShortName = regexp.MustCompile(`^\w[\w\-\.]*$`)
@@ -853,7 +2022,8 @@ func serveDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !canEditLink(r.Context(), link, cu) {
+	if !authz.canDelete(r.Context(), cu, link) {
+		audit(r, cu, "access.denied", link.Short, "delete")
 		http.Error(w, fmt.Sprintf("cannot delete link owned by %q", link.Owner), http.StatusForbidden)
 		return
 	}
@@ -868,11 +2038,20 @@ func serveDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := db.Delete(short); err != nil {
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.Delete(short, editor); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	deleteLinkStats(link)
+	linkTemplates.invalidate(link.Short)
+	linkChanges.Add("delete", 1)
+	audit(r, cu, "link.delete", link.Short, "long="+link.Long)
+	notifyLinkChange(cu.login, link, nil)
 
 	deleteTmpl.Execute(w, deleteData{
 		Short: link.Short,
@@ -881,6 +2060,86 @@ func serveDelete(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// serveMerge handles requests by admins to merge one link into another.
+// The "from" link is deleted and its stats and tags are moved to the "into"
+// link. The "from" short name continues to resolve as an alias.
+func serveMerge(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	from, into := r.FormValue("from"), r.FormValue("into")
+	if from == "" || into == "" {
+		http.Error(w, "from and into required", http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", from, "merge")
+		http.Error(w, "only admins can merge links", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, ".merge") {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	fromLink, err := db.Load(from)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "link not found: "+from, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	intoLink, err := db.Load(into)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "link not found: "+into, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if linkID(fromLink.Short) == linkID(intoLink.Short) {
+		http.Error(w, "cannot merge a link into itself", http.StatusBadRequest)
+		return
+	}
+
+	// flush pending clicks so they are moved along with the stored stats
+	if err := flushStats(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := db.Merge(fromLink.Short, intoLink.Short); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	mergeLinkStats(fromLink, intoLink)
+	linkTemplates.invalidate(fromLink.Short)
+	audit(r, cu, "link.merge", fromLink.Short, "into="+intoLink.Short)
+
+	merged, err := db.Load(intoLink.Short)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	notifyLinkChange(cu.login, fromLink, nil)
+	notifyLinkChange(cu.login, intoLink, merged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
 // serveSave handles requests to save or update a Link.  Both short name and
 // long URL are validated for proper format. Existing links may only be updated
 // by their owner.
@@ -898,8 +2157,48 @@ func serveSave(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "short may only contain letters, numbers, dash, and period", http.StatusBadRequest)
 		return
 	}
-	if _, err := texttemplate.New("").Funcs(expandFuncMap).Parse(long); err != nil {
-		http.Error(w, fmt.Sprintf("long contains an invalid template: %v", err), http.StatusBadRequest)
+	if err := checkLinkTarget(long); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxUses, err := parseMaxUses(r.FormValue("max_uses"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expires, err := parseExpires(r.FormValue("expires"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version, err := parseVersion(r.FormValue("version"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	headers, err := parseLinkHeaders(r.FormValue("headers"))
+	if err == nil {
+		err = checkLinkHeaders(headers)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fallbacks := parseFallbacks(r.FormValue("fallbacks"))
+	for _, f := range append(fallbacks, r.FormValue("maintenance_target")) {
+		if _, err := texttemplate.New("").Funcs(expandFuncMap).Parse(f); err != nil {
+			http.Error(w, fmt.Sprintf("fallback or maintenance target contains an invalid template: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	params := strings.TrimSpace(r.FormValue("params"))
+	if _, err := texttemplate.New("").Funcs(expandFuncMap).Parse(params); err != nil {
+		http.Error(w, fmt.Sprintf("params contains an invalid template: %v", err), http.StatusBadRequest)
+		return
+	}
+	hc, err := parseHealthCheck(r.FormValue("health_check"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -908,14 +2207,55 @@ func serveSave(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	taggedTeam, err := tagTeamDefaults(cu)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if taggedTeam != nil {
+		short = inNamespace(short, taggedTeam.Namespace)
+	}
 
 	link, err := db.Load(short)
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if link == nil {
+		target, err := db.LoadAlias(short)
+		if err == nil {
+			http.Error(w, fmt.Sprintf("%s was merged into another link (%s) and cannot be reused", short, target), http.StatusConflict)
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
-	if !canEditLink(r.Context(), link, cu) {
+	if link == nil {
+		if !authz.canCreate(r.Context(), cu, short) {
+			audit(r, cu, "access.denied", short, "create")
+			http.Error(w, "cannot create link "+short, http.StatusForbidden)
+			return
+		}
+		if n := reservedName(short); n != nil {
+			http.Error(w, reservedNameError(short, n), http.StatusBadRequest)
+			return
+		}
+		deletion, err := recentDeletion(short, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if deletion != nil && !authz.canReclaim(cu, deletion) {
+			audit(r, cu, "access.denied", short, "create deleted")
+			until := deletion.Edited.Add(*deleteCooldown).Format(time.RFC3339)
+			http.Error(w, fmt.Sprintf("%s was recently deleted and until %s may only be recreated by its previous owner or an admin", short, until), http.StatusForbidden)
+			return
+		}
+	} else if !authz.canEdit(r.Context(), cu, link) {
+		audit(r, cu, "access.denied", link.Short, "update")
 		http.Error(w, fmt.Sprintf("cannot update link owned by %q", link.Owner), http.StatusForbidden)
 		return
 	}
@@ -934,6 +2274,13 @@ func serveSave(w http.ResponseWriter, r *http.Request) {
 
 	// allow transferring ownership to valid users. If empty, set owner to current user.
 	owner := r.FormValue("owner")
+	if owner != "" && isPseudonym(owner) {
+		// unchanged pseudonymized owner from the detail page
+		if owner, err = ownerIdentity(owner); err != nil {
+			http.Error(w, "unknown owner: "+r.FormValue("owner"), http.StatusBadRequest)
+			return
+		}
+	}
 	if owner != "" {
 		exists, err := userExists(r.Context(), owner)
 		if err != nil {
@@ -943,25 +2290,161 @@ func serveSave(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "new owner not a valid user: "+owner, http.StatusBadRequest)
 			return
 		}
+	} else if taggedTeam != nil {
+		owner = teamOwnerPrefix + taggedTeam.Name
 	} else {
 		owner = cu.login
 	}
+	if owner, err = recordOwner(owner); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var coOwners []string
+	for _, co := range parseCoOwners(r.FormValue("co_owners")) {
+		if strings.HasPrefix(co, groupOwnerPrefix) {
+			// groups are only known from the grants of their members
+			coOwners = append(coOwners, co)
+			continue
+		}
+		if isPseudonym(co) {
+			// unchanged pseudonymized co-owner from the detail page
+			login, err := ownerIdentity(co)
+			if err != nil {
+				http.Error(w, "unknown co-owner: "+co, http.StatusBadRequest)
+				return
+			}
+			co = login
+		}
+		exists, err := userExists(r.Context(), co)
+		if err != nil {
+			log.Printf("looking up tailnet user %q: %v", co, err)
+		}
+		if !exists {
+			http.Error(w, "co-owner not a valid user: "+co, http.StatusBadRequest)
+			return
+		}
+		if co, err = recordOwner(co); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		coOwners = append(coOwners, co)
+	}
+	slices.Sort(coOwners)
+	coOwners = slices.Compact(coOwners)
 
 	now := time.Now().UTC()
-	if link == nil {
+	action := "edit"
+	var old *Link
+	if link != nil {
+		old = link.clone()
+	} else {
+		action = "create"
 		link = &Link{
-			Short:   short,
-			Created: now,
+			Short:       short,
+			Created:     now,
+			AutoCreated: createsAutoLinks(cu),
+		}
+	}
+	if _, ok := r.Form["tags"]; ok {
+		link.Tags = parseTags(r.FormValue("tags"))
+	}
+	if _, ok := r.Form["co_owners"]; ok {
+		link.CoOwners = coOwners
+	}
+	if _, ok := r.Form["fallbacks"]; ok {
+		link.Fallbacks = fallbacks
+	}
+	if _, ok := r.Form["headers"]; ok {
+		link.Headers = headers
+	}
+	if _, ok := r.Form["params"]; ok {
+		link.Params = params
+	}
+	if _, ok := r.Form["health_check"]; ok {
+		link.HealthCheck = hc.String()
+	}
+	if _, ok := r.Form["max_uses"]; ok {
+		link.MaxUses = maxUses
+	}
+	if _, ok := r.Form["expires"]; ok {
+		link.Expires = expires
+	}
+	if _, ok := r.Form["maintenance_target"]; ok {
+		link.MaintenanceTarget = strings.TrimSpace(r.FormValue("maintenance_target"))
+	}
+	if _, ok := r.Form["successor"]; ok {
+		successor := strings.TrimSpace(r.FormValue("successor"))
+		if successor != "" {
+			if linkID(successor) == linkID(short) {
+				http.Error(w, "a link cannot be its own successor", http.StatusBadRequest)
+				return
+			}
+			next, err := loadLink(successor)
+			if errors.Is(err, fs.ErrNotExist) {
+				http.Error(w, "successor link does not exist: "+successor, http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			successor = next.Short
+			if link.Deprecated.IsZero() {
+				link.Deprecated = now
+			}
+		} else {
+			link.Deprecated = time.Time{}
 		}
+		link.Successor = successor
 	}
 	link.Short = short
-	link.Long = long
+	link.Long = canonicalTarget(long, targetSupportsHTTPS)
+	link.RawLong = ""
+	if link.Long != long {
+		link.RawLong = long
+	}
+	// checked here as a credential may not be usable with a new destination
+	if err := checkHealthCheck(linkHealthCheck(link), link.Long); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	link.LastEdit = now
 	link.Owner = owner
-	if err := db.Save(link); err != nil {
+	link.Editor = editor
+	mode := saveAlways
+	switch {
+	case action == "create":
+		mode = saveCreate
+	case version > 0:
+		link.Version = version
+		mode = saveUpdate
+	}
+	err = db.save(link, mode, !authz.canAdmin(cu))
+	if mode == saveCreate && errors.Is(err, fs.ErrExist) {
+		err = conflictError(link.Short)
+	}
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		serveSaveConflict(w, r, cu, link, conflict)
+		return
+	}
+	if errors.Is(err, errQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	linkChanges.Add(action, 1)
+	linkTemplates.invalidate(link.Short)
+	audit(r, cu, "link.save", link.Short, "long="+link.Long+" owner="+link.Owner)
+	notifyLinkChange(cu.login, old, link)
 
 	if acceptHTML(r) {
 		successTmpl.Execute(w, homeData{Short: short})
@@ -971,60 +2454,94 @@ func serveSave(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// canEditLink returns whether the specified user has permission to edit link.
-// Admin users can edit all links.
-// Non-admin users can only edit their own links or links without an active owner.
-func canEditLink(ctx context.Context, link *Link, u user) bool {
-	if *readonly {
-		return false
-	}
-	if link == nil || link.Owner == "" {
-		// new or unowned link
-		return true
-	}
-
-	if u.isAdmin || link.Owner == u.login {
-		return true
-	}
+// parseCoOwners parses a comma or space separated list of co-owners, which
+// are user logins, team owners, groups, or pseudonyms.
+func parseCoOwners(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
 
-	owned, err := userExists(ctx, link.Owner)
-	if err != nil {
-		log.Printf("looking up tailnet user %q: %v", link.Owner, err)
+// parseTags parses a comma or space separated list of tags,
+// returning them lowercased, sorted, and without duplicates.
+func parseTags(s string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if len(fields) == 0 {
+		return nil
 	}
-	// Allow editing if the link is currently unowned
-	return err == nil && !owned
+	sort.Strings(fields)
+	return slices.Compact(fields)
 }
 
 // serveExport prints a snapshot of the link database. Links are JSON encoded
 // and printed one per line. This format is used to restore link snapshots on
-// startup.
-func serveExport(w http.ResponseWriter, _ *http.Request) {
+// startup. Each line has a checksum, and a trailer line closes the snapshot
+// so that `golink backup verify` can detect corruption and truncation.
+// With "format=csv", links are instead printed as CSV rows of csvColumns.
+//
+// Links are streamed from the database as they are written, so that large
+// exports are not held in memory, and the export is compressed if the
+// request accepts zstd or gzip.
+func serveExport(w http.ResponseWriter, r *http.Request) {
+	serveLinkExport(w, r, nil)
+}
+
+// serveLinkExport exports the links for which include returns true, or all
+// links if include is nil, as described by serveExport.
+func serveLinkExport(w http.ResponseWriter, r *http.Request, include func(*Link) bool) {
+	format := cmp.Or(r.FormValue("format"), "jsonl")
+	f, ok := exportFormats[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q: use jsonl or csv", format), http.StatusBadRequest)
+		return
+	}
 	if err := flushStats(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	links, err := db.LoadAll()
+	next, stop := iter.Pull2(db.AllLinks(r.Context()))
+	defer stop()
+	// report a failed query before the response is started
+	link, err, more := next()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	sort.Slice(links, func(i, j int) bool {
-		return links[i].Short < links[j].Short
-	})
-	encoder := json.NewEncoder(w)
-	for _, link := range links {
-		if err := encoder.Encode(link); err != nil {
+	w.Header().Set("Content-Type", f.contentType)
+	out, err := compressResponse(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	lw := f.writer(out)
+	for ; more; link, err, more = next() {
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+		if include != nil && !include(link) {
+			continue
+		}
+		if err := lw.Write(link); err != nil {
 			panic(http.ErrAbortHandler)
 		}
 	}
+	if err := lw.Close(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if err := out.Close(); err != nil {
+		panic(http.ErrAbortHandler)
+	}
 }
 
 // serveExportStats prints a snapshot of the stats database table.
 //
 // Stats are printed in CSV format with three columns: link ID, UNIX timestamp, and click count.
 // Each stat line represents the number of clicks in the previous minute.
-func serveExportStats(w http.ResponseWriter, _ *http.Request) {
+// Like /.export, the response is compressed if the request accepts it.
+func serveExportStats(w http.ResponseWriter, r *http.Request) {
 	if err := flushStats(); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1035,6 +2552,12 @@ func serveExportStats(w http.ResponseWriter, _ *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	out, err := compressResponse(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer out.Close()
 	defer func() {
 		rows.Close()
 		if err := rows.Err(); err != nil {
@@ -1052,13 +2575,19 @@ func serveExportStats(w http.ResponseWriter, _ *http.Request) {
 			return
 		}
 		// id is not permitted to contain commas, so no need to worry about CSV quoting
-		fmt.Fprintf(w, "%s,%d,%d\n", id, created, clicks)
+		fmt.Fprintf(out, "%s,%d,%d\n", id, created, clicks)
 	}
 }
 
 func restoreLastSnapshot() error {
-	bs := bufio.NewScanner(bytes.NewReader(LastSnapshot))
-	var restored int
+	// snapshots may be compressed, as served by /.export
+	r, err := decompressReader(bytes.NewReader(LastSnapshot))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	bs := bufio.NewScanner(r)
+	var restored, remapped int
 	for bs.Scan() {
 		link := new(Link)
 		if err := json.Unmarshal(bs.Bytes(), link); err != nil {
@@ -1073,17 +2602,38 @@ func restoreLastSnapshot() error {
 		} else if !errors.Is(err, fs.ErrNotExist) {
 			return err
 		}
+		if owner := importOwners.remap(link.Owner); owner != link.Owner {
+			link.Owner = owner
+			remapped++
+		}
 		if err := db.Save(link); err != nil {
 			return err
 		}
 		restored++
 	}
 	if restored > 0 && *verbose {
-		log.Printf("Restored %v links.", restored)
+		log.Printf("Restored %v links (%v with remapped owners).", restored, remapped)
 	}
 	return bs.Err()
 }
 
+// loadLink returns the link with the specified short name. If no such link
+// exists but short was merged into another link, that link is returned.
+func loadLink(short string) (*Link, error) {
+	link, err := db.Load(short)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return link, err
+	}
+	target, aerr := db.LoadAlias(short)
+	if aerr != nil {
+		if errors.Is(aerr, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, aerr
+	}
+	return db.Load(target)
+}
+
 func resolveLink(link *url.URL) (*url.URL, error) {
 	path := link.Path
 
@@ -1094,7 +2644,7 @@ func resolveLink(link *url.URL) (*url.URL, error) {
 	}
 
 	short, remainder, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
-	l, err := db.Load(short)
+	l, err := loadLink(short)
 	if err != nil {
 		return nil, err
 	}
@@ -1114,6 +2664,10 @@ func isRequestAuthorized(r *http.Request, u user, short string) bool {
 	if r.Header.Get(secHeaderName) != "" {
 		return true
 	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		// browsers don't attach API tokens to cross-site requests
+		return true
+	}
 
 	return xsrftoken.Valid(r.PostFormValue("xsrf"), xsrfKey, u.login, short)
 }
@@ -5,9 +5,12 @@ package golink
 
 import (
 	"errors"
+	"fmt"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -20,15 +23,11 @@ import (
 
 func init() {
 	// tests always need golink to be run in dev mode
-	*dev = ":8080"
+	*devListen = ":8080"
 }
 
 func TestServeGo(t *testing.T) {
-	var err error
-	db, err = NewSQLiteDB(":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
+	db = newTestDB(t)
 	db.Save(&Link{Short: "who", Long: "http://who/"})
 	db.Save(&Link{Short: "me", Long: "/who/{{.User}}"})
 	db.Save(&Link{Short: "invalid-var", Long: "/who/{{.Invalid}}"})
@@ -151,11 +150,7 @@ func TestServeGo(t *testing.T) {
 }
 
 func TestServeSave(t *testing.T) {
-	var err error
-	db, err = NewSQLiteDB(":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
+	db = newTestDB(t)
 	db.Save(&Link{Short: "link-owned-by-tagged-devices", Long: "/before", Owner: "tagged-devices"})
 
 	fooXSRF := func(short string) string {
@@ -205,7 +200,7 @@ func TestServeSave(t *testing.T) {
 			name:        "allow editing link owned by tagged-devices",
 			short:       "link-owned-by-tagged-devices",
 			xsrf:        barXSRF("link-owned-by-tagged-devices"),
-			long:        "/after",
+			long:        "http://after/",
 			currentUser: func(*http.Request) (user, error) { return user{login: "bar@example.com"}, nil },
 			wantStatus:  http.StatusOK,
 		},
@@ -273,11 +268,7 @@ func TestServeSave(t *testing.T) {
 }
 
 func TestServeDelete(t *testing.T) {
-	var err error
-	db, err = NewSQLiteDB(":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
+	db = newTestDB(t)
 	db.Save(&Link{Short: "a", Owner: "a@example.com"})
 	db.Save(&Link{Short: "foo", Owner: "foo@example.com"})
 	db.Save(&Link{Short: "link-owned-by-tagged-devices", Long: "/before", Owner: "tagged-devices"})
@@ -364,12 +355,8 @@ func TestServeExport(t *testing.T) {
 		Start: time.Date(2022, 06, 02, 1, 2, 3, 4, time.UTC),
 	})
 
-	var err error
-	db, err = NewSQLiteDB(":memory:")
+	db = newTestDB(t)
 	db.clock = clock
-	if err != nil {
-		t.Fatal(err)
-	}
 	db.Save(&Link{Short: "a", Owner: "a@example.com"})
 	db.Save(&Link{Short: "foo", Owner: "foo@example.com"})
 	db.Save(&Link{Short: "link-owned-by-tagged-devices", Long: "/before", Owner: "tagged-devices"})
@@ -421,11 +408,7 @@ a,1654131903,1
 }
 
 func TestReadOnlyMode(t *testing.T) {
-	var err error
-	db, err = NewSQLiteDB(":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
+	db = newTestDB(t)
 	db.Save(&Link{Short: "who", Long: "http://who/"})
 
 	oldReadOnly := readonly
@@ -634,12 +617,30 @@ func TestExpandLink(t *testing.T) {
 	}
 }
 
-func TestResolveLink(t *testing.T) {
-	var err error
-	db, err = NewSQLiteDB(":memory:")
-	if err != nil {
-		t.Fatal(err)
+func BenchmarkExpandLink(b *testing.B) {
+	query, _ := url.ParseQuery("a=b")
+	for _, bb := range []struct {
+		name string
+		long string
+		env  expandEnv
+	}{
+		{name: "plain", long: "https://example.com/", env: expandEnv{Path: "foo"}},
+		{name: "plain-query", long: "https://example.com/", env: expandEnv{Path: "foo", query: query}},
+		{name: "template", long: "https://example.com/{{with .Path}}search?q={{QueryEscape .}}{{end}}", env: expandEnv{Path: "foo"}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				if _, err := expandLink(bb.long, bb.env); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
+}
+
+func TestResolveLink(t *testing.T) {
+	db = newTestDB(t)
 	db.Save(&Link{Short: "meet", Long: "https://meet.google.com/lookup/"})
 	db.Save(&Link{Short: "cs", Long: "http://codesearch/{{with .Path}}search?q={{.}}{{end}}"})
 	db.Save(&Link{Short: "m", Long: "http://go/meet"})
@@ -705,11 +706,7 @@ func TestResolveLink(t *testing.T) {
 }
 
 func TestNoHSTSShortDomain(t *testing.T) {
-	var err error
-	db, err = NewSQLiteDB(":memory:")
-	if err != nil {
-		t.Fatal(err)
-	}
+	db = newTestDB(t)
 	db.Save(&Link{Short: "foobar", Long: "http://foobar/"})
 
 	tests := []struct {
@@ -754,3 +751,245 @@ func TestHTTPSRedirectHandlerWithQuery(t *testing.T) {
 		t.Errorf("got %q; want %q", w.Header().Get("Location"), "https://foobar.com/?query=bar")
 	}
 }
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: " , ", want: nil},
+		{in: "oncall", want: []string{"oncall"}},
+		{in: "Docs, oncall docs\tkeep", want: []string{"docs", "keep", "oncall"}},
+	}
+	for _, tt := range tests {
+		if got := parseTags(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parseTags(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPopularLinks(t *testing.T) {
+	stats.mu.Lock()
+	saved := stats.clicks
+	stats.clicks = ClickStats{"b": 3, "a": 3, "c": 7}
+	for i := range maxPopularLinks {
+		stats.clicks[fmt.Sprintf("link%03d", i)] = 1
+	}
+	stats.mu.Unlock()
+	t.Cleanup(func() {
+		stats.mu.Lock()
+		stats.clicks = saved
+		stats.mu.Unlock()
+	})
+
+	got := popularLinks()
+	if len(got) != maxPopularLinks {
+		t.Fatalf("popularLinks returned %d links; want %d", len(got), maxPopularLinks)
+	}
+	want := []visitData{{"c", 7}, {"a", 3}, {"b", 3}, {"link000", 1}}
+	if !slices.Equal(got[:len(want)], want) {
+		t.Errorf("popularLinks = %v...; want %v...", got[:len(want)], want)
+	}
+	if last := got[len(got)-1].Short; last != "link196" {
+		t.Errorf("last popular link = %q; want %q", last, "link196")
+	}
+}
+
+func TestStatsQueueLimit(t *testing.T) {
+	oldSize, oldPolicy := *statsQueueSize, *statsDropPolicy
+	stats.mu.Lock()
+	clicks, dirty, queued, external := stats.clicks, stats.dirty, stats.queued, stats.external
+	stats.mu.Unlock()
+	t.Cleanup(func() {
+		*statsQueueSize, *statsDropPolicy = oldSize, oldPolicy
+		stats.mu.Lock()
+		stats.clicks, stats.dirty, stats.queued, stats.external = clicks, dirty, queued, external
+		stats.mu.Unlock()
+	})
+
+	*statsQueueSize = 2
+	for _, tt := range []struct {
+		policy      string
+		want        ClickStats
+		wantDropped int64
+	}{
+		{"newest", ClickStats{"a": 2, "b": 1}, 1}, // c
+		{"oldest", ClickStats{"b": 1, "c": 1}, 2}, // both clicks of a
+	} {
+		*statsDropPolicy = tt.policy
+		stats.mu.Lock()
+		stats.clicks, stats.dirty, stats.queued = nil, nil, nil
+		stats.mu.Unlock()
+		dropped := statsDroppedClicks.Value()
+
+		for _, short := range []string{"a", "b", "a", "c"} {
+			countClick(short)
+		}
+		stats.mu.Lock()
+		if !maps.Equal(stats.dirty, tt.want) {
+			t.Errorf("%s: unsaved clicks = %v; want %v", tt.policy, stats.dirty, tt.want)
+		}
+		if !maps.Equal(stats.clicks, tt.want) {
+			t.Errorf("%s: clicks = %v; want %v", tt.policy, stats.clicks, tt.want)
+		}
+		stats.mu.Unlock()
+		if n := statsDroppedClicks.Value() - dropped; n != tt.wantDropped {
+			t.Errorf("%s: dropped %d clicks; want %d", tt.policy, n, tt.wantDropped)
+		}
+	}
+
+	// clicks that fail to save are requeued ahead of newer ones, if they fit
+	*statsDropPolicy = "oldest"
+	stats.mu.Lock()
+	stats.clicks = ClickStats{"a": 1, "b": 2, "d": 4}
+	stats.dirty, stats.queued, stats.external = ClickStats{"d": 4}, []string{"d"}, nil
+	stats.mu.Unlock()
+	requeueClicks(ClickStats{"a": 1, "b": 2}, ClickStats{"a": 1, "b": 1}, nil)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if want := (ClickStats{"a": 1, "d": 4}); !maps.Equal(stats.dirty, want) {
+		t.Errorf("after requeue, unsaved clicks = %v; want %v", stats.dirty, want)
+	}
+	if !slices.Equal(stats.queued, []string{"a", "d"}) {
+		t.Errorf("after requeue, queued = %v; want [a d]", stats.queued)
+	}
+	if want := (ClickStats{"a": 1}); !maps.Equal(stats.external, want) {
+		t.Errorf("after requeue, external clicks = %v; want %v", stats.external, want)
+	}
+}
+
+func TestClickBatchMergeLink(t *testing.T) {
+	b := &clickBatch{
+		clicks:   ClickStats{"old": 3, "new": 1, "other": 2},
+		external: ClickStats{"old": 1},
+		sources:  ClickSources{"old": {{Path: "a"}: 2}, "new": {{Path: "a"}: 1}},
+	}
+	b.mergeLink("old", "new")
+	if want := (ClickStats{"new": 4, "other": 2}); !maps.Equal(b.clicks, want) {
+		t.Errorf("after merge, clicks = %v; want %v", b.clicks, want)
+	}
+	if want := (ClickStats{"new": 1}); !maps.Equal(b.external, want) {
+		t.Errorf("after merge, external clicks = %v; want %v", b.external, want)
+	}
+	if want := (map[ClickSource]int{{Path: "a"}: 3}); len(b.sources) != 1 || !maps.Equal(b.sources["new"], want) {
+		t.Errorf("after merge, sources = %v; want new: %v", b.sources, want)
+	}
+
+	b.forgetLink("new")
+	if want := (ClickStats{"other": 2}); !maps.Equal(b.clicks, want) || len(b.external) != 0 || len(b.sources) != 0 {
+		t.Errorf("after forget, batch = %+v; want only other's clicks", b)
+	}
+}
+
+func TestClickSource(t *testing.T) {
+	tests := []struct {
+		path, referer string
+		want          ClickSource
+	}{
+		{"", "", ClickSource{}},
+		{"design", "", ClickSource{Path: "design"}},
+		{"", "https://Docs.Example.com:8443/d/secret?token=1", ClickSource{Referrer: "docs.example.com"}},
+		{"a/b", "http://wiki/page", ClickSource{Path: "a/b", Referrer: "wiki"}},
+		{"", "android-app://com.example", ClickSource{}},
+		{"", "not a url\x7f", ClickSource{}},
+		{strings.Repeat("x", maxClickPathLen+10), "", ClickSource{Path: strings.Repeat("x", maxClickPathLen)}},
+		{strings.Repeat("x", maxClickPathLen-1) + "é", "", ClickSource{Path: strings.Repeat("x", maxClickPathLen-1)}},
+	}
+	for _, tt := range tests {
+		if got := clickSource(tt.path, tt.referer); got != tt.want {
+			t.Errorf("clickSource(%q, %q) = %+v; want %+v", tt.path, tt.referer, got, tt.want)
+		}
+	}
+}
+
+func TestCountClickSource(t *testing.T) {
+	stats.mu.Lock()
+	dirty, sources := stats.dirty, stats.sources
+	stats.dirty, stats.sources = ClickStats{"docs": 3}, nil
+	stats.mu.Unlock()
+	t.Cleanup(func() {
+		stats.mu.Lock()
+		stats.dirty, stats.sources = dirty, sources
+		stats.mu.Unlock()
+	})
+
+	countClickSource("docs", "design", "https://wiki.example.com/page")
+	countClickSource("docs", "design", "https://wiki.example.com/other")
+	countClickSource("docs", "", "")
+	countClickSource("dropped", "design", "")
+
+	want := ClickSources{"docs": {{Path: "design", Referrer: "wiki.example.com"}: 2}}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if !maps.EqualFunc(stats.sources, want, maps.Equal) {
+		t.Errorf("sources = %v; want %v", stats.sources, want)
+	}
+}
+
+func TestParseStatsTimezone(t *testing.T) {
+	for _, name := range []string{"UTC", "America/New_York", "Asia/Kolkata"} {
+		if loc, err := parseStatsTimezone(name); err != nil || loc.String() != name {
+			t.Errorf("parseStatsTimezone(%q) = %v, %v; want %s", name, loc, err, name)
+		}
+	}
+	for _, name := range []string{"", "Local", "Mars/Olympus_Mons"} {
+		if _, err := parseStatsTimezone(name); err == nil {
+			t.Errorf("parseStatsTimezone(%q) succeeded; want error", name)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := make([]int, 2*allPageSize+50)
+	for i := range items {
+		items[i] = i
+	}
+	tests := []struct {
+		url       string
+		wantFirst int
+		wantLen   int
+		want      pagination
+	}{
+		{
+			url:       "/.all",
+			wantFirst: 0,
+			wantLen:   allPageSize,
+			want:      pagination{Total: len(items), Page: 1, Pages: 3, NextURL: "/.all?page=2"},
+		},
+		{
+			url:       "/.all?sort=clicks&page=2",
+			wantFirst: allPageSize,
+			wantLen:   allPageSize,
+			want:      pagination{Total: len(items), Page: 2, Pages: 3, PrevURL: "/.all?page=1&sort=clicks", NextURL: "/.all?page=3&sort=clicks"},
+		},
+		{
+			url:       "/.lists/stale?page=9",
+			wantFirst: 2 * allPageSize,
+			wantLen:   50,
+			want:      pagination{Total: len(items), Page: 3, Pages: 3, PrevURL: "/.lists/stale?page=2"},
+		},
+		{
+			url:       "/.all?page=bogus",
+			wantFirst: 0,
+			wantLen:   allPageSize,
+			want:      pagination{Total: len(items), Page: 1, Pages: 3, NextURL: "/.all?page=2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, p := paginate(httptest.NewRequest("GET", tt.url, nil), items)
+			if len(got) != tt.wantLen || got[0] != tt.wantFirst {
+				t.Errorf("paginate items = %d starting at %d; want %d starting at %d", len(got), got[0], tt.wantLen, tt.wantFirst)
+			}
+			if p != tt.want {
+				t.Errorf("paginate = %+v; want %+v", p, tt.want)
+			}
+		})
+	}
+
+	got, p := paginate(httptest.NewRequest("GET", "/.all", nil), []int(nil))
+	if len(got) != 0 || p.Pages != 1 || p.PrevURL != "" || p.NextURL != "" {
+		t.Errorf("paginate(nil) = %v, %+v; want one empty page", got, p)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	golinkv1 "github.com/tailscale/golink/proto/golink/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The golink.v1 gRPC service (see proto/golink/v1/golink.proto) is served
+// on --grpc-listen. Each call is made as the equivalent request to the JSON
+// API, from the caller's address and with its metadata as headers, so that
+// callers are identified, authorized, and limited to their API token's
+// scopes just as they are over HTTP.
+
+// grpcServer implements golinkv1.GolinkServiceServer.
+type grpcServer struct {
+	golinkv1.UnimplementedGolinkServiceServer
+	h http.Handler // the JSON API, usually serveHandler
+}
+
+// newGRPCServer returns a gRPC server for the golink.v1 service, which
+// makes its calls to h.
+func newGRPCServer(h http.Handler) *grpc.Server {
+	s := grpc.NewServer()
+	golinkv1.RegisterGolinkServiceServer(s, &grpcServer{h: h})
+	return s
+}
+
+// serveGRPC serves the golink.v1 service on ln until it is closed.
+func serveGRPC(ln net.Listener, h http.Handler) {
+	log.Printf("Serving gRPC on %s ...", ln.Addr())
+	if err := newGRPCServer(h).Serve(ln); err != nil {
+		log.Fatalf("--grpc-listen: %v", err)
+	}
+}
+
+// grpcResponse records the response of a JSON API request made for an RPC.
+type grpcResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *grpcResponse) Header() http.Header { return w.header }
+
+func (w *grpcResponse) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *grpcResponse) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// grpcCodes are the gRPC status codes of JSON API error responses.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusMethodNotAllowed:      codes.FailedPrecondition, // read-only mode
+	http.StatusConflict:              codes.Aborted,
+	http.StatusRequestEntityTooLarge: codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusLoopDetected:          codes.FailedPrecondition,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// grpcHeaderSkip reports whether the incoming metadata key k is part of the
+// gRPC protocol rather than a header to pass on to the JSON API.
+func grpcHeaderSkip(k string) bool {
+	return strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") ||
+		k == "content-type" || k == "te" || k == "user-agent"
+}
+
+// call makes the JSON API request method path?query, with the JSON
+// encoding of body if it is not nil, as the caller of the RPC in ctx, and
+// decodes the JSON response into resp if it is not nil. It returns the
+// response headers.
+func (s *grpcServer) call(ctx context.Context, method, path string, query url.Values, body, resp any) (http.Header, error) {
+	var rb io.Reader = http.NoBody
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		rb = bytes.NewReader(b)
+	}
+	u := &url.URL{Path: path, RawQuery: query.Encode()}
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), rb)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	r.Host = *hostname
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		if grpcHeaderSkip(k) {
+			continue
+		}
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	// browsers can't make gRPC calls, so they can't be forged cross-site
+	r.Header.Set(secHeaderName, "1")
+
+	w := &grpcResponse{header: make(http.Header)}
+	s.h.ServeHTTP(w, r)
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if w.code >= 400 {
+		var e apiError
+		if json.Unmarshal(w.body.Bytes(), &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(w.body.String())
+		}
+		code, ok := grpcCodes[w.code]
+		if !ok {
+			code = codes.Internal
+		}
+		return nil, status.Error(code, e.Error)
+	}
+	if resp != nil {
+		if err := json.Unmarshal(w.body.Bytes(), resp); err != nil {
+			return nil, status.Errorf(codes.Internal, "decoding %s response: %v", path, err)
+		}
+	}
+	return w.header, nil
+}
+
+// linkPath returns the JSON API path of the link short.
+func linkPath(short string) (string, error) {
+	if short == "" || strings.Contains(short, "/") {
+		return "", status.Error(codes.InvalidArgument, "invalid short name")
+	}
+	return "/.api/v1/links/" + url.PathEscape(short), nil
+}
+
+func (s *grpcServer) ResolveLink(ctx context.Context, req *golinkv1.ResolveLinkRequest) (*golinkv1.ResolveLinkResponse, error) {
+	query := url.Values{"short": {req.Short}}
+	if req.Path != "" {
+		query.Set("path", req.Path)
+	}
+	if req.Query != "" {
+		query.Set("query", req.Query)
+	}
+	var resp apiResolveResponse
+	if _, err := s.call(ctx, "GET", "/.api/v1/resolve", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &golinkv1.ResolveLinkResponse{Url: resp.URL}, nil
+}
+
+func (s *grpcServer) GetLink(ctx context.Context, req *golinkv1.GetLinkRequest) (*golinkv1.Link, error) {
+	path, err := linkPath(req.Short)
+	if err != nil {
+		return nil, err
+	}
+	var link Link
+	if _, err := s.call(ctx, "GET", path, nil, nil, &link); err != nil {
+		return nil, err
+	}
+	return linkProto(&link), nil
+}
+
+func (s *grpcServer) ListLinks(ctx context.Context, req *golinkv1.ListLinksRequest) (*golinkv1.ListLinksResponse, error) {
+	query := url.Values{}
+	for k, v := range map[string]string{"q": req.Q, "health": req.Health, "sort": req.Sort, "after": req.After} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if req.Limit != 0 {
+		query.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+	var links []*Link
+	h, err := s.call(ctx, "GET", "/.api/v1/links", query, nil, &links)
+	if err != nil {
+		return nil, err
+	}
+	resp := &golinkv1.ListLinksResponse{}
+	for _, link := range links {
+		resp.Links = append(resp.Links, linkProto(link))
+	}
+	// the next page's URL is in the Link header, as <url>; rel="next"
+	if next, ok := strings.CutSuffix(h.Get("Link"), `>; rel="next"`); ok {
+		if u, err := url.Parse(strings.TrimPrefix(next, "<")); err == nil {
+			resp.NextAfter = u.Query().Get("after")
+		}
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) PutLink(ctx context.Context, req *golinkv1.PutLinkRequest) (*golinkv1.Link, error) {
+	path, err := linkPath(req.Short)
+	if err != nil {
+		return nil, err
+	}
+	body := &apiLinkRequest{
+		Long:              req.Long,
+		Owner:             req.Owner,
+		MaintenanceTarget: req.MaintenanceTarget,
+		Successor:         req.Successor,
+		Params:            req.Params,
+		HealthCheck:       req.HealthCheck,
+		Expires:           req.Expires,
+		Version:           int(req.Version),
+	}
+	if req.Tags != nil {
+		body.Tags = &req.Tags.Values
+	}
+	if req.CoOwners != nil {
+		body.CoOwners = &req.CoOwners.Values
+	}
+	if req.Fallbacks != nil {
+		body.Fallbacks = &req.Fallbacks.Values
+	}
+	if req.Headers != nil {
+		body.Headers = &req.Headers.Values
+	}
+	if req.MaxUses != nil {
+		n := int(*req.MaxUses)
+		body.MaxUses = &n
+	}
+	if req.IdempotencyKey != "" {
+		// sent as the Idempotency-Key header
+		md, _ := metadata.FromIncomingContext(ctx)
+		md = md.Copy()
+		md.Set("idempotency-key", req.IdempotencyKey)
+		ctx = metadata.NewIncomingContext(ctx, md)
+	}
+	var link Link
+	if _, err := s.call(ctx, "PUT", path, nil, body, &link); err != nil {
+		return nil, err
+	}
+	return linkProto(&link), nil
+}
+
+func (s *grpcServer) DeleteLink(ctx context.Context, req *golinkv1.DeleteLinkRequest) (*golinkv1.DeleteLinkResponse, error) {
+	path, err := linkPath(req.Short)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.call(ctx, "DELETE", path, nil, nil, nil); err != nil {
+		return nil, err
+	}
+	return &golinkv1.DeleteLinkResponse{}, nil
+}
+
+func (s *grpcServer) GetStats(ctx context.Context, req *golinkv1.GetStatsRequest) (*golinkv1.GetStatsResponse, error) {
+	path, err := linkPath(req.Short)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{}
+	if req.By != "" {
+		query.Set("by", req.By)
+	}
+	if req.Days != 0 {
+		query.Set("days", strconv.Itoa(int(req.Days)))
+	}
+	if req.Tz != "" {
+		query.Set("tz", req.Tz)
+	}
+	var clicks struct {
+		Clicks []ClickCount
+	}
+	if _, err := s.call(ctx, "GET", path+"/clicks", query, nil, &clicks); err != nil {
+		return nil, err
+	}
+	// the breakdown is read after flushing stats, so the link's total is
+	// current too
+	var link Link
+	if _, err := s.call(ctx, "GET", path, nil, nil, &link); err != nil {
+		return nil, err
+	}
+	resp := &golinkv1.GetStatsResponse{TotalClicks: int64(link.TotalClicks)}
+	for i, c := range clicks.Clicks {
+		if req.Limit > 0 && i == int(req.Limit) {
+			break
+		}
+		resp.Counts = append(resp.Counts, &golinkv1.GetStatsResponse_Count{Value: c.Value, Clicks: int32(c.Clicks)})
+	}
+	return resp, nil
+}
+
+// linkProto returns link as a golink.v1 Link.
+func linkProto(link *Link) *golinkv1.Link {
+	return &golinkv1.Link{
+		Short:             link.Short,
+		Long:              link.Long,
+		Owner:             link.Owner,
+		Created:           timestampProto(link.Created),
+		LastEdit:          timestampProto(link.LastEdit),
+		Tags:              link.Tags,
+		CoOwners:          link.CoOwners,
+		Fallbacks:         link.Fallbacks,
+		MaintenanceTarget: link.MaintenanceTarget,
+		Successor:         link.Successor,
+		Deprecated:        timestampProto(link.Deprecated),
+		Expires:           timestampProto(link.Expires),
+		Headers:           link.Headers,
+		Params:            link.Params,
+		MaxUses:           int32(link.MaxUses),
+		Uses:              int32(link.Uses),
+		Version:           int32(link.Version),
+		AutoCreated:       link.AutoCreated,
+		HealthCheck:       link.HealthCheck,
+	}
+}
+
+// timestampProto returns t as a Timestamp, or nil if t is zero.
+func timestampProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	golinkv1 "github.com/tailscale/golink/proto/golink/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCServer(t *testing.T) {
+	var got *http.Request
+	var gotBody string
+	s := &grpcServer{h: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		switch r.URL.Path {
+		case "/.api/v1/links":
+			w.Header().Set("Link", `</.api/v1/links?after=b&limit=2>; rel="next"`)
+			json.NewEncoder(w).Encode([]*Link{{Short: "a"}, {Short: "b"}})
+		case "/.api/v1/links/wiki":
+			json.NewEncoder(w).Encode(&Link{Short: "wiki", Long: "https://wiki.example.com/", Version: 2})
+		default:
+			serveAPI(w, r, 0, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "cannot edit link", http.StatusForbidden)
+			})
+		}
+	})}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"authorization", "Bearer secret",
+		"content-type", "application/grpc",
+	))
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort("100.64.0.1:1234"))})
+
+	list, err := s.ListLinks(ctx, &golinkv1.ListLinksRequest{Q: "tag:docs", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Links) != 2 || list.NextAfter != "b" {
+		t.Errorf("ListLinks = %v; want 2 links and next_after b", list)
+	}
+	if q := got.URL.Query(); q.Get("q") != "tag:docs" || q.Get("limit") != "2" {
+		t.Errorf("ListLinks query = %q", got.URL.RawQuery)
+	}
+	if got.RemoteAddr != "100.64.0.1:1234" {
+		t.Errorf("RemoteAddr = %q; want the caller's address", got.RemoteAddr)
+	}
+	if got.Header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("Authorization = %q; want the call's metadata", got.Header.Get("Authorization"))
+	}
+
+	link, err := s.PutLink(ctx, &golinkv1.PutLinkRequest{
+		Short:          "wiki",
+		Long:           "https://wiki.example.com/",
+		Tags:           &golinkv1.PutLinkRequest_Strings{Values: []string{"docs"}},
+		IdempotencyKey: "k1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Short != "wiki" || link.Version != 2 {
+		t.Errorf("PutLink = %v", link)
+	}
+	if got.Method != "PUT" || got.Header.Get("Content-Type") != "application/json" || got.Header.Get("Idempotency-Key") != "k1" {
+		t.Errorf("PutLink made %s with headers %v", got.Method, got.Header)
+	}
+	var req apiLinkRequest
+	if err := json.Unmarshal([]byte(gotBody), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Tags == nil || len(*req.Tags) != 1 || req.Successor != nil {
+		t.Errorf("PutLink body = %s; want only the fields set", gotBody)
+	}
+
+	_, err = s.DeleteLink(ctx, &golinkv1.DeleteLinkRequest{Short: "other"})
+	if st := status.Convert(err); st.Code() != codes.PermissionDenied || st.Message() != "cannot edit link" {
+		t.Errorf("DeleteLink error = %v; want PermissionDenied", err)
+	}
+	if _, err := s.GetLink(ctx, &golinkv1.GetLinkRequest{Short: "a/b"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetLink(a/b) error = %v; want InvalidArgument", err)
+	}
+}
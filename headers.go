@@ -0,0 +1,92 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// allowedLinkHeaders is the set of canonical header names that links may
+// set on their redirects, from --link-headers.
+var allowedLinkHeaders map[string]bool
+
+// parseHeaderAllowlist parses a comma-separated list of header names.
+func parseHeaderAllowlist(s string) (map[string]bool, error) {
+	allowed := make(map[string]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		allowed[http.CanonicalHeaderKey(name)] = true
+	}
+	return allowed, nil
+}
+
+// parseLinkHeaders parses headers of a link from "Name: value" lines,
+// ignoring blank lines. Header names are canonicalized.
+func parseLinkHeaders(s string) (map[string]string, error) {
+	var headers map[string]string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf(`invalid header %q; want "Name: value"`, line)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return nil, fmt.Errorf("invalid value for header %s", name)
+		}
+		if headers == nil {
+			headers = make(map[string]string)
+		}
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+	return headers, nil
+}
+
+// formatLinkHeaders formats headers as "Name: value" lines, sorted by name.
+// It is the inverse of parseLinkHeaders.
+func formatLinkHeaders(headers map[string]string) string {
+	var lines []string
+	for name, value := range headers {
+		lines = append(lines, name+": "+value)
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "\n")
+}
+
+// checkLinkHeaders returns an error if headers includes a header that links
+// are not allowed to set.
+func checkLinkHeaders(headers map[string]string) error {
+	for name := range headers {
+		if !allowedLinkHeaders[name] {
+			return fmt.Errorf("links may not set the %s header; allowed headers are set with --link-headers", name)
+		}
+	}
+	return nil
+}
+
+// setLinkHeaders adds the headers of link to w. Headers that are no longer
+// allowed are skipped, so that narrowing --link-headers takes effect on
+// existing links. One-time links keep the Cache-Control set by useLink.
+func setLinkHeaders(w http.ResponseWriter, link *Link) {
+	for name, value := range link.Headers {
+		if !allowedLinkHeaders[name] || name == "Cache-Control" && link.MaxUses > 0 {
+			continue
+		}
+		w.Header().Set(name, value)
+	}
+}
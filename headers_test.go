@@ -0,0 +1,85 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLinkHeaders(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{
+			in:   "cache-control: max-age=60\n\n X-Robots-Tag:noindex ",
+			want: map[string]string{"Cache-Control": "max-age=60", "X-Robots-Tag": "noindex"},
+		},
+		{in: "Cache-Control", wantErr: true},
+		{in: "Bad Header: x", wantErr: true},
+		{in: "X-Tracking: a\x00b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLinkHeaders(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLinkHeaders(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseLinkHeaders(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+		if err == nil {
+			again, _ := parseLinkHeaders(formatLinkHeaders(got))
+			if diff := cmp.Diff(got, again); diff != "" {
+				t.Errorf("formatLinkHeaders(%q) does not round trip (-want +got):\n%s", tt.in, diff)
+			}
+		}
+	}
+}
+
+func TestLinkHeadersAllowlist(t *testing.T) {
+	oldAllowed := allowedLinkHeaders
+	defer func() { allowedLinkHeaders = oldAllowed }()
+
+	var err error
+	allowedLinkHeaders, err = parseHeaderAllowlist("cache-control, X-Tracking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLinkHeaders(map[string]string{"Cache-Control": "no-store", "X-Tracking": "1"}); err != nil {
+		t.Errorf("checkLinkHeaders of allowed headers: %v", err)
+	}
+	if err := checkLinkHeaders(map[string]string{"Set-Cookie": "a=b"}); err == nil {
+		t.Error("checkLinkHeaders(Set-Cookie) succeeded; want error")
+	}
+
+	// headers removed from the allowlist are no longer served
+	allowedLinkHeaders, _ = parseHeaderAllowlist("X-Tracking")
+	w := httptest.NewRecorder()
+	setLinkHeaders(w, &Link{Headers: map[string]string{"Cache-Control": "no-store", "X-Tracking": "1"}})
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("Cache-Control = %q; want unset", got)
+	}
+	if got := w.Header().Get("X-Tracking"); got != "1" {
+		t.Errorf("X-Tracking = %q; want %q", got, "1")
+	}
+
+	// one-time links are never cached, whatever their headers say
+	allowedLinkHeaders, _ = parseHeaderAllowlist("Cache-Control")
+	w = httptest.NewRecorder()
+	w.Header().Set("Cache-Control", "no-store")
+	setLinkHeaders(w, &Link{MaxUses: 1, Headers: map[string]string{"Cache-Control": "max-age=3600"}})
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control of one-time link = %q; want %q", got, "no-store")
+	}
+
+	if _, err := parseHeaderAllowlist("Good,Bad Header"); err == nil {
+		t.Error(`parseHeaderAllowlist("Good,Bad Header") succeeded; want error`)
+	}
+}
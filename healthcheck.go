@@ -0,0 +1,174 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// healthCheck is a parsed Link.HealthCheck, which overrides how the dead
+// link checker checks a link's destination.
+type healthCheck struct {
+	off    bool   // the destination isn't checked, and is never flagged broken
+	status int    // if set, the only status a healthy destination responds with
+	auth   string // name of the --link-check-auth-file credential sent with checks
+}
+
+// healthCheckOff is the Link.HealthCheck of links that opt out of checks.
+const healthCheckOff = "off"
+
+// parseHealthCheck parses a Link.HealthCheck: empty for the default check,
+// "off", or "status=NNN" and "auth=NAME" separated by spaces. Targets
+// behind single sign-on, which redirect to a login page, can be checked
+// with "status=302", in which case redirects aren't followed.
+func parseHealthCheck(s string) (healthCheck, error) {
+	var hc healthCheck
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, healthCheckOff) {
+		hc.off = true
+		return hc, nil
+	}
+	for _, f := range strings.Fields(s) {
+		k, v, _ := strings.Cut(f, "=")
+		switch strings.ToLower(k) {
+		case "status":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 200 || n > 499 {
+				return hc, fmt.Errorf("health check status %q must be a status code from 200 to 499", v)
+			}
+			hc.status = n
+		case "auth":
+			if v == "" {
+				return hc, errors.New("health check auth must name a credential")
+			}
+			hc.auth = v
+		default:
+			return hc, fmt.Errorf(`unknown health check option %q: use "off", "status=NNN", or "auth=NAME"`, f)
+		}
+	}
+	return hc, nil
+}
+
+// String returns hc in the form stored as Link.HealthCheck.
+func (hc healthCheck) String() string {
+	if hc.off {
+		return healthCheckOff
+	}
+	var fields []string
+	if hc.status != 0 {
+		fields = append(fields, "status="+strconv.Itoa(hc.status))
+	}
+	if hc.auth != "" {
+		fields = append(fields, "auth="+hc.auth)
+	}
+	return strings.Join(fields, " ")
+}
+
+// linkCheckCredential is a header sent by the dead link checker to check
+// destinations that need authentication, such as a service account's
+// token. It is only sent to its hosts, so that link owners can't send it
+// elsewhere.
+type linkCheckCredential struct {
+	hosts       []string // hostnames, or "*.example.com" for any subdomain
+	name, value string   // the header
+}
+
+// linkCheckAuth are the credentials in --link-check-auth-file, by name.
+var linkCheckAuth map[string]*linkCheckCredential
+
+// parseLinkCheckAuth parses --link-check-auth-file, which has a credential
+// per line: its name, a comma-separated list of hosts it may be sent to,
+// and the header, such as:
+//
+//	okta wiki.example.com,*.corp.example.com Authorization: Bearer abc123
+func parseLinkCheckAuth(r io.Reader) (map[string]*linkCheckCredential, error) {
+	creds := make(map[string]*linkCheckCredential)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: want name, hosts, and header", n)
+		}
+		name, value, ok := strings.Cut(fields[2], ":")
+		name, value = http.CanonicalHeaderKey(strings.TrimSpace(name)), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf(`line %d: header must be "Name: value"`, n)
+		}
+		if _, ok := creds[fields[0]]; ok {
+			return nil, fmt.Errorf("line %d: credential %q listed twice", n, fields[0])
+		}
+		c := &linkCheckCredential{name: name, value: value}
+		for _, h := range strings.Split(fields[1], ",") {
+			if h == "" || strings.Contains(strings.TrimPrefix(h, "*."), "*") {
+				return nil, fmt.Errorf("line %d: invalid host %q", n, h)
+			}
+			c.hosts = append(c.hosts, strings.ToLower(h))
+		}
+		creds[fields[0]] = c
+	}
+	return creds, s.Err()
+}
+
+// allows reports whether the credential may be sent to host.
+func (c *linkCheckCredential) allows(host string) bool {
+	return matchHost(c.hosts, host)
+}
+
+// checkHealthCheck returns an error if hc can't be used to check long, such
+// as if it names a credential that may not be sent to long's host.
+func checkHealthCheck(hc healthCheck, long string) error {
+	if hc.auth == "" {
+		return nil
+	}
+	c := linkCheckAuth[hc.auth]
+	if c == nil {
+		return fmt.Errorf("unknown health check credential %q", hc.auth)
+	}
+	u, err := url.Parse(long)
+	if err != nil || !c.allows(u.Hostname()) {
+		return fmt.Errorf("health check credential %q can't be sent to the destination's host", hc.auth)
+	}
+	return nil
+}
+
+// linkHealthCheck returns the health check of link, treating invalid
+// health checks, which Save doesn't allow, as the default.
+func linkHealthCheck(link *Link) healthCheck {
+	hc, _ := parseHealthCheck(link.HealthCheck)
+	return hc
+}
+
+// healthCheckClient returns the client used to check target u with hc.
+// Redirects aren't followed when hc expects a redirect, and credentials
+// aren't sent to other hosts when following redirects.
+func healthCheckClient(client *http.Client, u *url.URL, hc healthCheck) *http.Client {
+	if hc.status < 300 && hc.auth == "" {
+		return client
+	}
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if hc.status >= 300 && hc.status < 400 {
+			return http.ErrUseLastResponse
+		}
+		if !strings.EqualFold(req.URL.Hostname(), u.Hostname()) {
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &c
+}
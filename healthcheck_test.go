@@ -0,0 +1,119 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseHealthCheck(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"off", "off", false},
+		{" OFF ", "off", false},
+		{"status=302", "status=302", false},
+		{"auth=okta  Status=200", "status=200 auth=okta", false},
+		{"status=404", "status=404", false},
+		{"status=500", "", true},
+		{"status=abc", "", true},
+		{"auth=", "", true},
+		{"off status=302", "", true},
+		{"timeout=5s", "", true},
+	}
+	for _, tt := range tests {
+		hc, err := parseHealthCheck(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHealthCheck(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && hc.String() != tt.want {
+			t.Errorf("parseHealthCheck(%q) = %q; want %q", tt.in, hc.String(), tt.want)
+		}
+	}
+}
+
+func TestParseLinkCheckAuth(t *testing.T) {
+	creds, err := parseLinkCheckAuth(strings.NewReader(`
+# credentials for the dead link checker
+okta wiki.example.com,*.corp.example.com authorization: Bearer abc 123
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := creds["okta"]
+	if c == nil || c.name != "Authorization" || c.value != "Bearer abc 123" {
+		t.Fatalf("okta = %+v; want Authorization: Bearer abc 123", c)
+	}
+	for host, want := range map[string]bool{
+		"wiki.example.com":      true,
+		"WIKI.example.com":      true,
+		"jira.corp.example.com": true,
+		"corp.example.com":      false,
+		"evilcorp.example.com":  false,
+		"example.com":           false,
+		"wiki.example.com.evil": false,
+	} {
+		if got := c.allows(host); got != want {
+			t.Errorf("allows(%q) = %v; want %v", host, got, want)
+		}
+	}
+
+	for _, bad := range []string{
+		"okta wiki.example.com",
+		"okta wiki.example.com Authorization",
+		"okta wiki.example.com : value",
+		"okta *.*.example.com Authorization: x",
+		"okta a.example.com X: 1\nokta b.example.com X: 2",
+	} {
+		if _, err := parseLinkCheckAuth(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseLinkCheckAuth(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestCheckHealthCheck(t *testing.T) {
+	oldAuth := linkCheckAuth
+	t.Cleanup(func() { linkCheckAuth = oldAuth })
+	linkCheckAuth = map[string]*linkCheckCredential{
+		"okta": {hosts: []string{"wiki.example.com"}, name: "Authorization", value: "Bearer abc"},
+	}
+	tests := []struct {
+		hc, long string
+		wantErr  bool
+	}{
+		{"", "https://anywhere.example.com/", false},
+		{"status=302", "https://anywhere.example.com/", false},
+		{"auth=okta", "https://wiki.example.com/page", false},
+		{"auth=okta", "https://attacker.example.net/", true},
+		{"auth=missing", "https://wiki.example.com/", true},
+	}
+	for _, tt := range tests {
+		hc, err := parseHealthCheck(tt.hc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkHealthCheck(hc, tt.long); (err != nil) != tt.wantErr {
+			t.Errorf("checkHealthCheck(%q, %q) = %v; want error %v", tt.hc, tt.long, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTargetHealthCheck(t *testing.T) {
+	links := []*Link{
+		{Short: "zeta", HealthCheck: "status=200"},
+		{Short: "beta"},
+		{Short: "gamma", HealthCheck: "status=302"},
+	}
+	if got := targetHealthCheck(links).String(); got != "status=302" {
+		t.Errorf("targetHealthCheck = %q; want status=302", got)
+	}
+	if got := targetHealthCheck(nil).String(); got != "" {
+		t.Errorf("targetHealthCheck(nil) = %q; want default", got)
+	}
+}
@@ -0,0 +1,365 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldChange is a change to one field of a link between two revisions.
+// Tags report the tags that were added and removed, and other fields report
+// their old and new values.
+type FieldChange struct {
+	Field   string   // "Short", "Long", "Owner", "Tags", or "Deleted"
+	Old     string   `json:",omitempty"`
+	New     string   `json:",omitempty"`
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+}
+
+// RevisionDiff is the set of changes between two revisions of a link.
+type RevisionDiff struct {
+	Short   string
+	From    int
+	To      int
+	Changes []FieldChange
+}
+
+// revisionAt returns the revision in revs, which are sorted oldest first,
+// that was in effect at t. It returns nil if the link did not exist yet.
+func revisionAt(revs []*LinkRevision, t time.Time) *LinkRevision {
+	var rev *LinkRevision
+	for _, r := range revs {
+		if r.Edited.After(t) {
+			break
+		}
+		rev = r
+	}
+	return rev
+}
+
+// diffRevisions returns the changes from revision a to revision b.
+func diffRevisions(a, b *LinkRevision) RevisionDiff {
+	d := RevisionDiff{Short: b.Short, From: a.Revision, To: b.Revision}
+	for _, f := range []struct{ name, old, new string }{
+		{"Short", a.Short, b.Short},
+		{"Long", a.Long, b.Long},
+		{"Owner", a.Owner, b.Owner},
+	} {
+		if f.old != f.new {
+			d.Changes = append(d.Changes, FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	var tags FieldChange
+	for _, t := range b.Tags {
+		if !slices.Contains(a.Tags, t) {
+			tags.Added = append(tags.Added, t)
+		}
+	}
+	for _, t := range a.Tags {
+		if !slices.Contains(b.Tags, t) {
+			tags.Removed = append(tags.Removed, t)
+		}
+	}
+	if len(tags.Added) > 0 || len(tags.Removed) > 0 {
+		tags.Field = "Tags"
+		d.Changes = append(d.Changes, tags)
+	}
+	if a.Deleted != b.Deleted {
+		d.Changes = append(d.Changes, FieldChange{
+			Field: "Deleted",
+			Old:   strconv.FormatBool(a.Deleted),
+			New:   strconv.FormatBool(b.Deleted),
+		})
+	}
+	return d
+}
+
+// findRevision returns the revision numbered n in revs.
+func findRevision(revs []*LinkRevision, n int) (*LinkRevision, error) {
+	for _, r := range revs {
+		if r.Revision == n {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("revision %d: %w", n, fs.ErrNotExist)
+}
+
+// historyEntry is a revision of a link as listed on its detail page.
+type historyEntry struct {
+	*LinkRevision
+	OldLong string // Long in the previous revision, or "" for the first
+	Current bool   // the revision in effect now, which cannot be reverted to
+}
+
+// historyEntries returns the revisions revs, which are sorted oldest first,
+// as entries for the detail page, newest first.
+func historyEntries(revs []*LinkRevision) []historyEntry {
+	entries := make([]historyEntry, len(revs))
+	for i, r := range revs {
+		e := historyEntry{LinkRevision: r}
+		if i > 0 && !revs[i-1].Deleted {
+			e.OldLong = revs[i-1].Long
+		}
+		e.Current = i == len(revs)-1 && !r.Deleted
+		entries[len(revs)-1-i] = e
+	}
+	return entries
+}
+
+// restoreRevision returns link as it was at revision rev of its history
+// revs, keeping the fields that history does not record. If link is nil
+// because the link has since been deleted, it is recreated with the
+// creation time of the revision's first version.
+func restoreRevision(link *Link, revs []*LinkRevision, rev *LinkRevision, now time.Time) *Link {
+	if link == nil {
+		link = new(Link)
+		for _, r := range revs {
+			if r.Revision > rev.Revision {
+				break
+			}
+			if r.Deleted {
+				link.Created = time.Time{}
+			} else if link.Created.IsZero() {
+				link.Created = r.Edited
+			}
+		}
+	} else {
+		restored := *link
+		link = &restored
+	}
+	link.Short = rev.Short
+	link.Long = rev.Long
+	link.RawLong = ""
+	link.Owner = rev.Owner
+	link.Tags = slices.Clone(rev.Tags)
+	link.LastEdit = now
+	return link
+}
+
+// serveHistory returns the history of a link as JSON. With an "at" parameter
+// (a date, RFC 3339 time, or age like "7d"), it instead returns the revision
+// that was in effect at that time, answering questions like "where did
+// go/alerts point last Tuesday?". With "from" and/or "to" revision numbers,
+// it returns a RevisionDiff between them; "to" defaults to the latest
+// revision and "from" to the revision before "to".
+func serveHistory(w http.ResponseWriter, r *http.Request) {
+	short := strings.TrimPrefix(r.URL.Path, "/.history/")
+	if short == "" {
+		http.Error(w, "link name required", http.StatusBadRequest)
+		return
+	}
+	if r.Method == "POST" {
+		serveRestore(w, r, short)
+		return
+	}
+
+	revs, err := db.LoadHistory(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	var v any = revs
+	if query.Has("from") || query.Has("to") {
+		to := revs[len(revs)-1].Revision
+		if s := query.Get("to"); s != "" {
+			if to, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid to revision", http.StatusBadRequest)
+				return
+			}
+		}
+		from := to - 1
+		if s := query.Get("from"); s != "" {
+			if from, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid from revision", http.StatusBadRequest)
+				return
+			}
+		}
+		a, err := findRevision(revs, from)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		b, err := findRevision(revs, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		v = diffRevisions(a, b)
+	} else if at := query.Get("at"); at != "" {
+		t, err := parseQueryTime(at, time.Now().UTC())
+		if err != nil {
+			http.Error(w, "invalid at time: use YYYY-MM-DD, RFC 3339, or an age like 7d", http.StatusBadRequest)
+			return
+		}
+		rev := revisionAt(revs, t)
+		if rev == nil || rev.Deleted {
+			http.Error(w, short+" did not exist at "+t.Format(time.RFC3339), http.StatusNotFound)
+			return
+		}
+		v = rev
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// serveRestore restores the target, owner, and tags of a single link to a
+// revision of its history, given by its number in the "revision" parameter
+// or as the revision in effect at the time in the "at" parameter. A deleted
+// link is recreated. Other links and the link's other fields are left
+// alone. Anyone who can edit the link may restore it, but only admins may
+// recreate deleted links.
+func serveRestore(w http.ResponseWriter, r *http.Request, short string) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now().UTC()
+	var (
+		t      time.Time
+		number int
+	)
+	if s := r.FormValue("revision"); s != "" {
+		var err error
+		if number, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "invalid revision", http.StatusBadRequest)
+			return
+		}
+	} else if at := r.FormValue("at"); at != "" {
+		var err error
+		if t, err = parseQueryTime(at, now); err != nil {
+			http.Error(w, "invalid at time: use YYYY-MM-DD, RFC 3339, or an age like 7d", http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, "revision or at required", http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	revs, err := db.LoadHistory(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var rev *LinkRevision
+	if number > 0 {
+		if rev, err = findRevision(revs, number); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if rev.Deleted {
+			http.Error(w, fmt.Sprintf("revision %d of %s is a deletion", number, short), http.StatusBadRequest)
+			return
+		}
+	} else {
+		rev = revisionAt(revs, t)
+		if rev == nil || rev.Deleted {
+			http.Error(w, short+" did not exist at "+t.Format(time.RFC3339), http.StatusNotFound)
+			return
+		}
+	}
+	link, err := db.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		link = nil
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if link == nil && !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", short, "restore")
+		http.Error(w, "only admins can restore deleted links", http.StatusForbidden)
+		return
+	}
+	if link != nil && !authz.canEdit(r.Context(), cu, link) {
+		audit(r, cu, "access.denied", short, "restore")
+		http.Error(w, fmt.Sprintf("cannot restore link owned by %q", link.Owner), http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, ".restore") {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	restored := restoreRevision(link, revs, rev, now)
+	restored.Editor = editor
+	action := "edit"
+	if link == nil {
+		action = "create"
+		err = db.Create(restored)
+	} else {
+		err = db.Update(restored)
+	}
+	var conflict *ConflictError
+	if errors.Is(err, fs.ErrExist) || errors.As(err, &conflict) {
+		http.Error(w, short+" was changed while restoring it; try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	linkChanges.Add(action, 1)
+	linkTemplates.invalidate(restored.Short)
+	audit(r, cu, "link.restore", restored.Short, fmt.Sprintf("revision=%d", rev.Revision))
+	notifyLinkChange(cu.login, link, restored)
+
+	if acceptHTML(r) {
+		http.Redirect(w, r, "/.detail/"+restored.Short, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(restored)
+}
+
+// recentDeletion returns the revision recording the deletion of short if it
+// was deleted within --delete-cooldown of now and has not been recreated
+// since, or nil otherwise.
+func recentDeletion(short string, now time.Time) (*LinkRevision, error) {
+	if *deleteCooldown <= 0 {
+		return nil, nil
+	}
+	rev, err := db.LoadDeletion(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if now.Sub(rev.Edited) >= *deleteCooldown {
+		return nil, nil
+	}
+	return rev, nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRevisionAt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC) }
+	revs := []*LinkRevision{
+		{Revision: 1, Long: "https://grafana/old", Edited: day(1)},
+		{Revision: 2, Long: "https://grafana/new", Edited: day(10)},
+		{Revision: 3, Long: "https://grafana/new", Edited: day(20), Deleted: true},
+	}
+	tests := []struct {
+		at   time.Time
+		want int // revision, or 0 for none
+	}{
+		{at: day(1).Add(-time.Second), want: 0},
+		{at: day(1), want: 1},
+		{at: day(9), want: 1},
+		{at: day(10), want: 2},
+		{at: day(25), want: 3},
+	}
+	for _, tt := range tests {
+		got := 0
+		if rev := revisionAt(revs, tt.at); rev != nil {
+			got = rev.Revision
+		}
+		if got != tt.want {
+			t.Errorf("revisionAt(%v) = revision %d; want %d", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	a := &LinkRevision{Revision: 1, Short: "alerts", Long: "https://grafana/old", Owner: "foo@example.com", Tags: []string{"oncall", "sre"}}
+	b := &LinkRevision{Revision: 2, Short: "alerts", Long: "https://grafana/new", Owner: "foo@example.com", Tags: []string{"dashboards", "oncall"}}
+	want := RevisionDiff{
+		Short: "alerts",
+		From:  1,
+		To:    2,
+		Changes: []FieldChange{
+			{Field: "Long", Old: "https://grafana/old", New: "https://grafana/new"},
+			{Field: "Tags", Added: []string{"dashboards"}, Removed: []string{"sre"}},
+		},
+	}
+	if diff := cmp.Diff(want, diffRevisions(a, b)); diff != "" {
+		t.Errorf("diffRevisions mismatch (-want +got):\n%s", diff)
+	}
+
+	c := *b
+	c.Revision, c.Deleted = 3, true
+	got := diffRevisions(b, &c)
+	if len(got.Changes) != 1 || got.Changes[0].Field != "Deleted" {
+		t.Errorf("diffRevisions of deletion = %+v; want only Deleted change", got.Changes)
+	}
+}
+
+func TestRestoreRevision(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2023, 3, d, 0, 0, 0, 0, time.UTC) }
+	now := day(30)
+	revs := []*LinkRevision{
+		{Revision: 1, Short: "alerts", Long: "https://grafana/old", Owner: "foo@example.com", Edited: day(1)},
+		{Revision: 2, Short: "alerts", Long: "https://grafana/old", Owner: "foo@example.com", Edited: day(5), Deleted: true},
+		{Revision: 3, Short: "Alerts", Long: "https://grafana/new", Owner: "bar@example.com", Tags: []string{"oncall"}, Edited: day(10)},
+		{Revision: 4, Short: "Alerts", Long: "https://grafana/bad", Owner: "bar@example.com", Edited: day(20)},
+	}
+	current := &Link{
+		Short:    "Alerts",
+		Long:     "https://grafana/bad",
+		RawLong:  "grafana/bad",
+		Created:  day(10),
+		LastEdit: day(20),
+		Owner:    "bar@example.com",
+		Expires:  day(40),
+		Version:  2,
+	}
+
+	tests := []struct {
+		name string
+		link *Link
+		rev  int
+		want *Link
+	}{
+		{
+			name: "edited",
+			link: current,
+			rev:  3,
+			want: &Link{
+				Short:    "Alerts",
+				Long:     "https://grafana/new",
+				Created:  day(10),
+				LastEdit: now,
+				Owner:    "bar@example.com",
+				Tags:     []string{"oncall"},
+				Expires:  day(40),
+				Version:  2,
+			},
+		},
+		{
+			name: "deleted",
+			rev:  3,
+			want: &Link{
+				Short:    "Alerts",
+				Long:     "https://grafana/new",
+				Created:  day(10),
+				LastEdit: now,
+				Owner:    "bar@example.com",
+				Tags:     []string{"oncall"},
+			},
+		},
+		{
+			name: "earlier incarnation",
+			rev:  1,
+			want: &Link{
+				Short:    "alerts",
+				Long:     "https://grafana/old",
+				Created:  day(1),
+				LastEdit: now,
+				Owner:    "foo@example.com",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := restoreRevision(tt.link, revs, revs[tt.rev-1], now)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("restoreRevision mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+	if current.Long != "https://grafana/bad" {
+		t.Errorf("restoreRevision modified the current link")
+	}
+}
+
+func TestHistoryEntries(t *testing.T) {
+	revs := []*LinkRevision{
+		{Revision: 1, Long: "https://grafana/old", Editor: "foo@example.com"},
+		{Revision: 2, Long: "https://grafana/old", Deleted: true},
+		{Revision: 3, Long: "https://grafana/new", Editor: "bar@example.com"},
+		{Revision: 4, Long: "https://grafana/bad", Editor: "bar@example.com"},
+	}
+	type entry struct {
+		Revision int
+		OldLong  string
+		Current  bool
+	}
+	var got []entry
+	for _, e := range historyEntries(revs) {
+		got = append(got, entry{e.Revision, e.OldLong, e.Current})
+	}
+	want := []entry{
+		{4, "https://grafana/new", true},
+		{3, "", false}, // recreated after deletion
+		{2, "https://grafana/old", false},
+		{1, "", false},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("historyEntries mismatch (-want +got):\n%s", diff)
+	}
+
+	revs[3].Deleted = true
+	if historyEntries(revs)[0].Current {
+		t.Error("deletion is the current revision")
+	}
+}
+
+func TestDeleteCooldown(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "oncall", Long: "https://grafana/oncall", Owner: "foo@example.com"})
+	if err := db.Delete("oncall", "foo@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+	create := func(u user) int {
+		currentUser = func(*http.Request) (user, error) { return u, nil }
+		r := httptest.NewRequest("POST", "/", strings.NewReader(url.Values{
+			"short": {"oncall"},
+			"long":  {"https://evil.example.com/"},
+			"xsrf":  {xsrftoken.Generate(xsrfKey, u.login, newShortName)},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		serveSave(w, r)
+		return w.Code
+	}
+
+	if got := create(user{login: "bar@example.com"}); got != http.StatusForbidden {
+		t.Errorf("other user recreating deleted link = %d; want %d", got, http.StatusForbidden)
+	}
+
+	oldCooldown := *deleteCooldown
+	t.Cleanup(func() { *deleteCooldown = oldCooldown })
+	*deleteCooldown = 0
+	if deletion, err := recentDeletion("oncall", time.Now()); err != nil || deletion != nil {
+		t.Errorf("recentDeletion with no cooldown = %v, %v; want nil", deletion, err)
+	}
+	*deleteCooldown = oldCooldown
+	if deletion, err := recentDeletion("oncall", time.Now().Add(oldCooldown)); err != nil || deletion != nil {
+		t.Errorf("recentDeletion after cooldown = %v, %v; want nil", deletion, err)
+	}
+
+	if got := create(user{login: "foo@example.com"}); got != http.StatusOK {
+		t.Errorf("owner recreating deleted link = %d; want %d", got, http.StatusOK)
+	}
+	if deletion, err := recentDeletion("oncall", time.Now()); err != nil || deletion != nil {
+		t.Errorf("recentDeletion of recreated link = %v, %v; want nil", deletion, err)
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultHomeSectionLimit is the number of links listed in a home page
+// section that doesn't set its own Limit, except popular sections, which
+// list maxPopularLinks.
+const defaultHomeSectionLimit = 10
+
+// homeSectionPeriod is how far back "trending" and "new" sections look.
+const homeSectionPeriod = 7 * 24 * time.Hour
+
+// homeSectionKinds are the kinds of home page sections, and their default
+// titles.
+var homeSectionKinds = map[string]string{
+	"pinned":   "Pinned Links",
+	"popular":  "Popular Links",
+	"trending": "Trending This Week",
+	"yours":    "Your Links",
+	"new":      "New This Week",
+	"tag":      "", // "Links tagged TAG"
+}
+
+// flagHomeSections are the home page sections set by --home-sections, used
+// unless admins set others with /.api/v1/home-sections.
+var flagHomeSections []HomeSection
+
+// parseHomeSections parses semicolon-separated home page sections, such as
+// "pinned=docs,wiki;trending;popular;tag=onboarding". Pinned sections list
+// their links, and tag sections their tag.
+func parseHomeSections(s string) ([]HomeSection, error) {
+	var sections []HomeSection
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		kind, arg, _ := strings.Cut(spec, "=")
+		hs := HomeSection{Kind: strings.ToLower(strings.TrimSpace(kind))}
+		switch hs.Kind {
+		case "pinned":
+			hs.Links = parseCoOwners(arg)
+		case "tag":
+			hs.Tag = strings.TrimSpace(arg)
+		default:
+			if strings.TrimSpace(arg) != "" {
+				return nil, fmt.Errorf("invalid home section %q: %s sections take no value", spec, hs.Kind)
+			}
+		}
+		sections = append(sections, hs)
+	}
+	if err := checkHomeSections(sections); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// checkHomeSections reports whether sections are valid, normalizing their
+// tags. Each kind of section may appear once, except tag sections, which
+// may appear once per tag.
+func checkHomeSections(sections []HomeSection) error {
+	seen := make(map[string]bool)
+	for i := range sections {
+		hs := &sections[i]
+		if _, ok := homeSectionKinds[hs.Kind]; !ok {
+			return fmt.Errorf("unknown home section %q: want pinned, popular, trending, yours, new, or tag", hs.Kind)
+		}
+		key := hs.Kind
+		switch hs.Kind {
+		case "pinned":
+			if len(hs.Links) == 0 {
+				return errors.New("pinned section requires Links")
+			}
+			for _, short := range hs.Links {
+				if !reShortName.MatchString(short) {
+					return fmt.Errorf("pinned link %q: short may only contain letters, numbers, dash, and period", short)
+				}
+			}
+		case "tag":
+			tags := parseTags(hs.Tag)
+			if len(tags) != 1 {
+				return errors.New("tag section requires a single Tag")
+			}
+			hs.Tag = tags[0]
+			key += ":" + hs.Tag
+		default:
+			if hs.Tag != "" || len(hs.Links) > 0 {
+				return fmt.Errorf("%s section takes no Tag or Links", hs.Kind)
+			}
+		}
+		if seen[key] {
+			return fmt.Errorf("duplicate %s section", strings.ReplaceAll(key, ":", " "))
+		}
+		seen[key] = true
+		if hs.Limit < 0 || hs.Limit > maxPopularLinks {
+			return fmt.Errorf("%s section Limit must be between 0 and %d", hs.Kind, maxPopularLinks)
+		}
+		hs.Title = strings.TrimSpace(hs.Title)
+	}
+	return nil
+}
+
+// homeSectionRefresh is how long the cached home page sections are used
+// before being reloaded from db.
+const homeSectionRefresh = 30 * time.Second
+
+// homeSectionCache caches the sections set with /.api/v1/home-sections, so
+// that rendering the home page does not require an extra database query.
+var homeSectionCache struct {
+	mu       sync.Mutex
+	sections []HomeSection
+	loaded   time.Time
+}
+
+// homeSections returns the configured home page sections, in order,
+// including hidden ones. Sections set by admins replace --home-sections.
+//
+// The returned value must not be modified.
+func homeSections() []HomeSection {
+	homeSectionCache.mu.Lock()
+	defer homeSectionCache.mu.Unlock()
+	if now := time.Now(); now.Sub(homeSectionCache.loaded) >= homeSectionRefresh {
+		sections, err := db.LoadHomeSections()
+		if err != nil {
+			log.Printf("loading home sections: %v", err)
+		} else {
+			homeSectionCache.sections = sections
+			homeSectionCache.loaded = now
+		}
+	}
+	if len(homeSectionCache.sections) > 0 {
+		return homeSectionCache.sections
+	}
+	return flagHomeSections
+}
+
+// invalidateHomeSections causes the next call to homeSections to reload
+// from db.
+func invalidateHomeSections() {
+	homeSectionCache.mu.Lock()
+	defer homeSectionCache.mu.Unlock()
+	homeSectionCache.loaded = time.Time{}
+}
+
+// homeSectionLimit returns the most links listed by hs.
+func homeSectionLimit(hs HomeSection) int {
+	if hs.Kind == "popular" {
+		return cmp.Or(hs.Limit, maxPopularLinks)
+	}
+	return cmp.Or(hs.Limit, defaultHomeSectionLimit)
+}
+
+// homeLink is a link listed in a home page section.
+type homeLink struct {
+	Short     string
+	Long      string `json:",omitempty"`
+	NumClicks int
+}
+
+// homeSectionData is a home page section and the links it lists, as shown
+// to one visitor.
+type homeSectionData struct {
+	Kind  string
+	Title string
+	Tag   string     `json:",omitempty"`
+	Links []homeLink // empty for popular sections while click counts load
+
+	// Pending is set on popular sections when click counts are still
+	// loading. The home page fetches them from /.popular, and shows the
+	// first Limit.
+	Pending bool `json:",omitempty"`
+	Limit   int  `json:"-"`
+}
+
+// loadHomeSections returns the visible home page sections for cu, with the
+// links they list. Sections that can't be loaded are logged and left empty,
+// so that one failing query doesn't break the home page.
+func loadHomeSections(cu user, now time.Time) []homeSectionData {
+	var data []homeSectionData
+	for _, hs := range homeSections() {
+		if hs.Hidden || (hs.Kind == "yours" && cu.login == "") {
+			continue
+		}
+		d := homeSectionData{Kind: hs.Kind, Title: hs.Title, Tag: hs.Tag, Limit: homeSectionLimit(hs)}
+		if d.Title == "" {
+			d.Title = homeSectionKinds[hs.Kind]
+			if hs.Kind == "tag" {
+				d.Title = "Links tagged " + hs.Tag
+			}
+		}
+		var err error
+		d.Links, d.Pending, err = loadHomeSectionLinks(hs, cu, now)
+		if err != nil {
+			log.Printf("loading %s home section: %v", hs.Kind, err)
+		}
+		data = append(data, d)
+	}
+	return data
+}
+
+// loadHomeSectionLinks returns the links listed by hs for cu, and whether
+// the section's click counts are still loading.
+func loadHomeSectionLinks(hs HomeSection, cu user, now time.Time) (links []homeLink, pending bool, err error) {
+	limit := homeSectionLimit(hs)
+	if hs.Kind == "popular" {
+		select {
+		case <-statsLoaded:
+		default:
+			return nil, true, nil
+		}
+		for _, v := range popularLinks() {
+			links = append(links, homeLink{Short: v.Short, NumClicks: v.NumClicks})
+		}
+		return links[:min(len(links), limit)], false, nil
+	}
+	if hs.Kind == "trending" {
+		counts, err := db.LoadTrending(now.Add(-homeSectionPeriod), limit)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, c := range counts {
+			links = append(links, homeLink{Short: c.Value, NumClicks: c.Clicks})
+		}
+		return links, false, nil
+	}
+
+	var stored []*Link
+	switch hs.Kind {
+	case "pinned":
+		for _, short := range hs.Links {
+			link, err := db.Load(short)
+			if err != nil {
+				// pinned links that have since been deleted are skipped
+				continue
+			}
+			stored = append(stored, link)
+		}
+	case "yours":
+		owner := storedOwner(cu.login)
+		stored, err = db.LoadWhere("Owner = $1 OR ID IN (SELECT ID FROM LinkOwners WHERE Owner = $1)", owner)
+		sort.Slice(stored, func(i, j int) bool {
+			return stored[i].LastEdit.After(stored[j].LastEdit)
+		})
+	case "new":
+		stored, err = db.LoadWhere("Created >= $1", now.Add(-homeSectionPeriod).Unix())
+		sort.Slice(stored, func(i, j int) bool {
+			return stored[i].Created.After(stored[j].Created)
+		})
+	case "tag":
+		stored, err = db.LoadByTag(hs.Tag)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// one-time links are for sharing with specific people, not browsing,
+	// unless they are the visitor's own
+	if hs.Kind != "yours" {
+		stored = slices.DeleteFunc(stored, func(l *Link) bool { return l.MaxUses > 0 })
+	}
+
+	stats.mu.Lock()
+	for _, link := range stored {
+		links = append(links, homeLink{Short: link.Short, Long: link.Long, NumClicks: stats.clicks[link.Short]})
+	}
+	stats.mu.Unlock()
+	if hs.Kind == "tag" {
+		sort.SliceStable(links, func(i, j int) bool {
+			if links[i].NumClicks != links[j].NumClicks {
+				return links[i].NumClicks > links[j].NumClicks
+			}
+			return links[i].Short < links[j].Short
+		})
+	}
+	return links[:min(len(links), limit)], false, nil
+}
+
+// serveHomeAPI serves GET /.api/v1/home, the visible home page sections
+// for the current user with the links they list, so that other clients can
+// show the same landing page.
+func serveHomeAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(loadHomeSections(cu, time.Now()))
+}
+
+// homeSectionsRequest is the body of a request to set the home page
+// sections.
+type homeSectionsRequest struct {
+	Sections []HomeSection
+}
+
+// serveHomeSections serves the configuration of the home page sections.
+//
+// GET /.api/v1/home-sections lists the sections in order, including hidden
+// ones. PUT replaces them with the Sections in the request body, and DELETE
+// restores those set by --home-sections. Only admins may change them.
+func serveHomeSections(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(homeSectionsRequest{Sections: homeSections()})
+		return
+	}
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "PUT" && r.Method != "DELETE" {
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		http.Error(w, "GET, PUT, or DELETE required", http.StatusMethodNotAllowed)
+		return
+	}
+	var req homeSectionsRequest
+	if r.Method == "PUT" {
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		if len(req.Sections) == 0 {
+			http.Error(w, "Sections required; DELETE restores the default sections", http.StatusBadRequest)
+			return
+		}
+		if err := checkHomeSections(req.Sections); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "home sections")
+		http.Error(w, "only admins can edit home sections", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, adminShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	if err := db.SaveHomeSections(req.Sections); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invalidateShared("home-sections")
+	if r.Method == "DELETE" {
+		audit(r, cu, "home.reset", "", "")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	kinds := make([]string, len(req.Sections))
+	for i, hs := range req.Sections {
+		kinds[i] = hs.Kind
+		if hs.Kind == "tag" {
+			kinds[i] += ":" + hs.Tag
+		}
+		if hs.Hidden {
+			kinds[i] += "(hidden)"
+		}
+	}
+	audit(r, cu, "home.save", "", strings.Join(kinds, ","))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(req)
+}
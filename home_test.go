@@ -0,0 +1,103 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseHomeSections(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []HomeSection
+		wantErr string
+	}{
+		{in: "", want: nil},
+		{in: "popular", want: []HomeSection{{Kind: "popular"}}},
+		{
+			in: "pinned=docs, wiki;Trending; popular;tag=Onboarding;tag=eng;yours;new",
+			want: []HomeSection{
+				{Kind: "pinned", Links: []string{"docs", "wiki"}},
+				{Kind: "trending"},
+				{Kind: "popular"},
+				{Kind: "tag", Tag: "onboarding"},
+				{Kind: "tag", Tag: "eng"},
+				{Kind: "yours"},
+				{Kind: "new"},
+			},
+		},
+		{in: "favorites", wantErr: "unknown home section"},
+		{in: "popular=docs", wantErr: "take no value"},
+		{in: "pinned", wantErr: "requires Links"},
+		{in: "pinned=docs/wiki", wantErr: "short may only contain"},
+		{in: "tag", wantErr: "single Tag"},
+		{in: "tag=a b", wantErr: "single Tag"},
+		{in: "popular;trending;popular", wantErr: "duplicate popular section"},
+		{in: "tag=eng;tag=ENG", wantErr: "duplicate tag eng section"},
+	}
+	for _, tt := range tests {
+		got, err := parseHomeSections(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseHomeSections(%q) error = %v; want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHomeSections(%q): %v", tt.in, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("parseHomeSections(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+}
+
+func TestCheckHomeSections(t *testing.T) {
+	sections := []HomeSection{
+		{Kind: "tag", Tag: " Eng ", Title: " Engineering ", Limit: 5},
+		{Kind: "popular", Hidden: true},
+	}
+	if err := checkHomeSections(sections); err != nil {
+		t.Fatal(err)
+	}
+	want := []HomeSection{
+		{Kind: "tag", Tag: "eng", Title: "Engineering", Limit: 5},
+		{Kind: "popular", Hidden: true},
+	}
+	if diff := cmp.Diff(want, sections); diff != "" {
+		t.Errorf("checkHomeSections mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, hs := range []HomeSection{
+		{Kind: "popular", Limit: -1},
+		{Kind: "popular", Limit: maxPopularLinks + 1},
+		{Kind: "trending", Tag: "eng"},
+		{Kind: "new", Links: []string{"docs"}},
+	} {
+		if err := checkHomeSections([]HomeSection{hs}); err == nil {
+			t.Errorf("checkHomeSections(%+v) succeeded; want error", hs)
+		}
+	}
+}
+
+func TestHomeSectionLimit(t *testing.T) {
+	tests := []struct {
+		hs   HomeSection
+		want int
+	}{
+		{HomeSection{Kind: "popular"}, maxPopularLinks},
+		{HomeSection{Kind: "popular", Limit: 5}, 5},
+		{HomeSection{Kind: "trending"}, defaultHomeSectionLimit},
+		{HomeSection{Kind: "tag", Tag: "eng", Limit: 20}, 20},
+	}
+	for _, tt := range tests {
+		if got := homeSectionLimit(tt.hs); got != tt.want {
+			t.Errorf("homeSectionLimit(%+v) = %d; want %d", tt.hs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// API requests that create or update links may include an Idempotency-Key
+// header. The first response to each key is saved for idempotencyTTL, and
+// retries with the same key get that response again, marked with an
+// Idempotent-Replayed header, rather than saving the link again. Keys are
+// scoped to the user and kept in memory, so they don't survive restarts.
+
+// idempotencyTTL is how long responses are kept for replay.
+const idempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKey is the length limit of Idempotency-Key headers.
+const maxIdempotencyKey = 255
+
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte // of the request method, path, and body
+	done        bool              // the response below has been recorded
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyCache holds responses to requests with idempotency keys.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse // by scope and key
+	lastSweep time.Time
+}
+
+// idempotencyKeys holds responses to API requests with idempotency keys.
+var idempotencyKeys = new(idempotencyCache)
+
+// idempotent returns a handler that calls h once for each Idempotency-Key
+// sent by the current user, replaying the response to any repeated request.
+// Requests without the header are passed to h unchanged.
+func idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Idempotency-Key") == "" {
+			h(w, r)
+			return
+		}
+		cu, err := currentUser(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		idempotencyKeys.serve(w, r, cu.login, h)
+	}
+}
+
+// serve calls h for r unless a request with the same Idempotency-Key was
+// made before by scope, in which case its response is replayed. The key
+// can't be reused for a different request, or while the first request is
+// still in progress. Server errors are not saved, so that they can be
+// retried.
+func (c *idempotencyCache) serve(w http.ResponseWriter, r *http.Request, scope string, h http.HandlerFunc) {
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKey {
+		http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIRequestSize))
+	if err != nil {
+		http.Error(w, "reading request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	fp := sha256.New()
+	io.WriteString(fp, r.Method+" "+r.URL.Path+"\n")
+	fp.Write(body)
+
+	now := time.Now()
+	id := scope + "\n" + key
+	c.mu.Lock()
+	if c.responses == nil {
+		c.responses = make(map[string]*idempotentResponse)
+	}
+	if now.Sub(c.lastSweep) > time.Minute {
+		for id, resp := range c.responses {
+			if resp.done && now.After(resp.expires) {
+				delete(c.responses, id)
+			}
+		}
+		c.lastSweep = now
+	}
+	resp, ok := c.responses[id]
+	if ok && resp.done && now.After(resp.expires) {
+		ok = false
+	}
+	if !ok {
+		resp = &idempotentResponse{expires: now.Add(idempotencyTTL)}
+		fp.Sum(resp.fingerprint[:0])
+		c.responses[id] = resp
+	}
+	c.mu.Unlock()
+
+	if ok {
+		var sum [sha256.Size]byte
+		fp.Sum(sum[:0])
+		switch {
+		case sum != resp.fingerprint:
+			http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		case !resp.done:
+			http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+		default:
+			for k, v := range resp.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(resp.status)
+			w.Write(resp.body)
+		}
+		return
+	}
+
+	rw := &recordingWriter{ResponseWriter: w}
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if rw.status == 0 || rw.status >= 500 {
+			delete(c.responses, id)
+			return
+		}
+		resp.status = rw.status
+		resp.header = w.Header().Clone()
+		resp.body = rw.body.Bytes()
+		resp.done = true
+	}()
+	h(rw, r)
+}
+
+// recordingWriter is an http.ResponseWriter that keeps a copy of the
+// response it writes.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	var c idempotencyCache
+	calls := 0
+	status := http.StatusCreated
+	h := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"Short":"foo"}`))
+	}
+	do := func(scope, key, body string, h http.HandlerFunc) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/.api/v1/links", strings.NewReader(body))
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		c.serve(w, r, scope, h)
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		scope, key string
+		body       string
+		status     int // handler status
+		wantCode   int
+		wantCalls  int
+		wantReplay bool
+	}{
+		{name: "first", scope: "a@example.com", key: "k1", body: "{}", wantCode: 201, wantCalls: 1},
+		{name: "retry", scope: "a@example.com", key: "k1", body: "{}", wantCode: 201, wantCalls: 1, wantReplay: true},
+		{name: "different body", scope: "a@example.com", key: "k1", body: `{"Long":"x"}`, wantCode: 422, wantCalls: 1},
+		{name: "other user", scope: "b@example.com", key: "k1", body: "{}", wantCode: 201, wantCalls: 2},
+		{name: "server error", scope: "a@example.com", key: "k2", body: "{}", status: 500, wantCode: 500, wantCalls: 3},
+		{name: "server error retried", scope: "a@example.com", key: "k2", body: "{}", wantCode: 201, wantCalls: 4},
+		{name: "long key", scope: "a@example.com", key: strings.Repeat("k", maxIdempotencyKey+1), body: "{}", wantCode: 400, wantCalls: 4},
+	}
+	for _, tt := range tests {
+		status = http.StatusCreated
+		if tt.status != 0 {
+			status = tt.status
+		}
+		w := do(tt.scope, tt.key, tt.body, h)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if calls != tt.wantCalls {
+			t.Errorf("%s: handler calls = %d; want %d", tt.name, calls, tt.wantCalls)
+		}
+		if got := w.Header().Get("Idempotent-Replayed") == "true"; got != tt.wantReplay {
+			t.Errorf("%s: replayed = %v; want %v", tt.name, got, tt.wantReplay)
+		}
+		if tt.wantReplay && w.Body.String() != `{"Short":"foo"}` {
+			t.Errorf("%s: replayed body = %q", tt.name, w.Body.String())
+		}
+	}
+
+	// a retry while the first request is still being handled
+	var inner *httptest.ResponseRecorder
+	do("a@example.com", "k3", "{}", func(w http.ResponseWriter, r *http.Request) {
+		inner = do("a@example.com", "k3", "{}", h)
+		h(w, r)
+	})
+	if inner.Code != http.StatusConflict {
+		t.Errorf("concurrent retry: status = %d; want %d", inner.Code, http.StatusConflict)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"tailscale.com/tailcfg"
+)
+
+// identityProvider determines who is making a request. The provider is
+// selected by --identity, so that ownership, admin, and XSRF checks behave
+// the same however golink is deployed.
+type identityProvider interface {
+	// requestUser returns the user making r.
+	requestUser(r *http.Request) (user, error)
+
+	// userExists reports whether login is a known user.
+	userExists(ctx context.Context, login string) (bool, error)
+}
+
+// identity is the identityProvider used by currentUser and userExists.
+var identity identityProvider = tailscaleIdentity{}
+
+// adminLogins are users granted admin access by --admins, in addition to
+// any granted by the identity provider.
+var adminLogins map[string]bool
+
+// tailscaleIdentity identifies users with the tailnet's WhoIs service.
+// Admins, groups, and link grants are granted by the tailscale.com/cap/golink
+// capability.
+type tailscaleIdentity struct{}
+
+func (tailscaleIdentity) requestUser(r *http.Request) (user, error) {
+	whois, err := localClient.WhoIs(r.Context(), r.RemoteAddr)
+	if err != nil {
+		return user{}, err
+	}
+	u := user{login: whois.UserProfile.LoginName}
+	if whois.Node != nil && whois.Node.IsTagged() {
+		u.tags = whois.Node.Tags
+	}
+	caps, _ := tailcfg.UnmarshalCapJSON[capabilities](whois.CapMap, peerCapName)
+	for _, cap := range caps {
+		if cap.Admin {
+			u.isAdmin = true
+		}
+		u.groups = append(u.groups, cap.Groups...)
+		u.grants = append(u.grants, cap.Edit...)
+	}
+	return u, nil
+}
+
+func (tailscaleIdentity) userExists(ctx context.Context, login string) (bool, error) {
+	const userTaggedDevices = "tagged-devices" // owner of tagged devices
+
+	if login == userTaggedDevices {
+		return false, nil
+	}
+	st, err := localClient.Status(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, user := range st.User {
+		if user.LoginName == userTaggedDevices {
+			continue
+		}
+		if user.LoginName == login {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// devIdentity treats every request as coming from the same user, for local
+// development.
+type devIdentity struct{}
+
+func (devIdentity) requestUser(r *http.Request) (user, error) {
+	return user{login: "foo@example.com"}, nil
+}
+
+func (devIdentity) userExists(ctx context.Context, login string) (bool, error) {
+	// in dev mode, just assume the user exists
+	return true, nil
+}
+
+// headerIdentity trusts a request header set by an authenticating reverse
+// proxy, such as an OIDC proxy in front of golink. The header is only
+// trusted on requests from the configured proxy addresses.
+type headerIdentity struct {
+	header  string
+	proxies []netip.Prefix
+}
+
+func (h headerIdentity) requestUser(r *http.Request) (user, error) {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return user{}, err
+	}
+	trusted := false
+	for _, p := range h.proxies {
+		if p.Contains(ap.Addr().Unmap()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return user{}, fmt.Errorf("request from untrusted proxy %v", ap.Addr())
+	}
+	login := strings.TrimSpace(r.Header.Get(h.header))
+	if login == "" {
+		return user{}, fmt.Errorf("missing %s header", h.header)
+	}
+	return user{login: login}, nil
+}
+
+func (headerIdentity) userExists(ctx context.Context, login string) (bool, error) {
+	// the proxy's user directory isn't available, so assume the user exists
+	return true, nil
+}
+
+// tokenIdentity identifies requests with an "Authorization: Bearer" API
+// token, from --api-tokens-file or stored in the database, deferring to
+// next for other requests. Stored tokens are limited to their scopes.
+type tokenIdentity struct {
+	tokens map[string]string // token -> login
+	next   identityProvider
+}
+
+func (t tokenIdentity) requestUser(r *http.Request) (user, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return t.next.requestUser(r)
+	}
+	for tok, login := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(token)) == 1 {
+			return user{login: login}, nil
+		}
+	}
+	if strings.HasPrefix(token, apiTokenPrefix) && db != nil {
+		// the hash is looked up, so comparison time doesn't leak the token
+		at, err := db.LoadTokenByHash(hashAPIToken(token))
+		if err == nil && at.Revoked.IsZero() {
+			return user{login: at.Login, scopes: at.Scopes}, nil
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return user{}, err
+		}
+	}
+	return user{}, errors.New("invalid API token")
+}
+
+func (t tokenIdentity) userExists(ctx context.Context, login string) (bool, error) {
+	return t.next.userExists(ctx, login)
+}
+
+// parseAPITokens parses an API tokens file. Each non-empty line that is not
+// a "#" comment holds a token and the login it authenticates as, separated
+// by whitespace.
+func parseAPITokens(r io.Reader) (map[string]string, error) {
+	tokens := make(map[string]string)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want token and login", n)
+		}
+		if len(fields[0]) < 16 {
+			return nil, fmt.Errorf("line %d: token must be at least 16 characters", n)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	return tokens, s.Err()
+}
+
+// newIdentityProvider returns the identityProvider named by mode, which is
+// one of "tailscale", "header", "oidc", or "dev". An empty mode selects
+// "dev" in dev mode and "tailscale" otherwise. The header and proxies
+// configure "header" mode, where proxies is a comma-separated list of IP
+// addresses or prefixes, and oidc configures "oidc" mode.
+func newIdentityProvider(mode, header, proxies string, oidc oidcConfig) (identityProvider, error) {
+	if mode == "" {
+		mode = "tailscale"
+		if devMode() {
+			mode = "dev"
+		}
+	}
+	switch mode {
+	case "tailscale":
+		return tailscaleIdentity{}, nil
+	case "dev":
+		return devIdentity{}, nil
+	case "oidc":
+		return newOIDCIdentity(oidc)
+	case "header":
+		h := headerIdentity{header: header}
+		if h.header == "" {
+			return nil, errors.New("header identity requires --identity-header")
+		}
+		for _, s := range strings.Split(proxies, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			p, err := netip.ParsePrefix(s)
+			if err != nil {
+				addr, aerr := netip.ParseAddr(s)
+				if aerr != nil {
+					return nil, fmt.Errorf("invalid trusted proxy %q", s)
+				}
+				p = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			h.proxies = append(h.proxies, p)
+		}
+		if len(h.proxies) == 0 {
+			return nil, errors.New("header identity requires --trusted-proxies")
+		}
+		return h, nil
+	}
+	return nil, fmt.Errorf("unknown identity provider %q", mode)
+}
+
+// parseAdminLogins parses a comma-separated list of admin logins.
+func parseAdminLogins(s string) map[string]bool {
+	admins := make(map[string]bool)
+	for _, login := range strings.Split(s, ",") {
+		if login = strings.TrimSpace(login); login != "" {
+			admins[strings.ToLower(login)] = true
+		}
+	}
+	return admins
+}
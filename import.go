@@ -0,0 +1,371 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importRow is a link read from an import file.
+type importRow struct {
+	row  int   // 1-based record number in the file, not counting headers
+	link *Link // nil if err is set
+	err  error // why the record could not be read as a link
+}
+
+// importFormats are the import file formats, by the name used in the
+// "format" parameter of /.api/v1/import.
+var importFormats = map[string]func(io.Reader) ([]importRow, error){
+	"jsonl":   parseImportJSONLines,
+	"csv":     parseImportCSV,
+	"golinks": parseImportCSV,
+	"trotto":  parseImportTrotto,
+}
+
+// detectImportFormat guesses the format of an import file from its first
+// non-space byte.
+func detectImportFormat(b []byte) string {
+	for _, c := range b {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		case '[':
+			return "trotto"
+		case '{':
+			return "jsonl"
+		default:
+			return "csv"
+		}
+	}
+	return "csv"
+}
+
+// maxImportLine is the longest line accepted in a JSON lines import.
+const maxImportLine = 1 << 20
+
+// parseImportJSONLines parses links in the format written by /.export, one
+// JSON object per line.
+func parseImportJSONLines(r io.Reader) ([]importRow, error) {
+	var rows []importRow
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxImportLine)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || isBackupTrailer([]byte(line)) {
+			continue
+		}
+		row := importRow{row: len(rows) + 1}
+		link := new(Link)
+		if err := json.Unmarshal([]byte(line), link); err != nil {
+			row.err = err
+		} else {
+			row.link = link
+		}
+		rows = append(rows, row)
+	}
+	return rows, s.Err()
+}
+
+// importColumns maps the lowercase CSV column names accepted for each link
+// field, such as the name and url columns of golinks.io exports.
+var importColumns = map[string]string{
+	"short":       "short",
+	"name":        "short",
+	"keyword":     "short",
+	"shortpath":   "short",
+	"long":        "long",
+	"url":         "long",
+	"destination": "long",
+	"owner":       "owner",
+	"creator":     "owner",
+	"tags":        "tags",
+}
+
+// parseImportCSV parses links from a CSV file with a header row naming its
+// columns. Unknown columns are ignored.
+func parseImportCSV(r io.Reader) ([]importRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if field, ok := importColumns[name]; ok {
+			if _, dup := cols[field]; !dup {
+				cols[field] = i
+			}
+		}
+	}
+	if _, ok := cols["short"]; !ok {
+		return nil, errors.New("CSV header has no short name column (short or name)")
+	}
+	if _, ok := cols["long"]; !ok {
+		return nil, errors.New("CSV header has no destination column (long or url)")
+	}
+
+	var rows []importRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		row := importRow{row: len(rows) + 1}
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return nil, err
+			}
+			row.err = err
+			rows = append(rows, row)
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row.link = &Link{
+			Short: field("short"),
+			Long:  field("long"),
+			Owner: field("owner"),
+			Tags:  parseTags(field("tags")),
+		}
+		rows = append(rows, row)
+	}
+}
+
+// trottoLink is a link in a Trotto export.
+type trottoLink struct {
+	Shortpath      string `json:"shortpath"`
+	DestinationURL string `json:"destination_url"`
+	Owner          string `json:"owner"`
+}
+
+// parseImportTrotto parses links from a Trotto export, a JSON array of
+// links. Trotto's "%s" placeholders, as in a "jira/%s" link, become
+// {{.Path}} templates.
+func parseImportTrotto(r io.Reader) ([]importRow, error) {
+	var links []trottoLink
+	if err := json.NewDecoder(r).Decode(&links); err != nil {
+		return nil, err
+	}
+	rows := make([]importRow, len(links))
+	for i, tl := range links {
+		short, long := tl.Shortpath, tl.DestinationURL
+		if prefix, ok := strings.CutSuffix(short, "/%s"); ok {
+			short = prefix
+			long = strings.Replace(long, "%s", "{{.Path}}", 1)
+		}
+		rows[i] = importRow{row: i + 1, link: &Link{Short: short, Long: long, Owner: tl.Owner}}
+	}
+	return rows, nil
+}
+
+// importResult reports what happened to one imported row.
+type importResult struct {
+	Row    int
+	Short  string `json:",omitempty"`
+	Result string // created, valid (in a dry run), exists, duplicate, invalid, or failed
+	Error  string `json:",omitempty"`
+}
+
+// importReport is the response to /.api/v1/import.
+type importReport struct {
+	DryRun  bool `json:",omitempty"`
+	Created int  // or would be created, in a dry run
+	Skipped int  // already existing or duplicated in the file
+	Failed  int
+	Rows    []importResult
+}
+
+// importLink validates link, read from an import file, and creates it as
+// created by creator, a stored owner value, unless pending is set, for a dry
+// run. It returns the row's result. Links that would exceed a quota fail; in
+// a dry run, counting the links that earlier rows would have created, which
+// are recorded in pending.
+func importLink(link *Link, creator string, now time.Time, pending *pendingQuotas) (string, error) {
+	if link.Short == "" || link.Long == "" {
+		return "invalid", errors.New("short and long required")
+	}
+	if !reShortName.MatchString(link.Short) {
+		return "invalid", errors.New("short may only contain letters, numbers, dash, and period")
+	}
+	if n := reservedName(link.Short); n != nil {
+		return "invalid", errors.New(reservedNameError(link.Short, n))
+	}
+	if err := checkLinkTarget(link.Long); err != nil {
+		return "invalid", err
+	}
+
+	_, err := db.Load(link.Short)
+	if err == nil {
+		return "exists", nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "failed", err
+	}
+	if _, err := db.LoadAlias(link.Short); err == nil {
+		return "exists", errors.New("short name was merged into another link")
+	}
+
+	owner := importOwners.remap(link.Owner)
+	if pending != nil {
+		if err := checkQuotas(pending, nil, link.Short, storedOwner(owner), creator, now); err != nil {
+			return "failed", err
+		}
+		pending.add(link.Short, storedOwner(owner), creator)
+		return "valid", nil
+	}
+	if link.Owner, err = recordOwner(owner); err != nil {
+		return "failed", err
+	}
+	link.Editor = creator
+	long := cmp.Or(link.RawLong, link.Long) // as entered, if from /.export
+	link.Long = canonicalTarget(long, targetSupportsHTTPS)
+	link.RawLong = ""
+	if link.Long != long {
+		link.RawLong = long
+	}
+	if link.Created.IsZero() {
+		link.Created = now
+	}
+	if link.LastEdit.IsZero() {
+		link.LastEdit = now
+	}
+	link.AutoCreated = true
+	link.Uses = 0
+	if err := db.save(link, saveCreate, true); errors.Is(err, fs.ErrExist) {
+		return "exists", nil
+	} else if err != nil {
+		return "failed", err
+	}
+	return "created", nil
+}
+
+// maxImportSize limits the size of import request bodies.
+const maxImportSize = 64 << 20
+
+// serveImport creates links in bulk from the file in the request body,
+// which may be compressed with gzip or zstd. The "format" parameter is one
+// of importFormats, detected from the file if empty, and "dry_run" checks
+// the file without creating links. Existing links are never changed.
+// Only admins may import links, since the file sets their owners.
+func serveImport(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if _, ok := importFormats[format]; format != "" && !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q: use jsonl, csv, golinks, or trotto", format), http.StatusBadRequest)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "import")
+		http.Error(w, "only admins can import links", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, ".import") {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	body, err := decompressReader(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		http.Error(w, "reading import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+	br := bufio.NewReader(body)
+	if format == "" {
+		start, _ := br.Peek(512)
+		format = detectImportFormat(start)
+	}
+	rows, err := importFormats[format](br)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading %s import: %v", format, err), http.StatusBadRequest)
+		return
+	}
+
+	// unlike links saved one at a time, imports by admins count against
+	// quotas, so that they can't flood the store either
+	creator := storedOwner(cu.login)
+	if !dryRun {
+		if creator, err = recordOwner(cu.login); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	report := importReport{DryRun: dryRun, Rows: make([]importResult, 0, len(rows))}
+	var pending *pendingQuotas
+	if dryRun {
+		pending = newPendingQuotas(db)
+	}
+	seen := make(map[string]bool)
+	now := time.Now().UTC()
+	for _, row := range rows {
+		res := importResult{Row: row.row, Result: "invalid"}
+		err := row.err
+		if row.link != nil {
+			res.Short = row.link.Short
+			if id := linkID(row.link.Short); seen[id] {
+				res.Result, err = "duplicate", nil
+			} else {
+				seen[id] = true
+				res.Result, err = importLink(row.link, creator, now, pending)
+				if res.Result == "created" {
+					notifyLinkChange(cu.login, nil, row.link)
+				}
+			}
+		}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		switch res.Result {
+		case "created", "valid":
+			report.Created++
+		case "exists", "duplicate":
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+		report.Rows = append(report.Rows, res)
+	}
+	if !dryRun {
+		linkChanges.Add("create", int64(report.Created))
+		audit(r, cu, "link.import", "", fmt.Sprintf("format=%s created=%d skipped=%d failed=%d", format, report.Created, report.Skipped, report.Failed))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetectImportFormat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", "csv"},
+		{"short,long\n", "csv"},
+		{`{"Short":"a"}`, "jsonl"},
+		{"\n  [{\"shortpath\":\"a\"}]", "trotto"},
+	}
+	for _, tt := range tests {
+		if got := detectImportFormat([]byte(tt.in)); got != tt.want {
+			t.Errorf("detectImportFormat(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// importedLinks returns the links or errors of rows, for comparison.
+func importedLinks(rows []importRow) []string {
+	var got []string
+	for _, row := range rows {
+		if row.err != nil {
+			got = append(got, "error")
+			continue
+		}
+		l := row.link
+		got = append(got, l.Short+" "+l.Long+" "+l.Owner+" "+strings.Join(l.Tags, ","))
+	}
+	return got
+}
+
+func TestParseImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "jsonl",
+			format: "jsonl",
+			in:     `{"Short":"a","Long":"https://a/","Owner":"foo@example.com","Tags":["x"]}` + "\n\n" + "not json\n" + `{"Short":"b","Long":"https://b/"}`,
+			want:   []string{"a https://a/ foo@example.com x", "error", "b https://b/  "},
+		},
+		{
+			name:   "csv",
+			format: "csv",
+			in:     "Name,Description,URL,Owner,Tags\na,Alpha,https://a/,foo@example.com,\"x, y\"\nb,,https://b/,,\n",
+			want:   []string{"a https://a/ foo@example.com x,y", "b https://b/  "},
+		},
+		{
+			name:   "csv short record",
+			format: "csv",
+			in:     "short,long\na\n",
+			want:   []string{"a   "},
+		},
+		{
+			name:    "csv without url",
+			format:  "csv",
+			in:      "short,owner\na,foo@example.com\n",
+			wantErr: true,
+		},
+		{
+			name:   "trotto",
+			format: "trotto",
+			in:     `[{"shortpath":"wiki","destination_url":"https://wiki/","owner":"foo@example.com"},{"shortpath":"jira/%s","destination_url":"https://jira/browse/%s"}]`,
+			want:   []string{"wiki https://wiki/ foo@example.com ", "jira https://jira/browse/{{.Path}}  "},
+		},
+		{
+			name:    "trotto not an array",
+			format:  "trotto",
+			in:      `{"shortpath":"wiki"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := importFormats[tt.format](strings.NewReader(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v; want error %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, importedLinks(rows)); diff != "" {
+				t.Errorf("links mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,614 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schedule determines when a background job runs.
+type schedule interface {
+	// next returns the first time the job should run after t.
+	next(t time.Time) time.Time
+}
+
+// everySchedule runs a job at a fixed interval, as in "@every 1h".
+type everySchedule time.Duration
+
+func (e everySchedule) next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// cronSchedule runs a job at times matching a five field cron expression
+// ("minute hour day-of-month month day-of-week"), evaluated in UTC.
+// Each field is a bit set of the matching values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record whether the day fields started with "*". As in
+	// cron, if both day fields are restricted, a day matching either runs.
+	domStar, dowStar bool
+}
+
+func (c *cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// every schedule matches at least once within 5 years (Feb 29 on a given weekday)
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		if !c.matchDay(t) || c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) != 0 {
+			return t
+		}
+		t = t.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+func (c *cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if !c.domStar && !c.dowStar {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// parseCronField parses a cron field of comma-separated values, ranges
+// ("1-5"), and steps ("*/15" or "0-30/10") within [lo, hi].
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		start, end := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if start, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("invalid value in %q", part)
+			}
+			end = start
+			if isRange {
+				if end, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if hasStep {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseSchedule parses a job schedule, which is either "@every DURATION",
+// one of "@hourly" or "@daily", or a five field cron expression.
+func parseSchedule(spec string) (schedule, error) {
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily":
+		spec = "0 0 * * *"
+	}
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid interval %q", d)
+		}
+		return everySchedule(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: want @every DURATION or a five field cron expression", spec)
+	}
+	c := &cronSchedule{domStar: strings.HasPrefix(fields[2], "*"), dowStar: strings.HasPrefix(fields[4], "*")}
+	var err error
+	for i, f := range []struct {
+		bits   *uint64
+		lo, hi int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	} {
+		if *f.bits, err = parseCronField(fields[i], f.lo, f.hi); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // 7 is also Sunday
+	}
+	return c, nil
+}
+
+// job is a background task run by the scheduler.
+type job struct {
+	name   string
+	run    func(ctx context.Context) error
+	spec   string        // schedule spec, or "off" if disabled
+	jitter time.Duration // maximum random delay added to each run
+	sched  schedule
+
+	// exclusive jobs run on only one replica at a time, and are skipped by
+	// replicas that find another has run them since they last tried.
+	exclusive bool
+
+	mu           sync.Mutex
+	running      bool
+	lastStart    time.Time
+	lastDuration time.Duration
+	lastErr      error
+	nextRun      time.Time
+	runs         int
+	failures     int
+	skips        int // exclusive runs left to another replica
+}
+
+// jobs are the registered background jobs, in registration order.
+var (
+	jobsMu sync.Mutex
+	jobs   []*job
+)
+
+// jobSlots limits how many jobs run at once, so that background work
+// doesn't compete with serving links.
+var jobSlots = make(chan struct{}, 2)
+
+// registerJob adds a background job with a default schedule spec, which may
+// be "off" to disable it unless enabled by --jobs.
+func registerJob(name, spec string, jitter time.Duration, run func(ctx context.Context) error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	jobs = append(jobs, &job{name: name, spec: spec, jitter: jitter, run: run})
+}
+
+// registerExclusiveJob is like registerJob, but the job works on the
+// database as a whole rather than on this replica, so it runs on only one
+// of the replicas sharing the database at a time.
+func registerExclusiveJob(name, spec string, jitter time.Duration, run func(ctx context.Context) error) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	jobs = append(jobs, &job{name: name, spec: spec, jitter: jitter, run: run, exclusive: true})
+}
+
+// runExclusive runs an exclusive job, as (*PostgresDB).RunJob.
+var runExclusive = func(ctx context.Context, name string, since time.Time, run func() error) error {
+	return db.RunJob(ctx, name, since, run)
+}
+
+// findJob returns the registered job with the given name, or nil.
+func findJob(name string) *job {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, j := range jobs {
+		if j.name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// configureJobs applies the --jobs flag, a semicolon-separated list of
+// name=spec overrides such as "gc=@hourly;stats-flush=@every 30s~5s".
+// A spec of "off" disables a job, and a "~DURATION" suffix sets its jitter.
+// It then parses the schedules of all enabled jobs.
+func configureJobs(s string) error {
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("invalid job config %q: want name=schedule", kv)
+		}
+		j := findJob(strings.TrimSpace(name))
+		if j == nil {
+			return fmt.Errorf("unknown job %q", name)
+		}
+		spec, jitter, ok := strings.Cut(strings.TrimSpace(spec), "~")
+		if ok {
+			d, err := time.ParseDuration(jitter)
+			if err != nil {
+				return fmt.Errorf("invalid jitter for job %s: %w", j.name, err)
+			}
+			j.jitter = d
+		}
+		j.spec = strings.TrimSpace(spec)
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, j := range jobs {
+		if j.spec == "off" {
+			j.sched = nil
+			continue
+		}
+		sched, err := parseSchedule(j.spec)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", j.name, err)
+		}
+		j.sched = sched
+	}
+	return nil
+}
+
+// startJobs starts a goroutine running each enabled job on its schedule.
+func startJobs(ctx context.Context) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	for _, j := range jobs {
+		if j.sched != nil {
+			go j.loop(ctx)
+		}
+	}
+}
+
+// loop runs j on its schedule until ctx is done.
+func (j *job) loop(ctx context.Context) {
+	for {
+		since := time.Now()
+		next := j.sched.next(since)
+		if next.IsZero() {
+			log.Printf("job %s: schedule %q never runs", j.name, j.spec)
+			return
+		}
+		if j.jitter > 0 {
+			next = next.Add(rand.N(j.jitter))
+		}
+		j.mu.Lock()
+		j.nextRun = next
+		j.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		// an exclusive job run by another replica while this one waited
+		// is skipped
+		if err := j.runSince(ctx, since); err != nil && !errors.Is(err, errJobSkipped) {
+			log.Printf("job %s: %v", j.name, err)
+		}
+	}
+}
+
+// errJobRunning is returned by runOnce if the job is already running.
+var errJobRunning = errors.New("job already running")
+
+// runOnce runs j now, waiting for a free job slot, and records its outcome.
+// An exclusive job is skipped only if another replica is running it.
+func (j *job) runOnce(ctx context.Context) error {
+	return j.runSince(ctx, time.Time{})
+}
+
+// runSince is like runOnce, but also skips an exclusive job if another
+// replica started it after since.
+func (j *job) runSince(ctx context.Context, since time.Time) error {
+	j.mu.Lock()
+	if j.running {
+		j.mu.Unlock()
+		return errJobRunning
+	}
+	j.running = true
+	j.mu.Unlock()
+
+	select {
+	case jobSlots <- struct{}{}:
+	case <-ctx.Done():
+		j.mu.Lock()
+		j.running = false
+		j.mu.Unlock()
+		return ctx.Err()
+	}
+	start := time.Now()
+	var err error
+	if j.exclusive {
+		err = runExclusive(ctx, j.name, since, func() error { return j.run(ctx) })
+	} else {
+		err = j.run(ctx)
+	}
+	<-jobSlots
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.running = false
+	if errors.Is(err, errJobSkipped) {
+		j.skips++
+		return err
+	}
+	j.lastStart = start
+	j.lastDuration = time.Since(start)
+	j.lastErr = err
+	j.runs++
+	if err != nil {
+		j.failures++
+	}
+	return err
+}
+
+// jobsShortName is used as the short name for generating XSRF tokens when
+// triggering jobs.
+const jobsShortName = ".jobs"
+
+// jobStatus is the state of a background job, as returned by /.api/v1/jobs.
+type jobStatus struct {
+	Name         string
+	Schedule     string // schedule spec, or "off"
+	Enabled      bool
+	Running      bool
+	LastRun      time.Time `json:",omitzero"`
+	LastDuration string    `json:",omitempty"`
+	LastError    string    `json:",omitempty"`
+	NextRun      time.Time `json:",omitzero"`
+	Runs         int
+	Failures     int
+	Exclusive    bool // runs on only one replica at a time
+	Skipped      int  `json:",omitempty"` // runs left to another replica
+}
+
+// status returns the current state of j.
+func (j *job) status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := jobStatus{
+		Name:      j.name,
+		Schedule:  j.spec,
+		Enabled:   j.sched != nil,
+		Running:   j.running,
+		LastRun:   j.lastStart,
+		NextRun:   j.nextRun,
+		Runs:      j.runs,
+		Failures:  j.failures,
+		Exclusive: j.exclusive,
+		Skipped:   j.skips,
+	}
+	if !j.lastStart.IsZero() {
+		st.LastDuration = j.lastDuration.String()
+	}
+	if j.lastErr != nil {
+		st.LastError = j.lastErr.Error()
+	}
+	return st
+}
+
+// serveJobs returns the status of background jobs as JSON. Admins can POST
+// a job "name" to run it now, such as to retry a failed run. The job runs in
+// the background, including disabled jobs, and its outcome is reported in
+// later statuses.
+func serveJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		serveTriggerJob(w, r)
+		return
+	}
+
+	jobsMu.Lock()
+	all := slices.Clone(jobs)
+	jobsMu.Unlock()
+	statuses := make([]jobStatus, len(all))
+	for i, j := range all {
+		statuses[i] = j.status()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// serveTriggerJob starts a run of the job named in the request.
+func serveTriggerJob(w http.ResponseWriter, r *http.Request) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "trigger job")
+		http.Error(w, "only admins can run jobs", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, jobsShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	name := r.FormValue("name")
+	j := findJob(name)
+	if j == nil {
+		http.Error(w, "unknown job: "+name, http.StatusNotFound)
+		return
+	}
+	if j.status().Running {
+		http.Error(w, errJobRunning.Error(), http.StatusConflict)
+		return
+	}
+
+	go func() {
+		if err := j.runOnce(context.Background()); err != nil {
+			log.Printf("job %s (triggered by %s): %v", j.name, cu.login, err)
+		}
+	}()
+	audit(r, cu, "job.trigger", "", j.name)
+
+	if acceptHTML(r) {
+		// triggered from the admin console
+		http.Redirect(w, r, "/.admin", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(j.status())
+}
+
+// registerJobs registers golink's background jobs with their default
+// schedules.
+func registerJobs() {
+	registerJob("stats-flush", "@every 1m", 0, func(ctx context.Context) error {
+		return flushStats()
+	})
+
+	compactSpec := "@daily"
+	if *compactAfter <= 0 || *readonly {
+		compactSpec = "off"
+	}
+	registerExclusiveJob("stats-compact", compactSpec, 30*time.Minute, func(ctx context.Context) error {
+		if *compactAfter <= 0 || *readonly {
+			return errors.New("stats compaction requires --compact-stats-after and is disabled in read-only mode")
+		}
+		removed, err := db.CompactStats(*compactAfter, statsLocation)
+		if err != nil {
+			return err
+		}
+		log.Printf("compacted click stats older than %v: removed %d rows", *compactAfter, removed)
+		return nil
+	})
+
+	partitionSpec := "@daily"
+	if *readonly {
+		partitionSpec = "off"
+	}
+	registerExclusiveJob("stats-partitions", partitionSpec, time.Hour, func(ctx context.Context) error {
+		if *readonly {
+			return errors.New("stats partitions are not maintained in read-only mode")
+		}
+		// create partitions a month ahead, so that a missed run doesn't
+		// leave stats in the default partition
+		created, err := db.CreateStatsPartitions(1)
+		if len(created) > 0 {
+			log.Printf("created click stats partitions %s", strings.Join(created, ", "))
+		}
+		if err != nil || *statsRetention <= 0 {
+			return err
+		}
+		dropped, err := db.DropStatsPartitions(*statsRetention)
+		if len(dropped) > 0 {
+			log.Printf("dropped click stats partitions older than %v: %s", *statsRetention, strings.Join(dropped, ", "))
+		}
+		return err
+	})
+
+	acmeSpec := "@every 1h"
+	if publicCerts == nil {
+		acmeSpec = "off"
+	}
+	registerJob("acme-renew", acmeSpec, 5*time.Minute, func(ctx context.Context) error {
+		if publicCerts == nil {
+			return errors.New("certificate renewal requires --public-hostname")
+		}
+		return publicCerts.renew(ctx)
+	})
+
+	gcSpec := "@every 1h"
+	if *gcAutoLinksAfter <= 0 || *readonly {
+		gcSpec = "off"
+	}
+	registerExclusiveJob("gc", gcSpec, 5*time.Minute, func(ctx context.Context) error {
+		if *gcAutoLinksAfter <= 0 || *readonly {
+			return errors.New("garbage collection requires --gc-auto-links-after and is disabled in read-only mode")
+		}
+		return collectGarbage(time.Now().UTC())
+	})
+
+	webhookSpec := "@every 5s"
+	if webhooks == nil {
+		webhookSpec = "off"
+	}
+	registerJob("webhooks", webhookSpec, time.Second, func(ctx context.Context) error {
+		if webhooks == nil {
+			return errors.New("webhook delivery requires --webhooks-file")
+		}
+		return webhooks.deliver(time.Now())
+	})
+
+	sloSpec := "@every 1m"
+	if resolveSLO.config.Target <= 0 {
+		sloSpec = "off"
+	}
+	registerJob("slo", sloSpec, 0, func(ctx context.Context) error {
+		if resolveSLO.config.Target <= 0 {
+			return errors.New("SLO alerting requires a --slo target")
+		}
+		resolveSLO.check(time.Now())
+		return nil
+	})
+
+	probeSpec := "@every 1m"
+	if *probeLink == "" {
+		probeSpec = "off"
+	}
+	registerJob("probe", probeSpec, 10*time.Second, func(ctx context.Context) error {
+		if *probeLink == "" {
+			return errors.New("probing requires --probe-link")
+		}
+		return runProbes(ctx, *probeLink)
+	})
+
+	linkCheckSpec, linkCheckJitter := "@daily", time.Hour
+	if linkCheckHours != nil {
+		// checkLinks stops outside the window, so run often enough to use it
+		linkCheckSpec, linkCheckJitter = "@hourly", 5*time.Minute
+	}
+	if *readonly {
+		linkCheckSpec = "off"
+	}
+	registerExclusiveJob("link-check", linkCheckSpec, linkCheckJitter, func(ctx context.Context) error {
+		if *readonly {
+			return errors.New("dead link checking is disabled in read-only mode")
+		}
+		return checkLinks(ctx)
+	})
+
+	syncSpec := "@every 5m"
+	if *syncFile == "" || *readonly {
+		syncSpec = "off"
+	}
+	registerExclusiveJob("link-sync", syncSpec, 30*time.Second, func(ctx context.Context) error {
+		if *syncFile == "" || *readonly {
+			return errors.New("link sync requires --sync-file and is disabled in read-only mode")
+		}
+		return syncFromFile()
+	})
+
+	auditSpec := "@every 5s"
+	if auditLog == nil {
+		auditSpec = "off"
+	}
+	registerJob("audit-export", auditSpec, time.Second, func(ctx context.Context) error {
+		if auditLog == nil {
+			return errors.New("audit export requires --audit-export")
+		}
+		return auditLog.flush()
+	})
+}
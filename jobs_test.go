@@ -0,0 +1,187 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2023, 3, 15, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "@every 90s", want: now.Add(90 * time.Second)},
+		{spec: "@hourly", want: time.Date(2023, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2023, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{spec: "0 9-17 * * 1-5", want: time.Date(2023, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{spec: "30 2 * * 0", want: time.Date(2023, 3, 19, 2, 30, 0, 0, time.UTC)},
+		{spec: "30 2 * * 7", want: time.Date(2023, 3, 19, 2, 30, 0, 0, time.UTC)},
+		{spec: "0 0 1 */3 *", want: time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		// either restricted day field matches
+		{spec: "0 0 20 * 5", want: time.Date(2023, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every -1m", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "* * *", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseSchedule(%q) returned error %v; want %v", tt.spec, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := s.next(now); !got.Equal(tt.want) {
+			t.Errorf("parseSchedule(%q).next = %v; want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureJobs(t *testing.T) {
+	oldJobs := jobs
+	t.Cleanup(func() { jobs = oldJobs })
+	jobs = nil
+
+	registerJob("a", "@every 1m", 0, func(context.Context) error { return nil })
+	registerJob("b", "off", 0, func(context.Context) error { return nil })
+
+	if err := configureJobs("a=off; b=@hourly~30s"); err != nil {
+		t.Fatal(err)
+	}
+	if a := findJob("a"); a.sched != nil {
+		t.Errorf("job a is enabled; want disabled")
+	}
+	if b := findJob("b"); b.sched == nil || b.jitter != 30*time.Second {
+		t.Errorf("job b: sched = %v, jitter = %v; want enabled with 30s jitter", b.sched, b.jitter)
+	}
+
+	for _, bad := range []string{"c=@hourly", "a", "a=@sometimes", "a=@hourly~soon"} {
+		if err := configureJobs(bad); err == nil {
+			t.Errorf("configureJobs(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestJobRunOnce(t *testing.T) {
+	fail := errors.New("boom")
+	var err error
+	j := &job{name: "test", run: func(context.Context) error { return err }}
+
+	if got := j.runOnce(context.Background()); got != nil {
+		t.Fatalf("runOnce = %v; want nil", got)
+	}
+	err = fail
+	if got := j.runOnce(context.Background()); got != fail {
+		t.Fatalf("runOnce = %v; want %v", got, fail)
+	}
+	if j.runs != 2 || j.failures != 1 || j.lastErr != fail {
+		t.Errorf("runs = %d, failures = %d, lastErr = %v; want 2, 1, %v", j.runs, j.failures, j.lastErr, fail)
+	}
+
+	j.running = true
+	if got := j.runOnce(context.Background()); got != errJobRunning {
+		t.Errorf("runOnce while running = %v; want %v", got, errJobRunning)
+	}
+}
+
+func TestExclusiveJobRun(t *testing.T) {
+	oldRunExclusive := runExclusive
+	t.Cleanup(func() { runExclusive = oldRunExclusive })
+	var lastOther time.Time // when another replica last started the job
+	runExclusive = func(ctx context.Context, name string, since time.Time, run func() error) error {
+		if !since.IsZero() && lastOther.After(since) {
+			return fmt.Errorf("%w: already run by another replica", errJobSkipped)
+		}
+		return run()
+	}
+
+	var ran int
+	j := &job{name: "test", exclusive: true, run: func(context.Context) error { ran++; return nil }}
+	start := time.Now()
+	lastOther = start.Add(time.Second)
+	if err := j.runSince(context.Background(), start); !errors.Is(err, errJobSkipped) {
+		t.Errorf("runSince after another replica's run = %v; want errJobSkipped", err)
+	}
+	if ran != 0 || j.runs != 0 || j.skips != 1 {
+		t.Errorf("ran %d times, runs = %d, skips = %d; want 0, 0, 1", ran, j.runs, j.skips)
+	}
+	if st := j.status(); !st.Exclusive || st.Skipped != 1 || !st.LastRun.IsZero() {
+		t.Errorf("status = %+v; want exclusive with one skip and no runs", st)
+	}
+
+	// triggered runs ignore other replicas' runs
+	if err := j.runOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.runSince(context.Background(), lastOther); err != nil {
+		t.Fatal(err)
+	}
+	if ran != 2 || j.runs != 2 || j.skips != 1 {
+		t.Errorf("ran %d times, runs = %d, skips = %d; want 2, 2, 1", ran, j.runs, j.skips)
+	}
+}
+
+func TestServeJobs(t *testing.T) {
+	oldJobs, oldCurrentUser := jobs, currentUser
+	t.Cleanup(func() { jobs, currentUser = oldJobs, oldCurrentUser })
+	jobs = nil
+
+	ran := make(chan bool, 1)
+	registerJob("backup", "off", 0, func(context.Context) error {
+		ran <- true
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	serveJobs(w, httptest.NewRequest("GET", "/.api/v1/jobs", nil))
+	var statuses []jobStatus
+	if err := json.NewDecoder(w.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "backup" || statuses[0].Enabled {
+		t.Errorf("statuses = %+v; want one disabled backup job", statuses)
+	}
+
+	trigger := func(u user, name string) int {
+		currentUser = func(*http.Request) (user, error) { return u, nil }
+		r := httptest.NewRequest("POST", "/.api/v1/jobs", strings.NewReader(url.Values{"name": {name}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		serveJobs(w, r)
+		return w.Code
+	}
+	if got := trigger(user{login: "alice@example.com"}, "backup"); got != http.StatusForbidden {
+		t.Errorf("non-admin trigger = %d; want %d", got, http.StatusForbidden)
+	}
+	admin := user{login: "admin@example.com", isAdmin: true}
+	if got := trigger(admin, "nope"); got != http.StatusNotFound {
+		t.Errorf("unknown job trigger = %d; want %d", got, http.StatusNotFound)
+	}
+	if got := trigger(admin, "backup"); got != http.StatusAccepted {
+		t.Fatalf("admin trigger = %d; want %d", got, http.StatusAccepted)
+	}
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("triggered job did not run")
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// linkCacheChannel is the PostgreSQL notification channel on which writes
+// to links announce the IDs of the links they changed, or "*" if they may
+// have changed any link, so that every replica's linkCache drops them.
+const linkCacheChannel = "golink_link_changes"
+
+type linkCacheEntry struct {
+	id      string
+	link    *Link
+	expires time.Time
+}
+
+// linkCache is a size-limited cache of loaded links, keyed by link ID,
+// evicting the least recently used. Entries expire after a TTL, which
+// bounds how stale the click totals of cached links are, since flushing
+// click stats doesn't invalidate them.
+type linkCache struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List               // of *linkCacheEntry, most recently used first
+	items map[string]*list.Element // elements of ll, by link ID
+
+	// gen is incremented by every invalidation, so that a link loaded
+	// before an invalidation isn't cached after it.
+	gen uint64
+}
+
+// newLinkCache returns a linkCache of up to size links, each cached for
+// up to ttl.
+func newLinkCache(size int, ttl time.Duration) *linkCache {
+	return &linkCache{size: size, ttl: ttl, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns a copy of the cached link with the given ID, if it is cached
+// and hasn't expired, and the current generation, to pass to put if the
+// link is loaded instead.
+func (c *linkCache) get(id string, now time.Time) (*Link, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[id]
+	if !ok {
+		linkCacheLookups.Add("miss", 1)
+		return nil, c.gen
+	}
+	ce := e.Value.(*linkCacheEntry)
+	if !now.Before(ce.expires) {
+		c.remove(e)
+		linkCacheLookups.Add("miss", 1)
+		return nil, c.gen
+	}
+	c.ll.MoveToFront(e)
+	linkCacheLookups.Add("hit", 1)
+	return ce.link.clone(), c.gen
+}
+
+// put caches a copy of link, loaded by its ID, unless the cache has been
+// invalidated since generation gen.
+func (c *linkCache) put(id string, link *Link, gen uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	if e, ok := c.items[id]; ok {
+		c.remove(e)
+	}
+	c.items[id] = c.ll.PushFront(&linkCacheEntry{id: id, link: link.clone(), expires: now.Add(c.ttl)})
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+// warm caches links loaded from elsewhere than the database, such as
+// another replica, as if they had just been loaded.
+func (c *linkCache) warm(links []*Link, now time.Time) {
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+	for _, link := range links {
+		c.put(linkID(link.Short), link, gen, now)
+	}
+}
+
+// invalidate removes the links with the given IDs from the cache.
+func (c *linkCache) invalidate(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for _, id := range ids {
+		if e, ok := c.items[id]; ok {
+			c.remove(e)
+		}
+	}
+}
+
+// invalidateAll removes every link from the cache.
+func (c *linkCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.ll.Init()
+	clear(c.items)
+}
+
+func (c *linkCache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*linkCacheEntry).id)
+}
+
+// len returns the number of cached links.
+func (c *linkCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// EnableCache caches up to size loaded links for up to ttl each, so that
+// redirects to popular links don't each query the database. Cached links
+// are dropped when they are written, by this replica or, once
+// ListenForChanges is running, by any other.
+func (s *PostgresDB) EnableCache(size int, ttl time.Duration) {
+	s.cache = newLinkCache(size, ttl)
+}
+
+// EnableRedis shares loaded links between replicas on the Redis server of
+// r, which should have a TTL bounding how stale their click totals get.
+// Links are dropped from it when they are written, like from the cache.
+func (s *PostgresDB) EnableRedis(r *RedisDB) {
+	s.shared = r
+}
+
+// forget drops the links with the given IDs from the coalesced loads, the
+// cache, and the Redis server after they are written, and tells other
+// replicas to drop them from their caches.
+func (s *PostgresDB) forget(ids ...string) {
+	for _, id := range ids {
+		s.loads.Forget(id)
+	}
+	if s.cache != nil {
+		s.cache.invalidate(ids...)
+	}
+	if s.shared != nil {
+		s.shared.forget(ids...)
+	}
+	for _, id := range ids {
+		s.notify(linkCacheChannel, id)
+	}
+}
+
+// forgetAll drops every link from the cache and the Redis server, and
+// tells other replicas to drop them from their caches, after a write that may have changed any link.
+func (s *PostgresDB) forgetAll() {
+	if s.cache != nil {
+		s.cache.invalidateAll()
+	}
+	if s.shared != nil {
+		s.shared.forgetAll()
+	}
+	s.notify(linkCacheChannel, "*")
+}
+
+// notify sends payload on the notification channel. Failures are logged,
+// since caches are still refreshed or expire after a while.
+func (s *PostgresDB) notify(channel, payload string) {
+	if _, err := s.db.Exec("SELECT pg_notify($1, $2)", channel, payload); err != nil {
+		log.Printf("notifying %s: %v", channel, err)
+	}
+}
+
+// ListenForChanges drops links and settings from the caches when other
+// replicas announce writes to them, until ctx is done. While it can't
+// listen, such as after losing its connection, it empties the caches, since
+// announcements may have been missed, and retries.
+func (s *PostgresDB) ListenForChanges(ctx context.Context) {
+	for ctx.Err() == nil {
+		err := s.listen(ctx)
+		s.invalidateCaches()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listening for changes: %v; retrying", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// invalidateCaches empties the link cache and the shared caches.
+func (s *PostgresDB) invalidateCaches() {
+	if s.cache != nil {
+		s.cache.invalidateAll()
+	}
+	for _, invalidate := range sharedCaches {
+		invalidate()
+	}
+}
+
+// listen listens on linkCacheChannel and cacheChannel on a dedicated
+// connection, dropping announced links and settings from the caches, until
+// ctx is done or the connection fails.
+func (s *PostgresDB) listen(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		pc := sc.Conn()
+		for _, channel := range []string{linkCacheChannel, cacheChannel} {
+			if _, err := pc.Exec(ctx, "LISTEN "+channel); err != nil {
+				return err
+			}
+		}
+		// changes written before listening may have been cached
+		s.invalidateCaches()
+		for {
+			n, err := pc.WaitForNotification(ctx)
+			if err != nil {
+				// the connection can't be reused while listening
+				pc.Close(context.Background())
+				return err
+			}
+			switch {
+			case n.Channel == cacheChannel:
+				if invalidate, ok := sharedCaches[n.Payload]; ok {
+					invalidate()
+				}
+			case s.cache == nil:
+			case n.Payload == "*":
+				s.cache.invalidateAll()
+			default:
+				s.cache.invalidate(n.Payload)
+			}
+		}
+	})
+}
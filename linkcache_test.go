@@ -0,0 +1,96 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinkCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newLinkCache(2, time.Minute)
+	get := func(id string) *Link {
+		t.Helper()
+		link, _ := c.get(id, now)
+		return link
+	}
+	put := func(id string) {
+		t.Helper()
+		_, gen := c.get(id, now)
+		c.put(id, &Link{Short: id, Long: "https://" + id + ".example.com/"}, gen, now)
+	}
+
+	put("a")
+	put("b")
+	if link := get("a"); link == nil || link.Short != "a" {
+		t.Fatalf("get(a) = %v; want cached link", link)
+	}
+	// a was used more recently than b, so b is evicted
+	put("c")
+	if get("b") != nil {
+		t.Errorf("get(b) after eviction = non-nil; want nil")
+	}
+	if get("a") == nil || get("c") == nil {
+		t.Errorf("get(a), get(c) = nil; want cached links")
+	}
+	if n := c.len(); n != 2 {
+		t.Errorf("len = %d; want 2", n)
+	}
+
+	// callers own the returned links
+	get("a").Long = "https://changed.example.com/"
+	if link := get("a"); link.Long != "https://a.example.com/" {
+		t.Errorf("cached link changed to %q", link.Long)
+	}
+
+	c.invalidate("a")
+	if get("a") != nil {
+		t.Errorf("get(a) after invalidate = non-nil; want nil")
+	}
+	if get("c") == nil {
+		t.Errorf("get(c) after invalidating a = nil; want cached link")
+	}
+
+	c.invalidateAll()
+	if n := c.len(); n != 0 {
+		t.Errorf("len after invalidateAll = %d; want 0", n)
+	}
+}
+
+func TestLinkCacheExpiry(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newLinkCache(10, time.Minute)
+	_, gen := c.get("a", now)
+	c.put("a", &Link{Short: "a"}, gen, now)
+
+	if link, _ := c.get("a", now.Add(59*time.Second)); link == nil {
+		t.Errorf("get before TTL = nil; want cached link")
+	}
+	if link, _ := c.get("a", now.Add(time.Minute)); link != nil {
+		t.Errorf("get after TTL = non-nil; want nil")
+	}
+	if n := c.len(); n != 0 {
+		t.Errorf("len after expiry = %d; want 0", n)
+	}
+}
+
+func TestLinkCacheStalePut(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newLinkCache(10, time.Minute)
+
+	// a load that started before a write must not cache what it read
+	_, gen := c.get("a", now)
+	c.invalidate("a")
+	c.put("a", &Link{Short: "a"}, gen, now)
+	if link, _ := c.get("a", now); link != nil {
+		t.Errorf("get after stale put = non-nil; want nil")
+	}
+
+	_, gen = c.get("a", now)
+	c.put("a", &Link{Short: "a"}, gen, now)
+	if link, _ := c.get("a", now); link == nil {
+		t.Errorf("get after put = nil; want cached link")
+	}
+}
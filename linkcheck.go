@@ -0,0 +1,583 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// linkCheckTimeout is how long the dead link checker waits for a target.
+const linkCheckTimeout = 15 * time.Second
+
+// linkCheckConcurrency is how many targets the dead link checker checks at
+// once, across all hosts.
+const linkCheckConcurrency = 8
+
+// linkCheckBackoff is how long the dead link checker waits before its next
+// request to a host that asked it to slow down without saying how long for.
+const linkCheckBackoff = time.Minute
+
+// linkCheckMaxBackoff is the longest the dead link checker waits for a host
+// that asked it to slow down. Hosts that ask for longer are skipped until
+// the next run.
+const linkCheckMaxBackoff = 10 * time.Minute
+
+// linkCheckRecheckAfter is how long the dead link checker leaves a target
+// before checking it again when --link-check-window is set, so that runs
+// every hour through the window resume where the last left off.
+const linkCheckRecheckAfter = 20 * time.Hour
+
+// robotsMaxSize is the most of a robots.txt file the dead link checker reads.
+const robotsMaxSize = 512 << 10
+
+// linkCheckHours is the --link-check-window, or nil if it is not set.
+var linkCheckHours *dailyWindow
+
+// linkCheckClient is the HTTP client the dead link checker uses. It is
+// replaced by the tsnet client when running on a tailnet, so that targets on
+// the tailnet can be reached.
+var linkCheckClient = http.DefaultClient
+
+// sendMail sends email, replaced in tests.
+var sendMail = smtp.SendMail
+
+// checkTargetHealth requests target, returning its health and whether the
+// result is definitive. Targets that respond 404 Not Found or 410 Gone, or
+// whose host does not exist, are unhealthy. Other failures, such as
+// timeouts and server errors, may be temporary and are not definitive.
+//
+// If the server asks the checker to slow down, with 429 Too Many Requests or
+// 503 Service Unavailable, retryAfter is how long to wait before requesting
+// anything else from it.
+//
+// hc overrides the check: if it sets a status, targets are only healthy if
+// they respond with it, and if it names a credential, its header is sent.
+func checkTargetHealth(ctx context.Context, client *http.Client, target string, hc healthCheck) (h TargetHealth, definitive bool, retryAfter time.Duration) {
+	h = TargetHealth{Target: target, Checked: time.Now().UTC()}
+	ctx, cancel := context.WithTimeout(ctx, linkCheckTimeout)
+	defer cancel()
+
+	var cred *linkCheckCredential
+	if hc.auth != "" || hc.status != 0 {
+		u, err := url.Parse(target)
+		if err != nil {
+			h.Detail = err.Error()
+			return h, true, 0
+		}
+		if hc.auth != "" {
+			// the credential file may have changed since the link was saved
+			if cred = linkCheckAuth[hc.auth]; cred == nil || !cred.allows(u.Hostname()) {
+				h.Detail = fmt.Sprintf("health check credential %q can't be used", hc.auth)
+				return h, false, 0
+			}
+		}
+		client = healthCheckClient(client, u, hc)
+	}
+
+	var resp *http.Response
+	var err error
+	for _, method := range []string{"HEAD", "GET"} {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			h.Detail = err.Error()
+			return h, true, 0
+		}
+		req.Header.Set("User-Agent", *linkCheckUserAgent)
+		if cred != nil {
+			req.Header.Set(cred.name, cred.value)
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		// some servers don't support HEAD, so retry those with GET
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		h.Detail = "no such host " + dnsErr.Name
+		return h, true, 0
+	case err != nil:
+		h.Detail = err.Error()
+		return h, false, 0
+	case hc.status != 0 && resp.StatusCode == hc.status:
+		h.Healthy = true
+		return h, true, 0
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		h.Detail = resp.Status
+		return h, true, 0
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		h.Detail = resp.Status
+		return h, false, retryAfterDelay(resp.Header.Get("Retry-After"), time.Now())
+	case resp.StatusCode >= 500:
+		h.Detail = resp.Status
+		return h, false, 0
+	case hc.status != 0 && resp.StatusCode != hc.status:
+		h.Detail = fmt.Sprintf("%s, expected %d", resp.Status, hc.status)
+		return h, true, 0
+	}
+	h.Healthy = true
+	return h, true, 0
+}
+
+// retryAfterDelay returns how long a Retry-After header value, in seconds
+// or an HTTP date, asks clients to wait, or linkCheckBackoff if it is
+// missing or invalid.
+func retryAfterDelay(v string, now time.Time) time.Duration {
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return linkCheckBackoff
+}
+
+// robotsAgent returns the product token of --link-check-user-agent, which
+// robots.txt files name crawlers by.
+func robotsAgent() string {
+	token, _, _ := strings.Cut(*linkCheckUserAgent, "/")
+	token, _, _ = strings.Cut(token, " ")
+	return token
+}
+
+// fetchRobots returns the dead link checker's robots.txt rules for the
+// scheme and host of u. Hosts without a robots.txt allow everything. ok is
+// false if robots.txt couldn't be fetched because of a timeout or server
+// error, in which case the host should be left alone until the next run.
+func fetchRobots(ctx context.Context, client *http.Client, u *url.URL) (rules *robotsRules, ok bool) {
+	ctx, cancel := context.WithTimeout(ctx, linkCheckTimeout)
+	defer cancel()
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL.String(), nil)
+	if err != nil {
+		return nil, false
+	}
+	req.Header.Set("User-Agent", *linkCheckUserAgent)
+	resp, err := client.Do(req)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		// checking the target records that the host is gone
+		return nil, true
+	}
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return nil, false
+	case resp.StatusCode != http.StatusOK:
+		return nil, true
+	}
+	return parseRobots(io.LimitReader(resp.Body, robotsMaxSize), robotsAgent()), true
+}
+
+// linkCheckHost paces the dead link checker's requests to one host, so
+// that they start no closer together than its delay, which is the longer of
+// --link-check-delay and the host's robots.txt Crawl-delay.
+type linkCheckHost struct {
+	mu     sync.Mutex
+	delay  time.Duration
+	next   time.Time // earliest start of the next request
+	gaveUp bool      // the host asked for a longer backoff than linkCheckMaxBackoff
+}
+
+// wait blocks until the next request to the host may start. It returns
+// false if ctx is done or the checker has given up on the host.
+func (h *linkCheckHost) wait(ctx context.Context) bool {
+	h.mu.Lock()
+	if h.gaveUp {
+		h.mu.Unlock()
+		return false
+	}
+	now := time.Now()
+	start := now
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(h.delay)
+	h.mu.Unlock()
+
+	t := time.NewTimer(start.Sub(now))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.gaveUp
+}
+
+// backoff delays the next request to the host by d, or gives up on it for
+// the rest of the run if d is longer than linkCheckMaxBackoff.
+func (h *linkCheckHost) backoff(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if d > linkCheckMaxBackoff {
+		h.gaveUp = true
+		return
+	}
+	if next := time.Now().Add(d); next.After(h.next) {
+		h.next = next
+	}
+}
+
+// linkCheckTarget is a link destination to check, as stored and parsed,
+// and the health check of the links to it.
+type linkCheckTarget struct {
+	raw string
+	u   *url.URL
+	hc  healthCheck
+}
+
+// checkHostTargets checks targets, which are all on one host, calling
+// record with each definitive result. It makes at most --link-check-per-host
+// requests to the host at once, paced by a linkCheckHost, and each holds a
+// slot in sem while it runs. Targets disallowed by the host's robots.txt are
+// not checked; it returns how many there were.
+func checkHostTargets(ctx context.Context, sem chan struct{}, targets []linkCheckTarget, record func(TargetHealth)) (disallowed int) {
+	host := &linkCheckHost{delay: *linkCheckDelay}
+	robots := make(map[string]*robotsRules) // by scheme
+	for _, t := range targets {
+		if _, ok := robots[t.u.Scheme]; ok {
+			continue
+		}
+		if !host.wait(ctx) {
+			return 0
+		}
+		rules, ok := fetchRobots(ctx, linkCheckClient, t.u)
+		if !ok {
+			return 0
+		}
+		robots[t.u.Scheme] = rules
+		if rules != nil {
+			host.delay = max(host.delay, rules.crawlDelay)
+		}
+	}
+	var allowed []linkCheckTarget
+	for _, t := range targets {
+		if robots[t.u.Scheme].allowed(t.u.RequestURI()) {
+			allowed = append(allowed, t)
+		} else {
+			disallowed++
+		}
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range min(max(*linkCheckPerHost, 1), len(allowed)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(allowed) {
+					return
+				}
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				if !host.wait(ctx) {
+					<-sem
+					return
+				}
+				h, definitive, retryAfter := checkTargetHealth(ctx, linkCheckClient, allowed[i].raw, allowed[i].hc)
+				<-sem
+				if retryAfter > 0 {
+					host.backoff(retryAfter)
+				}
+				if definitive {
+					record(h)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return disallowed
+}
+
+// dailyWindow is a period of each day, which may span midnight.
+type dailyWindow struct {
+	start, end time.Duration // since midnight
+}
+
+// parseDailyWindow parses a window such as "01:00-05:00" or "22:00-04:00".
+func parseDailyWindow(s string) (*dailyWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("window %q is not of the form HH:MM-HH:MM", s)
+	}
+	var w dailyWindow
+	for _, p := range []struct {
+		s string
+		d *time.Duration
+	}{{from, &w.start}, {to, &w.end}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(p.s))
+		if err != nil {
+			return nil, fmt.Errorf("window %q is not of the form HH:MM-HH:MM", s)
+		}
+		*p.d = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("window %q is empty", s)
+	}
+	return &w, nil
+}
+
+// remaining returns how much of the window is left at t, in t's location,
+// and whether t is in the window at all.
+func (w *dailyWindow) remaining(t time.Time) (time.Duration, bool) {
+	since := t.Sub(startOfDay(t, t.Location()))
+	switch {
+	case w.start < w.end && since >= w.start && since < w.end:
+		return w.end - since, true
+	case w.start > w.end && since >= w.start:
+		return 24*time.Hour - since + w.end, true
+	case w.start > w.end && since < w.end:
+		return w.end - since, true
+	}
+	return 0, false
+}
+
+// linkCheckTargets returns the destinations of links that the dead link
+// checker can check, with the links to each. Template destinations,
+// destinations that aren't http or https, and destinations on golink itself
+// are skipped, as are links whose health check is off. The https form of
+// each http destination is also checked, so that links can be upgraded to
+// it.
+func linkCheckTargets(links []*Link) map[string][]*Link {
+	targets := make(map[string][]*Link)
+	for _, link := range links {
+		if strings.Contains(link.Long, "{{") || linkHealthCheck(link).off {
+			continue
+		}
+		u, err := url.Parse(link.Long)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || isGolinkHost(u.Host) {
+			continue
+		}
+		targets[link.Long] = append(targets[link.Long], link)
+		if rest, ok := strings.CutPrefix(link.Long, "http://"); ok {
+			if _, ok := targets["https://"+rest]; !ok {
+				targets["https://"+rest] = nil
+			}
+		}
+	}
+	return targets
+}
+
+// targetHealthCheck returns the health check of a target shared by links,
+// which is that of the first link by short name that overrides it.
+func targetHealthCheck(links []*Link) healthCheck {
+	var hc healthCheck
+	var from string
+	for _, link := range links {
+		if link.HealthCheck != "" && (from == "" || link.Short < from) {
+			hc, from = linkHealthCheck(link), link.Short
+		}
+	}
+	return hc
+}
+
+// checkLinks checks the destination of every link, recording the results
+// as target health, and emails the owners of links that have newly broken
+// if --link-check-smtp is set.
+//
+// Requests are paced per host, and targets are checked oldest result first.
+// If --link-check-window is set, nothing is checked outside it, the run
+// stops when it ends, and targets checked within linkCheckRecheckAfter are
+// skipped, so that the next run in the window picks up where this one
+// stopped.
+func checkLinks(ctx context.Context) error {
+	runCtx := ctx
+	if linkCheckHours != nil {
+		left, ok := linkCheckHours.remaining(time.Now().In(statsLocation))
+		if !ok {
+			log.Printf("not checking links outside --link-check-window=%s", *linkCheckWindow)
+			return nil
+		}
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, left)
+		defer cancel()
+	}
+
+	links, err := db.LoadAll()
+	if err != nil {
+		return err
+	}
+	targets := linkCheckTargets(links)
+	names := make([]string, 0, len(targets))
+	for target := range targets {
+		names = append(names, target)
+	}
+	previous, err := db.LoadTargetHealth(names)
+	if err != nil {
+		return err
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := previous[names[i]].Checked, previous[names[j]].Checked
+		if !ci.Equal(cj) {
+			return ci.Before(cj)
+		}
+		return names[i] < names[j]
+	})
+
+	byHost := make(map[string][]linkCheckTarget)
+	var due int
+	for _, target := range names {
+		if linkCheckHours != nil && time.Since(previous[target].Checked) < linkCheckRecheckAfter {
+			continue
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		byHost[host] = append(byHost[host], linkCheckTarget{raw: target, u: u, hc: targetHealthCheck(targets[target])})
+		due++
+	}
+
+	var (
+		mu         sync.Mutex
+		newlyBroke []*Link
+		saveErr    error
+		checked    int
+		disallowed int
+	)
+	sem := make(chan struct{}, linkCheckConcurrency)
+	var wg sync.WaitGroup
+	for _, hostTargets := range byHost {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := checkHostTargets(runCtx, sem, hostTargets, func(h TargetHealth) {
+				err := db.SaveTargetHealth(h)
+				mu.Lock()
+				defer mu.Unlock()
+				checked++
+				if err != nil {
+					saveErr = err
+					return
+				}
+				if prev, ok := previous[h.Target]; !h.Healthy && (!ok || prev.Healthy) {
+					newlyBroke = append(newlyBroke, targets[h.Target]...)
+				}
+			})
+			mu.Lock()
+			disallowed += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	log.Printf("checked %d of %d due link targets on %d hosts (%d disallowed by robots.txt): %d links newly broken", checked, due, len(byHost), disallowed, len(newlyBroke))
+	if saveErr != nil {
+		return saveErr
+	}
+	if *linkCheckSMTP != "" {
+		if err := emailBrokenLinks(newlyBroke); err != nil {
+			return err
+		}
+	}
+	// running out of window isn't an error
+	return ctx.Err()
+}
+
+// ownerEmail returns the email address of the owner of a link, or "" if the
+// owner is a team or its login is not an email address.
+func ownerEmail(owner string) string {
+	if owner == "" || strings.HasPrefix(owner, teamOwnerPrefix) {
+		return ""
+	}
+	login, err := ownerIdentity(owner)
+	if err != nil {
+		return ""
+	}
+	addr, err := mail.ParseAddress(login)
+	if err != nil || addr.Address != login {
+		return ""
+	}
+	// tailnet logins such as "alice@github" are not email addresses
+	if _, domain, _ := strings.Cut(login, "@"); !strings.Contains(domain, ".") {
+		return ""
+	}
+	return login
+}
+
+// brokenLinksEmail returns the message telling an owner, to, that their
+// links have broken.
+func brokenLinksEmail(from, to string, links []*Link) []byte {
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Short < links[j].Short
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %d of your %s links appear to be broken\r\n", len(links), goHostname())
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&b, "The destinations of these %s links no longer exist. Please update or delete them:\r\n\r\n", goHostname())
+	for _, link := range links {
+		fmt.Fprintf(&b, "  %s/%s -> %s\r\n", goHostname(), link.Short, link.Long)
+		fmt.Fprintf(&b, "    edit at http://%s/.detail/%s\r\n", goHostname(), link.Short)
+	}
+	return []byte(b.String())
+}
+
+// emailBrokenLinks emails each owner of links a list of them, using
+// --link-check-smtp.
+func emailBrokenLinks(links []*Link) error {
+	byOwner := make(map[string][]*Link)
+	for _, link := range links {
+		if to := ownerEmail(link.Owner); to != "" {
+			byOwner[to] = append(byOwner[to], link)
+		}
+	}
+	var errs []error
+	for to, links := range byOwner {
+		msg := brokenLinksEmail(*linkCheckFrom, to, links)
+		if err := sendMail(*linkCheckSMTP, nil, *linkCheckFrom, []string{to}, msg); err != nil {
+			errs = append(errs, fmt.Errorf("emailing %s: %w", to, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// brokenTargets returns the health of the link destinations that are
+// marked unhealthy, keyed by target. Errors are logged rather than
+// returned.
+func brokenTargets() map[string]*TargetHealth {
+	health, err := db.LoadUnhealthyTargets()
+	if err != nil {
+		log.Printf("loading unhealthy targets: %v", err)
+	}
+	broken := make(map[string]*TargetHealth, len(health))
+	for target, h := range health {
+		broken[target] = &h
+	}
+	return broken
+}
@@ -0,0 +1,254 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTargetHealth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/missing":
+			http.NotFound(w, r)
+		case "/no-head":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/login":
+			http.Redirect(w, r, "/", http.StatusFound)
+		case "/busy":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/sso":
+			if r.Header.Get("Authorization") != "Bearer checker" {
+				http.Redirect(w, r, "/login", http.StatusFound)
+			}
+		}
+	}))
+	defer ts.Close()
+
+	oldAuth := linkCheckAuth
+	t.Cleanup(func() { linkCheckAuth = oldAuth })
+	linkCheckAuth = map[string]*linkCheckCredential{
+		"sso":   {hosts: []string{"127.0.0.1"}, name: "Authorization", value: "Bearer checker"},
+		"other": {hosts: []string{"example.com"}, name: "Authorization", value: "Bearer checker"},
+	}
+
+	tests := []struct {
+		path           string
+		hc             string
+		wantHealthy    bool
+		wantDefinitive bool
+		wantRetryAfter time.Duration
+	}{
+		{"/", "", true, true, 0},
+		{"/login", "", true, true, 0},
+		{"/no-head", "", true, true, 0},
+		{"/gone", "", false, true, 0},
+		{"/missing", "", false, true, 0},
+		{"/error", "", false, false, 0},
+		{"/busy", "", false, false, 2 * time.Minute},
+		{"/sso", "", true, true, 0},
+		{"/sso", "status=302", true, true, 0},
+		{"/sso", "status=302 auth=sso", false, true, 0},
+		{"/sso", "status=200 auth=sso", true, true, 0},
+		{"/sso", "auth=other", false, false, 0},
+		{"/gone", "status=410", true, true, 0},
+	}
+	for _, tt := range tests {
+		hc, err := parseHealthCheck(tt.hc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, definitive, retryAfter := checkTargetHealth(context.Background(), ts.Client(), ts.URL+tt.path, hc)
+		if h.Healthy != tt.wantHealthy || definitive != tt.wantDefinitive || retryAfter != tt.wantRetryAfter {
+			t.Errorf("checkTargetHealth(%s, %q) = %v (%q), %v, %v; want %v, %v, %v", tt.path, tt.hc, h.Healthy, h.Detail, definitive, retryAfter, tt.wantHealthy, tt.wantDefinitive, tt.wantRetryAfter)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	oldClient := linkCheckClient
+	t.Cleanup(func() { linkCheckClient = oldClient })
+	linkCheckClient = ts.Client()
+	oldDelay := *linkCheckDelay
+	t.Cleanup(func() { *linkCheckDelay = oldDelay })
+	*linkCheckDelay = 0
+
+	db = newTestDB(t)
+	db.Save(&Link{Short: "wiki", Long: ts.URL + "/wiki", Owner: "foo@example.com"})
+	db.Save(&Link{Short: "old-wiki", Long: ts.URL + "/old", Owner: "foo@example.com"})
+	db.Save(&Link{Short: "old-docs", Long: ts.URL + "/old", Owner: "team:docs"})
+	db.Save(&Link{Short: "old-unchecked", Long: ts.URL + "/old", Owner: "bar@example.com", HealthCheck: "off"})
+	db.Save(&Link{Short: "who", Long: "http://who/{{.Path}}", Owner: "foo@example.com"})
+
+	oldSMTP, oldSendMail := *linkCheckSMTP, sendMail
+	t.Cleanup(func() { *linkCheckSMTP, sendMail = oldSMTP, oldSendMail })
+	*linkCheckSMTP = "smtp.example.com:25"
+	var sent []string
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, strings.Join(to, ",")+"\n"+string(msg))
+		return nil
+	}
+
+	if err := checkLinks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || !strings.HasPrefix(sent[0], "foo@example.com\n") || !strings.Contains(sent[0], "/old-wiki ->") || strings.Contains(sent[0], "old-docs") {
+		t.Errorf("sent %q; want one email to foo@example.com about old-wiki", sent)
+	}
+
+	q, err := parseLinkQuery("is:broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cond, args, err := q.sql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// links whose health check is off aren't flagged
+	links, err := db.LoadWhere(cond, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 {
+		t.Errorf("found %d broken links; want 2", len(links))
+	}
+
+	// owners are only emailed when links break, not every time they are checked
+	sent = nil
+	if err := checkLinks(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 0 {
+		t.Errorf("second check sent %q; want none", sent)
+	}
+}
+
+func TestCheckHostTargets(t *testing.T) {
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.URL.Path == "/robots.txt" {
+			w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+		}
+	}))
+	defer ts.Close()
+	oldClient, oldDelay, oldPerHost := linkCheckClient, *linkCheckDelay, *linkCheckPerHost
+	t.Cleanup(func() { linkCheckClient, *linkCheckDelay, *linkCheckPerHost = oldClient, oldDelay, oldPerHost })
+	linkCheckClient = ts.Client()
+	*linkCheckDelay = 0
+	*linkCheckPerHost = 1
+
+	var targets []linkCheckTarget
+	for _, p := range []string{"/a", "/private/b", "/c"} {
+		u, err := url.Parse(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, linkCheckTarget{raw: u.String(), u: u})
+	}
+	var recorded []string
+	disallowed := checkHostTargets(context.Background(), make(chan struct{}, 1), targets, func(h TargetHealth) {
+		recorded = append(recorded, strings.TrimPrefix(h.Target, ts.URL))
+	})
+	if disallowed != 1 {
+		t.Errorf("disallowed = %d; want 1", disallowed)
+	}
+	if got, want := strings.Join(recorded, " "), "/a /c"; got != want {
+		t.Errorf("recorded %q; want %q", got, want)
+	}
+	if got, want := strings.Join(requested, " "), "/robots.txt /a /c"; got != want {
+		t.Errorf("requested %q; want %q", got, want)
+	}
+}
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{"0", 0},
+		{"Fri, 01 Mar 2024 12:05:00 GMT", 5 * time.Minute},
+		{"Fri, 01 Mar 2024 11:00:00 GMT", 0},
+		{"", linkCheckBackoff},
+		{"soon", linkCheckBackoff},
+	}
+	for _, tt := range tests {
+		if got := retryAfterDelay(tt.v, now); got != tt.want {
+			t.Errorf("retryAfterDelay(%q) = %v; want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestDailyWindow(t *testing.T) {
+	for _, bad := range []string{"", "01:00", "1am-5am", "25:00-01:00", "03:00-03:00"} {
+		if _, err := parseDailyWindow(bad); err == nil {
+			t.Errorf("parseDailyWindow(%q) succeeded; want error", bad)
+		}
+	}
+
+	at := func(hour, min int) time.Time { return time.Date(2024, 3, 1, hour, min, 0, 0, time.UTC) }
+	tests := []struct {
+		window   string
+		t        time.Time
+		wantLeft time.Duration
+		wantOK   bool
+	}{
+		{"01:00-05:00", at(0, 30), 0, false},
+		{"01:00-05:00", at(1, 0), 4 * time.Hour, true},
+		{"01:00-05:00", at(4, 30), 30 * time.Minute, true},
+		{"01:00-05:00", at(5, 0), 0, false},
+		{"22:00-04:00", at(23, 0), 5 * time.Hour, true},
+		{"22:00-04:00", at(3, 0), time.Hour, true},
+		{"22:00-04:00", at(12, 0), 0, false},
+	}
+	for _, tt := range tests {
+		w, err := parseDailyWindow(tt.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left, ok := w.remaining(tt.t)
+		if left != tt.wantLeft || ok != tt.wantOK {
+			t.Errorf("%s.remaining(%s) = %v, %v; want %v, %v", tt.window, tt.t.Format("15:04"), left, ok, tt.wantLeft, tt.wantOK)
+		}
+	}
+}
+
+func TestOwnerEmail(t *testing.T) {
+	tests := []struct {
+		owner, want string
+	}{
+		{"foo@example.com", "foo@example.com"},
+		{"foo@github", ""},
+		{"team:sre", ""},
+		{"tagged-devices", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ownerEmail(tt.owner); got != tt.want {
+			t.Errorf("ownerEmail(%q) = %q; want %q", tt.owner, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// idStrategy is a way of normalizing link short names into the IDs that
+// links are stored and looked up by. Names that normalize to the same ID are
+// the same link.
+type idStrategy struct {
+	name    string
+	version int // recorded as the IDVersion of links stored with the strategy
+	id      func(short string) string
+}
+
+// idStrategies are the strategies --id-normalization can select. Versions
+// must not be reused, since they record how existing links were normalized.
+var idStrategies = []idStrategy{
+	{"legacy", 1, legacyLinkID},
+	{"strict", 2, strictLinkID},
+	{"fold", 3, foldLinkID},
+}
+
+// currentIDStrategy is the strategy selected by --id-normalization.
+var currentIDStrategy = idStrategies[0]
+
+// setIDStrategy sets currentIDStrategy to the strategy named name.
+func setIDStrategy(name string) error {
+	i := slices.IndexFunc(idStrategies, func(s idStrategy) bool { return s.name == name })
+	if i < 0 {
+		return fmt.Errorf("unknown strategy %q", name)
+	}
+	currentIDStrategy = idStrategies[i]
+	return nil
+}
+
+// linkID returns the normalized ID for a link short name, using
+// --id-normalization.
+func linkID(short string) string {
+	return currentIDStrategy.id(short)
+}
+
+// legacyLinkID ignores case and hyphens, so that go/Foo-Bar and go/foobar
+// are the same link.
+func legacyLinkID(short string) string {
+	id := url.PathEscape(strings.ToLower(short))
+	id = strings.ReplaceAll(id, "-", "")
+	return id
+}
+
+// strictLinkID distinguishes every short name, so that go/Foo, go/foo, and
+// go/f-oo are different links.
+func strictLinkID(short string) string {
+	return url.PathEscape(short)
+}
+
+// foldLinkID ignores case like legacyLinkID, but also folds case variants
+// that lowercasing keeps apart, and ignores all dashes, including en and em
+// dashes. Under it go/ΣΟΦΙΑΣ and go/σοφιας, whose final sigmas differ, or
+// go/a–b and go/ab, are the same link.
+func foldLinkID(short string) string {
+	var b strings.Builder
+	for _, r := range short {
+		if unicode.Is(unicode.Pd, r) {
+			continue
+		}
+		b.WriteRune(foldRune(r))
+	}
+	return url.PathEscape(b.String())
+}
+
+// foldRune returns the lowercase form of r's uppercase form, so that every
+// case variant of a letter, such as K, k, and the Kelvin sign, or Σ, σ, and
+// final ς, folds to the same rune.
+func foldRune(r rune) rune {
+	return unicode.ToLower(unicode.ToUpper(r))
+}
+
+// checkIDVersions returns an error if any links were stored with a
+// different ID strategy than --id-normalization, since they could not be
+// found by the IDs it produces. They are renormalized with
+// "golink migrate-ids".
+func checkIDVersions() error {
+	n, err := db.CountStaleIDs(currentIDStrategy.version)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("%d links were stored with a different --id-normalization than %q; run \"golink --id-normalization=%s migrate-ids\" to renormalize them", n, currentIDStrategy.name, currentIDStrategy.name)
+	}
+	return nil
+}
+
+// runMigrateIDsCommand runs the "golink migrate-ids" subcommand with args,
+// which renormalizes stored IDs with --id-normalization. With "check", it
+// only reports what would change.
+func runMigrateIDsCommand(args []string, w io.Writer) error {
+	checkOnly := len(args) == 1 && args[0] == "check"
+	if len(args) > 0 && !checkOnly {
+		return errors.New("usage: golink migrate-ids [check]")
+	}
+	res, err := db.RenormalizeIDs(currentIDStrategy.version, checkOnly)
+	if err != nil {
+		return err
+	}
+	for _, c := range res.Collisions {
+		fmt.Fprintf(w, "FAIL  %s %s: %s\n", c.Table, c.ID, strings.Join(c.Shorts, ", "))
+	}
+	if len(res.Collisions) > 0 {
+		return fmt.Errorf("%d IDs would collide under %q; merge or rename them first", len(res.Collisions), currentIDStrategy.name)
+	}
+	for _, table := range slices.Sorted(maps.Keys(res.Changed)) {
+		fmt.Fprintf(w, "%s: %d IDs\n", table, res.Changed[table])
+	}
+	if checkOnly {
+		fmt.Fprintf(w, "%d IDs would be renormalized with %q\n", res.Total(), currentIDStrategy.name)
+	} else {
+		fmt.Fprintf(w, "renormalized %d IDs with %q\n", res.Total(), currentIDStrategy.name)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import "testing"
+
+func TestIDStrategies(t *testing.T) {
+	tests := []struct {
+		short                string
+		legacy, strict, fold string
+	}{
+		{"foo", "foo", "foo", "foo"},
+		{"Foo-Bar", "foobar", "Foo-Bar", "foobar"},
+		{"a–b", "a%E2%80%93b", "a%E2%80%93b", "ab"},
+		{"ΣΟΦΙΑ", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1", "%CE%A3%CE%9F%CE%A6%CE%99%CE%91", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1"},
+		{"ΣΟΦΙΑΣ", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1%CF%83", "%CE%A3%CE%9F%CE%A6%CE%99%CE%91%CE%A3", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1%CF%83"},
+		{"σοφιας", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1%CF%82", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1%CF%82", "%CF%83%CE%BF%CF%86%CE%B9%CE%B1%CF%83"},
+		{"Kelvin", "kelvin", "%E2%84%AAelvin", "kelvin"},
+		{"a/b c", "a%2Fb%20c", "a%2Fb%20c", "a%2Fb%20c"},
+	}
+	for _, tt := range tests {
+		for _, s := range idStrategies {
+			want := map[string]string{"legacy": tt.legacy, "strict": tt.strict, "fold": tt.fold}[s.name]
+			if got := s.id(tt.short); got != want {
+				t.Errorf("%s(%q) = %q; want %q", s.name, tt.short, got, want)
+			}
+		}
+	}
+}
+
+func TestSetIDStrategy(t *testing.T) {
+	t.Cleanup(func() { currentIDStrategy = idStrategies[0] })
+
+	if err := setIDStrategy("strict"); err != nil {
+		t.Fatal(err)
+	}
+	if got := linkID("Foo-Bar"); got != "Foo-Bar" {
+		t.Errorf("strict linkID(Foo-Bar) = %q; want Foo-Bar", got)
+	}
+	if err := setIDStrategy("unknown"); err == nil {
+		t.Error("setIDStrategy(unknown) succeeded; want error")
+	}
+	if currentIDStrategy.name != "strict" {
+		t.Errorf("failed setIDStrategy changed strategy to %q", currentIDStrategy.name)
+	}
+
+	seen := make(map[int]bool)
+	for _, s := range idStrategies {
+		if seen[s.version] {
+			t.Errorf("ID strategy version %d is used more than once", s.version)
+		}
+		seen[s.version] = true
+	}
+}
@@ -0,0 +1,422 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media types of PATCH /.api/v1/links/{short} request bodies.
+const (
+	jsonPatchType  = "application/json-patch+json"  // RFC 6902
+	mergePatchType = "application/merge-patch+json" // RFC 7386
+)
+
+// errPatchTest is returned when a JSON Patch "test" operation fails.
+var errPatchTest = errors.New("test failed")
+
+// linkPatchDocument is the JSON document that PATCH requests change: the
+// editable fields of a link, as they are given to PUT. Removing a field
+// from it clears that field of the link.
+type linkPatchDocument struct {
+	Short             string
+	Long              string
+	Owner             string
+	Tags              []string
+	CoOwners          []string
+	Fallbacks         []string
+	MaintenanceTarget string
+	Successor         string
+	Headers           map[string]string
+	Params            string
+	MaxUses           int
+	HealthCheck       string
+	Expires           string // RFC 3339, or "" if the link never expires
+	Version           int
+}
+
+// newLinkPatchDocument returns the patch document of link.
+func newLinkPatchDocument(link *Link) *linkPatchDocument {
+	d := &linkPatchDocument{
+		Short:             link.Short,
+		Long:              cmp.Or(link.RawLong, link.Long),
+		Owner:             link.Owner,
+		Tags:              append([]string{}, link.Tags...),
+		CoOwners:          append([]string{}, link.CoOwners...),
+		Fallbacks:         append([]string{}, link.Fallbacks...),
+		MaintenanceTarget: link.MaintenanceTarget,
+		Successor:         link.Successor,
+		Headers:           maps.Clone(link.Headers),
+		Params:            link.Params,
+		MaxUses:           link.MaxUses,
+		HealthCheck:       link.HealthCheck,
+		Version:           link.Version,
+	}
+	if d.Headers == nil {
+		// so that headers can be added with JSON Patch
+		d.Headers = make(map[string]string)
+	}
+	if !link.Expires.IsZero() {
+		d.Expires = link.Expires.UTC().Format(time.RFC3339)
+	}
+	return d
+}
+
+// patch applies patch, of media type jsonPatchType or mergePatchType, to d,
+// and returns the request that saves the fields it changed. The request
+// carries d's version, unless the patch changes it, so that the save fails
+// if the link was changed after d was loaded.
+func (d *linkPatchDocument) patch(mediaType string, patch []byte) (*apiLinkRequest, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	switch mediaType {
+	case jsonPatchType:
+		doc, err = applyJSONPatch(doc, patch)
+	case mergePatchType:
+		doc, err = applyMergePatch(doc, patch)
+	default:
+		err = fmt.Errorf("unsupported patch type %q", mediaType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return nil, errors.New("patched link must be an object")
+	}
+	if b, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+	var p linkPatchDocument
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid patched link: %w", err)
+	}
+	if p.Short != d.Short {
+		return nil, errors.New("Short cannot be changed")
+	}
+	if p.Long == "" {
+		return nil, errors.New("Long cannot be removed")
+	}
+
+	req := &apiLinkRequest{Version: cmp.Or(p.Version, d.Version)}
+	if p.Long != d.Long {
+		req.Long = p.Long
+	}
+	if p.Owner != d.Owner {
+		req.Owner = p.Owner
+	}
+	if !slices.Equal(p.Tags, d.Tags) {
+		req.Tags = &p.Tags
+	}
+	if !slices.Equal(p.CoOwners, d.CoOwners) {
+		req.CoOwners = &p.CoOwners
+	}
+	if !slices.Equal(p.Fallbacks, d.Fallbacks) {
+		req.Fallbacks = &p.Fallbacks
+	}
+	if p.MaintenanceTarget != d.MaintenanceTarget {
+		req.MaintenanceTarget = &p.MaintenanceTarget
+	}
+	if p.Successor != d.Successor {
+		req.Successor = &p.Successor
+	}
+	if !maps.Equal(p.Headers, d.Headers) {
+		req.Headers = &p.Headers
+	}
+	if p.Params != d.Params {
+		req.Params = &p.Params
+	}
+	if p.MaxUses != d.MaxUses {
+		req.MaxUses = &p.MaxUses
+	}
+	if p.HealthCheck != d.HealthCheck {
+		req.HealthCheck = &p.HealthCheck
+	}
+	if p.Expires != d.Expires {
+		req.Expires = &p.Expires
+	}
+	return req, nil
+}
+
+// applyMergePatch applies the RFC 7386 JSON Merge Patch patch to doc.
+func applyMergePatch(doc any, patch []byte) (any, error) {
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+	return mergePatch(doc, p), nil
+}
+
+func mergePatch(target, patch any) any {
+	pm, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]any)
+	if !ok {
+		tm = make(map[string]any)
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+		} else {
+			tm[k] = mergePatch(tm[k], v)
+		}
+	}
+	return tm
+}
+
+// jsonPatchOp is an operation of an RFC 6902 JSON Patch.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies the RFC 6902 JSON Patch patch to doc. The
+// operations are applied in order, and if any fails, so does the patch.
+func applyJSONPatch(doc any, patch []byte) (any, error) {
+	var ops []jsonPatchOp
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ops); err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+	for i, op := range ops {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func (op jsonPatchOp) apply(doc any) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value required")
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		if op.Op == "move" && len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		if value, err = getJSON(doc, from); err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		if op.Op == "move" {
+			if doc, err = removeJSON(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = cloneJSON(value)
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addJSON(doc, path, value)
+	case "remove":
+		return removeJSON(doc, path)
+	case "replace":
+		if _, err := getJSON(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = removeJSON(doc, path); err != nil {
+			return nil, err
+		}
+		return addJSON(doc, path, value)
+	case "test":
+		got, err := getJSON(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, value) {
+			return nil, errPatchTest
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// parseJSONPointer parses an RFC 6901 JSON Pointer into its reference
+// tokens. The empty pointer refers to the whole document.
+func parseJSONPointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the reference token t as an index of an array of n
+// elements. If end is true, t may also be "-" or n, referring to the end
+// of the array.
+func arrayIndex(t string, n int, end bool) (int, error) {
+	if t == "-" && end {
+		return n, nil
+	}
+	i, err := strconv.Atoi(t)
+	if err != nil || i < 0 || (t != "0" && t[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", t)
+	}
+	if i > n || (i == n && !end) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// getJSON returns the value at path in doc.
+func getJSON(doc any, path []string) (any, error) {
+	for _, t := range path {
+		switch v := doc.(type) {
+		case map[string]any:
+			var ok bool
+			if doc, ok = v[t]; !ok {
+				return nil, fmt.Errorf("%q not found", t)
+			}
+		case []any:
+			i, err := arrayIndex(t, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[i]
+		default:
+			return nil, fmt.Errorf("%q not found", t)
+		}
+	}
+	return doc, nil
+}
+
+// updateJSON replaces the parent of the value at path in doc with the
+// result of calling f with it and the last token of path, returning the
+// updated doc.
+func updateJSON(doc any, path []string, f func(parent any, t string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return f(doc, path[0])
+	}
+	child, err := getJSON(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+	if child, err = updateJSON(child, path[1:], f); err != nil {
+		return nil, err
+	}
+	switch v := doc.(type) {
+	case map[string]any:
+		v[path[0]] = child
+	case []any:
+		i, _ := arrayIndex(path[0], len(v), false)
+		v[i] = child
+	}
+	return doc, nil
+}
+
+// addJSON adds value at path in doc, replacing an object member or
+// inserting an array element.
+func addJSON(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateJSON(doc, path, func(parent any, t string) (any, error) {
+		switch v := parent.(type) {
+		case map[string]any:
+			v[t] = value
+			return v, nil
+		case []any:
+			i, err := arrayIndex(t, len(v), true)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(v, i, value), nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a %T", t, parent)
+		}
+	})
+}
+
+// removeJSON removes the value at path in doc.
+func removeJSON(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole link")
+	}
+	return updateJSON(doc, path, func(parent any, t string) (any, error) {
+		switch v := parent.(type) {
+		case map[string]any:
+			if _, ok := v[t]; !ok {
+				return nil, fmt.Errorf("%q not found", t)
+			}
+			delete(v, t)
+			return v, nil
+		case []any:
+			i, err := arrayIndex(t, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			return slices.Delete(v, i, i+1), nil
+		default:
+			return nil, fmt.Errorf("%q not found", t)
+		}
+	})
+}
+
+// cloneJSON returns a deep copy of the decoded JSON value v.
+func cloneJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for k, e := range v {
+			c[k] = cloneJSON(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, e := range v {
+			c[i] = cloneJSON(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
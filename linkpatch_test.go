@@ -0,0 +1,188 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"tailscale.com/types/ptr"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	const doc = `{"a": 1, "b": {"c": ["x", "y"]}, "d~/e": true}`
+	tests := []struct {
+		patch   string
+		want    string
+		wantErr string
+	}{
+		{patch: `[]`, want: doc},
+		{
+			patch: `[{"op": "add", "path": "/b/c/-", "value": "z"}, {"op": "add", "path": "/b/c/0", "value": "w"}]`,
+			want:  `{"a": 1, "b": {"c": ["w", "x", "y", "z"]}, "d~/e": true}`,
+		},
+		{
+			patch: `[{"op": "remove", "path": "/b/c/0"}, {"op": "replace", "path": "/a", "value": null}]`,
+			want:  `{"a": null, "b": {"c": ["y"]}, "d~/e": true}`,
+		},
+		{
+			patch: `[{"op": "remove", "path": "/d~0~1e"}]`,
+			want:  `{"a": 1, "b": {"c": ["x", "y"]}}`,
+		},
+		{
+			patch: `[{"op": "move", "from": "/b/c", "path": "/c"}, {"op": "copy", "from": "/c/1", "path": "/f"}]`,
+			want:  `{"a": 1, "b": {}, "c": ["x", "y"], "d~/e": true, "f": "y"}`,
+		},
+		{
+			patch: `[{"op": "test", "path": "/b", "value": {"c": ["x", "y"]}}, {"op": "test", "path": "/a", "value": 1.0}]`,
+			want:  doc,
+		},
+		{patch: `[{"op": "test", "path": "/a", "value": 2}]`, wantErr: "test failed"},
+		{patch: `[{"op": "remove", "path": "/missing"}]`, wantErr: "not found"},
+		{patch: `[{"op": "replace", "path": "/missing", "value": 1}]`, wantErr: "not found"},
+		{patch: `[{"op": "add", "path": "/b/c/3", "value": "z"}]`, wantErr: "out of range"},
+		{patch: `[{"op": "add", "path": "/b/c/01", "value": "z"}]`, wantErr: "invalid array index"},
+		{patch: `[{"op": "add", "path": "/a"}]`, wantErr: "value required"},
+		{patch: `[{"op": "move", "from": "/b", "path": "/b/d"}]`, wantErr: "into itself"},
+		{patch: `[{"op": "increment", "path": "/a"}]`, wantErr: "unknown op"},
+		{patch: `[{"op": "add", "path": "a", "value": 1}]`, wantErr: "invalid JSON pointer"},
+		{patch: `{"op": "add"}`, wantErr: "invalid JSON patch"},
+	}
+	for _, tt := range tests {
+		var d any
+		if err := json.Unmarshal([]byte(doc), &d); err != nil {
+			t.Fatal(err)
+		}
+		got, err := applyJSONPatch(d, []byte(tt.patch))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("applyJSONPatch(%s) error = %v; want %q", tt.patch, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("applyJSONPatch(%s): %v", tt.patch, err)
+			continue
+		}
+		var want any
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("applyJSONPatch(%s) mismatch (-want +got):\n%s", tt.patch, diff)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// examples from RFC 7386, Appendix A
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, tt := range tests {
+		var doc, want any
+		if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := applyMergePatch(doc, []byte(tt.patch))
+		if err != nil {
+			t.Errorf("applyMergePatch(%s, %s): %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("applyMergePatch(%s, %s) mismatch (-want +got):\n%s", tt.doc, tt.patch, diff)
+		}
+	}
+}
+
+func TestLinkPatchDocument(t *testing.T) {
+	link := &Link{
+		Short:     "wiki",
+		Long:      "https://wiki.example.com/",
+		Owner:     "amelie@example.com",
+		Tags:      []string{"docs"},
+		Successor: "docs",
+		Expires:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:   7,
+	}
+	tests := []struct {
+		mediaType string
+		patch     string
+		want      *apiLinkRequest
+		wantErr   string
+	}{
+		{
+			mediaType: mergePatchType,
+			patch:     `{}`,
+			want:      &apiLinkRequest{Version: 7},
+		},
+		{
+			mediaType: mergePatchType,
+			patch:     `{"Tags": ["docs", "eng"], "Successor": null, "Headers": {"Cache-Control": "no-store"}}`,
+			want: &apiLinkRequest{
+				Tags:      &[]string{"docs", "eng"},
+				Successor: ptr.To(""),
+				Headers:   &map[string]string{"Cache-Control": "no-store"},
+				Version:   7,
+			},
+		},
+		{
+			mediaType: jsonPatchType,
+			patch:     `[{"op": "test", "path": "/Expires", "value": "2026-01-02T03:04:05Z"}, {"op": "remove", "path": "/Expires"}, {"op": "add", "path": "/Tags/-", "value": "eng"}]`,
+			want:      &apiLinkRequest{Tags: &[]string{"docs", "eng"}, Expires: ptr.To(""), Version: 7},
+		},
+		{
+			mediaType: jsonPatchType,
+			patch:     `[{"op": "replace", "path": "/Long", "value": "https://docs.example.com/"}, {"op": "replace", "path": "/Version", "value": 6}]`,
+			want:      &apiLinkRequest{Long: "https://docs.example.com/", Version: 6},
+		},
+		{mediaType: jsonPatchType, patch: `[{"op": "test", "path": "/Version", "value": 6}]`, wantErr: "test failed"},
+		{mediaType: mergePatchType, patch: `{"Short": "docs"}`, wantErr: "Short cannot be changed"},
+		{mediaType: mergePatchType, patch: `{"Long": null}`, wantErr: "Long cannot be removed"},
+		{mediaType: mergePatchType, patch: `{"Clicks": 5}`, wantErr: "unknown field"},
+		{mediaType: mergePatchType, patch: `["wiki"]`, wantErr: "must be an object"},
+	}
+	for _, tt := range tests {
+		got, err := newLinkPatchDocument(link).patch(tt.mediaType, []byte(tt.patch))
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("patch(%s) error = %v; want %q", tt.patch, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("patch(%s): %v", tt.patch, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("patch(%s) mismatch (-want +got):\n%s", tt.patch, diff)
+		}
+	}
+
+	_, err := newLinkPatchDocument(link).patch(jsonPatchType, []byte(`[{"op": "test", "path": "/Owner", "value": "bob@example.com"}]`))
+	if !errors.Is(err, errPatchTest) {
+		t.Errorf("failed test error = %v; want errPatchTest", err)
+	}
+}
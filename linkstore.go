@@ -0,0 +1,360 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// With --store=redis, links are kept in a RedisDB on --redis-url rather than
+// in PostgreSQL, for teams who already operate Redis and want fast lookups
+// without a relational database. A RedisDB only stores links and their
+// click counts, so golink then only resolves links and serves the links API
+// to get, save, and delete them. Everything else that is kept in the
+// database, such as the web UI, history, teams, and stats by day, is
+// unavailable.
+
+// runLinkStore serves links from the RedisDB on --redis-url, for
+// --store=redis. It only returns on error.
+func runLinkStore() error {
+	if *redisURL == "" {
+		return errors.New("--store=redis requires --redis-url")
+	}
+	if *grpcListen != "" {
+		return errors.New("--grpc-listen is not supported with --store=redis")
+	}
+	store, err := NewRedisDB(*redisURL, "golink:", 0)
+	if err != nil {
+		return fmt.Errorf("--redis-url: %w", err)
+	}
+	defer store.Close()
+	s := newStoreServer(store)
+	go s.flushClicksLoop(time.Minute)
+	return serveListeners(s.handler)
+}
+
+// storeServer serves links from a linkStore without the database.
+type storeServer struct {
+	store linkStore
+
+	mu     sync.Mutex
+	clicks ClickStats // counted since they were last saved, keyed by link ID
+}
+
+func newStoreServer(store linkStore) *storeServer {
+	return &storeServer{store: store, clicks: make(ClickStats)}
+}
+
+// handler returns the handler serving links and the links API.
+func (s *storeServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthCheck)
+	mux.HandleFunc("/.api/v1/links/", s.serveAPILink)
+	mux.HandleFunc("/", s.serveGo)
+	return mux
+}
+
+// serveGo redirects to the destination of the link named by the request
+// path, as serveGo does for links in the database.
+func (s *storeServer) serveGo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	short, remainder, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if short == "" {
+		http.NotFound(w, r)
+		return
+	}
+	link, err := s.store.Load(short)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && linkExpired(link, time.Now()) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("serving %q: %v", short, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	env := expandEnv{Now: time.Now().UTC(), Path: remainder}
+	if r.URL.RawQuery != "" {
+		env.query = r.URL.Query()
+	}
+	if usesUser(link.Long) {
+		cu, _ := currentUser(r)
+		env.user = cu.login
+	}
+	target, err := expandLink(link.Long, env)
+	if err != nil {
+		log.Printf("expanding %q: %v", link.Long, err)
+		if errors.Is(err, errNoUser) {
+			http.Error(w, "link requires a valid user", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.clicks[linkID(link.Short)]++
+	s.mu.Unlock()
+
+	setLinkHeaders(w, link)
+	w.Header().Set("Location", target.String())
+	redirectsServed.Add(1)
+	w.WriteHeader(http.StatusFound)
+}
+
+// flushClicks saves the clicks counted since the last flush. Clicks that
+// fail to save are kept for the next flush.
+func (s *storeServer) flushClicks() error {
+	s.mu.Lock()
+	clicks := s.clicks
+	s.clicks = make(ClickStats)
+	s.mu.Unlock()
+	if len(clicks) == 0 {
+		return nil
+	}
+	if err := s.store.SaveStats(clicks); err != nil {
+		s.mu.Lock()
+		for id, n := range clicks {
+			s.clicks[id] += n
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// flushClicksLoop calls flushClicks every interval. It never returns.
+func (s *storeServer) flushClicksLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.flushClicks(); err != nil {
+			log.Printf("saving clicks: %v", err)
+		}
+	}
+}
+
+// serveAPILink gets, saves, or deletes the link named by the request path,
+// as serveAPILink does for links in the database.
+func (s *storeServer) serveAPILink(w http.ResponseWriter, r *http.Request) {
+	short := strings.TrimPrefix(r.URL.Path, "/.api/v1/links/")
+	serveAPI(w, r, 0, func(w http.ResponseWriter, r *http.Request) {
+		if short == "" || strings.Contains(short, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET", "HEAD":
+			link, err := s.store.Load(short)
+			if errors.Is(err, fs.ErrNotExist) {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(link)
+		case "PUT":
+			var req apiLinkRequest
+			if decodeAPIRequest(w, r, &req) {
+				s.saveLink(w, r, short, &req)
+			}
+		case "DELETE":
+			s.deleteLink(w, r, short)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// unsupportedStoreField returns the name of a field of req that a linkStore
+// can't save, or "" if there is none.
+func unsupportedStoreField(req *apiLinkRequest) string {
+	switch {
+	case req.Fallbacks != nil:
+		return "Fallbacks"
+	case req.MaintenanceTarget != nil:
+		return "MaintenanceTarget"
+	case req.Successor != nil:
+		return "Successor"
+	case req.Params != nil:
+		return "Params"
+	case req.MaxUses != nil:
+		return "MaxUses"
+	case req.HealthCheck != nil:
+		return "HealthCheck"
+	case req.Version != 0:
+		return "Version"
+	}
+	return ""
+}
+
+func isTeamOwner(owner string) bool { return strings.HasPrefix(owner, teamOwnerPrefix) }
+
+// saveLink creates or updates the link short from req. Fields that are
+// omitted are left unchanged when updating a link.
+func (s *storeServer) saveLink(w http.ResponseWriter, r *http.Request, short string, req *apiLinkRequest) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if f := unsupportedStoreField(req); f != "" {
+		http.Error(w, f+" is not supported with --store="+*storeBackend, http.StatusBadRequest)
+		return
+	}
+	// teams are kept in the database
+	if req.CoOwners != nil && slices.ContainsFunc(*req.CoOwners, isTeamOwner) || isTeamOwner(req.Owner) {
+		http.Error(w, "team owners are not supported with --store="+*storeBackend, http.StatusBadRequest)
+		return
+	}
+	if !reShortName.MatchString(short) {
+		http.Error(w, "short may only contain letters, numbers, dash, and period", http.StatusBadRequest)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	link, err := s.store.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		link = nil
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if link == nil {
+		// only names reserved with --reserved-names, since the others
+		// are kept in the database
+		if n := flagReservedNames()[linkID(short)]; n != nil {
+			http.Error(w, reservedNameError(short, n), http.StatusBadRequest)
+			return
+		}
+		if !authz.canCreate(r.Context(), cu, short) {
+			http.Error(w, "cannot create links", http.StatusForbidden)
+			return
+		}
+	}
+	if !authz.canEdit(r.Context(), cu, link) {
+		http.Error(w, fmt.Sprintf("cannot update link owned by %q", link.Owner), http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, short) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	if link == nil {
+		if req.Long == "" {
+			http.Error(w, "Long required", http.StatusBadRequest)
+			return
+		}
+		link = &Link{Short: short, Created: now, Owner: storedOwner(cu.login)}
+	}
+	if req.Long != "" {
+		if err := checkLinkTarget(req.Long); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		link.Long = canonicalTarget(req.Long, nil) // target health is kept in the database
+		link.RawLong = ""
+		if link.Long != req.Long {
+			link.RawLong = req.Long
+		}
+	}
+	if req.Owner != "" {
+		exists, err := userExists(r.Context(), req.Owner)
+		if err != nil {
+			log.Printf("looking up user %q: %v", req.Owner, err)
+		}
+		if !exists {
+			http.Error(w, "new owner not a valid user: "+req.Owner, http.StatusBadRequest)
+			return
+		}
+		link.Owner = storedOwner(req.Owner)
+	}
+	if req.Tags != nil {
+		link.Tags = parseTags(strings.Join(*req.Tags, " "))
+	}
+	if req.CoOwners != nil {
+		link.CoOwners = nil
+		for _, co := range parseCoOwners(strings.Join(*req.CoOwners, " ")) {
+			link.CoOwners = append(link.CoOwners, storedOwner(co))
+		}
+	}
+	if req.Headers != nil {
+		headers, err := parseLinkHeaders(formatLinkHeaders(*req.Headers))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		link.Headers = headers
+	}
+	if req.Expires != nil {
+		expires, err := parseExpires(*req.Expires, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		link.Expires = expires
+	}
+	link.LastEdit = now
+	if err := s.store.Save(link); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(link)
+}
+
+// deleteLink deletes the link short.
+func (s *storeServer) deleteLink(w http.ResponseWriter, r *http.Request, short string) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	link, err := s.store.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canDelete(r.Context(), cu, link) {
+		http.Error(w, fmt.Sprintf("cannot delete link owned by %q", link.Owner), http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, link.Short) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	if err := s.store.Delete(link.Short, storedOwner(cu.login)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStoreServer(t *testing.T) {
+	store, _ := newTestRedisDB(t, 0)
+	s := newStoreServer(store)
+	h := s.handler()
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	defer func(old identityProvider) { identity = old }(identity)
+	identity = scopedIdentity{}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("PUT", "/.api/v1/links/who", `{"Long": "http://who/{{.Path}}", "Tags": ["people"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s; want %d", w.Code, w.Body, http.StatusOK)
+	}
+	var link Link
+	if err := json.NewDecoder(w.Body).Decode(&link); err != nil {
+		t.Fatal(err)
+	}
+	if link.Owner != "foo@example.com" || link.Version != 1 {
+		t.Errorf("created link = %+v; want owner foo@example.com at version 1", link)
+	}
+
+	for _, body := range []string{`{"MaxUses": 1}`, `{"CoOwners": ["team:eng"]}`} {
+		if w := do("PUT", "/.api/v1/links/who", body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s = %d; want %d", body, w.Code, http.StatusBadRequest)
+		}
+	}
+
+	w = do("GET", "/who/amelie", "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("GET /who/amelie = %d; want %d", w.Code, http.StatusFound)
+	}
+	if got, want := w.Header().Get("Location"), "http://who/amelie"; got != want {
+		t.Errorf("Location = %q; want %q", got, want)
+	}
+	if w := do("GET", "/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET /missing = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	if err := s.flushClicks(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Load("who")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TotalClicks != 1 {
+		t.Errorf("TotalClicks = %d after flushing; want 1", got.TotalClicks)
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "bar@example.com"}, nil }
+	if w := do("DELETE", "/.api/v1/links/who", ""); w.Code != http.StatusForbidden {
+		t.Errorf("DELETE by non-owner = %d; want %d", w.Code, http.StatusForbidden)
+	}
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	if w := do("DELETE", "/.api/v1/links/who", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if w := do("GET", "/.api/v1/links/who", ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET deleted link = %d; want %d", w.Code, http.StatusNotFound)
+	}
+}
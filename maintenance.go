@@ -0,0 +1,228 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maintenanceShortName is used as the short name for authorizing changes to
+// maintenance windows.
+const maintenanceShortName = ".maintenance"
+
+// maintenanceRefresh is how long cached maintenance windows are used before
+// being reloaded from db.
+const maintenanceRefresh = 30 * time.Second
+
+// maintenance caches upcoming and active maintenance windows, so that
+// resolving links does not require a database query.
+var maintenance struct {
+	mu      sync.Mutex
+	windows []*MaintenanceWindow
+	loaded  time.Time
+}
+
+// maintenanceWindows returns the cached maintenance windows that have not
+// ended, reloading them from db if the cache is stale.
+func maintenanceWindows(now time.Time) []*MaintenanceWindow {
+	maintenance.mu.Lock()
+	defer maintenance.mu.Unlock()
+
+	if now.Sub(maintenance.loaded) >= maintenanceRefresh {
+		windows, err := db.LoadMaintenanceWindows(now)
+		if err != nil {
+			log.Printf("loading maintenance windows: %v", err)
+		} else {
+			maintenance.windows = windows
+			maintenance.loaded = now
+		}
+	}
+	return maintenance.windows
+}
+
+// invalidateMaintenanceWindows causes the next call to maintenanceWindows to
+// reload from db.
+func invalidateMaintenanceWindows() {
+	maintenance.mu.Lock()
+	defer maintenance.mu.Unlock()
+	maintenance.loaded = time.Time{}
+}
+
+// windowApplies reports whether maintenance window m applies to link.
+func windowApplies(m *MaintenanceWindow, link *Link) bool {
+	if m.Short != "" {
+		return linkID(m.Short) == linkID(link.Short)
+	}
+	return m.Tag != "" && link.HasTag(m.Tag)
+}
+
+// maintenanceTarget returns the target to use for link if one of windows is
+// active at now and applies to it. A window's own target takes precedence over
+// the link's MaintenanceTarget. It returns "" if link is not under maintenance.
+func maintenanceTarget(link *Link, windows []*MaintenanceWindow, now time.Time) string {
+	for _, m := range windows {
+		if !m.Active(now) || !windowApplies(m, link) {
+			continue
+		}
+		if m.Target != "" {
+			return m.Target
+		}
+		if link.MaintenanceTarget != "" {
+			return link.MaintenanceTarget
+		}
+	}
+	return ""
+}
+
+// serveMaintenance lists maintenance windows that have not ended on GET
+// requests, and schedules or cancels windows on POST requests.
+//
+// Windows for a single link may be scheduled by anyone who can edit the link.
+// Windows for all links with a tag may only be scheduled by admins.
+func serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		windows, err := db.LoadMaintenanceWindows(time.Now().UTC())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(windows)
+		return
+	}
+
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !isRequestAuthorized(r, cu, maintenanceShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	if v := r.FormValue("cancel"); v != "" {
+		cancelMaintenance(w, r, cu, v)
+		return
+	}
+
+	m := &MaintenanceWindow{
+		Short:     r.FormValue("short"),
+		Tag:       strings.ToLower(strings.TrimSpace(r.FormValue("tag"))),
+		Target:    r.FormValue("target"),
+		Reason:    r.FormValue("reason"),
+		CreatedBy: cu.login,
+	}
+	if (m.Short == "") == (m.Tag == "") {
+		http.Error(w, "exactly one of short or tag required", http.StatusBadRequest)
+		return
+	}
+	if m.Start, err = time.Parse(time.RFC3339, r.FormValue("start")); err != nil {
+		http.Error(w, "start must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	if m.End, err = time.Parse(time.RFC3339, r.FormValue("end")); err != nil {
+		http.Error(w, "end must be an RFC 3339 time", http.StatusBadRequest)
+		return
+	}
+	m.Start, m.End = m.Start.UTC(), m.End.UTC()
+	if !m.End.After(m.Start) {
+		http.Error(w, "end must be after start", http.StatusBadRequest)
+		return
+	}
+
+	if m.Tag != "" {
+		if !authz.canAdmin(cu) {
+			http.Error(w, "only admins can schedule maintenance for a tag", http.StatusForbidden)
+			return
+		}
+	} else {
+		link, err := db.Load(m.Short)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !authz.canEdit(r.Context(), cu, link) {
+			http.Error(w, fmt.Sprintf("cannot schedule maintenance for link owned by %q", link.Owner), http.StatusForbidden)
+			return
+		}
+		if m.Target == "" && link.MaintenanceTarget == "" {
+			http.Error(w, "target required for links without a maintenance target", http.StatusBadRequest)
+			return
+		}
+		m.Short = link.Short
+	}
+
+	if err := db.SaveMaintenanceWindow(m); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invalidateShared("maintenance")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// cancelMaintenance deletes the maintenance window with the specified ID.
+// Windows may be cancelled by admins, by the user who scheduled them, or by
+// anyone who can edit the link they apply to.
+func cancelMaintenance(w http.ResponseWriter, r *http.Request, cu user, v string) {
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		http.Error(w, "invalid maintenance window ID", http.StatusBadRequest)
+		return
+	}
+	windows, err := db.LoadMaintenanceWindows(time.Time{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var m *MaintenanceWindow
+	for _, mw := range windows {
+		if mw.ID == id {
+			m = mw
+			break
+		}
+	}
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	allowed := authz.canAdmin(cu) || (cu.login != "" && m.CreatedBy == cu.login)
+	if !allowed && m.Short != "" {
+		if link, err := db.Load(m.Short); err == nil {
+			allowed = authz.canEdit(r.Context(), cu, link)
+		}
+	}
+	if !allowed {
+		http.Error(w, "cannot cancel maintenance window", http.StatusForbidden)
+		return
+	}
+
+	if err := db.DeleteMaintenanceWindow(id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invalidateShared("maintenance")
+	w.WriteHeader(http.StatusNoContent)
+}
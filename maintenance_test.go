@@ -0,0 +1,74 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceTarget(t *testing.T) {
+	now := time.Date(2022, 06, 02, 1, 2, 3, 4, time.UTC)
+	active := func(m MaintenanceWindow) *MaintenanceWindow {
+		m.Start, m.End = now.Add(-time.Hour), now.Add(time.Hour)
+		return &m
+	}
+	upcoming := func(m MaintenanceWindow) *MaintenanceWindow {
+		m.Start, m.End = now.Add(time.Hour), now.Add(2*time.Hour)
+		return &m
+	}
+
+	dashboard := &Link{Short: "dashboard", Long: "http://grafana/", MaintenanceTarget: "http://status/", Tags: []string{"grafana"}}
+	wiki := &Link{Short: "wiki", Long: "http://wiki/"}
+
+	tests := []struct {
+		name    string
+		link    *Link
+		windows []*MaintenanceWindow
+		want    string
+	}{
+		{
+			name: "no windows",
+			link: dashboard,
+			want: "",
+		},
+		{
+			name:    "active link window",
+			link:    dashboard,
+			windows: []*MaintenanceWindow{active(MaintenanceWindow{Short: "Dash-board"})},
+			want:    "http://status/",
+		},
+		{
+			name:    "upcoming link window",
+			link:    dashboard,
+			windows: []*MaintenanceWindow{upcoming(MaintenanceWindow{Short: "dashboard"})},
+			want:    "",
+		},
+		{
+			name:    "window for another link",
+			link:    dashboard,
+			windows: []*MaintenanceWindow{active(MaintenanceWindow{Short: "wiki", Target: "http://elsewhere/"})},
+			want:    "",
+		},
+		{
+			name:    "active tag window with target",
+			link:    dashboard,
+			windows: []*MaintenanceWindow{active(MaintenanceWindow{Tag: "grafana", Target: "http://upgrade/"})},
+			want:    "http://upgrade/",
+		},
+		{
+			name:    "window without any target",
+			link:    wiki,
+			windows: []*MaintenanceWindow{active(MaintenanceWindow{Short: "wiki"})},
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := maintenanceTarget(tt.link, tt.windows, now); got != tt.want {
+				t.Errorf("maintenanceTarget() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"tailscale.com/metrics"
+)
+
+// Metrics exported in Prometheus format at /.metrics.
+var (
+	redirectsServed = new(expvar.Int)
+
+	// statsDroppedClicks counts clicks that were never saved because the
+	// queue of unsaved stats was full.
+	statsDroppedClicks = new(expvar.Int)
+
+	// linkChanges counts link changes by action: create, edit, or delete.
+	linkChanges = &metrics.LabelMap{Label: "action"}
+
+	// templateCacheLookups counts link template cache lookups by result:
+	// hit or miss.
+	templateCacheLookups = &metrics.LabelMap{Label: "result"}
+
+	// linkCacheLookups counts link cache lookups by result: hit or miss.
+	linkCacheLookups = &metrics.LabelMap{Label: "result"}
+
+	dbQuerySeconds = &latencyHistograms{buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5}}
+
+	// probes counts canary link probes by the listener probed, and
+	// probeFailures counts those that failed. probeSeconds is labeled with
+	// the listener as its method.
+	probes        = &metrics.LabelMap{Label: "target"}
+	probeFailures = &metrics.LabelMap{Label: "target"}
+	probeSeconds  = &latencyHistograms{buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}}
+)
+
+func init() {
+	expvar.Publish("counter_golink_redirects", redirectsServed)
+	expvar.Publish("counter_golink_stats_dropped_clicks", statsDroppedClicks)
+	expvar.Publish("gauge_golink_stats_queued_links", expvar.Func(func() any {
+		stats.mu.Lock()
+		defer stats.mu.Unlock()
+		return len(stats.dirty)
+	}))
+	expvar.Publish("counter_golink_link_changes", linkChanges)
+	expvar.Publish("counter_golink_template_cache_lookups", templateCacheLookups)
+	expvar.Publish("counter_golink_link_cache_lookups", linkCacheLookups)
+	expvar.Publish("gauge_golink_link_cache_links", expvar.Func(func() any {
+		if db == nil || db.cache == nil {
+			return 0
+		}
+		return db.cache.len()
+	}))
+	expvar.Publish("golink_db_query_seconds", dbQuerySeconds)
+	expvar.Publish("golink_slo", resolveSLO)
+	expvar.Publish("counter_golink_probes", probes)
+	expvar.Publish("counter_golink_probe_failures", probeFailures)
+	expvar.Publish("golink_probe_seconds", probeSeconds)
+}
+
+// latencyHistograms is a set of latency histograms labeled by method.
+type latencyHistograms struct {
+	buckets []float64 // upper bounds in seconds, ascending
+
+	mu      sync.Mutex
+	methods map[string]*latencyHistogram
+}
+
+type latencyHistogram struct {
+	counts []int64 // cumulative, by bucket
+	count  int64
+	sum    float64
+}
+
+// observe records a call to method that started at start.
+func (h *latencyHistograms) observe(method string, start time.Time) {
+	v := time.Since(start).Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.methods == nil {
+		h.methods = make(map[string]*latencyHistogram)
+	}
+	m, ok := h.methods[method]
+	if !ok {
+		m = &latencyHistogram{counts: make([]int64, len(h.buckets))}
+		h.methods[method] = m
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			m.counts[i]++
+		}
+	}
+	m.count++
+	m.sum += v
+}
+
+// WritePrometheus writes h to w in Prometheus exposition format, as
+// expected by tailscale.com/tsweb/varz.
+func (h *latencyHistograms) WritePrometheus(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	methods := make([]string, 0, len(h.methods))
+	for method := range h.methods {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	for _, method := range methods {
+		m := h.methods[method]
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{method=%q,le=\"%v\"} %d\n", name, method, b, m.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{method=%q,le=\"+Inf\"} %d\n", name, method, m.count)
+		fmt.Fprintf(w, "%s_sum{method=%q} %v\n", name, method, m.sum)
+		fmt.Fprintf(w, "%s_count{method=%q} %d\n", name, method, m.count)
+	}
+}
+
+// String implements expvar.Var.
+func (h *latencyHistograms) String() string {
+	return `"latencyHistograms"`
+}
@@ -0,0 +1,42 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLatencyHistograms(t *testing.T) {
+	h := &latencyHistograms{buckets: []float64{1, 3600}}
+	h.observe("Save", time.Now())
+	h.observe("Load", time.Now())
+	h.observe("Load", time.Now().Add(-time.Minute))
+
+	var b strings.Builder
+	h.WritePrometheus(&b, "db_seconds")
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if !strings.Contains(line, "_sum{") {
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		"# TYPE db_seconds histogram",
+		`db_seconds_bucket{method="Load",le="1"} 1`,
+		`db_seconds_bucket{method="Load",le="3600"} 2`,
+		`db_seconds_bucket{method="Load",le="+Inf"} 2`,
+		`db_seconds_count{method="Load"} 2`,
+		`db_seconds_bucket{method="Save",le="1"} 1`,
+		`db_seconds_bucket{method="Save",le="3600"} 1`,
+		`db_seconds_bucket{method="Save",le="+Inf"} 1`,
+		`db_seconds_count{method="Save"} 1`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("WritePrometheus mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// Schema migrations are SQL files in the migrations directory named
+// NNNN_description.sql, numbered from 1 with no gaps. Each is applied once,
+// in order, in its own transaction, and recorded in the schema_version
+// table. Migrations must not be edited once released; add a new one.
+//
+// 0001_initial.sql is the schema as it was before migrations were tracked.
+// It is idempotent, so that it can be applied to databases created by
+// earlier versions of golink.
+//
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// migration is a numbered schema change.
+type migration struct {
+	version int
+	name    string // file name, such as 0001_initial.sql
+	sql     string
+}
+
+var reMigrationName = regexp.MustCompile(`^(\d{4})_\w+\.sql$`)
+
+// loadMigrations returns the migrations in fsys, ordered by version.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	names, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	var ms []migration
+	for _, name := range names {
+		base := path.Base(name)
+		m := reMigrationName.FindStringSubmatch(base)
+		if m == nil {
+			return nil, fmt.Errorf("migration %q: want name NNNN_description.sql", base)
+		}
+		version, _ := strconv.Atoi(m[1])
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, migration{version: version, name: base, sql: string(b)})
+	}
+	slices.SortFunc(ms, func(a, b migration) int { return a.version - b.version })
+	for i, m := range ms {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("migration %q: want version %04d", m.name, i+1)
+		}
+	}
+	return ms, nil
+}
+
+// migrationLockID is the PostgreSQL advisory lock held while migrating, so
+// that replicas starting together apply each migration once.
+const migrationLockID = 0x676f6c696e6b // "golink"
+
+const createSchemaVersion = `CREATE TABLE IF NOT EXISTS schema_version (
+	Version  INTEGER PRIMARY KEY,
+	Name     TEXT    NOT NULL DEFAULT '',
+	Applied  INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())) -- unix seconds
+)`
+
+// schemaVersion returns the version of the last migration applied to the
+// database, or 0 if none have been.
+func schemaVersion(ctx context.Context, q interface {
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+}) (int, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_version') IS NOT NULL").Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, nil
+	}
+	var version int
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(MAX(Version), 0) FROM schema_version").Scan(&version)
+	return version, err
+}
+
+// migrate applies the migrations in ms that have not yet been applied to db.
+// It returns the number of migrations applied.
+func migrate(ctx context.Context, db *sql.DB, ms []migration) (int, error) {
+	if _, err := db.ExecContext(ctx, createSchemaVersion); err != nil {
+		return 0, fmt.Errorf("creating schema_version: %w", err)
+	}
+	applied := 0
+	for {
+		done, err := migrateNext(ctx, db, ms)
+		if err != nil {
+			return applied, err
+		}
+		if done {
+			return applied, nil
+		}
+		applied++
+	}
+}
+
+// migrateNext applies the first pending migration in ms, reporting whether
+// there were none left.
+func migrateNext(ctx context.Context, db *sql.DB, ms []migration) (done bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return false, fmt.Errorf("locking schema: %w", err)
+	}
+	version, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return false, err
+	}
+	if version > len(ms) {
+		return false, fmt.Errorf("database schema version %d is newer than this version of golink (%d)", version, len(ms))
+	}
+	if version == len(ms) {
+		return true, nil
+	}
+
+	m := ms[version]
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return false, fmt.Errorf("migration %s: %w", m.name, err)
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_version (Version, Name) VALUES ($1, $2)", m.version, m.name); err != nil {
+		return false, fmt.Errorf("migration %s: %w", m.name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("migration %s: %w", m.name, err)
+	}
+	log.Printf("applied schema migration %s", m.name)
+	return false, nil
+}
+
+// pendingMigrations returns the migrations in ms not yet applied to db.
+func pendingMigrations(ctx context.Context, db *sql.DB, ms []migration) ([]migration, error) {
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if version > len(ms) {
+		return nil, errors.New("database schema is newer than this version of golink")
+	}
+	return ms[version:], nil
+}
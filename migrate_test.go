@@ -0,0 +1,67 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+	tests := []struct {
+		name      string
+		fsys      fstest.MapFS
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "ordered by version",
+			fsys:      fstest.MapFS{"migrations/0002_tags.sql": file("B"), "migrations/0001_initial.sql": file("A")},
+			wantNames: []string{"0001_initial.sql", "0002_tags.sql"},
+		},
+		{
+			name:    "gap",
+			fsys:    fstest.MapFS{"migrations/0001_initial.sql": file("A"), "migrations/0003_tags.sql": file("C")},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate version",
+			fsys:    fstest.MapFS{"migrations/0001_initial.sql": file("A"), "migrations/0001_tags.sql": file("B")},
+			wantErr: true,
+		},
+		{
+			name:    "bad name",
+			fsys:    fstest.MapFS{"migrations/initial.sql": file("A")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := loadMigrations(tt.fsys)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadMigrations() error = %v; want error %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, m := range ms {
+				names = append(names, m.name)
+			}
+			if diff := cmp.Diff(tt.wantNames, names); diff != "" {
+				t.Errorf("loadMigrations() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	ms, err := loadMigrations(migrationFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) == 0 || ms[0].name != "0001_initial.sql" {
+		t.Errorf("embedded migrations start with %v; want 0001_initial.sql", ms)
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sqliteSource reads the links and click stats of a deployment of upstream
+// golink from its SQLite database. It runs the sqlite3 command line shell
+// rather than linking a SQLite driver into golink, and opens the database
+// read-only, so that it can be read while the old deployment still serves
+// links.
+type sqliteSource struct {
+	path string
+}
+
+// sourceLink is a link as stored by upstream golink.
+type sourceLink struct {
+	Short    string
+	Long     string
+	Created  int64 // unix seconds
+	LastEdit int64 // unix seconds
+	Owner    string
+}
+
+// query runs the SQL query q against the database, decoding the rows it
+// returns into v, a pointer to a slice of structs whose fields are named
+// like the columns.
+func (s sqliteSource) query(ctx context.Context, q string, v any) error {
+	cmd := exec.CommandContext(ctx, "sqlite3", "-readonly", "-json", s.path, q)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("sqlite3 %s: %w: %s", s.path, err, msg)
+		}
+		return fmt.Errorf("sqlite3 %s: %w", s.path, err)
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil // no rows
+	}
+	return json.Unmarshal(out, v)
+}
+
+// links returns the source links, keyed by short name.
+func (s sqliteSource) links(ctx context.Context) (map[string]*sourceLink, error) {
+	var rows []*sourceLink
+	if err := s.query(ctx, "SELECT Short, Long, Created, LastEdit, Owner FROM Links", &rows); err != nil {
+		return nil, err
+	}
+	links := make(map[string]*sourceLink, len(rows))
+	for _, l := range rows {
+		if l.Short != "" {
+			links[l.Short] = l
+		}
+	}
+	return links, nil
+}
+
+// clicks returns the total clicks of each source link, keyed by short name.
+func (s sqliteSource) clicks(ctx context.Context) (ClickStats, error) {
+	var rows []struct {
+		Short  string
+		Clicks int
+	}
+	q := "SELECT Links.Short AS Short, SUM(Stats.Clicks) AS Clicks FROM Stats JOIN Links ON Links.ID = Stats.ID GROUP BY Links.Short"
+	if err := s.query(ctx, q, &rows); err != nil {
+		return nil, err
+	}
+	clicks := make(ClickStats, len(rows))
+	for _, r := range rows {
+		clicks[r.Short] = r.Clicks
+	}
+	return clicks, nil
+}
+
+// sourceMigration copies the links of a sqliteSource into db, remembering
+// which links it has copied so that later passes can delete the links
+// since deleted from the source.
+type sourceMigration struct {
+	src    sqliteSource
+	copied map[string]string // short names copied by earlier passes, keyed by link ID
+}
+
+// migrationReport summarizes a pass of a sourceMigration.
+type migrationReport struct {
+	Created, Updated, Deleted, Unchanged int
+	Clicks                               int // clicks added to copied links
+	Failed                               []string
+}
+
+// storedSourceOwner returns the owner of a link copied from l, as stored.
+func storedSourceOwner(l *sourceLink) string {
+	return storedOwner(importOwners.remap(l.Owner))
+}
+
+// pass copies the source links into db: missing links are created, links
+// whose destination or owner differ are updated, and links copied by an
+// earlier pass that are no longer in the source are deleted. Clicks the
+// source has counted beyond those stored for a link are added to it.
+// Links that would exceed a quota fail. Nothing is changed if dryRun is set.
+func (m *sourceMigration) pass(ctx context.Context, dryRun bool) (*migrationReport, error) {
+	links, err := m.src.links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	srcClicks, err := m.src.clicks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(migrationReport)
+	fail := func(short string, err error) {
+		report.Failed = append(report.Failed, short+": "+err.Error())
+	}
+	listed := make(map[string]bool, len(links))
+	var shorts []string
+	for _, short := range slices.Sorted(maps.Keys(links)) {
+		l := links[short]
+		id := linkID(short)
+		if listed[id] {
+			fail(short, errors.New("another source link has the same link ID"))
+			continue
+		}
+		listed[id] = true
+		shorts = append(shorts, short)
+
+		current, err := db.Load(short)
+		if errors.Is(err, fs.ErrNotExist) {
+			if dryRun {
+				if err := checkQuotas(db, nil, short, storedSourceOwner(l), "", time.Now()); err != nil {
+					fail(short, err)
+					continue
+				}
+				report.Created++
+				continue
+			}
+			link := &Link{
+				Short:    short,
+				Long:     l.Long,
+				Created:  time.Unix(l.Created, 0).UTC(),
+				LastEdit: time.Unix(l.LastEdit, 0).UTC(),
+			}
+			if link.Owner, err = recordOwner(importOwners.remap(l.Owner)); err == nil {
+				err = db.save(link, saveCreate, true)
+			}
+			if err != nil {
+				fail(short, err)
+				continue
+			}
+			report.Created++
+			continue
+		}
+		if err != nil {
+			fail(short, err)
+			continue
+		}
+		if current.Long == l.Long && current.Owner == storedSourceOwner(l) {
+			report.Unchanged++
+			continue
+		}
+		if dryRun {
+			if err := checkQuotas(db, current, short, storedSourceOwner(l), "", time.Now()); err != nil {
+				fail(short, err)
+				continue
+			}
+			report.Updated++
+			continue
+		}
+		link := current.clone()
+		link.Long, link.RawLong = l.Long, ""
+		link.LastEdit = time.Unix(l.LastEdit, 0).UTC()
+		if link.Owner, err = recordOwner(importOwners.remap(l.Owner)); err == nil {
+			err = db.save(link, saveUpdate, true)
+		}
+		if err != nil {
+			fail(short, err)
+			continue
+		}
+		report.Updated++
+	}
+
+	for id, short := range m.copied {
+		if listed[id] {
+			continue
+		}
+		if dryRun {
+			report.Deleted++
+			continue
+		}
+		if err := db.Delete(short, ""); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fail(short, err)
+			continue
+		}
+		report.Deleted++
+		delete(m.copied, id)
+	}
+
+	stored, err := db.LoadStatsFor(shorts)
+	if err != nil {
+		return nil, err
+	}
+	add := make(ClickStats)
+	for _, short := range shorts {
+		if n := srcClicks[short] - stored[linkID(short)]; n > 0 {
+			add[short] = n
+			report.Clicks += n
+		}
+	}
+	if dryRun {
+		return report, nil
+	}
+	if err := db.SaveStats(add); err != nil {
+		return nil, fmt.Errorf("saving clicks: %w", err)
+	}
+	for _, short := range shorts {
+		m.copied[linkID(short)] = short
+	}
+	return report, nil
+}
+
+// migrationVerification compares the source links with their copies.
+type migrationVerification struct {
+	SourceLinks int
+	CopiedLinks int      // source links found in db
+	Problems    []string // missing and differing links
+	SourceHash  string   // hash of the source links and their clicks
+	CopyHash    string   // hash of their copies, which matches SourceHash if they are the same
+}
+
+// migrationRecord returns the line hashed for a link by verify.
+func migrationRecord(short, long, owner string, created int64, clicks int) string {
+	return strings.Join([]string{linkID(short), short, long, owner, strconv.FormatInt(created, 10), strconv.Itoa(clicks)}, "\x00")
+}
+
+// verify compares each source link, and its clicks, with its copy in db,
+// and hashes both sets of links so that a matching hash confirms that every
+// link was copied.
+func (m *sourceMigration) verify(ctx context.Context) (*migrationVerification, error) {
+	links, err := m.src.links(ctx)
+	if err != nil {
+		return nil, err
+	}
+	srcClicks, err := m.src.clicks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shorts := slices.Sorted(maps.Keys(links))
+	stored, err := db.LoadStatsFor(shorts)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &migrationVerification{SourceLinks: len(links)}
+	srcHash, copyHash := sha256.New(), sha256.New()
+	for _, short := range shorts {
+		l := links[short]
+		owner := storedSourceOwner(l)
+		io.WriteString(srcHash, migrationRecord(short, l.Long, owner, l.Created, srcClicks[short])+"\n")
+
+		link, err := db.Load(short)
+		if errors.Is(err, fs.ErrNotExist) {
+			v.Problems = append(v.Problems, short+": missing")
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		v.CopiedLinks++
+		clicks := stored[linkID(short)]
+		io.WriteString(copyHash, migrationRecord(link.Short, link.Long, link.Owner, link.Created.Unix(), clicks)+"\n")
+
+		var diffs []string
+		if link.Short != short {
+			diffs = append(diffs, "short name "+link.Short)
+		}
+		if link.Long != l.Long {
+			diffs = append(diffs, "destination")
+		}
+		if link.Owner != owner {
+			diffs = append(diffs, "owner")
+		}
+		if link.Created.Unix() != l.Created {
+			diffs = append(diffs, "created time")
+		}
+		if clicks != srcClicks[short] {
+			diffs = append(diffs, fmt.Sprintf("clicks %d, source %d", clicks, srcClicks[short]))
+		}
+		if len(diffs) > 0 {
+			v.Problems = append(v.Problems, short+": differs in "+strings.Join(diffs, ", "))
+		}
+	}
+	v.SourceHash = hex.EncodeToString(srcHash.Sum(nil))
+	v.CopyHash = hex.EncodeToString(copyHash.Sum(nil))
+	return v, nil
+}
+
+// printMigrationReport prints a summary of a migration pass to w.
+func printMigrationReport(w io.Writer, report *migrationReport, dryRun bool) {
+	for _, f := range report.Failed {
+		fmt.Fprintf(w, "FAIL  %s\n", f)
+	}
+	verb := "copied"
+	if dryRun {
+		verb = "would copy"
+	}
+	fmt.Fprintf(w, "%s links: %d created, %d updated, %d deleted, %d unchanged, %d failed; %d clicks added\n",
+		verb, report.Created, report.Updated, report.Deleted, report.Unchanged, len(report.Failed), report.Clicks)
+}
+
+// printMigrationVerification prints the result of verifying a migration to
+// w, returning an error if the copy doesn't match the source.
+func printMigrationVerification(w io.Writer, v *migrationVerification) error {
+	for _, p := range v.Problems {
+		fmt.Fprintf(w, "FAIL  %s\n", p)
+	}
+	fmt.Fprintf(w, "source: %d links, hash %s\n", v.SourceLinks, v.SourceHash)
+	fmt.Fprintf(w, "copy:   %d links, hash %s\n", v.CopiedLinks, v.CopyHash)
+	if len(v.Problems) > 0 || v.SourceHash != v.CopyHash {
+		return fmt.Errorf("copy differs from source in %d links", len(v.Problems))
+	}
+	fmt.Fprintln(w, "copy matches source")
+	return nil
+}
+
+// runMigrateFromCommand implements "golink migrate-from", which copies the
+// links and click stats of an upstream golink SQLite database into the
+// PostgreSQL database:
+//
+//	golink migrate-from FILE                  copy once
+//	golink migrate-from FILE check            print what would be copied
+//	golink migrate-from FILE verify           compare the copy with the source
+//	golink migrate-from FILE follow INTERVAL  copy every INTERVAL until interrupted, then verify
+//
+// Following keeps the copy up to date while the old deployment still serves
+// links, so that clients can be cut over to golink gradually.
+func runMigrateFromCommand(args []string, w io.Writer) error {
+	usage := errors.New("usage: golink migrate-from FILE [check | verify | follow INTERVAL]")
+	if len(args) < 1 {
+		return usage
+	}
+	if _, err := os.Stat(args[0]); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return fmt.Errorf("migrate-from requires the sqlite3 command: %w", err)
+	}
+	m := &sourceMigration{src: sqliteSource{path: args[0]}, copied: make(map[string]string)}
+	ctx := context.Background()
+
+	switch {
+	case len(args) == 1 || (len(args) == 2 && args[1] == "check"):
+		if *readonly && len(args) == 1 {
+			return errors.New("golink is in read-only mode")
+		}
+		dryRun := len(args) == 2
+		report, err := m.pass(ctx, dryRun)
+		if err != nil {
+			return err
+		}
+		printMigrationReport(w, report, dryRun)
+		if len(report.Failed) > 0 {
+			return fmt.Errorf("%d links failed to copy", len(report.Failed))
+		}
+		return nil
+	case len(args) == 2 && args[1] == "verify":
+		v, err := m.verify(ctx)
+		if err != nil {
+			return err
+		}
+		return printMigrationVerification(w, v)
+	case len(args) == 3 && args[1] == "follow":
+		if *readonly {
+			return errors.New("golink is in read-only mode")
+		}
+		interval, err := time.ParseDuration(args[2])
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("invalid follow interval %q", args[2])
+		}
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		for {
+			report, err := m.pass(ctx, false)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(w, "%s: %v\n", time.Now().Format(time.RFC3339), err)
+			} else if err == nil {
+				fmt.Fprintf(w, "%s: ", time.Now().Format(time.RFC3339))
+				printMigrationReport(w, report, false)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+				continue
+			}
+			break
+		}
+		// verify with a fresh context, since following was interrupted
+		v, err := m.verify(context.Background())
+		if err != nil {
+			return err
+		}
+		return printMigrationVerification(w, v)
+	}
+	return usage
+}
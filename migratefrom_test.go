@@ -0,0 +1,99 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeSQLite3 installs a sqlite3 command in PATH that prints links for
+// queries of the Links table, stats for queries of the Stats table, and
+// fails for the database file "missing.db".
+func fakeSQLite3(t *testing.T, links, stats string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake sqlite3 is a shell script")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$3" in
+*missing.db) echo "Error: unable to open database" >&2; exit 1 ;;
+esac
+case "$4" in
+*"FROM Stats"*) printf '%s' '` + stats + `' ;;
+*"FROM Links"*) printf '%s' '` + links + `' ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "sqlite3"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestSQLiteSource(t *testing.T) {
+	fakeSQLite3(t,
+		`[{"Short":"docs","Long":"https://docs.example.com/","Created":1700000000,"LastEdit":1700000100,"Owner":"amelie@example.com"},
+{"Short":"","Long":"https://ignored.example.com/","Created":0,"LastEdit":0,"Owner":""}]`,
+		`[{"Short":"docs","Clicks":42}]`)
+	ctx := context.Background()
+	src := sqliteSource{path: "links.db"}
+
+	links, err := src.links(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantLinks := map[string]*sourceLink{
+		"docs": {Short: "docs", Long: "https://docs.example.com/", Created: 1700000000, LastEdit: 1700000100, Owner: "amelie@example.com"},
+	}
+	if diff := cmp.Diff(wantLinks, links); diff != "" {
+		t.Errorf("links mismatch (-want +got):\n%s", diff)
+	}
+
+	clicks, err := src.clicks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ClickStats{"docs": 42}, clicks); diff != "" {
+		t.Errorf("clicks mismatch (-want +got):\n%s", diff)
+	}
+
+	_, err = sqliteSource{path: "missing.db"}.links(ctx)
+	if err == nil || !strings.Contains(err.Error(), "unable to open database") {
+		t.Errorf("links of missing database: error = %v; want sqlite3's error", err)
+	}
+}
+
+func TestSQLiteSourceEmpty(t *testing.T) {
+	// sqlite3 -json prints nothing for queries that return no rows
+	fakeSQLite3(t, "", "")
+	links, err := sqliteSource{path: "links.db"}.links(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 0 {
+		t.Errorf("links = %v; want none", links)
+	}
+}
+
+func TestMigrationRecord(t *testing.T) {
+	a := migrationRecord("docs", "https://docs.example.com/", "amelie@example.com", 1700000000, 42)
+	for _, b := range []string{
+		migrationRecord("Docs", "https://docs.example.com/", "amelie@example.com", 1700000000, 42),
+		migrationRecord("docs", "https://docs.example.com", "amelie@example.com", 1700000000, 42),
+		migrationRecord("docs", "https://docs.example.com/", "bob@example.com", 1700000000, 42),
+		migrationRecord("docs", "https://docs.example.com/", "amelie@example.com", 1700000001, 42),
+		migrationRecord("docs", "https://docs.example.com/", "amelie@example.com", 1700000000, 41),
+	} {
+		if a == b {
+			t.Errorf("migrationRecord(%q) equals the record of a different link", b)
+		}
+	}
+}
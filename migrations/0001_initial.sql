@@ -0,0 +1,141 @@
+CREATE TABLE IF NOT EXISTS Links (
+	ID       TEXT    PRIMARY KEY,         -- normalized version of Short (foobar)
+	Short    TEXT    NOT NULL DEFAULT '',
+	Long     TEXT    NOT NULL DEFAULT '',
+	Created  INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())), -- unix seconds
+	LastEdit INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())), -- unix seconds
+	Owner	 TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS Stats (
+	ID       TEXT    NOT NULL DEFAULT '',
+	Created  INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())), -- unix seconds
+	Clicks   INTEGER
+);
+
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS AutoCreated BOOLEAN NOT NULL DEFAULT FALSE; -- created by an importer or bot
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Successor TEXT NOT NULL DEFAULT '';     -- short name replacing a deprecated link
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Deprecated INTEGER NOT NULL DEFAULT 0;  -- unix seconds, 0 if not deprecated
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Fallbacks TEXT NOT NULL DEFAULT '';     -- newline-separated fallback targets, in order
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS MaintenanceTarget TEXT NOT NULL DEFAULT ''; -- target used during maintenance windows
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Headers TEXT NOT NULL DEFAULT '';       -- newline-separated "Name: value" response headers set on redirects
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Params TEXT NOT NULL DEFAULT '';        -- query parameter template appended to targets
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS MaxUses INTEGER NOT NULL DEFAULT 0;     -- resolutions before the link is deleted, 0 if unlimited
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Uses INTEGER NOT NULL DEFAULT 0;        -- resolutions counted against MaxUses
+
+-- TotalClicks is the sum of Stats.Clicks for the link, maintained when stats
+-- are saved. It is backfilled from Stats when the column is first added.
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'links' AND column_name = 'totalclicks') THEN
+		ALTER TABLE Links ADD COLUMN TotalClicks INTEGER NOT NULL DEFAULT 0;
+		UPDATE Links SET TotalClicks = COALESCE((SELECT SUM(Clicks) FROM Stats WHERE Stats.ID = Links.ID), 0);
+	END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS LinksByTotalClicks ON Links (TotalClicks DESC);
+
+CREATE TABLE IF NOT EXISTS LinkTags (
+	ID       TEXT    NOT NULL,            -- normalized link ID
+	Tag      TEXT    NOT NULL,
+	PRIMARY KEY (ID, Tag)
+);
+
+CREATE TABLE IF NOT EXISTS GCNotices (
+	ID       TEXT    PRIMARY KEY,         -- normalized link ID
+	Notified INTEGER NOT NULL             -- unix seconds when the owner was notified
+);
+
+CREATE TABLE IF NOT EXISTS Aliases (
+	ID       TEXT    PRIMARY KEY,         -- normalized version of Short
+	Short    TEXT    NOT NULL DEFAULT '', -- short name of the merged link
+	Target   TEXT    NOT NULL             -- normalized ID of the link it was merged into
+);
+
+CREATE TABLE IF NOT EXISTS Teams (
+	ID        TEXT    PRIMARY KEY,         -- normalized version of Name
+	Name      TEXT    NOT NULL DEFAULT '',
+	Namespace TEXT    NOT NULL DEFAULT '', -- default namespace for the team's links
+	Created   INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())) -- unix seconds
+);
+
+CREATE TABLE IF NOT EXISTS TeamMembers (
+	Team     TEXT    NOT NULL,            -- normalized team ID
+	Login    TEXT    NOT NULL,            -- user@domain
+	PRIMARY KEY (Team, Login)
+);
+
+CREATE TABLE IF NOT EXISTS Collections (
+	ID          TEXT    PRIMARY KEY,         -- normalized version of Name
+	Name        TEXT    NOT NULL DEFAULT '',
+	Title       TEXT    NOT NULL DEFAULT '',
+	Description TEXT    NOT NULL DEFAULT '',
+	Position    INTEGER NOT NULL DEFAULT 0   -- display order, ascending
+);
+
+CREATE TABLE IF NOT EXISTS CollectionLinks (
+	Collection  TEXT    NOT NULL,            -- normalized collection ID
+	Short       TEXT    NOT NULL,
+	Description TEXT    NOT NULL DEFAULT '',
+	Position    INTEGER NOT NULL DEFAULT 0,  -- display order within the collection, ascending
+	PRIMARY KEY (Collection, Short)
+);
+
+CREATE TABLE IF NOT EXISTS TargetHealth (
+	Target   TEXT    PRIMARY KEY,         -- link target, as stored in Long or Fallbacks
+	Healthy  BOOLEAN NOT NULL,
+	Checked  INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())), -- unix seconds
+	Detail   TEXT    NOT NULL DEFAULT ''  -- reason the target was marked unhealthy
+);
+
+CREATE TABLE IF NOT EXISTS FallbackServes (
+	ID       TEXT    NOT NULL,            -- normalized link ID
+	Target   TEXT    NOT NULL,            -- fallback target that was served
+	Clicks   INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (ID, Target)
+);
+
+CREATE TABLE IF NOT EXISTS MaintenanceWindows (
+	ID        BIGSERIAL PRIMARY KEY,
+	LinkID    TEXT    NOT NULL DEFAULT '', -- normalized link ID the window applies to, or
+	Short     TEXT    NOT NULL DEFAULT '',
+	Tag       TEXT    NOT NULL DEFAULT '', -- tag of the links the window applies to
+	Start     INTEGER NOT NULL,            -- unix seconds
+	"End"     INTEGER NOT NULL,            -- unix seconds
+	Target    TEXT    NOT NULL DEFAULT '', -- overrides the link's MaintenanceTarget if set
+	Reason    TEXT    NOT NULL DEFAULT '',
+	CreatedBy TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS SmartLists (
+	Owner    TEXT    NOT NULL,            -- user@domain
+	ID       TEXT    NOT NULL,            -- normalized version of Name
+	Name     TEXT    NOT NULL DEFAULT '',
+	Query    TEXT    NOT NULL DEFAULT '', -- link query expression
+	Created  INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())), -- unix seconds
+	PRIMARY KEY (Owner, ID)
+);
+
+CREATE TABLE IF NOT EXISTS OwnerIdentities (
+	Owner    TEXT    PRIMARY KEY,         -- pseudonymized owner, as stored in Links
+	Identity TEXT    NOT NULL             -- encrypted user login
+);
+
+CREATE TABLE IF NOT EXISTS LinkHistory (
+	ID       TEXT    NOT NULL,            -- normalized link ID
+	Revision INTEGER NOT NULL,            -- 1 for the first revision of a link
+	Short    TEXT    NOT NULL DEFAULT '',
+	Long     TEXT    NOT NULL DEFAULT '',
+	Owner    TEXT    NOT NULL DEFAULT '',
+	Tags     TEXT    NOT NULL DEFAULT '', -- newline-separated
+	Edited   INTEGER NOT NULL,            -- unix seconds the revision took effect
+	Deleted  BOOLEAN NOT NULL DEFAULT FALSE, -- whether the link was deleted
+	PRIMARY KEY (ID, Revision)
+);
+
+-- record the current state of links saved before history was kept
+INSERT INTO LinkHistory (ID, Revision, Short, Long, Owner, Tags, Edited)
+SELECT ID, 1, Short, Long, Owner,
+	COALESCE((SELECT string_agg(Tag, E'\n' ORDER BY Tag) FROM LinkTags WHERE LinkTags.ID = Links.ID), ''),
+	LastEdit
+FROM Links
+WHERE NOT EXISTS (SELECT 1 FROM LinkHistory WHERE LinkHistory.ID = Links.ID);
@@ -0,0 +1 @@
+ALTER TABLE Links ADD COLUMN RawLong TEXT NOT NULL DEFAULT ''; -- target as entered, if Long is its canonical form
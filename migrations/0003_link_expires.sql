@@ -0,0 +1 @@
+ALTER TABLE Links ADD COLUMN Expires INTEGER NOT NULL DEFAULT 0; -- unix seconds the link stops resolving, 0 if it never expires
@@ -0,0 +1 @@
+ALTER TABLE Links ADD COLUMN Version INTEGER NOT NULL DEFAULT 0; -- incremented on each save, to detect concurrent edits
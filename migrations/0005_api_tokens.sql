@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS Tokens (
+	ID        TEXT    PRIMARY KEY,         -- public identifier, included in the token
+	Hash      TEXT    NOT NULL UNIQUE,     -- hex SHA-256 of the token, which is not stored
+	Name      TEXT    NOT NULL DEFAULT '', -- what the token is for, such as "deploy bot"
+	Login     TEXT    NOT NULL,            -- user@domain the token acts as
+	Scopes    TEXT    NOT NULL,            -- space-separated scopes, such as "links:read"
+	Created   INTEGER NOT NULL,            -- unix seconds
+	CreatedBy TEXT    NOT NULL,            -- admin who created the token
+	Revoked   INTEGER NOT NULL DEFAULT 0   -- unix seconds, 0 if not revoked
+);
@@ -0,0 +1 @@
+ALTER TABLE LinkHistory ADD COLUMN Editor TEXT NOT NULL DEFAULT ''; -- stored owner value of the user who made the change, '' if unknown
@@ -0,0 +1,33 @@
+-- Stats is partitioned by the month of Created, so that old stats can be
+-- dropped a month at a time and queries by time only scan the months they
+-- need. The stats-partitions job creates partitions ahead of time, named
+-- stats_YYYYMM; Stats_default holds any rows outside them.
+ALTER TABLE Stats RENAME TO Stats_unpartitioned;
+
+CREATE TABLE Stats (
+	ID       TEXT    NOT NULL DEFAULT '',
+	Created  INTEGER NOT NULL DEFAULT (EXTRACT(EPOCH FROM NOW())), -- unix seconds
+	Clicks   INTEGER
+) PARTITION BY RANGE (Created);
+
+CREATE TABLE Stats_default PARTITION OF Stats DEFAULT;
+
+-- a partition for each month from the oldest stats through next month
+DO $$
+DECLARE
+	month TIMESTAMP := date_trunc('month', to_timestamp(COALESCE((SELECT MIN(Created) FROM Stats_unpartitioned), EXTRACT(EPOCH FROM NOW()))) AT TIME ZONE 'UTC');
+	last  TIMESTAMP := date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '1 month';
+BEGIN
+	WHILE month <= last LOOP
+		EXECUTE format('CREATE TABLE %I PARTITION OF Stats FOR VALUES FROM (%s) TO (%s)',
+			'stats_' || to_char(month, 'YYYYMM'),
+			EXTRACT(EPOCH FROM month AT TIME ZONE 'UTC')::bigint,
+			EXTRACT(EPOCH FROM (month + INTERVAL '1 month') AT TIME ZONE 'UTC')::bigint);
+		month := month + INTERVAL '1 month';
+	END LOOP;
+END $$;
+
+INSERT INTO Stats (ID, Created, Clicks) SELECT ID, Created, Clicks FROM Stats_unpartitioned;
+DROP TABLE Stats_unpartitioned;
+
+CREATE INDEX IF NOT EXISTS StatsByID ON Stats (ID);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS LinkOwners (
+	ID       TEXT    NOT NULL,            -- normalized link ID
+	Owner    TEXT    NOT NULL,            -- stored owner value of a co-owner, a user or team:name
+	PRIMARY KEY (ID, Owner)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS Synonyms (
+	Term     TEXT    NOT NULL,            -- lowercased search word, such as k8s
+	Synonym  TEXT    NOT NULL,            -- lowercased word searched for along with Term, and vice versa
+	PRIMARY KEY (Term, Synonym)
+);
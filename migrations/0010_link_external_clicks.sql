@@ -0,0 +1,3 @@
+-- ExternalClicks is the part of TotalClicks from visitors to --public-hostname,
+-- maintained when stats are saved.
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS ExternalClicks INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS ReservedNames (
+	ID        TEXT    PRIMARY KEY,         -- normalized name, as for Links.ID
+	Name      TEXT    NOT NULL,            -- name as entered, such as "metrics"
+	Reason    TEXT    NOT NULL DEFAULT '', -- why the name is reserved, shown when a link is refused
+	Created   INTEGER NOT NULL,            -- unix seconds
+	CreatedBy TEXT    NOT NULL             -- admin who reserved the name
+);
@@ -0,0 +1,5 @@
+-- Path and Referrer break down a link's clicks by the path requested under
+-- it and the host of the referring page. Clicks recorded before they were
+-- added, and clicks with neither, have empty values.
+ALTER TABLE Stats ADD COLUMN IF NOT EXISTS Path TEXT NOT NULL DEFAULT '';
+ALTER TABLE Stats ADD COLUMN IF NOT EXISTS Referrer TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- IDVersion records the --id-normalization strategy each link's ID was
+-- normalized with; 1 is the original "legacy" strategy. golink refuses to
+-- start while any link has another version, until "golink migrate-ids"
+-- renormalizes them.
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS IDVersion INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- HealthCheck overrides how the dead link checker checks a link's
+-- destination: "off", or "status=NNN" and "auth=NAME" options separated by
+-- spaces. Empty uses the default check.
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS HealthCheck TEXT NOT NULL DEFAULT '';
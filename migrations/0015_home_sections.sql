@@ -0,0 +1,11 @@
+-- HomeSections are the sections of the home page, in order, set by admins
+-- with /.api/v1/home-sections. If empty, --home-sections is used.
+CREATE TABLE IF NOT EXISTS HomeSections (
+	Position INTEGER PRIMARY KEY,                -- order on the home page, from 0
+	Kind     TEXT    NOT NULL,                   -- pinned, popular, trending, yours, new, or tag
+	Title    TEXT    NOT NULL DEFAULT '',        -- heading, or "" for the default of Kind
+	Tag      TEXT    NOT NULL DEFAULT '',        -- tag listed by a tag section
+	Links    TEXT    NOT NULL DEFAULT '',        -- space-separated short names listed by a pinned section
+	MaxLinks INTEGER NOT NULL DEFAULT 0,         -- most links shown, or 0 for the default
+	Hidden   BOOLEAN NOT NULL DEFAULT FALSE      -- configured but not shown
+);
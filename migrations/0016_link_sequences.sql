@@ -0,0 +1,7 @@
+-- LinkSequences records the last number allocated to each family of
+-- sequentially numbered links, such as release-42, created with
+-- /.api/v1/shorten?prefix=release-.
+CREATE TABLE IF NOT EXISTS LinkSequences (
+	Prefix TEXT   PRIMARY KEY, -- link ID of the short name before the number
+	Last   BIGINT NOT NULL     -- last number allocated
+);
@@ -0,0 +1,17 @@
+-- JobRuns records the last start of each background job that runs on only
+-- one replica at a time, so that replicas sharing the database don't each
+-- run it on their own schedule.
+CREATE TABLE IF NOT EXISTS JobRuns (
+	Name      TEXT    PRIMARY KEY,
+	LastStart BIGINT  NOT NULL, -- unix seconds
+	Replica   TEXT    NOT NULL  -- replica that started the run
+);
+
+-- ClickBatches records the keys of flushed batches of click stats, so that
+-- a replica whose flush failed can tell whether it was saved anyway before
+-- saving its clicks again.
+CREATE TABLE IF NOT EXISTS ClickBatches (
+	ID      TEXT   PRIMARY KEY,
+	Created BIGINT NOT NULL -- unix seconds
+);
+CREATE INDEX IF NOT EXISTS ClickBatchesByCreated ON ClickBatches (Created);
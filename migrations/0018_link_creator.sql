@@ -0,0 +1,8 @@
+-- Creator is the stored owner value of the user who created the link, or ''
+-- if golink created it on its own or it predates this column, and Inserted
+-- is when it was added to the database, in unix seconds. Unlike Owner and
+-- Created, which imports may set, they count the links each user creates
+-- against --max-creations-per-day.
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Creator TEXT NOT NULL DEFAULT '';
+ALTER TABLE Links ADD COLUMN IF NOT EXISTS Inserted BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS LinksByCreator ON Links (Creator, Inserted);
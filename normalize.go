@@ -0,0 +1,289 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// collisionsShortName is used as the short name for generating XSRF tokens
+// when resolving ID collisions.
+const collisionsShortName = ".collisions"
+
+// normalizationRules are proposed additions to linkID normalization. Before a
+// rule is rolled out, links whose short names would collide under it can be
+// found with findCollisions and resolved by merging them.
+var normalizationRules = map[string]func(string) string{
+	// ignore underscores, like hyphens
+	"underscore": func(id string) string { return strings.ReplaceAll(id, "_", "") },
+	// ignore periods, including namespace separators
+	"dot": func(id string) string { return strings.ReplaceAll(id, ".", "") },
+}
+
+// normalizationSQL are SQL expressions equivalent to normalizationRules,
+// applied to the %s expression, for matching the IDs of stored links.
+var normalizationSQL = map[string]string{
+	"underscore": "REPLACE(%s, '_', '')",
+	"dot":        "REPLACE(%s, '.', '')",
+}
+
+// resolveNormalize is the normalization used to find links for short names
+// without an exact match, and resolveNormalizeID is the equivalent SQL
+// expression of the Links ID column. They are set from
+// --resolve-normalization, and resolveNormalize is nil if it is not set.
+var (
+	resolveNormalize   func(string) string
+	resolveNormalizeID string
+)
+
+// setResolveNormalization sets resolveNormalize and resolveNormalizeID from
+// a comma-separated list of normalizationRules names.
+func setResolveNormalization(rules string) error {
+	normalize, err := parseNormalizationRules(rules)
+	if err != nil {
+		return err
+	}
+	expr := "ID"
+	for _, name := range strings.Split(rules, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			expr = fmt.Sprintf(normalizationSQL[name], expr)
+		}
+	}
+	resolveNormalize, resolveNormalizeID = normalize, expr
+	return nil
+}
+
+// normalizedLinks returns the links whose short names normalize to the same
+// ID as short under --resolve-normalization, sorted by short name.
+func normalizedLinks(short string) ([]*Link, error) {
+	links, err := db.LoadWhere(resolveNormalizeID+" = $1", resolveNormalize(short))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Short < links[j].Short
+	})
+	return links, nil
+}
+
+// ambiguousData is the data used by ambiguousTmpl, and the JSON response
+// for ambiguous short names.
+type ambiguousData struct {
+	Short      string
+	Candidates []ambiguousCandidate
+}
+
+// ambiguousCandidate is one of the links an ambiguous short name may refer
+// to, or that may have been meant by a missing one.
+type ambiguousCandidate struct {
+	Short string
+	Long  string
+	URL   string // path to resolve the link, with the request's path and query
+}
+
+// linkCandidate returns link as a candidate for the request r, whose path
+// after the short name is remainder.
+func linkCandidate(r *http.Request, remainder string, link *Link) ambiguousCandidate {
+	u := &url.URL{Path: "/" + link.Short, RawQuery: r.URL.RawQuery}
+	if remainder != "" {
+		u.Path += "/" + remainder
+	}
+	return ambiguousCandidate{Short: link.Short, Long: link.Long, URL: u.String()}
+}
+
+// serveAmbiguous responds to a short name that matches several links under
+// --resolve-normalization with 300 Multiple Choices, listing the links
+// rather than picking one of them.
+func serveAmbiguous(w http.ResponseWriter, r *http.Request, short, remainder string, links []*Link) {
+	data := ambiguousData{Short: short}
+	for _, link := range links {
+		data.Candidates = append(data.Candidates, linkCandidate(r, remainder, link))
+	}
+	if acceptHTML(r) {
+		w.WriteHeader(http.StatusMultipleChoices)
+		ambiguousTmpl.Execute(w, data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMultipleChoices)
+	json.NewEncoder(w).Encode(data)
+}
+
+// parseNormalizationRules parses a comma-separated list of normalizationRules
+// names, returning a func that normalizes short names using linkID followed
+// by each of the rules.
+func parseNormalizationRules(s string) (func(string) string, error) {
+	var rules []func(string) string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		rule, ok := normalizationRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown normalization rule %q", name)
+		}
+		rules = append(rules, rule)
+	}
+	return func(short string) string {
+		id := linkID(short)
+		for _, rule := range rules {
+			id = rule(id)
+		}
+		return id
+	}, nil
+}
+
+// Collision is a group of links whose short names map to the same ID.
+type Collision struct {
+	ID     string   // ID shared by the links
+	Shorts []string // short names of the colliding links
+}
+
+// findCollisions returns the groups of links whose short names map to the
+// same ID under normalize, sorted by ID.
+func findCollisions(links []*Link, normalize func(string) string) []Collision {
+	groups := make(map[string][]string)
+	for _, link := range links {
+		id := normalize(link.Short)
+		groups[id] = append(groups[id], link.Short)
+	}
+	var collisions []Collision
+	for id, shorts := range groups {
+		if len(shorts) < 2 {
+			continue
+		}
+		sort.Strings(shorts)
+		collisions = append(collisions, Collision{ID: id, Shorts: shorts})
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].ID < collisions[j].ID
+	})
+	return collisions
+}
+
+// logCollisions logs any links that would collide under the normalization
+// rules in --check-normalization. It is run at startup.
+func logCollisions(rules string) error {
+	normalize, err := parseNormalizationRules(rules)
+	if err != nil {
+		return err
+	}
+	links, err := db.LoadAll()
+	if err != nil {
+		return err
+	}
+	collisions := findCollisions(links, normalize)
+	for _, c := range collisions {
+		log.Printf("normalization collision for %q: %s", c.ID, strings.Join(c.Shorts, ", "))
+	}
+	log.Printf("found %d link ID collisions under normalization rules %q", len(collisions), rules)
+	return nil
+}
+
+// serveCollisions reports links whose short names would collide under the
+// normalization rules in the "rules" parameter, such as "underscore,dot".
+//
+// POST requests resolve a collision by merging every other link in the
+// group containing "keep" into it, so that each remaining link maps to a
+// distinct ID once the rules are rolled out.
+func serveCollisions(w http.ResponseWriter, r *http.Request) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		http.Error(w, "only admins can view link collisions", http.StatusForbidden)
+		return
+	}
+	normalize, err := parseNormalizationRules(r.FormValue("rules"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	links, err := db.LoadAll()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	collisions := findCollisions(links, normalize)
+
+	if r.Method != "POST" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(collisions)
+		return
+	}
+
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isRequestAuthorized(r, cu, collisionsShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	keep := r.FormValue("keep")
+	if keep == "" {
+		http.Error(w, "keep required", http.StatusBadRequest)
+		return
+	}
+	var group *Collision
+	for i, c := range collisions {
+		for _, short := range c.Shorts {
+			if short == keep {
+				group = &collisions[i]
+			}
+		}
+	}
+	if group == nil {
+		http.Error(w, "no collision found for "+keep, http.StatusNotFound)
+		return
+	}
+
+	// flush pending clicks so they are moved along with the stored stats
+	if err := flushStats(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	intoLink, err := db.Load(keep)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, short := range group.Shorts {
+		if short == keep {
+			continue
+		}
+		fromLink, err := db.Load(short)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := db.Merge(fromLink.Short, intoLink.Short); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mergeLinkStats(fromLink, intoLink)
+		linkTemplates.invalidate(fromLink.Short)
+		audit(r, cu, "link.merge", fromLink.Short, "into="+intoLink.Short)
+		notifyLinkChange(cu.login, fromLink, nil)
+		log.Printf("collision on %q resolved by %s: merged %q into %q", group.ID, cu.login, fromLink.Short, intoLink.Short)
+	}
+
+	merged, err := db.Load(keep)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	notifyLinkChange(cu.login, intoLink, merged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
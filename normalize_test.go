@@ -0,0 +1,101 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFindCollisions(t *testing.T) {
+	var links []*Link
+	for _, short := range []string{"team_wiki", "teamwiki", "Team-Wiki2", "eng.docs", "engdocs", "cs"} {
+		links = append(links, &Link{Short: short})
+	}
+	tests := []struct {
+		rules string
+		want  []Collision
+	}{
+		{rules: "", want: nil},
+		{
+			rules: "underscore",
+			want:  []Collision{{ID: "teamwiki", Shorts: []string{"team_wiki", "teamwiki"}}},
+		},
+		{
+			rules: "underscore, dot",
+			want: []Collision{
+				{ID: "engdocs", Shorts: []string{"eng.docs", "engdocs"}},
+				{ID: "teamwiki", Shorts: []string{"team_wiki", "teamwiki"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		normalize, err := parseNormalizationRules(tt.rules)
+		if err != nil {
+			t.Fatalf("parseNormalizationRules(%q) returned error: %v", tt.rules, err)
+		}
+		got := findCollisions(links, normalize)
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("findCollisions(%q) mismatch (-want +got):\n%s", tt.rules, diff)
+		}
+	}
+
+	if _, err := parseNormalizationRules("unicode"); err == nil {
+		t.Error("parseNormalizationRules(unicode) succeeded; want error")
+	}
+}
+
+func TestResolveNormalization(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "team_wiki", Long: "https://wiki/team"})
+	db.Save(&Link{Short: "teamwiki", Long: "https://wiki/"})
+	db.Save(&Link{Short: "engdocs", Long: "https://docs/eng"})
+
+	t.Cleanup(func() { resolveNormalize, resolveNormalizeID = nil, "" })
+	if err := setResolveNormalization("underscore"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		link       string
+		wantStatus int
+		wantLink   string
+	}{
+		{link: "/teamwiki", wantStatus: http.StatusFound, wantLink: "https://wiki/"},
+		{link: "/eng_docs", wantStatus: http.StatusFound, wantLink: "https://docs/eng"},
+		{link: "/team__wiki", wantStatus: http.StatusMultipleChoices},
+		{link: "/unknown_link", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		serveHandler().ServeHTTP(w, httptest.NewRequest("GET", tt.link, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("serveGo(%q) = %d; want %d", tt.link, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("Location"); got != tt.wantLink {
+			t.Errorf("serveGo(%q) = %q; want %q", tt.link, got, tt.wantLink)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	serveHandler().ServeHTTP(w, httptest.NewRequest("GET", "/team__wiki/edit?q=1", nil))
+	var got ambiguousData
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := ambiguousData{
+		Short: "team__wiki",
+		Candidates: []ambiguousCandidate{
+			{Short: "team_wiki", Long: "https://wiki/team", URL: "/team_wiki/edit?q=1"},
+			{Short: "teamwiki", Long: "https://wiki/", URL: "/teamwiki/edit?q=1"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ambiguous response mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,551 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"cmp"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oidcConfig configures OIDC login, for --identity=oidc.
+type oidcConfig struct {
+	issuer       string // issuer URL, where /.well-known/openid-configuration is served
+	clientID     string
+	clientSecret string
+	redirectURL  string // this server's oidcCallbackPath, as registered with the issuer
+	claim        string // ID token claim holding the user's login, such as "email"
+}
+
+const (
+	oidcCallbackPath  = "/.oidc/callback"
+	oidcSessionCookie = "golink_session"
+	oidcStateCookie   = "golink_oidc_state"
+	oidcSessionTTL    = 24 * time.Hour
+	oidcLoginTTL      = 10 * time.Minute // to complete a login at the issuer
+)
+
+// errLoginRequired is returned by oidcIdentity for requests without a
+// session.
+var errLoginRequired = errors.New("login required")
+
+// oidcIdentity signs users in with an OpenID Connect provider, using the
+// authorization code flow, and identifies them with a signed session cookie
+// afterwards. The provider's metadata and signing keys are fetched when
+// first needed.
+type oidcIdentity struct {
+	oidcConfig
+	sessionKey []byte // signs cookies, derived from the client secret
+	client     *http.Client
+
+	mu       sync.Mutex
+	metadata *oidcMetadata
+	keys     map[string]crypto.PublicKey // by key ID
+}
+
+// oidcMetadata is the subset of the provider's discovery document used by
+// oidcIdentity.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcFlagConfig returns the OIDC configuration set by flags, reading the
+// client secret from --oidc-client-secret-file.
+func oidcFlagConfig() (oidcConfig, error) {
+	cfg := oidcConfig{
+		issuer:      *oidcIssuer,
+		clientID:    *oidcClientID,
+		redirectURL: *oidcRedirectURL,
+		claim:       *oidcLoginClaim,
+	}
+	if *oidcSecretFile != "" {
+		b, err := os.ReadFile(*oidcSecretFile)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.clientSecret = strings.TrimSpace(string(b))
+	}
+	return cfg, nil
+}
+
+func newOIDCIdentity(cfg oidcConfig) (*oidcIdentity, error) {
+	switch {
+	case cfg.issuer == "":
+		return nil, errors.New("oidc identity requires --oidc-issuer")
+	case cfg.clientID == "":
+		return nil, errors.New("oidc identity requires --oidc-client-id")
+	case cfg.clientSecret == "":
+		return nil, errors.New("oidc identity requires --oidc-client-secret-file")
+	case cfg.redirectURL == "":
+		return nil, errors.New("oidc identity requires --oidc-redirect-url")
+	}
+	u, err := url.Parse(cfg.redirectURL)
+	if err != nil || u.Path != oidcCallbackPath {
+		return nil, fmt.Errorf("--oidc-redirect-url must be an absolute URL ending in %s", oidcCallbackPath)
+	}
+	if cfg.claim == "" {
+		cfg.claim = "email"
+	}
+	cfg.issuer = strings.TrimSuffix(cfg.issuer, "/")
+	// deriving the key from the secret keeps sessions valid across restarts
+	// and replicas, and ends them when the secret is rotated
+	mac := hmac.New(sha256.New, []byte(cfg.clientSecret))
+	io.WriteString(mac, "golink session")
+	return &oidcIdentity{
+		oidcConfig: cfg,
+		sessionKey: mac.Sum(nil),
+		client:     outboundClient(10 * time.Second),
+	}, nil
+}
+
+func (o *oidcIdentity) requestUser(r *http.Request) (user, error) {
+	c, err := r.Cookie(oidcSessionCookie)
+	if err != nil {
+		return user{}, errLoginRequired
+	}
+	value, ok := o.verify(c.Value)
+	if !ok {
+		return user{}, errLoginRequired
+	}
+	enc, exp, _ := strings.Cut(value, ".")
+	login, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return user{}, errLoginRequired
+	}
+	if t, err := strconv.ParseInt(exp, 10, 64); err != nil || time.Now().Unix() > t {
+		return user{}, errLoginRequired
+	}
+	return user{login: string(login)}, nil
+}
+
+func (*oidcIdentity) userExists(ctx context.Context, login string) (bool, error) {
+	// the provider's user directory isn't available, so assume the user exists
+	return true, nil
+}
+
+// sign returns value with an HMAC appended.
+func (o *oidcIdentity) sign(value string) string {
+	mac := hmac.New(sha256.New, o.sessionKey)
+	io.WriteString(mac, value)
+	return value + "~" + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the value signed by sign, and whether its HMAC is valid.
+func (o *oidcIdentity) verify(signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '~')
+	if i < 0 {
+		return "", false
+	}
+	value := signed[:i]
+	if subtle.ConstantTimeCompare([]byte(o.sign(value)), []byte(signed)) != 1 {
+		return "", false
+	}
+	return value, true
+}
+
+// oidcLogin returns the oidcIdentity that p signs users in with, or nil if
+// p doesn't use OIDC.
+func oidcLogin(p identityProvider) *oidcIdentity {
+	switch p := p.(type) {
+	case *oidcIdentity:
+		return p
+	case tokenIdentity:
+		return oidcLogin(p.next)
+	}
+	return nil
+}
+
+// requireLogin returns a handler that serves the OIDC callback, and sends
+// page views from users who are not signed in to the provider to sign in.
+// Other requests without a session, such as API calls, are refused.
+func (o *oidcIdentity) requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == oidcCallbackPath {
+			o.serveCallback(w, r)
+			return
+		}
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || strings.HasPrefix(r.URL.Path, "/.static/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// identity may also accept API tokens
+		if _, err := identity.requestUser(r); err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if (r.Method != "GET" && r.Method != "HEAD") || strings.HasPrefix(r.URL.Path, "/.api/") || r.Header.Get("Authorization") != "" {
+			http.Error(w, errLoginRequired.Error(), http.StatusUnauthorized)
+			return
+		}
+		o.startLogin(w, r)
+	})
+}
+
+// startLogin redirects to the provider's authorization endpoint, saving the
+// state needed to complete the login in a short-lived cookie.
+func (o *oidcIdentity) startLogin(w http.ResponseWriter, r *http.Request) {
+	md, err := o.discover(r.Context())
+	if err != nil {
+		http.Error(w, "OIDC discovery: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	state, verifier := rand.Text(), rand.Text()
+	challenge := sha256.Sum256([]byte(verifier))
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    o.sign(state + "." + verifier + "." + base64.RawURLEncoding.EncodeToString([]byte(r.URL.RequestURI()))),
+		Path:     oidcCallbackPath,
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(o.redirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {o.clientID},
+		"redirect_uri":          {o.redirectURL},
+		"scope":                 {"openid email profile"},
+		"state":                 {state},
+		"nonce":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, md.AuthorizationEndpoint+sep+q.Encode(), http.StatusFound)
+}
+
+// serveCallback completes a login: it exchanges the authorization code for
+// an ID token, verifies it, and starts a session for the user it names.
+func (o *oidcIdentity) serveCallback(w http.ResponseWriter, r *http.Request) {
+	if msg := r.FormValue("error"); msg != "" {
+		http.Error(w, "login failed: "+cmp.Or(r.FormValue("error_description"), msg), http.StatusForbidden)
+		return
+	}
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, "login expired; try again", http.StatusBadRequest)
+		return
+	}
+	value, ok := o.verify(c.Value)
+	parts := strings.Split(value, ".")
+	if !ok || len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(r.FormValue("state"))) != 1 {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	state, verifier := parts[0], parts[1]
+	returnTo := "/"
+	if b, err := base64.RawURLEncoding.DecodeString(parts[2]); err == nil && isLocalPath(string(b)) {
+		returnTo = string(b)
+	}
+
+	login, err := o.exchange(r.Context(), r.FormValue("code"), verifier, state)
+	if err != nil {
+		http.Error(w, "login failed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	exp := time.Now().Add(oidcSessionTTL)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCallbackPath, MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcSessionCookie,
+		Value:    o.sign(base64.RawURLEncoding.EncodeToString([]byte(login)) + "." + strconv.FormatInt(exp.Unix(), 10)),
+		Path:     "/",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(o.redirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, returnTo, http.StatusFound)
+}
+
+// isLocalPath reports whether p is a path on this server, and not a
+// protocol-relative URL like "//evil.example.com", which browsers would
+// follow to another host.
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.HasPrefix(p, "/\\")
+}
+
+// exchange redeems an authorization code at the token endpoint and returns
+// the login named by the verified ID token.
+func (o *oidcIdentity) exchange(ctx context.Context, code, verifier, nonce string) (string, error) {
+	md, err := o.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.redirectURL},
+		"client_id":     {o.clientID},
+		"client_secret": {o.clientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	var tok struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := o.getJSON(req, &tok); err != nil && tok.Error == "" {
+		return "", fmt.Errorf("token endpoint: %w", err)
+	}
+	if tok.Error != "" {
+		return "", fmt.Errorf("token endpoint: %s", tok.Error)
+	}
+	keys, err := o.signingKeys(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	claims, err := verifyIDToken(tok.IDToken, keys, o.issuer, o.clientID, nonce, time.Now())
+	if errors.Is(err, errUnknownKey) {
+		// the provider may have rotated its keys
+		if keys, err = o.signingKeys(ctx, true); err != nil {
+			return "", err
+		}
+		claims, err = verifyIDToken(tok.IDToken, keys, o.issuer, o.clientID, nonce, time.Now())
+	}
+	if err != nil {
+		return "", err
+	}
+	return loginClaim(claims, o.claim)
+}
+
+// loginClaim returns the named claim from an ID token's claims. Email
+// addresses that the provider reports as unverified are rejected.
+func loginClaim(claims map[string]any, name string) (string, error) {
+	login, _ := claims[name].(string)
+	if login == "" {
+		return "", fmt.Errorf("ID token has no %q claim", name)
+	}
+	if name == "email" {
+		if verified, ok := claims["email_verified"].(bool); ok && !verified {
+			return "", fmt.Errorf("email %s is not verified", login)
+		}
+	}
+	return login, nil
+}
+
+// discover returns the provider's metadata, fetching it on first use.
+func (o *oidcIdentity) discover(ctx context.Context) (*oidcMetadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.metadata != nil {
+		return o.metadata, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", o.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	md := new(oidcMetadata)
+	if err := o.getJSON(req, md); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != o.issuer {
+		return nil, fmt.Errorf("provider reports issuer %q, want %q", md.Issuer, o.issuer)
+	}
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("provider metadata is missing endpoints")
+	}
+	o.metadata = md
+	return md, nil
+}
+
+// signingKeys returns the provider's ID token signing keys, fetching them
+// on first use or if refresh is set.
+func (o *oidcIdentity) signingKeys(ctx context.Context, refresh bool) (map[string]crypto.PublicKey, error) {
+	md, err := o.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.keys != nil && !refresh {
+		return o.keys, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", md.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct{ Keys []jwk }
+	if err := o.getJSON(req, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		if pub, err := k.publicKey(); err == nil && k.Use != "enc" {
+			keys[k.Kid] = pub
+		}
+	}
+	o.keys = keys
+	return keys, nil
+}
+
+// getJSON sends req and decodes its JSON response into v. The response is
+// decoded even if it reports an error, so that OAuth error codes are seen.
+func (o *oidcIdentity) getJSON(req *http.Request, v any) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return err
+}
+
+// jwk is a JSON Web Key, as served at a provider's jwks_uri.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`   // RSA modulus
+	E   string `json:"e"`   // RSA exponent
+	Crv string `json:"crv"` // EC curve
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid key %s", k.Kid)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := num(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid key %s", k.Kid)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// errUnknownKey is returned by verifyIDToken if the token was signed with
+// a key that is not in keys.
+var errUnknownKey = errors.New("ID token signed with unknown key")
+
+// verifyIDToken verifies the signature and claims of an ID token, a JWT
+// signed with RS256 or ES256 by one of keys, and returns its claims.
+func verifyIDToken(raw string, keys map[string]crypto.PublicKey, issuer, clientID, nonce string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed ID token signature")
+	}
+	key, ok := keys[header.Kid]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	valid := false
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		valid = header.Alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		if header.Alg == "ES256" && len(sig) == 64 {
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			valid = ecdsa.Verify(key, digest[:], r, s)
+		}
+	}
+	if !valid {
+		return nil, errors.New("invalid ID token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != issuer {
+		return nil, fmt.Errorf("ID token issued by %q", iss)
+	}
+	audOK := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audOK = aud == clientID
+	case []any:
+		for _, a := range aud {
+			audOK = audOK || a == clientID
+		}
+	}
+	if !audOK {
+		return nil, errors.New("ID token is for another client")
+	}
+	if exp, _ := claims["exp"].(float64); now.Unix() > int64(exp) {
+		return nil, errors.New("ID token expired")
+	}
+	if n, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(s string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("malformed ID token")
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("malformed ID token: %v", err)
+	}
+	return nil
+}
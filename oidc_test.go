@@ -0,0 +1,195 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func signTestJWT(t *testing.T, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	enc := func(v any) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(map[string]string{"alg": alg, "kid": kid}) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PublicKey{"rsa": rsaKey.Public(), "ec": ecKey.Public()}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":   "https://idp.example.com",
+			"aud":   "golink",
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "n1",
+			"email": "alice@example.com",
+		}
+		for k, v := range changes {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "rsa", token: signTestJWT(t, "rsa", rsaKey, claims(nil))},
+		{name: "ec", token: signTestJWT(t, "ec", ecKey, claims(nil))},
+		{name: "audience list", token: signTestJWT(t, "rsa", rsaKey, claims(map[string]any{"aud": []string{"other", "golink"}}))},
+		{name: "other audience", token: signTestJWT(t, "rsa", rsaKey, claims(map[string]any{"aud": "other"})), wantErr: true},
+		{name: "other issuer", token: signTestJWT(t, "rsa", rsaKey, claims(map[string]any{"iss": "https://evil.example.com"})), wantErr: true},
+		{name: "expired", token: signTestJWT(t, "rsa", rsaKey, claims(map[string]any{"exp": now.Add(-time.Minute).Unix()})), wantErr: true},
+		{name: "nonce", token: signTestJWT(t, "rsa", rsaKey, claims(map[string]any{"nonce": "n2"})), wantErr: true},
+		{name: "wrong key", token: signTestJWT(t, "ec", rsaKey, claims(nil)), wantErr: true},
+		{name: "malformed", token: "not.a-token", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := verifyIDToken(tt.token, keys, "https://idp.example.com", "golink", "n1", now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifyIDToken error = %v; want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got["email"] != "alice@example.com" {
+			t.Errorf("%s: verifyIDToken email = %v; want alice@example.com", tt.name, got["email"])
+		}
+	}
+
+	tampered := signTestJWT(t, "rsa", rsaKey, claims(nil))
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	if _, err := verifyIDToken(tampered, keys, "https://idp.example.com", "golink", "n1", now); err == nil {
+		t.Errorf("verifyIDToken accepted a tampered signature")
+	}
+	unknown := signTestJWT(t, "new", rsaKey, claims(nil))
+	if _, err := verifyIDToken(unknown, keys, "https://idp.example.com", "golink", "n1", now); !errors.Is(err, errUnknownKey) {
+		t.Errorf("verifyIDToken with unknown key = %v; want errUnknownKey", err)
+	}
+}
+
+func TestOIDCSession(t *testing.T) {
+	o, err := newOIDCIdentity(oidcConfig{
+		issuer:       "https://idp.example.com/",
+		clientID:     "golink",
+		clientSecret: "secret",
+		redirectURL:  "https://go.example.com/.oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := func(login string, exp time.Time) string {
+		return o.sign(base64.RawURLEncoding.EncodeToString([]byte(login)) + "." + strconv.FormatInt(exp.Unix(), 10))
+	}
+	tests := []struct {
+		name      string
+		cookie    string
+		wantLogin string
+	}{
+		{name: "valid", cookie: session("alice@example.com", time.Now().Add(time.Hour)), wantLogin: "alice@example.com"},
+		{name: "expired", cookie: session("alice@example.com", time.Now().Add(-time.Hour))},
+		{name: "forged", cookie: session("alice@example.com", time.Now().Add(time.Hour))[:10] + "x~AAAA"},
+		{name: "none"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.cookie != "" {
+			r.Header.Set("Cookie", oidcSessionCookie+"="+tt.cookie)
+		}
+		u, err := o.requestUser(r)
+		if tt.wantLogin == "" {
+			if err == nil {
+				t.Errorf("%s: requestUser = %q; want error", tt.name, u.login)
+			}
+			continue
+		}
+		if err != nil || u.login != tt.wantLogin {
+			t.Errorf("%s: requestUser = %q, %v; want %q", tt.name, u.login, err, tt.wantLogin)
+		}
+	}
+
+	if _, err := newOIDCIdentity(oidcConfig{issuer: "https://idp.example.com", clientID: "golink", clientSecret: "secret", redirectURL: "https://go.example.com/callback"}); err == nil {
+		t.Errorf("newOIDCIdentity accepted a redirect URL not ending in %s", oidcCallbackPath)
+	}
+}
+
+func TestLoginClaim(t *testing.T) {
+	tests := []struct {
+		claims  map[string]any
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{claims: map[string]any{"email": "alice@example.com", "email_verified": true}, name: "email", want: "alice@example.com"},
+		{claims: map[string]any{"email": "alice@example.com"}, name: "email", want: "alice@example.com"},
+		{claims: map[string]any{"email": "alice@example.com", "email_verified": false}, name: "email", wantErr: true},
+		{claims: map[string]any{"preferred_username": "alice"}, name: "preferred_username", want: "alice"},
+		{claims: map[string]any{"sub": "123"}, name: "email", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := loginClaim(tt.claims, tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("loginClaim(%v, %q) = %q, %v; want %q, error %v", tt.claims, tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestIsLocalPath(t *testing.T) {
+	for p, want := range map[string]bool{
+		"/":                   true,
+		"/foo?bar=1":          true,
+		"//evil.example.com":  false,
+		`/\evil.example.com`:  false,
+		"https://example.com": false,
+		"":                    false,
+	} {
+		if got := isLocalPath(p); got != want {
+			t.Errorf("isLocalPath(%q) = %v; want %v", p, got, want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Outbound HTTP requests, such as dead link checks, webhooks, audit
+// exports, OIDC discovery, update checks, and DNS provider calls, are made
+// with clients from outboundClient, so that they share the proxy, CA
+// bundle, timeout, and egress allowlist flags. golink's probes of its own
+// listeners are not outbound and don't use them.
+
+// outboundConfig is the parsed outbound HTTP configuration.
+type outboundConfig struct {
+	proxy   func(*http.Request) (*url.URL, error)
+	roots   *x509.CertPool // nil for the system roots
+	timeout time.Duration  // for dialing, TLS handshakes, and response headers
+	allow   []string       // hosts requests may be made to, or nil for any
+}
+
+// outbound is the configuration used by outboundClient, set by
+// configureOutbound.
+var outbound = outboundConfig{
+	proxy:   http.ProxyFromEnvironment,
+	timeout: 30 * time.Second,
+}
+
+// configureOutbound sets outbound from the --outbound-* flags.
+func configureOutbound() error {
+	cfg, err := parseOutboundConfig(*outboundProxy, *outboundCAFile, *outboundTimeout, *outboundAllow)
+	if err != nil {
+		return err
+	}
+	outbound = cfg
+	return nil
+}
+
+// parseOutboundConfig parses the --outbound-* flags. The proxy, if set,
+// replaces HTTP_PROXY and HTTPS_PROXY, but hosts in NO_PROXY still bypass
+// it. The CA file, if set, replaces the system roots.
+func parseOutboundConfig(proxy, caFile string, timeout time.Duration, allow string) (outboundConfig, error) {
+	cfg := outboundConfig{timeout: timeout}
+	env := httpproxy.FromEnvironment()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return cfg, fmt.Errorf("--outbound-proxy: %q is not an http, https, or socks5 URL", proxy)
+		}
+		env.HTTPProxy, env.HTTPSProxy = proxy, proxy
+	}
+	proxyFunc := env.ProxyFunc()
+	cfg.proxy = func(r *http.Request) (*url.URL, error) { return proxyFunc(r.URL) }
+	if caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return cfg, fmt.Errorf("--outbound-ca-file: %w", err)
+		}
+		cfg.roots = x509.NewCertPool()
+		if !cfg.roots.AppendCertsFromPEM(b) {
+			return cfg, fmt.Errorf("--outbound-ca-file: no PEM certificates in %s", caFile)
+		}
+	}
+	if timeout <= 0 {
+		return cfg, errors.New("--outbound-timeout must be positive")
+	}
+	for _, h := range strings.Split(allow, ",") {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+		if strings.Contains(strings.TrimPrefix(h, "*."), "*") {
+			return cfg, fmt.Errorf("--outbound-allow: invalid host %q", h)
+		}
+		cfg.allow = append(cfg.allow, h)
+	}
+	return cfg, nil
+}
+
+// matchHost reports whether host matches one of patterns, which are
+// hostnames, or "*.example.com" for any subdomain of example.com.
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, p := range patterns {
+		if suffix, ok := strings.CutPrefix(p, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+// errEgressDenied is returned for requests to hosts not in --outbound-allow.
+var errEgressDenied = errors.New("not in --outbound-allow")
+
+// egressTransport refuses requests, including redirects, to hosts that
+// aren't allowed.
+type egressTransport struct {
+	allow []string
+	next  http.RoundTripper
+}
+
+func (t *egressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !matchHost(t.allow, req.URL.Hostname()) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("request to %s: %w", req.URL.Hostname(), errEgressDenied)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// newTransport returns a transport for cfg. If dial is non-nil, it dials
+// connections, such as through the tailnet.
+func (cfg outboundConfig) newTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) http.RoundTripper {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = cfg.proxy
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: cfg.timeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	t.DialContext = dial
+	t.TLSHandshakeTimeout = cfg.timeout
+	t.ResponseHeaderTimeout = cfg.timeout
+	if cfg.roots != nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: cfg.roots}
+	}
+	if cfg.allow == nil {
+		return t
+	}
+	return &egressTransport{allow: cfg.allow, next: t}
+}
+
+// outboundClient returns a client for outbound requests that time out
+// after timeout, or never if it is zero.
+func outboundClient(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: outbound.newTransport(nil), Timeout: timeout}
+}
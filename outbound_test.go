@@ -0,0 +1,140 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseOutboundConfig(t *testing.T) {
+	tests := []struct {
+		proxy, caFile string
+		timeout       time.Duration
+		allow         string
+		wantErr       bool
+	}{
+		{"", "", time.Second, "", false},
+		{"http://proxy.example.com:3128", "", time.Second, "", false},
+		{"socks5://127.0.0.1:1080", "", time.Second, " example.com, *.example.com ", false},
+		{"proxy.example.com:3128", "", time.Second, "", true},
+		{"ftp://proxy.example.com", "", time.Second, "", true},
+		{"", filepath.Join(t.TempDir(), "missing.pem"), time.Second, "", true},
+		{"", "", 0, "", true},
+		{"", "", time.Second, "*.*.example.com", true},
+	}
+	for _, tt := range tests {
+		_, err := parseOutboundConfig(tt.proxy, tt.caFile, tt.timeout, tt.allow)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseOutboundConfig(%q, %q, %v, %q) = %v; want error %v", tt.proxy, tt.caFile, tt.timeout, tt.allow, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	patterns := []string{"hooks.example.com", "*.corp.example.com"}
+	for host, want := range map[string]bool{
+		"hooks.example.com":      true,
+		"Hooks.Example.com.":     true,
+		"a.corp.example.com":     true,
+		"a.b.corp.example.com":   true,
+		"corp.example.com":       false,
+		"xcorp.example.com":      false,
+		"hooks.example.com.evil": false,
+	} {
+		if got := matchHost(patterns, host); got != want {
+			t.Errorf("matchHost(%q) = %v; want %v", host, got, want)
+		}
+	}
+}
+
+func TestOutboundAllow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/elsewhere" {
+			http.Redirect(w, r, "http://denied.example.com/", http.StatusFound)
+		}
+	}))
+	defer ts.Close()
+
+	cfg, err := parseOutboundConfig("", "", time.Second, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Client{Transport: cfg.newTransport(nil)}
+	resp, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// redirects are checked too
+	if _, err := c.Get(ts.URL + "/elsewhere"); !errors.Is(err, errEgressDenied) {
+		t.Errorf("redirect to denied host = %v; want errEgressDenied", err)
+	}
+
+	cfg, err = parseOutboundConfig("", "", time.Second, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = &http.Client{Transport: cfg.newTransport(nil)}
+	if _, err := c.Get(ts.URL); !errors.Is(err, errEgressDenied) {
+		t.Errorf("request to denied host = %v; want errEgressDenied", err)
+	}
+}
+
+func TestOutboundProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	cfg, err := parseOutboundConfig(proxy.URL, "", time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Client{Transport: cfg.newTransport(nil)}
+	resp, err := c.Get("http://hooks.example.com/event")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want := "http://hooks.example.com/event"; proxied != want {
+		t.Errorf("proxy got %q; want %q", proxied, want)
+	}
+}
+
+func TestOutboundCAFile(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	// not trusted by the system roots
+	cfg, err := parseOutboundConfig("", "", time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&http.Client{Transport: cfg.newTransport(nil)}).Get(ts.URL); err == nil {
+		t.Error("request to test server succeeded without its CA")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	if err := os.WriteFile(caFile, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = parseOutboundConfig("", caFile, time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: cfg.newTransport(nil)}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,228 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// pseudonymPrefix is prepended to pseudonymized link owners, such as
+// "anon:3b1f9c0e2d7a4c55e8a06f1d9b2c7e40".
+const pseudonymPrefix = "anon:"
+
+// ownerKey is the secret used to pseudonymize link owners, read from
+// --owner-key-file. Owners are stored in plaintext if it is nil.
+var ownerKey []byte
+
+// isPseudonym reports whether owner is a pseudonymized owner.
+func isPseudonym(owner string) bool {
+	return strings.HasPrefix(owner, pseudonymPrefix)
+}
+
+// storedOwner returns the Owner value stored for links owned by login.
+// When owner pseudonymization is enabled, user logins are replaced with a
+// keyed hash. Team and group owners and existing pseudonyms are returned
+// unchanged.
+func storedOwner(login string) string {
+	if ownerKey == nil || login == "" || isPseudonym(login) || strings.HasPrefix(login, teamOwnerPrefix) || strings.HasPrefix(login, groupOwnerPrefix) {
+		return login
+	}
+	mac := hmac.New(sha256.New, ownerKey)
+	mac.Write([]byte(strings.ToLower(login)))
+	return pseudonymPrefix + hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// identityCipher returns the cipher used to encrypt the identities behind
+// pseudonyms, using a key derived from ownerKey.
+func identityCipher() (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, ownerKey)
+	mac.Write([]byte("golink owner identity"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealIdentity encrypts login for storage alongside its pseudonym, which is
+// used as additional data so that sealed identities cannot be swapped.
+func sealIdentity(pseudonym, login string) (string, error) {
+	aead, err := identityCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(login), []byte(pseudonym))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openIdentity decrypts an identity sealed by sealIdentity.
+func openIdentity(pseudonym, sealed string) (string, error) {
+	aead, err := identityCipher()
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(b) < aead.NonceSize() {
+		return "", errors.New("sealed identity too short")
+	}
+	login, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(pseudonym))
+	if err != nil {
+		return "", err
+	}
+	return string(login), nil
+}
+
+// recordOwner returns the stored owner for login, first recording its
+// encrypted identity if it is pseudonymized.
+func recordOwner(login string) (string, error) {
+	owner := storedOwner(login)
+	if owner == login {
+		return owner, nil
+	}
+	sealed, err := sealIdentity(owner, login)
+	if err != nil {
+		return "", err
+	}
+	if err := db.SaveOwnerIdentity(owner, sealed); err != nil {
+		return "", err
+	}
+	return owner, nil
+}
+
+// ownerIdentity returns the login behind a stored owner, which is owner
+// itself unless it is pseudonymized.
+func ownerIdentity(owner string) (string, error) {
+	if !isPseudonym(owner) {
+		return owner, nil
+	}
+	if ownerKey == nil {
+		return "", errors.New("owner pseudonymization is not enabled")
+	}
+	sealed, err := db.LoadOwnerIdentity(owner)
+	if err != nil {
+		return "", err
+	}
+	return openIdentity(owner, sealed)
+}
+
+// linkOwnerExists is like userExists, but accepts pseudonymized owners.
+func linkOwnerExists(ctx context.Context, owner string) (bool, error) {
+	login, err := ownerIdentity(owner)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return userExists(ctx, login)
+}
+
+// pseudonymizeOwners replaces plaintext user owners of all links with their
+// pseudonyms. It is run at startup when --owner-key-file is set.
+func pseudonymizeOwners() error {
+	links, err := db.LoadAll()
+	if err != nil {
+		return err
+	}
+	done := make(map[string]bool)
+	for _, link := range links {
+		login := link.Owner
+		if done[login] || storedOwner(login) == login {
+			continue
+		}
+		done[login] = true
+		owner, err := recordOwner(login)
+		if err != nil {
+			return err
+		}
+		if _, err := db.RenameOwner(login, owner); err != nil {
+			return err
+		}
+	}
+	if len(done) > 0 {
+		log.Printf("pseudonymized owners of links for %d users", len(done))
+	}
+	return nil
+}
+
+// ownerLookup is the response of the /.owners lookup service.
+type ownerLookup struct {
+	Owner    string // value stored in Link.Owner
+	Identity string // user login
+}
+
+// serveOwnerLookup lets admins map between pseudonymized owners and the
+// identities behind them. Requests specify either an "owner" pseudonym to
+// reveal, or a "login" to find the pseudonym of.
+func serveOwnerLookup(w http.ResponseWriter, r *http.Request) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "owner lookup")
+		http.Error(w, "only admins can look up owners", http.StatusForbidden)
+		return
+	}
+	if ownerKey == nil {
+		http.Error(w, "owner pseudonymization is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var res ownerLookup
+	switch owner, login := r.FormValue("owner"), r.FormValue("login"); {
+	case owner != "":
+		res.Owner = owner
+		res.Identity, err = ownerIdentity(owner)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case login != "":
+		res.Owner, res.Identity = storedOwner(login), login
+	default:
+		http.Error(w, "owner or login required", http.StatusBadRequest)
+		return
+	}
+	log.Printf("owner lookup by %s: %s", cu.login, res.Owner)
+	audit(r, cu, "owner.lookup", "", res.Owner)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// parseOwnerKey parses the contents of --owner-key-file, ignoring
+// surrounding whitespace.
+func parseOwnerKey(b []byte) ([]byte, error) {
+	key := []byte(strings.TrimSpace(string(b)))
+	if len(key) < 16 {
+		return nil, fmt.Errorf("key must be at least 16 bytes, got %d", len(key))
+	}
+	return key, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoredOwner(t *testing.T) {
+	defer func(k []byte) { ownerKey = k }(ownerKey)
+
+	ownerKey = nil
+	if got := storedOwner("foo@example.com"); got != "foo@example.com" {
+		t.Errorf("storedOwner without key = %q; want unchanged", got)
+	}
+
+	ownerKey = []byte("0123456789abcdef")
+	got := storedOwner("foo@example.com")
+	if !isPseudonym(got) || strings.Contains(got, "foo") {
+		t.Errorf("storedOwner(%q) = %q; want pseudonym", "foo@example.com", got)
+	}
+	if again := storedOwner("Foo@Example.com"); again != got {
+		t.Errorf("storedOwner is not case insensitive: %q != %q", again, got)
+	}
+	if other := storedOwner("bar@example.com"); other == got {
+		t.Errorf("storedOwner returned %q for different users", got)
+	}
+	for _, owner := range []string{"", "team:sre", got} {
+		if s := storedOwner(owner); s != owner {
+			t.Errorf("storedOwner(%q) = %q; want unchanged", owner, s)
+		}
+	}
+}
+
+func TestSealIdentity(t *testing.T) {
+	defer func(k []byte) { ownerKey = k }(ownerKey)
+	ownerKey = []byte("0123456789abcdef")
+
+	owner := storedOwner("foo@example.com")
+	sealed, err := sealIdentity(owner, "foo@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := openIdentity(owner, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "foo@example.com" {
+		t.Errorf("openIdentity = %q; want %q", got, "foo@example.com")
+	}
+
+	// sealed identities are bound to their pseudonym
+	if _, err := openIdentity(storedOwner("bar@example.com"), sealed); err == nil {
+		t.Error("openIdentity with wrong pseudonym succeeded")
+	}
+	ownerKey = []byte("fedcba9876543210")
+	if _, err := openIdentity(owner, sealed); err == nil {
+		t.Error("openIdentity with wrong key succeeded")
+	}
+}
+
+func TestParseOwnerKey(t *testing.T) {
+	if _, err := parseOwnerKey([]byte("short\n")); err == nil {
+		t.Error("parseOwnerKey accepted short key")
+	}
+	key, err := parseOwnerKey([]byte("0123456789abcdef\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "0123456789abcdef" {
+		t.Errorf("parseOwnerKey = %q; want trimmed key", key)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ownerMap rewrites link owners when importing links, such as from a legacy
+// shortener that used a different identity domain. It is read from the file
+// given by --owner-map.
+type ownerMap struct {
+	logins  map[string]string // lowercase old login -> new owner
+	domains map[string]string // lowercase old domain -> new domain
+}
+
+// parseOwnerMap parses an owner mapping file. Each non-empty line that is not
+// a "#" comment maps an old owner to a new one, separated by whitespace:
+//
+//	alice@legacy.example.com  alice.smith@example.com
+//	@legacy.example.com       @example.com
+//
+// Lines starting with "@" rewrite the domain of any owner not mapped by an
+// exact login.
+func parseOwnerMap(r io.Reader) (*ownerMap, error) {
+	m := &ownerMap{
+		logins:  make(map[string]string),
+		domains: make(map[string]string),
+	}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want old and new owner, got %q", n, line)
+		}
+		from, to := strings.ToLower(fields[0]), fields[1]
+		if strings.HasPrefix(from, "@") != strings.HasPrefix(to, "@") {
+			return nil, fmt.Errorf("line %d: cannot map between a login and a domain", n)
+		}
+		if strings.HasPrefix(from, "@") {
+			m.domains[from[1:]] = to[1:]
+		} else {
+			m.logins[from] = to
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// remap returns the new owner for owner. Owners that are not mapped,
+// including team and group owners, are returned unchanged.
+func (m *ownerMap) remap(owner string) string {
+	if m == nil || owner == "" || strings.HasPrefix(owner, teamOwnerPrefix) || strings.HasPrefix(owner, groupOwnerPrefix) {
+		return owner
+	}
+	if to, ok := m.logins[strings.ToLower(owner)]; ok {
+		return to
+	}
+	if user, domain, ok := strings.Cut(owner, "@"); ok {
+		if to, ok := m.domains[strings.ToLower(domain)]; ok {
+			return user + "@" + to
+		}
+	}
+	return owner
+}
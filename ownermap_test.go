@@ -0,0 +1,82 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOwnerMap(t *testing.T) {
+	m, err := parseOwnerMap(strings.NewReader(`
+# legacy shortener identities
+Alice@legacy.example.com  alice.smith@example.com
+@Legacy.example.com       @example.com
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		owner string
+		want  string
+	}{
+		{"alice@legacy.example.com", "alice.smith@example.com"},
+		{"bob@legacy.example.com", "bob@example.com"},
+		{"bob@LEGACY.example.com", "bob@example.com"},
+		{"carol@example.com", "carol@example.com"},
+		{"team:eng", "team:eng"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := m.remap(tt.owner); got != tt.want {
+			t.Errorf("remap(%q) = %q; want %q", tt.owner, got, tt.want)
+		}
+	}
+
+	var nilMap *ownerMap
+	if got := nilMap.remap("alice@legacy.example.com"); got != "alice@legacy.example.com" {
+		t.Errorf("nil remap = %q; want unchanged", got)
+	}
+
+	for _, bad := range []string{"alice@legacy.example.com", "a b c", "@legacy.example.com bob@example.com"} {
+		if _, err := parseOwnerMap(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseOwnerMap(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestRestoreLastSnapshotOwners(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "kept", Long: "https://kept.example.com/", Owner: "carol@example.com"})
+
+	oldSnapshot, oldOwners := LastSnapshot, importOwners
+	t.Cleanup(func() { LastSnapshot, importOwners = oldSnapshot, oldOwners })
+	LastSnapshot = []byte(`{"Short": "wiki", "Long": "https://wiki.example.com/", "Owner": "bob@legacy.example.com"}
+{"Short": "kept", "Long": "https://changed.example.com/", "Owner": "bob@legacy.example.com"}
+`)
+	var err error
+	importOwners, err = parseOwnerMap(strings.NewReader("@legacy.example.com @example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreLastSnapshot(); err != nil {
+		t.Fatal(err)
+	}
+	link, err := db.Load("wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Owner != "bob@example.com" {
+		t.Errorf("restored owner = %q; want %q", link.Owner, "bob@example.com")
+	}
+	// links that already exist aren't overwritten
+	link, err = db.Load("kept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Long != "https://kept.example.com/" || link.Owner != "carol@example.com" {
+		t.Errorf("existing link restored as %q owned by %q", link.Long, link.Owner)
+	}
+}
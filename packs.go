@@ -0,0 +1,152 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// packsShortName is used as the short name for authorizing changes to
+	// starter packs.
+	packsShortName = ".packs"
+
+	// seenCookieName is set on the first visit to the home page, so that
+	// starter packs are only presented to first-time visitors.
+	seenCookieName = "golink_seen"
+)
+
+// validateCollection checks that c has a valid name and that its links are
+// valid short names without duplicates.
+func validateCollection(c *Collection) error {
+	if !reShortName.MatchString(c.Name) {
+		return errors.New("name may only contain letters, numbers, dash, and period")
+	}
+	seen := make(map[string]bool)
+	for _, l := range c.Links {
+		if !reShortName.MatchString(l.Short) {
+			return fmt.Errorf("invalid short name %q", l.Short)
+		}
+		id := linkID(l.Short)
+		if seen[id] {
+			return fmt.Errorf("duplicate link %q", l.Short)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// serveStarterPacks serves the starter packs API.
+//
+//	GET /.packs/        lists all packs in display order
+//	GET /.packs/{name}  returns a single pack
+//	POST /.packs/{name} creates or replaces a pack from a JSON request body (admins only)
+//	DELETE /.packs/{name} deletes a pack (admins only)
+func serveStarterPacks(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/.packs/")
+
+	switch r.Method {
+	case "GET":
+		packs, err := db.LoadCollections()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if name == "" {
+			enc.Encode(packs)
+			return
+		}
+		for _, p := range packs {
+			if linkID(p.Name) == linkID(name) {
+				enc.Encode(p)
+				return
+			}
+		}
+		http.NotFound(w, r)
+		return
+	case "POST", "DELETE":
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if name == "" {
+		http.Error(w, "pack name required", http.StatusBadRequest)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		http.Error(w, "only admins can change starter packs", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, packsShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if err := db.DeleteCollection(name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	pack := new(Collection)
+	if err := json.NewDecoder(r.Body).Decode(pack); err != nil {
+		http.Error(w, "invalid starter pack: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	pack.Name = name
+	if err := validateCollection(pack); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := db.SaveCollection(pack); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pack)
+}
+
+// firstVisitPacks returns the starter packs to present on the home page if
+// this is the user's first visit, and marks the user as having visited.
+func firstVisitPacks(w http.ResponseWriter, r *http.Request) []*Collection {
+	if _, err := r.Cookie(seenCookieName); err == nil {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     seenCookieName,
+		Value:    "1",
+		Path:     "/",
+		Expires:  time.Now().Add(5 * 365 * 24 * time.Hour),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	packs, err := db.LoadCollections()
+	if err != nil {
+		log.Printf("loading starter packs: %v", err)
+		return nil
+	}
+	return packs
+}
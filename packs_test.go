@@ -0,0 +1,41 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import "testing"
+
+func TestValidateCollection(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       *Collection
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			c:    &Collection{Name: "engineer", Links: []CollectionLink{{Short: "cs"}, {Short: "on-call"}}},
+		},
+		{
+			name:    "invalid name",
+			c:       &Collection{Name: "new hire"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid short",
+			c:       &Collection{Name: "engineer", Links: []CollectionLink{{Short: "a/b"}}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate normalized short",
+			c:       &Collection{Name: "engineer", Links: []CollectionLink{{Short: "oncall"}, {Short: "On-Call"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCollection(tt.c); (err != nil) != tt.wantErr {
+				t.Errorf("validateCollection() = %v; want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
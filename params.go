@@ -0,0 +1,111 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+)
+
+// paramRule is a template of query parameters appended to link targets,
+// such as "utm_source=golink&utm_content={{.Path}}".
+type paramRule struct {
+	text string
+	tmpl *texttemplate.Template
+}
+
+// tagParams holds the parameter rules for links with each tag, from
+// --tag-params, keyed by tag.
+var tagParams map[string]paramRule
+
+// parseTagParams parses semicolon-separated tag=params rules, such as
+// "marketing=utm_source=golink&utm_medium=internal;docs=src=go".
+func parseTagParams(s string) (map[string]paramRule, error) {
+	rules := make(map[string]paramRule)
+	for _, rule := range strings.Split(s, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		tag, params, ok := strings.Cut(rule, "=")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		params = strings.TrimSpace(params)
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("invalid tag params %q: want tag=params", rule)
+		}
+		tmpl, err := parseLinkTemplate(params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid params for tag %q: %w", tag, err)
+		}
+		rules[tag] = paramRule{text: params, tmpl: tmpl}
+	}
+	return rules, nil
+}
+
+// paramsUseUser reports whether the params appended to link's target use
+// the current user.
+func paramsUseUser(link *Link) bool {
+	if usesUser(link.Params) {
+		return true
+	}
+	for _, tag := range link.Tags {
+		if usesUser(tagParams[tag].text) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendParams adds the query parameters from link's Params, followed by
+// the --tag-params rules for its tags, to target. A parameter already in
+// target, from the destination or from the request, is never replaced, so
+// the link's own params take precedence over those of its tags.
+// Only http and https targets are changed.
+func appendParams(link *Link, target *url.URL, env expandEnv) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return nil
+	}
+	var tmpls []*texttemplate.Template
+	if link.Params != "" {
+		tmpl, err := linkTemplates.get(link, link.Params)
+		if err != nil {
+			return err
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	for _, tag := range link.Tags {
+		if rule, ok := tagParams[tag]; ok {
+			tmpls = append(tmpls, rule.tmpl)
+		}
+	}
+	if len(tmpls) == 0 {
+		return nil
+	}
+
+	query := target.Query()
+	added := false
+	for _, tmpl := range tmpls {
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, env); err != nil {
+			return err
+		}
+		params, err := url.ParseQuery(buf.String())
+		if err != nil {
+			return fmt.Errorf("parsing params: %w", err)
+		}
+		for key, values := range params {
+			if !query.Has(key) {
+				query[key] = values
+				added = true
+			}
+		}
+	}
+	if added {
+		target.RawQuery = query.Encode()
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAppendParams(t *testing.T) {
+	oldParams := tagParams
+	defer func() { tagParams = oldParams }()
+	var err error
+	tagParams, err = parseTagParams("marketing=utm_source=golink&utm_medium=internal; docs = src={{.User}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		link   *Link
+		target string
+		want   string
+	}{
+		{
+			name:   "no params",
+			link:   &Link{Short: "a"},
+			target: "https://example.com/?q=1",
+			want:   "https://example.com/?q=1",
+		},
+		{
+			name:   "link params",
+			link:   &Link{Short: "a", Params: "utm_source=golink&utm_content={{.Path}}"},
+			target: "https://example.com/",
+			want:   "https://example.com/?utm_content=p&utm_source=golink",
+		},
+		{
+			name:   "existing params are kept",
+			link:   &Link{Short: "a", Params: "utm_source=golink"},
+			target: "https://example.com/?utm_source=email",
+			want:   "https://example.com/?utm_source=email",
+		},
+		{
+			name:   "tag params",
+			link:   &Link{Short: "a", Tags: []string{"docs", "marketing"}},
+			target: "https://example.com/",
+			want:   "https://example.com/?src=foo%40example.com&utm_medium=internal&utm_source=golink",
+		},
+		{
+			name:   "link params take precedence over tags",
+			link:   &Link{Short: "a", Params: "utm_source=launch", Tags: []string{"marketing"}},
+			target: "https://example.com/",
+			want:   "https://example.com/?utm_medium=internal&utm_source=launch",
+		},
+		{
+			name:   "non-web targets are unchanged",
+			link:   &Link{Short: "a", Params: "utm_source=golink"},
+			target: "mailto:team@example.com",
+			want:   "mailto:team@example.com",
+		},
+	}
+	env := expandEnv{Path: "p", user: "foo@example.com"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := appendParams(tt.link, u, env); err != nil {
+				t.Fatal(err)
+			}
+			if got := u.String(); got != tt.want {
+				t.Errorf("appendParams = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagParams(t *testing.T) {
+	for _, s := range []string{"marketing", "=utm_source=golink", "docs=src={{.Bad"} {
+		if _, err := parseTagParams(s); err == nil {
+			t.Errorf("parseTagParams(%q) succeeded; want error", s)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+)
+
+// groupOwnerPrefix begins a co-owner naming a tailnet group, such as
+// "group:sre", whose members may edit the link. Tailscale doesn't tell golink
+// which groups a user is in, so each group is granted its own name with the
+// "groups" field of the tailscale.com/cap/golink capability.
+const groupOwnerPrefix = "group:"
+
+// protectedLinks are the patterns of links that only admins may create,
+// edit, or delete, from --protected-links.
+var protectedLinks []string
+
+// parseLinkPatterns parses a comma-separated list of link patterns, which
+// are short names, or prefixes of short names ending in "*", such as
+// "wiki,eng.*".
+func parseLinkPatterns(s string) ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if name := strings.TrimSuffix(p, "*"); name != "" && !reShortName.MatchString(name) {
+			return nil, fmt.Errorf("invalid link pattern %q", p)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// matchLinkPattern reports whether the link short matches pattern. Names
+// are compared by link ID.
+func matchLinkPattern(pattern, short string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(linkID(short), linkID(prefix))
+	}
+	return linkID(short) == linkID(pattern)
+}
+
+// isProtectedLink reports whether short matches --protected-links.
+func isProtectedLink(short string) bool {
+	return slices.ContainsFunc(protectedLinks, func(p string) bool { return matchLinkPattern(p, short) })
+}
+
+// linkPolicy decides what users may do. Handlers ask authz rather than
+// checking ownership or admin status themselves, so that the rules are kept
+// in one place.
+type linkPolicy struct {
+	// readonly reports whether golink is in read-only mode.
+	readonly func() bool
+
+	// teamMember reports whether login is a member of the named team.
+	teamMember func(team, login string) bool
+
+	// ownerExists reports whether a stored link owner is an active user.
+	ownerExists func(ctx context.Context, owner string) (bool, error)
+
+	// protected reports whether only admins may change the link short.
+	protected func(short string) bool
+}
+
+// authz is the policy used by handlers.
+var authz = linkPolicy{
+	readonly:    func() bool { return *readonly },
+	teamMember:  isTeamMember,
+	ownerExists: linkOwnerExists,
+	protected:   isProtectedLink,
+}
+
+// canAdmin reports whether u may perform administrative actions, such as
+// merging links or changing starter packs.
+func (p linkPolicy) canAdmin(u user) bool {
+	return u.isAdmin
+}
+
+// canCreate reports whether u may create a new link named short, which is
+// empty if golink generates the name. Only admins may create protected links.
+func (p linkPolicy) canCreate(ctx context.Context, u user, short string) bool {
+	if p.readonly() {
+		return false
+	}
+	return short == "" || !p.protected(short) || p.canAdmin(u)
+}
+
+// canEdit reports whether u may edit link, which is nil for new links.
+// Admin users can edit all links, and are the only users who can edit
+// protected links.
+// Non-admin users can only edit links they own or co-own, either themselves
+// or through a team or group they are a member of or a team whose ACL tags
+// act for, links they are granted, or links without an active owner.
+func (p linkPolicy) canEdit(ctx context.Context, u user, link *Link) bool {
+	if p.readonly() {
+		return false
+	}
+	if p.canAdmin(u) {
+		return true
+	}
+	if link != nil && p.protected(link.Short) {
+		return false
+	}
+	if link == nil || link.Owner == "" {
+		// new or unowned link
+		return true
+	}
+
+	if p.isOwner(u, link.Owner) || p.isGranted(u, link.Short) {
+		return true
+	}
+	for _, owner := range link.CoOwners {
+		if p.isOwner(u, owner) {
+			return true
+		}
+	}
+
+	owned, err := p.ownerExists(ctx, link.Owner)
+	if err != nil {
+		log.Printf("looking up tailnet user %q: %v", link.Owner, err)
+	}
+	// Allow editing if the link is currently unowned
+	return err == nil && !owned
+}
+
+// isOwner reports whether u is the stored owner, either as that user or as
+// a member of that team or group.
+func (p linkPolicy) isOwner(u user, owner string) bool {
+	if u.login != "" && owner == storedOwner(u.login) {
+		return true
+	}
+	if strings.HasPrefix(owner, groupOwnerPrefix) {
+		return slices.Contains(u.groups, owner)
+	}
+	name, ok := strings.CutPrefix(owner, teamOwnerPrefix)
+	return ok && (p.teamMember(name, u.login) || actsForTeam(u, name))
+}
+
+// isGranted reports whether u is granted the link short, and so may edit it
+// as if they owned it, by a pattern in the "edit" field of the
+// tailscale.com/cap/golink capability.
+func (p linkPolicy) isGranted(u user, short string) bool {
+	return slices.ContainsFunc(u.grants, func(pattern string) bool { return matchLinkPattern(pattern, short) })
+}
+
+// canReclaim reports whether u may create a link in place of one recently
+// deleted by deletion, the revision recording its deletion. Only admins, the
+// deleted link's owner, and whoever deleted it may, so that a popular link
+// can't be taken over as soon as it is deleted.
+func (p linkPolicy) canReclaim(u user, deletion *LinkRevision) bool {
+	return p.canAdmin(u) || deletion.Owner == "" || p.isOwner(u, deletion.Owner) || p.isOwner(u, deletion.Editor)
+}
+
+// canDelete reports whether u may delete link.
+func (p linkPolicy) canDelete(ctx context.Context, u user, link *Link) bool {
+	return link != nil && p.canEdit(ctx, u, link)
+}
+
+// canExportTeam reports whether u may export the links of the named team:
+// admins, and members of the team or devices whose ACL tags act for it.
+func (p linkPolicy) canExportTeam(u user, team string) bool {
+	return p.canAdmin(u) || p.isOwner(u, teamOwnerPrefix+team)
+}
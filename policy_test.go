@@ -0,0 +1,206 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestLinkPolicy(t *testing.T) {
+	var (
+		admin   = user{login: "admin@example.com", isAdmin: true}
+		owner   = user{login: "owner@example.com"}
+		member  = user{login: "member@example.com"}
+		other   = user{login: "other@example.com"}
+		ci      = user{login: "tagged-devices", tags: []string{"tag:ci"}}
+		build   = user{login: "tagged-devices", tags: []string{"tag:build"}}
+		oncall  = user{login: "oncall@example.com", groups: []string{"group:oncall"}}
+		granted = user{login: "granted@example.com", grants: []string{"eng.*", "wiki"}}
+		unknown = user{}
+	)
+	var (
+		newLink      *Link
+		unowned      = &Link{Short: "unowned"}
+		owned        = &Link{Short: "owned", Owner: "owner@example.com"}
+		teamOwned    = &Link{Short: "team", Owner: "team:sre"}
+		departed     = &Link{Short: "departed", Owner: "gone@example.com"}
+		lookupFailed = &Link{Short: "lookup", Owner: "broken@example.com"}
+		coOwned      = &Link{Short: "shared", Owner: "owner@example.com", CoOwners: []string{"other@example.com"}}
+		teamCoOwned  = &Link{Short: "shared-team", Owner: "owner@example.com", CoOwners: []string{"team:sre"}}
+		groupCoOwned = &Link{Short: "shared-group", Owner: "owner@example.com", CoOwners: []string{"group:oncall"}}
+		engLink      = &Link{Short: "eng.docs", Owner: "owner@example.com"}
+		wiki         = &Link{Short: "Wiki", Owner: "owner@example.com"}
+		protected    = &Link{Short: "go", Owner: "owner@example.com"}
+		protectedNS  = &Link{Short: "hr.payroll", Owner: "owner@example.com", CoOwners: []string{"other@example.com"}}
+		unownedProt  = &Link{Short: "hr.unowned"}
+	)
+	policy := func(readonly bool) linkPolicy {
+		return linkPolicy{
+			readonly: func() bool { return readonly },
+			teamMember: func(team, login string) bool {
+				return team == "sre" && login == member.login
+			},
+			ownerExists: func(ctx context.Context, owner string) (bool, error) {
+				switch owner {
+				case "gone@example.com":
+					return false, nil
+				case "broken@example.com":
+					return false, errors.New("lookup failed")
+				}
+				return true, nil
+			},
+			protected: func(short string) bool {
+				return matchLinkPattern("go", short) || matchLinkPattern("hr.*", short)
+			},
+		}
+	}
+
+	oldTagTeams := tagTeams
+	t.Cleanup(func() { tagTeams = oldTagTeams })
+	tagTeams = map[string]string{"tag:ci": "SRE"}
+
+	tests := []struct {
+		name       string
+		readonly   bool
+		user       user
+		link       *Link
+		wantEdit   bool
+		wantDelete bool
+	}{
+		{"admin edits owned", false, admin, owned, true, true},
+		{"admin edits team", false, admin, teamOwned, true, true},
+		{"owner edits own", false, owner, owned, true, true},
+		{"other cannot edit owned", false, other, owned, false, false},
+		{"unknown cannot edit owned", false, unknown, owned, false, false},
+		{"member edits team", false, member, teamOwned, true, true},
+		{"non-member cannot edit team", false, other, teamOwned, false, false},
+		{"tagged node edits its team", false, ci, teamOwned, true, true},
+		{"other tag cannot edit team", false, build, teamOwned, false, false},
+		{"co-owner edits shared", false, other, coOwned, true, true},
+		{"non-co-owner cannot edit shared", false, member, coOwned, false, false},
+		{"team member co-owner edits shared", false, member, teamCoOwned, true, true},
+		{"non-member cannot edit team co-owned", false, other, teamCoOwned, false, false},
+		{"readonly denies co-owner", true, other, coOwned, false, false},
+		{"anyone edits unowned", false, other, unowned, true, true},
+		{"anyone edits departed owner", false, other, departed, true, true},
+		{"lookup failure denies", false, other, lookupFailed, false, false},
+		{"new link editable", false, other, newLink, true, false},
+		{"readonly denies admin", true, admin, owned, false, false},
+		{"readonly denies owner", true, owner, owned, false, false},
+		{"readonly denies unowned", true, other, unowned, false, false},
+		{"group member co-owner edits shared", false, oncall, groupCoOwned, true, true},
+		{"non-member cannot edit group co-owned", false, other, groupCoOwned, false, false},
+		{"grant prefix edits", false, granted, engLink, true, true},
+		{"grant name edits", false, granted, wiki, true, true},
+		{"grant does not extend", false, granted, owned, false, false},
+		{"readonly denies grant", true, granted, engLink, false, false},
+		{"admin edits protected", false, admin, protected, true, true},
+		{"owner cannot edit protected", false, owner, protected, false, false},
+		{"co-owner cannot edit protected", false, other, protectedNS, false, false},
+		{"anyone cannot edit unowned protected", false, other, unownedProt, false, false},
+		{"readonly denies admin protected", true, admin, protected, false, false},
+	}
+	ctx := context.Background()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := policy(tt.readonly)
+			if got := p.canEdit(ctx, tt.user, tt.link); got != tt.wantEdit {
+				t.Errorf("canEdit = %v; want %v", got, tt.wantEdit)
+			}
+			if got := p.canDelete(ctx, tt.user, tt.link); got != tt.wantDelete {
+				t.Errorf("canDelete = %v; want %v", got, tt.wantDelete)
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		readonly bool
+		user     user
+		short    string
+		want     bool
+	}{
+		{false, other, "new", true},
+		{false, unknown, "new", true},
+		{true, admin, "new", false},
+		{false, other, "", true},
+		{false, other, "GO", false},
+		{false, granted, "hr.new", false},
+		{false, admin, "hr.new", true},
+		{true, admin, "hr.new", false},
+	} {
+		if got := policy(tt.readonly).canCreate(ctx, tt.user, tt.short); got != tt.want {
+			t.Errorf("canCreate(readonly=%v, %q, %q) = %v; want %v", tt.readonly, tt.user.login, tt.short, got, tt.want)
+		}
+	}
+
+	deleted := &LinkRevision{Short: "owned", Owner: "owner@example.com", Editor: "admin@example.com", Deleted: true}
+	teamDeleted := &LinkRevision{Short: "team", Owner: "team:sre", Deleted: true}
+	unownedDeleted := &LinkRevision{Short: "unowned", Deleted: true}
+	for _, tt := range []struct {
+		user     user
+		deletion *LinkRevision
+		want     bool
+	}{
+		{owner, deleted, true},
+		{admin, deleted, true},
+		{other, deleted, false},
+		{unknown, deleted, false},
+		{member, teamDeleted, true},
+		{ci, teamDeleted, true},
+		{other, teamDeleted, false},
+		{other, unownedDeleted, true},
+		{other, &LinkRevision{Owner: "owner@example.com", Editor: "other@example.com", Deleted: true}, true},
+	} {
+		if got := policy(false).canReclaim(tt.user, tt.deletion); got != tt.want {
+			t.Errorf("canReclaim(%q, owner %q) = %v; want %v", tt.user.login, tt.deletion.Owner, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		user user
+		want bool
+	}{
+		{admin, true},
+		{member, true},
+		{ci, true},
+		{build, false},
+		{owner, false},
+		{unknown, false},
+	} {
+		if got := policy(false).canExportTeam(tt.user, "sre"); got != tt.want {
+			t.Errorf("canExportTeam(%q, %v) = %v; want %v", tt.user.login, tt.user.tags, got, tt.want)
+		}
+	}
+
+	p := policy(false)
+	if !p.canAdmin(admin) || p.canAdmin(owner) || p.canAdmin(unknown) {
+		t.Error("canAdmin should only allow admins")
+	}
+}
+
+func TestParseLinkPatterns(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "wiki, eng.*,", want: []string{"wiki", "eng.*"}},
+		{in: "*", want: []string{"*"}},
+		{in: "a/b", wantErr: true},
+		{in: "eng*.x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseLinkPatterns(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseLinkPatterns(%q) returned error %v; want %v", tt.in, err, tt.wantErr)
+		}
+		if !tt.wantErr && !slices.Equal(got, tt.want) {
+			t.Errorf("parseLinkPatterns(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// probeTimeout limits each probe request, including connecting and the TLS
+// handshake.
+const probeTimeout = 10 * time.Second
+
+// probeTarget is a listener that the probe job resolves the canary link
+// through, as users would.
+type probeTarget struct {
+	name   string // such as "https" or "public"
+	base   string // URL of the listener, such as "https://go.example.ts.net"
+	client *http.Client
+}
+
+var (
+	probeMu      sync.Mutex
+	probeTargets []probeTarget
+)
+
+// addProbeTarget registers a listener for the probe job, once it is serving.
+// The client's redirect policy and timeout are replaced.
+func addProbeTarget(name, base string, client *http.Client) {
+	c := *client
+	c.Timeout = probeTimeout
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	probeTargets = append(probeTargets, probeTarget{name: name, base: base, client: &c})
+}
+
+// probeWant returns the destination that resolving short with no extra path
+// or query should redirect to, or "" if it depends on the user.
+func probeWant(short string) (string, error) {
+	link, err := loadLink(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("canary link %q does not exist; create it, or change --probe-link", short)
+	}
+	if err != nil {
+		return "", err
+	}
+	if link.MaxUses > 0 {
+		return "", fmt.Errorf("canary link %q is a one-time link, which probes would use up", short)
+	}
+	env := expandEnv{Now: time.Now().UTC()}
+	target, err := expandLinkTarget(link, resolveTarget(link), env)
+	if err == nil {
+		err = appendParams(link, target, env)
+	}
+	if errors.Is(err, errNoUser) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return target.String(), nil
+}
+
+// probe resolves short through t, checking that it redirects to want, if
+// non-empty.
+func (t probeTarget) probe(ctx context.Context, short, want string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.base+"/"+url.PathEscape(short), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound && resp.StatusCode != http.StatusMovedPermanently {
+		return fmt.Errorf("got %s, want a redirect", resp.Status)
+	}
+	if got := resp.Header.Get("Location"); want != "" && got != want {
+		return fmt.Errorf("redirected to %q, want %q", got, want)
+	}
+	return nil
+}
+
+// runProbes resolves the canary link short through every probe target,
+// recording the outcome and latency of each in the probe metrics.
+func runProbes(ctx context.Context, short string) error {
+	want, err := probeWant(short)
+	if err != nil {
+		return err
+	}
+	probeMu.Lock()
+	targets := probeTargets
+	probeMu.Unlock()
+
+	var errs []error
+	for _, t := range targets {
+		start := time.Now()
+		err := t.probe(ctx, short, want)
+		probeSeconds.observe(t.name, start)
+		probes.Add(t.name, 1)
+		if err != nil {
+			probeFailures.Add(t.name, 1)
+			log.Printf("probe of %s/%s failed: %v", t.base, short, err)
+			errs = append(errs, fmt.Errorf("%s: %w", t.base, err))
+		}
+	}
+	return errors.Join(errs...)
+}
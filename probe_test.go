@@ -0,0 +1,59 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProbeTarget(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/canary":
+			w.Header().Set("Location", "https://example.com/")
+			w.WriteHeader(http.StatusFound)
+		case "/moved":
+			w.Header().Set("Location", "https://other.example.com/")
+			w.WriteHeader(http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	probeTargets = nil
+	defer func() { probeTargets = nil }()
+	addProbeTarget("https", srv.URL, srv.Client())
+	target := probeTargets[0]
+
+	ctx := context.Background()
+	tests := []struct {
+		short, want string
+		wantErr     string
+	}{
+		{short: "canary", want: "https://example.com/"},
+		{short: "canary"}, // destination depends on the user
+		{short: "moved", want: "https://example.com/", wantErr: "redirected to"},
+		{short: "missing", want: "https://example.com/", wantErr: "404"},
+	}
+	for _, tt := range tests {
+		err := target.probe(ctx, tt.short, tt.want)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("probe(%q, %q) = %v; want success", tt.short, tt.want, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("probe(%q, %q) = %v; want error containing %q", tt.short, tt.want, err, tt.wantErr)
+		}
+	}
+
+	// an untrusted certificate fails the probe
+	addProbeTarget("public", srv.URL, http.DefaultClient)
+	if err := probeTargets[1].probe(ctx, "canary", ""); err == nil {
+		t.Error("probe with an untrusted certificate succeeded")
+	}
+}
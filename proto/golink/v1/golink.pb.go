@@ -0,0 +1,1198 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The golink.v1 service mirrors the JSON links API at /.api/v1/links and
+// /.api/v1/resolve (see api.go), with the same authorization and token
+// scopes. It is served on --grpc-listen (see grpc.go).
+//
+// After editing this file, regenerate golink.pb.go and golink_grpc.pb.go
+// with protoc-gen-go and protoc-gen-go-grpc.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: golink/v1/golink.proto
+
+package golinkv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Link is a short link, with the fields of the JSON Link object.
+type Link struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Short             string                 `protobuf:"bytes,1,opt,name=short,proto3" json:"short,omitempty"`
+	Long              string                 `protobuf:"bytes,2,opt,name=long,proto3" json:"long,omitempty"`
+	Owner             string                 `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	Created           *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=created,proto3" json:"created,omitempty"`
+	LastEdit          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=last_edit,json=lastEdit,proto3" json:"last_edit,omitempty"`
+	Tags              []string               `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	CoOwners          []string               `protobuf:"bytes,7,rep,name=co_owners,json=coOwners,proto3" json:"co_owners,omitempty"`
+	Fallbacks         []string               `protobuf:"bytes,8,rep,name=fallbacks,proto3" json:"fallbacks,omitempty"`
+	MaintenanceTarget string                 `protobuf:"bytes,9,opt,name=maintenance_target,json=maintenanceTarget,proto3" json:"maintenance_target,omitempty"`
+	Successor         string                 `protobuf:"bytes,10,opt,name=successor,proto3" json:"successor,omitempty"`
+	Deprecated        *timestamppb.Timestamp `protobuf:"bytes,11,opt,name=deprecated,proto3" json:"deprecated,omitempty"`
+	Expires           *timestamppb.Timestamp `protobuf:"bytes,12,opt,name=expires,proto3" json:"expires,omitempty"`
+	Headers           map[string]string      `protobuf:"bytes,13,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Params            string                 `protobuf:"bytes,14,opt,name=params,proto3" json:"params,omitempty"`
+	MaxUses           int32                  `protobuf:"varint,15,opt,name=max_uses,json=maxUses,proto3" json:"max_uses,omitempty"`
+	Uses              int32                  `protobuf:"varint,16,opt,name=uses,proto3" json:"uses,omitempty"`
+	Version           int32                  `protobuf:"varint,17,opt,name=version,proto3" json:"version,omitempty"`
+	AutoCreated       bool                   `protobuf:"varint,18,opt,name=auto_created,json=autoCreated,proto3" json:"auto_created,omitempty"`
+	HealthCheck       string                 `protobuf:"bytes,19,opt,name=health_check,json=healthCheck,proto3" json:"health_check,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Link) Reset() {
+	*x = Link{}
+	mi := &file_golink_v1_golink_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Link) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Link) ProtoMessage() {}
+
+func (x *Link) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Link.ProtoReflect.Descriptor instead.
+func (*Link) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Link) GetShort() string {
+	if x != nil {
+		return x.Short
+	}
+	return ""
+}
+
+func (x *Link) GetLong() string {
+	if x != nil {
+		return x.Long
+	}
+	return ""
+}
+
+func (x *Link) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Link) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *Link) GetLastEdit() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastEdit
+	}
+	return nil
+}
+
+func (x *Link) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Link) GetCoOwners() []string {
+	if x != nil {
+		return x.CoOwners
+	}
+	return nil
+}
+
+func (x *Link) GetFallbacks() []string {
+	if x != nil {
+		return x.Fallbacks
+	}
+	return nil
+}
+
+func (x *Link) GetMaintenanceTarget() string {
+	if x != nil {
+		return x.MaintenanceTarget
+	}
+	return ""
+}
+
+func (x *Link) GetSuccessor() string {
+	if x != nil {
+		return x.Successor
+	}
+	return ""
+}
+
+func (x *Link) GetDeprecated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Deprecated
+	}
+	return nil
+}
+
+func (x *Link) GetExpires() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Expires
+	}
+	return nil
+}
+
+func (x *Link) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *Link) GetParams() string {
+	if x != nil {
+		return x.Params
+	}
+	return ""
+}
+
+func (x *Link) GetMaxUses() int32 {
+	if x != nil {
+		return x.MaxUses
+	}
+	return 0
+}
+
+func (x *Link) GetUses() int32 {
+	if x != nil {
+		return x.Uses
+	}
+	return 0
+}
+
+func (x *Link) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Link) GetAutoCreated() bool {
+	if x != nil {
+		return x.AutoCreated
+	}
+	return false
+}
+
+func (x *Link) GetHealthCheck() string {
+	if x != nil {
+		return x.HealthCheck
+	}
+	return ""
+}
+
+type ResolveLinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Short         string                 `protobuf:"bytes,1,opt,name=short,proto3" json:"short,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`   // the part of the request path after the short name
+	Query         string                 `protobuf:"bytes,3,opt,name=query,proto3" json:"query,omitempty"` // the request's query string
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveLinkRequest) Reset() {
+	*x = ResolveLinkRequest{}
+	mi := &file_golink_v1_golink_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveLinkRequest) ProtoMessage() {}
+
+func (x *ResolveLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveLinkRequest.ProtoReflect.Descriptor instead.
+func (*ResolveLinkRequest) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ResolveLinkRequest) GetShort() string {
+	if x != nil {
+		return x.Short
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ResolveLinkRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+type ResolveLinkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResolveLinkResponse) Reset() {
+	*x = ResolveLinkResponse{}
+	mi := &file_golink_v1_golink_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResolveLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResolveLinkResponse) ProtoMessage() {}
+
+func (x *ResolveLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResolveLinkResponse.ProtoReflect.Descriptor instead.
+func (*ResolveLinkResponse) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ResolveLinkResponse) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type GetLinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Short         string                 `protobuf:"bytes,1,opt,name=short,proto3" json:"short,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetLinkRequest) Reset() {
+	*x = GetLinkRequest{}
+	mi := &file_golink_v1_golink_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetLinkRequest) ProtoMessage() {}
+
+func (x *GetLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetLinkRequest.ProtoReflect.Descriptor instead.
+func (*GetLinkRequest) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetLinkRequest) GetShort() string {
+	if x != nil {
+		return x.Short
+	}
+	return ""
+}
+
+type ListLinksRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Q             string                 `protobuf:"bytes,1,opt,name=q,proto3" json:"q,omitempty"`           // a search query, as in the UI
+	Health        string                 `protobuf:"bytes,2,opt,name=health,proto3" json:"health,omitempty"` // "broken" to list only broken links
+	Sort          string                 `protobuf:"bytes,3,opt,name=sort,proto3" json:"sort,omitempty"`     // "short" (the default) or "score"
+	Limit         int32                  `protobuf:"varint,4,opt,name=limit,proto3" json:"limit,omitempty"`  // at most maxAPIPageSize
+	After         string                 `protobuf:"bytes,5,opt,name=after,proto3" json:"after,omitempty"`   // the short name to list after, from next_after
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLinksRequest) Reset() {
+	*x = ListLinksRequest{}
+	mi := &file_golink_v1_golink_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLinksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLinksRequest) ProtoMessage() {}
+
+func (x *ListLinksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLinksRequest.ProtoReflect.Descriptor instead.
+func (*ListLinksRequest) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListLinksRequest) GetQ() string {
+	if x != nil {
+		return x.Q
+	}
+	return ""
+}
+
+func (x *ListLinksRequest) GetHealth() string {
+	if x != nil {
+		return x.Health
+	}
+	return ""
+}
+
+func (x *ListLinksRequest) GetSort() string {
+	if x != nil {
+		return x.Sort
+	}
+	return ""
+}
+
+func (x *ListLinksRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListLinksRequest) GetAfter() string {
+	if x != nil {
+		return x.After
+	}
+	return ""
+}
+
+type ListLinksResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Links         []*Link                `protobuf:"bytes,1,rep,name=links,proto3" json:"links,omitempty"`
+	NextAfter     string                 `protobuf:"bytes,2,opt,name=next_after,json=nextAfter,proto3" json:"next_after,omitempty"` // set if there are more links
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListLinksResponse) Reset() {
+	*x = ListLinksResponse{}
+	mi := &file_golink_v1_golink_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListLinksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListLinksResponse) ProtoMessage() {}
+
+func (x *ListLinksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListLinksResponse.ProtoReflect.Descriptor instead.
+func (*ListLinksResponse) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListLinksResponse) GetLinks() []*Link {
+	if x != nil {
+		return x.Links
+	}
+	return nil
+}
+
+func (x *ListLinksResponse) GetNextAfter() string {
+	if x != nil {
+		return x.NextAfter
+	}
+	return ""
+}
+
+// PutLinkRequest is the same as the JSON apiLinkRequest: fields that are
+// not set are left unchanged when updating a link.
+type PutLinkRequest struct {
+	state             protoimpl.MessageState  `protogen:"open.v1"`
+	Short             string                  `protobuf:"bytes,1,opt,name=short,proto3" json:"short,omitempty"`
+	Long              string                  `protobuf:"bytes,2,opt,name=long,proto3" json:"long,omitempty"`
+	Owner             string                  `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	Tags              *PutLinkRequest_Strings `protobuf:"bytes,4,opt,name=tags,proto3" json:"tags,omitempty"`
+	CoOwners          *PutLinkRequest_Strings `protobuf:"bytes,5,opt,name=co_owners,json=coOwners,proto3" json:"co_owners,omitempty"`
+	Fallbacks         *PutLinkRequest_Strings `protobuf:"bytes,6,opt,name=fallbacks,proto3" json:"fallbacks,omitempty"`
+	MaintenanceTarget *string                 `protobuf:"bytes,7,opt,name=maintenance_target,json=maintenanceTarget,proto3,oneof" json:"maintenance_target,omitempty"`
+	Successor         *string                 `protobuf:"bytes,8,opt,name=successor,proto3,oneof" json:"successor,omitempty"`
+	Headers           *PutLinkRequest_Headers `protobuf:"bytes,9,opt,name=headers,proto3" json:"headers,omitempty"`
+	Params            *string                 `protobuf:"bytes,10,opt,name=params,proto3,oneof" json:"params,omitempty"`
+	MaxUses           *int32                  `protobuf:"varint,11,opt,name=max_uses,json=maxUses,proto3,oneof" json:"max_uses,omitempty"`
+	Expires           *string                 `protobuf:"bytes,12,opt,name=expires,proto3,oneof" json:"expires,omitempty"` // as accepted by the JSON API, or "" to never expire
+	Version           int32                   `protobuf:"varint,13,opt,name=version,proto3" json:"version,omitempty"`      // if set, the update fails unless the link is at this version
+	IdempotencyKey    string                  `protobuf:"bytes,14,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	HealthCheck       *string                 `protobuf:"bytes,15,opt,name=health_check,json=healthCheck,proto3,oneof" json:"health_check,omitempty"` // "off", or "status=NNN" and "auth=NAME"
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *PutLinkRequest) Reset() {
+	*x = PutLinkRequest{}
+	mi := &file_golink_v1_golink_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutLinkRequest) ProtoMessage() {}
+
+func (x *PutLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutLinkRequest.ProtoReflect.Descriptor instead.
+func (*PutLinkRequest) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PutLinkRequest) GetShort() string {
+	if x != nil {
+		return x.Short
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetLong() string {
+	if x != nil {
+		return x.Long
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetTags() *PutLinkRequest_Strings {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *PutLinkRequest) GetCoOwners() *PutLinkRequest_Strings {
+	if x != nil {
+		return x.CoOwners
+	}
+	return nil
+}
+
+func (x *PutLinkRequest) GetFallbacks() *PutLinkRequest_Strings {
+	if x != nil {
+		return x.Fallbacks
+	}
+	return nil
+}
+
+func (x *PutLinkRequest) GetMaintenanceTarget() string {
+	if x != nil && x.MaintenanceTarget != nil {
+		return *x.MaintenanceTarget
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetSuccessor() string {
+	if x != nil && x.Successor != nil {
+		return *x.Successor
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetHeaders() *PutLinkRequest_Headers {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *PutLinkRequest) GetParams() string {
+	if x != nil && x.Params != nil {
+		return *x.Params
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetMaxUses() int32 {
+	if x != nil && x.MaxUses != nil {
+		return *x.MaxUses
+	}
+	return 0
+}
+
+func (x *PutLinkRequest) GetExpires() string {
+	if x != nil && x.Expires != nil {
+		return *x.Expires
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetVersion() int32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *PutLinkRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+func (x *PutLinkRequest) GetHealthCheck() string {
+	if x != nil && x.HealthCheck != nil {
+		return *x.HealthCheck
+	}
+	return ""
+}
+
+type DeleteLinkRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Short         string                 `protobuf:"bytes,1,opt,name=short,proto3" json:"short,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLinkRequest) Reset() {
+	*x = DeleteLinkRequest{}
+	mi := &file_golink_v1_golink_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLinkRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLinkRequest) ProtoMessage() {}
+
+func (x *DeleteLinkRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLinkRequest.ProtoReflect.Descriptor instead.
+func (*DeleteLinkRequest) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DeleteLinkRequest) GetShort() string {
+	if x != nil {
+		return x.Short
+	}
+	return ""
+}
+
+type DeleteLinkResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteLinkResponse) Reset() {
+	*x = DeleteLinkResponse{}
+	mi := &file_golink_v1_golink_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteLinkResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteLinkResponse) ProtoMessage() {}
+
+func (x *DeleteLinkResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteLinkResponse.ProtoReflect.Descriptor instead.
+func (*DeleteLinkResponse) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{8}
+}
+
+type GetStatsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Short         string                 `protobuf:"bytes,1,opt,name=short,proto3" json:"short,omitempty"`
+	By            string                 `protobuf:"bytes,2,opt,name=by,proto3" json:"by,omitempty"` // "path", "referrer", or "day"
+	Days          int32                  `protobuf:"varint,3,opt,name=days,proto3" json:"days,omitempty"`
+	Tz            string                 `protobuf:"bytes,4,opt,name=tz,proto3" json:"tz,omitempty"` // for by=day, an IANA time zone
+	Limit         int32                  `protobuf:"varint,5,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsRequest) Reset() {
+	*x = GetStatsRequest{}
+	mi := &file_golink_v1_golink_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsRequest) ProtoMessage() {}
+
+func (x *GetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetStatsRequest) GetShort() string {
+	if x != nil {
+		return x.Short
+	}
+	return ""
+}
+
+func (x *GetStatsRequest) GetBy() string {
+	if x != nil {
+		return x.By
+	}
+	return ""
+}
+
+func (x *GetStatsRequest) GetDays() int32 {
+	if x != nil {
+		return x.Days
+	}
+	return 0
+}
+
+func (x *GetStatsRequest) GetTz() string {
+	if x != nil {
+		return x.Tz
+	}
+	return ""
+}
+
+func (x *GetStatsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetStatsResponse struct {
+	state         protoimpl.MessageState    `protogen:"open.v1"`
+	TotalClicks   int64                     `protobuf:"varint,1,opt,name=total_clicks,json=totalClicks,proto3" json:"total_clicks,omitempty"`
+	Counts        []*GetStatsResponse_Count `protobuf:"bytes,2,rep,name=counts,proto3" json:"counts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsResponse) Reset() {
+	*x = GetStatsResponse{}
+	mi := &file_golink_v1_golink_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsResponse) ProtoMessage() {}
+
+func (x *GetStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetStatsResponse) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetStatsResponse) GetTotalClicks() int64 {
+	if x != nil {
+		return x.TotalClicks
+	}
+	return 0
+}
+
+func (x *GetStatsResponse) GetCounts() []*GetStatsResponse_Count {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+type PutLinkRequest_Strings struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        []string               `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutLinkRequest_Strings) Reset() {
+	*x = PutLinkRequest_Strings{}
+	mi := &file_golink_v1_golink_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutLinkRequest_Strings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutLinkRequest_Strings) ProtoMessage() {}
+
+func (x *PutLinkRequest_Strings) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutLinkRequest_Strings.ProtoReflect.Descriptor instead.
+func (*PutLinkRequest_Strings) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{6, 0}
+}
+
+func (x *PutLinkRequest_Strings) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type PutLinkRequest_Headers struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Values        map[string]string      `protobuf:"bytes,1,rep,name=values,proto3" json:"values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutLinkRequest_Headers) Reset() {
+	*x = PutLinkRequest_Headers{}
+	mi := &file_golink_v1_golink_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutLinkRequest_Headers) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutLinkRequest_Headers) ProtoMessage() {}
+
+func (x *PutLinkRequest_Headers) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutLinkRequest_Headers.ProtoReflect.Descriptor instead.
+func (*PutLinkRequest_Headers) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{6, 1}
+}
+
+func (x *PutLinkRequest_Headers) GetValues() map[string]string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type GetStatsResponse_Count struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	Clicks        int32                  `protobuf:"varint,2,opt,name=clicks,proto3" json:"clicks,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatsResponse_Count) Reset() {
+	*x = GetStatsResponse_Count{}
+	mi := &file_golink_v1_golink_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatsResponse_Count) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatsResponse_Count) ProtoMessage() {}
+
+func (x *GetStatsResponse_Count) ProtoReflect() protoreflect.Message {
+	mi := &file_golink_v1_golink_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatsResponse_Count.ProtoReflect.Descriptor instead.
+func (*GetStatsResponse_Count) Descriptor() ([]byte, []int) {
+	return file_golink_v1_golink_proto_rawDescGZIP(), []int{10, 0}
+}
+
+func (x *GetStatsResponse_Count) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *GetStatsResponse_Count) GetClicks() int32 {
+	if x != nil {
+		return x.Clicks
+	}
+	return 0
+}
+
+var File_golink_v1_golink_proto protoreflect.FileDescriptor
+
+const file_golink_v1_golink_proto_rawDesc = "" +
+	"\n" +
+	"\x16golink/v1/golink.proto\x12\tgolink.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xde\x05\n" +
+	"\x04Link\x12\x14\n" +
+	"\x05short\x18\x01 \x01(\tR\x05short\x12\x12\n" +
+	"\x04long\x18\x02 \x01(\tR\x04long\x12\x14\n" +
+	"\x05owner\x18\x03 \x01(\tR\x05owner\x124\n" +
+	"\acreated\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x127\n" +
+	"\tlast_edit\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\blastEdit\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\x12\x1b\n" +
+	"\tco_owners\x18\a \x03(\tR\bcoOwners\x12\x1c\n" +
+	"\tfallbacks\x18\b \x03(\tR\tfallbacks\x12-\n" +
+	"\x12maintenance_target\x18\t \x01(\tR\x11maintenanceTarget\x12\x1c\n" +
+	"\tsuccessor\x18\n" +
+	" \x01(\tR\tsuccessor\x12:\n" +
+	"\n" +
+	"deprecated\x18\v \x01(\v2\x1a.google.protobuf.TimestampR\n" +
+	"deprecated\x124\n" +
+	"\aexpires\x18\f \x01(\v2\x1a.google.protobuf.TimestampR\aexpires\x126\n" +
+	"\aheaders\x18\r \x03(\v2\x1c.golink.v1.Link.HeadersEntryR\aheaders\x12\x16\n" +
+	"\x06params\x18\x0e \x01(\tR\x06params\x12\x19\n" +
+	"\bmax_uses\x18\x0f \x01(\x05R\amaxUses\x12\x12\n" +
+	"\x04uses\x18\x10 \x01(\x05R\x04uses\x12\x18\n" +
+	"\aversion\x18\x11 \x01(\x05R\aversion\x12!\n" +
+	"\fauto_created\x18\x12 \x01(\bR\vautoCreated\x12!\n" +
+	"\fhealth_check\x18\x13 \x01(\tR\vhealthCheck\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"T\n" +
+	"\x12ResolveLinkRequest\x12\x14\n" +
+	"\x05short\x18\x01 \x01(\tR\x05short\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x14\n" +
+	"\x05query\x18\x03 \x01(\tR\x05query\"'\n" +
+	"\x13ResolveLinkResponse\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\"&\n" +
+	"\x0eGetLinkRequest\x12\x14\n" +
+	"\x05short\x18\x01 \x01(\tR\x05short\"x\n" +
+	"\x10ListLinksRequest\x12\f\n" +
+	"\x01q\x18\x01 \x01(\tR\x01q\x12\x16\n" +
+	"\x06health\x18\x02 \x01(\tR\x06health\x12\x12\n" +
+	"\x04sort\x18\x03 \x01(\tR\x04sort\x12\x14\n" +
+	"\x05limit\x18\x04 \x01(\x05R\x05limit\x12\x14\n" +
+	"\x05after\x18\x05 \x01(\tR\x05after\"Y\n" +
+	"\x11ListLinksResponse\x12%\n" +
+	"\x05links\x18\x01 \x03(\v2\x0f.golink.v1.LinkR\x05links\x12\x1d\n" +
+	"\n" +
+	"next_after\x18\x02 \x01(\tR\tnextAfter\"\xee\x06\n" +
+	"\x0ePutLinkRequest\x12\x14\n" +
+	"\x05short\x18\x01 \x01(\tR\x05short\x12\x12\n" +
+	"\x04long\x18\x02 \x01(\tR\x04long\x12\x14\n" +
+	"\x05owner\x18\x03 \x01(\tR\x05owner\x125\n" +
+	"\x04tags\x18\x04 \x01(\v2!.golink.v1.PutLinkRequest.StringsR\x04tags\x12>\n" +
+	"\tco_owners\x18\x05 \x01(\v2!.golink.v1.PutLinkRequest.StringsR\bcoOwners\x12?\n" +
+	"\tfallbacks\x18\x06 \x01(\v2!.golink.v1.PutLinkRequest.StringsR\tfallbacks\x122\n" +
+	"\x12maintenance_target\x18\a \x01(\tH\x00R\x11maintenanceTarget\x88\x01\x01\x12!\n" +
+	"\tsuccessor\x18\b \x01(\tH\x01R\tsuccessor\x88\x01\x01\x12;\n" +
+	"\aheaders\x18\t \x01(\v2!.golink.v1.PutLinkRequest.HeadersR\aheaders\x12\x1b\n" +
+	"\x06params\x18\n" +
+	" \x01(\tH\x02R\x06params\x88\x01\x01\x12\x1e\n" +
+	"\bmax_uses\x18\v \x01(\x05H\x03R\amaxUses\x88\x01\x01\x12\x1d\n" +
+	"\aexpires\x18\f \x01(\tH\x04R\aexpires\x88\x01\x01\x12\x18\n" +
+	"\aversion\x18\r \x01(\x05R\aversion\x12'\n" +
+	"\x0fidempotency_key\x18\x0e \x01(\tR\x0eidempotencyKey\x12&\n" +
+	"\fhealth_check\x18\x0f \x01(\tH\x05R\vhealthCheck\x88\x01\x01\x1a!\n" +
+	"\aStrings\x12\x16\n" +
+	"\x06values\x18\x01 \x03(\tR\x06values\x1a\x8b\x01\n" +
+	"\aHeaders\x12E\n" +
+	"\x06values\x18\x01 \x03(\v2-.golink.v1.PutLinkRequest.Headers.ValuesEntryR\x06values\x1a9\n" +
+	"\vValuesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x15\n" +
+	"\x13_maintenance_targetB\f\n" +
+	"\n" +
+	"_successorB\t\n" +
+	"\a_paramsB\v\n" +
+	"\t_max_usesB\n" +
+	"\n" +
+	"\b_expiresB\x0f\n" +
+	"\r_health_check\")\n" +
+	"\x11DeleteLinkRequest\x12\x14\n" +
+	"\x05short\x18\x01 \x01(\tR\x05short\"\x14\n" +
+	"\x12DeleteLinkResponse\"q\n" +
+	"\x0fGetStatsRequest\x12\x14\n" +
+	"\x05short\x18\x01 \x01(\tR\x05short\x12\x0e\n" +
+	"\x02by\x18\x02 \x01(\tR\x02by\x12\x12\n" +
+	"\x04days\x18\x03 \x01(\x05R\x04days\x12\x0e\n" +
+	"\x02tz\x18\x04 \x01(\tR\x02tz\x12\x14\n" +
+	"\x05limit\x18\x05 \x01(\x05R\x05limit\"\xa7\x01\n" +
+	"\x10GetStatsResponse\x12!\n" +
+	"\ftotal_clicks\x18\x01 \x01(\x03R\vtotalClicks\x129\n" +
+	"\x06counts\x18\x02 \x03(\v2!.golink.v1.GetStatsResponse.CountR\x06counts\x1a5\n" +
+	"\x05Count\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\x12\x16\n" +
+	"\x06clicks\x18\x02 \x01(\x05R\x06clicks2\xa3\x03\n" +
+	"\rGolinkService\x12L\n" +
+	"\vResolveLink\x12\x1d.golink.v1.ResolveLinkRequest\x1a\x1e.golink.v1.ResolveLinkResponse\x125\n" +
+	"\aGetLink\x12\x19.golink.v1.GetLinkRequest\x1a\x0f.golink.v1.Link\x12F\n" +
+	"\tListLinks\x12\x1b.golink.v1.ListLinksRequest\x1a\x1c.golink.v1.ListLinksResponse\x125\n" +
+	"\aPutLink\x12\x19.golink.v1.PutLinkRequest\x1a\x0f.golink.v1.Link\x12I\n" +
+	"\n" +
+	"DeleteLink\x12\x1c.golink.v1.DeleteLinkRequest\x1a\x1d.golink.v1.DeleteLinkResponse\x12C\n" +
+	"\bGetStats\x12\x1a.golink.v1.GetStatsRequest\x1a\x1b.golink.v1.GetStatsResponseB6Z4github.com/tailscale/golink/proto/golink/v1;golinkv1b\x06proto3"
+
+var (
+	file_golink_v1_golink_proto_rawDescOnce sync.Once
+	file_golink_v1_golink_proto_rawDescData []byte
+)
+
+func file_golink_v1_golink_proto_rawDescGZIP() []byte {
+	file_golink_v1_golink_proto_rawDescOnce.Do(func() {
+		file_golink_v1_golink_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_golink_v1_golink_proto_rawDesc), len(file_golink_v1_golink_proto_rawDesc)))
+	})
+	return file_golink_v1_golink_proto_rawDescData
+}
+
+var file_golink_v1_golink_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_golink_v1_golink_proto_goTypes = []any{
+	(*Link)(nil),                   // 0: golink.v1.Link
+	(*ResolveLinkRequest)(nil),     // 1: golink.v1.ResolveLinkRequest
+	(*ResolveLinkResponse)(nil),    // 2: golink.v1.ResolveLinkResponse
+	(*GetLinkRequest)(nil),         // 3: golink.v1.GetLinkRequest
+	(*ListLinksRequest)(nil),       // 4: golink.v1.ListLinksRequest
+	(*ListLinksResponse)(nil),      // 5: golink.v1.ListLinksResponse
+	(*PutLinkRequest)(nil),         // 6: golink.v1.PutLinkRequest
+	(*DeleteLinkRequest)(nil),      // 7: golink.v1.DeleteLinkRequest
+	(*DeleteLinkResponse)(nil),     // 8: golink.v1.DeleteLinkResponse
+	(*GetStatsRequest)(nil),        // 9: golink.v1.GetStatsRequest
+	(*GetStatsResponse)(nil),       // 10: golink.v1.GetStatsResponse
+	nil,                            // 11: golink.v1.Link.HeadersEntry
+	(*PutLinkRequest_Strings)(nil), // 12: golink.v1.PutLinkRequest.Strings
+	(*PutLinkRequest_Headers)(nil), // 13: golink.v1.PutLinkRequest.Headers
+	nil,                            // 14: golink.v1.PutLinkRequest.Headers.ValuesEntry
+	(*GetStatsResponse_Count)(nil), // 15: golink.v1.GetStatsResponse.Count
+	(*timestamppb.Timestamp)(nil),  // 16: google.protobuf.Timestamp
+}
+var file_golink_v1_golink_proto_depIdxs = []int32{
+	16, // 0: golink.v1.Link.created:type_name -> google.protobuf.Timestamp
+	16, // 1: golink.v1.Link.last_edit:type_name -> google.protobuf.Timestamp
+	16, // 2: golink.v1.Link.deprecated:type_name -> google.protobuf.Timestamp
+	16, // 3: golink.v1.Link.expires:type_name -> google.protobuf.Timestamp
+	11, // 4: golink.v1.Link.headers:type_name -> golink.v1.Link.HeadersEntry
+	0,  // 5: golink.v1.ListLinksResponse.links:type_name -> golink.v1.Link
+	12, // 6: golink.v1.PutLinkRequest.tags:type_name -> golink.v1.PutLinkRequest.Strings
+	12, // 7: golink.v1.PutLinkRequest.co_owners:type_name -> golink.v1.PutLinkRequest.Strings
+	12, // 8: golink.v1.PutLinkRequest.fallbacks:type_name -> golink.v1.PutLinkRequest.Strings
+	13, // 9: golink.v1.PutLinkRequest.headers:type_name -> golink.v1.PutLinkRequest.Headers
+	15, // 10: golink.v1.GetStatsResponse.counts:type_name -> golink.v1.GetStatsResponse.Count
+	14, // 11: golink.v1.PutLinkRequest.Headers.values:type_name -> golink.v1.PutLinkRequest.Headers.ValuesEntry
+	1,  // 12: golink.v1.GolinkService.ResolveLink:input_type -> golink.v1.ResolveLinkRequest
+	3,  // 13: golink.v1.GolinkService.GetLink:input_type -> golink.v1.GetLinkRequest
+	4,  // 14: golink.v1.GolinkService.ListLinks:input_type -> golink.v1.ListLinksRequest
+	6,  // 15: golink.v1.GolinkService.PutLink:input_type -> golink.v1.PutLinkRequest
+	7,  // 16: golink.v1.GolinkService.DeleteLink:input_type -> golink.v1.DeleteLinkRequest
+	9,  // 17: golink.v1.GolinkService.GetStats:input_type -> golink.v1.GetStatsRequest
+	2,  // 18: golink.v1.GolinkService.ResolveLink:output_type -> golink.v1.ResolveLinkResponse
+	0,  // 19: golink.v1.GolinkService.GetLink:output_type -> golink.v1.Link
+	5,  // 20: golink.v1.GolinkService.ListLinks:output_type -> golink.v1.ListLinksResponse
+	0,  // 21: golink.v1.GolinkService.PutLink:output_type -> golink.v1.Link
+	8,  // 22: golink.v1.GolinkService.DeleteLink:output_type -> golink.v1.DeleteLinkResponse
+	10, // 23: golink.v1.GolinkService.GetStats:output_type -> golink.v1.GetStatsResponse
+	18, // [18:24] is the sub-list for method output_type
+	12, // [12:18] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_golink_v1_golink_proto_init() }
+func file_golink_v1_golink_proto_init() {
+	if File_golink_v1_golink_proto != nil {
+		return
+	}
+	file_golink_v1_golink_proto_msgTypes[6].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_golink_v1_golink_proto_rawDesc), len(file_golink_v1_golink_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_golink_v1_golink_proto_goTypes,
+		DependencyIndexes: file_golink_v1_golink_proto_depIdxs,
+		MessageInfos:      file_golink_v1_golink_proto_msgTypes,
+	}.Build()
+	File_golink_v1_golink_proto = out.File
+	file_golink_v1_golink_proto_goTypes = nil
+	file_golink_v1_golink_proto_depIdxs = nil
+}
@@ -0,0 +1,335 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+// The golink.v1 service mirrors the JSON links API at /.api/v1/links and
+// /.api/v1/resolve (see api.go), with the same authorization and token
+// scopes. It is served on --grpc-listen (see grpc.go).
+//
+// After editing this file, regenerate golink.pb.go and golink_grpc.pb.go
+// with protoc-gen-go and protoc-gen-go-grpc.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: golink/v1/golink.proto
+
+package golinkv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GolinkService_ResolveLink_FullMethodName = "/golink.v1.GolinkService/ResolveLink"
+	GolinkService_GetLink_FullMethodName     = "/golink.v1.GolinkService/GetLink"
+	GolinkService_ListLinks_FullMethodName   = "/golink.v1.GolinkService/ListLinks"
+	GolinkService_PutLink_FullMethodName     = "/golink.v1.GolinkService/PutLink"
+	GolinkService_DeleteLink_FullMethodName  = "/golink.v1.GolinkService/DeleteLink"
+	GolinkService_GetStats_FullMethodName    = "/golink.v1.GolinkService/GetStats"
+)
+
+// GolinkServiceClient is the client API for GolinkService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GolinkServiceClient interface {
+	// ResolveLink returns the URL that visiting a link redirects to,
+	// like GET /.api/v1/resolve.
+	ResolveLink(ctx context.Context, in *ResolveLinkRequest, opts ...grpc.CallOption) (*ResolveLinkResponse, error)
+	// GetLink returns a link, like GET /.api/v1/links/{short}.
+	GetLink(ctx context.Context, in *GetLinkRequest, opts ...grpc.CallOption) (*Link, error)
+	// ListLinks lists links matching a query, like GET /.api/v1/links.
+	ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error)
+	// PutLink creates or updates a link, like PUT /.api/v1/links/{short}.
+	PutLink(ctx context.Context, in *PutLinkRequest, opts ...grpc.CallOption) (*Link, error)
+	// DeleteLink deletes a link, like DELETE /.api/v1/links/{short}.
+	DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error)
+	// GetStats returns a link's clicks, like GET /.api/v1/links/{short}/clicks.
+	GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error)
+}
+
+type golinkServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGolinkServiceClient(cc grpc.ClientConnInterface) GolinkServiceClient {
+	return &golinkServiceClient{cc}
+}
+
+func (c *golinkServiceClient) ResolveLink(ctx context.Context, in *ResolveLinkRequest, opts ...grpc.CallOption) (*ResolveLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResolveLinkResponse)
+	err := c.cc.Invoke(ctx, GolinkService_ResolveLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinkServiceClient) GetLink(ctx context.Context, in *GetLinkRequest, opts ...grpc.CallOption) (*Link, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Link)
+	err := c.cc.Invoke(ctx, GolinkService_GetLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinkServiceClient) ListLinks(ctx context.Context, in *ListLinksRequest, opts ...grpc.CallOption) (*ListLinksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLinksResponse)
+	err := c.cc.Invoke(ctx, GolinkService_ListLinks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinkServiceClient) PutLink(ctx context.Context, in *PutLinkRequest, opts ...grpc.CallOption) (*Link, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Link)
+	err := c.cc.Invoke(ctx, GolinkService_PutLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinkServiceClient) DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteLinkResponse)
+	err := c.cc.Invoke(ctx, GolinkService_DeleteLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *golinkServiceClient) GetStats(ctx context.Context, in *GetStatsRequest, opts ...grpc.CallOption) (*GetStatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetStatsResponse)
+	err := c.cc.Invoke(ctx, GolinkService_GetStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GolinkServiceServer is the server API for GolinkService service.
+// All implementations must embed UnimplementedGolinkServiceServer
+// for forward compatibility.
+type GolinkServiceServer interface {
+	// ResolveLink returns the URL that visiting a link redirects to,
+	// like GET /.api/v1/resolve.
+	ResolveLink(context.Context, *ResolveLinkRequest) (*ResolveLinkResponse, error)
+	// GetLink returns a link, like GET /.api/v1/links/{short}.
+	GetLink(context.Context, *GetLinkRequest) (*Link, error)
+	// ListLinks lists links matching a query, like GET /.api/v1/links.
+	ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error)
+	// PutLink creates or updates a link, like PUT /.api/v1/links/{short}.
+	PutLink(context.Context, *PutLinkRequest) (*Link, error)
+	// DeleteLink deletes a link, like DELETE /.api/v1/links/{short}.
+	DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error)
+	// GetStats returns a link's clicks, like GET /.api/v1/links/{short}/clicks.
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	mustEmbedUnimplementedGolinkServiceServer()
+}
+
+// UnimplementedGolinkServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGolinkServiceServer struct{}
+
+func (UnimplementedGolinkServiceServer) ResolveLink(context.Context, *ResolveLinkRequest) (*ResolveLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveLink not implemented")
+}
+func (UnimplementedGolinkServiceServer) GetLink(context.Context, *GetLinkRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLink not implemented")
+}
+func (UnimplementedGolinkServiceServer) ListLinks(context.Context, *ListLinksRequest) (*ListLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLinks not implemented")
+}
+func (UnimplementedGolinkServiceServer) PutLink(context.Context, *PutLinkRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PutLink not implemented")
+}
+func (UnimplementedGolinkServiceServer) DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLink not implemented")
+}
+func (UnimplementedGolinkServiceServer) GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStats not implemented")
+}
+func (UnimplementedGolinkServiceServer) mustEmbedUnimplementedGolinkServiceServer() {}
+func (UnimplementedGolinkServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeGolinkServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GolinkServiceServer will
+// result in compilation errors.
+type UnsafeGolinkServiceServer interface {
+	mustEmbedUnimplementedGolinkServiceServer()
+}
+
+func RegisterGolinkServiceServer(s grpc.ServiceRegistrar, srv GolinkServiceServer) {
+	// If the following call pancis, it indicates UnimplementedGolinkServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GolinkService_ServiceDesc, srv)
+}
+
+func _GolinkService_ResolveLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinkServiceServer).ResolveLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolinkService_ResolveLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinkServiceServer).ResolveLink(ctx, req.(*ResolveLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolinkService_GetLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinkServiceServer).GetLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolinkService_GetLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinkServiceServer).GetLink(ctx, req.(*GetLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolinkService_ListLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinkServiceServer).ListLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolinkService_ListLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinkServiceServer).ListLinks(ctx, req.(*ListLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolinkService_PutLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinkServiceServer).PutLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolinkService_PutLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinkServiceServer).PutLink(ctx, req.(*PutLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolinkService_DeleteLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinkServiceServer).DeleteLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolinkService_DeleteLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinkServiceServer).DeleteLink(ctx, req.(*DeleteLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GolinkService_GetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GolinkServiceServer).GetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GolinkService_GetStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GolinkServiceServer).GetStats(ctx, req.(*GetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// GolinkService_ServiceDesc is the grpc.ServiceDesc for GolinkService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GolinkService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "golink.v1.GolinkService",
+	HandlerType: (*GolinkServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ResolveLink",
+			Handler:    _GolinkService_ResolveLink_Handler,
+		},
+		{
+			MethodName: "GetLink",
+			Handler:    _GolinkService_GetLink_Handler,
+		},
+		{
+			MethodName: "ListLinks",
+			Handler:    _GolinkService_ListLinks_Handler,
+		},
+		{
+			MethodName: "PutLink",
+			Handler:    _GolinkService_PutLink_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _GolinkService_DeleteLink_Handler,
+		},
+		{
+			MethodName: "GetStats",
+			Handler:    _GolinkService_GetStats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "golink/v1/golink.proto",
+}
@@ -0,0 +1,577 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// QR codes for links are served at /.qr/{short} as PNG images, for putting
+// links on slides and posters. The encoder below implements the byte mode
+// of QR Code Model 2 (ISO/IEC 18004), which is all that URLs need.
+
+// qrLevel is a QR code error correction level.
+type qrLevel int
+
+const (
+	qrLow      qrLevel = iota // L: recovers from 7% damage
+	qrMedium                  // M: 15%
+	qrQuartile                // Q: 25%
+	qrHigh                    // H: 30%
+)
+
+// qrLevels are the error correction levels by name.
+var qrLevels = map[string]qrLevel{"L": qrLow, "M": qrMedium, "Q": qrQuartile, "H": qrHigh}
+
+// qrFormatBits are the bits identifying each level in the format information.
+var qrFormatBits = [4]int{qrLow: 1, qrMedium: 0, qrQuartile: 3, qrHigh: 2}
+
+// qrECCPerBlock is the number of error correction codewords in each block,
+// by level and version.
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrBlocks is the number of error correction blocks, by level and version.
+var qrBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// errQRTooLong is returned by qrEncode when the data does not fit in a QR
+// code at the requested error correction level.
+var errQRTooLong = errors.New("too long for a QR code")
+
+// qrCode is an encoded QR code, without its quiet zone.
+type qrCode struct {
+	size     int
+	modules  [][]bool // dark modules, by row and column
+	function [][]bool // modules that are not data, by row and column
+}
+
+// dark reports whether the module at column x and row y is dark.
+func (q *qrCode) dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// qrEncode encodes data as a QR code at error correction level, using the
+// smallest version that fits.
+func qrEncode(data []byte, level qrLevel) (*qrCode, error) {
+	version := 1
+	for ; ; version++ {
+		if version > 40 {
+			return nil, errQRTooLong
+		}
+		if 4+qrCountBits(version)+8*len(data) <= 8*qrDataCodewords(version, level) {
+			break
+		}
+	}
+
+	// byte mode segment, terminator, and padding
+	var bits qrBits
+	bits.append(0b0100, 4)
+	bits.append(len(data), qrCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := 8 * qrDataCodewords(version, level)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	q := &qrCode{size: 17 + 4*version}
+	q.modules = make([][]bool, q.size)
+	q.function = make([][]bool, q.size)
+	for i := range q.size {
+		q.modules[i] = make([]bool, q.size)
+		q.function[i] = make([]bool, q.size)
+	}
+	q.drawFunctionPatterns(version, level)
+	q.drawCodewords(qrInterleave(codewords, version, level))
+
+	// use the mask with the lowest penalty
+	best, bestPenalty := 0, -1
+	for mask := range 8 {
+		q.applyMask(mask)
+		q.drawFormatBits(level, mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // undo
+	}
+	q.applyMask(best)
+	q.drawFormatBits(level, best)
+	return q, nil
+}
+
+// qrBits is a sequence of bits.
+type qrBits []bool
+
+// append appends the n low bits of v, most significant first.
+func (b *qrBits) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 != 0)
+	}
+}
+
+// qrCountBits is the length of the character count of a byte mode segment.
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// qrRawModules returns the number of modules available for data and error
+// correction in a version, after the function patterns.
+func qrRawModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// qrDataCodewords returns the number of data codewords in a version at an
+// error correction level.
+func qrDataCodewords(version int, level qrLevel) int {
+	return qrRawModules(version)/8 - qrECCPerBlock[level][version]*qrBlocks[level][version]
+}
+
+// qrInterleave splits data into blocks, adds their error correction
+// codewords, and interleaves the blocks.
+func qrInterleave(data []byte, version int, level qrLevel) []byte {
+	numBlocks := qrBlocks[level][version]
+	eccLen := qrECCPerBlock[level][version]
+	raw := qrRawModules(version) / 8
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+
+	divisor := qrDivisor(eccLen)
+	var blocks [][]byte
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortLen - eccLen
+		if i >= numShort {
+			n++
+		}
+		block := append([]byte(nil), data[k:k+n]...)
+		k += n
+		ecc := qrRemainder(block, divisor)
+		if i < numShort {
+			block = append(block, 0) // skipped when interleaving
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	var out []byte
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= numShort {
+				out = append(out, block[i])
+			}
+		}
+	}
+	return out
+}
+
+// qrMultiply multiplies x and y in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func qrMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// qrDivisor returns the Reed-Solomon generator polynomial of degree n,
+// without its leading coefficient.
+func qrDivisor(n int) []byte {
+	d := make([]byte, n)
+	d[n-1] = 1
+	root := byte(1)
+	for range n {
+		for j := range d {
+			d[j] = qrMultiply(d[j], root)
+			if j+1 < len(d) {
+				d[j] ^= d[j+1]
+			}
+		}
+		root = qrMultiply(root, 0x02)
+	}
+	return d
+}
+
+// qrRemainder returns the Reed-Solomon error correction codewords of data.
+func qrRemainder(data, divisor []byte) []byte {
+	r := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ r[0]
+		copy(r, r[1:])
+		r[len(r)-1] = 0
+		for i, c := range divisor {
+			r[i] ^= qrMultiply(c, factor)
+		}
+	}
+	return r
+}
+
+// set sets the module at column x and row y as a function module.
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing, and alignment patterns,
+// and the version information, and reserves the format information.
+func (q *qrCode) drawFunctionPatterns(version int, level qrLevel) {
+	for i := range q.size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < q.size && y >= 0 && y < q.size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+
+	pos := qrAlignmentPositions(version)
+	n := len(pos)
+	for i := range n {
+		for j := range n {
+			if i == 0 && j == 0 || i == 0 && j == n-1 || i == n-1 && j == 0 {
+				continue // finder patterns
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(pos[i]+dx, pos[j]+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormatBits(level, 0)
+	if version >= 7 {
+		rem := version
+		for range 12 {
+			rem = rem<<1 ^ (rem>>11)*0x1F25
+		}
+		bits := version<<12 | rem
+		for i := range 18 {
+			dark := bits>>i&1 != 0
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+// qrAlignmentPositions returns the row and column centers of the alignment
+// patterns of a version.
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	if version == 32 {
+		step = 26
+	}
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, 17+4*version-7; i >= 1; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// drawFormatBits draws both copies of the format information for a level
+// and mask.
+func (q *qrCode) drawFormatBits(level qrLevel, mask int) {
+	data := qrFormatBits[level]<<3 | mask
+	rem := data
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+
+	for i := range 6 {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+
+	for i := range 8 {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// drawCodewords places data in the zigzag pattern of pairs of columns,
+// skipping function modules.
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := range q.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert // upward
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i/8]>>(7-i%8)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by mask. Applying the same
+// mask again undoes it.
+func (q *qrCode) applyMask(mask int) {
+	for y := range q.size {
+		for x := range q.size {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to read; masks are chosen to
+// minimize it.
+func (q *qrCode) penalty() int {
+	p := 0
+	line := make([]bool, q.size)
+	for _, horizontal := range []bool{true, false} {
+		for i := range q.size {
+			for j := range q.size {
+				if horizontal {
+					line[j] = q.dark(j, i)
+				} else {
+					line[j] = q.dark(i, j)
+				}
+			}
+			// runs of five or more modules of the same color
+			run := 1
+			for j := 1; j <= q.size; j++ {
+				if j < q.size && line[j] == line[j-1] {
+					run++
+					continue
+				}
+				if run >= 5 {
+					p += 3 + run - 5
+				}
+				run = 1
+			}
+			// patterns that look like finder patterns
+			for j := 0; j+11 <= q.size; j++ {
+				if qrFinderLike(line[j:j+11], false) || qrFinderLike(line[j:j+11], true) {
+					p += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range q.size {
+		for x := range q.size {
+			if q.dark(x, y) {
+				dark++
+			}
+			// 2x2 blocks of the same color
+			if x+1 < q.size && y+1 < q.size {
+				c := q.dark(x, y)
+				if q.dark(x+1, y) == c && q.dark(x, y+1) == c && q.dark(x+1, y+1) == c {
+					p += 3
+				}
+			}
+		}
+	}
+	// deviation of the proportion of dark modules from 50%
+	total := q.size * q.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return p + k*10
+}
+
+// qrFinderLike reports whether 11 modules are dark-light-dark-dark-dark-
+// light-dark followed by four light modules, or preceded by them if
+// reversed.
+func qrFinderLike(m []bool, reversed bool) bool {
+	const pattern = "10111010000"
+	for i := range pattern {
+		j := i
+		if reversed {
+			j = len(pattern) - 1 - i
+		}
+		if m[j] != (pattern[i] == '1') {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// qrQuietZone is the width of the light border around a QR code, in
+// modules.
+const qrQuietZone = 4
+
+// image returns the code as a grayscale image of about size pixels square,
+// including its quiet zone. Each module is a whole number of pixels, so the
+// image may be smaller than size, but it is at least one pixel per module.
+func (q *qrCode) image(size int) *image.Gray {
+	n := q.size + 2*qrQuietZone
+	scale := max(size/n, 1)
+	img := image.NewGray(image.Rect(0, 0, n*scale, n*scale))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+	for y := range q.size {
+		for x := range q.size {
+			if !q.dark(x, y) {
+				continue
+			}
+			for dy := range scale {
+				for dx := range scale {
+					img.SetGray((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// linkURL returns the URL that a QR code for link opens: the link on
+// --public-hostname if it is served there, and otherwise the go link.
+func linkURL(link *Link) string {
+	if *publicHostname != "" && link.HasTag(*publicTag) {
+		return "https://" + *publicHostname + "/" + link.Short
+	}
+	return "http://" + goHostname() + "/" + link.Short
+}
+
+// maxQRSize is the largest QR code image served, in pixels.
+const maxQRSize = 2048
+
+// serveQR serves a QR code PNG for the link at /.qr/{short}. The "size"
+// parameter is the approximate image size in pixels, and "ec" is the error
+// correction level: L, M (the default), Q, or H. Higher levels are larger,
+// but can be read when partly covered or damaged.
+func serveQR(w http.ResponseWriter, r *http.Request) {
+	short := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/.qr/"), ".png")
+	if short == "" {
+		http.Error(w, "short required", http.StatusBadRequest)
+		return
+	}
+	size := 256
+	if s := r.FormValue("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxQRSize {
+			http.Error(w, fmt.Sprintf("size must be a number of pixels from 1 to %d", maxQRSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+	level := qrMedium
+	if s := r.FormValue("ec"); s != "" {
+		var ok bool
+		if level, ok = qrLevels[strings.ToUpper(s)]; !ok {
+			http.Error(w, fmt.Sprintf("unknown ec %q: use L, M, Q, or H", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	link, err := db.Load(short)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	code, err := qrEncode([]byte(linkURL(link)), level)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.image(size)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(buf.Bytes())
+}
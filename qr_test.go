@@ -0,0 +1,97 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQRRemainder(t *testing.T) {
+	// the data codewords of "HELLO WORLD" in a 1-M code, and their error
+	// correction codewords, from the QR code specification
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := qrRemainder(data, qrDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("qrRemainder = %v; want %v", got, want)
+	}
+}
+
+func TestQREncode(t *testing.T) {
+	tests := []struct {
+		data  string
+		level qrLevel
+		size  int
+	}{
+		{"http://go/x", qrLow, 21},
+		{"http://go/x", qrHigh, 25},
+		{"http://go/some-long-link-name/with/a/path", qrMedium, 29},
+		{strings.Repeat("a", 200), qrQuartile, 65},
+	}
+	for _, tt := range tests {
+		q, err := qrEncode([]byte(tt.data), tt.level)
+		if err != nil {
+			t.Fatalf("qrEncode(%q) returned error: %v", tt.data, err)
+		}
+		if q.size != tt.size {
+			t.Errorf("qrEncode(%q) size = %d; want %d", tt.data, q.size, tt.size)
+		}
+		// each corner but the bottom right has a finder pattern
+		for _, c := range [][2]int{{0, 0}, {q.size - 7, 0}, {0, q.size - 7}} {
+			for i := range 7 {
+				if !q.dark(c[0]+i, c[1]) || !q.dark(c[0], c[1]+i) || q.dark(c[0]+1, c[1]+1+i%5) {
+					t.Errorf("qrEncode(%q) has no finder pattern at %v", tt.data, c)
+					break
+				}
+			}
+		}
+	}
+
+	if _, err := qrEncode(make([]byte, 3000), qrLow); err != errQRTooLong {
+		t.Errorf("qrEncode of 3000 bytes returned %v; want %v", err, errQRTooLong)
+	}
+}
+
+func TestServeQR(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "slides", Long: "https://example.com/slides"})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantSize   int
+	}{
+		{"/.qr/slides.png", http.StatusOK, 231}, // 33 modules with the quiet zone, 7 pixels each
+		{"/.qr/slides.png?size=1024&ec=H", http.StatusOK, 999},
+		{"/.qr/slides?size=10", http.StatusOK, 33},
+		{"/.qr/slides.png?size=0", http.StatusBadRequest, 0},
+		{"/.qr/slides.png?ec=X", http.StatusBadRequest, 0},
+		{"/.qr/missing.png", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		serveQR(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET %s = %d; want %d", tt.path, w.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			continue
+		}
+		img, err := png.Decode(w.Body)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		b := img.Bounds()
+		if diff := cmp.Diff([2]int{tt.wantSize, tt.wantSize}, [2]int{b.Dx(), b.Dy()}); diff != "" {
+			t.Errorf("GET %s image size mismatch (-want +got):\n%s", tt.path, diff)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// linkQuery is a parsed link filter expression, such as
+// "owner:alice tag:oncall clicks>100 edited<2023-01-01".
+//
+// An expression is a space separated list of terms, all of which must match.
+// Terms are either field comparisons or free text matched against the short
+// name and destination of links. Prefixing a term with "-" negates it, and
+// double quotes may be used to include spaces in a term.
+//
+// Supported fields are:
+//
+//	owner:alice         owned by alice, or by alice@ any domain
+//	tag:oncall          tagged oncall
+//	namespace:eng       in the eng namespace (also ns:eng)
+//	clicks>100          total clicks, compared with : = < > <= >=
+//	created<2023-01-01  creation date, compared with : = < > <= >=
+//	edited>=2023-01-01  last edit date, compared with : = < > <= >=
+//	edited<90d          last edited more than 90 days ago (also h and w)
+//	is:deprecated       deprecated links (also is:auto, is:unowned, is:expired)
+//	is:broken           destination found broken by the dead link checker
+//	target:https://x/   destination is the same URL, after canonicalization
+type linkQuery struct {
+	terms []queryTerm
+}
+
+// queryTerm is a single term of a linkQuery.
+type queryTerm struct {
+	negate bool
+	field  string // empty for free text
+	op     string // one of : = < > <= >=, or empty for free text
+	value  string
+
+	// synonyms are other words matched in place of a free text value.
+	synonyms []string
+}
+
+var reQueryTerm = regexp.MustCompile(`^([a-z]+)(:|<=|>=|<|>|=)(.*)$`)
+
+// queryFields are the fields supported in link queries.
+var queryFields = map[string]bool{
+	"owner":     true,
+	"tag":       true,
+	"namespace": true,
+	"ns":        true,
+	"clicks":    true,
+	"created":   true,
+	"edited":    true,
+	"is":        true,
+	"target":    true,
+}
+
+// splitQuery splits s into space separated terms, keeping double quoted
+// sections together and removing the quotes.
+func splitQuery(s string) ([]string, error) {
+	var terms []string
+	var cur strings.Builder
+	inQuote, inTerm := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			inTerm = true
+		case unicode.IsSpace(r) && !inQuote:
+			if inTerm {
+				terms = append(terms, cur.String())
+				cur.Reset()
+				inTerm = false
+			}
+		default:
+			cur.WriteRune(r)
+			inTerm = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote in query %q", s)
+	}
+	if inTerm {
+		terms = append(terms, cur.String())
+	}
+	return terms, nil
+}
+
+// parseLinkQuery parses a link filter expression.
+func parseLinkQuery(s string) (*linkQuery, error) {
+	tokens, err := splitQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	q := new(linkQuery)
+	for _, tok := range tokens {
+		var t queryTerm
+		if len(tok) > 1 && tok[0] == '-' {
+			t.negate = true
+			tok = tok[1:]
+		}
+		if m := reQueryTerm.FindStringSubmatch(tok); m != nil && queryFields[m[1]] {
+			t.field, t.op, t.value = m[1], m[2], m[3]
+			if t.value == "" {
+				return nil, fmt.Errorf("missing value for %s", t.field)
+			}
+			switch t.field {
+			case "owner", "tag", "namespace", "ns", "is", "target":
+				if t.op != ":" && t.op != "=" {
+					return nil, fmt.Errorf("%s does not support %s", t.field, t.op)
+				}
+			}
+		} else {
+			t.value = tok
+		}
+		if t.value == "" {
+			continue
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+// withSynonyms matches each free text term of q by any of its synonyms, as
+// returned by synonymsOf, as well as by the term itself.
+func (q *linkQuery) withSynonyms(synonymsOf func(string) []string) {
+	for i, t := range q.terms {
+		if t.field == "" {
+			q.terms[i].synonyms = synonymsOf(t.value)
+		}
+	}
+}
+
+// sqlBuilder accumulates positional arguments for a SQL condition.
+type sqlBuilder struct {
+	args []any
+}
+
+// arg adds v as an argument and returns its placeholder.
+func (b *sqlBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+var reQueryAge = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+// parseQueryTime parses a date (2006-01-02), RFC 3339 time, or age relative
+// to now in a query. Ages are a number of hours, days, or weeks, such as
+// "90d", so "edited<90d" matches links last edited more than 90 days ago.
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if m := reQueryAge.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch m[2] {
+		case "h":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, -n), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n), nil
+		}
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// likeEscape escapes the special characters of a SQL LIKE pattern.
+func likeEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// sql returns the query as a SQL condition on the Links table,
+// along with its positional arguments.
+func (q *linkQuery) sql() (string, []any, error) {
+	if len(q.terms) == 0 {
+		return "TRUE", nil, nil
+	}
+	b := new(sqlBuilder)
+	conds := make([]string, 0, len(q.terms))
+	for _, t := range q.terms {
+		cond, err := t.sql(b)
+		if err != nil {
+			return "", nil, err
+		}
+		if t.negate {
+			cond = "NOT (" + cond + ")"
+		}
+		conds = append(conds, cond)
+	}
+	return strings.Join(conds, " AND "), b.args, nil
+}
+
+func (t queryTerm) sql(b *sqlBuilder) (string, error) {
+	op := t.op
+	if op == ":" {
+		op = "="
+	}
+	switch t.field {
+	case "":
+		var conds []string
+		for _, v := range append([]string{t.value}, t.synonyms...) {
+			p := b.arg("%" + likeEscape(v) + "%")
+			conds = append(conds, fmt.Sprintf("Short ILIKE %s OR Long ILIKE %s", p, p))
+		}
+		return "(" + strings.Join(conds, " OR ") + ")", nil
+	case "owner":
+		if owner := storedOwner(t.value); owner != t.value {
+			// pseudonymized owners can only be matched by full login
+			return "Owner = " + b.arg(owner), nil
+		}
+		p := b.arg(t.value)
+		return fmt.Sprintf("(Owner = %s OR split_part(Owner, '@', 1) = %s)", p, p), nil
+	case "tag":
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM LinkTags WHERE LinkTags.ID = Links.ID AND LinkTags.Tag = %s)", b.arg(strings.ToLower(t.value))), nil
+	case "namespace", "ns":
+		return fmt.Sprintf("(position('.' in ID) > 0 AND split_part(ID, '.', 1) = %s)", b.arg(linkID(t.value))), nil
+	case "clicks":
+		n, err := strconv.Atoi(t.value)
+		if err != nil {
+			return "", fmt.Errorf("invalid clicks value %q", t.value)
+		}
+		return fmt.Sprintf("TotalClicks %s %s", op, b.arg(n)), nil
+	case "created", "edited":
+		col := "Created"
+		if t.field == "edited" {
+			col = "LastEdit"
+		}
+		ts, err := parseQueryTime(t.value, time.Now())
+		if err != nil {
+			return "", fmt.Errorf("invalid %s time %q: use YYYY-MM-DD, RFC 3339, or an age like 90d", t.field, t.value)
+		}
+		if t.op == ":" {
+			// match the whole day (or instant, for RFC 3339 times)
+			end := ts.Add(time.Second)
+			if len(t.value) == len(time.DateOnly) {
+				end = ts.AddDate(0, 0, 1)
+			}
+			return fmt.Sprintf("(%s >= %s AND %s < %s)", col, b.arg(ts.Unix()), col, b.arg(end.Unix())), nil
+		}
+		return fmt.Sprintf("%s %s %s", col, op, b.arg(ts.Unix())), nil
+	case "target":
+		var ps []string
+		for _, target := range sameTargets(t.value) {
+			ps = append(ps, b.arg(target))
+		}
+		return fmt.Sprintf("Long IN (%s)", strings.Join(ps, ", ")), nil
+	case "is":
+		switch strings.ToLower(t.value) {
+		case "deprecated":
+			return "Successor <> ''", nil
+		case "auto":
+			return "AutoCreated", nil
+		case "unowned":
+			return "Owner = ''", nil
+		case "expired":
+			return "(Expires > 0 AND Expires <= " + b.arg(time.Now().Unix()) + ")", nil
+		case "broken":
+			return "(HealthCheck <> 'off' AND EXISTS (SELECT 1 FROM TargetHealth WHERE TargetHealth.Target = Links.Long AND NOT TargetHealth.Healthy))", nil
+		}
+		return "", fmt.Errorf("unknown is: value %q", t.value)
+	}
+	return "", fmt.Errorf("unknown field %q", t.field)
+}
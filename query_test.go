@@ -0,0 +1,114 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkQuerySQL(t *testing.T) {
+	tests := []struct {
+		q        string
+		wantCond string
+		wantArgs []any
+		wantErr  bool
+	}{
+		{q: "", wantCond: "TRUE"},
+		{
+			q:        "owner:alice",
+			wantCond: "(Owner = $1 OR split_part(Owner, '@', 1) = $1)",
+			wantArgs: []any{"alice"},
+		},
+		{
+			q:        "tag:OnCall clicks>100",
+			wantCond: "EXISTS (SELECT 1 FROM LinkTags WHERE LinkTags.ID = Links.ID AND LinkTags.Tag = $1) AND TotalClicks > $2",
+			wantArgs: []any{"oncall", 100},
+		},
+		{
+			q:        "edited<2023-01-01 -is:deprecated",
+			wantCond: "LastEdit < $1 AND NOT (Successor <> '')",
+			wantArgs: []any{int64(1672531200)},
+		},
+		{
+			q:        "created:2023-01-01",
+			wantCond: "(Created >= $1 AND Created < $2)",
+			wantArgs: []any{int64(1672531200), int64(1672617600)},
+		},
+		{
+			q:        `ns:Eng "50%_off"`,
+			wantCond: "(position('.' in ID) > 0 AND split_part(ID, '.', 1) = $1) AND (Short ILIKE $2 OR Long ILIKE $2)",
+			wantArgs: []any{"eng", `%50\%\_off%`},
+		},
+		{
+			// unknown fields are free text
+			q:        "https://example.com",
+			wantCond: "(Short ILIKE $1 OR Long ILIKE $1)",
+			wantArgs: []any{"%https://example.com%"},
+		},
+		{
+			q:        "target:HTTP://Example.com:80//docs/./a",
+			wantCond: "Long IN ($1, $2)",
+			wantArgs: []any{"http://example.com/docs/a", "https://example.com/docs/a"},
+		},
+		{
+			q:        "is:broken",
+			wantCond: "(HealthCheck <> 'off' AND EXISTS (SELECT 1 FROM TargetHealth WHERE TargetHealth.Target = Links.Long AND NOT TargetHealth.Healthy))",
+		},
+		{q: "clicks>many", wantErr: true},
+		{q: "edited<yesterday", wantErr: true},
+		{q: "owner>alice", wantErr: true},
+		{q: "is:popular", wantErr: true},
+		{q: "tag:", wantErr: true},
+		{q: `"unterminated`, wantErr: true},
+	}
+	for _, tt := range tests {
+		q, err := parseLinkQuery(tt.q)
+		var cond string
+		var args []any
+		if err == nil {
+			cond, args, err = q.sql()
+		}
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseLinkQuery(%q) returned error %v; want %v", tt.q, err, tt.wantErr)
+		}
+		if tt.wantErr {
+			continue
+		}
+		if cond != tt.wantCond {
+			t.Errorf("parseLinkQuery(%q) cond = %q; want %q", tt.q, cond, tt.wantCond)
+		}
+		if !cmp.Equal(args, tt.wantArgs) {
+			t.Errorf("parseLinkQuery(%q) args = %v; want %v", tt.q, args, tt.wantArgs)
+		}
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	now := time.Date(2023, 3, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in      string
+		want    time.Time
+		wantErr bool
+	}{
+		{in: "2023-01-01", want: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "2023-01-01T08:30:00Z", want: time.Date(2023, 1, 1, 8, 30, 0, 0, time.UTC)},
+		{in: "6h", want: time.Date(2023, 3, 15, 6, 0, 0, 0, time.UTC)},
+		{in: "14d", want: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{in: "2w", want: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{in: "2y", wantErr: true},
+		{in: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseQueryTime(tt.in, now)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseQueryTime(%q) returned error %v; want %v", tt.in, err, tt.wantErr)
+		}
+		if !tt.wantErr && !got.Equal(tt.want) {
+			t.Errorf("parseQueryTime(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errQuotaExceeded is returned when saving a link would exceed a configured quota.
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// namespaceLimits holds per-namespace link limits parsed from the
+// --namespace-quotas flag. Namespaces not listed use --max-links-per-namespace.
+var namespaceLimits map[string]int
+
+// linkNamespace returns the namespace of a short name, which is the portion
+// before the first period. Short names without a period are in the global
+// namespace, represented by the empty string.
+func linkNamespace(short string) string {
+	ns, _, ok := strings.Cut(short, ".")
+	if !ok {
+		return ""
+	}
+	return ns
+}
+
+// parseNamespaceQuotas parses a comma-separated list of namespace=limit pairs,
+// such as "eng=500,sales=100". Namespaces are normalized with linkID. A limit
+// of 0 means no limit, exempting the namespace from --max-links-per-namespace.
+func parseNamespaceQuotas(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		ns, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid namespace quota %q: want namespace=limit", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid limit in namespace quota %q", pair)
+		}
+		limits[linkID(strings.TrimSpace(ns))] = n
+	}
+	return limits, nil
+}
+
+// namespaceLimit returns the maximum number of links allowed in ns,
+// or 0 if there is no limit.
+func namespaceLimit(ns string) int {
+	if n, ok := namespaceLimits[linkID(ns)]; ok {
+		return n
+	}
+	return *maxLinksPerNamespace
+}
+
+// quotaCounter counts the links that quotas limit. PostgresDB implements it,
+// as does linkCounter in the transaction saving a link.
+type quotaCounter interface {
+	CountOwnedLinks(owner string) (int, error)
+	CountNamespaceLinks(ns string) (int, error)
+	CountCreatedSince(creator string, t time.Time) (int, error)
+}
+
+// checkQuotas returns an error wrapping errQuotaExceeded if saving short with
+// the specified owner would exceed a configured quota, counting links with q.
+// existing is the currently stored link, or nil if a new link is being
+// created by creator, the stored owner value of the user creating it, or ""
+// if golink is creating it on its own, such as when syncing --sync-file.
+//
+// Per-user limits also apply when ownership of an existing link is transferred.
+// Namespace and daily creation limits only apply to new links, and the daily
+// limit counts the links creator has created, whoever owns them.
+//
+// Checking quotas before saving a link races with other saves, so links are
+// saved with PostgresDB.save, which checks them again as it saves them.
+func checkQuotas(q quotaCounter, existing *Link, short, owner, creator string, now time.Time) error {
+	if existing != nil && existing.Owner == owner {
+		return nil
+	}
+
+	if *maxLinksPerUser > 0 && owner != "" {
+		n, err := q.CountOwnedLinks(owner)
+		if err != nil {
+			return err
+		}
+		if n >= *maxLinksPerUser {
+			return fmt.Errorf("%w: %s already owns %d links (limit %d)", errQuotaExceeded, owner, n, *maxLinksPerUser)
+		}
+	}
+
+	if existing != nil {
+		return nil
+	}
+
+	ns := linkNamespace(short)
+	if limit := namespaceLimit(ns); limit > 0 {
+		n, err := q.CountNamespaceLinks(ns)
+		if err != nil {
+			return err
+		}
+		if n >= limit {
+			name := ns
+			if name == "" {
+				name = "global"
+			}
+			return fmt.Errorf("%w: %s namespace already has %d links (limit %d)", errQuotaExceeded, name, n, limit)
+		}
+	}
+
+	if *maxCreationsPerDay > 0 && creator != "" {
+		n, err := q.CountCreatedSince(creator, now.Add(-24*time.Hour))
+		if err != nil {
+			return err
+		}
+		if n >= *maxCreationsPerDay {
+			return fmt.Errorf("%w: %s created %d links in the last day (limit %d)", errQuotaExceeded, creator, n, *maxCreationsPerDay)
+		}
+	}
+
+	return nil
+}
+
+// quotaLockKeys returns the sorted names of the advisory locks taken by
+// PostgresDB.save to save short with the specified owner as created by
+// creator: one for each quota that the save might count against.
+func quotaLockKeys(short, owner, creator string) []string {
+	var keys []string
+	if *maxLinksPerUser > 0 && owner != "" {
+		keys = append(keys, "quota:owner:"+owner)
+	}
+	if ns := linkNamespace(short); namespaceLimit(ns) > 0 {
+		keys = append(keys, "quota:namespace:"+linkID(ns))
+	}
+	if *maxCreationsPerDay > 0 && creator != "" {
+		keys = append(keys, "quota:creator:"+creator)
+	}
+	// always locked in the same order, so that saves can't deadlock
+	slices.Sort(keys)
+	return keys
+}
+
+// pendingQuotas counts links as q does, along with the links that a dry run
+// has found it would create, so that a dry run reports the rows that would
+// exceed a quota once earlier rows were created.
+type pendingQuotas struct {
+	q          quotaCounter
+	owners     map[string]int
+	namespaces map[string]int
+	creators   map[string]int
+}
+
+func newPendingQuotas(q quotaCounter) *pendingQuotas {
+	return &pendingQuotas{
+		q:          q,
+		owners:     make(map[string]int),
+		namespaces: make(map[string]int),
+		creators:   make(map[string]int),
+	}
+}
+
+// add records that short would be created with the specified owner by
+// creator.
+func (p *pendingQuotas) add(short, owner, creator string) {
+	p.owners[owner]++
+	p.namespaces[linkID(linkNamespace(short))]++
+	p.creators[creator]++
+}
+
+func (p *pendingQuotas) CountOwnedLinks(owner string) (int, error) {
+	n, err := p.q.CountOwnedLinks(owner)
+	return n + p.owners[owner], err
+}
+
+func (p *pendingQuotas) CountNamespaceLinks(ns string) (int, error) {
+	n, err := p.q.CountNamespaceLinks(ns)
+	return n + p.namespaces[linkID(ns)], err
+}
+
+func (p *pendingQuotas) CountCreatedSince(creator string, t time.Time) (int, error) {
+	// pending links would be created now, within any window
+	n, err := p.q.CountCreatedSince(creator, t)
+	return n + p.creators[creator], err
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLinkNamespace(t *testing.T) {
+	tests := []struct {
+		short string
+		want  string
+	}{
+		{short: "who", want: ""},
+		{short: "eng.oncall", want: "eng"},
+		{short: "eng.oncall.primary", want: "eng"},
+		{short: "Eng-Team.wiki", want: "Eng-Team"},
+	}
+	for _, tt := range tests {
+		if got := linkNamespace(tt.short); got != tt.want {
+			t.Errorf("linkNamespace(%q) = %q; want %q", tt.short, got, tt.want)
+		}
+	}
+}
+
+func TestParseNamespaceQuotas(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]int
+		wantErr bool
+	}{
+		{in: "", want: map[string]int{}},
+		{in: "eng=500", want: map[string]int{"eng": 500}},
+		{in: "Eng-Team=5, sales = 10,", want: map[string]int{"engteam": 5, "sales": 10}},
+		{in: "eng", wantErr: true},
+		{in: "eng=many", wantErr: true},
+		{in: "eng=-1", wantErr: true},
+		{in: "eng=0", want: map[string]int{"eng": 0}}, // no limit
+	}
+	for _, tt := range tests {
+		got, err := parseNamespaceQuotas(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseNamespaceQuotas(%q) returned error %v; want %v", tt.in, err, tt.wantErr)
+		}
+		if !tt.wantErr && !cmp.Equal(got, tt.want) {
+			t.Errorf("parseNamespaceQuotas(%q) = %v; want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestImportQuotas(t *testing.T) {
+	db = newTestDB(t)
+	oldMax := *maxCreationsPerDay
+	t.Cleanup(func() { *maxCreationsPerDay = oldMax })
+	*maxCreationsPerDay = 1
+
+	now := time.Now().UTC()
+	// the link is owned by someone else, but counts against its creator
+	if _, err := importLink(&Link{Short: "a", Long: "https://a.example.com/", Owner: "bob@example.com"}, "alice@example.com", now, nil); err != nil {
+		t.Fatal(err)
+	}
+	res, err := importLink(&Link{Short: "b", Long: "https://b.example.com/", Owner: "carol@example.com"}, "alice@example.com", now, nil)
+	if res != "failed" || !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("second import by alice = %q, %v; want failed, quota exceeded", res, err)
+	}
+	if err := checkQuotas(db, nil, "b", "alice@example.com", "bob@example.com", now); err != nil {
+		t.Errorf("checkQuotas for bob's first creation: %v", err)
+	}
+	// links golink creates on its own aren't counted against anyone
+	if err := checkQuotas(db, nil, "b", "alice@example.com", "", now); err != nil {
+		t.Errorf("checkQuotas without creator: %v", err)
+	}
+}
+
+func TestImportQuotasDryRun(t *testing.T) {
+	db = newTestDB(t)
+	oldMax := *maxLinksPerUser
+	t.Cleanup(func() { *maxLinksPerUser = oldMax })
+	*maxLinksPerUser = 2
+
+	now := time.Now().UTC()
+	if _, err := importLink(&Link{Short: "a", Long: "https://a.example.com/", Owner: "bob@example.com"}, "", now, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the first row would bring bob to the limit, so the second would fail
+	pending := newPendingQuotas(db)
+	if res, err := importLink(&Link{Short: "b", Long: "https://b.example.com/", Owner: "bob@example.com"}, "", now, pending); res != "valid" {
+		t.Errorf("first dry run row = %q, %v; want valid", res, err)
+	}
+	res, err := importLink(&Link{Short: "c", Long: "https://c.example.com/", Owner: "bob@example.com"}, "", now, pending)
+	if res != "failed" || !errors.Is(err, errQuotaExceeded) {
+		t.Errorf("second dry run row = %q, %v; want failed, quota exceeded", res, err)
+	}
+	if _, err := db.Load("b"); err == nil {
+		t.Error("dry run created a link")
+	}
+}
+
+func TestSaveQuotasConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	oldMax := *maxLinksPerUser
+	t.Cleanup(func() { *maxLinksPerUser = oldMax })
+	*maxLinksPerUser = 1
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			link := &Link{Short: fmt.Sprintf("link-%d", i), Long: "https://example.com/", Owner: "alice@example.com"}
+			errs[i] = db.save(link, saveCreate, true)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, errQuotaExceeded):
+			t.Errorf("save: %v; want nil or errQuotaExceeded", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created %d links for a user with a limit of 1", created)
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// linkStore stores links and their click counts: the operations that
+// resolving links needs. PostgresDB implements it along with everything else
+// golink stores, and RedisDB implements only it.
+type linkStore interface {
+	Load(short string) (*Link, error)
+	Save(link *Link) error
+	Delete(short, editor string) error
+	LoadStats() (ClickStats, error)
+	SaveStats(stats ClickStats) error
+}
+
+var (
+	_ linkStore = (*PostgresDB)(nil)
+	_ linkStore = (*RedisDB)(nil)
+)
+
+// RedisDB stores Links in Redis. Each link is a hash of its Link fields,
+// JSON-encoded, under the key "{prefix}link:{ID}", and click counts are
+// kept in the sorted set "{prefix}clicks", scored by clicks and keyed by
+// link ID. Unlike PostgresDB, it keeps no history, tags index, or stats by
+// day.
+//
+// Links are kept until they are deleted, persisted as the Redis server is
+// configured to, unless a TTL is set, in which case they expire like a
+// cache. With --store=redis, golink stores its links in a RedisDB instead of
+// PostgreSQL, and otherwise PostgresDB can keep the links it loads in a
+// RedisDB, set with --redis-url, to share them between replicas.
+type RedisDB struct {
+	rdb    *redis.Client
+	prefix string
+	ttl    time.Duration // how long saved links are kept, or 0 for no limit
+}
+
+// NewRedisDB returns a RedisDB using the Redis server at url, such as
+// "redis://:password@localhost:6379/0", whose keys begin with prefix.
+func NewRedisDB(url, prefix string, ttl time.Duration) (*RedisDB, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opts)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+	return &RedisDB{rdb: rdb, prefix: prefix, ttl: ttl}, nil
+}
+
+// Close closes the connections to the Redis server.
+func (s *RedisDB) Close() error {
+	return s.rdb.Close()
+}
+
+func (s *RedisDB) linkKey(id string) string { return s.prefix + "link:" + id }
+func (s *RedisDB) clicksKey() string        { return s.prefix + "clicks" }
+
+// linkFields returns the fields of the hash storing link.
+func linkFields(link *Link) ([]any, error) {
+	b, err := json.Marshal(link)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	fields := make([]any, 0, 2*len(m))
+	for k, v := range m {
+		fields = append(fields, k, string(v))
+	}
+	return fields, nil
+}
+
+// Load returns a Link by its short name.
+//
+// It returns fs.ErrNotExist if the link does not exist.
+func (s *RedisDB) Load(short string) (*Link, error) {
+	return s.loadID(linkID(short))
+}
+
+// loadID returns the Link with the specified ID.
+func (s *RedisDB) loadID(id string) (*Link, error) {
+	defer dbQuerySeconds.observe("RedisLoad", time.Now())
+	h, err := s.rdb.HGetAll(context.TODO(), s.linkKey(id)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(h) == 0 {
+		return nil, fs.ErrNotExist
+	}
+	m := make(map[string]json.RawMessage, len(h))
+	for k, v := range h {
+		m[k] = json.RawMessage(v)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	link := new(Link)
+	if err := json.Unmarshal(b, link); err != nil {
+		return nil, fmt.Errorf("decoding link %q: %w", id, err)
+	}
+	return link, nil
+}
+
+// saveScript replaces the hash KEYS[1] with the fields in ARGV[3:], with
+// its Version one more than before, which it returns. ARGV[1] is the TTL of
+// the hash in milliseconds, or 0 for none, and ARGV[2] is the number of
+// clicks of the link, which are kept.
+var saveScript = redis.NewScript(`
+local version = tonumber(redis.call('HGET', KEYS[1], 'Version') or '0') + 1
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'Version', version, 'TotalClicks', ARGV[2], unpack(ARGV, 3))
+if ARGV[1] ~= '0' then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return version
+`)
+
+// Save saves a Link, replacing any existing link with the same ID.
+// link.Version is set to the new version. Its TotalClicks is that of the
+// clicks sorted set, as maintained by SaveStats.
+func (s *RedisDB) Save(link *Link) error {
+	defer dbQuerySeconds.observe("RedisSave", time.Now())
+	id := linkID(link.Short)
+	ctx := context.TODO()
+	clicks, err := s.rdb.ZScore(ctx, s.clicksKey(), id).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	fields, err := linkFields(link)
+	if err != nil {
+		return err
+	}
+	// Version and TotalClicks are set by saveScript
+	args := []any{s.ttl.Milliseconds(), int(clicks)}
+	for i := 0; i < len(fields); i += 2 {
+		if k := fields[i]; k != "Version" && k != "TotalClicks" {
+			args = append(args, k, fields[i+1])
+		}
+	}
+	version, err := saveScript.Run(ctx, s.rdb, []string{s.linkKey(id)}, args...).Int()
+	if err != nil {
+		return err
+	}
+	link.Version = version
+	link.TotalClicks = int(clicks)
+	return nil
+}
+
+// linkGeneration counts the writes to a link, and to all links, that a
+// RedisDB has been told of with forget and forgetAll, as of a load. A link
+// loaded from another store is only put if there have been none since, so
+// that a replica that loaded a link just before it was written doesn't put
+// the old link back after the writer has forgotten it.
+type linkGeneration struct {
+	link, all string
+}
+
+// genTTL is how long the generation of a link is kept after it was last
+// written, which must be longer than loading a link from another store
+// takes. A link whose generation expired looks changed to loads begun
+// before that.
+const genTTL = time.Hour
+
+func (s *RedisDB) genKey(id string) string { return s.prefix + "gen:" + id }
+func (s *RedisDB) allGenKey() string       { return s.prefix + "gen" }
+
+// generation returns the generation of the link with the specified ID, to
+// be read before loading it from the store that it is put from.
+func (s *RedisDB) generation(id string) (linkGeneration, error) {
+	vs, err := s.rdb.MGet(context.TODO(), s.genKey(id), s.allGenKey()).Result()
+	if err != nil {
+		return linkGeneration{}, err
+	}
+	gen := func(v any) string {
+		if v, ok := v.(string); ok {
+			return v
+		}
+		return "0"
+	}
+	return linkGeneration{link: gen(vs[0]), all: gen(vs[1])}, nil
+}
+
+// putScript replaces the hash KEYS[1] with the fields in ARGV[4:] if the
+// generations KEYS[2] and KEYS[3] of the link and of all links are still
+// ARGV[2] and ARGV[3], returning whether it did. ARGV[1] is the TTL of the
+// hash in milliseconds, or 0 for none.
+var putScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[2] or (redis.call('GET', KEYS[3]) or '0') ~= ARGV[3] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], unpack(ARGV, 4))
+if ARGV[1] ~= '0' then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// put stores link as it is, such as after loading it from another store,
+// with no change to its Version or TotalClicks, unless it was forgotten
+// since gen, its generation before it was loaded.
+func (s *RedisDB) put(link *Link, gen linkGeneration) error {
+	fields, err := linkFields(link)
+	if err != nil {
+		return err
+	}
+	id := linkID(link.Short)
+	args := append([]any{s.ttl.Milliseconds(), gen.link, gen.all}, fields...)
+	return putScript.Run(context.TODO(), s.rdb, []string{s.linkKey(id), s.genKey(id), s.allGenKey()}, args...).Err()
+}
+
+// Delete removes a Link using its short name, and its click count. Links
+// have no history in Redis, so editor is not recorded.
+//
+// It returns fs.ErrNotExist if the link does not exist.
+func (s *RedisDB) Delete(short, editor string) error {
+	defer dbQuerySeconds.observe("RedisDelete", time.Now())
+	id := linkID(short)
+	var del *redis.IntCmd
+	_, err := s.rdb.TxPipelined(context.TODO(), func(p redis.Pipeliner) error {
+		del = p.Del(context.TODO(), s.linkKey(id))
+		p.ZRem(context.TODO(), s.clicksKey(), id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if del.Val() == 0 {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// forget removes the links with the given IDs, after they are changed in
+// the store that they were put from, and advances their generations so that
+// copies loaded before the change aren't put back.
+func (s *RedisDB) forget(ids ...string) {
+	ctx := context.TODO()
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, id := range ids {
+			p.Incr(ctx, s.genKey(id))
+			p.PExpire(ctx, s.genKey(id), genTTL)
+			p.Del(ctx, s.linkKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("redis: forgetting links: %v", err)
+	}
+}
+
+// forgetAll removes every link, after a change that may have changed any
+// link in the store that they were put from, and advances the generation of
+// all links.
+func (s *RedisDB) forgetAll() {
+	ctx := context.TODO()
+	if err := s.rdb.Incr(ctx, s.allGenKey()).Err(); err != nil {
+		log.Printf("redis: forgetting links: %v", err)
+		return
+	}
+	iter := s.rdb.Scan(ctx, 0, s.prefix+"link:*", 1000).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	err := iter.Err()
+	if err == nil && len(keys) > 0 {
+		err = s.rdb.Del(ctx, keys...).Err()
+	}
+	if err != nil {
+		log.Printf("redis: forgetting links: %v", err)
+	}
+}
+
+// LoadStats returns click stats for links, keyed by link ID.
+func (s *RedisDB) LoadStats() (ClickStats, error) {
+	zs, err := s.rdb.ZRangeWithScores(context.TODO(), s.clicksKey(), 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("loading stats: %w", err)
+	}
+	stats := make(ClickStats, len(zs))
+	for _, z := range zs {
+		stats[z.Member.(string)] = int(z.Score)
+	}
+	return stats, nil
+}
+
+// statsScript adds ARGV[1] clicks to the link ARGV[2] in the sorted set
+// KEYS[1], and to the TotalClicks of its hash KEYS[2], if it exists.
+var statsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	redis.call('HINCRBY', KEYS[2], 'TotalClicks', ARGV[1])
+end
+return redis.call('ZINCRBY', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// SaveStats records click stats for links, keyed by link ID. The provided
+// map includes incremental clicks that have occurred since the last time
+// SaveStats was called.
+func (s *RedisDB) SaveStats(stats ClickStats) error {
+	ctx := context.TODO()
+	_, err := s.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for id, clicks := range stats {
+			statsScript.Eval(ctx, p, []string{s.clicksKey(), s.linkKey(id)}, strconv.Itoa(clicks), id)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("saving stats: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestRedisDB(t *testing.T, ttl time.Duration) (*RedisDB, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	s, err := NewRedisDB("redis://"+mr.Addr(), "golink:", ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, mr
+}
+
+func TestRedisDB(t *testing.T) {
+	s, mr := newTestRedisDB(t, 0)
+	now := time.Now().UTC().Truncate(time.Second)
+	link := &Link{
+		Short:    "Wiki",
+		Long:     "https://wiki.example.com/",
+		Owner:    "amelie@example.com",
+		Created:  now,
+		LastEdit: now,
+		Tags:     []string{"docs"},
+		Headers:  map[string]string{"Cache-Control": "no-store"},
+	}
+	if err := s.Save(link); err != nil {
+		t.Fatal(err)
+	}
+	if link.Version != 1 {
+		t.Errorf("Version = %d; want 1", link.Version)
+	}
+	if !mr.Exists("golink:link:wiki") {
+		t.Errorf("link hash not stored under its ID")
+	}
+	got, err := s.Load("wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(link, got); diff != "" {
+		t.Errorf("Load mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := s.SaveStats(ClickStats{"wiki": 3, "other": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveStats(ClickStats{"wiki": 2}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := s.LoadStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ClickStats{"wiki": 5, "other": 1}, stats); diff != "" {
+		t.Errorf("LoadStats mismatch (-want +got):\n%s", diff)
+	}
+	if got, err := s.Load("wiki"); err != nil || got.TotalClicks != 5 {
+		t.Errorf("Load TotalClicks = %v, %v; want 5", got, err)
+	}
+
+	// saving again keeps the clicks and replaces the other fields
+	link.Tags = nil
+	if err := s.Save(link); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Load("wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 2 || got.TotalClicks != 5 || got.Tags != nil {
+		t.Errorf("after second Save, Load = %+v; want version 2, 5 clicks, no tags", got)
+	}
+
+	if err := s.Delete("wiki", "amelie@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("wiki"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Load after Delete error = %v; want fs.ErrNotExist", err)
+	}
+	if err := s.Delete("wiki", "amelie@example.com"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("second Delete error = %v; want fs.ErrNotExist", err)
+	}
+	if stats, _ := s.LoadStats(); stats["wiki"] != 0 {
+		t.Errorf("clicks after Delete = %d; want 0", stats["wiki"])
+	}
+}
+
+func TestRedisDBShared(t *testing.T) {
+	s, mr := newTestRedisDB(t, time.Minute)
+	put := func(link *Link) {
+		t.Helper()
+		gen, err := s.generation(linkID(link.Short))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.put(link, gen); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := &Link{Short: "docs", Long: "https://docs.example.com/", Version: 7, TotalClicks: 12}
+	put(link)
+	got, err := s.loadID(linkID("docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != 7 || got.TotalClicks != 12 {
+		t.Errorf("put changed the link: %+v", got)
+	}
+	if ttl := mr.TTL("golink:link:docs"); ttl != time.Minute {
+		t.Errorf("TTL = %v; want %v", ttl, time.Minute)
+	}
+
+	s.forget(linkID("docs"))
+	if _, err := s.loadID(linkID("docs")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("load after forget error = %v; want fs.ErrNotExist", err)
+	}
+
+	put(&Link{Short: "a"})
+	put(&Link{Short: "b"})
+	s.SaveStats(ClickStats{"a": 1})
+	s.forgetAll()
+	for _, key := range mr.Keys() {
+		if strings.HasPrefix(key, "golink:link:") {
+			t.Errorf("%s kept after forgetAll", key)
+		}
+	}
+	if !mr.Exists("golink:clicks") {
+		t.Error("clicks removed by forgetAll")
+	}
+}
+
+func TestRedisDBSharedStalePut(t *testing.T) {
+	s, _ := newTestRedisDB(t, 0)
+	id := linkID("docs")
+
+	// a replica loads the link, which another replica then writes and
+	// forgets before the first puts what it loaded
+	gen, err := s.generation(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.forget(id)
+	if err := s.put(&Link{Short: "docs", Long: "https://old.example.com/"}, gen); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.loadID(id); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("load of link put after forget error = %v; want fs.ErrNotExist", err)
+	}
+
+	gen, err = s.generation(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.forgetAll()
+	if err := s.put(&Link{Short: "docs", Long: "https://old.example.com/"}, gen); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.loadID(id); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("load of link put after forgetAll error = %v; want fs.ErrNotExist", err)
+	}
+
+	gen, err = s.generation(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.put(&Link{Short: "docs", Long: "https://new.example.com/"}, gen); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.loadID(id); err != nil || got.Long != "https://new.example.com/" {
+		t.Errorf("load of current link = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reservedRefresh is how long the cached reserved names are used before
+// being reloaded from db.
+const reservedRefresh = 30 * time.Second
+
+// reservedCache caches the names reserved with /.api/v1/reserved-names, so
+// that saving a link does not require an extra database query.
+var reservedCache struct {
+	mu     sync.Mutex
+	names  map[string]*ReservedName // keyed by linkID
+	loaded time.Time
+}
+
+// flagReservedNames returns the names reserved with --reserved-names, keyed
+// by linkID.
+func flagReservedNames() map[string]*ReservedName {
+	names := make(map[string]*ReservedName)
+	for _, name := range strings.Split(*reservedNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[linkID(name)] = &ReservedName{Name: name, Reason: "reserved by --reserved-names"}
+		}
+	}
+	return names
+}
+
+// reservedName returns the reservation of short if links may not be created
+// with it, or nil otherwise. Names are compared by link ID, so case and
+// dashes are ignored.
+//
+// The returned value must not be modified.
+func reservedName(short string) *ReservedName {
+	id := linkID(short)
+	if n := flagReservedNames()[id]; n != nil {
+		return n
+	}
+
+	reservedCache.mu.Lock()
+	defer reservedCache.mu.Unlock()
+	if now := time.Now(); now.Sub(reservedCache.loaded) >= reservedRefresh {
+		names, err := db.LoadReservedNames()
+		if err != nil {
+			log.Printf("loading reserved names: %v", err)
+		} else {
+			reservedCache.names = make(map[string]*ReservedName)
+			for _, n := range names {
+				reservedCache.names[linkID(n.Name)] = n
+			}
+			reservedCache.loaded = now
+		}
+	}
+	return reservedCache.names[id]
+}
+
+// invalidateReservedNames causes the next call to reservedName to reload
+// from db.
+func invalidateReservedNames() {
+	reservedCache.mu.Lock()
+	defer reservedCache.mu.Unlock()
+	reservedCache.loaded = time.Time{}
+}
+
+// reservedNameError returns the validation error for a link named short,
+// which is reserved by n.
+func reservedNameError(short string, n *ReservedName) string {
+	msg := short + " is a reserved name and cannot be used for a link"
+	if n.Reason != "" {
+		msg += ": " + n.Reason
+	}
+	return msg
+}
+
+// reservedNameRequest is the body of a request to reserve a short name.
+type reservedNameRequest struct {
+	Reason string
+}
+
+// serveReservedNames serves the short names that links may not be created
+// with.
+//
+// GET /.api/v1/reserved-names lists the reserved names, including those
+// reserved by --reserved-names. PUT /.api/v1/reserved-names/{name} reserves
+// name, and DELETE /.api/v1/reserved-names/{name} releases it. Only admins
+// may reserve and release names, and names reserved by --reserved-names can
+// only be released by changing the flag.
+func serveReservedNames(w http.ResponseWriter, r *http.Request) {
+	name, hasName := strings.CutPrefix(r.URL.Path, "/.api/v1/reserved-names/")
+	name = strings.TrimSpace(name)
+	if hasName && (name == "" || strings.Contains(name, "/")) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if hasName {
+			n := reservedName(name)
+			if n == nil {
+				http.Error(w, name+" is not reserved", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(n)
+			return
+		}
+		names, err := db.LoadReservedNames()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for id, n := range flagReservedNames() {
+			if !slices.ContainsFunc(names, func(rn *ReservedName) bool { return linkID(rn.Name) == id }) {
+				names = append(names, n)
+			}
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return linkID(names[i].Name) < linkID(names[j].Name)
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(names)
+		return
+	}
+
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if !hasName {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "PUT" && r.Method != "DELETE" {
+		http.Error(w, "PUT or DELETE required", http.StatusMethodNotAllowed)
+		return
+	}
+	if !reShortName.MatchString(name) {
+		http.Error(w, "name may only contain letters, numbers, dash, and period", http.StatusBadRequest)
+		return
+	}
+	var req reservedNameRequest
+	if r.Method == "PUT" && !decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", name, "reserved names")
+		http.Error(w, "only admins can edit reserved names", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, adminShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if flagReservedNames()[linkID(name)] != nil {
+			http.Error(w, name+" is reserved by --reserved-names", http.StatusConflict)
+			return
+		}
+		if err := db.DeleteReservedName(name); errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, name+" is not reserved", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invalidateShared("reserved")
+		audit(r, cu, "reserved.delete", name, "")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	n := &ReservedName{
+		Name:      name,
+		Reason:    strings.TrimSpace(req.Reason),
+		Created:   time.Now().UTC(),
+		CreatedBy: cu.login,
+	}
+	if err := db.SaveReservedName(n); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invalidateShared("reserved")
+	audit(r, cu, "reserved.save", name, n.Reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+func TestReservedNames(t *testing.T) {
+	db = newTestDB(t)
+	t.Cleanup(invalidateReservedNames)
+
+	oldReservedNames := *reservedNames
+	t.Cleanup(func() { *reservedNames = oldReservedNames })
+	*reservedNames = "api, Metrics"
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+	admin := user{login: "admin@example.com", isAdmin: true}
+	currentUser = func(*http.Request) (user, error) { return admin, nil }
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		serveReservedNames(w, r)
+		return w
+	}
+	create := func(short string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(url.Values{
+			"short": {short},
+			"long":  {"https://example.com/"},
+			"xsrf":  {xsrftoken.Generate(xsrfKey, admin.login, newShortName)},
+		}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		serveSave(w, r)
+		return w
+	}
+
+	if w := do("PUT", "/.api/v1/reserved-names/status", `{"Reason": "used for the status page"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	tests := []struct {
+		short string
+		want  int
+	}{
+		{"api", http.StatusBadRequest},
+		{"metrics", http.StatusBadRequest}, // case is ignored
+		{"Sta-tus", http.StatusBadRequest}, // dashes are ignored
+		{"apis", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := create(tt.short); w.Code != tt.want {
+			t.Errorf("creating %q = %d; want %d: %s", tt.short, w.Code, tt.want, w.Body.String())
+		}
+	}
+	if w := create("status"); !strings.Contains(w.Body.String(), "used for the status page") {
+		t.Errorf("creating status error = %q; want reason", w.Body.String())
+	}
+	if _, err := importLink(&Link{Short: "api", Long: "https://example.com/"}, "", time.Now(), newPendingQuotas(db)); err == nil {
+		t.Error("importing api succeeded; want error")
+	}
+
+	w := do("GET", "/.api/v1/reserved-names", "")
+	for _, name := range []string{`"api"`, `"Metrics"`, `"status"`} {
+		if !strings.Contains(w.Body.String(), name) {
+			t.Errorf("GET = %s; want %s listed", w.Body.String(), name)
+		}
+	}
+
+	if w := do("DELETE", "/.api/v1/reserved-names/api", ""); w.Code != http.StatusConflict {
+		t.Errorf("DELETE of flag name = %d; want %d", w.Code, http.StatusConflict)
+	}
+	if w := do("DELETE", "/.api/v1/reserved-names/status", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if w := do("DELETE", "/.api/v1/reserved-names/status", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	if w := create("status"); w.Code != http.StatusOK {
+		t.Errorf("creating released name = %d; want %d", w.Code, http.StatusOK)
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	if w := do("PUT", "/.api/v1/reserved-names/wiki", `{}`); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin PUT = %d; want %d", w.Code, http.StatusForbidden)
+	}
+}
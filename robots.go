@@ -0,0 +1,122 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules are the robots.txt rules that apply to the dead link checker
+// on one host.
+type robotsRules struct {
+	allow, disallow []string // path patterns
+	crawlDelay      time.Duration
+}
+
+// parseRobots parses a robots.txt file, returning the rules for the crawler
+// whose User-Agent product token is agent, such as "golink-link-checker".
+// Rules for agent are used if there are any, and otherwise the rules for all
+// crawlers ("*").
+func parseRobots(r io.Reader, agent string) *robotsRules {
+	agent = strings.ToLower(agent)
+	var (
+		specific, general robotsRules
+		hasSpecific       bool
+		groups            []*robotsRules // groups the current lines apply to
+		inAgents          bool           // whether the previous line was a User-agent
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if key == "user-agent" {
+			if !inAgents {
+				groups = nil
+			}
+			inAgents = true
+			switch ua := strings.ToLower(value); {
+			case ua == "*":
+				groups = append(groups, &general)
+			case ua != "" && strings.Contains(agent, ua):
+				groups = append(groups, &specific)
+				hasSpecific = true
+			}
+			continue
+		}
+		inAgents = false
+		for _, g := range groups {
+			switch key {
+			case "allow":
+				if value != "" {
+					g.allow = append(g.allow, value)
+				}
+			case "disallow":
+				// an empty Disallow allows everything
+				if value != "" {
+					g.disallow = append(g.disallow, value)
+				}
+			case "crawl-delay":
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					g.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+	if hasSpecific {
+		return &specific
+	}
+	return &general
+}
+
+// allowed reports whether the rules allow requesting path, which includes
+// any query. The longest matching pattern wins, and Allow wins ties.
+func (rr *robotsRules) allowed(path string) bool {
+	if rr == nil {
+		return true
+	}
+	best, allow := -1, true
+	for _, p := range rr.allow {
+		if len(p) > best && robotsMatch(p, path) {
+			best, allow = len(p), true
+		}
+	}
+	for _, p := range rr.disallow {
+		if len(p) > best && robotsMatch(p, path) {
+			best, allow = len(p), false
+		}
+	}
+	return allow
+}
+
+// robotsMatch reports whether the robots.txt path pattern matches path.
+// Patterns match path prefixes, "*" matches any characters, and a trailing
+// "$" anchors the pattern to the end of the path.
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		j := strings.Index(rest, part)
+		if j < 0 {
+			return false
+		}
+		rest = rest[j+len(part):]
+	}
+	return !anchored || rest == ""
+}
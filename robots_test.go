@@ -0,0 +1,77 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	const robots = `# comment
+User-agent: *
+Disallow: /private/
+Crawl-delay: 2
+
+User-agent: Googlebot
+User-agent: golink-link-checker
+Disallow: /search
+Allow: /search/about
+Crawl-delay: 0.5
+`
+	tests := []struct {
+		agent     string
+		path      string
+		want      bool
+		wantDelay time.Duration
+	}{
+		{"golink-link-checker", "/private/x", true, 500 * time.Millisecond},
+		{"golink-link-checker", "/search?q=x", false, 500 * time.Millisecond},
+		{"golink-link-checker", "/search/about", true, 500 * time.Millisecond},
+		{"other-bot", "/private/x", false, 2 * time.Second},
+		{"other-bot", "/search", true, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		rules := parseRobots(strings.NewReader(robots), tt.agent)
+		if got := rules.allowed(tt.path); got != tt.want {
+			t.Errorf("parseRobots(%s).allowed(%q) = %v; want %v", tt.agent, tt.path, got, tt.want)
+		}
+		if rules.crawlDelay != tt.wantDelay {
+			t.Errorf("parseRobots(%s).crawlDelay = %v; want %v", tt.agent, rules.crawlDelay, tt.wantDelay)
+		}
+	}
+
+	var none *robotsRules
+	if !none.allowed("/anything") {
+		t.Error("nil rules disallow /anything; want allowed")
+	}
+	if !parseRobots(strings.NewReader("User-agent: *\nDisallow:\n"), "x").allowed("/") {
+		t.Error("empty Disallow disallows /; want allowed")
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/docs", "/docs/a", true},
+		{"/docs", "/doc", false},
+		{"/*.pdf", "/a/b.pdf", true},
+		{"/*.pdf", "/a/b.pdf?x=1", true},
+		{"/*.pdf$", "/a/b.pdf?x=1", false},
+		{"/*.pdf$", "/a/b.pdf", true},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/a*b*c", "/axxbxxc", true},
+		{"/a*b*c", "/axxcxxb", false},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %v; want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchWeights are the weights of the signals combined into a link's
+// search score, from --search-weights.
+var searchWeights = defaultSearchWeights
+
+// defaultSearchWeights favor links whose names match the search, then
+// popular, recently edited, and the searcher's own links.
+var defaultSearchWeights = scoreWeights{Clicks: 1, Recency: 1, Prefix: 2, Owner: 1}
+
+// scoreWeights weigh the signals that make up a link's search score. Each
+// signal is from 0 to 1, so a weight is the most its signal can add.
+type scoreWeights struct {
+	Clicks  float64 // popularity, relative to the most clicked result
+	Recency float64 // how recently the link was edited
+	Prefix  float64 // whether the short name is, or starts with, a search term
+	Owner   float64 // how close the link's owner is to the searcher
+}
+
+// recencyHalfLife is the age at which a link's recency signal is halved.
+const recencyHalfLife = 90 * 24 * time.Hour
+
+// parseScoreWeights parses comma-separated name=weight pairs, such as
+// "clicks=1,recency=0.5,prefix=2,owner=1". Signals that are not listed keep
+// their default weight, and a weight of 0 ignores the signal.
+func parseScoreWeights(s string) (scoreWeights, error) {
+	w := defaultSearchWeights
+	fields := map[string]*float64{
+		"clicks":  &w.Clicks,
+		"recency": &w.Recency,
+		"prefix":  &w.Prefix,
+		"owner":   &w.Owner,
+	}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return w, fmt.Errorf("invalid weight %q: want name=weight", pair)
+		}
+		f, ok := fields[strings.TrimSpace(name)]
+		if !ok {
+			return w, fmt.Errorf("unknown signal %q: use clicks, recency, prefix, or owner", name)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || v < 0 || math.IsInf(v, 0) {
+			return w, fmt.Errorf("invalid weight %q for %s: want a non-negative number", value, name)
+		}
+		*f = v
+	}
+	return w, nil
+}
+
+// linkScorer scores links found by a search for a user.
+type linkScorer struct {
+	weights   scoreWeights
+	u         user
+	terms     []string // link IDs of the free text terms searched for, and their synonyms
+	maxClicks int      // most clicks of any result
+	now       time.Time
+}
+
+// newLinkScorer returns a scorer for the links found by q for u.
+func newLinkScorer(weights scoreWeights, q *linkQuery, u user, links []*Link, now time.Time) *linkScorer {
+	s := &linkScorer{weights: weights, u: u, now: now}
+	for _, t := range q.terms {
+		if t.field == "" && !t.negate {
+			s.terms = append(s.terms, linkID(t.value))
+			for _, syn := range t.synonyms {
+				s.terms = append(s.terms, linkID(syn))
+			}
+		}
+	}
+	for _, link := range links {
+		s.maxClicks = max(s.maxClicks, link.TotalClicks)
+	}
+	return s
+}
+
+// score returns the combined score of link; higher is better.
+func (s *linkScorer) score(link *Link) float64 {
+	var clicks float64
+	if s.maxClicks > 0 {
+		// logarithmic, so that a few very popular links don't flatten the rest
+		clicks = math.Log1p(float64(link.TotalClicks)) / math.Log1p(float64(s.maxClicks))
+	}
+
+	recency := 1.0
+	if age := s.now.Sub(link.LastEdit); age > 0 {
+		recency = math.Exp2(-float64(age) / float64(recencyHalfLife))
+	}
+
+	var prefix float64
+	id := linkID(link.Short)
+	for _, term := range s.terms {
+		switch {
+		case id == term:
+			prefix = 1
+		case strings.HasPrefix(id, term):
+			prefix = max(prefix, 0.5)
+		}
+	}
+
+	var owner float64
+	switch {
+	case link.Owner != "" && authz.isOwner(s.u, link.Owner):
+		owner = 1
+	case s.coOwns(link):
+		owner = 0.75
+	case sameDomain(s.u.login, link.Owner):
+		owner = 0.25
+	}
+
+	w := s.weights
+	return w.Clicks*clicks + w.Recency*recency + w.Prefix*prefix + w.Owner*owner
+}
+
+// coOwns reports whether the scorer's user is one of link's co-owners.
+func (s *linkScorer) coOwns(link *Link) bool {
+	for _, owner := range link.CoOwners {
+		if authz.isOwner(s.u, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameDomain reports whether login and owner are email addresses in the
+// same domain.
+func sameDomain(login, owner string) bool {
+	_, a, ok := strings.Cut(login, "@")
+	if !ok || a == "" {
+		return false
+	}
+	_, b, ok := strings.Cut(owner, "@")
+	return ok && strings.EqualFold(a, b)
+}
+
+// sortByScore sorts links by their score, best first, and then by short
+// name.
+func (s *linkScorer) sortByScore(links []*Link) {
+	scores := make(map[*Link]float64, len(links))
+	for _, link := range links {
+		scores[link] = s.score(link)
+	}
+	sort.SliceStable(links, func(i, j int) bool {
+		if a, b := scores[links[i]], scores[links[j]]; a != b {
+			return a > b
+		}
+		return links[i].Short < links[j].Short
+	})
+}
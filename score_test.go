@@ -0,0 +1,94 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseScoreWeights(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    scoreWeights
+		wantErr bool
+	}{
+		{in: "", want: defaultSearchWeights},
+		{in: "clicks=3, owner=0", want: scoreWeights{Clicks: 3, Recency: 1, Prefix: 2, Owner: 0}},
+		{in: "recency=0.5", want: scoreWeights{Clicks: 1, Recency: 0.5, Prefix: 2, Owner: 1}},
+		{in: "clicks", wantErr: true},
+		{in: "stars=1", wantErr: true},
+		{in: "prefix=-1", wantErr: true},
+		{in: "prefix=lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseScoreWeights(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseScoreWeights(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("parseScoreWeights(%q) = %+v; want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSortByScore(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	old := now.AddDate(-2, 0, 0)
+	links := []*Link{
+		{Short: "docs-archive", Owner: "bob@other.com", LastEdit: old, TotalClicks: 10},
+		{Short: "docs", Owner: "bob@other.com", LastEdit: old},
+		{Short: "team-docs", Owner: "bob@other.com", LastEdit: old, TotalClicks: 1000},
+		{Short: "my-docs", Owner: "alice@example.com", LastEdit: now.AddDate(-1, 0, 0)},
+		{Short: "new-docs", Owner: "bob@other.com", LastEdit: now},
+	}
+	u := user{login: "alice@example.com"}
+
+	tests := []struct {
+		name    string
+		weights scoreWeights
+		want    []string
+	}{
+		{
+			name:    "default",
+			weights: defaultSearchWeights,
+			want:    []string{"docs", "docs-archive", "my-docs", "team-docs", "new-docs"},
+		},
+		{
+			name:    "clicks only",
+			weights: scoreWeights{Clicks: 1},
+			want:    []string{"team-docs", "docs-archive", "docs", "my-docs", "new-docs"},
+		},
+		{
+			name:    "owner only",
+			weights: scoreWeights{Owner: 1},
+			want:    []string{"my-docs", "docs", "docs-archive", "new-docs", "team-docs"},
+		},
+		{
+			name:    "none",
+			weights: scoreWeights{},
+			want:    []string{"docs", "docs-archive", "my-docs", "new-docs", "team-docs"},
+		},
+	}
+	q, err := parseLinkQuery("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := append([]*Link(nil), links...)
+			newLinkScorer(tt.weights, q, u, links, now).sortByScore(links)
+			var got []string
+			for _, link := range links {
+				got = append(got, link.Short)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("sortByScore mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// sequenceShorts generates numbered short names in a family, such as
+// release-43 after release-42, allocating numbers with next so that
+// concurrent callers never get the same one.
+type sequenceShorts struct {
+	prefix string
+	next   func(prefix string) (int64, error)
+}
+
+// generate returns the prefix followed by a newly allocated number. Every
+// attempt allocates another number, so a number whose name turns out to be
+// taken is skipped.
+func (g sequenceShorts) generate(attempt int) (string, error) {
+	n, err := g.next(g.prefix)
+	if err != nil {
+		return "", err
+	}
+	return g.prefix + strconv.FormatInt(n, 10), nil
+}
+
+// checkSequencePrefix reports whether prefix can name a family of numbered
+// links. Its link ID can't end in a digit, since the numbers of its links
+// couldn't then be told apart from the prefix.
+func checkSequencePrefix(prefix string) error {
+	if !reShortName.MatchString(prefix + "1") {
+		return errors.New("prefix may only contain letters, numbers, dash, and period")
+	}
+	if id := linkID(prefix); id == "" || isDigit(id[len(id)-1]) {
+		return errors.New("prefix must not end in a digit: add a separator, such as release-")
+	}
+	return nil
+}
+
+// sequenceNumber returns the number of the link with the given ID in the
+// family whose prefix has the link ID prefixID, or false if it is not in
+// the family.
+func sequenceNumber(prefixID, id string) (int64, bool) {
+	s, ok := strings.CutPrefix(id, prefixID)
+	if !ok || s == "" || (s[0] == '0' && s != "0") {
+		return 0, false
+	}
+	for i := range len(s) {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"io/fs"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestCheckSequencePrefix(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		wantErr bool
+	}{
+		{"release-", false},
+		{"release", false},
+		{"team.build-", false},
+		{"v2", true},
+		{"v2-", true}, // hyphens are ignored in link IDs
+		{"rel/ease-", true},
+		{"-", true},
+	}
+	for _, tt := range tests {
+		err := checkSequencePrefix(tt.prefix)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkSequencePrefix(%q) error = %v; want error %v", tt.prefix, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSequenceNumber(t *testing.T) {
+	tests := []struct {
+		id     string
+		want   int64
+		wantOK bool
+	}{
+		{"release42", 42, true},
+		{"release0", 0, true},
+		{"release", 0, false},
+		{"release042", 0, false},
+		{"release42a", 0, false},
+		{"releasenotes", 0, false},
+		{"prerelease42", 0, false},
+		{"release99999999999999999999", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := sequenceNumber("release", tt.id)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("sequenceNumber(release, %q) = %d, %v; want %d, %v", tt.id, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCreateSequenceLink(t *testing.T) {
+	last := int64(41)
+	g := sequenceShorts{prefix: "release-", next: func(prefix string) (int64, error) {
+		if prefix != "release-" {
+			t.Errorf("next(%q); want next(%q)", prefix, "release-")
+		}
+		last++
+		return last, nil
+	}}
+	// release-42 was created by hand after the number was allocated
+	create := func(link *Link) error {
+		if link.Short == "release-42" {
+			return fs.ErrExist
+		}
+		return nil
+	}
+	link := &Link{Long: "http://example.com/"}
+	if err := createGeneratedLink(g, link, create); err != nil {
+		t.Fatal(err)
+	}
+	if link.Short != "release-43" {
+		t.Errorf("created %q; want %q", link.Short, "release-43")
+	}
+}
+
+// TestNextInSequenceConcurrent allocates numbers in one sequence from many
+// goroutines at once, which must each get a different one.
+func TestNextInSequenceConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Save(&Link{Short: "release-7", Long: "https://example.com/7"}); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	got := make([]int64, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			got[i], err = db.NextInSequence("release-")
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// numbers continue from the highest existing link, with no gaps
+	slices.Sort(got)
+	for i, num := range got {
+		if want := int64(8 + i); num != want {
+			t.Fatalf("allocated %v; want 8 to %d", got, 8+n-1)
+		}
+	}
+}
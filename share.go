@@ -0,0 +1,161 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The share API at /.api/v1/share creates links from a phone's share sheet,
+// such as with an iOS Shortcut or an Android share target. It takes the
+// shared url, or text containing one, and an optional link name, and
+// responds with the go URL of the new link, ready to be copied. Phones
+// authenticate with a device token with the links:share scope.
+
+// reSharedURL matches a URL in shared text, such as the title and URL of a
+// page shared from a browser.
+var reSharedURL = regexp.MustCompile(`https?://\S+`)
+
+// sharedTarget returns the URL to create a link to from the url and text
+// fields of a share request, or "" if neither has an http or https URL.
+func sharedTarget(rawURL, text string) string {
+	if rawURL = strings.TrimSpace(rawURL); rawURL == "" {
+		rawURL = reSharedURL.FindString(text)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return rawURL
+}
+
+// shareResponse is the response to /.api/v1/share.
+type shareResponse struct {
+	Short string // name of the new link
+	URL   string // go URL of the new link, such as "http://go/abc123"
+}
+
+// serveShare creates a link to a shared URL, named by the optional "name"
+// value or with a generated name otherwise.
+func serveShare(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	long := sharedTarget(r.FormValue("url"), r.FormValue("text"))
+	if long == "" {
+		http.Error(w, "url required: share an http or https URL", http.StatusBadRequest)
+		return
+	}
+	if err := checkLinkTarget(long); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	short := strings.TrimSpace(r.FormValue("name"))
+	if short != "" && !reShortName.MatchString(short) {
+		http.Error(w, "name may only contain letters, numbers, dash, and period", http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	taggedTeam, err := tagTeamDefaults(cu)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// links are in the namespace of the team that cu's tags act for, if any
+	ns, login := "", cu.login
+	if taggedTeam != nil {
+		ns, login = taggedTeam.Namespace, teamOwnerPrefix+taggedTeam.Name
+	}
+	if short != "" {
+		short = inNamespace(short, ns)
+	}
+	if !authz.canCreate(r.Context(), cu, short) {
+		audit(r, cu, "access.denied", short, "share")
+		http.Error(w, "cannot create links", http.StatusForbidden)
+		return
+	}
+	if short != "" {
+		if n := reservedName(short); n != nil {
+			http.Error(w, reservedNameError(short, n), http.StatusBadRequest)
+			return
+		}
+	}
+	if !isRequestAuthorized(r, cu, newShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	owner, err := recordOwner(login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	link := &Link{
+		Long:     canonicalTarget(long, targetSupportsHTTPS),
+		Created:  now,
+		LastEdit: now,
+		Owner:    owner,
+		Editor:   editor,
+	}
+	if link.Long != long {
+		link.RawLong = long
+	}
+	quotas := !authz.canAdmin(cu)
+	create := func(link *Link) error {
+		link.Short = inNamespace(link.Short, ns)
+		return db.save(link, saveCreate, quotas)
+	}
+	if short == "" {
+		err = createAutoLink(link, create)
+	} else {
+		link.Short = short
+		err = db.save(link, saveCreate, quotas)
+	}
+	if errors.Is(err, fs.ErrExist) {
+		http.Error(w, fmt.Sprintf("%s is taken: choose another name, or leave it out to generate one", link.Short), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, errQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	linkChanges.Add("create", 1)
+	audit(r, cu, "link.save", link.Short, "long="+link.Long+" owner="+link.Owner)
+	notifyLinkChange(cu.login, nil, link)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shareResponse{
+		Short: link.Short,
+		URL:   "http://" + goHostname() + "/" + link.Short,
+	})
+}
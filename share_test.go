@@ -0,0 +1,28 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import "testing"
+
+func TestSharedTarget(t *testing.T) {
+	tests := []struct {
+		url, text string
+		want      string
+	}{
+		{url: "https://example.com/a?b=c", want: "https://example.com/a?b=c"},
+		{url: " http://example.com/ ", text: "https://other.example.com/", want: "http://example.com/"},
+		{text: "Design doc - Google Docs https://docs.example.com/d/123/edit", want: "https://docs.example.com/d/123/edit"},
+		{text: "https://a.example.com/ and https://b.example.com/", want: "https://a.example.com/"},
+		{text: "no link here"},
+		{url: "mailto:amelie@example.com"},
+		{url: "javascript:alert(1)"},
+		{url: "https://"},
+		{},
+	}
+	for _, tt := range tests {
+		if got := sharedTarget(tt.url, tt.text); got != tt.want {
+			t.Errorf("sharedTarget(%q, %q) = %q; want %q", tt.url, tt.text, got, tt.want)
+		}
+	}
+}
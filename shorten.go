@@ -0,0 +1,231 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// shortGenerator generates short names for links created without one.
+// Implementations are called again with increasing attempt numbers when a
+// generated name is already taken.
+type shortGenerator interface {
+	generate(attempt int) (string, error)
+}
+
+// randomShorts generates random short names from an alphabet.
+type randomShorts struct {
+	alphabet string
+	length   int
+}
+
+// generate returns a random short name. The name is lengthened by one
+// character for every few collisions, so that a crowded name space still
+// yields free names quickly.
+func (g randomShorts) generate(attempt int) (string, error) {
+	n := g.length + attempt/3
+	max := big.NewInt(int64(len(g.alphabet)))
+	var b strings.Builder
+	for range n {
+		i, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(g.alphabet[i.Int64()])
+	}
+	return b.String(), nil
+}
+
+// newRandomShorts returns a generator using the --auto-short-alphabet and
+// --auto-short-length settings. Because short names are matched ignoring case
+// and hyphens, the alphabet is limited to distinct lowercase letters and digits.
+func newRandomShorts(alphabet string, length int) (randomShorts, error) {
+	if len(alphabet) < 2 {
+		return randomShorts{}, errors.New("alphabet must have at least 2 characters")
+	}
+	for i, c := range alphabet {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return randomShorts{}, fmt.Errorf("alphabet may only contain lowercase letters and digits, not %q", c)
+		}
+		if strings.IndexRune(alphabet, c) != i {
+			return randomShorts{}, fmt.Errorf("alphabet contains %q more than once", c)
+		}
+	}
+	if length < 1 {
+		return randomShorts{}, errors.New("length must be at least 1")
+	}
+	return randomShorts{alphabet: alphabet, length: length}, nil
+}
+
+// autoShorts generates the short names of links created by /.api/v1/shorten.
+var autoShorts shortGenerator = randomShorts{alphabet: "abcdefghjkmnpqrstuvwxyz23456789", length: 6}
+
+// maxShortenAttempts is how many generated names are tried before giving up.
+const maxShortenAttempts = 10
+
+// createAutoLink saves link under a newly generated short name, retrying
+// with another name if the generated one is taken or reserved.
+func createAutoLink(link *Link, create func(*Link) error) error {
+	return createGeneratedLink(autoShorts, link, create)
+}
+
+// createGeneratedLink is like createAutoLink, but generates names with g.
+func createGeneratedLink(g shortGenerator, link *Link, create func(*Link) error) error {
+	for attempt := range maxShortenAttempts {
+		short, err := g.generate(attempt)
+		if err != nil {
+			return err
+		}
+		if reservedName(short) != nil {
+			continue
+		}
+		link.Short = short
+		err = create(link)
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	return errors.New("could not find a free short name")
+}
+
+// serveShorten creates a link to the "long" URL with a generated short name,
+// for callers that don't need to choose one. It returns the new link as JSON.
+//
+// If "prefix" is set, the link is instead named prefix followed by the next
+// number of its family, such as release-43 for release- after release-42,
+// so that release automation can create numbered links without racing.
+func serveShorten(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	long := r.FormValue("long")
+	if long == "" {
+		http.Error(w, "long required", http.StatusBadRequest)
+		return
+	}
+	if err := checkLinkTarget(long); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prefix := strings.TrimSpace(r.FormValue("prefix"))
+	if prefix != "" {
+		if err := checkSequencePrefix(prefix); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	maxUses, err := parseMaxUses(r.FormValue("max_uses"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expires, err := parseExpires(r.FormValue("expires"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canCreate(r.Context(), cu, "") {
+		audit(r, cu, "access.denied", "", "shorten")
+		http.Error(w, "cannot create links", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, newShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	taggedTeam, err := tagTeamDefaults(cu)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// generated names are in the global namespace, or the namespace of the
+	// team that cu's tags act for
+	ns, login := "", cu.login
+	if taggedTeam != nil {
+		ns, login = taggedTeam.Namespace, teamOwnerPrefix+taggedTeam.Name
+	}
+	owner, err := recordOwner(login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	editor, err := recordOwner(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	quotas := !authz.canAdmin(cu)
+	if quotas {
+		// checked again as the link is created, but first too so that no
+		// sequence number is used up; numbered links are in the namespace
+		// of their prefix
+		if err := checkQuotas(db, nil, inNamespace(prefix, ns), owner, editor, now); err != nil {
+			if errors.Is(err, errQuotaExceeded) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	link := &Link{
+		Long:        canonicalTarget(long, targetSupportsHTTPS),
+		Created:     now,
+		LastEdit:    now,
+		Owner:       owner,
+		AutoCreated: createsAutoLinks(cu),
+		Expires:     expires,
+		MaxUses:     maxUses,
+		Editor:      editor,
+	}
+	if link.Long != long {
+		link.RawLong = long
+	}
+	if _, ok := r.Form["tags"]; ok {
+		link.Tags = parseTags(r.FormValue("tags"))
+	}
+	create := func(link *Link) error {
+		link.Short = inNamespace(link.Short, ns)
+		return db.save(link, saveCreate, quotas)
+	}
+	var gen shortGenerator = autoShorts
+	if prefix != "" {
+		gen = sequenceShorts{prefix: inNamespace(prefix, ns), next: db.NextInSequence}
+	}
+	if err := createGeneratedLink(gen, link, create); errors.Is(err, errQuotaExceeded) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	linkChanges.Add("create", 1)
+	audit(r, cu, "link.save", link.Short, "long="+link.Long+" owner="+link.Owner)
+	notifyLinkChange(cu.login, nil, link)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestNewRandomShorts(t *testing.T) {
+	tests := []struct {
+		alphabet string
+		length   int
+		wantErr  bool
+	}{
+		{"abc123", 4, false},
+		{"a", 4, true},
+		{"abcA", 4, true},
+		{"ab-c", 4, true},
+		{"abca", 4, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		_, err := newRandomShorts(tt.alphabet, tt.length)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newRandomShorts(%q, %d) error = %v; want error %v", tt.alphabet, tt.length, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRandomShortsGenerate(t *testing.T) {
+	g, err := newRandomShorts("ab", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for attempt, wantLen := range []int{4, 4, 4, 5, 5, 5, 6} {
+		short, err := g.generate(attempt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(short) != wantLen {
+			t.Errorf("generate(%d) = %q; want length %d", attempt, short, wantLen)
+		}
+		if strings.Trim(short, "ab") != "" {
+			t.Errorf("generate(%d) = %q; want only characters from alphabet", attempt, short)
+		}
+	}
+}
+
+func TestCreateAutoLink(t *testing.T) {
+	taken := map[string]bool{"aa": true, "ab": true, "ba": true}
+	oldShorts := autoShorts
+	autoShorts = fixedShorts{"aa", "ab", "ba", "bb"}
+	defer func() { autoShorts = oldShorts }()
+
+	var tries int
+	create := func(link *Link) error {
+		tries++
+		if taken[link.Short] {
+			return fs.ErrExist
+		}
+		return nil
+	}
+	link := &Link{Long: "http://example.com/"}
+	if err := createAutoLink(link, create); err != nil {
+		t.Fatal(err)
+	}
+	if link.Short != "bb" || tries != 4 {
+		t.Errorf("created %q after %d tries; want %q after 4", link.Short, tries, "bb")
+	}
+
+	taken["bb"] = true
+	if err := createAutoLink(link, create); err == nil {
+		t.Error("createAutoLink with all names taken succeeded; want error")
+	}
+}
+
+// fixedShorts generates names from a list, repeating the last one.
+type fixedShorts []string
+
+func (f fixedShorts) generate(attempt int) (string, error) {
+	return f[min(attempt, len(f)-1)], nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// siteLink is a link in a static site export.
+type siteLink struct {
+	Short  string
+	Target string // destination with no additional path
+
+	// AppendPath is whether extra path elements are appended to Target,
+	// as they are for links that are not templates.
+	AppendPath bool
+}
+
+// siteData is the data used by the static site index and 404 pages.
+type siteData struct {
+	Exported time.Time
+	Links    []siteLink
+}
+
+// siteLinks returns the links that can be resolved by a static site, sorted
+// by short name. Links whose destination depends on the current user are
+// skipped.
+func siteLinks(links []*Link, now time.Time) []siteLink {
+	var out []siteLink
+	for _, link := range links {
+		u, err := expandLink(link.Long, expandEnv{Now: now})
+		if err != nil {
+			if !errors.Is(err, errNoUser) {
+				log.Printf("export-site: skipping %q: %v", link.Short, err)
+			}
+			continue
+		}
+		out = append(out, siteLink{
+			Short:      link.Short,
+			Target:     u.String(),
+			AppendPath: !strings.Contains(link.Long, "{{"),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Short < out[j].Short
+	})
+	return out
+}
+
+// exportSite writes a static mirror of all links to dir, suitable for
+// serving from static hosting as a read-only fallback resolver. Each link
+// has a redirect page at "/{short}/", and "/404.html" resolves differently
+// cased names and links with extra path elements using "/links.json".
+//
+// It returns the number of links exported.
+func exportSite(dir string) (int, error) {
+	links, err := db.LoadAll()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	data := siteData{Exported: now, Links: siteLinks(links, now)}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	redirectTmpl := newTemplate("site-redirect.html")
+	for _, l := range data.Links {
+		if err := writeSiteFile(dir, path.Join(l.Short, "index.html"), redirectTmpl, l); err != nil {
+			return 0, err
+		}
+	}
+	if err := writeSiteFile(dir, "index.html", newTemplate("base.html", "site-index.html"), data); err != nil {
+		return 0, err
+	}
+	if err := writeSiteFile(dir, "404.html", newTemplate("base.html", "site-404.html"), data); err != nil {
+		return 0, err
+	}
+
+	// links.json is keyed by link ID for lookups by the 404 page
+	byID := make(map[string]siteLink, len(data.Links))
+	for _, l := range data.Links {
+		byID[linkID(l.Short)] = l
+	}
+	b, err := json.Marshal(byID)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "links.json"), b, 0644); err != nil {
+		return 0, err
+	}
+
+	// copy static assets used by the index and 404 pages, and keep GitHub
+	// Pages from ignoring the .static directory
+	static, err := fs.Sub(embeddedFS, "static")
+	if err != nil {
+		return 0, err
+	}
+	staticDir := filepath.Join(dir, ".static")
+	if err := os.RemoveAll(staticDir); err != nil {
+		return 0, err
+	}
+	if err := os.CopyFS(staticDir, static); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".nojekyll"), nil, 0644); err != nil {
+		return 0, err
+	}
+	return len(data.Links), nil
+}
+
+// writeSiteFile executes t with data into the file name within dir.
+func writeSiteFile(dir, name string, t *template.Template, data any) error {
+	p := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	if err := t.Execute(f, data); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return f.Close()
+}
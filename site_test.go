@@ -0,0 +1,29 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSiteLinks(t *testing.T) {
+	links := []*Link{
+		{Short: "who", Long: "http://who/"},
+		{Short: "cs", Long: "https://cs.github.com/{{with .Path}}?q={{.}}{{end}}"},
+		{Short: "me", Long: "http://who/{{.User}}"},
+		{Short: "Docs", Long: "https://docs.example.com"},
+	}
+	want := []siteLink{
+		{Short: "Docs", Target: "https://docs.example.com", AppendPath: true},
+		{Short: "cs", Target: "https://cs.github.com/"},
+		{Short: "who", Target: "http://who/", AppendPath: true},
+	}
+	got := siteLinks(links, time.Now())
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("siteLinks mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sloLatencyBuckets are the upper bounds, in seconds, of the histogram
+// that resolve latency quantiles are estimated from.
+var sloLatencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// sloConfig is the --slo configuration.
+type sloConfig struct {
+	// Target is the fraction of resolves that must be good, such as 0.999,
+	// or 0 to track latency and errors without alerting.
+	Target float64
+
+	// Latency is the time within which a resolve must succeed to be good,
+	// or 0 to only count server errors as bad.
+	Latency time.Duration
+
+	// Window is the period burn rates are measured over. Alerts also
+	// require the burn rate over the last twelfth of it to be high, so that
+	// they resolve soon after errors stop.
+	Window time.Duration
+
+	// BurnRate is the rate at which the error budget may be spent before
+	// alerting, as a multiple of the rate that would spend exactly the
+	// budget, 1-Target.
+	BurnRate float64
+
+	// Unready makes /readyz fail while alerting.
+	Unready bool
+}
+
+// parseSLOConfig parses a semicolon-separated --slo configuration such as
+// "target=99.9;latency=250ms;window=1h;burn-rate=14.4;unready".
+func parseSLOConfig(s string) (sloConfig, error) {
+	c := sloConfig{Window: time.Hour, BurnRate: 14.4}
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		var err error
+		switch k {
+		case "target":
+			var pct float64
+			pct, err = strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			if err == nil && (pct <= 0 || pct >= 100) {
+				err = fmt.Errorf("must be between 0 and 100")
+			}
+			c.Target = pct / 100
+		case "latency":
+			c.Latency, err = time.ParseDuration(v)
+		case "window":
+			c.Window, err = time.ParseDuration(v)
+			if err == nil && c.Window < 12*time.Minute {
+				err = fmt.Errorf("must be at least 12m")
+			}
+		case "burn-rate":
+			c.BurnRate, err = strconv.ParseFloat(v, 64)
+			if err == nil && c.BurnRate <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "unready":
+			c.Unready = true
+		default:
+			return c, fmt.Errorf("unknown setting %q", k)
+		}
+		if err != nil {
+			return c, fmt.Errorf("%s: %v", k, err)
+		}
+	}
+	return c, nil
+}
+
+// sloBucket counts the resolves in a minute.
+type sloBucket struct {
+	minute       int64 // Unix time in minutes
+	total, bad   int64
+	errors       int64   // server errors, which are also bad
+	latencyCount []int64 // by sloLatencyBuckets, with a final overflow bucket
+}
+
+// sloTracker records the latency and outcome of link resolves in per-minute
+// buckets covering its window, and alerts when they spend the error budget
+// too fast.
+type sloTracker struct {
+	config sloConfig
+
+	mu       sync.Mutex
+	buckets  []sloBucket // ring indexed by minute
+	alerting bool
+}
+
+func newSLOTracker(config sloConfig) *sloTracker {
+	t := new(sloTracker)
+	t.configure(config)
+	return t
+}
+
+// configure replaces the tracker's configuration, discarding the resolves
+// recorded so far.
+func (t *sloTracker) configure(config sloConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.config = config
+	t.alerting = false
+	t.buckets = make([]sloBucket, config.Window/time.Minute)
+	for i := range t.buckets {
+		t.buckets[i].latencyCount = make([]int64, len(sloLatencyBuckets)+1)
+	}
+}
+
+// resolveSLO tracks link resolves, as configured by --slo.
+var resolveSLO = newSLOTracker(sloConfig{Window: time.Hour})
+
+// observe records a resolve that took d and responded with status.
+func (t *sloTracker) observe(now time.Time, d time.Duration, status int) {
+	minute := now.Unix() / 60
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[minute%int64(len(t.buckets))]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute, latencyCount: b.latencyCount}
+		clear(b.latencyCount)
+	}
+	b.total++
+	failed := status >= 500
+	if failed {
+		b.errors++
+	}
+	if failed || (t.config.Latency > 0 && d > t.config.Latency) {
+		b.bad++
+	}
+	i := 0
+	for i < len(sloLatencyBuckets) && d.Seconds() > sloLatencyBuckets[i] {
+		i++
+	}
+	b.latencyCount[i]++
+}
+
+// sloWindow summarizes the resolves in a period.
+type sloWindow struct {
+	total, bad, errors int64
+	latencyCount       []int64
+}
+
+// window returns the resolves in the d before now.
+func (t *sloTracker) window(now time.Time, d time.Duration) sloWindow {
+	w := sloWindow{latencyCount: make([]int64, len(sloLatencyBuckets)+1)}
+	minute := now.Unix() / 60
+	oldest := minute - int64(d/time.Minute)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, b := range t.buckets {
+		if b.minute <= oldest || b.minute > minute {
+			continue
+		}
+		w.total += b.total
+		w.bad += b.bad
+		w.errors += b.errors
+		for i, n := range b.latencyCount {
+			w.latencyCount[i] += n
+		}
+	}
+	return w
+}
+
+// quantile returns the upper bound of the latency bucket containing the q
+// quantile, or 0 if there were no resolves. Latencies over the largest
+// bucket are reported as its bound.
+func (w sloWindow) quantile(q float64) float64 {
+	if w.total == 0 {
+		return 0
+	}
+	rank := int64(q*float64(w.total-1)) + 1
+	var n int64
+	for i, c := range w.latencyCount[:len(sloLatencyBuckets)] {
+		if n += c; n >= rank {
+			return sloLatencyBuckets[i]
+		}
+	}
+	return sloLatencyBuckets[len(sloLatencyBuckets)-1]
+}
+
+// burnRate returns the rate that w spent the error budget of target, as a
+// multiple of the rate that spends exactly the budget.
+func (w sloWindow) burnRate(target float64) float64 {
+	if w.total == 0 || target <= 0 {
+		return 0
+	}
+	return float64(w.bad) / float64(w.total) / (1 - target)
+}
+
+// check updates whether the tracker is alerting, reporting changes in the
+// log and to webhooks.
+func (t *sloTracker) check(now time.Time) {
+	if t.config.Target <= 0 {
+		return
+	}
+	long := t.window(now, t.config.Window).burnRate(t.config.Target)
+	short := t.window(now, t.config.Window/12).burnRate(t.config.Target)
+	alerting := long >= t.config.BurnRate && short >= t.config.BurnRate
+
+	t.mu.Lock()
+	changed := alerting != t.alerting
+	t.alerting = alerting
+	t.mu.Unlock()
+	if !changed {
+		return
+	}
+	alert := &SLOAlert{
+		Target:   t.config.Target,
+		Window:   t.config.Window.String(),
+		BurnRate: long,
+	}
+	if alerting {
+		log.Printf("SLO alert: error budget burning at %.1fx over %v (threshold %.1fx)", long, t.config.Window, t.config.BurnRate)
+		notifySLO("slo.alert", alert)
+	} else {
+		log.Printf("SLO alert resolved: error budget burning at %.1fx over %v", long, t.config.Window)
+		notifySLO("slo.resolve", alert)
+	}
+}
+
+// ready reports whether /readyz should succeed.
+func (t *sloTracker) ready() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !(t.config.Unready && t.alerting)
+}
+
+// WritePrometheus writes the resolve latency quantiles, request and error
+// counts, and burn rate over the tracker's window to w, as expected by
+// tailscale.com/tsweb/varz.
+func (t *sloTracker) WritePrometheus(w io.Writer, name string) {
+	win := t.window(time.Now(), t.config.Window)
+	fmt.Fprintf(w, "# TYPE %s_resolve_latency_seconds gauge\n", name)
+	for _, q := range []float64{.5, .95, .99} {
+		fmt.Fprintf(w, "%s_resolve_latency_seconds{quantile=\"%v\"} %v\n", name, q, win.quantile(q))
+	}
+	fmt.Fprintf(w, "# TYPE %s_resolves gauge\n", name)
+	fmt.Fprintf(w, "%s_resolves %d\n", name, win.total)
+	fmt.Fprintf(w, "# TYPE %s_resolve_errors gauge\n", name)
+	fmt.Fprintf(w, "%s_resolve_errors %d\n", name, win.errors)
+	if t.config.Target > 0 {
+		fmt.Fprintf(w, "# TYPE %s_burn_rate gauge\n", name)
+		fmt.Fprintf(w, "%s_burn_rate %v\n", name, win.burnRate(t.config.Target))
+		t.mu.Lock()
+		alerting := 0
+		if t.alerting {
+			alerting = 1
+		}
+		t.mu.Unlock()
+		fmt.Fprintf(w, "# TYPE %s_alerting gauge\n", name)
+		fmt.Fprintf(w, "%s_alerting %d\n", name, alerting)
+	}
+}
+
+// String implements expvar.Var.
+func (t *sloTracker) String() string {
+	return `"sloTracker"`
+}
+
+// statusWriter is an http.ResponseWriter that records the response status.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// trackResolve serves a go link with serveGo, recording it in resolveSLO.
+func trackResolve(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w}
+	serveGo(sw, r)
+	resolveSLO.observe(start, time.Since(start), cmp.Or(sw.status, http.StatusOK))
+}
+
+// handleReadyCheck reports whether golink should receive traffic, which it
+// shouldn't while the --slo error budget burns too fast, if configured with
+// "unready".
+func handleReadyCheck(w http.ResponseWriter, r *http.Request) {
+	if !resolveSLO.ready() {
+		http.Error(w, "error budget burning too fast", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "OK")
+}
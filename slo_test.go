@@ -0,0 +1,107 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSLOConfig(t *testing.T) {
+	c, err := parseSLOConfig("target=99.9; latency=250ms;window=2h;burn-rate=6;unready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sloConfig{Target: .999, Latency: 250 * time.Millisecond, Window: 2 * time.Hour, BurnRate: 6, Unready: true}
+	if c.Target < .99899 || c.Target > .99901 {
+		t.Errorf("Target = %v; want .999", c.Target)
+	}
+	c.Target = want.Target
+	if c != want {
+		t.Errorf("parseSLOConfig = %+v; want %+v", c, want)
+	}
+
+	c, err = parseSLOConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Target != 0 || c.Window != time.Hour || c.BurnRate != 14.4 {
+		t.Errorf("default config = %+v", c)
+	}
+
+	for _, bad := range []string{"target=100", "target=abc", "window=5m", "burn-rate=0", "latency=fast", "budget=1"} {
+		if _, err := parseSLOConfig(bad); err == nil {
+			t.Errorf("parseSLOConfig(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestSLOTracker(t *testing.T) {
+	tr := newSLOTracker(sloConfig{Target: .99, Latency: 100 * time.Millisecond, Window: time.Hour, BurnRate: 10, Unready: true})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// an hour ago, which has left the window
+	tr.observe(now.Add(-time.Hour), time.Millisecond, http.StatusInternalServerError)
+	for range 90 {
+		tr.observe(now.Add(-30*time.Minute), 2*time.Millisecond, http.StatusFound)
+	}
+	for range 8 {
+		tr.observe(now.Add(-30*time.Minute), 200*time.Millisecond, http.StatusFound)
+	}
+	tr.observe(now.Add(-30*time.Minute), 3*time.Millisecond, http.StatusNotFound)
+	tr.observe(now, time.Millisecond, http.StatusInternalServerError)
+
+	w := tr.window(now, time.Hour)
+	if w.total != 100 || w.bad != 9 || w.errors != 1 {
+		t.Fatalf("window total, bad, errors = %d, %d, %d; want 100, 9, 1", w.total, w.bad, w.errors)
+	}
+	for q, want := range map[float64]float64{.5: .0025, .95: .25, .99: .25} {
+		if got := w.quantile(q); got != want {
+			t.Errorf("quantile(%v) = %v; want %v", q, got, want)
+		}
+	}
+	if got := w.burnRate(.99); got < 8.99 || got > 9.01 {
+		t.Errorf("burnRate = %v; want 9", got)
+	}
+
+	// burning over the last hour but not the last 5 minutes
+	tr.check(now)
+	if !tr.ready() {
+		t.Error("alerting on the long window alone")
+	}
+
+	// burning over both windows
+	for range 20 {
+		tr.observe(now, time.Millisecond, http.StatusBadGateway)
+	}
+	tr.check(now)
+	if tr.ready() {
+		t.Error("not alerting while burning over both windows")
+	}
+
+	// recovered in the short window
+	later := now.Add(6 * time.Minute)
+	for range 100 {
+		tr.observe(later, time.Millisecond, http.StatusFound)
+	}
+	tr.check(later)
+	if !tr.ready() {
+		t.Error("still alerting after the short window recovered")
+	}
+
+	var b strings.Builder
+	tr.WritePrometheus(&b, "golink_slo")
+	for _, want := range []string{
+		`golink_slo_resolve_latency_seconds{quantile="0.99"} `,
+		"golink_slo_resolve_errors ",
+		"golink_slo_burn_rate ",
+		"golink_slo_alerting 0",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, b.String())
+		}
+	}
+}
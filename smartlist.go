@@ -0,0 +1,186 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+// smartListsShortName is used as the short name for generating XSRF tokens
+// when saving or deleting smart lists.
+const smartListsShortName = ".lists"
+
+// smartListData is the data used by smartListTmpl.
+type smartListData struct {
+	List     *SmartList
+	Links    []*Link // the links on this page
+	XSRF     string
+	ReadOnly bool
+	pagination
+}
+
+// runSmartList returns the links matching a smart list's query, sorted by
+// short name.
+func runSmartList(l *SmartList) ([]*Link, error) {
+	q, err := parseLinkQuery(l.Query)
+	if err != nil {
+		return nil, err
+	}
+	cond, args, err := q.sql()
+	if err != nil {
+		return nil, err
+	}
+	if err := flushStats(); err != nil {
+		return nil, err
+	}
+	links, err := db.LoadWhere(cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Short < links[j].Short
+	})
+	return links, nil
+}
+
+// serveSmartLists returns the current user's smart lists as JSON, or saves or
+// deletes one of their smart lists on POST requests.
+func serveSmartLists(w http.ResponseWriter, r *http.Request) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cu.login == "" {
+		http.Error(w, "smart lists are only available to known users", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == "POST" {
+		serveSaveSmartList(w, r, cu)
+		return
+	}
+
+	lists, err := db.LoadSmartLists(cu.login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if acceptHTML(r) {
+		// smart lists are shown on the home page
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+// serveSmartList shows the links matching one of the current user's smart
+// lists.
+func serveSmartList(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/.lists/")
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	l, err := db.LoadSmartList(cu.login, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	links, err := runSmartList(l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !acceptHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(links)
+		return
+	}
+	data := smartListData{
+		List:     l,
+		XSRF:     xsrftoken.Generate(xsrfKey, cu.login, smartListsShortName),
+		ReadOnly: *readonly,
+	}
+	data.Links, data.pagination = paginate(r, links)
+	smartListTmpl.Execute(w, data)
+}
+
+// serveSaveSmartList saves or deletes one of the current user's smart lists.
+func serveSaveSmartList(w http.ResponseWriter, r *http.Request, cu user) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	if !isRequestAuthorized(r, cu, smartListsShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	if r.FormValue("delete") != "" {
+		err := db.DeleteSmartList(cu.login, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if acceptHTML(r) {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if !reShortName.MatchString(name) {
+		http.Error(w, "name may only contain letters, numbers, dash, and period", http.StatusBadRequest)
+		return
+	}
+	query := strings.TrimSpace(r.FormValue("q"))
+	q, err := parseLinkQuery(query)
+	if err == nil {
+		_, _, err = q.sql()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l := &SmartList{Owner: cu.login, Name: name, Query: query, Created: time.Now().UTC()}
+	if err := db.SaveSmartList(l); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if acceptHTML(r) {
+		http.Redirect(w, r, "/.lists/"+l.Name, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
@@ -0,0 +1,164 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// statsStreamBuffer is how many flushes a stats stream client may fall
+// behind before the oldest are dropped for it.
+const statsStreamBuffer = 16
+
+// statsStreamKeepalive is how often an idle stats stream sends a comment,
+// so that proxies don't close it.
+const statsStreamKeepalive = 30 * time.Second
+
+// statsFlush is the event sent to stats streams when clicks are saved.
+type statsFlush struct {
+	Time   time.Time
+	Clicks ClickStats // clicks of each link saved by the flush
+	Totals ClickStats // total clicks of the same links after the flush
+}
+
+// statsStreams fans out saved clicks to the clients of /.api/v1/stats/stream.
+var statsStreams = &statsBroadcaster{subs: make(map[chan statsFlush]bool)}
+
+// statsBroadcaster sends each statsFlush to every subscriber.
+type statsBroadcaster struct {
+	mu   sync.Mutex
+	subs map[chan statsFlush]bool
+}
+
+// subscribe returns a channel that receives each published flush, until it
+// is passed to unsubscribe.
+func (b *statsBroadcaster) subscribe() chan statsFlush {
+	ch := make(chan statsFlush, statsStreamBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[ch] = true
+	return ch
+}
+
+func (b *statsBroadcaster) unsubscribe(ch chan statsFlush) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, ch)
+}
+
+// active reports whether there are any subscribers, so that flushes needn't
+// be prepared for publishing when there are none.
+func (b *statsBroadcaster) active() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs) > 0
+}
+
+// publish sends f to every subscriber. Subscribers that have fallen
+// statsStreamBuffer flushes behind miss it, rather than holding up
+// flushing; the totals in later flushes let them catch up.
+func (b *statsBroadcaster) publish(f statsFlush) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- f:
+		default:
+		}
+	}
+}
+
+// publishFlush publishes the clicks saved by a flush to stats streams, along
+// with the totals of the links clicked.
+func publishFlush(saved ClickStats) {
+	if len(saved) == 0 || !statsStreams.active() {
+		return
+	}
+	f := statsFlush{Time: time.Now().UTC(), Clicks: saved, Totals: make(ClickStats, len(saved))}
+	stats.mu.Lock()
+	for short := range saved {
+		f.Totals[short] = stats.clicks[short]
+	}
+	stats.mu.Unlock()
+	statsStreams.publish(f)
+}
+
+// serveStatsStream handles GET /.api/v1/stats/stream, a server-sent event
+// stream that sends a JSON "clicks" event with the clicks of each link every
+// time stats are flushed, until the client disconnects. If link parameters
+// are given, such as ?link=docs&link=wiki, only those links are included,
+// and flushes without clicks of them are not sent.
+func serveStatsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	var only map[string]bool
+	if links := r.URL.Query()["link"]; len(links) > 0 {
+		only = make(map[string]bool)
+		for _, short := range links {
+			only[linkID(short)] = true
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{}) // the stream outlives any server write timeout
+	ch := statsStreams.subscribe()
+	defer statsStreams.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// send the headers now, rather than with the first flush
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	keepalive := time.NewTicker(statsStreamKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case f := <-ch:
+			if only != nil {
+				f = filterStatsFlush(f, only)
+				if len(f.Clicks) == 0 {
+					continue
+				}
+			}
+			b, err := json.Marshal(f)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: clicks\ndata: %s\n\n", b); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// filterStatsFlush returns the part of f for the links whose IDs are in ids.
+func filterStatsFlush(f statsFlush, ids map[string]bool) statsFlush {
+	filtered := statsFlush{Time: f.Time, Clicks: make(ClickStats), Totals: make(ClickStats)}
+	for short, n := range f.Clicks {
+		if ids[linkID(short)] {
+			filtered.Clicks[short] = n
+			filtered.Totals[short] = f.Totals[short]
+		}
+	}
+	return filtered
+}
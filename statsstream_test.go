@@ -0,0 +1,74 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatsBroadcaster(t *testing.T) {
+	b := &statsBroadcaster{subs: make(map[chan statsFlush]bool)}
+	if b.active() {
+		t.Fatal("broadcaster with no subscribers is active")
+	}
+	ch := b.subscribe()
+	for i := range statsStreamBuffer + 1 {
+		b.publish(statsFlush{Clicks: ClickStats{"a": i}})
+	}
+	// the flush that didn't fit is dropped, rather than blocking publish
+	if len(ch) != statsStreamBuffer {
+		t.Errorf("subscriber has %d flushes; want %d", len(ch), statsStreamBuffer)
+	}
+	b.unsubscribe(ch)
+	if b.active() {
+		t.Error("broadcaster is active after unsubscribing")
+	}
+}
+
+func TestServeStatsStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(serveStatsStream))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?link=Docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Content-Type = %q; want text/event-stream", got)
+	}
+
+	// wait until the stream has subscribed
+	for !statsStreams.active() {
+		time.Sleep(time.Millisecond)
+	}
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	statsStreams.publish(statsFlush{Time: now, Clicks: ClickStats{"wiki": 1}, Totals: ClickStats{"wiki": 10}})
+	statsStreams.publish(statsFlush{Time: now, Clicks: ClickStats{"docs": 2, "wiki": 1}, Totals: ClickStats{"docs": 5, "wiki": 11}})
+
+	sc := bufio.NewScanner(resp.Body)
+	var data string
+	for sc.Scan() {
+		if d, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			data = d
+			break
+		}
+	}
+	var got statsFlush
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("decoding %q: %v", data, err)
+	}
+	want := statsFlush{Time: now, Clicks: ClickStats{"docs": 2}, Totals: ClickStats{"docs": 5}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("clicks event mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSuggestions is the most links suggested in place of a missing link.
+const maxSuggestions = 5
+
+// suggestionRefresh is how long the cached links used for suggestions are
+// used before being reloaded from db.
+const suggestionRefresh = time.Minute
+
+// suggestionCache caches the links that may be suggested in place of a
+// missing link, so that each missing link does not load every link.
+var suggestionCache struct {
+	mu     sync.Mutex
+	links  []*Link
+	ids    []string // linkID of each of links
+	loaded time.Time
+}
+
+// suggestableLinks returns the cached links that may be suggested and their
+// link IDs, reloading them from db if the cache is stale. One-time and
+// expired links are never suggested.
+//
+// The returned values must not be modified.
+func suggestableLinks() ([]*Link, []string) {
+	suggestionCache.mu.Lock()
+	defer suggestionCache.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(suggestionCache.loaded) >= suggestionRefresh {
+		links, err := db.LoadAll()
+		if err != nil {
+			log.Printf("loading links for suggestions: %v", err)
+		} else {
+			links = slices.DeleteFunc(links, func(l *Link) bool { return l.MaxUses > 0 || linkExpired(l, now) })
+			ids := make([]string, len(links))
+			for i, link := range links {
+				ids[i] = linkID(link.Short)
+			}
+			suggestionCache.links, suggestionCache.ids = links, ids
+			suggestionCache.loaded = now
+		}
+	}
+	return suggestionCache.links, suggestionCache.ids
+}
+
+// invalidateSuggestions causes the next call to suggestableLinks to reload
+// from db.
+func invalidateSuggestions() {
+	suggestionCache.mu.Lock()
+	defer suggestionCache.mu.Unlock()
+	suggestionCache.loaded = time.Time{}
+}
+
+// fuzzySuggestions returns up to limit links whose short names are close to
+// short, best first. Names within a small edit distance of short come
+// first, nearest first, followed by names that start with short or that
+// short starts with. Names are compared by link ID, so case and dashes are
+// ignored.
+func fuzzySuggestions(short string, limit int) []*Link {
+	target := linkID(short)
+	maxDist := 1
+	if len(target) >= 5 {
+		maxDist = 2
+	}
+
+	type match struct {
+		link *Link
+		rank int
+	}
+	var matches []match
+	links, ids := suggestableLinks()
+	for i, id := range ids {
+		if id == target {
+			continue
+		}
+		// names of very different lengths can't be close, so skip measuring
+		if abs(len(id)-len(target)) <= maxDist {
+			if d := editDistance(id, target); d <= maxDist {
+				matches = append(matches, match{links[i], d})
+				continue
+			}
+		}
+		if min(len(id), len(target)) >= 3 && (strings.HasPrefix(id, target) || strings.HasPrefix(target, id)) {
+			matches = append(matches, match{links[i], maxDist + 1})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].rank != matches[j].rank {
+			return matches[i].rank < matches[j].rank
+		}
+		return matches[i].link.Short < matches[j].link.Short
+	})
+	var suggestions []*Link
+	for _, m := range matches[:min(limit, len(matches))] {
+		suggestions = append(suggestions, m.link)
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b: the number
+// of single character insertions, deletions, and substitutions needed to
+// change one into the other.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := range ra {
+		cur[0] = i + 1
+		for j := range rb {
+			cost := 1
+			if ra[i] == rb[j] {
+				cost = 0
+			}
+			cur[j+1] = min(prev[j+1]+1, cur[j]+1, prev[j]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// suggestLinks returns up to maxSuggestions links to suggest in place of the
+// missing link short: those found using the synonym dictionary, followed by
+// those with similar names. Errors are logged rather than returned.
+func suggestLinks(short string) []*Link {
+	links, err := synonymSuggestions(short)
+	if err != nil {
+		log.Printf("suggesting links for %q: %v", short, err)
+	}
+	for _, link := range fuzzySuggestions(short, maxSuggestions) {
+		if !slices.ContainsFunc(links, func(l *Link) bool { return linkID(l.Short) == linkID(link.Short) }) {
+			links = append(links, link)
+		}
+	}
+	return links[:min(maxSuggestions, len(links))]
+}
+
+// notFoundResponse is the JSON body of a response to an API client for a
+// link that does not exist.
+type notFoundResponse struct {
+	Error       string
+	Suggestions []ambiguousCandidate `json:",omitempty"`
+}
+
+// serveNotFoundJSON responds to an API client that the link short does not
+// exist, suggesting links that may have been meant. Suggested URLs keep the
+// request's path after the short name and its query.
+func serveNotFoundJSON(w http.ResponseWriter, r *http.Request, short, remainder string) {
+	resp := notFoundResponse{Error: "link not found"}
+	for _, link := range suggestLinks(short) {
+		resp.Suggestions = append(resp.Suggestions, linkCandidate(r, remainder, link))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(resp)
+}
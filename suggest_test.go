@@ -0,0 +1,99 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"oncall", "oncall", 0},
+		{"oncal", "oncall", 1},
+		{"oncall", "onclal", 2},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"café", "cafe", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d; want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d; want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestLinks(t *testing.T) {
+	db = newTestDB(t)
+	t.Cleanup(invalidateSuggestions)
+	t.Cleanup(invalidateSynonyms)
+	for _, short := range []string{"oncall", "oncall-rota", "on-call-sre", "roadmap", "wiki", "k8s"} {
+		db.Save(&Link{Short: short, Long: "https://example.com/" + short})
+	}
+	db.Save(&Link{Short: "roadmaps", Long: "https://example.com/", MaxUses: 1})
+	db.Save(&Link{Short: "roadmap-old", Long: "https://example.com/", Expires: time.Now().Add(-time.Hour)})
+	db.SaveSynonyms("k8s", []string{"kubernetes"})
+	invalidateSuggestions()
+	invalidateSynonyms()
+
+	tests := []struct {
+		short string
+		want  []string
+	}{
+		{"oncal", []string{"oncall", "on-call-sre", "oncall-rota"}},
+		{"oncal-rota", []string{"oncall-rota"}},
+		{"onclal", []string{"oncall"}},
+		{"roadmp", []string{"roadmap"}}, // one-time and expired links are not suggested
+		{"wik", []string{"wiki"}},
+		{"kubernetes", []string{"k8s"}},
+		{"zzz", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, link := range suggestLinks(tt.short) {
+			got = append(got, link.Short)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("suggestLinks(%q) mismatch (-want +got):\n%s", tt.short, diff)
+		}
+	}
+}
+
+func TestServeNotFoundJSON(t *testing.T) {
+	db = newTestDB(t)
+	t.Cleanup(invalidateSuggestions)
+	db.Save(&Link{Short: "oncall", Long: "https://example.com/oncall"})
+	invalidateSuggestions()
+
+	r := httptest.NewRequest("GET", "/oncal/today?tz=utc", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	serveGo(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("GET /oncal/today = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	var got notFoundResponse
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := notFoundResponse{
+		Error:       "link not found",
+		Suggestions: []ambiguousCandidate{{Short: "oncall", Long: "https://example.com/oncall", URL: "/oncall/today?tz=utc"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("GET /oncal/today mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,466 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// syncManifest is a declarative list of links, such as one kept in a git
+// repository, that golink keeps the database in line with. It is read from
+// --sync-file or POSTed to /.api/v1/sync, as JSON or YAML.
+type syncManifest struct {
+	// Tag is added to every link in the manifest, and marks the links it
+	// manages: pruning only deletes links with the tag that the manifest
+	// no longer lists.
+	Tag string
+
+	// Owner owns links that don't set their own.
+	Owner string
+
+	Links []syncLink
+}
+
+// syncLink is a link in a syncManifest. Fields have the same meaning as in
+// Link, and are left empty on the link if they are omitted.
+type syncLink struct {
+	Short       string
+	Long        string
+	Owner       string   `json:",omitempty"`
+	Tags        []string `json:",omitempty"`
+	CoOwners    []string `json:",omitempty"`
+	Fallbacks   []string `json:",omitempty"`
+	Params      string   `json:",omitempty"`
+	HealthCheck string   `json:",omitempty"`
+}
+
+// maxSyncManifestSize limits the size of sync manifests.
+const maxSyncManifestSize = 16 << 20
+
+// parseSyncManifest parses a JSON sync manifest, or a YAML one if isYAML is
+// set. Unknown fields are rejected, so that typos don't silently leave links
+// unmanaged.
+func parseSyncManifest(r io.Reader, isYAML bool) (*syncManifest, error) {
+	r = io.LimitReader(r, maxSyncManifestSize)
+	if isYAML {
+		// YAML manifests are converted to JSON, so that both formats
+		// match field names the same way
+		var v any
+		if err := yaml.NewDecoder(r).Decode(&v); err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var m syncManifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	tags := parseTags(m.Tag)
+	if len(tags) != 1 {
+		return nil, errors.New("manifest Tag must be a single tag, such as \"gitops\"")
+	}
+	m.Tag = tags[0]
+	return &m, nil
+}
+
+// syncChange reports what syncing did, or would do, to one link.
+type syncChange struct {
+	Short  string
+	Action string   // create, update, delete, invalid, or failed
+	Fields []string `json:",omitempty"` // the fields an update changes
+	Error  string   `json:",omitempty"`
+}
+
+// syncReport is the result of syncing a manifest, and the response to
+// /.api/v1/sync.
+type syncReport struct {
+	DryRun    bool `json:",omitempty"`
+	Created   int
+	Updated   int
+	Deleted   int
+	Unchanged int
+	Failed    int          // invalid or failed
+	Changes   []syncChange // links that were, or would be, changed or failed
+}
+
+// syncLinks reconciles the database with m: links it lists are created if
+// missing and updated if they differ, and if prune is set, links with the
+// manifest's tag that it doesn't list are deleted. Changes are recorded as
+// made by editor, a login, and are only reported if dryRun is set.
+//
+// Links are synced one at a time, so a failed link, such as one that would
+// exceed a quota, doesn't stop the rest.
+func syncLinks(m *syncManifest, editor string, dryRun, prune bool, now time.Time) (*syncReport, error) {
+	report := &syncReport{DryRun: dryRun}
+	storedEditor := ""
+	if editor != "" {
+		var err error
+		if storedEditor, err = recordOwner(editor); err != nil {
+			return nil, err
+		}
+	}
+	add := func(c syncChange) {
+		switch c.Action {
+		case "create":
+			report.Created++
+		case "update":
+			report.Updated++
+		case "delete":
+			report.Deleted++
+		default:
+			report.Failed++
+		}
+		report.Changes = append(report.Changes, c)
+	}
+
+	listed := make(map[string]bool)
+	for _, sl := range m.Links {
+		id := linkID(sl.Short)
+		if sl.Short != "" && listed[id] {
+			add(syncChange{Short: sl.Short, Action: "invalid", Error: "listed more than once"})
+			continue
+		}
+		listed[id] = true
+		c, err := syncLink1(m, sl, editor, storedEditor, dryRun, now)
+		if err != nil {
+			c.Error = err.Error()
+		}
+		if c.Action == "" {
+			report.Unchanged++
+			continue
+		}
+		add(c)
+	}
+
+	if prune {
+		links, err := db.LoadByTag(m.Tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, link := range links {
+			if listed[linkID(link.Short)] {
+				continue
+			}
+			c := syncChange{Short: link.Short, Action: "delete"}
+			if !dryRun {
+				if err := db.Delete(link.Short, storedEditor); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					c.Action, c.Error = "failed", err.Error()
+				} else {
+					deleteLinkStats(link)
+					linkChanges.Add("delete", 1)
+					linkTemplates.invalidate(link.Short)
+					notifyLinkChange(editor, link, nil)
+				}
+			}
+			add(c)
+		}
+	}
+	return report, nil
+}
+
+// syncLink1 creates or updates the link sl of manifest m, returning the
+// change, with an empty Action if the link is already up to date.
+func syncLink1(m *syncManifest, sl syncLink, editor, storedEditor string, dryRun bool, now time.Time) (syncChange, error) {
+	c := syncChange{Short: sl.Short, Action: "invalid"}
+	if sl.Short == "" || sl.Long == "" {
+		return c, errors.New("Short and Long required")
+	}
+	if !reShortName.MatchString(sl.Short) {
+		return c, errors.New("short may only contain letters, numbers, dash, and period")
+	}
+	if n := reservedName(sl.Short); n != nil {
+		return c, errors.New(reservedNameError(sl.Short, n))
+	}
+	if err := checkLinkTarget(sl.Long); err != nil {
+		return c, err
+	}
+	hc, err := parseHealthCheck(sl.HealthCheck)
+	if err == nil {
+		err = checkHealthCheck(hc, sl.Long)
+	}
+	if err != nil {
+		return c, err
+	}
+	owner := cmp.Or(sl.Owner, m.Owner)
+	if owner == "" {
+		return c, errors.New("no Owner, and the manifest has no default Owner")
+	}
+	coOwners := slices.Clone(sl.CoOwners)
+	for i, co := range coOwners {
+		coOwners[i] = storedOwner(co)
+	}
+	slices.Sort(coOwners)
+	coOwners = slices.Compact(coOwners)
+	want := &Link{
+		Short:       sl.Short,
+		Long:        sl.Long,
+		Owner:       storedOwner(owner),
+		Tags:        parseTags(strings.Join(append(slices.Clone(sl.Tags), m.Tag), " ")),
+		CoOwners:    coOwners,
+		Fallbacks:   parseFallbacks(strings.Join(sl.Fallbacks, "\n")),
+		Params:      strings.TrimSpace(sl.Params),
+		HealthCheck: hc.String(),
+	}
+
+	c.Action = "failed"
+	current, err := db.Load(sl.Short)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, err := db.LoadAlias(sl.Short); err == nil {
+			c.Action = "invalid"
+			return c, errors.New("short name was merged into another link")
+		}
+		c.Action = "create"
+		if dryRun {
+			if err := checkQuotas(db, nil, sl.Short, want.Owner, storedEditor, now); err != nil {
+				c.Action = "failed"
+				return c, err
+			}
+			return c, nil
+		}
+		want.Created = now
+		if err := saveSyncedLink(want, owner, coOwners, sl.CoOwners, storedEditor, now, nil); err != nil {
+			c.Action = "failed"
+			return c, err
+		}
+		notifyLinkChange(editor, nil, want)
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	c.Fields = syncDiff(current, want)
+	if len(c.Fields) == 0 {
+		c.Action = ""
+		return c, nil
+	}
+	c.Action = "update"
+	if dryRun {
+		if err := checkQuotas(db, current, sl.Short, want.Owner, storedEditor, now); err != nil {
+			c.Action = "failed"
+			return c, err
+		}
+		return c, nil
+	}
+	link := current.clone()
+	link.Long, link.Tags, link.Fallbacks, link.Params, link.HealthCheck = want.Long, want.Tags, want.Fallbacks, want.Params, want.HealthCheck
+	if err := saveSyncedLink(link, owner, coOwners, sl.CoOwners, storedEditor, now, current); err != nil {
+		c.Action = "failed"
+		return c, err
+	}
+	notifyLinkChange(editor, current, link)
+	return c, nil
+}
+
+// syncDiff returns the names of the fields of current that differ from
+// want, which has the destination as entered and owners in stored form.
+func syncDiff(current, want *Link) []string {
+	var fields []string
+	diff := func(name string, differ bool) {
+		if differ {
+			fields = append(fields, name)
+		}
+	}
+	diff("Long", cmp.Or(current.RawLong, current.Long) != want.Long)
+	diff("Owner", current.Owner != want.Owner)
+	diff("Tags", !slices.Equal(current.Tags, want.Tags))
+	diff("CoOwners", !slices.Equal(current.CoOwners, want.CoOwners))
+	diff("Fallbacks", !slices.Equal(current.Fallbacks, want.Fallbacks))
+	diff("Params", current.Params != want.Params)
+	diff("HealthCheck", current.HealthCheck != want.HealthCheck)
+	return fields
+}
+
+// saveSyncedLink records link's owner and co-owners, whose logins are given,
+// and creates link, or updates it if current is its stored version, within
+// quotas.
+func saveSyncedLink(link *Link, owner string, storedCoOwners, coOwners []string, editor string, now time.Time, current *Link) error {
+	var err error
+	if link.Owner, err = recordOwner(owner); err != nil {
+		return err
+	}
+	for _, co := range coOwners {
+		if _, err := recordOwner(co); err != nil {
+			return err
+		}
+	}
+	link.CoOwners = storedCoOwners
+	long := link.Long
+	link.Long = canonicalTarget(long, targetSupportsHTTPS)
+	link.RawLong = ""
+	if link.Long != long {
+		link.RawLong = long
+	}
+	link.LastEdit = now
+	link.Editor = editor
+	if current == nil {
+		if err := db.save(link, saveCreate, true); errors.Is(err, fs.ErrExist) {
+			return errors.New("created concurrently")
+		} else if err != nil {
+			return err
+		}
+	} else if err := db.save(link, saveUpdate, true); err != nil {
+		// the version check fails if the link was edited since it was loaded
+		return err
+	}
+	linkTemplates.invalidate(link.Short)
+	action := "edit"
+	if current == nil {
+		action = "create"
+	}
+	linkChanges.Add(action, 1)
+	return nil
+}
+
+// readSyncFile reads the --sync-file manifest.
+func readSyncFile() (*syncManifest, error) {
+	f, err := os.Open(*syncFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ext := strings.ToLower(filepath.Ext(*syncFile))
+	m, err := parseSyncManifest(f, ext == ".yaml" || ext == ".yml")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", *syncFile, err)
+	}
+	return m, nil
+}
+
+// syncFromFile is the link-sync job, which syncs --sync-file.
+func syncFromFile() error {
+	m, err := readSyncFile()
+	if err != nil {
+		return err
+	}
+	report, err := syncLinks(m, "", false, *syncPrune, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if report.Created+report.Updated+report.Deleted+report.Failed > 0 {
+		log.Printf("link sync from %s: created %d, updated %d, deleted %d, failed %d", *syncFile, report.Created, report.Updated, report.Deleted, report.Failed)
+	}
+	for _, c := range report.Changes {
+		if c.Error != "" {
+			log.Printf("link sync: %s: %s", c.Short, c.Error)
+		}
+	}
+	if report.Failed > 0 {
+		return fmt.Errorf("%d links failed to sync", report.Failed)
+	}
+	return nil
+}
+
+// runSyncCommand implements "golink sync [check]", which syncs --sync-file
+// once, or with "check", prints the changes it would make without making
+// them.
+func runSyncCommand(args []string, w io.Writer) error {
+	checkOnly := len(args) == 1 && args[0] == "check"
+	if len(args) > 0 && !checkOnly {
+		return errors.New("usage: golink sync [check]")
+	}
+	if *syncFile == "" {
+		return errors.New("golink sync requires --sync-file")
+	}
+	m, err := readSyncFile()
+	if err != nil {
+		return err
+	}
+	report, err := syncLinks(m, "", checkOnly, *syncPrune, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	for _, c := range report.Changes {
+		line := fmt.Sprintf("%-7s %s", c.Action, c.Short)
+		if len(c.Fields) > 0 {
+			line += " (" + strings.Join(c.Fields, ", ") + ")"
+		}
+		if c.Error != "" {
+			line += ": " + c.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+	verb := "synced"
+	if checkOnly {
+		verb = "would sync"
+	}
+	fmt.Fprintf(w, "%s %d links: %d created, %d updated, %d deleted, %d unchanged, %d failed\n",
+		verb, len(m.Links), report.Created, report.Updated, report.Deleted, report.Unchanged, report.Failed)
+	if report.Failed > 0 {
+		return fmt.Errorf("%d links failed to sync", report.Failed)
+	}
+	return nil
+}
+
+// serveSync handles POST /.api/v1/sync, which syncs the manifest in the
+// request body, which is YAML if its Content-Type says so and otherwise JSON. "dry_run" reports the changes without making them,
+// and "prune" deletes links with the manifest's tag that it doesn't list.
+// Only admins may sync links, since manifests set their owners.
+func serveSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	prune, _ := strconv.ParseBool(r.URL.Query().Get("prune"))
+	if *readonly && !dryRun {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "sync")
+		http.Error(w, "only admins can sync links", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, ".sync") {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isYAML := mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml"
+	m, err := parseSyncManifest(http.MaxBytesReader(w, r.Body, maxSyncManifestSize), isYAML)
+	if err != nil {
+		http.Error(w, "reading manifest: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := syncLinks(m, cu.login, dryRun, prune, time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !dryRun {
+		audit(r, cu, "link.sync", "", fmt.Sprintf("tag=%s created=%d updated=%d deleted=%d failed=%d", m.Tag, report.Created, report.Updated, report.Deleted, report.Failed))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
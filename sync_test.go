@@ -0,0 +1,126 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseSyncManifest(t *testing.T) {
+	want := &syncManifest{
+		Tag:   "gitops",
+		Owner: "platform",
+		Links: []syncLink{
+			{Short: "docs", Long: "https://docs.example.com/", Tags: []string{"eng"}},
+			{Short: "oncall", Long: "https://pager.example.com/", Owner: "sre", HealthCheck: "status=302"},
+		},
+	}
+	tests := []struct {
+		name    string
+		in      string
+		isYAML  bool
+		want    *syncManifest
+		wantErr string
+	}{
+		{
+			name: "json",
+			in: `{"Tag": "GitOps", "Owner": "platform", "Links": [
+				{"Short": "docs", "Long": "https://docs.example.com/", "Tags": ["eng"]},
+				{"Short": "oncall", "Long": "https://pager.example.com/", "Owner": "sre", "HealthCheck": "status=302"}]}`,
+			want: want,
+		},
+		{
+			name: "yaml",
+			in: `
+tag: gitops
+owner: platform
+links:
+  - short: docs
+    long: https://docs.example.com/
+    tags: [eng]
+  - short: oncall
+    long: https://pager.example.com/
+    owner: sre
+    healthcheck: status=302
+`,
+			isYAML: true,
+			want:   want,
+		},
+		{
+			name:    "unknown field",
+			in:      `{"Tag": "gitops", "Links": [{"Short": "docs", "URL": "https://docs.example.com/"}]}`,
+			wantErr: "unknown field",
+		},
+		{
+			name:    "yaml unknown field",
+			in:      "tag: gitops\nlinks:\n  - short: docs\n    url: https://docs.example.com/\n",
+			isYAML:  true,
+			wantErr: "unknown field",
+		},
+		{
+			name:    "no tag",
+			in:      `{"Links": []}`,
+			wantErr: "single tag",
+		},
+		{
+			name:    "several tags",
+			in:      `{"Tag": "gitops eng", "Links": []}`,
+			wantErr: "single tag",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSyncManifest(strings.NewReader(tt.in), tt.isYAML)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseSyncManifest() error = %v; want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("parseSyncManifest() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSyncDiff(t *testing.T) {
+	want := &Link{
+		Short:     "docs",
+		Long:      "http://docs.example.com/",
+		Owner:     "platform",
+		Tags:      []string{"eng", "gitops"},
+		Fallbacks: []string{"https://mirror.example.com/"},
+	}
+	tests := []struct {
+		name    string
+		current *Link
+		want    []string
+	}{
+		{"same", want.clone(), nil},
+		{
+			name: "canonicalized destination",
+			current: &Link{Short: "docs", Long: "https://docs.example.com/", RawLong: "http://docs.example.com/",
+				Owner: "platform", Tags: []string{"eng", "gitops"}, Fallbacks: []string{"https://mirror.example.com/"}},
+		},
+		{
+			name:    "drifted",
+			current: &Link{Short: "docs", Long: "https://wiki.example.com/", Owner: "alice", Tags: []string{"gitops"}, Params: "x=1"},
+			want:    []string{"Long", "Owner", "Tags", "Fallbacks", "Params"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, syncDiff(tt.current, want)); diff != "" {
+				t.Errorf("syncDiff() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// synonymRefresh is how long the cached synonym dictionary is used before
+// being reloaded from db.
+const synonymRefresh = 30 * time.Second
+
+// synonymCache caches the synonym dictionary, so that searches and missing
+// links do not require an extra database query.
+var synonymCache struct {
+	mu     sync.Mutex
+	index  map[string][]string // word to its synonyms, in both directions
+	loaded time.Time
+}
+
+// synonymsOf returns the synonyms of word, sorted, reloading the dictionary
+// from db if the cache is stale. Synonyms go both ways, so if k8s has the
+// synonym kubernetes, then kubernetes also has the synonym k8s.
+func synonymsOf(word string) []string {
+	synonymCache.mu.Lock()
+	defer synonymCache.mu.Unlock()
+
+	if now := time.Now(); now.Sub(synonymCache.loaded) >= synonymRefresh {
+		synonyms, err := db.LoadSynonyms()
+		if err != nil {
+			log.Printf("loading synonyms: %v", err)
+		} else {
+			synonymCache.index = synonymIndex(synonyms)
+			synonymCache.loaded = now
+		}
+	}
+	return synonymCache.index[strings.ToLower(word)]
+}
+
+// invalidateSynonyms causes the next call to synonymsOf to reload from db.
+func invalidateSynonyms() {
+	synonymCache.mu.Lock()
+	defer synonymCache.mu.Unlock()
+	synonymCache.loaded = time.Time{}
+}
+
+// synonymIndex returns the synonyms of each word in the dictionary
+// synonyms, adding the reverse of each entry.
+func synonymIndex(synonyms map[string][]string) map[string][]string {
+	index := make(map[string][]string)
+	for term, words := range synonyms {
+		for _, w := range words {
+			index[term] = append(index[term], w)
+			index[w] = append(index[w], term)
+		}
+	}
+	for w, words := range index {
+		slices.Sort(words)
+		index[w] = slices.Compact(words)
+	}
+	return index
+}
+
+// reShortWord matches the words of a short name, which are separated by
+// dashes, underscores, and dots.
+var reShortWord = regexp.MustCompile(`[^-_.]+`)
+
+// synonymSuggestions returns the links named like short with one of its words
+// replaced by a synonym, such as go/kubernetes-dashboard for a missing
+// go/k8s-dashboard, sorted by short name. One-time and expired links are
+// never suggested.
+func synonymSuggestions(short string) ([]*Link, error) {
+	candidates := slices.Clone(synonymsOf(short))
+	for _, m := range reShortWord.FindAllStringIndex(short, -1) {
+		if m[0] == 0 && m[1] == len(short) {
+			break // the whole short name, handled above
+		}
+		for _, syn := range synonymsOf(short[m[0]:m[1]]) {
+			candidates = append(candidates, short[:m[0]]+syn+short[m[1]:])
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	b := new(sqlBuilder)
+	ps := make([]string, len(candidates))
+	for i, c := range candidates {
+		ps[i] = b.arg(linkID(c))
+	}
+	links, err := db.LoadWhere("ID IN ("+strings.Join(ps, ", ")+")", b.args...)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	links = slices.DeleteFunc(links, func(l *Link) bool { return l.MaxUses > 0 || linkExpired(l, now) })
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Short < links[j].Short
+	})
+	return links, nil
+}
+
+// synonymsRequest is the body of a request to set a term's synonyms.
+type synonymsRequest struct {
+	Synonyms []string
+}
+
+// synonymsResponse describes the synonyms of a term.
+type synonymsResponse struct {
+	Term     string
+	Synonyms []string
+}
+
+// serveSynonyms serves the synonym dictionary used by search and missing
+// link suggestions.
+//
+// GET /.api/v1/synonyms returns the dictionary as an object mapping each term
+// to its synonyms. PUT /.api/v1/synonyms/{term} sets the synonyms of term,
+// and DELETE /.api/v1/synonyms/{term} removes them. Only admins may change
+// the dictionary.
+func serveSynonyms(w http.ResponseWriter, r *http.Request) {
+	term, hasTerm := strings.CutPrefix(r.URL.Path, "/.api/v1/synonyms/")
+	term = strings.ToLower(strings.TrimSpace(term))
+	if hasTerm && (term == "" || strings.Contains(term, "/")) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == "GET" || r.Method == "HEAD" {
+		synonyms, err := db.LoadSynonyms()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var resp any = synonyms
+		if hasTerm {
+			if len(synonyms[term]) == 0 {
+				http.Error(w, "no synonyms for "+term, http.StatusNotFound)
+				return
+			}
+			resp = synonymsResponse{Term: term, Synonyms: synonyms[term]}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	if !hasTerm {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Method != "PUT" && r.Method != "DELETE" {
+		http.Error(w, "PUT or DELETE required", http.StatusMethodNotAllowed)
+		return
+	}
+	if strings.ContainsFunc(term, unicode.IsSpace) {
+		http.Error(w, "terms must be single words", http.StatusBadRequest)
+		return
+	}
+	var req synonymsRequest
+	if r.Method == "PUT" && !decodeAPIRequest(w, r, &req) {
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "synonyms")
+		http.Error(w, "only admins can edit synonyms", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, adminShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if err := db.DeleteSynonyms(term); errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "no synonyms for "+term, http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invalidateShared("synonyms")
+		audit(r, cu, "synonyms.delete", "", term)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var synonyms []string
+	for _, s := range req.Synonyms {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == "" || s == term {
+			continue
+		}
+		if strings.ContainsFunc(s, unicode.IsSpace) {
+			http.Error(w, "synonyms must be single words: "+s, http.StatusBadRequest)
+			return
+		}
+		synonyms = append(synonyms, s)
+	}
+	slices.Sort(synonyms)
+	synonyms = slices.Compact(synonyms)
+	if len(synonyms) == 0 {
+		http.Error(w, "Synonyms required", http.StatusBadRequest)
+		return
+	}
+	if err := db.SaveSynonyms(term, synonyms); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	invalidateShared("synonyms")
+	audit(r, cu, "synonyms.save", "", term+": "+strings.Join(synonyms, ", "))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(synonymsResponse{Term: term, Synonyms: synonyms})
+}
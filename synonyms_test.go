@@ -0,0 +1,142 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSynonymIndex(t *testing.T) {
+	got := synonymIndex(map[string][]string{
+		"k8s":  {"kube", "kubernetes"},
+		"kube": {"kubernetes"},
+		"hr":   {"people"},
+	})
+	want := map[string][]string{
+		"k8s":        {"kube", "kubernetes"},
+		"kube":       {"k8s", "kubernetes"},
+		"kubernetes": {"k8s", "kube"},
+		"hr":         {"people"},
+		"people":     {"hr"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("synonymIndex mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinkQueryWithSynonyms(t *testing.T) {
+	q, err := parseLinkQuery("tag:oncall K8s -hr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.withSynonyms(func(word string) []string {
+		return synonymIndex(map[string][]string{"k8s": {"kubernetes"}, "hr": {"people"}})[strings.ToLower(word)]
+	})
+	cond, args, err := q.sql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCond := "EXISTS (SELECT 1 FROM LinkTags WHERE LinkTags.ID = Links.ID AND LinkTags.Tag = $1)" +
+		" AND (Short ILIKE $2 OR Long ILIKE $2 OR Short ILIKE $3 OR Long ILIKE $3)" +
+		" AND NOT ((Short ILIKE $4 OR Long ILIKE $4 OR Short ILIKE $5 OR Long ILIKE $5))"
+	if cond != wantCond {
+		t.Errorf("cond = %q; want %q", cond, wantCond)
+	}
+	if want := []any{"oncall", "%K8s%", "%kubernetes%", "%hr%", "%people%"}; !cmp.Equal(args, want) {
+		t.Errorf("args = %v; want %v", args, want)
+	}
+}
+
+func TestSynonymSuggestions(t *testing.T) {
+	db = newTestDB(t)
+	t.Cleanup(invalidateSynonyms)
+	db.Save(&Link{Short: "kubernetes-dashboard", Long: "https://k8s.example.com/"})
+	db.Save(&Link{Short: "people", Long: "https://hr.example.com/"})
+	db.Save(&Link{Short: "people-handbook", Long: "https://hr.example.com/handbook", MaxUses: 1})
+	db.Save(&Link{Short: "kube-dashboard", Long: "https://old.example.com/", Expires: time.Now().Add(-time.Hour)})
+	db.SaveSynonyms("k8s", []string{"kube", "kubernetes"})
+	db.SaveSynonyms("people", []string{"hr"})
+	invalidateSynonyms()
+
+	tests := []struct {
+		short string
+		want  []string
+	}{
+		{"k8s-dashboard", []string{"kubernetes-dashboard"}},
+		{"K8s-Dashboard", []string{"kubernetes-dashboard"}},
+		{"hr", []string{"people"}},
+		{"hr-handbook", nil}, // one-time links are not suggested
+		{"wiki", nil},
+	}
+	for _, tt := range tests {
+		links, err := synonymSuggestions(tt.short)
+		if err != nil {
+			t.Fatalf("synonymSuggestions(%q) returned error: %v", tt.short, err)
+		}
+		var got []string
+		for _, link := range links {
+			got = append(got, link.Short)
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("synonymSuggestions(%q) mismatch (-want +got):\n%s", tt.short, diff)
+		}
+	}
+}
+
+func TestServeSynonyms(t *testing.T) {
+	db = newTestDB(t)
+	t.Cleanup(invalidateSynonyms)
+
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		serveSynonyms(w, r)
+		return w
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com"}, nil }
+	if w := do("PUT", "/.api/v1/synonyms/k8s", `{"Synonyms": ["kubernetes"]}`); w.Code != http.StatusForbidden {
+		t.Errorf("non-admin PUT = %d; want %d", w.Code, http.StatusForbidden)
+	}
+
+	currentUser = func(*http.Request) (user, error) { return user{login: "foo@example.com", isAdmin: true}, nil }
+	if w := do("PUT", "/.api/v1/synonyms/k8s", `{"Synonyms": ["k8s", " "]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT without synonyms = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := do("PUT", "/.api/v1/synonyms/k8s", `{"Synonyms": ["container platform"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT with spaces = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := do("PUT", "/.api/v1/synonyms/K8s", `{"Synonyms": ["Kubernetes", "kube", "kube"]}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := synonymsOf("kubernetes"), []string{"k8s"}; !cmp.Equal(got, want) {
+		t.Errorf("synonymsOf(kubernetes) = %q; want %q", got, want)
+	}
+
+	w := do("GET", "/.api/v1/synonyms", "")
+	if want := `{"k8s":["kube","kubernetes"]}` + "\n"; w.Body.String() != want {
+		t.Errorf("GET = %q; want %q", w.Body.String(), want)
+	}
+
+	if w := do("DELETE", "/.api/v1/synonyms/k8s", ""); w.Code != http.StatusNoContent {
+		t.Errorf("DELETE = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if w := do("DELETE", "/.api/v1/synonyms/k8s", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	if got := synonymsOf("kubernetes"); got != nil {
+		t.Errorf("synonymsOf(kubernetes) after DELETE = %q; want none", got)
+	}
+}
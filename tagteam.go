@@ -0,0 +1,80 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tagTeams maps Tailscale ACL tags, such as "tag:ci", to the name of the
+// team that acts for nodes with the tag, from --tag-teams. Links created
+// from those nodes are owned by the team and placed in its namespace.
+var tagTeams map[string]string
+
+// parseTagTeams parses comma-separated tag=team pairs, such as
+// "tag:ci=sre,tag:deploy=platform".
+func parseTagTeams(s string) (map[string]string, error) {
+	teams := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		tag, team, ok := strings.Cut(pair, "=")
+		tag, team = strings.TrimSpace(tag), strings.TrimSpace(team)
+		if !ok || team == "" {
+			return nil, fmt.Errorf("invalid tag team %q: want tag=team", pair)
+		}
+		if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+			return nil, fmt.Errorf("invalid tag %q: want tag:name", tag)
+		}
+		if _, dup := teams[tag]; dup {
+			return nil, fmt.Errorf("tag %q mapped more than once", tag)
+		}
+		teams[tag] = team
+	}
+	return teams, nil
+}
+
+// tagTeam returns the name of the team that u acts for because of its ACL
+// tags, or "" if none. If more than one of u's tags is mapped to a team,
+// the first in u.tags is used.
+func tagTeam(u user) string {
+	for _, tag := range u.tags {
+		if team, ok := tagTeams[tag]; ok {
+			return team
+		}
+	}
+	return ""
+}
+
+// inNamespace returns short in namespace ns, unless short already has a
+// namespace or ns is empty.
+func inNamespace(short, ns string) string {
+	if ns == "" || linkNamespace(short) != "" {
+		return short
+	}
+	return ns + "." + short
+}
+
+// tagTeamDefaults returns the team whose namespace and ownership apply to
+// links created by u, or nil if u's tags are not mapped to a team.
+func tagTeamDefaults(u user) (*Team, error) {
+	name := tagTeam(u)
+	if name == "" {
+		return nil, nil
+	}
+	team, err := db.LoadTeam(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading team %q for --tag-teams: %w", name, err)
+	}
+	return team, nil
+}
+
+// actsForTeam reports whether u's ACL tags are mapped to the named team.
+func actsForTeam(u user, team string) bool {
+	name := tagTeam(u)
+	return name != "" && linkID(name) == linkID(team)
+}
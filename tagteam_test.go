@@ -0,0 +1,72 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseTagTeams(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]string
+		wantErr bool
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "tag:ci=sre, tag:deploy = platform", want: map[string]string{"tag:ci": "sre", "tag:deploy": "platform"}},
+		{in: "tag:ci", wantErr: true},
+		{in: "tag:ci=", wantErr: true},
+		{in: "ci=sre", wantErr: true},
+		{in: "tag:=sre", wantErr: true},
+		{in: "tag:ci=sre,tag:ci=platform", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTagTeams(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTagTeams(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" && !tt.wantErr {
+			t.Errorf("parseTagTeams(%q) mismatch (-want +got):\n%s", tt.in, diff)
+		}
+	}
+}
+
+func TestTagTeam(t *testing.T) {
+	oldTagTeams := tagTeams
+	t.Cleanup(func() { tagTeams = oldTagTeams })
+	tagTeams = map[string]string{"tag:ci": "sre", "tag:deploy": "platform"}
+
+	tests := []struct {
+		tags []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"tag:web"}, ""},
+		{[]string{"tag:web", "tag:ci"}, "sre"},
+		{[]string{"tag:deploy", "tag:ci"}, "platform"},
+	}
+	for _, tt := range tests {
+		if got := tagTeam(user{login: "tagged-devices", tags: tt.tags}); got != tt.want {
+			t.Errorf("tagTeam(%q) = %q; want %q", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestInNamespace(t *testing.T) {
+	tests := []struct {
+		short, ns, want string
+	}{
+		{"deploy", "", "deploy"},
+		{"deploy", "sre", "sre.deploy"},
+		{"eng.deploy", "sre", "eng.deploy"},
+	}
+	for _, tt := range tests {
+		if got := inNamespace(tt.short, tt.ns); got != tt.want {
+			t.Errorf("inNamespace(%q, %q) = %q; want %q", tt.short, tt.ns, got, tt.want)
+		}
+	}
+}
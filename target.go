@@ -0,0 +1,86 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// allowedTargetSchemes returns the lowercased URL schemes that link
+// destinations may use, as set by --allowed-schemes.
+func allowedTargetSchemes() []string {
+	var schemes []string
+	for _, s := range strings.Split(*allowedSchemes, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			schemes = append(schemes, s)
+		}
+	}
+	return schemes
+}
+
+// isGolinkHost reports whether host, which may include a port, is one of the
+// names golink itself is served on: --hostname, its MagicDNS name, or
+// --public-hostname.
+func isGolinkHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	name := strings.ToLower(*hostname)
+	if h, _, ok := strings.Cut(name, ":"); ok {
+		name = h
+	}
+	if host == name || strings.HasPrefix(host, name+".") {
+		return true
+	}
+	return *publicHostname != "" && host == strings.ToLower(*publicHostname)
+}
+
+// checkLinkTarget validates the destination long of a link being saved. long
+// must be a valid link template that expands to an absolute URL using one of
+// allowedTargetSchemes, and must not point back at golink, which would cause
+// a redirect loop. Targets on golink's own pages, such as /.all, are
+// allowed.
+//
+// Templates are checked by expanding them for a request with no path.
+func checkLinkTarget(long string) error {
+	target := long
+	if strings.Contains(long, "{{") {
+		tmpl, err := parseLinkTemplate(long)
+		if err != nil {
+			return fmt.Errorf("long contains an invalid template: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		if err := tmpl.Execute(buf, expandEnv{Now: time.Now().UTC(), user: "user@example.com"}); err != nil {
+			return fmt.Errorf("long contains an invalid template: %v", err)
+		}
+		target = buf.String()
+	}
+	u, err := url.Parse(strings.TrimSpace(target))
+	if err != nil {
+		return fmt.Errorf("long is not a valid URL: %v", err)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	switch {
+	case scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+		if !strings.HasPrefix(u.Path, "/.") {
+			return fmt.Errorf("long %q points back to %s, which would cause a redirect loop", long, goHostname())
+		}
+		return nil
+	case scheme == "":
+		return fmt.Errorf("long %q must be an absolute URL, such as https://example.com/", long)
+	case !slices.Contains(allowedTargetSchemes(), scheme):
+		return fmt.Errorf("long %q uses unsupported scheme %q; allowed schemes are %s", long, scheme, strings.Join(allowedTargetSchemes(), ", "))
+	}
+	if (scheme == "http" || scheme == "https") && isGolinkHost(u.Host) && !strings.HasPrefix(u.Path, "/.") {
+		return fmt.Errorf("long %q points back to %s, which would cause a redirect loop", long, goHostname())
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import "testing"
+
+func TestCheckLinkTarget(t *testing.T) {
+	oldSchemes, oldPublic := *allowedSchemes, *publicHostname
+	t.Cleanup(func() { *allowedSchemes, *publicHostname = oldSchemes, oldPublic })
+	*allowedSchemes = "http, HTTPS, slack"
+	*publicHostname = "links.example.com"
+
+	tests := []struct {
+		long    string
+		wantErr bool
+	}{
+		{"https://example.com/", false},
+		{"HTTP://example.com/{{.Path}}", false},
+		{"slack://channel?team=T1&id=C1", false},
+		{"{{if .Path}}https://example.com/{{.Path}}{{else}}https://example.com/{{end}}", false},
+		{"/.all", false},
+		{"http://go/.detail/foo", false},
+		{"https://{{.Path}}", false},
+		{"ftp://example.com/", true},
+		{"javascript:alert(1)", true},
+		{"{{`javascript:`}}alert(1)", true},
+		{"example.com/foo", true},
+		{"//example.com/foo", true},
+		{"https://example.com/{{.Path", true},
+		{"https://example.com/{{.Invalid}}", true},
+		{"http://go/foo", true},
+		{"http://GO:80/foo", true},
+		{"https://go.example.ts.net/foo", true},
+		{"https://links.example.com/foo", true},
+		{"/foo", true},
+		{"https://golang.org/", false},
+	}
+	for _, tt := range tests {
+		if err := checkLinkTarget(tt.long); (err != nil) != tt.wantErr {
+			t.Errorf("checkLinkTarget(%q) = %v; want error %v", tt.long, err, tt.wantErr)
+		}
+	}
+}
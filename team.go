@@ -0,0 +1,346 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/xsrftoken"
+)
+
+// teamOwnerPrefix is prepended to a team name to form the Owner of links
+// owned by that team, such as "team:sre".
+const teamOwnerPrefix = "team:"
+
+// teamsShortName is used as the short name for generating XSRF tokens
+// when creating, updating, or deleting teams.
+const teamsShortName = ".teams"
+
+var reNamespace = regexp.MustCompile(`^\w[\w\-]*$`)
+
+// IsMember reports whether login is a member of the team.
+func (t *Team) IsMember(login string) bool {
+	return login != "" && slices.Contains(t.Members, login)
+}
+
+// HasLink reports whether link is owned by the team or is in its namespace.
+func (t *Team) HasLink(link *Link) bool {
+	if linkID(link.Owner) == linkID(teamOwnerPrefix+t.Name) {
+		return true
+	}
+	ns := linkID(t.Namespace)
+	return ns != "" && linkID(linkNamespace(link.Short)) == ns
+}
+
+// isTeamMember reports whether login is a member of the named team.
+func isTeamMember(name, login string) bool {
+	team, err := db.LoadTeam(name)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("loading team %q: %v", name, err)
+		}
+		return false
+	}
+	return team.IsMember(login)
+}
+
+// parseMembers parses a comma or space separated list of user logins,
+// returning them sorted and without duplicates.
+func parseMembers(s string) []string {
+	members := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	sort.Strings(members)
+	return slices.Compact(members)
+}
+
+// teamLink is a link shown on a team page, along with its click count.
+type teamLink struct {
+	*Link
+	Clicks int
+}
+
+// teamData is the data used by teamTmpl.
+type teamData struct {
+	Team        *Team
+	Links       []teamLink // all links in JSON, or the links on this page
+	TotalClicks int
+	Editable    bool
+	Admin       bool // whether the current user may change the namespace
+	XSRF        string
+	pagination  `json:"-"`
+}
+
+// teamsData is the data used by teamsTmpl.
+type teamsData struct {
+	Teams    []*Team
+	XSRF     string
+	ReadOnly bool
+	Admin    bool // whether the current user may claim a namespace
+}
+
+// serveTeams lists all teams, or saves or deletes a team on POST requests.
+func serveTeams(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		serveSaveTeam(w, r)
+		return
+	}
+
+	teams, err := db.LoadTeams()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !acceptHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(teams)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	teamsTmpl.Execute(w, teamsData{
+		Teams:    teams,
+		XSRF:     xsrftoken.Generate(xsrfKey, cu.login, teamsShortName),
+		ReadOnly: *readonly,
+		Admin:    authz.canAdmin(cu),
+	})
+}
+
+// serveTeam shows a team along with the links it owns and the links in its
+// namespace.
+func serveTeam(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/.team/")
+
+	team, err := db.LoadTeam(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if name != team.Name {
+		// redirect to canonical team name
+		http.Redirect(w, r, "/.team/"+team.Name, http.StatusFound)
+		return
+	}
+
+	links, err := loadTeamLinks(team)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := teamData{Team: team}
+	stats.mu.Lock()
+	for _, link := range links {
+		if !team.HasLink(link) {
+			continue
+		}
+		clicks := stats.clicks[link.Short]
+		data.Links = append(data.Links, teamLink{Link: link, Clicks: clicks})
+		data.TotalClicks += clicks
+	}
+	stats.mu.Unlock()
+	sort.Slice(data.Links, func(i, j int) bool {
+		return data.Links[i].Short < data.Links[j].Short
+	})
+
+	if !acceptHTML(r) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(data)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Admin = authz.canAdmin(cu)
+	data.Editable = !*readonly && (data.Admin || team.IsMember(cu.login))
+	data.XSRF = xsrftoken.Generate(xsrfKey, cu.login, teamsShortName)
+	data.Links, data.pagination = paginate(r, data.Links)
+	teamTmpl.Execute(w, data)
+}
+
+// loadTeamLinks returns the links owned by team or in its namespace.
+func loadTeamLinks(team *Team) ([]*Link, error) {
+	// The query matches team owners ignoring case and hyphens, and the
+	// namespace by ID prefix, and HasLink decides under the link ID
+	// strategy.
+	owner := strings.ToLower(strings.ReplaceAll(teamOwnerPrefix+team.Name, "-", ""))
+	cond := "lower(replace(Owner, '-', '')) = $1"
+	args := []any{owner}
+	if ns := linkID(team.Namespace); ns != "" {
+		cond += " OR left(ID, length($2)) = $2"
+		args = append(args, ns+".")
+	}
+	links, err := db.LoadWhere(cond, args...)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(links, func(l *Link) bool { return !team.HasLink(l) }), nil
+}
+
+// serveSaveTeam creates, updates, or deletes a team. Any user may create a
+// team, and is added as a member. Existing teams may only be changed by their
+// members or by admins. Members of a team may edit the links in its
+// namespace, so only admins may set or change it.
+func serveSaveTeam(w http.ResponseWriter, r *http.Request) {
+	if *readonly {
+		http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		http.Error(w, "name required", http.StatusBadRequest)
+		return
+	}
+	if !reShortName.MatchString(name) {
+		http.Error(w, "name may only contain letters, numbers, dash, and period", http.StatusBadRequest)
+		return
+	}
+	namespace := strings.TrimSpace(r.FormValue("namespace"))
+	if namespace != "" && !reNamespace.MatchString(namespace) {
+		http.Error(w, "namespace may only contain letters, numbers, and dash", http.StatusBadRequest)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if cu.login == "" {
+		http.Error(w, "teams can only be changed by known users", http.StatusForbidden)
+		return
+	}
+	if !isRequestAuthorized(r, cu, teamsShortName) {
+		http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+		return
+	}
+
+	team, err := db.LoadTeam(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if team != nil && !authz.canAdmin(cu) && !team.IsMember(cu.login) {
+		http.Error(w, fmt.Sprintf("only members of %s can change it", team.Name), http.StatusForbidden)
+		return
+	}
+
+	if r.FormValue("delete") != "" {
+		if team == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := db.DeleteTeam(team.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/.teams", http.StatusSeeOther)
+		return
+	}
+
+	oldNamespace := ""
+	if team != nil {
+		oldNamespace = team.Namespace
+	}
+	if linkID(namespace) != linkID(oldNamespace) && !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "team namespace "+name)
+		http.Error(w, "only admins can set a team's namespace", http.StatusForbidden)
+		return
+	}
+
+	members := parseMembers(r.FormValue("members"))
+	if team == nil {
+		team = &Team{Name: name, Created: time.Now().UTC()}
+		if !slices.Contains(members, cu.login) {
+			members = append(members, cu.login)
+			sort.Strings(members)
+		}
+	}
+	for _, m := range members {
+		exists, err := userExists(r.Context(), m)
+		if err != nil {
+			log.Printf("looking up tailnet user %q: %v", m, err)
+		}
+		if !exists {
+			http.Error(w, "member not a valid user: "+m, http.StatusBadRequest)
+			return
+		}
+	}
+	team.Namespace = namespace
+	team.Members = members
+	if err := db.SaveTeam(team); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if acceptHTML(r) {
+		http.Redirect(w, r, "/.team/"+team.Name, http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(team)
+}
+
+// serveTeamExport handles GET /.api/v1/teams/{name}/export, which exports
+// the links owned by the team or in its namespace, with their click counts,
+// in the same formats as /.export. Team members, devices whose ACL tags act
+// for the team, and admins may export a team's links, so that team leads
+// don't need an admin to run a full export.
+func serveTeamExport(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/.api/v1/teams/"), "/export")
+	if !ok || name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "GET required", http.StatusMethodNotAllowed)
+		return
+	}
+	team, err := db.LoadTeam(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "no team named "+name, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canExportTeam(cu, team.Name) {
+		audit(r, cu, "access.denied", "", "team export "+team.Name)
+		http.Error(w, fmt.Sprintf("only members of team %s and admins can export its links", team.Name), http.StatusForbidden)
+		return
+	}
+	audit(r, cu, "team.export", "", team.Name)
+	serveLinkExport(w, r, team.HasLink)
+}
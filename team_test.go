@@ -0,0 +1,128 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseMembers(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "", want: nil},
+		{in: "foo@example.com", want: []string{"foo@example.com"}},
+		{in: "foo@example.com, bar@example.com foo@example.com", want: []string{"bar@example.com", "foo@example.com"}},
+	}
+	for _, tt := range tests {
+		if got := parseMembers(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parseMembers(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTeamIsMember(t *testing.T) {
+	team := &Team{Name: "sre", Members: []string{"bar@example.com", "foo@example.com"}}
+	tests := []struct {
+		login string
+		want  bool
+	}{
+		{login: "foo@example.com", want: true},
+		{login: "baz@example.com", want: false},
+		{login: "", want: false},
+	}
+	for _, tt := range tests {
+		if got := team.IsMember(tt.login); got != tt.want {
+			t.Errorf("IsMember(%q) = %v; want %v", tt.login, got, tt.want)
+		}
+	}
+}
+
+func TestTeamHasLink(t *testing.T) {
+	team := &Team{Name: "sre", Namespace: "sre"}
+	tests := []struct {
+		link *Link
+		want bool
+	}{
+		{link: &Link{Short: "oncall", Owner: "team:sre"}, want: true},
+		{link: &Link{Short: "oncall", Owner: "team:SRE"}, want: true},
+		{link: &Link{Short: "sre.runbook", Owner: "foo@example.com"}, want: true},
+		{link: &Link{Short: "wiki", Owner: "foo@example.com"}, want: false},
+		{link: &Link{Short: "docs.sre", Owner: "team:docs"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := team.HasLink(tt.link); got != tt.want {
+			t.Errorf("HasLink(%q owned by %q) = %v; want %v", tt.link.Short, tt.link.Owner, got, tt.want)
+		}
+	}
+
+	team.Namespace = ""
+	if team.HasLink(&Link{Short: "wiki", Owner: "foo@example.com"}) {
+		t.Errorf("team without a namespace has unowned link")
+	}
+}
+
+func TestLoadTeamLinks(t *testing.T) {
+	db = newTestDB(t)
+	db.Save(&Link{Short: "oncall", Owner: "team:SRE"})
+	db.Save(&Link{Short: "sre.runbook", Owner: "foo@example.com"})
+	db.Save(&Link{Short: "docs.sre", Owner: "team:docs"})
+	db.Save(&Link{Short: "wiki", Owner: "foo@example.com"})
+
+	links, err := loadTeamLinks(&Team{Name: "sre", Namespace: "sre"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, link := range links {
+		got = append(got, link.Short)
+	}
+	slices.Sort(got)
+	if want := []string{"oncall", "sre.runbook"}; !slices.Equal(got, want) {
+		t.Errorf("loadTeamLinks = %q; want %q", got, want)
+	}
+}
+
+func TestServeSaveTeamNamespace(t *testing.T) {
+	db = newTestDB(t)
+	oldCurrentUser := currentUser
+	t.Cleanup(func() { currentUser = oldCurrentUser })
+
+	save := func(login string, admin bool, form url.Values) int {
+		currentUser = func(*http.Request) (user, error) { return user{login: login, isAdmin: admin}, nil }
+		r := httptest.NewRequest("POST", "/.teams", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set(secHeaderName, "1")
+		w := httptest.NewRecorder()
+		serveSaveTeam(w, r)
+		return w.Code
+	}
+
+	if code := save("foo@example.com", false, url.Values{"name": {"sre"}, "namespace": {"sre"}}); code != http.StatusForbidden {
+		t.Errorf("non-admin creating a team with a namespace = %d; want %d", code, http.StatusForbidden)
+	}
+	if code := save("admin@example.com", true, url.Values{"name": {"sre"}, "namespace": {"sre"}, "members": {"foo@example.com"}}); code >= 400 {
+		t.Fatalf("admin creating a team with a namespace = %d", code)
+	}
+	// members may change other settings, leaving the namespace as it is
+	if code := save("foo@example.com", false, url.Values{"name": {"sre"}, "namespace": {"sre"}, "members": {"foo@example.com, bar@example.com"}}); code >= 400 {
+		t.Errorf("member updating members = %d", code)
+	}
+	if code := save("foo@example.com", false, url.Values{"name": {"sre"}, "namespace": {"eng"}, "members": {"foo@example.com"}}); code != http.StatusForbidden {
+		t.Errorf("member changing the namespace = %d; want %d", code, http.StatusForbidden)
+	}
+	team, err := db.LoadTeam("sre")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.Namespace != "sre" || len(team.Members) != 2 {
+		t.Errorf("team = %+v; want namespace sre with two members", team)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"container/list"
+	"sync"
+	texttemplate "text/template"
+)
+
+// templateKey identifies a parsed link template. Keys include the link's
+// LastEdit so that edits are never served from a stale template, and the
+// template text since a link may resolve to its fallback or maintenance
+// targets rather than Long.
+type templateKey struct {
+	id       string
+	lastEdit int64
+	long     string
+}
+
+type templateEntry struct {
+	key    templateKey
+	tmpl   *texttemplate.Template
+	clicks int  // the link's TotalClicks when last used
+	pinned bool // the link has the pin tag, so the entry is never evicted
+}
+
+// evictionSample is the number of least recently used entries considered
+// for eviction, of which the least clicked is evicted.
+const evictionSample = 8
+
+// templateCache is a size-limited cache of parsed link templates. It evicts
+// the least clicked of its least recently used entries, so that popular
+// links stay cached through bursts of visits to rarely used ones. Entries for
+// links tagged with the pin tag are never evicted and are not counted toward
+// the size limit.
+type templateCache struct {
+	mu     sync.Mutex
+	size   func() int                    // maximum number of unpinned entries; 0 disables caching
+	pinTag func() string                 // tag of links to pin, or nil or "" for none
+	ll     *list.List                    // of *templateEntry, most recently used first
+	items  map[templateKey]*list.Element // elements of ll
+	pinned int                           // number of pinned entries in ll
+}
+
+// linkTemplates caches the parsed templates of template links, so that they
+// are not parsed on every request.
+var linkTemplates = &templateCache{
+	size:   func() int { return *templateCacheSize },
+	pinTag: func() string { return *templatePinTag },
+}
+
+// get returns the parsed template long for link, parsing and caching it if
+// needed.
+func (c *templateCache) get(link *Link, long string) (*texttemplate.Template, error) {
+	size := c.size()
+	if size <= 0 {
+		return parseLinkTemplate(long)
+	}
+	key := templateKey{id: linkID(link.Short), lastEdit: link.LastEdit.Unix(), long: long}
+
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		te := e.Value.(*templateEntry)
+		te.clicks = link.TotalClicks
+		c.mu.Unlock()
+		templateCacheLookups.Add("hit", 1)
+		return te.tmpl, nil
+	}
+	c.mu.Unlock()
+	templateCacheLookups.Add("miss", 1)
+
+	// parse without holding the lock; concurrent misses for the same key
+	// may parse twice, which is harmless.
+	tmpl, err := parseLinkTemplate(long)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ll == nil {
+		c.ll = list.New()
+		c.items = make(map[templateKey]*list.Element)
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		return e.Value.(*templateEntry).tmpl, nil
+	}
+	te := &templateEntry{key: key, tmpl: tmpl, clicks: link.TotalClicks}
+	if c.pinTag != nil && link.HasTag(c.pinTag()) {
+		te.pinned = true
+		c.pinned++
+	}
+	c.items[key] = c.ll.PushFront(te)
+	for c.ll.Len()-c.pinned > size {
+		c.remove(c.victim())
+	}
+	return tmpl, nil
+}
+
+// victim returns the entry to evict: the least clicked of the
+// evictionSample least recently used unpinned entries, preferring the least
+// recently used on ties. There must be an unpinned entry.
+func (c *templateCache) victim() *list.Element {
+	var victim *list.Element
+	n := 0
+	for e := c.ll.Back(); e != nil && n < evictionSample; e = e.Prev() {
+		te := e.Value.(*templateEntry)
+		if te.pinned {
+			continue
+		}
+		if victim == nil || te.clicks < victim.Value.(*templateEntry).clicks {
+			victim = e
+		}
+		n++
+	}
+	return victim
+}
+
+// invalidate removes all cached templates for the link short.
+func (c *templateCache) invalidate(short string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ll == nil {
+		return
+	}
+	id := linkID(short)
+	for e := c.ll.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*templateEntry).key.id == id {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// len returns the number of cached templates.
+func (c *templateCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ll == nil {
+		return 0
+	}
+	return c.ll.Len()
+}
+
+func (c *templateCache) remove(e *list.Element) {
+	c.ll.Remove(e)
+	te := e.Value.(*templateEntry)
+	delete(c.items, te.key)
+	if te.pinned {
+		c.pinned--
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTemplateCache(t *testing.T) {
+	c := &templateCache{size: func() int { return 2 }}
+	now := time.Now()
+	a := &Link{Short: "a", Long: "/a/{{.Path}}", LastEdit: now}
+	b := &Link{Short: "b", Long: "/b/{{.Path}}", LastEdit: now}
+	d := &Link{Short: "d", Long: "/d/{{.Path}}", LastEdit: now}
+
+	t1, err := c.get(a, a.Long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if t2, _ := c.get(a, a.Long); t2 != t1 {
+		t.Error("get did not return cached template")
+	}
+
+	// editing a link changes its key
+	edited := *a
+	edited.LastEdit = now.Add(time.Second)
+	if t3, _ := c.get(&edited, a.Long); t3 == t1 {
+		t.Error("get returned template cached for previous revision")
+	}
+	if n := c.len(); n != 2 {
+		t.Errorf("len = %d; want 2", n)
+	}
+
+	// least recently used entries are evicted
+	c.get(b, b.Long)
+	c.get(d, d.Long)
+	if n := c.len(); n != 2 {
+		t.Errorf("len = %d after eviction; want 2", n)
+	}
+	if t4, _ := c.get(a, a.Long); t4 == t1 {
+		t.Error("get returned evicted template")
+	}
+
+	c.invalidate("A")
+	if n := c.len(); n != 1 {
+		t.Errorf("len = %d after invalidate; want 1", n)
+	}
+
+	if _, err := c.get(b, "{{.Bad"); err == nil {
+		t.Error("get of invalid template succeeded")
+	}
+}
+
+func TestTemplateCacheEviction(t *testing.T) {
+	c := &templateCache{
+		size:   func() int { return 2 },
+		pinTag: func() string { return "hot" },
+	}
+	now := time.Now()
+	link := func(short string, clicks int, tags ...string) *Link {
+		return &Link{Short: short, Long: "/" + short + "/{{.Path}}", LastEdit: now, TotalClicks: clicks, Tags: tags}
+	}
+	popular := link("popular", 1000)
+	pinned := link("pinned", 0, "hot")
+	tPopular, _ := c.get(popular, popular.Long)
+	tPinned, _ := c.get(pinned, pinned.Long)
+
+	// a stream of rarely clicked links evicts each other rather than the
+	// popular link, even though it was used least recently
+	for _, short := range []string{"a", "b", "d", "e"} {
+		l := link(short, 1)
+		c.get(l, l.Long)
+	}
+	if n := c.len(); n != 3 {
+		t.Errorf("len = %d; want 2 plus the pinned entry", n)
+	}
+	if got, _ := c.get(popular, popular.Long); got != tPopular {
+		t.Error("popular link's template was evicted")
+	}
+	if got, _ := c.get(pinned, pinned.Long); got != tPinned {
+		t.Error("pinned link's template was evicted")
+	}
+
+	c.invalidate("pinned")
+	if c.pinned != 0 {
+		t.Errorf("pinned = %d after invalidating the pinned link; want 0", c.pinned)
+	}
+}
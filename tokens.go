@@ -0,0 +1,259 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The tokens API at /.api/v1/tokens lets admins manage API tokens stored in
+// the database:
+//
+//	GET    /.api/v1/tokens       list tokens
+//	POST   /.api/v1/tokens       create a token, returned only in this response
+//	DELETE /.api/v1/tokens/{id}  revoke a token
+//
+// Unlike tokens from --api-tokens-file, stored tokens are limited to their
+// apiScopes, and can only be used with the links and share APIs. Other users
+// may manage device tokens for themselves, limited to deviceScopes.
+
+// apiScopes are the scopes an API token can be granted.
+var apiScopes = []string{"links:read", "links:write", "links:share"}
+
+// deviceScopes are the scopes of tokens that users who are not admins may
+// create for their own devices, such as a phone's share sheet.
+var deviceScopes = []string{"links:share"}
+
+// impliedScopes maps scopes to a broader scope that also grants them.
+var impliedScopes = map[string]string{"links:share": "links:write"}
+
+// apiTokenPrefix begins every stored API token, so that leaked tokens are
+// easy to recognize.
+const apiTokenPrefix = "golink_"
+
+// newAPIToken returns a new random token and its public ID.
+func newAPIToken() (id, token string) {
+	id = strings.ToLower(rand.Text()[:10])
+	return id, apiTokenPrefix + id + "_" + rand.Text()
+}
+
+// hashAPIToken returns the hash of token that is stored in the database.
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// requiredScope returns the scope an API token needs for r, or "" if
+// scoped tokens can't be used for r at all.
+func requiredScope(r *http.Request) string {
+	if r.URL.Path == "/.api/v1/share" {
+		return "links:share"
+	}
+	if r.URL.Path == "/.api/v1/resolve" {
+		return "links:read"
+	}
+	if r.URL.Path == "/.api/v1/shorten" {
+		return "links:write"
+	}
+	if strings.HasPrefix(r.URL.Path, "/.api/v1/teams/") && strings.HasSuffix(r.URL.Path, "/export") {
+		return "links:read"
+	}
+	if r.URL.Path == "/.api/v1/stats/stream" {
+		return "links:read"
+	}
+	if r.URL.Path != "/.api/v1/links" && !strings.HasPrefix(r.URL.Path, "/.api/v1/links/") {
+		return ""
+	}
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return "links:read"
+	}
+	return "links:write"
+}
+
+// checkTokenScopes returns a handler that refuses requests made with a
+// scoped API token that lacks the scope they need.
+func checkTokenScopes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		u, err := identity.requestUser(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if u.scopes != nil {
+			scope := requiredScope(r)
+			if scope == "" {
+				http.Error(w, "API tokens can only be used with /.api/v1/links, /.api/v1/resolve, /.api/v1/share, /.api/v1/shorten, /.api/v1/stats/stream, and team exports", http.StatusForbidden)
+				return
+			}
+			if !slices.Contains(u.scopes, scope) && !slices.Contains(u.scopes, impliedScopes[scope]) {
+				http.Error(w, "API token lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiTokenRequest is the JSON body of a request to create an API token.
+type apiTokenRequest struct {
+	Name   string
+	Login  string // user the token acts as; defaults to the admin creating it
+	Scopes []string
+}
+
+// apiTokenResponse is the response to creating an API token.
+type apiTokenResponse struct {
+	*APIToken
+	Token string // the secret token, which can't be retrieved again
+}
+
+// serveTokens lists or creates API tokens. Users who are not admins see and
+// create only device tokens of their own.
+func serveTokens(w http.ResponseWriter, r *http.Request) {
+	cu, admin, ok := tokenUser(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+		tokens, err := db.LoadTokens()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			tokens = slices.DeleteFunc(tokens, func(t *APIToken) bool { return t.Login != cu.login })
+		}
+		if tokens == nil {
+			tokens = []*APIToken{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+	case "POST":
+		var req apiTokenRequest
+		if !decodeAPIRequest(w, r, &req) {
+			return
+		}
+		if len(req.Scopes) == 0 {
+			http.Error(w, fmt.Sprintf("Scopes required: any of %s", strings.Join(apiScopes, ", ")), http.StatusBadRequest)
+			return
+		}
+		for _, scope := range req.Scopes {
+			if !slices.Contains(apiScopes, scope) {
+				http.Error(w, fmt.Sprintf("unknown scope %q: use %s", scope, strings.Join(apiScopes, ", ")), http.StatusBadRequest)
+				return
+			}
+			if !admin && !slices.Contains(deviceScopes, scope) {
+				audit(r, cu, "access.denied", "", "tokens")
+				http.Error(w, fmt.Sprintf("only admins can create tokens with the %s scope", scope), http.StatusForbidden)
+				return
+			}
+		}
+		if login := strings.TrimSpace(req.Login); !admin && login != "" && login != cu.login {
+			audit(r, cu, "access.denied", "", "tokens")
+			http.Error(w, "only admins can create tokens for other users", http.StatusForbidden)
+			return
+		}
+		id, token := newAPIToken()
+		t := &APIToken{
+			ID:        id,
+			Name:      strings.TrimSpace(req.Name),
+			Login:     cmp.Or(strings.TrimSpace(req.Login), cu.login),
+			Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+			Created:   time.Now().UTC(),
+			CreatedBy: cu.login,
+		}
+		if err := db.CreateToken(t, hashAPIToken(token)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		audit(r, cu, "token.create", "", fmt.Sprintf("id=%s login=%s scopes=%s", t.ID, t.Login, strings.Join(t.Scopes, ",")))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(apiTokenResponse{APIToken: t, Token: token})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveToken revokes the API token named by the request path. Users who are
+// not admins may only revoke their own tokens.
+func serveToken(w http.ResponseWriter, r *http.Request) {
+	cu, admin, ok := tokenUser(w, r)
+	if !ok {
+		return
+	}
+	if r.Method != "DELETE" {
+		w.Header().Set("Allow", "DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/.api/v1/tokens/")
+	if !admin {
+		tokens, err := db.LoadTokens()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !slices.ContainsFunc(tokens, func(t *APIToken) bool { return t.ID == id && t.Login == cu.login }) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	err := db.RevokeToken(id, time.Now().UTC())
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audit(r, cu, "token.revoke", "", "id="+id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tokenUser returns the current user, and whether they may manage the API
+// tokens of all users, if they may manage API tokens at all. Otherwise it
+// writes an error response.
+func tokenUser(w http.ResponseWriter, r *http.Request) (cu user, admin, ok bool) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return cu, false, false
+	}
+	admin = authz.canAdmin(cu)
+	if !admin && cu.login == "" {
+		audit(r, cu, "access.denied", "", "tokens")
+		http.Error(w, "only admins and signed-in users can manage API tokens", http.StatusForbidden)
+		return cu, false, false
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		if *readonly {
+			http.Error(w, "golink is in read-only mode", http.StatusMethodNotAllowed)
+			return cu, admin, false
+		}
+		if !isRequestAuthorized(r, cu, ".tokens") {
+			http.Error(w, "invalid XSRF token", http.StatusBadRequest)
+			return cu, admin, false
+		}
+	}
+	return cu, admin, true
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIToken(t *testing.T) {
+	id, token := newAPIToken()
+	if !strings.HasPrefix(token, apiTokenPrefix+id+"_") {
+		t.Errorf("newAPIToken() = %q, %q; want token starting with %q", id, token, apiTokenPrefix+id+"_")
+	}
+	if _, token2 := newAPIToken(); token2 == token {
+		t.Errorf("newAPIToken returned %q twice", token)
+	}
+	if h := hashAPIToken(token); len(h) != 64 || strings.Contains(h, id) {
+		t.Errorf("hashAPIToken(%q) = %q; want 64 hex digits", token, h)
+	}
+}
+
+// scopedIdentity identifies every request as u.
+type scopedIdentity struct{ u user }
+
+func (p scopedIdentity) requestUser(r *http.Request) (user, error)                  { return p.u, nil }
+func (p scopedIdentity) userExists(ctx context.Context, login string) (bool, error) { return true, nil }
+
+func TestCheckTokenScopes(t *testing.T) {
+	defer func(old identityProvider) { identity = old }(identity)
+
+	h := checkTokenScopes(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		scopes []string
+		method string
+		path   string
+		bearer bool
+		want   int
+	}{
+		{scopes: []string{"links:read"}, method: "GET", path: "/.api/v1/links", bearer: true, want: 200},
+		{scopes: []string{"links:read"}, method: "GET", path: "/.api/v1/links/foo", bearer: true, want: 200},
+		{scopes: []string{"links:read"}, method: "PUT", path: "/.api/v1/links/foo", bearer: true, want: 403},
+		{scopes: []string{"links:read", "links:write"}, method: "DELETE", path: "/.api/v1/links/foo", bearer: true, want: 200},
+		{scopes: []string{"links:share"}, method: "POST", path: "/.api/v1/share", bearer: true, want: 200},
+		{scopes: []string{"links:write"}, method: "POST", path: "/.api/v1/share", bearer: true, want: 200},
+		{scopes: []string{"links:read"}, method: "POST", path: "/.api/v1/share", bearer: true, want: 403},
+		{scopes: []string{"links:share"}, method: "POST", path: "/.api/v1/links", bearer: true, want: 403},
+		{scopes: []string{"links:write"}, method: "POST", path: "/.api/v1/shorten", bearer: true, want: 200},
+		{scopes: []string{"links:read"}, method: "POST", path: "/.api/v1/shorten", bearer: true, want: 403},
+		{scopes: []string{"links:write"}, method: "POST", path: "/.api/v1/tokens", bearer: true, want: 403},
+		{scopes: []string{"links:write"}, method: "POST", path: "/.merge", bearer: true, want: 403},
+		{scopes: nil, method: "POST", path: "/.merge", bearer: true, want: 200},      // --api-tokens-file
+		{scopes: []string{"links:read"}, method: "POST", path: "/.merge", want: 200}, // not a token request
+	}
+	for _, tt := range tests {
+		identity = scopedIdentity{user{login: "bot@example.com", scopes: tt.scopes}}
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.bearer {
+			r.Header.Set("Authorization", "Bearer "+apiTokenPrefix+"x")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s with scopes %v = %d; want %d", tt.method, tt.path, tt.scopes, w.Code, tt.want)
+		}
+	}
+}
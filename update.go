@@ -0,0 +1,289 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releaseManifest describes the latest golink release, as published at
+// --update-url. The manifest is signed with the release key, and the
+// base64 ed25519 signature of its exact bytes is published at the same URL
+// with ".sig" appended.
+type releaseManifest struct {
+	Version  string
+	Binaries map[string]releaseBinary // keyed by platform, such as "linux/arm64" or "linux/armv7"
+}
+
+// releaseBinary is a golink binary for one platform.
+type releaseBinary struct {
+	URL    string
+	SHA256 string // hex encoded
+}
+
+// updateCheck is the result of checking for an update, as returned by
+// /.api/v1/update.
+type updateCheck struct {
+	Current   string
+	Latest    string
+	Platform  string
+	Available bool // a newer release exists for this platform
+}
+
+// updateClient fetches releases. Run replaces it with an outboundClient.
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// platform returns the release platform of the running binary.
+func platform() string {
+	p := runtime.GOOS + "/" + runtime.GOARCH
+	if runtime.GOARCH == "arm" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "GOARM" {
+					p += "v" + strings.TrimSuffix(s.Value, ",softfloat")
+				}
+			}
+		}
+	}
+	return p
+}
+
+// fetch returns the body of url, up to limit bytes.
+func fetch(url string, limit int64) ([]byte, error) {
+	resp, err := updateClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, fmt.Errorf("fetching %s: response too large", url)
+	}
+	return b, nil
+}
+
+// parseUpdateKey parses a base64 ed25519 public key from --update-public-key.
+func parseUpdateKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is %d bytes; want %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// verifyManifest parses manifest after checking sig, its base64 signature
+// by key.
+func verifyManifest(manifest, sig []byte, key ed25519.PublicKey) (*releaseManifest, error) {
+	s, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+	if !ed25519.Verify(key, manifest, s) {
+		return nil, errors.New("release manifest signature is invalid")
+	}
+	m := new(releaseManifest)
+	if err := json.Unmarshal(manifest, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// newerVersion reports whether version a is newer than b. Versions are
+// compared as dot separated numbers after a leading "v", ignoring any
+// pre-release or build suffix. Unparseable versions, such as "(devel)",
+// are older than any release.
+func newerVersion(a, b string) bool {
+	parse := func(v string) []int {
+		v, ok := strings.CutPrefix(v, "v")
+		if !ok {
+			return nil
+		}
+		if i := strings.IndexAny(v, "-+"); i >= 0 {
+			v = v[:i]
+		}
+		var nums []int
+		for _, p := range strings.Split(v, ".") {
+			n, err := strconv.Atoi(p)
+			if err != nil {
+				return nil
+			}
+			nums = append(nums, n)
+		}
+		return nums
+	}
+	va, vb := parse(a), parse(b)
+	if va == nil {
+		return false
+	}
+	if vb == nil {
+		return true
+	}
+	for i := 0; i < max(len(va), len(vb)); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+// checkUpdate fetches and verifies the release manifest from --update-url.
+func checkUpdate() (*releaseManifest, updateCheck, error) {
+	res := updateCheck{Current: buildVersion().Version, Platform: platform()}
+	if *updateURL == "" {
+		return nil, res, errors.New("updates require --update-url")
+	}
+	key, err := parseUpdateKey(*updatePublicKey)
+	if err != nil {
+		return nil, res, fmt.Errorf("--update-public-key: %w", err)
+	}
+	manifest, err := fetch(*updateURL, 1<<20)
+	if err != nil {
+		return nil, res, err
+	}
+	sig, err := fetch(*updateURL+".sig", 1<<10)
+	if err != nil {
+		return nil, res, err
+	}
+	m, err := verifyManifest(manifest, sig, key)
+	if err != nil {
+		return nil, res, err
+	}
+	res.Latest = m.Version
+	_, ok := m.Binaries[res.Platform]
+	res.Available = ok && newerVersion(m.Version, res.Current)
+	return m, res, nil
+}
+
+// applyUpdate downloads the binary for this platform from m, verifies its
+// checksum, and atomically replaces the running executable with it.
+// The new version is used once golink is restarted.
+func applyUpdate(m *releaseManifest) error {
+	bin, ok := m.Binaries[platform()]
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s", m.Version, platform())
+	}
+	want, err := hex.DecodeString(bin.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("release %s has an invalid checksum for %s", m.Version, platform())
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	resp, err := updateClient.Get(bin.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: %s", bin.URL, resp.Status)
+	}
+
+	// write alongside the executable so that the rename is atomic
+	f, err := os.CreateTemp(filepath.Dir(exe), ".golink-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, want) {
+		return fmt.Errorf("downloaded binary checksum %x does not match release checksum %x", got, want)
+	}
+	if err := os.Chmod(f.Name(), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), exe)
+}
+
+// runUpdate runs "golink update", which installs the latest release, or
+// "golink update check", which only reports whether one is available.
+func runUpdate(args []string, w io.Writer) error {
+	checkOnly := len(args) == 1 && args[0] == "check"
+	if len(args) > 0 && !checkOnly {
+		return errors.New("usage: golink update [check]")
+	}
+	m, res, err := checkUpdate()
+	if err != nil {
+		return err
+	}
+	if !res.Available {
+		fmt.Fprintf(w, "golink %s is up to date (latest release %s for %s)\n", res.Current, res.Latest, res.Platform)
+		return nil
+	}
+	if checkOnly {
+		fmt.Fprintf(w, "golink %s is available for %s (running %s)\n", res.Latest, res.Platform, res.Current)
+		return nil
+	}
+	if err := applyUpdate(m); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "updated golink from %s to %s; restart golink to use it\n", res.Current, res.Latest)
+	return nil
+}
+
+// serveUpdateCheck reports to admins whether a newer release is available.
+// Updates are only applied with the "golink update" command.
+func serveUpdateCheck(w http.ResponseWriter, r *http.Request) {
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		http.Error(w, "only admins can check for updates", http.StatusForbidden)
+		return
+	}
+	_, res, err := checkUpdate()
+	if err != nil {
+		log.Printf("checking for update: %v", err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"v1.2.0", "v1.1.9", true},
+		{"v1.10.0", "v1.9.0", true},
+		{"v1.2", "v1.2.0", false},
+		{"v1.2.1", "v1.2.1-rc1", false},
+		{"v1.1.0", "v1.2.0", false},
+		{"v1.0.0", "(devel)", true},
+		{"(devel)", "v1.0.0", false},
+		{"latest", "v1.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := newerVersion(tt.a, tt.b); got != tt.want {
+			t.Errorf("newerVersion(%q, %q) = %v; want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckUpdate(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := []byte(fmt.Sprintf(`{"Version":"v99.0.0","Binaries":{%q:{"URL":"https://example.com/golink","SHA256":"00"}}}`, platform()))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, manifest))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			w.Write(manifest)
+		case "/manifest.json.sig":
+			w.Write([]byte(sig))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	oldURL, oldKey := *updateURL, *updatePublicKey
+	t.Cleanup(func() { *updateURL, *updatePublicKey = oldURL, oldKey })
+	*updateURL = srv.URL + "/manifest.json"
+	*updatePublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	_, res, err := checkUpdate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Available || res.Latest != "v99.0.0" {
+		t.Errorf("checkUpdate = %+v; want v99.0.0 available", res)
+	}
+
+	// manifests signed by another key are rejected
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*updatePublicKey = base64.StdEncoding.EncodeToString(otherPub)
+	if _, _, err := checkUpdate(); err == nil {
+		t.Error("checkUpdate with wrong key succeeded; want error")
+	}
+}
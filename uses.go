@@ -0,0 +1,57 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxUsesLimit is the largest number of uses a one-time link may be given.
+const maxUsesLimit = 1000
+
+// parseMaxUses parses the max_uses form value of a link, which is empty or
+// 0 for links that can be used any number of times.
+func parseMaxUses(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n > maxUsesLimit {
+		return 0, fmt.Errorf("max_uses must be a number from 0 to %d", maxUsesLimit)
+	}
+	return n, nil
+}
+
+// useLink takes a use of link if it is limited to MaxUses resolutions,
+// deleting it after its last use. It reports whether the link may be
+// served, having written an error response if not.
+func useLink(w http.ResponseWriter, r *http.Request, link *Link) bool {
+	if link.MaxUses == 0 {
+		return true
+	}
+	left, err := db.UseLink(link.Short)
+	if errors.Is(err, errLinkUsedUp) {
+		serveErrorPage(w, r, http.StatusGone, errorExpired, link.Short, "link has already been used")
+		return false
+	}
+	if err != nil {
+		log.Printf("using %q: %v", link.Short, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if left == 0 {
+		linkChanges.Add("delete", 1)
+		linkTemplates.invalidate(link.Short)
+		notifyLinkChange("", link, nil)
+	}
+	// each use may go to a different visitor, so don't let it be cached
+	w.Header().Set("Cache-Control", "no-store")
+	return true
+}
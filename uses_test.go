@@ -0,0 +1,73 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestParseMaxUses(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{" 1 ", 1, false},
+		{"1000", 1000, false},
+		{"1001", 0, true},
+		{"-1", 0, true},
+		{"once", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMaxUses(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMaxUses(%q) error = %v; want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseMaxUses(%q) = %d; want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestUseLinkConcurrent uses a link with one use left from many goroutines
+// at once, only one of which may get it.
+func TestUseLinkConcurrent(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Save(&Link{Short: "once", Long: "https://example.com/", MaxUses: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = db.UseLink("once")
+		}()
+	}
+	wg.Wait()
+
+	used := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			used++
+		case !errors.Is(err, errLinkUsedUp):
+			t.Errorf("UseLink: %v; want nil or errLinkUsedUp", err)
+		}
+	}
+	if used != 1 {
+		t.Errorf("link with one use was used %d times", used)
+	}
+	if _, err := db.Load("once"); err == nil {
+		t.Error("link still exists after its last use")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"crypto/fips140"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// versionInfo describes the running golink build, as returned by
+// /.api/v1/version.
+type versionInfo struct {
+	Version      string // main module version, or "(devel)"
+	Commit       string `json:",omitempty"` // VCS revision the binary was built from
+	Modified     bool   `json:",omitempty"` // built with uncommitted changes
+	GoVersion    string
+	Storage      string // storage backend
+	BoringCrypto bool   // built with GOEXPERIMENT=boringcrypto
+	FIPS140      bool   // Go FIPS 140-3 mode is enabled
+	FIPSModule   string `json:",omitempty"` // GOFIPS140 module version selected at build time
+}
+
+// buildVersion returns information about the running build.
+func buildVersion() versionInfo {
+	v := versionInfo{
+		Version: "(devel)",
+		Storage: "postgres",
+		FIPS140: fips140.Enabled(),
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return v
+	}
+	v.GoVersion = info.GoVersion
+	if info.Main.Version != "" {
+		v.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			v.Commit = s.Value
+		case "vcs.modified":
+			v.Modified = s.Value == "true"
+		case "GOEXPERIMENT":
+			for _, exp := range strings.Split(s.Value, ",") {
+				if exp == "boringcrypto" {
+					v.BoringCrypto = true
+				}
+			}
+		case "GOFIPS140":
+			if s.Value != "off" {
+				v.FIPSModule = s.Value
+			}
+		}
+	}
+	return v
+}
+
+// serveVersion returns build information about golink as JSON.
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildVersion())
+}
@@ -0,0 +1,30 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestServeVersion(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveVersion(w, httptest.NewRequest("GET", "/.api/v1/version", nil))
+
+	var v versionInfo
+	if err := json.NewDecoder(w.Body).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.GoVersion != runtime.Version() {
+		t.Errorf("GoVersion = %q; want %q", v.GoVersion, runtime.Version())
+	}
+	if v.Storage != "postgres" {
+		t.Errorf("Storage = %q; want postgres", v.Storage)
+	}
+	if v.Version == "" {
+		t.Error("Version is empty")
+	}
+}
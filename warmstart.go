@@ -0,0 +1,155 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// A new replica started with --warm-from fetches links from a running
+// replica with the paginated links API, and starts serving redirects to them
+// while it connects to the database in the background, so that they don't
+// wait for the database while many replicas start at once, such as during an
+// incident. Once connected, it seeds its link cache with them, where they are
+// cached like loaded ones, for up to --link-cache-ttl.
+//
+// The links API hides one-time links, which are never warmed: each use must
+// be counted in the database, so they wait for it like other requests.
+
+// warmTimeout limits how long a replica waits for --warm-from before
+// starting with an empty cache.
+const warmTimeout = 30 * time.Second
+
+// fetchPeerLinks returns up to max links from the golink replica at the base
+// URL peer, sorted by short name, authenticating with the API token if it
+// is not empty.
+func fetchPeerLinks(ctx context.Context, client *http.Client, peer, token string, max int) ([]*Link, error) {
+	base, err := url.Parse(strings.TrimSuffix(peer, "/") + "/.api/v1/links")
+	if err != nil {
+		return nil, err
+	}
+	var links []*Link
+	after := ""
+	for len(links) < max {
+		limit := min(max-len(links), maxAPIPageSize)
+		q := url.Values{"limit": {strconv.Itoa(limit)}}
+		if after != "" {
+			q.Set("after", after)
+		}
+		u := *base
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return links, err
+		}
+		var page []*Link
+		if resp.StatusCode != http.StatusOK {
+			b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return links, fmt.Errorf("%s: %s: %s", u.Redacted(), resp.Status, strings.TrimSpace(string(b)))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return links, fmt.Errorf("%s: %w", u.Redacted(), err)
+		}
+		links = append(links, page...)
+		if len(page) < limit {
+			break
+		}
+		after = page[len(page)-1].Short
+	}
+	return links, nil
+}
+
+// warmHandler serves redirects to warmed links until ready is called with
+// the handler to serve everything with once the database is connected.
+// Other requests, and links whose target depends on the database, such as
+// those with fallbacks, fail with 503 Service Unavailable until then.
+type warmHandler struct {
+	links map[string]*Link // by link ID
+	next  atomic.Pointer[http.Handler]
+}
+
+func newWarmHandler(links []*Link) *warmHandler {
+	h := &warmHandler{links: make(map[string]*Link, len(links))}
+	for _, link := range links {
+		h.links[linkID(link.Short)] = link
+	}
+	return h
+}
+
+// ready makes h serve all requests with next.
+func (h *warmHandler) ready(next http.Handler) {
+	h.next.Store(&next)
+}
+
+func (h *warmHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if next := h.next.Load(); next != nil {
+		(*next).ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path == "/healthz" {
+		handleHealthCheck(w, r)
+		return
+	}
+	if (r.Method == "GET" || r.Method == "HEAD") && h.serveLink(w, r) {
+		return
+	}
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "golink is starting, try again shortly", http.StatusServiceUnavailable)
+}
+
+// serveLink redirects to the warmed link named by the request path, as
+// serveGo would, returning false without writing a response if it can't.
+// Its click is counted with the others, and saved once stats are loaded.
+func (h *warmHandler) serveLink(w http.ResponseWriter, r *http.Request) bool {
+	short, remainder, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	link := h.links[linkID(short)]
+	if link == nil || linkExpired(link, time.Now()) {
+		return false
+	}
+	if link.MaxUses > 0 || link.Successor != "" || link.MaintenanceTarget != "" || len(link.Fallbacks) > 0 {
+		return false
+	}
+	env := expandEnv{Now: time.Now().UTC(), Path: remainder}
+	if r.URL.RawQuery != "" {
+		env.query = r.URL.Query()
+	}
+	if usesUser(link.Long) || paramsUseUser(link) {
+		cu, _ := currentUser(r)
+		env.user = cu.login
+	}
+	target, err := expandLinkTarget(link, link.Long, env)
+	if err == nil {
+		err = appendParams(link, target, env)
+	}
+	if err != nil {
+		return false
+	}
+	countClick(link.Short)
+	countClickSource(link.Short, remainder, r.Referer())
+
+	setLinkHeaders(w, link)
+	w.Header().Set("Location", target.String())
+	redirectsServed.Add(1)
+	w.WriteHeader(http.StatusFound)
+	return true
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFetchPeerLinks(t *testing.T) {
+	var shorts []string
+	for i := range 5 {
+		shorts = append(shorts, fmt.Sprintf("link%d", i))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.api/v1/links" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			http.Error(w, "invalid API token", http.StatusUnauthorized)
+			return
+		}
+		limit, _ := strconv.Atoi(r.FormValue("limit"))
+		i := sort.SearchStrings(shorts, r.FormValue("after")+"\x00")
+		var page []*Link
+		for _, short := range shorts[i:min(i+limit, len(shorts))] {
+			page = append(page, &Link{Short: short, Long: "https://" + short + ".example.com/"})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	links, err := fetchPeerLinks(ctx, ts.Client(), ts.URL+"/", "secret", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 5 || links[4].Short != "link4" {
+		t.Errorf("fetched %d links; want all 5", len(links))
+	}
+
+	links, err = fetchPeerLinks(ctx, ts.Client(), ts.URL, "secret", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 3 || links[2].Short != "link2" {
+		t.Errorf("fetched %d links; want the first 3", len(links))
+	}
+
+	if _, err := fetchPeerLinks(ctx, ts.Client(), ts.URL, "wrong", 3); err == nil {
+		t.Errorf("fetch with a wrong token succeeded; want error")
+	}
+}
+
+func TestLinkCacheWarm(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newLinkCache(10, time.Minute)
+	c.warm([]*Link{{Short: "Wiki", Long: "https://wiki.example.com/"}}, now)
+	if link, _ := c.get(linkID("wiki"), now); link == nil || link.Long != "https://wiki.example.com/" {
+		t.Errorf("get(wiki) = %v; want the warmed link", link)
+	}
+	if link, _ := c.get(linkID("wiki"), now.Add(time.Minute)); link != nil {
+		t.Errorf("get(wiki) after the TTL = %v; want nil", link)
+	}
+}
+
+func TestWarmHandler(t *testing.T) {
+	stats.mu.Lock()
+	stats.clicks, stats.dirty, stats.external = nil, nil, nil
+	stats.mu.Unlock()
+
+	h := newWarmHandler([]*Link{
+		{Short: "Wiki", Long: "https://wiki.example.com/"},
+		{Short: "status", Long: "https://status.example.com/", Fallbacks: []string{"https://status2.example.com/"}},
+	})
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/wiki/start")
+	if w.Code != http.StatusFound {
+		t.Fatalf("GET /wiki/start = %d; want %d", w.Code, http.StatusFound)
+	}
+	if got, want := w.Header().Get("Location"), "https://wiki.example.com/start"; got != want {
+		t.Errorf("Location = %q; want %q", got, want)
+	}
+	stats.mu.Lock()
+	clicks := stats.dirty["Wiki"]
+	stats.mu.Unlock()
+	if clicks != 1 {
+		t.Errorf("clicks of Wiki = %d; want 1", clicks)
+	}
+
+	// links whose target needs the database, unknown links, and everything
+	// else wait for it
+	for _, path := range []string{"/status", "/missing", "/.all"} {
+		if w := get(path); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s while starting = %d; want %d", path, w.Code, http.StatusServiceUnavailable)
+		}
+	}
+	if w := get("/healthz"); w.Code != http.StatusOK {
+		t.Errorf("GET /healthz while starting = %d; want %d", w.Code, http.StatusOK)
+	}
+
+	h.ready(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	if w := get("/wiki"); w.Code != http.StatusTeapot {
+		t.Errorf("GET /wiki once ready = %d; want it served by the next handler", w.Code)
+	}
+}
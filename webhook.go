@@ -0,0 +1,358 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookEvent is the JSON payload POSTed to webhooks when a link changes.
+type WebhookEvent struct {
+	ID    string // unique per event, for ignoring repeated deliveries
+	Time  time.Time
+	Event string // one of webhookEvents
+	User  string `json:",omitempty"` // login making the change, empty for changes golink makes itself
+
+	// Link is the link after the change, or before it for link.delete.
+	Link *Link `json:",omitempty"`
+
+	// PreviousOwner is the owner before a link.owner change.
+	PreviousOwner string `json:",omitempty"`
+
+	// Alert describes the error budget burn of slo.alert and slo.resolve events.
+	Alert *SLOAlert `json:",omitempty"`
+}
+
+// SLOAlert describes the error budget burn rate that started or ended an
+// --slo alert.
+type SLOAlert struct {
+	Target   float64 // fraction of resolves that must be good
+	Window   string  // period the burn rate is measured over
+	BurnRate float64 // multiple of the rate that spends exactly the error budget
+}
+
+// webhookEvents are the events that webhooks may subscribe to.
+var webhookEvents = []string{"link.create", "link.update", "link.delete", "link.owner", "slo.alert", "slo.resolve"}
+
+// webhook is an endpoint configured in --webhooks-file.
+type webhook struct {
+	url    string
+	secret string
+	events []string // events to deliver, or all if empty
+}
+
+func (h *webhook) wants(event string) bool {
+	return len(h.events) == 0 || slices.Contains(h.events, event)
+}
+
+// parseWebhooks parses a webhooks file of "URL SECRET [EVENTS]" lines, where
+// EVENTS is a comma-separated list of webhookEvents to deliver to the URL.
+func parseWebhooks(r io.Reader) ([]*webhook, error) {
+	var hooks []*webhook
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: want URL, secret, and optional events", n)
+		}
+		u, err := url.Parse(fields[0])
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("line %d: webhook URL must be https://", n)
+		}
+		if len(fields[1]) < 16 {
+			return nil, fmt.Errorf("line %d: secret must be at least 16 characters", n)
+		}
+		h := &webhook{url: fields[0], secret: fields[1]}
+		if len(fields) == 3 {
+			for _, e := range strings.Split(fields[2], ",") {
+				if !slices.Contains(webhookEvents, e) {
+					return nil, fmt.Errorf("line %d: unknown event %q", n, e)
+				}
+				h.events = append(h.events, e)
+			}
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, s.Err()
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of "TIMESTAMP.BODY" keyed
+// with secret, sent as the X-Golink-Signature header.
+func webhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDelivery is an event being delivered to a webhook.
+type webhookDelivery struct {
+	ID          string // event ID
+	Event       string
+	Short       string
+	URL         string
+	Status      string // "pending", "delivered", or "failed"
+	Attempts    int
+	LastAttempt time.Time `json:",omitzero"`
+	NextAttempt time.Time `json:",omitzero"`  // for pending deliveries
+	Error       string    `json:",omitempty"` // of the last attempt
+
+	hook *webhook
+	body []byte
+}
+
+// webhookDispatcher queues webhook events and delivers them in order to
+// each webhook, retrying failed deliveries with exponential backoff.
+type webhookDispatcher struct {
+	hooks       []*webhook
+	client      *http.Client
+	backoff     time.Duration // delay before the first retry, doubled for each later one
+	maxBackoff  time.Duration
+	maxAttempts int
+
+	mu      sync.Mutex
+	pending []*webhookDelivery
+	recent  []*webhookDelivery // finished deliveries, oldest first
+}
+
+const (
+	// maxPendingWebhooks limits the deliveries held while webhooks are unreachable.
+	maxPendingWebhooks = 10000
+
+	// maxRecentWebhooks is the number of finished deliveries kept for /.api/v1/webhooks.
+	maxRecentWebhooks = 200
+)
+
+// webhooks delivers link changes to the --webhooks-file endpoints, or is
+// nil if none are configured.
+var webhooks *webhookDispatcher
+
+func newWebhookDispatcher(hooks []*webhook) *webhookDispatcher {
+	return &webhookDispatcher{
+		hooks:       hooks,
+		client:      outboundClient(30 * time.Second),
+		backoff:     10 * time.Second,
+		maxBackoff:  time.Hour,
+		maxAttempts: 10,
+	}
+}
+
+// notifyLinkChange sends webhook events for a change to a link made by login,
+// and records it for the admin dashboard: old is nil for created links, and
+// link is nil for deleted links.
+func notifyLinkChange(login string, old, link *Link) {
+	e := dashboardEdit{Time: time.Now().UTC(), User: login}
+	switch {
+	case old == nil:
+		e.Action, e.Short = "create", link.Short
+	case link == nil:
+		e.Action, e.Short = "delete", old.Short
+	default:
+		e.Action, e.Short = "update", link.Short
+	}
+	activity.edit(e)
+
+	if webhooks == nil {
+		return
+	}
+	switch {
+	case old == nil:
+		webhooks.add(WebhookEvent{Event: "link.create", User: login, Link: link})
+	case link == nil:
+		webhooks.add(WebhookEvent{Event: "link.delete", User: login, Link: old})
+	default:
+		webhooks.add(WebhookEvent{Event: "link.update", User: login, Link: link})
+		if old.Owner != link.Owner {
+			webhooks.add(WebhookEvent{Event: "link.owner", User: login, Link: link, PreviousOwner: old.Owner})
+		}
+	}
+}
+
+// notifySLO sends a webhook event for an --slo alert starting or ending.
+func notifySLO(event string, alert *SLOAlert) {
+	if webhooks == nil {
+		return
+	}
+	webhooks.add(WebhookEvent{Event: event, Alert: alert})
+}
+
+// add queues e for delivery to the webhooks that want it.
+func (d *webhookDispatcher) add(e WebhookEvent) {
+	e.ID = rand.Text()
+	e.Time = time.Now().UTC()
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("encoding webhook event: %v", err)
+		return
+	}
+	var short string
+	if e.Link != nil {
+		short = e.Link.Short
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, h := range d.hooks {
+		if !h.wants(e.Event) {
+			continue
+		}
+		if len(d.pending) >= maxPendingWebhooks {
+			log.Printf("webhook queue full; dropping %s event for %q to %s", e.Event, short, h.url)
+			continue
+		}
+		d.pending = append(d.pending, &webhookDelivery{
+			ID:          e.ID,
+			Event:       e.Event,
+			Short:       short,
+			URL:         h.url,
+			Status:      "pending",
+			NextAttempt: e.Time,
+			hook:        h,
+			body:        body,
+		})
+	}
+}
+
+// deliver attempts the pending deliveries due at now. So that webhooks see
+// changes in order, a delivery waits for earlier deliveries to the same
+// webhook, until they succeed or are given up on.
+func (d *webhookDispatcher) deliver(now time.Time) error {
+	d.mu.Lock()
+	pending := slices.Clone(d.pending)
+	d.mu.Unlock()
+
+	blocked := make(map[*webhook]bool)
+	var failed int
+	for _, del := range pending {
+		if blocked[del.hook] || del.NextAttempt.After(now) {
+			blocked[del.hook] = true
+			continue
+		}
+		err := d.send(del, now)
+
+		d.mu.Lock()
+		del.Attempts++
+		del.LastAttempt = now
+		switch {
+		case err == nil:
+			del.Status, del.Error = "delivered", ""
+		case del.Attempts >= d.maxAttempts:
+			del.Status, del.Error = "failed", err.Error()
+			log.Printf("webhook %s for %q to %s failed after %d attempts: %v", del.Event, del.Short, del.URL, del.Attempts, err)
+		default:
+			del.Error = err.Error()
+			del.NextAttempt = now.Add(min(d.backoff<<(del.Attempts-1), d.maxBackoff))
+			blocked[del.hook] = true
+			failed++
+		}
+		if del.Status != "pending" {
+			del.NextAttempt = time.Time{}
+			d.recent = append(d.recent, del)
+			if len(d.recent) > maxRecentWebhooks {
+				d.recent = d.recent[len(d.recent)-maxRecentWebhooks:]
+			}
+		}
+		d.mu.Unlock()
+	}
+
+	d.mu.Lock()
+	d.pending = slices.DeleteFunc(d.pending, func(del *webhookDelivery) bool {
+		return del.Status != "pending"
+	})
+	d.mu.Unlock()
+	if failed > 0 {
+		return fmt.Errorf("%d webhook deliveries failed and will be retried", failed)
+	}
+	return nil
+}
+
+// send POSTs a delivery's event to its webhook.
+func (d *webhookDispatcher) send(del *webhookDelivery, now time.Time) error {
+	req, err := http.NewRequest("POST", del.URL, bytes.NewReader(del.body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Golink-Event", del.Event)
+	req.Header.Set("X-Golink-Delivery", del.ID)
+	req.Header.Set("X-Golink-Timestamp", ts)
+	req.Header.Set("X-Golink-Signature", "sha256="+webhookSignature(del.hook.secret, ts, del.body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// webhookLog is the response of /.api/v1/webhooks.
+type webhookLog struct {
+	Pending []webhookDelivery
+	Recent  []webhookDelivery // newest first
+}
+
+// deliveries returns a copy of the pending and recently finished deliveries.
+func (d *webhookDispatcher) deliveries() webhookLog {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := webhookLog{
+		Pending: make([]webhookDelivery, 0, len(d.pending)),
+		Recent:  make([]webhookDelivery, 0, len(d.recent)),
+	}
+	for _, del := range d.pending {
+		l.Pending = append(l.Pending, *del)
+	}
+	for _, del := range slices.Backward(d.recent) {
+		l.Recent = append(l.Recent, *del)
+	}
+	return l
+}
+
+// serveWebhooks returns the webhook delivery log as JSON. Only admins may
+// see it, since it lists the configured webhook URLs.
+func serveWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cu, err := currentUser(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !authz.canAdmin(cu) {
+		audit(r, cu, "access.denied", "", "webhook log")
+		http.Error(w, "only admins can see webhook deliveries", http.StatusForbidden)
+		return
+	}
+	l := webhookLog{Pending: []webhookDelivery{}, Recent: []webhookDelivery{}}
+	if webhooks != nil {
+		l = webhooks.deliveries()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 Tailscale Inc & Contributors
+// SPDX-License-Identifier: BSD-3-Clause
+
+package golink
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseWebhooks(t *testing.T) {
+	hooks, err := parseWebhooks(strings.NewReader(`
+# knowledge base mirror
+https://kb.example.com/hooks/golink 0123456789abcdef
+https://chat.example.com/hook fedcba9876543210 link.create,link.delete
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 2 {
+		t.Fatalf("got %d webhooks; want 2", len(hooks))
+	}
+	if !hooks[0].wants("link.owner") {
+		t.Error("webhook without events does not want link.owner")
+	}
+	if !hooks[1].wants("link.delete") || hooks[1].wants("link.update") {
+		t.Errorf("webhook events = %v; want link.create,link.delete", hooks[1].events)
+	}
+
+	for _, bad := range []string{
+		"https://kb.example.com/hook",
+		"http://kb.example.com/hook 0123456789abcdef",
+		"https://kb.example.com/hook short",
+		"https://kb.example.com/hook 0123456789abcdef link.rename",
+		"https://kb.example.com/hook 0123456789abcdef link.create extra",
+	} {
+		if _, err := parseWebhooks(strings.NewReader(bad)); err == nil {
+			t.Errorf("parseWebhooks(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	const secret = "0123456789abcdef"
+	var (
+		mu       sync.Mutex
+		fail     = true
+		received []WebhookEvent
+	)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := "sha256=" + webhookSignature(secret, r.Header.Get("X-Golink-Timestamp"), body)
+		if got := r.Header.Get("X-Golink-Signature"); got != want {
+			t.Errorf("signature = %q; want %q", got, want)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var e WebhookEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+		}
+		received = append(received, e)
+	}))
+	defer srv.Close()
+
+	d := newWebhookDispatcher([]*webhook{{url: srv.URL, secret: secret}})
+	d.client = srv.Client()
+	d.maxAttempts = 3
+	webhooks = d
+	defer func() { webhooks = nil }()
+
+	old := &Link{Short: "docs", Long: "https://docs.example.com/", Owner: "amelie@example.com"}
+	link := &Link{Short: "docs", Long: "https://docs.example.com/v2", Owner: "bruno@example.com"}
+	notifyLinkChange("amelie@example.com", nil, old)
+	notifyLinkChange("amelie@example.com", old, link)
+
+	now := time.Now()
+	if err := d.deliver(now); err == nil {
+		t.Fatal("deliver succeeded while the webhook is failing")
+	}
+	l := d.deliveries()
+	if len(l.Pending) != 3 || l.Pending[0].Attempts != 1 || l.Pending[1].Attempts != 0 {
+		t.Fatalf("after failure, pending = %+v; want the first of 3 deliveries attempted once", l.Pending)
+	}
+
+	// nothing is due until the backoff has passed
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if err := d.deliver(now.Add(d.backoff / 2)); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("delivered %d events before the backoff passed", len(received))
+	}
+	if err := d.deliver(now.Add(d.backoff)); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for _, e := range received {
+		events = append(events, e.Event)
+	}
+	if got, want := strings.Join(events, ","), "link.create,link.update,link.owner"; got != want {
+		t.Errorf("delivered events = %s; want %s", got, want)
+	}
+	if prev := received[2].PreviousOwner; prev != "amelie@example.com" {
+		t.Errorf("link.owner PreviousOwner = %q; want amelie@example.com", prev)
+	}
+	l = d.deliveries()
+	if len(l.Pending) != 0 || len(l.Recent) != 3 || l.Recent[0].Status != "delivered" {
+		t.Errorf("after delivery, %d pending and %d recent deliveries; want 0 pending and 3 delivered", len(l.Pending), len(l.Recent))
+	}
+
+	// deliveries are given up on after maxAttempts
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	notifyLinkChange("", link, nil)
+	later := time.Now().Add(time.Minute)
+	for i := range d.maxAttempts {
+		d.deliver(later.Add(time.Duration(i) * time.Hour))
+	}
+	l = d.deliveries()
+	if len(l.Pending) != 0 {
+		t.Fatalf("%d deliveries still pending after maxAttempts", len(l.Pending))
+	}
+	if got := l.Recent[0]; got.Status != "failed" || got.Event != "link.delete" || got.Attempts != d.maxAttempts {
+		t.Errorf("last delivery: %s %s after %d attempts; want link.delete failed after %d", got.Event, got.Status, got.Attempts, d.maxAttempts)
+	}
+}